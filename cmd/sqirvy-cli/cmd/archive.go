@@ -0,0 +1,38 @@
+/*
+Copyright © 2025 David Howard  dmh2000@gmail.com
+*/
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	util "github.com/dmh2000/sqirvy-cli/pkg/util"
+
+	"github.com/spf13/viper"
+)
+
+// readArchive returns the text files of a zip or tar archive given as an argument
+// as prompts, framed by their paths in the archive after the archive path. The
+// paths matching archive.ignore in the config file or the .gitignore files of
+// the archive are skipped.
+func readArchive(file string) ([]string, error) {
+	start := time.Now()
+	files, err := util.ReadArchive(file, MaxInputTotalBytes, viper.GetStringSlice("archive.ignore"))
+	if err != nil {
+		return nil, fmt.Errorf("error: %w", err)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("error: archive %s has no text files", file)
+	}
+	prompts := make([]string, 0, len(files))
+	for _, f := range files {
+		name := strings.TrimSuffix(file, "/") + "/" + f.Path
+		warnEncoding(name, f.Encoding)
+		prompts = append(prompts, fmt.Sprintf("--- START FILE: %s ---\n%s\n--- END FILE: %s ---", name, f.Content, name))
+	}
+	slog.Debug("Read archive", "archive", file, "files", len(files), "duration", time.Since(start).Round(time.Millisecond))
+	return prompts, nil
+}
@@ -0,0 +1,501 @@
+/*
+Copyright © 2025 David Howard  dmh2000@gmail.com
+*/
+package cmd
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	sqirvy "github.com/dmh2000/sqirvy-cli/pkg/sqirvy"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// auditRecord is one line of the audit log: who sent which prompt to which model
+// when, and the response. Prompts and responses are recorded as SHA-256 hashes,
+// or as HMAC-SHA256 with a key of an encrypted log, and as text only with
+// audit.include_text.
+type auditRecord struct {
+	Time           time.Time        `json:"time"`
+	User           string           `json:"user"`
+	Host           string           `json:"host"`
+	Command        string           `json:"command"`
+	Provider       string           `json:"provider"`
+	Model          string           `json:"model"`
+	PromptSHA256   string           `json:"prompt_sha256,omitempty"`
+	ResponseSHA256 string           `json:"response_sha256,omitempty"`
+	PromptHMAC     string           `json:"prompt_hmac,omitempty"`
+	ResponseHMAC   string           `json:"response_hmac,omitempty"`
+	InputTokens    int64            `json:"input_tokens"`
+	OutputTokens   int64            `json:"output_tokens"`
+	DurationMS     int64            `json:"duration_ms"`
+	ToolCalls      int              `json:"tool_calls,omitempty"`
+	Seed           *int64           `json:"seed,omitempty"`
+	Fingerprint    string           `json:"system_fingerprint,omitempty"`
+	Error          string           `json:"error,omitempty"`
+	Prompt         []sqirvy.Message `json:"prompt,omitempty"`
+	Response       string           `json:"response,omitempty"`
+}
+
+// auditEncrypted is a line of an encrypted audit log: the record encrypted with
+// AES-256-GCM, the nonce followed by the ciphertext, base64 encoded.
+type auditEncrypted struct {
+	Encrypted string `json:"encrypted"`
+}
+
+// auditHeader is the first line of an encrypted audit log: the parameters that
+// derive the keys of the log from audit.key.
+type auditHeader struct {
+	KDF        string `json:"kdf"`
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+}
+
+// auditHeaderLine wraps the header, so it is told apart from the records.
+type auditHeaderLine struct {
+	Header *auditHeader `json:"audit_header"`
+}
+
+// auditKDF and auditIterations derive the keys of new encrypted logs. Logs are
+// read with the parameters of their header, up to auditMaxIterations.
+const (
+	auditKDF           = "pbkdf2-sha256"
+	auditIterations    = 600000
+	auditMaxIterations = 10000000
+	auditSaltSize      = 16
+)
+
+// auditKeys are the keys of an encrypted audit log: the cipher of the records
+// and the key of the HMACs of the prompts and responses.
+type auditKeys struct {
+	aead cipher.AEAD
+	mac  []byte
+}
+
+// auditMu serializes the writes of the concurrent queries of a process. Lines
+// from different processes are kept whole by O_APPEND.
+var auditMu sync.Mutex
+
+// auditCmd groups the subcommands of the audit log.
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Show the audit log of prompts and responses",
+	Long: `sqirvy-cli audit shows the audit log, an opt-in, append-only JSONL file with a
+line for every query: the time, user, host, command, provider and model, the
+SHA-256 hashes of the prompt and the response, and the token usage.
+With a key, the records are encrypted with AES-256-GCM, with a key derived from
+the passphrase with PBKDF2 and the random salt in the first line of the log, and
+the hashes are HMAC-SHA256 with a second derived key, so they cannot be matched
+against guessed prompts without the passphrase.
+The audit section of the config file turns it on:
+	audit:
+	  enabled: true
+	  file: /var/log/sqirvy-cli/audit.jsonl  # default audit.jsonl in the data directory
+	  include_text: false                    # also record the prompt and response text
+	  key: passphrase                        # encrypt the records, or $SQIRVY_AUDIT_KEY
+`,
+}
+
+var auditShowCmd = &cobra.Command{
+	Use:               "show",
+	Short:             "Print the records of the audit log",
+	Args:              cobra.NoArgs,
+	ValidArgsFunction: cobra.NoFileCompletions,
+	Run: func(cmd *cobra.Command, args []string) {
+		format, _ := cmd.Flags().GetString("format")
+		since, _ := cmd.Flags().GetDuration("since")
+		last, _ := cmd.Flags().GetInt("last")
+
+		records, err := readAuditLog(auditFilePath(), viper.GetString("audit.key"))
+		if err != nil {
+			log.Fatalf("Error executing audit show command: %v", err)
+		}
+		if since > 0 {
+			cutoff := time.Now().Add(-since)
+			kept := records[:0]
+			for _, r := range records {
+				if !r.Time.Before(cutoff) {
+					kept = append(kept, r)
+				}
+			}
+			records = kept
+		}
+		if last > 0 && len(records) > last {
+			records = records[len(records)-last:]
+		}
+
+		switch format {
+		case "json":
+			enc := json.NewEncoder(os.Stdout)
+			for _, r := range records {
+				if err := enc.Encode(r); err != nil {
+					log.Fatalf("Error executing audit show command: %v", err)
+				}
+			}
+		case "text":
+			printAuditRecords(records)
+		default:
+			log.Fatalf("Error executing audit show command: unknown --format %q (use text or json)", format)
+		}
+	},
+}
+
+// initAudit records every query in the audit log if audit.enabled is set, and
+// adds up the usage of the queries for the webhook of --post-to.
+func initAudit() {
+	var audit func(sqirvy.QueryRecord)
+	if viper.GetBool("audit.enabled") {
+		path := auditFilePath()
+		key := viper.GetString("audit.key")
+		includeText := viper.GetBool("audit.include_text")
+		// the keys are derived once, at the first query
+		loadKeys := sync.OnceValues(func() (*auditKeys, error) {
+			if key == "" {
+				return nil, nil
+			}
+			return openAuditKeys(path, key)
+		})
+		audit = func(q sqirvy.QueryRecord) {
+			keys, err := loadKeys()
+			if err == nil {
+				err = appendAuditRecord(path, keys, newAuditRecord(q, includeText, keys))
+			}
+			if err != nil {
+				slog.Warn("Writing the audit log failed", "file", path, "error", err)
+			}
+		}
+	}
+	sqirvy.SetQueryRecorder(func(q sqirvy.QueryRecord) {
+		recordPostUsage(q)
+		if audit != nil {
+			audit(q)
+		}
+	})
+}
+
+// auditFilePath returns the audit log file, from audit.file in the config file or
+// audit.jsonl in the data directory.
+func auditFilePath() string {
+	if path := viper.GetString("audit.file"); path != "" {
+		return path
+	}
+	return dataFileIn("audit.jsonl")
+}
+
+// newAuditRecord returns the audit record of a query. The prompt and response
+// are hashed with SHA-256, or with HMAC-SHA256 if keys is set.
+func newAuditRecord(q sqirvy.QueryRecord, includeText bool, keys *auditKeys) auditRecord {
+	prompt, _ := json.Marshal(q.Messages)
+	r := auditRecord{
+		Time:         q.Time.UTC(),
+		User:         auditUser(),
+		Command:      auditCommand(),
+		Provider:     q.Provider,
+		Model:        q.Model,
+		InputTokens:  q.Usage.InputTokens,
+		OutputTokens: q.Usage.OutputTokens,
+		DurationMS:   q.Duration.Milliseconds(),
+		ToolCalls:    len(q.ToolCalls),
+		Seed:         q.Seed,
+		Fingerprint:  q.Fingerprint,
+	}
+	if keys != nil {
+		r.PromptHMAC = hmacHex(keys.mac, prompt)
+		r.ResponseHMAC = hmacHex(keys.mac, []byte(q.Response))
+	} else {
+		r.PromptSHA256 = sha256Hex(prompt)
+		r.ResponseSHA256 = sha256Hex([]byte(q.Response))
+	}
+	r.Host, _ = os.Hostname()
+	if q.Err != nil {
+		r.Error = q.Err.Error()
+	}
+	if includeText {
+		r.Prompt = q.Messages
+		r.Response = q.Response
+	}
+	return r
+}
+
+// auditUser returns the name of the user running sqirvy-cli.
+func auditUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+// auditCommand returns the sqirvy-cli command being run, e.g. "sqirvy-cli review".
+func auditCommand() string {
+	c, _, err := rootCmd.Find(os.Args[1:])
+	if err != nil {
+		return rootCmd.Name()
+	}
+	return c.CommandPath()
+}
+
+// sha256Hex returns the hex encoded SHA-256 hash of data.
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// hmacHex returns the hex encoded HMAC-SHA256 of data.
+func hmacHex(key, data []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// deriveAuditKeys derives the keys of an encrypted audit log from a passphrase
+// and the header of the log.
+func deriveAuditKeys(key string, h auditHeader) (*auditKeys, error) {
+	if h.KDF != auditKDF || h.Iterations < 1 || h.Iterations > auditMaxIterations || len(h.Salt) < auditSaltSize {
+		return nil, fmt.Errorf("error: unsupported audit log header: kdf %q, %d iterations, %d byte salt", h.KDF, h.Iterations, len(h.Salt))
+	}
+	derived, err := pbkdf2.Key(sha256.New, key, h.Salt, h.Iterations, 64)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(derived[:32])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &auditKeys{aead: aead, mac: derived[32:]}, nil
+}
+
+// readAuditHeader returns the header of an audit log, or nil if its first line
+// is not a header.
+func readAuditHeader(line []byte) *auditHeader {
+	var h auditHeaderLine
+	if json.Unmarshal(line, &h) != nil {
+		return nil
+	}
+	return h.Header
+}
+
+// openAuditKeys returns the keys of the encrypted audit log at path. A new log is
+// created with a header with a random salt; an existing log must start with one.
+func openAuditKeys(path, key string) (*auditKeys, error) {
+	if err := createAuditLog(path); err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*MaxInputTotalBytes)
+	scanner.Scan()
+	h := readAuditHeader(scanner.Bytes())
+	if h == nil {
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("error: audit log %s is not encrypted: move it aside to start an encrypted log", path)
+	}
+	return deriveAuditKeys(key, *h)
+}
+
+// createAuditLog creates an encrypted audit log with a new header if path does
+// not exist. The header is written to a temporary file that is linked to path,
+// so a concurrent process sees either no log or a log with its header.
+func createAuditLog(path string) error {
+	if _, err := os.Stat(path); err == nil || !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	salt := make([]byte, auditSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	line, err := json.Marshal(auditHeaderLine{Header: &auditHeader{KDF: auditKDF, Iterations: auditIterations, Salt: salt}})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(line, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Link(tmp.Name(), path); err != nil && !errors.Is(err, os.ErrExist) {
+		return err
+	}
+	return nil
+}
+
+// appendAuditRecord appends a record to the audit log, encrypted if keys is set.
+func appendAuditRecord(path string, keys *auditKeys, r auditRecord) error {
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if keys != nil {
+		nonce := make([]byte, keys.aead.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return err
+		}
+		sealed := keys.aead.Seal(nonce, nonce, line, nil)
+		if line, err = json.Marshal(auditEncrypted{Encrypted: base64.StdEncoding.EncodeToString(sealed)}); err != nil {
+			return err
+		}
+	}
+
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// readAuditLog returns the records of the audit log, decrypting encrypted records
+// with key.
+func readAuditLog(path, key string) ([]auditRecord, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("error: no audit log at %s (see sqirvy-cli audit --help)", path)
+		}
+		return nil, fmt.Errorf("error: reading audit log: %w", err)
+	}
+	defer f.Close()
+
+	var header *auditHeader
+	var keys *auditKeys
+	var records []auditRecord
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*MaxInputTotalBytes)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		if n == 1 {
+			if header = readAuditHeader(line); header != nil {
+				continue
+			}
+		}
+		var enc auditEncrypted
+		if err := json.Unmarshal(line, &enc); err != nil {
+			return nil, fmt.Errorf("error: audit log %s line %d: %w", path, n, err)
+		}
+		if enc.Encrypted != "" {
+			if key == "" {
+				return nil, fmt.Errorf("error: audit log %s is encrypted: set audit.key or SQIRVY_AUDIT_KEY", path)
+			}
+			if header == nil {
+				return nil, fmt.Errorf("error: audit log %s line %d is encrypted, but the log has no header", path, n)
+			}
+			if keys == nil {
+				if keys, err = deriveAuditKeys(key, *header); err != nil {
+					return nil, err
+				}
+			}
+			if line, err = openAuditLine(keys.aead, enc.Encrypted); err != nil {
+				return nil, fmt.Errorf("error: audit log %s line %d: %w", path, n, err)
+			}
+		}
+		var r auditRecord
+		if err := json.Unmarshal(line, &r); err != nil {
+			return nil, fmt.Errorf("error: audit log %s line %d: %w", path, n, err)
+		}
+		records = append(records, r)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error: reading audit log: %w", err)
+	}
+	return records, nil
+}
+
+// openAuditLine decrypts an encrypted audit record.
+func openAuditLine(aead cipher.AEAD, encrypted string) ([]byte, error) {
+	sealed, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("encrypted record is too short")
+	}
+	line, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, errors.New("cannot decrypt record: wrong audit key or modified record")
+	}
+	return line, nil
+}
+
+// printAuditRecords prints the records as a table, with shortened hashes.
+func printAuditRecords(records []auditRecord) {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TIME\tUSER\tCOMMAND\tMODEL\tTOKENS\tPROMPT\tRESPONSE\tERROR")
+	for _, r := range records {
+		prompt, response := r.PromptSHA256, r.ResponseSHA256
+		if r.PromptHMAC != "" {
+			prompt, response = r.PromptHMAC, r.ResponseHMAC
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d/%d\t%.12s\t%.12s\t%s\n",
+			r.Time.Local().Format(time.DateTime), r.User, r.Command, r.Model,
+			r.InputTokens, r.OutputTokens, prompt, response, r.Error)
+	}
+	tw.Flush()
+}
+
+// auditUsage prints the usage instructions for the audit command.
+func auditUsage(cmd *cobra.Command) error {
+	fmt.Println("Usage: sqirvy-cli audit show [--format text|json] [--since duration] [--last n]")
+	fmt.Println("\nFlags:")
+	cmd.Flags().PrintDefaults()
+	return nil
+}
+
+// init registers the audit command and its subcommands with the root command.
+func init() {
+	auditShowCmd.Flags().String("format", "text", "Output format: text or json (the records as JSONL)")
+	auditShowCmd.Flags().Duration("since", 0, "Show only the records of this period, e.g. 24h")
+	auditShowCmd.Flags().Int("last", 0, "Show only the last n records")
+	auditCmd.AddCommand(auditShowCmd)
+	rootCmd.AddCommand(auditCmd)
+	auditCmd.SetUsageFunc(auditUsage)
+}
@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	sqirvy "github.com/dmh2000/sqirvy-cli/pkg/sqirvy"
+)
+
+func TestAuditLogEncrypted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit", "audit.jsonl")
+	q := sqirvy.QueryRecord{
+		Time:     time.Now(),
+		Provider: sqirvy.Anthropic,
+		Model:    "claude-3-5-haiku-latest",
+		Messages: []sqirvy.Message{{Role: sqirvy.RoleUser, Content: "the secret prompt"}},
+		Response: "the secret response",
+	}
+
+	keys, err := openAuditKeys(path, "passphrase")
+	if err != nil {
+		t.Fatalf("openAuditKeys() error = %v", err)
+	}
+	r := newAuditRecord(q, true, keys)
+	if r.PromptSHA256 != "" || r.ResponseSHA256 != "" || r.PromptHMAC == "" || r.ResponseHMAC == "" {
+		t.Fatalf("record of an encrypted log = %+v, want HMACs instead of SHA-256 hashes", r)
+	}
+	for range 2 {
+		if err := appendAuditRecord(path, keys, r); err != nil {
+			t.Fatalf("appendAuditRecord() error = %v", err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := bytes.Split(bytes.TrimSpace(data), []byte("\n"))
+	if len(lines) != 3 {
+		t.Fatalf("log has %d lines, want a header and 2 records:\n%s", len(lines), data)
+	}
+	h := readAuditHeader(lines[0])
+	if h == nil || h.KDF != auditKDF || h.Iterations != auditIterations || len(h.Salt) != auditSaltSize {
+		t.Fatalf("header = %s", lines[0])
+	}
+	for _, s := range []string{"secret", "prompt_hmac", "prompt_sha256", r.PromptHMAC} {
+		if strings.Contains(string(data), s) {
+			t.Errorf("log contains %q in the clear:\n%s", s, data)
+		}
+	}
+
+	// a second process derives the same keys from the header
+	again, err := openAuditKeys(path, "passphrase")
+	if err != nil {
+		t.Fatalf("openAuditKeys() of an existing log error = %v", err)
+	}
+	if got := newAuditRecord(q, false, again); got.PromptHMAC != r.PromptHMAC {
+		t.Errorf("HMAC with the keys of the existing log = %s, want %s", got.PromptHMAC, r.PromptHMAC)
+	}
+	// another log has another salt, so the same prompt has another HMAC
+	other, err := openAuditKeys(filepath.Join(t.TempDir(), "audit.jsonl"), "passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := newAuditRecord(q, false, other); got.PromptHMAC == r.PromptHMAC {
+		t.Error("two logs with the same passphrase have the same HMAC of a prompt")
+	}
+
+	records, err := readAuditLog(path, "passphrase")
+	if err != nil {
+		t.Fatalf("readAuditLog() error = %v", err)
+	}
+	if len(records) != 2 || records[0].PromptHMAC != r.PromptHMAC || records[1].Response != q.Response {
+		t.Errorf("readAuditLog() = %+v", records)
+	}
+	if _, err := readAuditLog(path, "wrong"); err == nil {
+		t.Error("readAuditLog() with the wrong key succeeded")
+	}
+	if _, err := readAuditLog(path, ""); err == nil {
+		t.Error("readAuditLog() without a key succeeded")
+	}
+}
+
+func TestAuditLogPlaintext(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	q := sqirvy.QueryRecord{Time: time.Now(), Model: "gpt-4o-mini", Response: "response"}
+	r := newAuditRecord(q, false, nil)
+	if r.PromptHMAC != "" || r.ResponseSHA256 != sha256Hex([]byte("response")) {
+		t.Fatalf("record of a plaintext log = %+v, want SHA-256 hashes", r)
+	}
+	if err := appendAuditRecord(path, nil, r); err != nil {
+		t.Fatalf("appendAuditRecord() error = %v", err)
+	}
+	records, err := readAuditLog(path, "")
+	if err != nil || len(records) != 1 || records[0].ResponseSHA256 != r.ResponseSHA256 {
+		t.Fatalf("readAuditLog() = %+v, %v", records, err)
+	}
+	// encrypted records are not appended to a log without a header
+	if _, err := openAuditKeys(path, "passphrase"); err == nil {
+		t.Error("openAuditKeys() of a plaintext log succeeded")
+	}
+}
+
+func TestDeriveAuditKeysHeader(t *testing.T) {
+	salt := bytes.Repeat([]byte{1}, auditSaltSize)
+	tests := []struct {
+		name    string
+		header  auditHeader
+		wantErr bool
+	}{
+		{"valid", auditHeader{KDF: auditKDF, Iterations: 1000, Salt: salt}, false},
+		{"unknown kdf", auditHeader{KDF: "sha256", Iterations: 1000, Salt: salt}, true},
+		{"no iterations", auditHeader{KDF: auditKDF, Salt: salt}, true},
+		{"too many iterations", auditHeader{KDF: auditKDF, Iterations: auditMaxIterations + 1, Salt: salt}, true},
+		{"short salt", auditHeader{KDF: auditKDF, Iterations: 1000, Salt: salt[:4]}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := deriveAuditKeys("passphrase", tt.header); (err != nil) != tt.wantErr {
+				t.Errorf("deriveAuditKeys() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
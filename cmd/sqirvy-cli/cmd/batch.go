@@ -0,0 +1,386 @@
+/*
+Copyright © 2025 David Howard  dmh2000@gmail.com
+*/
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	sqirvy "github.com/dmh2000/sqirvy-cli/pkg/sqirvy"
+	util "github.com/dmh2000/sqirvy-cli/pkg/util"
+
+	"github.com/spf13/cobra"
+)
+
+// batchIndexFile is the name of the summary index written to the output directory.
+const batchIndexFile = "index.json"
+
+// batchResult records the outcome of running the command on one input file.
+type batchResult struct {
+	Input        string  `json:"input"`
+	Output       string  `json:"output,omitempty"`
+	Model        string  `json:"model"`
+	InputTokens  int64   `json:"input_tokens"`
+	OutputTokens int64   `json:"output_tokens"`
+	Cost         float64 `json:"cost_usd"`
+	Attempts     int     `json:"attempts"`
+	LatencyMs    int64   `json:"latency_ms"`
+	Error        string  `json:"error,omitempty"`
+}
+
+// batchCmd represents the command that runs another command once per input file.
+// Files are processed concurrently by a pool of workers that share the client, so
+// the provider rate limits, the budget and the circuit breaker apply to the whole batch.
+var batchCmd = &cobra.Command{
+	Use:   "batch command pattern...",
+	Short: "Run query, plan, code or review once per file, concurrently",
+	Long: `sqirvy-cli batch runs a command once for every file matching the patterns and
+writes each response to its own file in the output directory, e.g.
+
+    sqirvy-cli batch review 'src/**/*.go' --concurrency 4 --out-dir reviews/
+
+writes the review of src/pkg/main.go to reviews/src/pkg/main.go.md.
+A ** in a pattern matches any number of directories; quote patterns so the shell
+does not expand them. Input from stdin, if any, is sent with every file, e.g. for
+extra instructions. Failed queries are retried. A summary of every file is written
+to index.json in the output directory, and the command exits with status 1 if any
+file failed.
+
+With --async the files are submitted as one OpenAI or Anthropic batch job, which
+completes within 24 hours at half the price. A manifest is written to the output
+directory; "batch status" reports the progress of the job and "batch collect"
+writes the responses and the index once it is done. The prompts and responses go
+through the query hooks, redaction and moderation of the config file. Batch jobs
+are not recorded in the audit log, so --async fails while audit.enabled is set.
+`,
+	Args: cobra.MinimumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		// get arg/config params
+		name := args[0]
+		model := namedCommandModel(cmd, name)
+		temperature := namedCommandTemperature(cmd, name)
+		concurrency, _ := cmd.Flags().GetInt("concurrency")
+		outDir, _ := cmd.Flags().GetString("out-dir")
+		retries, _ := cmd.Flags().GetInt("retries")
+		async, _ := cmd.Flags().GetBool("async")
+
+		if async {
+			if err := executeBatchSubmit(name, model, temperature, args[1:], outDir); err != nil {
+				log.Fatalf("Error executing batch command: %v", err)
+			}
+			return
+		}
+
+		// identical queries, e.g. of files with the same content, are sent once
+		sqirvy.SetMemoize(true)
+		start, spent := time.Now(), sqirvy.RunSpend()
+		results, err := executeBatch(name, model, temperature, args[1:], outDir, concurrency, retries)
+		failed := 0
+		for _, r := range results {
+			if r.Error != "" {
+				failed++
+			}
+		}
+		if notifyEnabled(cmd) {
+			notifyDone(cmd.Name(), start, spent, fmt.Sprintf("%d files, %d failed", len(results), failed), err)
+		}
+		if err != nil {
+			log.Fatalf("Error executing batch command: %v", err)
+		}
+		if failed > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+// batchSystemPrompt returns the system prompt of a command that batch can run.
+// Reviews follow the review rules file, if there is one.
+func batchSystemPrompt(name string) (string, error) {
+	switch name {
+	case "query":
+		return queryPrompt, nil
+	case "plan":
+		return planPrompt, nil
+	case "code":
+		return codePrompt, nil
+	case "review":
+		rules, err := readReviewRules("")
+		if err != nil {
+			return "", err
+		}
+		return reviewPrompt + rules.prompt(), nil
+	}
+	return "", fmt.Errorf("error: batch cannot run command %q (use query, plan, code or review)", name)
+}
+
+// executeBatch runs the named command on each file matching the patterns with a pool
+// of concurrency workers, writes the responses and the index to outDir, and returns
+// the results in input order. Errors from individual files are recorded in the results.
+func executeBatch(name string, model string, temperature float64, patterns []string, outDir string, concurrency int, retries int) ([]batchResult, error) {
+	system, err := batchSystemPrompt(name)
+	if err != nil {
+		return nil, err
+	}
+	if system, err = commandSystemPrompt(system); err != nil {
+		return nil, err
+	}
+	if concurrency < 1 {
+		return nil, fmt.Errorf("error: --concurrency must be at least 1")
+	}
+	if retries < 0 {
+		return nil, fmt.Errorf("error: --retries cannot be negative")
+	}
+
+	files, err := batchFiles(patterns)
+	if err != nil {
+		return nil, err
+	}
+
+	shared, err := batchSharedPrompts()
+	if err != nil {
+		return nil, err
+	}
+
+	model = availableModel(resolveModel(model))
+	slog.Info("Using model", "model", model)
+	client, err := newClientForModel(model)
+	if err != nil {
+		return nil, err
+	}
+
+	queryTemp, err := queryTemperature(temperature, model)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(outDir, 0o755); err != nil {
+		return nil, fmt.Errorf("error: creating output directory: %w", err)
+	}
+
+	options := sqirvy.Options{Temperature: queryTemp, MaxTokens: commandMaxTokens(model), Stop: stopSequences(), Seed: querySeed(model), Prefill: queryPrefill(model)}
+	ctx := context.Background()
+
+	results := make([]batchResult, len(files))
+	jobs := make(chan int)
+	var mu sync.Mutex
+	done := 0
+	var wg sync.WaitGroup
+	for w := 0; w < min(concurrency, len(files)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = batchFile(ctx, client, system, shared, model, options, files[i], outDir, retries)
+
+				// report progress
+				mu.Lock()
+				done++
+				progress := fmt.Sprintf("%d/%d", done, len(files))
+				if results[i].Error != "" {
+					slog.Warn("File failed", "progress", progress, "file", files[i], "error", results[i].Error)
+				} else {
+					slog.Info("File done", "progress", progress, "file", files[i])
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for i := range files {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	if err := writeBatchIndex(filepath.Join(outDir, batchIndexFile), results); err != nil {
+		return results, err
+	}
+	writeBatchSummary(results)
+	return results, nil
+}
+
+// batchFiles expands the patterns into a list of files without duplicates.
+func batchFiles(patterns []string) ([]string, error) {
+	var files []string
+	seen := make(map[string]bool)
+	for _, pattern := range patterns {
+		matches, err := util.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("error: %w", err)
+		}
+		for _, m := range matches {
+			if !seen[m] {
+				seen[m] = true
+				files = append(files, m)
+			}
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("error: no files match %s", strings.Join(patterns, " "))
+	}
+	return files, nil
+}
+
+// batchSharedPrompts returns the prompts sent with every file: the library prompt
+// selected by --prompt with --prompt-as user and the input from stdin, if any.
+// Stdin is read once for the whole batch.
+func batchSharedPrompts() ([]string, error) {
+	stdinData, _, err := util.ReadStdin(MaxInputTotalBytes)
+	if err != nil {
+		return nil, fmt.Errorf("error: reading from stdin: %w", err)
+	}
+	var shared []string
+	// a library prompt with --prompt-as user leads the prompts of every file
+	text, role, err := selectedPrompt()
+	if err != nil {
+		return nil, err
+	}
+	if text != "" && role == promptAsUser {
+		shared = append(shared, text)
+	}
+	if stdinData != "" {
+		shared = append(shared, fmt.Sprintf("--- START STDIN ---\n%s\n--- END STDIN ---", stdinData))
+	}
+	return shared, nil
+}
+
+// batchFilePrompts returns the prompts for one file: the shared prompts followed by the file.
+func batchFilePrompts(shared []string, file string) ([]string, error) {
+	data, _, err := util.ReadFile(file, MaxInputTotalBytes)
+	if err != nil {
+		return nil, err
+	}
+	return append(append([]string{}, shared...),
+		fmt.Sprintf("--- START FILE: %s ---\n%s\n--- END FILE: %s ---", file, string(data), file)), nil
+}
+
+// batchFile runs the query for one file, retrying failures with exponential backoff,
+// and writes the response to the output directory.
+func batchFile(ctx context.Context, client sqirvy.Client, system string, shared []string, model string, options sqirvy.Options, file string, outDir string, retries int) batchResult {
+	result := batchResult{Input: file, Model: model}
+
+	prompts, err := batchFilePrompts(shared, file)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	var response string
+	start := time.Now()
+	backoff := time.Second
+	for attempt := 0; attempt <= retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		result.Attempts++
+		var usage sqirvy.Usage
+		response, usage, err = client.QueryTextUsage(ctx, system, prompts, model, options)
+		result.InputTokens += usage.InputTokens
+		result.OutputTokens += usage.OutputTokens
+		result.Cost += sqirvy.EstimateCost(model, usage)
+		if err == nil || !retryable(err) {
+			break
+		}
+	}
+	result.LatencyMs = time.Since(start).Milliseconds()
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	output := batchOutputPath(outDir, file)
+	if err := writeBatchOutput(output, response); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Output = output
+	return result
+}
+
+// writeBatchOutput writes one response, creating its directory if needed.
+func writeBatchOutput(output string, response string) error {
+	if err := os.MkdirAll(filepath.Dir(output), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(output, []byte(response+"\n"), 0o644)
+}
+
+// retryable reports whether a failed query may succeed if it is sent again.
+// Queries refused by the budget, an open circuit or the context window are not retried.
+func retryable(err error) bool {
+	var budgetErr *sqirvy.BudgetError
+	var circuitErr *sqirvy.CircuitOpenError
+	var windowErr *sqirvy.ContextWindowError
+	return !errors.As(err, &budgetErr) && !errors.As(err, &circuitErr) && !errors.As(err, &windowErr)
+}
+
+// batchOutputPath returns the output file for an input file: the input path below
+// outDir with a .md extension. Parent directory references are kept inside outDir.
+func batchOutputPath(outDir string, file string) string {
+	rel := filepath.ToSlash(filepath.Clean(file))
+	rel = strings.TrimPrefix(rel, filepath.ToSlash(filepath.VolumeName(rel)))
+	var segments []string
+	for _, seg := range strings.Split(rel, "/") {
+		switch seg {
+		case "", ".":
+			continue
+		case "..":
+			seg = "__"
+		}
+		segments = append(segments, seg)
+	}
+	return filepath.Join(outDir, filepath.FromSlash(strings.Join(segments, "/"))+".md")
+}
+
+// writeBatchIndex writes the results as a JSON array.
+func writeBatchIndex(path string, results []batchResult) error {
+	data, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error: encoding batch index: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("error: writing batch index: %w", err)
+	}
+	return nil
+}
+
+// writeBatchSummary prints the number of files processed and failed and the total cost.
+func writeBatchSummary(results []batchResult) {
+	failed := 0
+	var cost float64
+	for _, r := range results {
+		if r.Error != "" {
+			failed++
+		}
+		cost += r.Cost
+	}
+	slog.Info("Batch complete", "succeeded", len(results)-failed, "failed", failed, "cost_usd", fmt.Sprintf("%.4f", cost))
+}
+
+// batchUsage prints the usage instructions for the batch command.
+func batchUsage(cmd *cobra.Command) error {
+	fmt.Println("Usage: [stdin |] sqirvy-cli batch query|plan|code|review pattern... --out-dir dir [flags]")
+	fmt.Println("\nFlags:")
+	cmd.Flags().PrintDefaults()
+	return nil
+}
+
+// init registers the batch command with the root command and sets its custom usage function.
+func init() {
+	rootCmd.AddCommand(batchCmd)
+	batchCmd.SetUsageFunc(batchUsage)
+	batchCmd.Flags().IntP("concurrency", "c", 4, "Number of files processed at the same time")
+	batchCmd.PersistentFlags().StringP("out-dir", "o", "batch-out", "Directory for the responses and the index")
+	batchCmd.Flags().Int("retries", 2, "Number of times a failed query is retried")
+	batchCmd.Flags().Bool("async", false, "Submit the files as a provider batch job at half the price (OpenAI and Anthropic)")
+}
@@ -0,0 +1,274 @@
+// Package cmd implements provider batch jobs for the batch command, where all
+// files are submitted at once and the results are collected later.
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	sqirvy "github.com/dmh2000/sqirvy-cli/pkg/sqirvy"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// batchManifestName is the name of the manifest of an asynchronous batch job.
+const batchManifestName = "manifest.json"
+
+// batchManifest records a submitted batch job so its results can be collected later.
+type batchManifest struct {
+	Provider  string              `json:"provider"`
+	BatchID   string              `json:"batch_id"`
+	Command   string              `json:"command"`
+	Model     string              `json:"model"`
+	Submitted time.Time           `json:"submitted"`
+	Charged   float64             `json:"charged"`           // estimate charged to the budget at submission
+	Settled   bool                `json:"settled,omitempty"` // the cost of the results is in the budget
+	Files     []batchManifestFile `json:"files"`
+}
+
+// batchManifestFile maps a request of the batch job to its input and output files.
+type batchManifestFile struct {
+	ID     string `json:"id"`
+	Input  string `json:"input"`
+	Output string `json:"output"`
+}
+
+// batchStatusCmd represents the command that reports the progress of a batch job.
+var batchStatusCmd = &cobra.Command{
+	Use:               "status",
+	Short:             "Show the progress of a batch job submitted with --async",
+	Args:              cobra.NoArgs,
+	ValidArgsFunction: cobra.NoFileCompletions,
+	Run: func(cmd *cobra.Command, args []string) {
+		outDir, _ := cmd.Flags().GetString("out-dir")
+		job, err := executeBatchStatus(outDir)
+		if err != nil {
+			log.Fatalf("Error executing batch status command: %v", err)
+		}
+		state := "running"
+		if job.Done {
+			state = "done, run batch collect"
+		}
+		fmt.Printf("%s (%s): %s, %d of %d succeeded, %d failed, %s\n",
+			job.ID, job.Provider, job.Status, job.Succeeded, job.Total, job.Failed, state)
+	},
+}
+
+// batchCollectCmd represents the command that writes the results of a finished batch job.
+var batchCollectCmd = &cobra.Command{
+	Use:               "collect",
+	Short:             "Write the responses of a finished batch job submitted with --async",
+	Args:              cobra.NoArgs,
+	ValidArgsFunction: cobra.NoFileCompletions,
+	Run: func(cmd *cobra.Command, args []string) {
+		outDir, _ := cmd.Flags().GetString("out-dir")
+		results, err := executeBatchCollect(outDir)
+		if err != nil {
+			log.Fatalf("Error executing batch collect command: %v", err)
+		}
+		for _, r := range results {
+			if r.Error != "" {
+				os.Exit(1)
+			}
+		}
+	},
+}
+
+// executeBatchSubmit submits the files matching the patterns as a provider batch
+// job and writes its manifest to outDir. The prompts go through the query filters,
+// as they would without --async. Batch jobs are not queries of the audit log, so
+// they are refused while it is enabled.
+func executeBatchSubmit(name string, model string, temperature float64, patterns []string, outDir string) error {
+	if viper.GetBool("audit.enabled") {
+		return fmt.Errorf("error: batch jobs are not recorded in the audit log, run without --async or disable audit.enabled")
+	}
+	ctx := context.Background()
+	filters, err := configQueryFilters()
+	if err != nil {
+		return err
+	}
+	system, err := batchSystemPrompt(name)
+	if err != nil {
+		return err
+	}
+	files, err := batchFiles(patterns)
+	if err != nil {
+		return err
+	}
+	shared, err := batchSharedPrompts()
+	if err != nil {
+		return err
+	}
+
+	model = availableModel(resolveModel(model))
+	provider, err := sqirvy.GetProviderName(model)
+	if err != nil {
+		return fmt.Errorf("error: model is not supported %s: %v", model, err)
+	}
+	if !sqirvy.SupportsBatch(provider) {
+		return fmt.Errorf("error: provider %s does not support batch jobs, run without --async", provider)
+	}
+	if err := loadAPIKey(provider); err != nil {
+		return err
+	}
+	slog.Info("Using model", "model", model)
+	if system, err = filters.filterPrompt(ctx, system, model); err != nil {
+		return err
+	}
+
+	manifest := batchManifest{Provider: provider, Command: name, Model: model}
+	requests := make([]sqirvy.BatchRequest, 0, len(files))
+	for i, file := range files {
+		prompts, err := batchFilePrompts(shared, file)
+		if err != nil {
+			return fmt.Errorf("error: failed to read file %s: %w", file, err)
+		}
+		if _, prompts, err = filters.filterPrompts(ctx, "", prompts, model); err != nil {
+			return fmt.Errorf("%w (file %s)", err, file)
+		}
+		id := "file-" + strconv.Itoa(i)
+		requests = append(requests, sqirvy.BatchRequest{ID: id, System: system, Prompts: prompts})
+		manifest.Files = append(manifest.Files, batchManifestFile{ID: id, Input: file, Output: batchOutputPath(outDir, file)})
+	}
+
+	queryTemp, err := queryTemperature(temperature, model)
+	if err != nil {
+		return err
+	}
+	options := sqirvy.Options{Temperature: queryTemp, MaxTokens: sqirvy.GetMaxTokens(model), Stop: stopSequences(), Seed: querySeed(model)}
+	job, err := sqirvy.SubmitBatch(ctx, model, options, requests)
+	if err != nil {
+		return fmt.Errorf("error: submitting batch job: %w", err)
+	}
+	manifest.BatchID = job.ID
+	manifest.Submitted = time.Now().UTC()
+	manifest.Charged = job.Charged
+
+	if err := os.MkdirAll(outDir, 0o755); err != nil {
+		return fmt.Errorf("error: creating output directory: %w", err)
+	}
+	if err := writeBatchManifest(outDir, manifest); err != nil {
+		return err
+	}
+	slog.Info("Submitted batch", "id", job.ID, "files", len(files), "manifest", filepath.Join(outDir, batchManifestName))
+	return nil
+}
+
+// writeBatchManifest writes the manifest of a batch job to outDir.
+func writeBatchManifest(outDir string, manifest batchManifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error: encoding batch manifest: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(outDir, batchManifestName), append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("error: writing batch manifest: %w", err)
+	}
+	return nil
+}
+
+// readBatchManifest reads the manifest in outDir and loads the API key of its provider.
+func readBatchManifest(outDir string) (batchManifest, error) {
+	var manifest batchManifest
+	path := filepath.Join(outDir, batchManifestName)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return manifest, fmt.Errorf("error: reading batch manifest: %w", err)
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return manifest, fmt.Errorf("error: invalid batch manifest %s: %w", path, err)
+	}
+	if err := loadAPIKey(manifest.Provider); err != nil {
+		return manifest, err
+	}
+	return manifest, nil
+}
+
+// executeBatchStatus returns the state of the batch job in outDir.
+func executeBatchStatus(outDir string) (sqirvy.BatchJob, error) {
+	manifest, err := readBatchManifest(outDir)
+	if err != nil {
+		return sqirvy.BatchJob{}, err
+	}
+	job, err := sqirvy.GetBatch(context.Background(), manifest.Provider, manifest.BatchID)
+	if err != nil {
+		return sqirvy.BatchJob{}, fmt.Errorf("error: %w", err)
+	}
+	return job, nil
+}
+
+// executeBatchCollect writes the responses of the finished batch job in outDir and
+// the index, and returns the results in manifest order. The responses go through
+// the query filters, as they would without --async. The first collect replaces the
+// estimate charged to the budget at submission with the cost of the results.
+func executeBatchCollect(outDir string) ([]batchResult, error) {
+	manifest, err := readBatchManifest(outDir)
+	if err != nil {
+		return nil, err
+	}
+	filters, err := configQueryFilters()
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+	batchResults, err := sqirvy.GetBatchResults(ctx, manifest.Provider, manifest.BatchID)
+	if err != nil {
+		return nil, fmt.Errorf("error: %w", err)
+	}
+	if !manifest.Settled {
+		cost := sqirvy.SettleBatch(manifest.Model, manifest.Charged, batchResults)
+		slog.Info("Charged batch", "id", manifest.BatchID, "cost", cost)
+		manifest.Settled = true
+		if err := writeBatchManifest(outDir, manifest); err != nil {
+			return nil, err
+		}
+	}
+	byID := make(map[string]sqirvy.BatchResult, len(batchResults))
+	for _, r := range batchResults {
+		byID[r.ID] = r
+	}
+
+	results := make([]batchResult, 0, len(manifest.Files))
+	for _, f := range manifest.Files {
+		result := batchResult{Input: f.Input, Model: manifest.Model, Attempts: 1}
+		r, ok := byID[f.ID]
+		switch {
+		case !ok:
+			result.Error = "no result in batch " + manifest.BatchID
+		case r.Err != "":
+			result.Error = r.Err
+		default:
+			result.InputTokens = r.Usage.InputTokens
+			result.OutputTokens = r.Usage.OutputTokens
+			result.Cost = sqirvy.EstimateCost(manifest.Model, r.Usage) * sqirvy.BatchDiscount
+			text, err := filters.filterResponse(ctx, r.Text, manifest.Model)
+			if err != nil {
+				result.Error = err.Error()
+			} else if err := writeBatchOutput(f.Output, text); err != nil {
+				result.Error = err.Error()
+			} else {
+				result.Output = f.Output
+			}
+		}
+		results = append(results, result)
+	}
+
+	if err := writeBatchIndex(filepath.Join(outDir, batchIndexFile), results); err != nil {
+		return results, err
+	}
+	writeBatchSummary(results)
+	return results, nil
+}
+
+// init registers the batch job subcommands with the batch command.
+func init() {
+	batchCmd.AddCommand(batchStatusCmd)
+	batchCmd.AddCommand(batchCollectCmd)
+}
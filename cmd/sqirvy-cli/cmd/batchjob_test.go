@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	sqirvy "github.com/dmh2000/sqirvy-cli/pkg/sqirvy"
+)
+
+func TestBatchCollectSettlesBudget(t *testing.T) {
+	var serverURL string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/messages/batches/msgbatch_1":
+			w.Write([]byte(`{"id": "msgbatch_1", "processing_status": "ended", "request_counts": {"succeeded": 2},
+				"results_url": "` + serverURL + `/v1/messages/batches/msgbatch_1/results"}`))
+		case "/v1/messages/batches/msgbatch_1/results":
+			w.Write([]byte(`{"custom_id": "file-0", "result": {"type": "succeeded", "message": {"content": [{"type": "text", "text": "a"}], "usage": {"input_tokens": 1000, "output_tokens": 2000}}}}
+{"custom_id": "file-1", "result": {"type": "succeeded", "message": {"content": [{"type": "text", "text": "b"}], "usage": {"input_tokens": 500, "output_tokens": 4000}}}}
+`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	serverURL = server.URL
+	t.Setenv("ANTHROPIC_API_KEY", "test-key")
+	t.Setenv("ANTHROPIC_BASE_URL", server.URL)
+
+	// the ledger holds the input estimate charged when the job was submitted
+	const model = "claude-3-5-haiku-latest"
+	const charged = 0.0006
+	dir := t.TempDir()
+	ledger := filepath.Join(dir, "ledger.json")
+	month := time.Now().Format("2006-01")
+	if err := os.WriteFile(ledger, []byte(`{"`+month+`": {"cost": 0.0006, "requests": 1}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	sqirvy.SetLedgerFile(ledger)
+	defer sqirvy.SetLedgerFile("")
+
+	outDir := filepath.Join(dir, "out")
+	if err := os.MkdirAll(outDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	manifest := batchManifest{
+		Provider: sqirvy.Anthropic, BatchID: "msgbatch_1", Command: "query", Model: model, Charged: charged,
+		Files: []batchManifestFile{
+			{ID: "file-0", Input: "a.go", Output: filepath.Join(outDir, "a.go.md")},
+			{ID: "file-1", Input: "b.go", Output: filepath.Join(outDir, "b.go.md")},
+		},
+	}
+	if err := writeBatchManifest(outDir, manifest); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := executeBatchCollect(outDir)
+	if err != nil {
+		t.Fatalf("executeBatchCollect() error = %v", err)
+	}
+	var want float64
+	for _, r := range results {
+		if r.Error != "" {
+			t.Fatalf("result of %s: %s", r.Input, r.Error)
+		}
+		want += r.Cost
+	}
+	if math.Abs(want-(1500*0.8+6000*4)/1e6*sqirvy.BatchDiscount) > 1e-12 {
+		t.Fatalf("cost of the results = %v", want)
+	}
+
+	checkLedger := func(when string) {
+		t.Helper()
+		spent, err := sqirvy.MonthlySpend(time.Now())
+		if err != nil {
+			t.Fatalf("MonthlySpend() error = %v", err)
+		}
+		if math.Abs(spent.Cost-want) > 1e-12 || spent.Requests != 1 {
+			t.Errorf("ledger %s = %+v, want the cost of the results %v and 1 request", when, spent, want)
+		}
+	}
+	checkLedger("after collect")
+
+	var saved batchManifest
+	data, err := os.ReadFile(filepath.Join(outDir, batchManifestName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &saved); err != nil || !saved.Settled {
+		t.Errorf("manifest after collect = %s, want settled", data)
+	}
+
+	// collecting again writes the results but does not charge them twice
+	if _, err := executeBatchCollect(outDir); err != nil {
+		t.Fatalf("second executeBatchCollect() error = %v", err)
+	}
+	checkLedger("after a second collect")
+}
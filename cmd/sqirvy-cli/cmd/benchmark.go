@@ -0,0 +1,270 @@
+/*
+Copyright © 2025 David Howard  dmh2000@gmail.com
+*/
+package cmd
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	sqirvy "github.com/dmh2000/sqirvy-cli/pkg/sqirvy"
+	util "github.com/dmh2000/sqirvy-cli/pkg/util"
+
+	"github.com/spf13/cobra"
+)
+
+// benchmarkResult records the outcome of running one prompt against one model.
+type benchmarkResult struct {
+	Prompt  string
+	Model   string
+	Latency time.Duration
+	Usage   sqirvy.Usage
+	Cost    float64
+	Score   float64 // judge score, -1 when not judged
+	Err     error
+}
+
+// benchmarkCmd represents the command to compare models on a set of prompts.
+// Every prompt file in the directory is sent to every model. The latency, token
+// usage and estimated cost of each query are recorded and, if a judge model is
+// given, each response is scored by that model.
+var benchmarkCmd = &cobra.Command{
+	Use:   "benchmark",
+	Short: "Compare models on a directory of prompt files",
+	Long: `sqirvy-cli benchmark will send every prompt file in a directory to each of
+the listed models and output a comparison of latency, token usage, estimated cost
+and, optionally, a score from a judge model.
+Each prompt file is sent on its own with the query system prompt.
+The output is a table, or CSV with --csv.
+`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		// get arg/config params
+		temperature := commandTemperature(cmd)
+		models, _ := cmd.Flags().GetStringSlice("models")
+		judgeModel, _ := cmd.Flags().GetString("judge")
+		asCSV, _ := cmd.Flags().GetBool("csv")
+
+		if len(models) == 0 {
+			models = []string{commandModel(cmd)}
+		}
+
+		results, err := executeBenchmark(models, temperature, judgeModel, args[0])
+		if err != nil {
+			log.Fatalf("Error executing benchmark command: %v", err)
+		}
+
+		if asCSV {
+			err = writeBenchmarkCSV(os.Stdout, results)
+		} else {
+			err = writeBenchmarkTable(os.Stdout, results)
+		}
+		if err != nil {
+			log.Fatalf("Error executing benchmark command: %v", err)
+		}
+	},
+}
+
+// executeBenchmark runs each prompt file in dir against each model and collects the results.
+// Errors from individual queries are recorded in the results rather than returned.
+func executeBenchmark(models []string, temperature float64, judgeModel string, dir string) ([]benchmarkResult, error) {
+	files, err := promptFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	// every run is sent, so that the latencies are measured
+	ctx := sqirvy.WithoutMemo(context.Background())
+
+	var judge sqirvy.Client
+	if judgeModel != "" {
+		judgeModel = resolveModel(judgeModel)
+		judge, err = newClientForModel(judgeModel)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var results []benchmarkResult
+	for _, model := range models {
+		model = resolveModel(model)
+		slog.Info("Benchmarking model", "model", model)
+
+		client, err := newClientForModel(model)
+		if err != nil {
+			return nil, err
+		}
+
+		queryTemp, err := queryTemperature(temperature, model)
+		if err != nil {
+			return nil, err
+		}
+		options := sqirvy.Options{Temperature: queryTemp, MaxTokens: sqirvy.GetMaxTokens(model), Stop: stopSequences(), Seed: querySeed(model), Prefill: queryPrefill(model)}
+		for _, file := range files {
+			data, _, err := util.ReadFile(file, MaxInputTotalBytes)
+			if err != nil {
+				return nil, fmt.Errorf("error: failed to read file %s: %w", file, err)
+			}
+			prompt := string(data)
+
+			result := benchmarkResult{Prompt: filepath.Base(file), Model: model, Score: -1}
+			start := time.Now()
+			response, usage, err := client.QueryTextUsage(ctx, queryPrompt, []string{prompt}, model, options)
+			result.Latency = time.Since(start)
+			result.Usage = usage
+			result.Cost = sqirvy.EstimateCost(model, usage)
+			result.Err = err
+
+			if err == nil && judge != nil {
+				judgeOptions := sqirvy.Options{Temperature: 0, MaxTokens: sqirvy.GetMaxTokens(judgeModel)}
+				j, err := judgeResponse(ctx, judge, judgeModel, judgeOptions, "", prompt, response)
+				if err != nil {
+					slog.Warn("Judging failed", "prompt", result.Prompt, "model", model, "error", err)
+				} else {
+					result.Score = j.Score
+				}
+			}
+			results = append(results, result)
+		}
+	}
+	return results, nil
+}
+
+// promptFiles returns the regular files in dir, sorted by name.
+func promptFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error: reading prompt directory %s: %w", dir, err)
+	}
+	var files []string
+	for _, entry := range entries {
+		if entry.Type().IsRegular() {
+			files = append(files, filepath.Join(dir, entry.Name()))
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("error: no prompt files in %s", dir)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// benchmarkHeader is the column header for benchmark output.
+var benchmarkHeader = []string{"prompt", "model", "latency_ms", "input_tokens", "output_tokens", "cost_usd", "score", "error"}
+
+// benchmarkRecord formats a result as a row of benchmark output.
+func benchmarkRecord(r benchmarkResult) []string {
+	score := ""
+	if r.Score >= 0 {
+		score = strconv.FormatFloat(r.Score, 'f', 1, 64)
+	}
+	errText := ""
+	if r.Err != nil {
+		errText = r.Err.Error()
+	}
+	return []string{
+		r.Prompt,
+		r.Model,
+		strconv.FormatInt(r.Latency.Milliseconds(), 10),
+		strconv.FormatInt(r.Usage.InputTokens, 10),
+		strconv.FormatInt(r.Usage.OutputTokens, 10),
+		strconv.FormatFloat(r.Cost, 'f', 6, 64),
+		score,
+		errText,
+	}
+}
+
+// writeBenchmarkCSV writes one CSV row per result.
+func writeBenchmarkCSV(w io.Writer, results []benchmarkResult) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(benchmarkHeader); err != nil {
+		return err
+	}
+	for _, r := range results {
+		if err := cw.Write(benchmarkRecord(r)); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeBenchmarkTable writes the results as an aligned table followed by a per-model summary.
+func writeBenchmarkTable(w io.Writer, results []benchmarkResult) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PROMPT\tMODEL\tLATENCY(ms)\tIN\tOUT\tCOST($)\tSCORE\tERROR")
+	for _, r := range results {
+		rec := benchmarkRecord(r)
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", rec[0], rec[1], rec[2], rec[3], rec[4], rec[5], rec[6], rec[7])
+	}
+	fmt.Fprintln(tw)
+
+	// summarize by model, in the order the models were run
+	fmt.Fprintln(tw, "MODEL\tRUNS\tERRORS\tAVG LATENCY(ms)\tTOTAL TOKENS\tTOTAL COST($)\tAVG SCORE")
+	var order []string
+	type summary struct {
+		runs, errors, scored int
+		latency              time.Duration
+		tokens               int64
+		cost, score          float64
+	}
+	sums := make(map[string]*summary)
+	for _, r := range results {
+		s, ok := sums[r.Model]
+		if !ok {
+			s = &summary{}
+			sums[r.Model] = s
+			order = append(order, r.Model)
+		}
+		s.runs++
+		if r.Err != nil {
+			s.errors++
+		}
+		s.latency += r.Latency
+		s.tokens += r.Usage.InputTokens + r.Usage.OutputTokens
+		s.cost += r.Cost
+		if r.Score >= 0 {
+			s.scored++
+			s.score += r.Score
+		}
+	}
+	for _, model := range order {
+		s := sums[model]
+		avgScore := "-"
+		if s.scored > 0 {
+			avgScore = strconv.FormatFloat(s.score/float64(s.scored), 'f', 1, 64)
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%.6f\t%s\n",
+			model, s.runs, s.errors, (s.latency / time.Duration(s.runs)).Milliseconds(), s.tokens, s.cost, avgScore)
+	}
+	return tw.Flush()
+}
+
+// benchmarkUsage prints the usage instructions for the benchmark command.
+func benchmarkUsage(cmd *cobra.Command) error {
+	fmt.Println("Usage: sqirvy-cli benchmark --models m1,m2 [--judge model] [--csv] [flags] prompt-directory")
+	fmt.Println("\nFlags:")
+	cmd.Flags().PrintDefaults()
+	return nil
+}
+
+// init registers the benchmark command with the root command and sets its custom usage function.
+func init() {
+	benchmarkCmd.Flags().StringSlice("models", nil, "Comma separated list of models to compare (default is the --model value)")
+	benchmarkCmd.RegisterFlagCompletionFunc("models", completeModelList)
+	benchmarkCmd.Flags().String("judge", "", "Model used to score each response (no scoring if empty)")
+	benchmarkCmd.RegisterFlagCompletionFunc("judge", completeModels)
+	benchmarkCmd.Flags().Bool("csv", false, "Output CSV instead of a table")
+	rootCmd.AddCommand(benchmarkCmd)
+	benchmarkCmd.SetUsageFunc(benchmarkUsage)
+}
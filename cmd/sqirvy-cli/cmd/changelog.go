@@ -0,0 +1,217 @@
+/*
+Copyright © 2025 David Howard  dmh2000@gmail.com
+*/
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"os/exec"
+	"strings"
+
+	sqirvy "github.com/dmh2000/sqirvy-cli/pkg/sqirvy"
+
+	"github.com/spf13/cobra"
+)
+
+// changelogFormats maps the values of --format to the layout the release notes
+// are asked for.
+var changelogFormats = map[string]string{
+	"markdown": `Use this layout, leaving out empty sections:
+
+## %[1]s
+
+### Breaking Changes
+
+### New Features
+
+### Bug Fixes
+
+### Other Changes`,
+	"keepachangelog": `Follow the Keep a Changelog format (https://keepachangelog.com/en/1.1.0/). Use this layout, leaving out empty sections:
+
+## %[2]s
+
+### Added
+
+### Changed
+
+### Deprecated
+
+### Removed
+
+### Fixed
+
+### Security`,
+}
+
+// changelogCmd represents the command to generate release notes from the git history.
+// It reads the commits and the diff between two refs of the repository in the
+// current directory and asks the LLM to write grouped release notes.
+var changelogCmd = &cobra.Command{
+	Use:   "changelog",
+	Short: "Generate release notes from the git history between two refs",
+	Long: `sqirvy-cli changelog will read the git log and diff between two refs and
+ask the LLM to write grouped, human-readable release notes.
+--from defaults to the latest tag before --to, and --to defaults to HEAD.
+--format markdown groups the notes by breaking changes, features, fixes and other
+changes; --format keepachangelog follows the Keep a Changelog format.
+The diff stat is always included; --diff also includes the full diff, cut to the
+input size limit.
+The prompt is constructed in this order:
+	An internal system prompt for release notes
+	The commits between the refs
+	The diff between the refs
+`,
+	Args:              cobra.NoArgs,
+	ValidArgsFunction: cobra.NoFileCompletions,
+	Run: func(cmd *cobra.Command, args []string) {
+		// get arg/config params
+		model := commandModel(cmd)
+		temperature := commandTemperature(cmd)
+		from, _ := cmd.Flags().GetString("from")
+		to, _ := cmd.Flags().GetString("to")
+		format := commandFormat(cmd)
+		release, _ := cmd.Flags().GetString("release")
+		diff, _ := cmd.Flags().GetBool("diff")
+
+		response, err := executeChangelog(model, temperature, from, to, format, release, diff)
+		if err != nil {
+			log.Fatalf("Error executing changelog command: %v", err)
+		}
+		// Print the release notes to standard output
+		fmt.Print(response)
+		fmt.Println() // Ensure a newline at the end
+	},
+}
+
+// executeChangelog reads the history between the refs and asks the model for
+// release notes in the given format.
+func executeChangelog(model string, temperature float64, from, to, format, release string, diff bool) (string, error) {
+	layout, ok := changelogFormats[format]
+	if !ok {
+		return "", fmt.Errorf("error: unknown format %q (use markdown or keepachangelog)", format)
+	}
+
+	if from == "" {
+		tag, err := runGit("describe", "--tags", "--abbrev=0", to+"^")
+		if err != nil {
+			return "", fmt.Errorf("error: no tag found before %s, use --from: %w", to, err)
+		}
+		from = strings.TrimSpace(tag)
+	}
+	slog.Info("Generating changelog", "from", from, "to", to)
+
+	commits, err := runGit("log", "--no-merges", "--format=commit %h%n%s%n%n%b", from+".."+to)
+	if err != nil {
+		return "", fmt.Errorf("error: reading git log: %w", err)
+	}
+	if strings.TrimSpace(commits) == "" {
+		return "", fmt.Errorf("error: no commits between %s and %s", from, to)
+	}
+	date, err := runGit("log", "-1", "--format=%cs", to)
+	if err != nil {
+		return "", fmt.Errorf("error: reading git log: %w", err)
+	}
+	if release == "" {
+		release = to
+		if to == "HEAD" {
+			release = "Unreleased"
+		}
+	}
+
+	prompts := []string{fmt.Sprintf("--- START COMMITS: %s..%s ---\n%s\n--- END COMMITS ---", from, to, commits)}
+	length := int64(len(prompts[0]))
+
+	stat, err := runGit("diff", "--stat", from, to)
+	if err != nil {
+		return "", fmt.Errorf("error: reading git diff: %w", err)
+	}
+	prompts = append(prompts, fmt.Sprintf("--- START DIFF STAT ---\n%s\n--- END DIFF STAT ---", stat))
+	length += int64(len(prompts[1]))
+
+	if diff {
+		patch, err := runGit("diff", from, to)
+		if err != nil {
+			return "", fmt.Errorf("error: reading git diff: %w", err)
+		}
+		if room := MaxInputTotalBytes - length; int64(len(patch)) > room {
+			slog.Warn("Diff is too large, cutting it", "bytes", len(patch), "limit", room)
+			patch = strings.ToValidUTF8(patch[:max(room, 0)], "") + "\n[diff cut at the input size limit]"
+		}
+		prompts = append(prompts, fmt.Sprintf("--- START DIFF ---\n%s\n--- END DIFF ---", patch))
+	}
+
+	// resolve aliases and unique prefixes
+	model = resolveModel(model)
+
+	// switch to the fallback model while the provider is failing
+	model = availableModel(model)
+
+	// Log the selected model
+	slog.Info("Using model", "model", model)
+
+	client, err := newClientForModel(model)
+	if err != nil {
+		return "", err
+	}
+
+	queryTemp, err := queryTemperature(temperature, model)
+	if err != nil {
+		return "", err
+	}
+	options := sqirvy.Options{Temperature: queryTemp, MaxTokens: commandMaxTokens(model)}
+
+	// Keep a Changelog headings link the release name and date the release,
+	// except for unreleased changes
+	heading := "[" + release + "]"
+	if release != "Unreleased" {
+		heading += " - " + strings.TrimSpace(date)
+	}
+	system, err := commandSystemPrompt(changelogPrompt + "\n" + fmt.Sprintf(layout, release, heading))
+	if err != nil {
+		return "", err
+	}
+	response, err := client.QueryText(context.Background(), system, prompts, model, options)
+	if err != nil {
+		return "", fmt.Errorf("error: querying model %s: %v", model, err)
+	}
+	return response, nil
+}
+
+// runGit runs git with the arguments in the current directory and returns its output.
+func runGit(args ...string) (string, error) {
+	c := exec.Command("git", args...)
+	var stderr bytes.Buffer
+	c.Stderr = &stderr
+	out, err := c.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%w: %s", err, msg)
+		}
+		return "", err
+	}
+	return string(out), nil
+}
+
+// changelogUsage prints the usage instructions for the changelog command.
+func changelogUsage(cmd *cobra.Command) error {
+	fmt.Println("Usage: sqirvy-cli changelog [--from ref] [--to ref] [--format markdown|keepachangelog] [--release name] [--diff] [flags]")
+	fmt.Println("\nFlags:")
+	cmd.Flags().PrintDefaults()
+	return nil
+}
+
+// init registers the changelog command with the root command and sets its custom usage function.
+func init() {
+	changelogCmd.Flags().String("from", "", "Start of the range, exclusive (default is the latest tag before --to)")
+	changelogCmd.Flags().String("to", "HEAD", "End of the range, inclusive")
+	changelogCmd.Flags().String("format", "markdown", "Output format: markdown or keepachangelog")
+	changelogCmd.Flags().String("release", "", "Name of the release in the heading (default is --to, or Unreleased for HEAD)")
+	changelogCmd.Flags().Bool("diff", false, "Include the full diff, not only the diff stat")
+	rootCmd.AddCommand(changelogCmd)
+	changelogCmd.SetUsageFunc(changelogUsage)
+}
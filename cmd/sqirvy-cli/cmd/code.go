@@ -6,12 +6,16 @@ package cmd
 import (
 	_ "embed"
 	"fmt"
-	"log"
 
+	sqirvy "github.com/dmh2000/sqirvy-cli/pkg/sqirvy"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
+// rawCodeInstruction is added to the system prompt with --raw-code.
+const rawCodeInstruction = `
+Output only the contents of a single source file that can be saved and compiled or run as is.
+Do not use markdown, code fences, explanations, or any text before or after the code.`
+
 // codeCmd represents the command to request code generation from the LLM.
 // It constructs a prompt including an internal system prompt for code generation,
 // input from stdin, and content from specified files or URLs, then sends it
@@ -25,26 +29,37 @@ The prompt is constructed in this order:
 	An internal system prompt for code generation
 	Input from stdin
 	Any number of filename or url arguments	
+--lang and --framework name the language and framework of the code; without
+--lang the language is detected from the file extensions.
+With --raw-code the model is told to output only code, and any markdown
+fences and prose around the code are removed, so the output can be
+redirected to a source file.
 	`,
 	Run: func(cmd *cobra.Command, args []string) {
 		// get arg/config params
-		model := viper.GetString("model")
-		temperature := viper.GetFloat64("temperature")
+		model := commandModel(cmd)
+		temperature := commandTemperature(cmd)
+		rawCode, _ := cmd.Flags().GetBool("raw-code")
 
-		// Execute the query using the specific code generation prompt
-		response, err := executeQuery(model, temperature, codePrompt, args)
-		if err != nil {
-			log.Fatalf("Error executing code command: %v", err)
-		}
-		// Print the LLM response to standard output
-		fmt.Print(response)
-		fmt.Println() // Ensure a newline at the end
+		// Execute the query using the specific code generation prompt, running it again on
+		// changes with --watch
+		runOrWatch(cmd, args, func(args []string) (string, error) {
+			system := codePrompt + languageHint(cmd, args)
+			if rawCode {
+				system += rawCodeInstruction
+			}
+			response, err := executeQuery(model, temperature, system, args)
+			if err != nil || !rawCode {
+				return response, err
+			}
+			return sqirvy.ExtractCode(response), nil
+		})
 	},
 }
 
 // codeUsage prints the usage instructions for the code command.
 func codeUsage(cmd *cobra.Command) error {
-	fmt.Println("Usage: stdin | sqirvy-cli code [flags] [files| urls]")
+	fmt.Println("Usage: [stdin |] sqirvy-cli code [flags] [-p prompt] [files| urls]")
 	fmt.Println("\nFlags:")
 	cmd.Flags().PrintDefaults()
 	return nil
@@ -54,4 +69,6 @@ func codeUsage(cmd *cobra.Command) error {
 func init() {
 	rootCmd.AddCommand(codeCmd)
 	codeCmd.SetUsageFunc(codeUsage)
+	addLanguageFlags(codeCmd)
+	codeCmd.Flags().Bool("raw-code", false, "Output only code: strip markdown fences and prose around the code")
 }
@@ -0,0 +1,315 @@
+// Package cmd implements the completion command, which prints or installs the
+// shell completion scripts of bash, zsh, fish and PowerShell. It replaces the
+// completion command cobra adds, so that completion install writes the script to
+// the directory the shell loads completions from. Model names, providers and
+// config keys are completed from the model registry and the configuration.
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	sqirvy "github.com/dmh2000/sqirvy-cli/pkg/sqirvy"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// completionShells are the shells with completion scripts.
+var completionShells = []string{"bash", "zsh", "fish", "powershell"}
+
+// completionCmd prints the completion script of a shell.
+var completionCmd = &cobra.Command{
+	Use:   "completion",
+	Short: "Print or install the shell completion script of bash, zsh, fish or powershell",
+	Long: `sqirvy-cli completion prints the completion script of a shell to stdout, or
+installs it where the shell loads completions from.
+	bash        print the bash script
+	zsh         print the zsh script
+	fish        print the fish script
+	powershell  print the PowerShell script
+	install     write the script of a shell, by default $SHELL, to its completion directory
+The scripts complete commands and flags, and the names of models and providers
+and config keys, e.g. sqirvy-cli query -m claude<TAB>.`,
+}
+
+// completionInstallCmd writes the completion script of a shell to the directory
+// the shell loads completions from.
+var completionInstallCmd = &cobra.Command{
+	Use:   "install [bash|zsh|fish|powershell]",
+	Short: "Install the completion script of a shell, by default $SHELL",
+	Long: `sqirvy-cli completion install writes the completion script of the shell, or of
+$SHELL, to the directory the shell loads completions from:
+	bash        $XDG_DATA_HOME/bash-completion/completions/sqirvy-cli (needs bash-completion 2)
+	zsh         ~/.zsh/completions/_sqirvy-cli (the directory must be in fpath)
+	fish        $XDG_CONFIG_HOME/fish/completions/sqirvy-cli.fish
+	powershell  $XDG_CONFIG_HOME/powershell/sqirvy-cli.ps1 (dot-source it from $PROFILE)
+--dir writes the script to another directory. Run it again after an upgrade to
+update the script.`,
+	Args:      cobra.MaximumNArgs(1),
+	ValidArgs: completionShells,
+	Run: func(cmd *cobra.Command, args []string) {
+		shell := ""
+		if len(args) > 0 {
+			shell = args[0]
+		} else {
+			// $SHELL is e.g. /bin/zsh or /usr/bin/fish
+			shell = strings.TrimSuffix(filepath.Base(os.Getenv("SHELL")), ".exe")
+			if shell == "pwsh" {
+				shell = "powershell"
+			}
+		}
+		if !slices.Contains(completionShells, shell) {
+			log.Fatalf("Error executing completion install command: unknown shell %q (use bash, zsh, fish or powershell)", shell)
+		}
+		dir, _ := cmd.Flags().GetString("dir")
+		path, err := installCompletion(shell, dir)
+		if err != nil {
+			log.Fatalf("Error executing completion install command: %v", err)
+		}
+		fmt.Println(path)
+		fmt.Fprintln(os.Stderr, completionHint(shell, path))
+	},
+}
+
+// completionScript returns the completion script of a shell, with descriptions.
+func completionScript(shell string) ([]byte, error) {
+	var b bytes.Buffer
+	var err error
+	switch shell {
+	case "bash":
+		err = rootCmd.GenBashCompletionV2(&b, true)
+	case "zsh":
+		err = rootCmd.GenZshCompletion(&b)
+	case "fish":
+		err = rootCmd.GenFishCompletion(&b, true)
+	case "powershell":
+		err = rootCmd.GenPowerShellCompletionWithDesc(&b)
+	default:
+		err = fmt.Errorf("unknown shell %q", shell)
+	}
+	return b.Bytes(), err
+}
+
+// completionPath returns the file the completion script of a shell is installed
+// to, in dir if it is not empty.
+func completionPath(shell, dir string) (string, error) {
+	file := map[string]string{
+		"bash":       "sqirvy-cli",
+		"zsh":        "_sqirvy-cli",
+		"fish":       "sqirvy-cli.fish",
+		"powershell": "sqirvy-cli.ps1",
+	}[shell]
+	if dir != "" {
+		return filepath.Join(dir, file), nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		dataHome = filepath.Join(home, ".local", "share")
+	}
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" {
+		configHome = filepath.Join(home, ".config")
+	}
+	switch shell {
+	case "bash":
+		dir = filepath.Join(dataHome, "bash-completion", "completions")
+	case "zsh":
+		zdotdir := os.Getenv("ZDOTDIR")
+		if zdotdir == "" {
+			zdotdir = home
+		}
+		dir = filepath.Join(zdotdir, ".zsh", "completions")
+	case "fish":
+		dir = filepath.Join(configHome, "fish", "completions")
+	case "powershell":
+		dir = filepath.Join(configHome, "powershell")
+	}
+	return filepath.Join(dir, file), nil
+}
+
+// installCompletion writes the completion script of a shell and returns its path.
+func installCompletion(shell, dir string) (string, error) {
+	script, err := completionScript(shell)
+	if err != nil {
+		return "", err
+	}
+	path, err := completionPath(shell, dir)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, script, 0o644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// completionHint returns what the user has to do for the shell to load the
+// installed script.
+func completionHint(shell, path string) string {
+	switch shell {
+	case "zsh":
+		return fmt.Sprintf("Add to ~/.zshrc, before compinit, if it is not there:\n\tfpath=(%s $fpath)\n\tautoload -U compinit && compinit", filepath.Dir(path))
+	case "powershell":
+		return fmt.Sprintf("Add to $PROFILE:\n\t. %s", path)
+	}
+	return "Start a new shell to load the completions."
+}
+
+// completeModels completes model names and aliases, with their provider, or the
+// successor of deprecated models, as description.
+func completeModels(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return modelCompletions(toComplete, ""), cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeModelList completes the last model of a comma separated list, as in
+// --race gpt-4o,gemini-2.5-flash.
+func completeModelList(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	prefix := ""
+	if i := strings.LastIndex(toComplete, ","); i >= 0 {
+		prefix, toComplete = toComplete[:i+1], toComplete[i+1:]
+	}
+	return modelCompletions(toComplete, prefix), cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveNoSpace
+}
+
+// modelCompletions returns the model names and aliases that start with
+// toComplete, each after prefix, in "name\tdescription" form.
+func modelCompletions(toComplete, prefix string) []string {
+	now := time.Now()
+	var completions []string
+	for _, mp := range sqirvy.GetModelProviderList() {
+		if !strings.HasPrefix(mp.Model, toComplete) {
+			continue
+		}
+		desc := mp.Provider
+		if d, ok := sqirvy.CheckDeprecation(mp.Model, now); ok {
+			desc = d.String()
+		}
+		completions = append(completions, prefix+mp.Model+"\t"+desc)
+	}
+	for alias, model := range sqirvy.GetAliases() {
+		if strings.HasPrefix(alias, toComplete) {
+			completions = append(completions, prefix+alias+"\talias of "+model)
+		}
+	}
+	sort.Strings(completions)
+	return completions
+}
+
+// completeProviders completes the provider names.
+func completeProviders(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return sqirvy.GetProviderList(), cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeKeyProviders completes the providers with an API key that are not
+// already arguments, for keys set and keys check.
+func completeKeyProviders(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if cmd == keysSetCmd && len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	var providers []string
+	for _, provider := range sqirvy.GetProviderList() {
+		if providerKeyVar(provider) != "" && !slices.Contains(args, provider) {
+			providers = append(providers, provider)
+		}
+	}
+	return providers, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeProfiles completes the names of the profiles in the config file.
+func completeProfiles(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	readCompletionConfig()
+	return profileNames(), cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeConfigKeys completes the first argument of config get and config set
+// with the top level keys of the config file and the keys that are set.
+func completeConfigKeys(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	readCompletionConfig()
+	keys := slices.Clone(knownConfigKeys)
+	for _, key := range viper.AllKeys() {
+		if !slices.Contains(keys, key) {
+			keys = append(keys, key)
+		}
+	}
+	var completions []string
+	for _, key := range keys {
+		if strings.HasPrefix(key, toComplete) {
+			completions = append(completions, key)
+		}
+	}
+	sort.Strings(completions)
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
+
+// readCompletionConfig reads the config file of a --config flag on the completed
+// command line. The config file is read before cobra parses the flags of the
+// command line it completes, so it is the default file until then.
+func readCompletionConfig() {
+	if cfgFile == "" || cfgFile == viper.ConfigFileUsed() {
+		return
+	}
+	viper.SetConfigFile(cfgFile)
+	if err := viper.ReadInConfig(); err != nil {
+		cobra.CompDebugln("reading config file: "+err.Error(), true)
+	}
+}
+
+// completionUsage prints the usage instructions for the completion commands.
+func completionUsage(cmd *cobra.Command) error {
+	fmt.Println("Usage: sqirvy-cli completion bash|zsh|fish|powershell")
+	fmt.Println("       sqirvy-cli completion install [bash|zsh|fish|powershell] [--dir directory]")
+	fmt.Println("\nFlags:")
+	cmd.Flags().PrintDefaults()
+	return nil
+}
+
+// init registers the completion commands and the completion of model names,
+// providers and config keys.
+func init() {
+	for _, shell := range completionShells {
+		completionCmd.AddCommand(&cobra.Command{
+			Use:               shell,
+			Short:             "Print the " + shell + " completion script",
+			Args:              cobra.NoArgs,
+			ValidArgsFunction: cobra.NoFileCompletions,
+			Run: func(cmd *cobra.Command, args []string) {
+				script, err := completionScript(cmd.Name())
+				if err != nil {
+					log.Fatalf("Error executing completion command: %v", err)
+				}
+				os.Stdout.Write(script)
+			},
+		})
+	}
+	completionInstallCmd.Flags().String("dir", "", "Directory to write the script to instead of the completion directory of the shell")
+	completionInstallCmd.MarkFlagDirname("dir")
+	completionCmd.AddCommand(completionInstallCmd)
+	rootCmd.AddCommand(completionCmd)
+	completionCmd.SetUsageFunc(completionUsage)
+
+	// the completion of flags is registered where the flags are defined
+	modelsResolveCmd.ValidArgsFunction = completeModels
+	configGetCmd.ValidArgsFunction = completeConfigKeys
+	configSetCmd.ValidArgsFunction = completeConfigKeys
+	keysSetCmd.ValidArgsFunction = completeKeyProviders
+	keysCheckCmd.ValidArgsFunction = completeKeyProviders
+}
@@ -0,0 +1,191 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func TestValidArgsFunctions(t *testing.T) {
+	viper.Set("profiles", map[string]any{"work": map[string]any{"model": "gpt-4o"}, "home": map[string]any{"model": "gpt-4o-mini"}})
+	defer viper.Reset()
+
+	flagCompletion := func(c *cobra.Command, flag string) cobra.CompletionFunc {
+		f, ok := c.GetFlagCompletionFunc(flag)
+		if !ok {
+			t.Fatalf("no completion of --%s for %s", flag, c.Name())
+		}
+		return f
+	}
+
+	tests := []struct {
+		name          string
+		complete      cobra.CompletionFunc
+		cmd           *cobra.Command
+		args          []string
+		toComplete    string
+		contains      []string // completions that must be returned
+		excludes      []string // completions that must not be returned
+		all           func(string) bool
+		wantDirective cobra.ShellCompDirective
+	}{
+		{
+			name:          "model argument",
+			complete:      modelsResolveCmd.ValidArgsFunction,
+			cmd:           modelsResolveCmd,
+			toComplete:    "gpt-4o-m",
+			contains:      []string{"gpt-4o-mini\topenai"},
+			all:           func(c string) bool { return strings.HasPrefix(c, "gpt-4o-m") },
+			wantDirective: cobra.ShellCompDirectiveNoFileComp,
+		},
+		{
+			name:          "model alias",
+			complete:      flagCompletion(rootCmd, "model"),
+			cmd:           rootCmd,
+			toComplete:    "claude-3-5-haiku",
+			contains:      []string{"claude-3-5-haiku\talias of claude-3-5-haiku-latest"},
+			wantDirective: cobra.ShellCompDirectiveNoFileComp,
+		},
+		{
+			name:          "last model of a list",
+			complete:      flagCompletion(rootCmd, "race"),
+			cmd:           rootCmd,
+			toComplete:    "gpt-4o,gpt-4o-m",
+			contains:      []string{"gpt-4o,gpt-4o-mini\topenai"},
+			all:           func(c string) bool { return strings.HasPrefix(c, "gpt-4o,gpt-4o-m") },
+			wantDirective: cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveNoSpace,
+		},
+		{
+			name:          "providers",
+			complete:      flagCompletion(rootCmd, "provider"),
+			cmd:           rootCmd,
+			contains:      []string{"anthropic", "openai"},
+			wantDirective: cobra.ShellCompDirectiveNoFileComp,
+		},
+		{
+			name:          "key providers not given yet",
+			complete:      keysCheckCmd.ValidArgsFunction,
+			cmd:           keysCheckCmd,
+			args:          []string{"openai"},
+			contains:      []string{"anthropic"},
+			excludes:      []string{"openai"},
+			all:           func(c string) bool { return providerKeyVar(c) != "" },
+			wantDirective: cobra.ShellCompDirectiveNoFileComp,
+		},
+		{
+			name:          "keys set takes one provider",
+			complete:      keysSetCmd.ValidArgsFunction,
+			cmd:           keysSetCmd,
+			args:          []string{"openai"},
+			all:           func(c string) bool { return false },
+			wantDirective: cobra.ShellCompDirectiveNoFileComp,
+		},
+		{
+			name:          "config keys",
+			complete:      configGetCmd.ValidArgsFunction,
+			cmd:           configGetCmd,
+			toComplete:    "mod",
+			contains:      []string{"model", "models-file", "moderation"},
+			all:           func(c string) bool { return strings.HasPrefix(c, "mod") },
+			wantDirective: cobra.ShellCompDirectiveNoFileComp,
+		},
+		{
+			name:          "config value",
+			complete:      configSetCmd.ValidArgsFunction,
+			cmd:           configSetCmd,
+			args:          []string{"model"},
+			all:           func(c string) bool { return false },
+			wantDirective: cobra.ShellCompDirectiveNoFileComp,
+		},
+		{
+			name:          "profiles",
+			complete:      flagCompletion(rootCmd, "profile"),
+			cmd:           rootCmd,
+			contains:      []string{"home", "work"},
+			wantDirective: cobra.ShellCompDirectiveNoFileComp,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, directive := tt.complete(tt.cmd, tt.args, tt.toComplete)
+			if directive != tt.wantDirective {
+				t.Errorf("directive = %v, want %v", directive, tt.wantDirective)
+			}
+			for _, want := range tt.contains {
+				if !slices.Contains(got, want) {
+					t.Errorf("completions %q do not contain %q", got, want)
+				}
+			}
+			for _, exclude := range tt.excludes {
+				if slices.Contains(got, exclude) {
+					t.Errorf("completions %q contain %q", got, exclude)
+				}
+			}
+			if tt.all != nil {
+				for _, c := range got {
+					if !tt.all(c) {
+						t.Errorf("unexpected completion %q", c)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestCompletionScripts(t *testing.T) {
+	for _, shell := range completionShells {
+		t.Run(shell, func(t *testing.T) {
+			script, err := completionScript(shell)
+			if err != nil {
+				t.Fatalf("completionScript() error = %v", err)
+			}
+			if !strings.Contains(string(script), "sqirvy-cli") {
+				t.Errorf("completionScript() does not complete sqirvy-cli:\n%s", script)
+			}
+		})
+	}
+	if _, err := completionScript("tcsh"); err == nil {
+		t.Error("completionScript(tcsh) error = nil")
+	}
+}
+
+func TestInstallCompletion(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_DATA_HOME", filepath.Join(home, "data"))
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, "config"))
+	t.Setenv("ZDOTDIR", "")
+
+	tests := []struct {
+		shell string
+		dir   string
+		want  string
+	}{
+		{shell: "bash", want: filepath.Join(home, "data", "bash-completion", "completions", "sqirvy-cli")},
+		{shell: "zsh", want: filepath.Join(home, ".zsh", "completions", "_sqirvy-cli")},
+		{shell: "fish", want: filepath.Join(home, "config", "fish", "completions", "sqirvy-cli.fish")},
+		{shell: "powershell", want: filepath.Join(home, "config", "powershell", "sqirvy-cli.ps1")},
+		{shell: "bash", dir: filepath.Join(home, "custom"), want: filepath.Join(home, "custom", "sqirvy-cli")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.shell+" "+tt.dir, func(t *testing.T) {
+			path, err := installCompletion(tt.shell, tt.dir)
+			if err != nil {
+				t.Fatalf("installCompletion() error = %v", err)
+			}
+			if path != tt.want {
+				t.Errorf("installCompletion() = %s, want %s", path, tt.want)
+			}
+			script, err := os.ReadFile(path)
+			if err != nil || len(script) == 0 {
+				t.Errorf("installed script = %d bytes, %v", len(script), err)
+			}
+		})
+	}
+}
@@ -0,0 +1,320 @@
+/*
+Copyright © 2025 David Howard  dmh2000@gmail.com
+*/
+package cmd
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultConfig is the commented configuration file written by config init.
+//
+//go:embed defaults/config.yaml
+var defaultConfig string
+
+// configCmd groups the subcommands that manage the configuration file.
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Manage the configuration file",
+	Long: `sqirvy-cli config manages the configuration file.
+	init    write a commented default configuration file
+	get     print the effective value of a key
+	set     write a key to the configuration file
+	list    print the effective configuration (flags, environment and file merged)
+	path    print the path of the configuration file, and with --all the config, data
+	        and cache directories
+	validate  check the configuration file for unknown keys, wrong types and unknown models
+Nested keys are separated by dots, e.g. commands.code.model.
+`,
+}
+
+var configInitCmd = &cobra.Command{
+	Use:               "init",
+	Short:             "Write a commented default configuration file",
+	Args:              cobra.NoArgs,
+	ValidArgsFunction: cobra.NoFileCompletions,
+	Run: func(cmd *cobra.Command, args []string) {
+		force, _ := cmd.Flags().GetBool("force")
+		path, err := configFilePath()
+		if err != nil {
+			log.Fatalf("Error executing config init command: %v", err)
+		}
+		if err := writeConfigFile(path, []byte(defaultConfig), force); err != nil {
+			log.Fatalf("Error executing config init command: %v", err)
+		}
+		fmt.Println(path)
+	},
+}
+
+var configGetCmd = &cobra.Command{
+	Use:   "get key",
+	Short: "Print the effective value of a key",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if !viper.IsSet(args[0]) {
+			log.Fatalf("Error executing config get command: %s is not set", args[0])
+		}
+		out, err := formatConfigValue(viper.Get(args[0]))
+		if err != nil {
+			log.Fatalf("Error executing config get command: %v", err)
+		}
+		fmt.Println(out)
+	},
+}
+
+var configSetCmd = &cobra.Command{
+	Use:   "set key value",
+	Short: "Write a key to the configuration file",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		path, err := configFilePath()
+		if err != nil {
+			log.Fatalf("Error executing config set command: %v", err)
+		}
+		if err := setConfigKey(path, args[0], args[1]); err != nil {
+			log.Fatalf("Error executing config set command: %v", err)
+		}
+	},
+}
+
+var configListCmd = &cobra.Command{
+	Use:               "list",
+	Short:             "Print the effective configuration",
+	Args:              cobra.NoArgs,
+	ValidArgsFunction: cobra.NoFileCompletions,
+	Run: func(cmd *cobra.Command, args []string) {
+		out, err := yaml.Marshal(viper.AllSettings())
+		if err != nil {
+			log.Fatalf("Error executing config list command: %v", err)
+		}
+		fmt.Print(string(out))
+	},
+}
+
+var configPathCmd = &cobra.Command{
+	Use:               "path",
+	Short:             "Print the path of the configuration file",
+	Args:              cobra.NoArgs,
+	ValidArgsFunction: cobra.NoFileCompletions,
+	Run: func(cmd *cobra.Command, args []string) {
+		path, err := configFilePath()
+		if err != nil {
+			log.Fatalf("Error executing config path command: %v", err)
+		}
+		if all, _ := cmd.Flags().GetBool("all"); !all {
+			fmt.Println(path)
+			return
+		}
+		fmt.Printf("config file:  %s\n", path)
+		for _, d := range []struct {
+			name string
+			dir  func() (string, error)
+		}{{"config dir:", configDir}, {"data dir:", dataDir}, {"cache dir:", cacheDir}} {
+			dir, err := d.dir()
+			if err != nil {
+				log.Fatalf("Error executing config path command: %v", err)
+			}
+			fmt.Printf("%-13s %s\n", d.name, dir)
+		}
+	},
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate [file]",
+	Short: "Check the configuration file for unknown keys, wrong types and unknown models",
+	Long: `sqirvy-cli config validate checks the configuration file, or the given file,
+against the settings sqirvy-cli understands. It reports unknown keys, e.g. modle:
+for model:, values of the wrong type, e.g. a duration without a unit, values that
+are not one of the allowed ones and unknown model names, each with its line. The
+problems are also warned about whenever the file is loaded. The command exits
+with status 1 if there is any problem.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		format, _ := cmd.Flags().GetString("format")
+		path, err := configFilePath()
+		if len(args) > 0 {
+			path, err = args[0], nil
+		}
+		if err != nil {
+			log.Fatalf("Error executing config validate command: %v", err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			log.Fatalf("Error executing config validate command: %v", err)
+		}
+		issues, err := validateConfig(data)
+		if err != nil {
+			log.Fatalf("Error executing config validate command: %s: %v", path, err)
+		}
+
+		switch format {
+		case "json":
+			if issues == nil {
+				issues = []configIssue{}
+			}
+			b, err := json.MarshalIndent(issues, "", "  ")
+			if err != nil {
+				log.Fatalf("Error executing config validate command: %v", err)
+			}
+			fmt.Println(string(b))
+		case "text":
+			for _, issue := range issues {
+				severity := "warning"
+				if issue.Error {
+					severity = "error"
+				}
+				fmt.Printf("%s:%d:%d: %s: %s: %s\n", path, issue.Line, issue.Column, severity, issue.Key, issue.Message)
+			}
+			if len(issues) == 0 {
+				fmt.Printf("%s: ok\n", path)
+			}
+		default:
+			log.Fatalf("Error executing config validate command: unknown format %q (use text or json)", format)
+		}
+		if len(issues) > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+// configFilePath returns the --config file, the config file that was loaded, or the
+// default location if there is neither.
+func configFilePath() (string, error) {
+	if cfgFile != "" {
+		return cfgFile, nil
+	}
+	if used := viper.ConfigFileUsed(); used != "" {
+		if _, err := os.Stat(used); err == nil {
+			return used, nil
+		}
+	}
+	return configFileIn("config.yaml")
+}
+
+// writeConfigFile writes data to path, creating the directory if needed. The file
+// may hold API keys, so it is only readable by the user. An existing file is only
+// replaced if force is set.
+func writeConfigFile(path string, data []byte, force bool) error {
+	if _, err := os.Stat(path); err == nil && !force {
+		return fmt.Errorf("error: %s already exists (use --force to overwrite)", path)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("error: creating config directory: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return fmt.Errorf("error: writing config file: %w", err)
+	}
+	return nil
+}
+
+// setConfigKey sets a dotted key in the config file at path, creating the file if
+// it does not exist. The file is edited as a YAML node tree so comments are kept.
+func setConfigKey(path string, key string, value string) error {
+	var doc yaml.Node
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("error: reading config file: %w", err)
+	}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("error: parsing config file %s: %w", path, err)
+	}
+
+	if err := setYAMLKey(&doc, strings.Split(key, "."), value); err != nil {
+		return fmt.Errorf("error: setting %s: %w", key, err)
+	}
+
+	var out bytes.Buffer
+	enc := yaml.NewEncoder(&out)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return fmt.Errorf("error: encoding config file: %w", err)
+	}
+	return writeConfigFile(path, out.Bytes(), true)
+}
+
+// setYAMLKey sets the value at the key path in a YAML document, adding mappings as needed.
+// The value is written as a plain scalar, so numbers and booleans keep their type.
+func setYAMLKey(doc *yaml.Node, keys []string, value string) error {
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 {
+		*doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+	node := doc.Content[0]
+	if node.Kind != yaml.MappingNode {
+		return fmt.Errorf("config file is not a mapping")
+	}
+
+	for i, key := range keys {
+		last := i == len(keys)-1
+
+		var child *yaml.Node
+		for j := 0; j+1 < len(node.Content); j += 2 {
+			// viper keys are case insensitive
+			if strings.EqualFold(node.Content[j].Value, key) {
+				child = node.Content[j+1]
+				break
+			}
+		}
+
+		switch {
+		case last && child != nil:
+			*child = yaml.Node{Kind: yaml.ScalarNode, Value: value, LineComment: child.LineComment}
+		case last:
+			node.Content = append(node.Content,
+				&yaml.Node{Kind: yaml.ScalarNode, Value: key},
+				&yaml.Node{Kind: yaml.ScalarNode, Value: value})
+		case child == nil:
+			child = &yaml.Node{Kind: yaml.MappingNode}
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, child)
+			node = child
+		case child.Kind == yaml.MappingNode:
+			node = child
+		default:
+			return fmt.Errorf("%s is not a section", strings.Join(keys[:i+1], "."))
+		}
+	}
+	return nil
+}
+
+// formatConfigValue renders a setting for output, scalars as is and sections as YAML.
+func formatConfigValue(value any) (string, error) {
+	switch value.(type) {
+	case map[string]any, []any:
+		out, err := yaml.Marshal(value)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(out), "\n"), nil
+	default:
+		return fmt.Sprint(value), nil
+	}
+}
+
+// configUsage prints the usage instructions for the config command.
+func configUsage(cmd *cobra.Command) error {
+	fmt.Println("Usage: sqirvy-cli config [init | get key | set key value | list | path | validate [file]] [flags]")
+	fmt.Println("\nFlags:")
+	cmd.Flags().PrintDefaults()
+	return nil
+}
+
+// init registers the config command and its subcommands with the root command.
+func init() {
+	configInitCmd.Flags().Bool("force", false, "Overwrite an existing configuration file")
+	configPathCmd.Flags().Bool("all", false, "Also print the config, data and cache directories")
+	configValidateCmd.Flags().String("format", "text", "Output format: text or json")
+	configCmd.AddCommand(configInitCmd, configGetCmd, configSetCmd, configListCmd, configPathCmd, configValidateCmd)
+	rootCmd.AddCommand(configCmd)
+	configCmd.SetUsageFunc(configUsage)
+}
@@ -0,0 +1,351 @@
+// Package cmd implements the schema of the config file. The config file is
+// checked against it when it is loaded, by config validate and by doctor, so that
+// a typo such as modle: or a duration written as 30 is reported with its line
+// instead of being silently ignored. Unknown keys and model names are warnings;
+// values of the wrong type, which the settings cannot use, are errors.
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	sqirvy "github.com/dmh2000/sqirvy-cli/pkg/sqirvy"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// configKind is the type of the value of a config key.
+type configKind int
+
+const (
+	kindSection  configKind = iota // a mapping with the keys of Fields
+	kindMap                        // a mapping with any keys, or those of Names, and values of Elem
+	kindString                     // any scalar, read as a string
+	kindBool                       // true or false
+	kindInt                        // an integer
+	kindNumber                     // an integer or a decimal number
+	kindDuration                   // a duration such as 30s or 2m
+	kindStrings                    // a list of strings
+	kindModel                      // a model name or alias
+	kindModels                     // a list of model names or aliases
+)
+
+// configField describes the value of a config key.
+type configField struct {
+	Kind   configKind
+	Fields map[string]*configField // keys of a section
+	Elem   *configField            // values of a map
+	Names  func() []string         // allowed keys of a map, any if nil
+	What   string                  // what the keys of a map name, e.g. provider
+	Values []string                // allowed values of a string, any if nil
+}
+
+// configSchema is the schema of the config file.
+var configSchema = newConfigSchema()
+
+// knownConfigKeys are the top level keys understood in the config file.
+var knownConfigKeys = slices.Sorted(maps.Keys(configSchema.Fields))
+
+// newConfigSchema returns the schema of the config file. A profile can set any
+// key but profile and profiles.
+func newConfigSchema() *configField {
+	str := &configField{Kind: kindString}
+	boolean := &configField{Kind: kindBool}
+	integer := &configField{Kind: kindInt}
+	number := &configField{Kind: kindNumber}
+	duration := &configField{Kind: kindDuration}
+	strs := &configField{Kind: kindStrings}
+	model := &configField{Kind: kindModel}
+	enum := func(values ...string) *configField { return &configField{Kind: kindString, Values: values} }
+	section := func(fields map[string]*configField) *configField {
+		return &configField{Kind: kindSection, Fields: fields}
+	}
+	perProvider := func(elem *configField) *configField {
+		return &configField{Kind: kindMap, Elem: elem, Names: sqirvy.GetProviderList, What: "provider"}
+	}
+	strMap := &configField{Kind: kindMap, Elem: str}
+
+	fields := map[string]*configField{
+		"archive":      section(map[string]*configField{"ignore": strs}),
+		"audit":        section(map[string]*configField{"enabled": boolean, "file": str, "include_text": boolean, "key": str}),
+		"auto-upgrade": boolean,
+		"budget":       section(map[string]*configField{"per_run": number, "monthly": number, "ledger": str}),
+		"circuit":      section(map[string]*configField{"threshold": integer, "cooldown": duration, "fallback_model": model}),
+		"commands": {Kind: kindMap, Names: commandNames, What: "command",
+			Elem: section(map[string]*configField{"model": model, "temperature": number})},
+		"confirm":        section(map[string]*configField{"tokens": integer, "cost": number}),
+		"default-prompt": str,
+		"env":            strMap,
+		"headers":        perProvider(strMap),
+		"hooks": section(map[string]*configField{"model": model, "timeout": duration, "fail_open": boolean,
+			"fail_on": enum(slices.Sorted(maps.Keys(failOnSeverities))...)}),
+		"http": section(map[string]*configField{"proxy": str, "ca_file": str, "cert_file": str, "key_file": str,
+			"max_idle_conns_per_host": integer, "idle_timeout": duration, "disable_http2": boolean}),
+		"key_command":   perProvider(str),
+		"log-format":    enum("text", "json"),
+		"memoize":       boolean,
+		"mock":          section(map[string]*configField{"response": str}),
+		"model":         model,
+		"models-file":   str,
+		"models_update": section(map[string]*configField{"url": str, "public_key": str}),
+		"moderation": section(map[string]*configField{"provider": enum(moderationOpenAI, moderationLocal),
+			"action": enum(moderationWarn, moderationBlock), "rules": strMap}),
+		"notify":      section(map[string]*configField{"enabled": boolean, "min_duration": duration, "command": str}),
+		"post":        section(map[string]*configField{"url": str, "timeout": duration, "headers": strMap}),
+		"prefill":     str,
+		"provider":    enum(sqirvy.GetProviderList()...),
+		"query_hooks": section(map[string]*configField{"pre": strs, "post": strs, "timeout": duration}),
+		"race":        {Kind: kindModels},
+		"rate_limits": perProvider(section(map[string]*configField{"requests_per_minute": integer, "tokens_per_minute": integer})),
+		"redact": section(map[string]*configField{"mode": enum(redactMask, redactWarn, redactBlock, redactOff),
+			"ignore": strs, "patterns": strMap}),
+		"repomap":           section(map[string]*configField{"tokens": integer}),
+		"rerank":            section(map[string]*configField{"service": str, "model": str}),
+		"sample-mode":       enum(sampleModeAll, sampleModeVote, sampleModeMerge, sampleModeJSON),
+		"samples":           integer,
+		"seed":              integer,
+		"speak":             section(map[string]*configField{"service": str, "model": str, "voice": str, "player": str}),
+		"stop":              strs,
+		"system_prompt":     str,
+		"tables":            section(map[string]*configField{"max_rows": integer, "sample_rows": integer}),
+		"temperature":       number,
+		"temperature-scale": enum(temperatureScaleUnit, temperatureScalePercent, temperatureScaleNative),
+		"timeouts": perProvider(section(map[string]*configField{"dial": duration, "tls_handshake": duration,
+			"response_header": duration, "total": duration})),
+		"transcribe": section(map[string]*configField{"service": str, "model": str, "language": str}),
+		"vars":       strMap,
+	}
+
+	profile := section(maps.Clone(fields))
+	fields["profile"] = str
+	fields["profiles"] = &configField{Kind: kindMap, Elem: profile}
+	return section(fields)
+}
+
+// commandNames returns the names of the commands, the keys of the commands section.
+func commandNames() []string {
+	var names []string
+	for _, c := range rootCmd.Commands() {
+		names = append(names, c.Name())
+	}
+	return names
+}
+
+// configChecked ensures the config file is checked only once per run.
+var configChecked bool
+
+// initConfigCheck warns about the problems of the loaded config file. It runs after
+// initModels, so that the models of models.yaml are known. Shell completion, which
+// prints to the terminal of the user, skips it.
+func initConfigCheck() {
+	path := viper.ConfigFileUsed()
+	if configChecked || path == "" || (len(os.Args) > 1 && strings.HasPrefix(os.Args[1], cobra.ShellCompRequestCmd)) {
+		return
+	}
+	configChecked = true
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	issues, err := validateConfig(data)
+	if err != nil {
+		// reported by initConfig
+		return
+	}
+	for _, issue := range issues {
+		slog.Warn("Config file "+issue.String(), "path", path)
+	}
+}
+
+// configIssue is a problem of the config file.
+type configIssue struct {
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Key     string `json:"key"` // dotted path of the key, e.g. commands.code.model
+	Message string `json:"message"`
+	Error   bool   `json:"error"` // the value cannot be used, otherwise a warning
+}
+
+// String returns the issue as "line 3: modle: unknown key, did you mean model?".
+func (i configIssue) String() string {
+	return fmt.Sprintf("line %d: %s: %s", i.Line, i.Key, i.Message)
+}
+
+// validateConfig checks the contents of a config file against the schema. It
+// returns an error if the file is not valid YAML.
+func validateConfig(data []byte) ([]configIssue, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil
+	}
+	var issues []configIssue
+	checkConfigNode(doc.Content[0], configSchema, "", &issues)
+	return issues, nil
+}
+
+// checkConfigNode checks a value of the config file against its field and adds the
+// problems to issues.
+func checkConfigNode(node *yaml.Node, field *configField, key string, issues *[]configIssue) {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!null" {
+		// an empty value leaves the setting unset
+		return
+	}
+	issue := func(error bool, format string, args ...any) {
+		*issues = append(*issues, configIssue{node.Line, node.Column, key, fmt.Sprintf(format, args...), error})
+	}
+
+	switch field.Kind {
+	case kindSection, kindMap:
+		if node.Kind != yaml.MappingNode {
+			issue(true, "expected a mapping of keys to values, found %s", describeNode(node))
+			return
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			name, value := node.Content[i].Value, node.Content[i+1]
+			sub := joinKey(key, name)
+			switch {
+			case name == "<<":
+				// YAML merge key
+				checkConfigNode(value, field, key, issues)
+			case field.Kind == kindMap:
+				if field.Names != nil && !slices.Contains(field.Names(), name) {
+					*issues = append(*issues, configIssue{node.Content[i].Line, node.Content[i].Column, sub,
+						fmt.Sprintf("unknown %s%s", field.What, didYouMean(name, field.Names())), false})
+				}
+				checkConfigNode(value, field.Elem, sub, issues)
+			case field.Fields[name] == nil:
+				*issues = append(*issues, configIssue{node.Content[i].Line, node.Content[i].Column, sub,
+					"unknown key" + didYouMean(name, slices.Collect(maps.Keys(field.Fields))), false})
+			default:
+				checkConfigNode(value, field.Fields[name], sub, issues)
+			}
+		}
+
+	case kindStrings, kindModels:
+		if node.Kind != yaml.SequenceNode {
+			issue(true, "expected a list, e.g. [%s], found %s", node.Value, describeNode(node))
+			return
+		}
+		elem := &configField{Kind: kindString}
+		if field.Kind == kindModels {
+			elem.Kind = kindModel
+		}
+		for _, item := range node.Content {
+			checkConfigNode(item, elem, key, issues)
+		}
+
+	default:
+		if node.Kind != yaml.ScalarNode {
+			issue(true, "expected %s, found %s", describeKind(field.Kind), describeNode(node))
+			return
+		}
+		checkConfigScalar(node, field, issue)
+	}
+}
+
+// checkConfigScalar checks a scalar value of the config file against its field.
+func checkConfigScalar(node *yaml.Node, field *configField, issue func(error bool, format string, args ...any)) {
+	switch field.Kind {
+	case kindBool:
+		if node.Tag != "!!bool" {
+			issue(true, "expected true or false, found %q", node.Value)
+		}
+	case kindInt:
+		if node.Tag != "!!int" {
+			issue(true, "expected an integer, found %q", node.Value)
+		}
+	case kindNumber:
+		if node.Tag != "!!int" && node.Tag != "!!float" {
+			issue(true, "expected a number, found %q", node.Value)
+		}
+	case kindDuration:
+		if _, err := time.ParseDuration(node.Value); err != nil && node.Value != "0" {
+			issue(true, "expected a duration such as 30s, 2m or 1h30m, found %q", node.Value)
+		}
+	case kindModel:
+		if msg := checkModelName(node.Value); msg != "" {
+			issue(false, "%s", msg)
+		}
+	case kindString:
+		if field.Values != nil && !slices.Contains(field.Values, node.Value) {
+			issue(true, "unknown value %q, expected one of %s", node.Value, strings.Join(field.Values, ", "))
+		}
+	}
+}
+
+// checkModelName returns why a model name is not valid, or "" if it is a
+// registered model or alias, a GGUF file, or a model of the provider setting.
+func checkModelName(model string) string {
+	if strings.HasSuffix(model, ".gguf") || viper.GetString("provider") != "" {
+		return ""
+	}
+	if _, err := sqirvy.GetProviderName(sqirvy.ResolveModel(model)); err == nil {
+		return ""
+	}
+	msg := fmt.Sprintf("unknown model %q", model)
+	if suggestions := sqirvy.SuggestModels(model); len(suggestions) > 0 {
+		msg += ", did you mean " + suggestions[0] + "?"
+	} else {
+		msg += ", see sqirvy-cli models"
+	}
+	return msg
+}
+
+// didYouMean returns ", did you mean x?" for the closest candidate to name, or "".
+func didYouMean(name string, candidates []string) string {
+	suggestions := sqirvy.SuggestNames(name, candidates)
+	if len(suggestions) == 0 {
+		return ""
+	}
+	return ", did you mean " + suggestions[0] + "?"
+}
+
+// joinKey returns the dotted path of name below key.
+func joinKey(key, name string) string {
+	if key == "" {
+		return name
+	}
+	return key + "." + name
+}
+
+// describeKind returns the description of a scalar kind in issues.
+func describeKind(kind configKind) string {
+	switch kind {
+	case kindBool:
+		return "true or false"
+	case kindInt:
+		return "an integer"
+	case kindNumber:
+		return "a number"
+	case kindDuration:
+		return "a duration such as 30s"
+	case kindModel:
+		return "a model name"
+	}
+	return "a string"
+}
+
+// describeNode returns the description of a value in issues.
+func describeNode(node *yaml.Node) string {
+	switch node.Kind {
+	case yaml.MappingNode:
+		return "a mapping"
+	case yaml.SequenceNode:
+		return "a list"
+	}
+	return strconv.Quote(node.Value)
+}
@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestValidateConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		want   []configIssue
+	}{
+		{
+			name:   "valid",
+			config: "model: claude-3-5-haiku\ntemperature: 0.7\nbudget:\n  monthly: 20\nnotify:\n  min_duration: 30s\n",
+		},
+		{
+			name:   "empty",
+			config: "",
+		},
+		{
+			name:   "unknown key",
+			config: "modle: gpt-4o\n",
+			want:   []configIssue{{Line: 1, Column: 1, Key: "modle", Message: "unknown key, did you mean model?"}},
+		},
+		{
+			name:   "unknown key of a section",
+			config: "budget:\n  per_run: 1\n  montly: 20\n",
+			want:   []configIssue{{Line: 3, Column: 3, Key: "budget.montly", Message: "unknown key, did you mean monthly?"}},
+		},
+		{
+			name:   "unknown key of a profile",
+			config: "profiles:\n  fast:\n    temprature: 1\n",
+			want:   []configIssue{{Line: 3, Column: 5, Key: "profiles.fast.temprature", Message: "unknown key, did you mean temperature?"}},
+		},
+		{
+			name:   "unknown provider",
+			config: "headers:\n  opnai:\n    X-Team: search\n",
+			want:   []configIssue{{Line: 2, Column: 3, Key: "headers.opnai", Message: "unknown provider, did you mean openai?"}},
+		},
+		{
+			name:   "unknown command",
+			config: "commands:\n  qurey:\n    temperature: 0.2\n",
+			want:   []configIssue{{Line: 2, Column: 3, Key: "commands.qurey", Message: "unknown command, did you mean query?"}},
+		},
+		{
+			name:   "unknown key without a suggestion",
+			config: "colour: blue\n",
+			want:   []configIssue{{Line: 1, Column: 1, Key: "colour", Message: "unknown key"}},
+		},
+		{
+			name:   "number",
+			config: "temperature: hot\n",
+			want:   []configIssue{{Line: 1, Column: 14, Key: "temperature", Message: `expected a number, found "hot"`, Error: true}},
+		},
+		{
+			name:   "integer",
+			config: "samples: 2.5\n",
+			want:   []configIssue{{Line: 1, Column: 10, Key: "samples", Message: `expected an integer, found "2.5"`, Error: true}},
+		},
+		{
+			name:   "bool",
+			config: "memoize: yes\n",
+			want:   []configIssue{{Line: 1, Column: 10, Key: "memoize", Message: `expected true or false, found "yes"`, Error: true}},
+		},
+		{
+			name:   "duration without a unit",
+			config: "notify:\n  min_duration: 30\n",
+			want:   []configIssue{{Line: 2, Column: 17, Key: "notify.min_duration", Message: `expected a duration such as 30s, 2m or 1h30m, found "30"`, Error: true}},
+		},
+		{
+			name:   "list",
+			config: "stop: END\n",
+			want:   []configIssue{{Line: 1, Column: 7, Key: "stop", Message: `expected a list, e.g. [END], found "END"`, Error: true}},
+		},
+		{
+			name:   "section",
+			config: "budget: 5\n",
+			want:   []configIssue{{Line: 1, Column: 9, Key: "budget", Message: `expected a mapping of keys to values, found "5"`, Error: true}},
+		},
+		{
+			name:   "enum",
+			config: "log-format: xml\n",
+			want:   []configIssue{{Line: 1, Column: 13, Key: "log-format", Message: `unknown value "xml", expected one of text, json`, Error: true}},
+		},
+		{
+			name:   "unknown model",
+			config: "model: completely-unknown-model-name\n",
+			want:   []configIssue{{Line: 1, Column: 8, Key: "model", Message: `unknown model "completely-unknown-model-name", see sqirvy-cli models`}},
+		},
+		{
+			name:   "issues in file order",
+			config: "model: claude-3-5-haiku\n\n# budget\nbudget:\n  monthly: lots\nmodle: gpt-4o\n",
+			want: []configIssue{
+				{Line: 5, Column: 12, Key: "budget.monthly", Message: `expected a number, found "lots"`, Error: true},
+				{Line: 6, Column: 1, Key: "modle", Message: "unknown key, did you mean model?"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := validateConfig([]byte(tt.config))
+			if err != nil {
+				t.Fatalf("validateConfig() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("validateConfig() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateConfigInvalidYAML(t *testing.T) {
+	if _, err := validateConfig([]byte("model: [gpt-4o\n")); err == nil {
+		t.Error("validateConfig() error = nil for invalid YAML")
+	}
+}
+
+func TestValidateExampleConfigs(t *testing.T) {
+	for _, path := range []string{"../../example-config.yaml", "defaults/config.yaml"} {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		issues, err := validateConfig(data)
+		if err != nil || len(issues) > 0 {
+			t.Errorf("validateConfig(%s) = %v, %v, want no issues", path, issues, err)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+// Package cmd implements the confirmation of large prompts. When the prompt of a
+// query is estimated above confirm.tokens tokens, or its input above confirm.cost
+// USD, in the config file, a summary of the files, tokens and cost is shown and
+// the query is sent only if it is confirmed on the terminal, so that a command
+// like review ./ cannot send a huge prompt by accident. --yes skips the question.
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	sqirvy "github.com/dmh2000/sqirvy-cli/pkg/sqirvy"
+
+	"github.com/spf13/viper"
+)
+
+// Thresholds of the confirmation when confirm.tokens and confirm.cost are not set.
+const (
+	defaultConfirmTokens = 100000
+	defaultConfirmCost   = 1.0
+)
+
+// confirmLargePrompt asks on the terminal whether to send the prompts to the
+// model if they are above the token or cost threshold. It is an error if the
+// query is declined, or if there is no terminal to ask on and --yes is not set.
+func confirmLargePrompt(model, system string, prompts []string) error {
+	if yes, _ := rootCmd.PersistentFlags().GetBool("yes"); yes {
+		return nil
+	}
+	maxTokens := int64(defaultConfirmTokens)
+	if viper.IsSet("confirm.tokens") {
+		maxTokens = viper.GetInt64("confirm.tokens")
+	}
+	maxCost := defaultConfirmCost
+	if viper.IsSet("confirm.cost") {
+		maxCost = viper.GetFloat64("confirm.cost")
+	}
+
+	tokens := sqirvy.EstimateTokens(system, prompts)
+	cost := sqirvy.EstimateCost(model, sqirvy.Usage{InputTokens: tokens})
+	if (maxTokens <= 0 || tokens <= maxTokens) && (maxCost <= 0 || cost <= maxCost) {
+		return nil
+	}
+
+	files := 0
+	for _, p := range prompts {
+		if strings.HasPrefix(p, "--- START FILE: ") {
+			files++
+		}
+	}
+	summary := fmt.Sprintf("%d files, about %d tokens, est. $%.2f of input to %s", files, tokens, cost, model)
+
+	// stdin may hold the prompt, so the question is asked on the terminal
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return fmt.Errorf("error: the prompt is large (%s), use --yes to send it", summary)
+	}
+	defer tty.Close()
+	w := &setupWizard{in: bufio.NewReader(tty), out: tty}
+	ok, err := w.confirm("The prompt is large: "+summary+". Send it?", false)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("error: query cancelled")
+	}
+	slog.Debug("Large prompt confirmed", "tokens", tokens, "cost", cost)
+	return nil
+}
+
+// init adds the --yes flag.
+func init() {
+	rootCmd.PersistentFlags().BoolP("yes", "y", false, "Send large prompts without asking for confirmation (see confirm.tokens and confirm.cost in the config file)")
+}
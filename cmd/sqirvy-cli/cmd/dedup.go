@@ -0,0 +1,71 @@
+/*
+Copyright © 2025 David Howard  dmh2000@gmail.com
+*/
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// inputSet tracks the inputs of a prompt to skip duplicates: the same file or URL
+// given twice, or inputs with the same content, e.g. stdin redirected from a file
+// that is also an argument. It maps the keys of each input to its name.
+type inputSet map[string]string
+
+// duplicate reports whether an input with one of the keys was already added, and
+// records the keys of the input otherwise. Empty keys are ignored. Duplicates are
+// reported on stderr.
+func (s inputSet) duplicate(name string, keys ...string) bool {
+	for _, key := range keys {
+		if first, ok := s[key]; ok && key != "" {
+			slog.Info("Skipped duplicate input", "input", name, "duplicate_of", first)
+			return true
+		}
+	}
+	for _, key := range keys {
+		if key != "" {
+			s[key] = name
+		}
+	}
+	return false
+}
+
+// fileKey identifies a file or directory by its absolute path with symbolic
+// links resolved, so that ./a.go, a.go and a link to it are the same input.
+func fileKey(name string) string {
+	path, err := filepath.Abs(name)
+	if err != nil {
+		return "file:" + name
+	}
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	return "file:" + path
+}
+
+// urlKey identifies a URL without its fragment, ignoring the case of the scheme
+// and host and a trailing slash.
+func urlKey(u *url.URL) string {
+	v := *u
+	v.Scheme = strings.ToLower(v.Scheme)
+	v.Host = strings.ToLower(v.Host)
+	v.Fragment, v.RawFragment = "", ""
+	v.Path = strings.TrimSuffix(v.Path, "/")
+	v.RawPath = strings.TrimSuffix(v.RawPath, "/")
+	return "url:" + v.String()
+}
+
+// contentKey identifies an input by its content, ignoring leading and trailing
+// white space. Empty inputs have no key and are never duplicates.
+func contentKey(text string) string {
+	if strings.TrimSpace(text) == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(strings.TrimSpace(text)))
+	return "content:" + hex.EncodeToString(sum[:])
+}
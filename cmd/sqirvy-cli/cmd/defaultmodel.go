@@ -0,0 +1,77 @@
+// Package cmd implements the choice of the default model. The model of --model,
+// SQIRVY_MODEL or model in the config file is used when it is set. Otherwise the
+// default model of the first provider, in the order of the init command, with an
+// API key is used, so that a user with only an Anthropic key does not get an
+// OpenAI or Gemini model by default. The choice and where it came from are logged
+// with --verbose.
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+
+	sqirvy "github.com/dmh2000/sqirvy-cli/pkg/sqirvy"
+
+	"github.com/spf13/viper"
+)
+
+// defaultModelOnce chooses the default model once, since looking for an API key
+// may run a key_command or read the OS keyring.
+var (
+	defaultModelOnce   sync.Once
+	defaultModelChoice string
+)
+
+// globalModel returns the model of --model, SQIRVY_MODEL or model in the config
+// file, or else the default model of the first provider with an API key. It
+// returns "" if there is no model and no API key.
+func globalModel() string {
+	defaultModelOnce.Do(func() {
+		var source string
+		defaultModelChoice, source = chooseDefaultModel()
+		if defaultModelChoice != "" {
+			slog.Debug("Default model", "model", defaultModelChoice, "from", source)
+		}
+	})
+	return defaultModelChoice
+}
+
+// chooseDefaultModel returns the default model and the setting or API key it
+// comes from.
+func chooseDefaultModel() (model, source string) {
+	if model := viper.GetString("model"); model != "" {
+		switch {
+		case rootCmd.PersistentFlags().Changed("model"):
+			return model, "--model"
+		case os.Getenv(envVarName("model")) != "":
+			return model, envVarName("model")
+		default:
+			return model, "config file"
+		}
+	}
+
+	for _, p := range setupProviders {
+		if !sqirvy.ProviderIncluded(p.Provider) {
+			continue
+		}
+		if err := loadAPIKey(p.Provider); err != nil {
+			slog.Debug("Skipping provider for the default model", "provider", p.Provider, "error", err)
+			continue
+		}
+		if os.Getenv(p.KeyVar) == "" {
+			continue
+		}
+		if p.BaseURLRequired && os.Getenv(p.BaseURLVar) == "" {
+			continue
+		}
+		return p.DefaultModel, p.KeyVar
+	}
+	return "", ""
+}
+
+// errNoModel is returned when a query has no model.
+func errNoModel() error {
+	return fmt.Errorf("error: no model selected: use --model, set model in the config file or SQIRVY_MODEL, or set an API key (see sqirvy-cli init)")
+}
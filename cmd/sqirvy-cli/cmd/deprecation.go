@@ -0,0 +1,51 @@
+// Package cmd implements the handling of deprecated models. A model the provider
+// has deprecated or retired is warned about when it is selected, and with
+// --auto-upgrade, or auto-upgrade in the config file, it is replaced by its
+// successor, so that a query does not fail at the provider.
+package cmd
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	sqirvy "github.com/dmh2000/sqirvy-cli/pkg/sqirvy"
+
+	"github.com/spf13/viper"
+)
+
+// deprecationWarned holds the deprecated models already warned about.
+var deprecationWarned sync.Map
+
+// resolveModel resolves the aliases and unique prefixes of a model name, then
+// warns once if the model is deprecated, or replaces it with its successor if
+// auto-upgrade is set.
+func resolveModel(name string) string {
+	model := sqirvy.ResolveModel(name)
+	d, deprecated := sqirvy.CheckDeprecation(model, time.Now())
+	if !deprecated {
+		return model
+	}
+	if viper.GetBool("auto-upgrade") {
+		if successor := sqirvy.UpgradeModel(model); successor != model {
+			if _, warned := deprecationWarned.LoadOrStore(model, true); !warned {
+				slog.Warn("The model is deprecated, using its successor", "model", model, "successor", successor)
+			}
+			return successor
+		}
+	}
+	if _, warned := deprecationWarned.LoadOrStore(model, true); !warned {
+		msg := d.String()
+		if d.Successor != "" {
+			msg += " (or set --auto-upgrade)"
+		}
+		slog.Warn(msg)
+	}
+	return model
+}
+
+// init adds the --auto-upgrade flag.
+func init() {
+	rootCmd.PersistentFlags().Bool("auto-upgrade", false, "Replace deprecated and retired models with their successors")
+	viper.BindPFlag("auto-upgrade", rootCmd.PersistentFlags().Lookup("auto-upgrade")) // Bind flag to Viper config
+}
@@ -0,0 +1,288 @@
+/*
+Copyright © 2025 David Howard  dmh2000@gmail.com
+*/
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	sqirvy "github.com/dmh2000/sqirvy-cli/pkg/sqirvy"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// Doctor check results
+const (
+	checkPass = "PASS"
+	checkWarn = "WARN"
+	checkFail = "FAIL"
+	checkSkip = "SKIP"
+)
+
+// doctorTimeout limits each network check.
+const doctorTimeout = 15 * time.Second
+
+// doctorCheck is one line of the doctor report.
+type doctorCheck struct {
+	Name   string
+	Status string
+	Detail string
+}
+
+// doctorCmd represents the command that diagnoses the local setup.
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check the configuration, API keys and provider connectivity",
+	Long: `sqirvy-cli doctor checks the configuration file, the spending this month
+against the monthly budget, the default model, the API key of each provider,
+whether recent failures have opened the circuit breaker of a provider, whether
+each configured provider endpoint can be reached, and sends a one token query
+to each configured provider.
+It prints a report and exits with status 1 if any check fails.
+`,
+	Args:              cobra.NoArgs,
+	ValidArgsFunction: cobra.NoFileCompletions,
+	Run: func(cmd *cobra.Command, args []string) {
+		checks := executeDoctor(context.Background())
+		if err := writeDoctorReport(os.Stdout, checks); err != nil {
+			log.Fatalf("Error executing doctor command: %v", err)
+		}
+		for _, c := range checks {
+			if c.Status == checkFail {
+				os.Exit(1)
+			}
+		}
+	},
+}
+
+// executeDoctor runs all checks and returns the results in report order.
+func executeDoctor(ctx context.Context) []doctorCheck {
+	version := buildVersion()
+	checks := []doctorCheck{
+		{"version", checkPass, version.short() + ", " + version.GoVersion + ", providers " + strings.Join(version.Providers, ",")},
+		checkConfigFile(),
+		checkBudget(),
+	}
+
+	model := sqirvy.ResolveModel(globalModel())
+	modelProvider, err := sqirvy.GetProviderName(model)
+	if model == "" {
+		checks = append(checks, doctorCheck{"default model", checkFail, errNoModel().Error()})
+	} else if err != nil {
+		checks = append(checks, doctorCheck{"default model", checkFail, err.Error()})
+	} else if d, deprecated := sqirvy.CheckDeprecation(model, time.Now()); deprecated {
+		status := checkWarn
+		if viper.GetBool("auto-upgrade") {
+			// queries use the successor, so it is the model that is pinged
+			model = sqirvy.UpgradeModel(model)
+		} else if d.Retired {
+			status = checkFail
+		}
+		checks = append(checks, doctorCheck{"default model", status, d.String()})
+	} else {
+		checks = append(checks, doctorCheck{"default model", checkPass, model + " (" + modelProvider + ")"})
+	}
+
+	for _, p := range setupProviders {
+		name := p.Provider
+		if !sqirvy.ProviderIncluded(name) {
+			checks = append(checks, doctorCheck{name + " api key", checkSkip, "not included in this build"})
+			continue
+		}
+		if err := loadAPIKey(p.Provider); err != nil {
+			checks = append(checks, doctorCheck{name + " api key", checkFail, err.Error()})
+			continue
+		}
+		if os.Getenv(p.KeyVar) == "" {
+			status := checkSkip
+			if name == modelProvider {
+				// the default model cannot be used without its key
+				status = checkFail
+			}
+			checks = append(checks, doctorCheck{name + " api key", status, p.KeyVar + " not set"})
+			continue
+		}
+		checks = append(checks, doctorCheck{name + " api key", checkPass, p.KeyVar + " set"})
+		checks = append(checks, checkCircuit(p.Provider))
+		checks = append(checks, checkReachable(ctx, p))
+		checks = append(checks, checkPing(ctx, p.Provider, model, modelProvider))
+	}
+	return checks
+}
+
+// checkConfigFile checks the config file, if any, against the schema of the config
+// file: it fails on invalid YAML and values of the wrong type, and warns about
+// unknown keys and models.
+func checkConfigFile() doctorCheck {
+	const name = "config file"
+	path, err := configFilePath()
+	if err != nil {
+		return doctorCheck{name, checkFail, err.Error()}
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return doctorCheck{name, checkSkip, "no config file at " + path + ", using defaults"}
+	}
+	if err != nil {
+		return doctorCheck{name, checkFail, err.Error()}
+	}
+
+	issues, err := validateConfig(data)
+	if err != nil {
+		return doctorCheck{name, checkFail, fmt.Sprintf("%s: %v", path, err)}
+	}
+	if len(issues) == 0 {
+		return doctorCheck{name, checkPass, path}
+	}
+	status := checkWarn
+	for _, issue := range issues {
+		if issue.Error {
+			status = checkFail
+		}
+	}
+	detail := fmt.Sprintf("%s: %s", path, issues[0])
+	if len(issues) > 1 {
+		detail += fmt.Sprintf(" and %d more problems", len(issues)-1)
+	}
+	return doctorCheck{name, status, detail + " (see sqirvy-cli config validate)"}
+}
+
+// checkBudget reports the spending recorded in the ledger this month against the
+// monthly budget.
+func checkBudget() doctorCheck {
+	const name = "monthly spend"
+	month, err := sqirvy.MonthlySpend(time.Now())
+	if err != nil {
+		return doctorCheck{name, checkFail, err.Error()}
+	}
+	spent := fmt.Sprintf("$%.4f in %d queries", month.Cost, month.Requests)
+	limit := viper.GetFloat64("budget.monthly")
+	switch {
+	case limit == 0:
+		return doctorCheck{name, checkPass, spent + ", no monthly budget"}
+	case month.Cost >= limit:
+		return doctorCheck{name, checkWarn, fmt.Sprintf("%s, monthly budget of $%.2f reached", spent, limit)}
+	}
+	return doctorCheck{name, checkPass, fmt.Sprintf("%s of the $%.2f monthly budget", spent, limit)}
+}
+
+// checkCircuit reports the recent failures of the provider and whether its circuit
+// is open, in which case queries fail immediately until the cooldown has passed.
+func checkCircuit(provider string) doctorCheck {
+	name := provider + " circuit"
+	h := sqirvy.GetProviderHealth(provider)
+	now := time.Now()
+	switch {
+	case h.Open(now):
+		return doctorCheck{name, checkWarn, fmt.Sprintf("open for %s after %d consecutive failures: %s",
+			h.OpenUntil.Sub(now).Round(time.Second), h.ConsecutiveFailures, h.LastError)}
+	case h.ConsecutiveFailures > 0:
+		return doctorCheck{name, checkPass, fmt.Sprintf("closed, %d recent failures: %s", h.ConsecutiveFailures, h.LastError)}
+	}
+	return doctorCheck{name, checkPass, "closed"}
+}
+
+// checkReachable checks that the provider endpoint answers HTTP requests.
+// Any HTTP response counts, since the request is not authenticated.
+func checkReachable(ctx context.Context, p providerSetup) doctorCheck {
+	name := p.Provider + " endpoint"
+	endpoint := p.DefaultBaseURL
+	if p.BaseURLVar != "" && os.Getenv(p.BaseURLVar) != "" {
+		endpoint = os.Getenv(p.BaseURLVar)
+	}
+	if endpoint == "" {
+		return doctorCheck{name, checkFail, p.BaseURLVar + " not set"}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, doctorTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return doctorCheck{name, checkFail, err.Error()}
+	}
+	start := time.Now()
+	resp, err := sqirvy.HTTPClient().Do(req)
+	if err != nil {
+		return doctorCheck{name, checkFail, err.Error()}
+	}
+	resp.Body.Close()
+	return doctorCheck{name, checkPass, fmt.Sprintf("%s answered in %dms", endpoint, time.Since(start).Milliseconds())}
+}
+
+// checkPing sends a one token query to the provider. It uses the default model if it
+// belongs to the provider, otherwise the cheapest registered model of the provider.
+func checkPing(ctx context.Context, provider string, model string, modelProvider string) doctorCheck {
+	name := provider + " query"
+	if modelProvider != provider {
+		model = cheapestModel(provider)
+		if model == "" {
+			return doctorCheck{name, checkSkip, "no registered models"}
+		}
+	}
+
+	client, err := sqirvy.NewClient(provider)
+	if err != nil {
+		return doctorCheck{name, checkFail, err.Error()}
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, doctorTimeout)
+	defer cancel()
+	start := time.Now()
+	_, err = client.QueryText(ctx, "", []string{"Reply with the word ok."}, model, sqirvy.Options{Temperature: 0, MaxTokens: 1})
+	if err != nil {
+		return doctorCheck{name, checkFail, fmt.Sprintf("%s: %v", model, err)}
+	}
+	return doctorCheck{name, checkPass, fmt.Sprintf("%s answered in %dms", model, time.Since(start).Milliseconds())}
+}
+
+// cheapestModel returns the registered model of the provider with the lowest input cost,
+// or "" if the provider has no registered models.
+func cheapestModel(provider string) string {
+	var models []string
+	for _, mp := range sqirvy.GetModelProviderList() {
+		if mp.Provider == provider {
+			models = append(models, mp.Model)
+		}
+	}
+	sort.Strings(models)
+
+	best := ""
+	bestCost := 0.0
+	for _, model := range models {
+		info, err := sqirvy.GetModelInfo(model)
+		if err != nil {
+			continue
+		}
+		if best == "" || info.InputCost < bestCost {
+			best, bestCost = model, info.InputCost
+		}
+	}
+	return best
+}
+
+// writeDoctorReport writes the checks as an aligned table.
+func writeDoctorReport(w io.Writer, checks []doctorCheck) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "CHECK\tSTATUS\tDETAIL")
+	for _, c := range checks {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", c.Name, c.Status, c.Detail)
+	}
+	return tw.Flush()
+}
+
+// init registers the doctor command with the root command.
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+}
@@ -0,0 +1,140 @@
+// Package cmd implements self-consistency sampling, where several completions
+// are generated for the same prompt and combined into one answer.
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	sqirvy "github.com/dmh2000/sqirvy-cli/pkg/sqirvy"
+)
+
+// Sample modes select how multiple completions are combined.
+const (
+	sampleModeAll   = "all"   // print every sample
+	sampleModeVote  = "vote"  // majority vote over JSON answers
+	sampleModeMerge = "merge" // ask the model to synthesize a final answer
+	sampleModeJSON  = "json"  // print the samples as a JSON array
+)
+
+// validSampleMode reports whether mode is a known sample mode.
+func validSampleMode(mode string) bool {
+	switch mode {
+	case sampleModeAll, sampleModeVote, sampleModeMerge, sampleModeJSON:
+		return true
+	}
+	return false
+}
+
+// querySamples generates n completions, in one request if the provider allows it,
+// and combines them according to mode.
+func querySamples(ctx context.Context, client sqirvy.Client, system string, prompts []string, model string, options sqirvy.Options, n int, mode string) (string, error) {
+	if !validSampleMode(mode) {
+		return "", fmt.Errorf("error: unknown sample mode %q (use all, vote, merge or json)", mode)
+	}
+
+	options = samplingOptions(options)
+
+	// the samples are generated in one request if the provider allows it
+	ok, _, err := sqirvy.QueryCompletions(sqirvy.WithoutMemo(ctx), client, system, prompts, model, options, n)
+	if err != nil {
+		return "", fmt.Errorf("error: querying model %s: all %d samples failed: %v", model, n, err)
+	}
+	if len(ok) < n {
+		slog.Warn("Samples failed", "failed", n-len(ok), "samples", n)
+	}
+	return combineSamples(ctx, client, prompts, model, options, ok, mode)
+}
+
+// samplingOptions returns the options of a query for samples: identical samples
+// are useless, so sampling requires some randomness.
+func samplingOptions(options sqirvy.Options) sqirvy.Options {
+	if options.Temperature == 0 {
+		options.Temperature = defaultTemperature
+		slog.Warn("Sampling requires a nonzero temperature, ignoring temperature 0", "temperature", defaultTemperature)
+	}
+	return options
+}
+
+// combineSamples combines the samples according to mode.
+func combineSamples(ctx context.Context, client sqirvy.Client, prompts []string, model string, options sqirvy.Options, ok []string, mode string) (string, error) {
+	switch mode {
+	case sampleModeVote:
+		return majorityVote(ok)
+	case sampleModeMerge:
+		return mergeSamples(ctx, client, prompts, model, options, ok)
+	case sampleModeJSON:
+		b, err := json.MarshalIndent(ok, "", "  ")
+		return string(b), err
+	default:
+		var b strings.Builder
+		for i, s := range ok {
+			if i > 0 {
+				b.WriteString("\n\n")
+			}
+			fmt.Fprintf(&b, "--- SAMPLE %d ---\n%s", i+1, s)
+		}
+		return b.String(), nil
+	}
+}
+
+// majorityVote decodes each sample as JSON and returns the most common answer.
+// Answers are compared after normalization, so key order and whitespace do not matter.
+// Ties go to the answer seen first.
+func majorityVote(samples []string) (string, error) {
+	counts := make(map[string]int)
+	var order []string
+	for i, s := range samples {
+		var v any
+		if err := json.Unmarshal([]byte(sqirvy.StripCodeFences(s)), &v); err != nil {
+			slog.Warn("Sample is not valid JSON, excluded from vote", "sample", i+1, "error", err)
+			continue
+		}
+		// encoding/json writes map keys in sorted order, giving a canonical form
+		b, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			continue
+		}
+		key := string(b)
+		if counts[key] == 0 {
+			order = append(order, key)
+		}
+		counts[key]++
+	}
+	if len(order) == 0 {
+		return "", fmt.Errorf("error: no sample contained a valid JSON answer to vote on")
+	}
+
+	best := order[0]
+	for _, key := range order[1:] {
+		if counts[key] > counts[best] {
+			best = key
+		}
+	}
+	slog.Info("Vote", "agree", counts[best], "samples", len(samples))
+	return best, nil
+}
+
+// mergeSamples asks the model to synthesize a final response from the samples.
+func mergeSamples(ctx context.Context, client sqirvy.Client, prompts []string, model string, options sqirvy.Options, samples []string) (string, error) {
+	var task strings.Builder
+	task.WriteString("--- START TASK ---\n")
+	task.WriteString(strings.Join(prompts, "\n\n"))
+	task.WriteString("\n--- END TASK ---")
+
+	mergePrompts := []string{task.String()}
+	for i, s := range samples {
+		mergePrompts = append(mergePrompts, fmt.Sprintf("--- START CANDIDATE %d ---\n%s\n--- END CANDIDATE %d ---", i+1, s, i+1))
+	}
+
+	// the merge pass should be deterministic
+	options.Temperature = 0
+	response, err := client.QueryText(ctx, mergePrompt, mergePrompts, model, options)
+	if err != nil {
+		return "", fmt.Errorf("error: merging samples with model %s: %v", model, err)
+	}
+	return response, nil
+}
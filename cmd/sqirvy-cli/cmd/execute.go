@@ -7,9 +7,14 @@ import (
 	"context"
 	_ "embed"
 	"fmt"
+	"log/slog"
 	"os"
+	"slices"
+	"strings"
 
-	sqirvy "dmh2000/sqirvy-cli/pkg/sqirvy"
+	sqirvy "github.com/dmh2000/sqirvy-cli/pkg/sqirvy"
+
+	"github.com/spf13/viper"
 )
 
 // executeQuery processes and executes an AI model query with the given system prompt and arguments.
@@ -24,38 +29,169 @@ import (
 //   - string: The model's response text
 //   - error: Any error encountered during execution
 func executeQuery(model string, temperature float64, system string, args []string) (string, error) {
-	// check if it has an alias
-	model = sqirvy.GetModelAlias(model)
+	// with --stdin-format json, stdin is a request with the options, files and
+	// conversation of the query
+	req, err := readStdinRequest()
+	if err != nil {
+		return "", err
+	}
+
+	// Layer the system prompt: the command prompt, the config file prompt, the
+	// library prompt selected by --prompt and --system, then the request's
+	system, err = commandSystemPrompt(system)
+	if err != nil {
+		return "", err
+	}
+	if req != nil {
+		model, temperature, system, args = req.apply(model, temperature, system, args)
+	}
+
+	// resolve aliases and unique prefixes
+	model = resolveModel(model)
+
+	// switch to the fallback model while the provider is failing
+	model = availableModel(model)
+
+	// Log the selected model
+	slog.Info("Using model", "model", model)
+
+	// Process system prompt and arguments into query prompts. A JSON request with
+	// a conversation or file contents needs no default prompt.
+	var prompts []string
+	if req == nil || len(args) > 0 || (len(req.Messages) == 0 && len(req.inlineFiles()) == 0) {
+		prompts, err = ReadPrompt(args)
+		if err != nil {
+			return "", fmt.Errorf("error: reading prompt: %v", err)
+		}
+	}
+	if req != nil {
+		prompts = append(prompts, req.inlineFiles()...)
+	}
+
+	// Ask before sending a large prompt
+	inputs := prompts
+	if req != nil {
+		for _, m := range req.Messages {
+			inputs = append(slices.Clip(inputs), m.Content)
+		}
+	}
+	if err := confirmLargePrompt(model, system, inputs); err != nil {
+		return "", err
+	}
+
+	// Configure query options and execute the query
+	maxTokens := int64(0)
+	if req != nil && req.Options.MaxTokens > 0 {
+		maxTokens = req.Options.MaxTokens
+	}
+	query := func(ctx context.Context, client sqirvy.Client, model string, options sqirvy.Options) (string, error) {
+		if req != nil && len(req.Messages) > 0 {
+			return req.query(ctx, client, system, prompts, model, options)
+		}
+
+		// with --samples, generate several completions and combine them
+		if samples := viper.GetInt("samples"); samples > 1 {
+			return querySamples(ctx, client, system, prompts, model, options, samples, viper.GetString("sample-mode"))
+		}
+
+		response, err := client.QueryText(ctx, system, prompts, model, options)
+		if err != nil {
+			return "", fmt.Errorf("error: querying model %s: %v", model, err)
+		}
+		return response, nil
+	}
+	ctx := context.Background()
 
-	// Print the selected model to stderr
-	fmt.Fprintln(os.Stderr, "Using model :", model)
+	// with --race, send the query to several models and use the first response
+	if models := raceModels(model, viper.GetStringSlice("race")); len(models) > 1 {
+		slog.Info("Racing models", "models", strings.Join(models, ","))
+		return queryRace(ctx, models, temperature, maxTokens, query)
+	}
 
-	// Process system prompt and arguments into query prompts
-	prompts, err := ReadPrompt(args)
+	// Create a client for the provider of the selected model
+	client, err := newClientForModel(model)
 	if err != nil {
-		return "", fmt.Errorf("error: reading prompt:[]string{\n%v", err)
+		return "", err
+	}
+	queryTemp, err := queryTemperature(temperature, model)
+	if err != nil {
+		return "", err
+	}
+	options := sqirvy.Options{Temperature: queryTemp, MaxTokens: commandMaxTokens(model), Stop: stopSequences(), Seed: querySeed(model), Prefill: queryPrefill(model)}
+	if maxTokens > 0 {
+		options.MaxTokens = maxTokens
+	}
+	return query(ctx, client, model, options)
+}
+
+// availableModel returns the model, or the circuit.fallback_model from the config
+// file if the circuit of the model's provider is open and the fallback model
+// belongs to a provider that is not failing.
+func availableModel(model string) string {
+	provider, err := sqirvy.GetProviderName(model)
+	if err != nil || !sqirvy.CircuitOpen(provider) {
+		return model
+	}
+	fallback := resolveModel(viper.GetString("circuit.fallback_model"))
+	if fallback == "" || fallback == model {
+		return model
+	}
+	fallbackProvider, err := sqirvy.GetProviderName(fallback)
+	if err != nil || sqirvy.CircuitOpen(fallbackProvider) {
+		return model
+	}
+	slog.Warn("Provider is unavailable, using the fallback model", "provider", provider, "model", fallback)
+	return fallback
+}
+
+// clients holds the provider clients of the process, so that commands sending
+// several queries, e.g. batch and watch, reuse one client per provider.
+// Execute closes it on shutdown.
+var clients = sqirvy.NewClientPool()
+
+// newClientForModel determines the AI provider for the model and returns its client
+// from the pool; callers must not close it.
+// The model name must already have any alias resolved.
+// A model that is not in the registry is passed through to the provider named by
+// the --provider flag, using the default token limits.
+func newClientForModel(model string) (sqirvy.Client, error) {
+	if model == "" {
+		return nil, errNoModel()
 	}
 
 	// Determine the AI provider based on the selected model
 	provider, err := sqirvy.GetProviderName(model)
 	if err != nil {
-		return "", fmt.Errorf("error: model is not supported %s: %v", model, err)
+		provider = viper.GetString("provider")
+		if sqirvy.IsLocalModel(model) {
+			// a GGUF model file is run in process by the local provider
+			if _, err := os.Stat(model); err != nil {
+				return nil, fmt.Errorf("error: model file %s: %v", model, err)
+			}
+			provider = sqirvy.Local
+		}
+		if provider == "" {
+			if suggestions := sqirvy.SuggestModels(model); len(suggestions) > 0 {
+				return nil, fmt.Errorf("error: model is not supported %s: did you mean %s?", model, strings.Join(suggestions, ", "))
+			}
+			return nil, fmt.Errorf("error: model is not supported %s: %v (use --provider to select a provider for unregistered models)", model, err)
+		}
+		// register the model so the provider client accepts it; its capabilities
+		// are unknown, so none are refused
+		info := sqirvy.ModelInfo{Provider: provider, Vision: true, Tools: true, JSON: true}
+		if err := sqirvy.RegisterModel(model, info); err != nil {
+			return nil, fmt.Errorf("error: model is not supported %s: %v", model, err)
+		}
+		slog.Info("Model is not registered", "model", model, "provider", provider)
 	}
 
 	// Create client for the provider
-	client, err := sqirvy.NewClient(provider)
-	if err != nil {
-		return "", fmt.Errorf("error: creating client for provider %s: %v", provider, err)
+	if err := loadAPIKey(provider); err != nil {
+		return nil, err
 	}
-	defer client.Close()
-
-	// Configure query options and execute the query
-	options := sqirvy.Options{Temperature: float32(temperature), MaxTokens: sqirvy.GetMaxTokens(model)}
-	ctx := context.Background()
-	response, err := client.QueryText(ctx, system, prompts, model, options)
+	client, err := clients.Get(provider)
 	if err != nil {
-		return "", fmt.Errorf("error: querying model %s: %v", model, err)
+		return nil, fmt.Errorf("error: creating client for provider %s: %v", provider, err)
 	}
-
-	return response, nil
+	return withQueryFilters(client)
 }
@@ -0,0 +1,322 @@
+/*
+Copyright © 2025 David Howard  dmh2000@gmail.com
+*/
+package cmd
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+
+	sqirvy "github.com/dmh2000/sqirvy-cli/pkg/sqirvy"
+	util "github.com/dmh2000/sqirvy-cli/pkg/util"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// extractToolName is the name of the tool the model calls to record extracted data.
+const extractToolName = "record_extraction"
+
+// defaultExtractRetries is the number of times an invalid extraction is retried.
+const defaultExtractRetries = 2
+
+// extractCmd represents the command to extract structured data from unstructured input.
+// The output either conforms to a user-supplied JSON Schema or is CSV with columns
+// inferred by the LLM. Responses that fail validation are sent back to the LLM with
+// the validation error so it can correct them.
+var extractCmd = &cobra.Command{
+	Use:   "extract",
+	Short: "Extract structured data (JSON or CSV) from the input",
+	Long: `sqirvy-cli extract will ask the LLM to extract structured records from the input
+and will output the results to stdout.
+With --schema, the output is JSON that conforms to the given JSON Schema file.
+With --csv, the output is CSV and the LLM chooses the columns.
+Responses that fail validation are retried with the validation error.
+With --samples N, N extractions are made and combined like the samples of a query,
+by --sample-mode; with --sample-mode vote the most common extraction wins. With
+--seed, each sample gets its own seed, counting up from the given one.
+The prompt is constructed in this order:
+	An internal system prompt for data extraction
+	Input from stdin
+	Any number of filename or url arguments
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		// get arg/config params
+		model := commandModel(cmd)
+		temperature := commandTemperature(cmd)
+		schemaFile, _ := cmd.Flags().GetString("schema")
+		csvMode, _ := cmd.Flags().GetBool("csv")
+		if !cmd.Flags().Changed("csv") {
+			// the format of the --prompt prompt chooses between csv and json
+			csvMode = selectedPromptSettings().Format == "csv"
+		}
+		retries, _ := cmd.Flags().GetInt("retries")
+
+		if schemaFile == "" && !csvMode {
+			log.Fatalf("Error executing extract command: one of --schema or --csv is required")
+		}
+		if schemaFile != "" && csvMode {
+			log.Fatalf("Error executing extract command: --schema and --csv cannot be used together")
+		}
+		if samples := viper.GetInt("samples"); samples > 1 {
+			mode := viper.GetString("sample-mode")
+			if !validSampleMode(mode) {
+				log.Fatalf("Error executing extract command: unknown sample mode %q (use all, vote, merge or json)", mode)
+			}
+			if csvMode && mode == sampleModeVote {
+				log.Fatalf("Error executing extract command: --sample-mode vote compares JSON extractions: use --schema instead of --csv")
+			}
+		}
+
+		response, err := executeExtract(model, temperature, schemaFile, csvMode, retries, args)
+		if err != nil {
+			log.Fatalf("Error executing extract command: %v", err)
+		}
+		// Print the extracted data to standard output
+		fmt.Print(response)
+		fmt.Println() // Ensure a newline at the end
+	},
+}
+
+// executeExtract runs the extraction, validating each response and retrying up to
+// retries times when the response does not validate.
+func executeExtract(model string, temperature float64, schemaFile string, csvMode bool, retries int, args []string) (string, error) {
+	// resolve aliases and unique prefixes
+	model = resolveModel(model)
+
+	// switch to the fallback model while the provider is failing
+	model = availableModel(model)
+
+	// Log the selected model
+	slog.Info("Using model", "model", model)
+
+	// JSON records are returned through a tool call
+	if !csvMode {
+		if err := sqirvy.CheckCapability(model, sqirvy.CapabilityTools); err != nil {
+			return "", fmt.Errorf("error: %v (or use --csv)", err)
+		}
+	}
+
+	var schema map[string]any
+	if schemaFile != "" {
+		data, _, err := util.ReadFile(schemaFile, MaxInputTotalBytes)
+		if err != nil {
+			return "", fmt.Errorf("error: reading schema: %w", err)
+		}
+		schema, err = sqirvy.ParseSchema(data)
+		if err != nil {
+			return "", fmt.Errorf("error: %w", err)
+		}
+	}
+
+	prompts, err := ReadPrompt(args)
+	if err != nil {
+		return "", fmt.Errorf("error: reading prompt: %v", err)
+	}
+	if err := confirmLargePrompt(model, extractPrompt, prompts); err != nil {
+		return "", err
+	}
+
+	client, err := newClientForModel(model)
+	if err != nil {
+		return "", err
+	}
+
+	queryTemp, err := queryTemperature(temperature, model)
+	if err != nil {
+		return "", err
+	}
+	options := sqirvy.Options{Temperature: queryTemp, MaxTokens: commandMaxTokens(model)}
+	ctx := context.Background()
+
+	// add the library prompt selected by --prompt
+	system, err := commandSystemPrompt(extractPrompt)
+	if err != nil {
+		return "", err
+	}
+
+	// with --samples, make several extractions and combine them
+	if samples := viper.GetInt("samples"); samples > 1 {
+		return extractSamples(ctx, client, system, model, options, prompts, schema, csvMode, retries, samples, viper.GetString("sample-mode"))
+	}
+	return extractWithRetries(ctx, client, system, model, options, prompts, schema, csvMode, retries)
+}
+
+// extractWithRetries runs one extraction, retrying up to retries times with the
+// validation error when the response does not validate.
+func extractWithRetries(ctx context.Context, client sqirvy.Client, system string, model string, options sqirvy.Options, prompts []string, schema map[string]any, csvMode bool, retries int) (string, error) {
+	// the retries append to the prompts, which may be shared with other samples
+	prompts = slices.Clip(prompts)
+	var lastErr error
+	for attempt := 0; attempt <= retries; attempt++ {
+		var result string
+		if csvMode {
+			result, lastErr = extractCSV(ctx, client, system, model, options, prompts)
+		} else {
+			result, lastErr = extractJSON(ctx, client, system, model, options, prompts, schema)
+		}
+		if lastErr == nil {
+			return result, nil
+		}
+		slog.Warn("Extraction attempt failed", "attempt", attempt+1, "error", lastErr)
+
+		// tell the model what was wrong so the next attempt can correct it
+		prompts = append(prompts, fmt.Sprintf("The previous extraction was rejected: %v. Extract the data again and make sure the output is valid.", lastErr))
+	}
+	return "", fmt.Errorf("error: extraction failed after %d attempts: %w", retries+1, lastErr)
+}
+
+// extractSamples runs n extractions concurrently, each with its own retries, and
+// combines the valid ones according to mode, like the samples of a query. With a
+// seed, sample i is sampled with the seed plus i, so the samples differ.
+func extractSamples(ctx context.Context, client sqirvy.Client, system string, model string, options sqirvy.Options, prompts []string, schema map[string]any, csvMode bool, retries int, n int, mode string) (string, error) {
+	options = samplingOptions(options)
+	// the requests of the samples are identical and must all be sent
+	ctx = sqirvy.WithoutMemo(ctx)
+
+	results := make([]string, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sampleOptions := options
+			if options.Seed != nil {
+				seed := *options.Seed + int64(i)
+				sampleOptions.Seed = &seed
+			}
+			results[i], errs[i] = extractWithRetries(ctx, client, system, model, sampleOptions, prompts, schema, csvMode, retries)
+		}()
+	}
+	wg.Wait()
+
+	var ok []string
+	for i := range n {
+		if errs[i] != nil {
+			slog.Warn("Extraction sample failed", "sample", i+1, "error", errs[i])
+			continue
+		}
+		ok = append(ok, results[i])
+	}
+	if len(ok) == 0 {
+		return "", fmt.Errorf("error: all %d extraction samples failed: %w", n, errors.Join(errs...))
+	}
+	return combineSamples(ctx, client, prompts, model, options, ok, mode)
+}
+
+// extractJSON asks the model to record the data through a tool whose parameters are
+// the user's schema, then validates the result against the schema.
+func extractJSON(ctx context.Context, client sqirvy.Client, base string, model string, options sqirvy.Options, prompts []string, schema map[string]any) (string, error) {
+	// providers require the tool parameters to be an object, so the user's
+	// schema is wrapped in a single "data" property
+	tool := sqirvy.Tool{
+		Name:        extractToolName,
+		Description: "Record the data extracted from the input.",
+		Parameters: map[string]any{
+			"type":       "object",
+			"properties": map[string]any{"data": schema},
+			"required":   []string{"data"},
+		},
+	}
+
+	system := base + "\n\nThe extracted data must conform to this JSON Schema:\n" + schemaString(schema)
+	resp, err := client.QueryWithTools(ctx, system, prompts, model, options, []sqirvy.Tool{tool})
+	if err != nil {
+		return "", fmt.Errorf("querying model %s: %w", model, err)
+	}
+
+	var data any
+	if call := findToolCall(resp.ToolCalls, extractToolName); call != nil {
+		var args map[string]any
+		if err := json.Unmarshal([]byte(call.Arguments), &args); err != nil {
+			return "", fmt.Errorf("tool arguments are not valid JSON: %v", err)
+		}
+		data = args["data"]
+	} else {
+		// some models answer in text even when a tool is offered
+		if err := json.Unmarshal([]byte(sqirvy.StripCodeFences(resp.Text)), &data); err != nil {
+			return "", fmt.Errorf("response is not valid JSON: %v", err)
+		}
+	}
+
+	if err := sqirvy.ValidateJSON(schema, data); err != nil {
+		return "", fmt.Errorf("response does not match schema: %v", err)
+	}
+
+	out, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// extractCSV asks the model for CSV output and checks that it parses with a
+// consistent number of columns.
+func extractCSV(ctx context.Context, client sqirvy.Client, base string, model string, options sqirvy.Options, prompts []string) (string, error) {
+	system := base + "\n\nOutput the extracted records as CSV. The first row must be a header row naming the columns you chose. Quote fields that contain commas, quotes or newlines."
+	resp, err := client.QueryText(ctx, system, prompts, model, options)
+	if err != nil {
+		return "", fmt.Errorf("querying model %s: %w", model, err)
+	}
+
+	text := sqirvy.StripCodeFences(resp)
+	records, err := csv.NewReader(strings.NewReader(text)).ReadAll()
+	if err != nil {
+		return "", fmt.Errorf("response is not valid CSV: %v", err)
+	}
+	if len(records) < 2 {
+		return "", fmt.Errorf("response must contain a header row and at least one record")
+	}
+
+	var out strings.Builder
+	w := csv.NewWriter(&out)
+	if err := w.WriteAll(records); err != nil {
+		return "", err
+	}
+	return strings.TrimRight(out.String(), "\n"), nil
+}
+
+// findToolCall returns the first call to the named tool, or nil.
+func findToolCall(calls []sqirvy.ToolCall, name string) *sqirvy.ToolCall {
+	for i := range calls {
+		if calls[i].Name == name {
+			return &calls[i]
+		}
+	}
+	return nil
+}
+
+// schemaString renders a schema for inclusion in a prompt.
+func schemaString(schema map[string]any) string {
+	b, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+// extractUsage prints the usage instructions for the extract command.
+func extractUsage(cmd *cobra.Command) error {
+	fmt.Println("Usage: stdin | sqirvy-cli extract [--schema schema.json | --csv] [flags] [files| urls]")
+	fmt.Println("\nFlags:")
+	cmd.Flags().PrintDefaults()
+	return nil
+}
+
+// init registers the extract command with the root command and sets its custom usage function.
+func init() {
+	extractCmd.Flags().String("schema", "", "JSON Schema file the extracted data must conform to")
+	extractCmd.Flags().Bool("csv", false, "Output CSV with columns inferred by the LLM")
+	extractCmd.Flags().Int("retries", defaultExtractRetries, "Number of retries when the response fails validation")
+	rootCmd.AddCommand(extractCmd)
+	extractCmd.SetUsageFunc(extractUsage)
+}
@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	sqirvy "github.com/dmh2000/sqirvy-cli/pkg/sqirvy"
+)
+
+func TestExtractSamplesVote(t *testing.T) {
+	defer sqirvy.SetMockResponse("")
+	// each sample has its own seed: the first extraction is outvoted, and the
+	// third does not validate and has no vote
+	err := sqirvy.SetMockResponse(`{"data": {{if eq .Seed 7}}{"name": "bob"}{{else if eq .Seed 9}}{"name": 5}{{else}}{"name": "ada"}{{end}}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, _ := sqirvy.NewMockClient()
+	schema := map[string]any{
+		"type":       "object",
+		"properties": map[string]any{"name": map[string]any{"type": "string"}},
+		"required":   []any{"name"},
+	}
+	seed := int64(7)
+	options := sqirvy.Options{Temperature: 0.5, Seed: &seed}
+
+	tests := []struct {
+		name string
+		mode string
+		want any
+	}{
+		{"vote", sampleModeVote, map[string]any{"name": "ada"}},
+		{"json", sampleModeJSON, []any{`{
+  "name": "bob"
+}`, `{
+  "name": "ada"
+}`, `{
+  "name": "ada"
+}`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := extractSamples(context.Background(), client, "extract", "mock", options, []string{"ada and bob"}, schema, false, 0, 4, tt.mode)
+			if err != nil {
+				t.Fatalf("extractSamples() error = %v", err)
+			}
+			var data any
+			if err := json.Unmarshal([]byte(got), &data); err != nil {
+				t.Fatalf("extractSamples() = %q, not JSON: %v", got, err)
+			}
+			if gotJSON, wantJSON := mustJSON(t, data), mustJSON(t, tt.want); gotJSON != wantJSON {
+				t.Errorf("extractSamples() = %s, want %s", gotJSON, wantJSON)
+			}
+		})
+	}
+
+	// without a valid extraction there is nothing to vote on
+	if err := sqirvy.SetMockResponse(`{"data": {"name": 5}}`); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := extractSamples(context.Background(), client, "extract", "mock", options, []string{"x"}, schema, false, 0, 3, sampleModeVote); err == nil {
+		t.Errorf("extractSamples() of invalid extractions = %q, want an error", got)
+	}
+}
+
+func mustJSON(t *testing.T, v any) string {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
@@ -0,0 +1,218 @@
+// Package cmd implements the structured findings of the review command. With
+// --format sarif the model returns each problem as a finding with a file, line,
+// severity and rule instead of a markdown review, and the findings are checked
+// and normalized before they are printed.
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strings"
+
+	sqirvy "github.com/dmh2000/sqirvy-cli/pkg/sqirvy"
+)
+
+// defaultReviewRetries is the number of times findings that fail validation are retried.
+const defaultReviewRetries = 2
+
+// Severities of review findings, most severe first.
+const (
+	severityCritical = "critical"
+	severityHigh     = "high"
+	severityMedium   = "medium"
+	severityLow      = "low"
+)
+
+// severityAliases maps the severity names models use instead of the review
+// severities, e.g. SARIF levels, to the review severity.
+var severityAliases = map[string]string{
+	severityCritical: severityCritical,
+	"blocker":        severityCritical,
+	severityHigh:     severityHigh,
+	"major":          severityHigh,
+	"error":          severityHigh,
+	severityMedium:   severityMedium,
+	"moderate":       severityMedium,
+	"warning":        severityMedium,
+	severityLow:      severityLow,
+	"minor":          severityLow,
+	"note":           severityLow,
+	"info":           severityLow,
+}
+
+// reviewFinding is one problem found by a review.
+type reviewFinding struct {
+	File     string `json:"file" description:"path of the file from its START FILE marker, empty for stdin or urls"`
+	Line     int    `json:"line" description:"1-based line where the problem starts"`
+	EndLine  int    `json:"end_line,omitempty" description:"1-based line where the problem ends"`
+	Severity string `json:"severity" description:"critical, high, medium or low"`
+	Category string `json:"category" description:"bugs, security, performance or style"`
+	Rule     string `json:"rule" description:"short lowercase identifier of the kind of problem, e.g. sql-injection"`
+	Message  string `json:"message" description:"description of the problem and how to fix it"`
+}
+
+// reviewFindings is the structured result of a review.
+type reviewFindings struct {
+	Findings []reviewFinding `json:"findings"`
+	Summary  string          `json:"summary"`
+}
+
+// reviewOutput is the JSON document printed by review --format json.
+type reviewOutput struct {
+	Summary  string          `json:"summary"`
+	Counts   findingCounts   `json:"counts"`
+	Findings []reviewFinding `json:"findings"`
+}
+
+// findingCounts is the number of findings of a review by severity, and whether
+// the review fails the --fail-on threshold.
+type findingCounts struct {
+	Total    int    `json:"total"`
+	Critical int    `json:"critical"`
+	High     int    `json:"high"`
+	Medium   int    `json:"medium"`
+	Low      int    `json:"low"`
+	FailOn   string `json:"fail_on,omitempty"`
+	Failed   bool   `json:"failed"`
+}
+
+// failOnSeverities maps the values of --fail-on to the least severe severity
+// that fails the review.
+var failOnSeverities = map[string]string{
+	severityCritical: severityCritical,
+	severityHigh:     severityHigh,
+	severityMedium:   severityMedium,
+	"any":            severityLow,
+}
+
+// countFindings counts the normalized findings by severity. The counts are
+// failed if failOn is set and a finding is at or above its severity.
+func countFindings(findings []reviewFinding, failOn string) findingCounts {
+	counts := findingCounts{Total: len(findings), FailOn: failOn}
+	threshold, gated := failOnSeverities[failOn]
+	for _, f := range findings {
+		switch f.Severity {
+		case severityCritical:
+			counts.Critical++
+		case severityHigh:
+			counts.High++
+		case severityMedium:
+			counts.Medium++
+		default:
+			counts.Low++
+		}
+		if gated && severityRank(f.Severity) <= severityRank(threshold) {
+			counts.Failed = true
+		}
+	}
+	return counts
+}
+
+// executeReviewFindings asks the model to review the input and return structured
+// findings, then normalizes them.
+func executeReviewFindings(model string, temperature float64, system string, args []string) (reviewFindings, error) {
+	// resolve aliases and unique prefixes
+	model = resolveModel(model)
+
+	// switch to the fallback model while the provider is failing
+	model = availableModel(model)
+
+	// Log the selected model
+	slog.Info("Using model", "model", model)
+
+	// the findings are returned through a tool call
+	if err := sqirvy.CheckCapability(model, sqirvy.CapabilityTools); err != nil {
+		return reviewFindings{}, fmt.Errorf("error: %v (or use --format markdown)", err)
+	}
+
+	// add the library prompt selected by --prompt
+	system, err := commandSystemPrompt(system)
+	if err != nil {
+		return reviewFindings{}, err
+	}
+
+	prompts, err := ReadPrompt(args)
+	if err != nil {
+		return reviewFindings{}, fmt.Errorf("error: reading prompt: %v", err)
+	}
+	if err := confirmLargePrompt(model, system, prompts); err != nil {
+		return reviewFindings{}, err
+	}
+
+	client, err := newClientForModel(model)
+	if err != nil {
+		return reviewFindings{}, err
+	}
+
+	queryTemp, err := queryTemperature(temperature, model)
+	if err != nil {
+		return reviewFindings{}, err
+	}
+	options := sqirvy.Options{Temperature: queryTemp, MaxTokens: commandMaxTokens(model)}
+
+	review, _, err := sqirvy.QueryInto[reviewFindings](context.Background(), client, system, prompts, model, options, defaultReviewRetries)
+	if err != nil {
+		return reviewFindings{}, fmt.Errorf("error: querying model %s: %v", model, err)
+	}
+	review.Findings = normalizeFindings(review.Findings, args)
+	return review, nil
+}
+
+// normalizeFindings maps the severities of the findings to the review severities
+// and cleans up their files, lines and rules, so that every finding can be
+// reported. Findings without a message are dropped. Files that are not among the
+// arguments are kept but logged, since the model may have made them up.
+func normalizeFindings(findings []reviewFinding, args []string) []reviewFinding {
+	inputs := make(map[string]bool, len(args))
+	for _, arg := range args {
+		inputs[filepath.ToSlash(filepath.Clean(arg))] = true
+	}
+
+	normalized := make([]reviewFinding, 0, len(findings))
+	for _, f := range findings {
+		f.Message = strings.TrimSpace(f.Message)
+		if f.Message == "" {
+			slog.Warn("Dropping review finding without a message", "file", f.File, "line", f.Line)
+			continue
+		}
+
+		severity, ok := severityAliases[strings.ToLower(strings.TrimSpace(f.Severity))]
+		if !ok {
+			slog.Warn("Unknown severity of review finding, using medium", "severity", f.Severity, "file", f.File, "line", f.Line)
+			severity = severityMedium
+		}
+		f.Severity = severity
+
+		f.Category = strings.ToLower(strings.TrimSpace(f.Category))
+		f.Rule = normalizeRuleID(f.Rule)
+		if f.Rule == "" {
+			f.Rule = f.Category
+		}
+		if f.Rule == "" {
+			f.Rule = "general"
+		}
+
+		if f.File = strings.TrimSpace(f.File); f.File != "" {
+			f.File = filepath.ToSlash(filepath.Clean(f.File))
+			if len(inputs) > 0 && !inputs[f.File] {
+				slog.Warn("Review finding refers to a file that is not an input", "file", f.File)
+			}
+		}
+		if f.Line < 1 {
+			f.Line = 1
+		}
+		if f.EndLine < f.Line {
+			f.EndLine = 0
+		}
+		normalized = append(normalized, f)
+	}
+	return normalized
+}
+
+// normalizeRuleID returns a rule ID in lowercase with words joined by dashes,
+// e.g. "SQL Injection" becomes sql-injection.
+func normalizeRuleID(rule string) string {
+	return strings.Join(strings.Fields(strings.ToLower(rule)), "-")
+}
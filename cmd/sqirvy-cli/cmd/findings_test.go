@@ -0,0 +1,169 @@
+package cmd
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeFindings(t *testing.T) {
+	tests := []struct {
+		name string
+		json string // the findings as the model returns them
+		args []string
+		want []reviewFinding
+	}{
+		{
+			name: "clean finding",
+			json: `{"findings": [{"file": "main.go", "line": 4, "end_line": 6, "severity": "high", "category": "bugs", "rule": "nil-deref", "message": "x may be nil"}], "summary": "one bug"}`,
+			args: []string{"main.go"},
+			want: []reviewFinding{{File: "main.go", Line: 4, EndLine: 6, Severity: severityHigh, Category: "bugs", Rule: "nil-deref", Message: "x may be nil"}},
+		},
+		{
+			name: "severity aliases",
+			json: `{"findings": [
+				{"file": "a.go", "line": 1, "severity": "Blocker", "rule": "r", "message": "m"},
+				{"file": "a.go", "line": 1, "severity": " error ", "rule": "r", "message": "m"},
+				{"file": "a.go", "line": 1, "severity": "warning", "rule": "r", "message": "m"},
+				{"file": "a.go", "line": 1, "severity": "note", "rule": "r", "message": "m"},
+				{"file": "a.go", "line": 1, "severity": "whatever", "rule": "r", "message": "m"}
+			]}`,
+			want: []reviewFinding{
+				{File: "a.go", Line: 1, Severity: severityCritical, Rule: "r", Message: "m"},
+				{File: "a.go", Line: 1, Severity: severityHigh, Rule: "r", Message: "m"},
+				{File: "a.go", Line: 1, Severity: severityMedium, Rule: "r", Message: "m"},
+				{File: "a.go", Line: 1, Severity: severityLow, Rule: "r", Message: "m"},
+				{File: "a.go", Line: 1, Severity: severityMedium, Rule: "r", Message: "m"},
+			},
+		},
+		{
+			name: "rule from the rule, the category or general",
+			json: `{"findings": [
+				{"file": "a.go", "line": 1, "severity": "low", "category": "Security", "rule": "SQL  Injection", "message": "m"},
+				{"file": "a.go", "line": 1, "severity": "low", "category": "Performance", "message": "m"},
+				{"file": "a.go", "line": 1, "severity": "low", "message": "m"}
+			]}`,
+			want: []reviewFinding{
+				{File: "a.go", Line: 1, Severity: severityLow, Category: "security", Rule: "sql-injection", Message: "m"},
+				{File: "a.go", Line: 1, Severity: severityLow, Category: "performance", Rule: "performance", Message: "m"},
+				{File: "a.go", Line: 1, Severity: severityLow, Rule: "general", Message: "m"},
+			},
+		},
+		{
+			name: "files and lines cleaned up",
+			json: `{"findings": [
+				{"file": " ./src/../src/a.go ", "line": 0, "end_line": 3, "severity": "low", "rule": "r", "message": "m"},
+				{"file": "b.go", "line": 9, "end_line": 2, "severity": "low", "rule": "r", "message": "m"},
+				{"file": "", "line": -4, "severity": "low", "rule": "r", "message": "m"}
+			]}`,
+			want: []reviewFinding{
+				{File: "src/a.go", Line: 1, EndLine: 3, Severity: severityLow, Rule: "r", Message: "m"},
+				{File: "b.go", Line: 9, Severity: severityLow, Rule: "r", Message: "m"},
+				{Line: 1, Severity: severityLow, Rule: "r", Message: "m"},
+			},
+		},
+		{
+			name: "findings without a message dropped",
+			json: `{"findings": [
+				{"file": "a.go", "line": 1, "severity": "high", "rule": "r", "message": "  "},
+				{"file": "a.go", "line": 2, "severity": "high", "rule": "r", "message": " kept "}
+			]}`,
+			want: []reviewFinding{{File: "a.go", Line: 2, Severity: severityHigh, Rule: "r", Message: "kept"}},
+		},
+		{
+			name: "no findings",
+			json: `{"findings": [], "summary": "looks good"}`,
+			want: []reviewFinding{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var review reviewFindings
+			if err := json.Unmarshal([]byte(tt.json), &review); err != nil {
+				t.Fatalf("invalid findings: %v", err)
+			}
+			if got := normalizeFindings(review.Findings, tt.args); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("normalizeFindings() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCountFindings(t *testing.T) {
+	findings := func(severities ...string) []reviewFinding {
+		var f []reviewFinding
+		for _, s := range severities {
+			f = append(f, reviewFinding{Severity: s, Rule: "r", Message: "m"})
+		}
+		return f
+	}
+
+	tests := []struct {
+		name     string
+		findings []reviewFinding
+		failOn   string
+		want     findingCounts
+	}{
+		{
+			name:     "no threshold",
+			findings: findings(severityCritical, severityLow),
+			want:     findingCounts{Total: 2, Critical: 1, Low: 1},
+		},
+		{
+			name:     "critical fails critical",
+			findings: findings(severityCritical),
+			failOn:   "critical",
+			want:     findingCounts{Total: 1, Critical: 1, FailOn: "critical", Failed: true},
+		},
+		{
+			name:     "high passes critical",
+			findings: findings(severityHigh, severityMedium),
+			failOn:   "critical",
+			want:     findingCounts{Total: 2, High: 1, Medium: 1, FailOn: "critical"},
+		},
+		{
+			name:     "high fails high",
+			findings: findings(severityLow, severityHigh),
+			failOn:   "high",
+			want:     findingCounts{Total: 2, High: 1, Low: 1, FailOn: "high", Failed: true},
+		},
+		{
+			name:     "medium passes high",
+			findings: findings(severityMedium, severityLow),
+			failOn:   "high",
+			want:     findingCounts{Total: 2, Medium: 1, Low: 1, FailOn: "high"},
+		},
+		{
+			name:     "medium fails medium",
+			findings: findings(severityMedium),
+			failOn:   "medium",
+			want:     findingCounts{Total: 1, Medium: 1, FailOn: "medium", Failed: true},
+		},
+		{
+			name:     "low passes medium",
+			findings: findings(severityLow, severityLow),
+			failOn:   "medium",
+			want:     findingCounts{Total: 2, Low: 2, FailOn: "medium"},
+		},
+		{
+			name:     "low fails any",
+			findings: findings(severityLow),
+			failOn:   "any",
+			want:     findingCounts{Total: 1, Low: 1, FailOn: "any", Failed: true},
+		},
+		{
+			name:   "no findings pass any",
+			failOn: "any",
+			want:   findingCounts{FailOn: "any"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := countFindings(tt.findings, tt.failOn); got != tt.want {
+				t.Errorf("countFindings() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,222 @@
+// Package cmd implements the gen-man command, which writes a man page in section
+// 1 for sqirvy-cli and each of its commands, e.g. sqirvy-cli-query.1, from the
+// descriptions and flags of the commands, for packagers and for man sqirvy-cli.
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// genManCmd writes the man pages of the commands.
+var genManCmd = &cobra.Command{
+	Use:   "gen-man",
+	Short: "Write the man pages of sqirvy-cli and its commands",
+	Long: `sqirvy-cli gen-man writes a man page for sqirvy-cli and each of its commands,
+e.g. sqirvy-cli-query.1, to the directory of --dir, and prints their paths. Copy
+them to a directory in MANPATH, e.g.
+	sqirvy-cli gen-man --dir ~/.local/share/man/man1
+	man sqirvy-cli-query
+The date of the pages is the build date of the binary, or $SOURCE_DATE_EPOCH,
+so that packaged pages are reproducible.`,
+	Args:              cobra.NoArgs,
+	ValidArgsFunction: cobra.NoFileCompletions,
+	Run: func(cmd *cobra.Command, args []string) {
+		dir, _ := cmd.Flags().GetString("dir")
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			log.Fatalf("Error executing gen-man command: %v", err)
+		}
+		header := manHeader{Date: manDate(), Source: "sqirvy-cli " + buildVersion().Version}
+		for _, c := range manCommands(rootCmd) {
+			path := filepath.Join(dir, manName(c)+".1")
+			if err := os.WriteFile(path, genManPage(c, header), 0o644); err != nil {
+				log.Fatalf("Error executing gen-man command: %v", err)
+			}
+			fmt.Println(path)
+		}
+	},
+}
+
+// manHeader is the date and source of the title line of the man pages.
+type manHeader struct {
+	Date   string
+	Source string
+}
+
+// manDate returns the date of the man pages: the date of $SOURCE_DATE_EPOCH, the
+// build date of the binary or today.
+func manDate() string {
+	if epoch := os.Getenv("SOURCE_DATE_EPOCH"); epoch != "" {
+		var secs int64
+		if _, err := fmt.Sscan(epoch, &secs); err == nil {
+			return time.Unix(secs, 0).UTC().Format(time.DateOnly)
+		}
+	}
+	if date := buildVersion().BuildDate; len(date) >= len(time.DateOnly) {
+		return date[:len(time.DateOnly)]
+	}
+	return time.Now().Format(time.DateOnly)
+}
+
+// manCommands returns the command and the commands below it that get a man page,
+// leaving out hidden commands and help.
+func manCommands(c *cobra.Command) []*cobra.Command {
+	commands := []*cobra.Command{c}
+	for _, sub := range c.Commands() {
+		if !sub.IsAvailableCommand() || sub.IsAdditionalHelpTopicCommand() {
+			continue
+		}
+		commands = append(commands, manCommands(sub)...)
+	}
+	return commands
+}
+
+// manName returns the name of the man page of a command, e.g. sqirvy-cli-models-resolve.
+func manName(c *cobra.Command) string {
+	return strings.ReplaceAll(c.CommandPath(), " ", "-")
+}
+
+// genManPage returns the man page of a command in roff.
+func genManPage(c *cobra.Command, header manHeader) []byte {
+	var b bytes.Buffer
+	name := manName(c)
+	fmt.Fprintf(&b, ".TH %q 1 %q %q \"sqirvy-cli Manual\"\n", strings.ToUpper(name), header.Date, header.Source)
+
+	b.WriteString(".SH NAME\n")
+	fmt.Fprintf(&b, "%s \\- %s\n", manEscape(name), manEscape(c.Short))
+
+	b.WriteString(".SH SYNOPSIS\n")
+	fmt.Fprintf(&b, ".B %s\n", manEscape(c.UseLine()))
+	if c.HasAvailableSubCommands() {
+		fmt.Fprintf(&b, ".br\n.B %s\n", manEscape(c.CommandPath()+" [command]"))
+	}
+
+	b.WriteString(".SH DESCRIPTION\n")
+	description := c.Long
+	if description == "" {
+		description = c.Short
+	}
+	writeManText(&b, description)
+
+	if c.Example != "" {
+		b.WriteString(".SH EXAMPLES\n.PP\n.nf\n")
+		for _, line := range strings.Split(strings.TrimSpace(c.Example), "\n") {
+			b.WriteString(manLine(line) + "\n")
+		}
+		b.WriteString(".fi\n")
+	}
+
+	writeManFlags(&b, "OPTIONS", c.NonInheritedFlags())
+	writeManFlags(&b, "OPTIONS INHERITED FROM PARENT COMMANDS", c.InheritedFlags())
+
+	var seeAlso []string
+	if c.HasParent() {
+		seeAlso = append(seeAlso, manName(c.Parent()))
+	}
+	for _, sub := range c.Commands() {
+		if sub.IsAvailableCommand() && !sub.IsAdditionalHelpTopicCommand() {
+			seeAlso = append(seeAlso, manName(sub))
+		}
+	}
+	if len(seeAlso) > 0 {
+		b.WriteString(".SH SEE ALSO\n")
+		for i, see := range seeAlso {
+			sep := ","
+			if i == len(seeAlso)-1 {
+				sep = ""
+			}
+			fmt.Fprintf(&b, ".BR %s (1)%s\n", manEscape(see), sep)
+		}
+	}
+	return b.Bytes()
+}
+
+// writeManText writes text as paragraphs. Paragraphs with indented lines, such as
+// the lists of subcommands, keep their line breaks; the others are filled.
+func writeManText(b *bytes.Buffer, text string) {
+	for _, para := range strings.Split(strings.TrimSpace(text), "\n\n") {
+		lines := strings.Split(para, "\n")
+		indented := false
+		for _, line := range lines {
+			if strings.HasPrefix(line, "\t") || strings.HasPrefix(line, "  ") {
+				indented = true
+			}
+		}
+		b.WriteString(".PP\n")
+		if indented {
+			b.WriteString(".nf\n")
+		}
+		for _, line := range lines {
+			b.WriteString(manLine(strings.ReplaceAll(line, "\t", "    ")) + "\n")
+		}
+		if indented {
+			b.WriteString(".fi\n")
+		}
+	}
+}
+
+// writeManFlags writes the flags that are not hidden as a section of the man page.
+func writeManFlags(b *bytes.Buffer, title string, flags *pflag.FlagSet) {
+	if !flags.HasAvailableFlags() {
+		return
+	}
+	fmt.Fprintf(b, ".SH %s\n", title)
+	flags.VisitAll(func(f *pflag.Flag) {
+		if f.Hidden {
+			return
+		}
+		varname, usage := pflag.UnquoteUsage(f)
+		b.WriteString(".TP\n")
+		if f.Shorthand != "" && f.ShorthandDeprecated == "" {
+			fmt.Fprintf(b, "\\fB\\-%s\\fP, ", manEscape(f.Shorthand))
+		}
+		fmt.Fprintf(b, "\\fB\\-\\-%s\\fP", manEscape(f.Name))
+		if varname != "" {
+			fmt.Fprintf(b, " \\fI%s\\fP", manEscape(varname))
+		}
+		b.WriteString("\n")
+		if f.DefValue != "" && f.DefValue != "false" && f.DefValue != "0" && f.DefValue != "[]" {
+			usage += fmt.Sprintf(" (default %s)", f.DefValue)
+		}
+		b.WriteString(manLine(usage) + "\n")
+	})
+}
+
+// manLine escapes a line of text, including a leading . or ', which roff would
+// read as a request.
+func manLine(line string) string {
+	line = manEscape(line)
+	if strings.HasPrefix(line, ".") || strings.HasPrefix(line, "'") {
+		line = "\\&" + line
+	}
+	return line
+}
+
+// manEscape escapes the backslashes and hyphens of text for roff.
+func manEscape(text string) string {
+	return strings.NewReplacer(`\`, `\e`, "-", `\-`).Replace(text)
+}
+
+// genManUsage prints the usage instructions for the gen-man command.
+func genManUsage(cmd *cobra.Command) error {
+	fmt.Println("Usage: sqirvy-cli gen-man [--dir directory]")
+	fmt.Println("\nFlags:")
+	cmd.Flags().PrintDefaults()
+	return nil
+}
+
+// init registers the gen-man command with the root command.
+func init() {
+	genManCmd.Flags().String("dir", "man", "Directory to write the man pages to")
+	genManCmd.MarkFlagDirname("dir")
+	rootCmd.AddCommand(genManCmd)
+	genManCmd.SetUsageFunc(genManUsage)
+}
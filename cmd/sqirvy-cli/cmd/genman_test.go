@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestGenManCommand(t *testing.T) {
+	t.Setenv("SOURCE_DATE_EPOCH", "1700000000")
+	dir := filepath.Join(t.TempDir(), "man")
+	if err := genManCmd.Flags().Set("dir", dir); err != nil {
+		t.Fatal(err)
+	}
+	defer genManCmd.Flags().Set("dir", "man")
+
+	// the paths of the pages are printed to stdout
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer devNull.Close()
+	stdout := os.Stdout
+	os.Stdout = devNull
+	genManCmd.Run(genManCmd, nil)
+	os.Stdout = stdout
+
+	commands := manCommands(rootCmd)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != len(commands) {
+		t.Errorf("gen-man wrote %d pages, want one for each of the %d commands", len(entries), len(commands))
+	}
+	for _, c := range commands {
+		page, err := os.ReadFile(filepath.Join(dir, manName(c)+".1"))
+		if err != nil {
+			t.Errorf("no man page for %s: %v", c.CommandPath(), err)
+			continue
+		}
+		title := `.TH "` + strings.ToUpper(manName(c)) + `" 1 "2023-11-14" "sqirvy-cli `
+		if !strings.HasPrefix(string(page), title) {
+			t.Errorf("man page of %s starts with %q, want %q", c.CommandPath(), strings.SplitN(string(page), "\n", 2)[0], title)
+		}
+		for _, section := range []string{".SH NAME\n", ".SH SYNOPSIS\n", ".SH DESCRIPTION\n"} {
+			if !strings.Contains(string(page), section) {
+				t.Errorf("man page of %s has no %s", c.CommandPath(), strings.TrimSpace(section))
+			}
+		}
+	}
+	for _, hidden := range []string{"sqirvy-cli-help.1", "sqirvy-cli-__complete.1"} {
+		if _, err := os.Stat(filepath.Join(dir, hidden)); err == nil {
+			t.Errorf("man page %s written for a hidden command", hidden)
+		}
+	}
+}
+
+func TestGenManPage(t *testing.T) {
+	root := &cobra.Command{Use: "tool", Short: "Do things"}
+	sub := &cobra.Command{
+		Use:     "run [files]",
+		Short:   "Run the files",
+		Long:    "tool run runs the files.\n\nModes:\n\tfast  skip checks\n\tslow  check -everything-",
+		Example: "tool run a.txt\n.hidden",
+		Run:     func(cmd *cobra.Command, args []string) {},
+	}
+	sub.Flags().IntP("jobs", "j", 4, "Number of `workers`")
+	sub.Flags().Bool("dry-run", false, `Print the commands, with \ escaped`)
+	root.PersistentFlags().String("config", "", "config file")
+	root.AddCommand(sub)
+
+	want := `.TH "TOOL-RUN" 1 "2025-01-02" "tool 1.0" "sqirvy-cli Manual"
+.SH NAME
+tool\-run \- Run the files
+.SH SYNOPSIS
+.B tool run [files] [flags]
+.SH DESCRIPTION
+.PP
+tool run runs the files.
+.PP
+.nf
+Modes:
+    fast  skip checks
+    slow  check \-everything\-
+.fi
+.SH EXAMPLES
+.PP
+.nf
+tool run a.txt
+\&.hidden
+.fi
+.SH OPTIONS
+.TP
+\fB\-\-dry\-run\fP
+Print the commands, with \e escaped
+.TP
+\fB\-j\fP, \fB\-\-jobs\fP \fIworkers\fP
+Number of workers (default 4)
+.SH OPTIONS INHERITED FROM PARENT COMMANDS
+.TP
+\fB\-\-config\fP \fIstring\fP
+config file
+.SH SEE ALSO
+.BR tool (1)
+`
+	got := string(genManPage(sub, manHeader{Date: "2025-01-02", Source: "tool 1.0"}))
+	if got != want {
+		t.Errorf("genManPage() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestManDate(t *testing.T) {
+	t.Setenv("SOURCE_DATE_EPOCH", "1700000000")
+	if got := manDate(); got != "2023-11-14" {
+		t.Errorf("manDate() = %s, want the date of SOURCE_DATE_EPOCH", got)
+	}
+}
@@ -0,0 +1,414 @@
+/*
+Copyright © 2025 David Howard  dmh2000@gmail.com
+*/
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	sqirvy "github.com/dmh2000/sqirvy-cli/pkg/sqirvy"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// hookMarker identifies hook scripts written by hooks install, so that other
+// hooks are never overwritten or removed by accident.
+const hookMarker = "# installed by sqirvy-cli hooks install"
+
+// defaultHookTimeout is the time a hook waits for the model unless hooks.timeout is set.
+const defaultHookTimeout = 30 * time.Second
+
+// hookMaxDiffBytes limits the diff sent by a hook, so that hooks stay fast on large changes.
+const hookMaxDiffBytes = 100_000
+
+// emptyTree is the hash of the empty git tree, the base of a diff of root commits.
+const emptyTree = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+
+// hookNames are the git hooks that hooks install can set up.
+var hookNames = []string{"prepare-commit-msg", "pre-push"}
+
+// hooksCmd groups the subcommands that manage the git hooks of sqirvy-cli.
+var hooksCmd = &cobra.Command{
+	Use:   "hooks",
+	Short: "Manage git hooks that write commit messages and review pushes",
+	Long: `sqirvy-cli hooks manages git hooks of the repository in the current directory.
+	install     install the prepare-commit-msg and pre-push hooks
+	uninstall   remove the hooks installed by sqirvy-cli
+The prepare-commit-msg hook writes a commit message for the staged changes when
+none is given with -m. The pre-push hook reviews the pushed changes and blocks the
+push if a finding is at or above hooks.fail_on, high by default.
+The hooks use hooks.model from the config file, or the default model, at
+temperature 0, and cache their responses, so running them again on the same
+changes does not query the model. If the model cannot be reached within
+hooks.timeout, 30s by default, the hooks fail open and let git continue unless
+hooks.fail_open is false.
+`,
+}
+
+var hooksInstallCmd = &cobra.Command{
+	Use:   "install",
+	Short: "Install the git hooks in the current repository",
+	Long: `sqirvy-cli hooks install writes the prepare-commit-msg and pre-push hooks, or the
+hooks named by --hooks, to the hooks directory of the repository in the current
+directory. Existing hooks that were not installed by sqirvy-cli are kept unless
+--force is given.
+`,
+	Args:              cobra.NoArgs,
+	ValidArgsFunction: cobra.NoFileCompletions,
+	Run: func(cmd *cobra.Command, args []string) {
+		names, _ := cmd.Flags().GetStringSlice("hooks")
+		force, _ := cmd.Flags().GetBool("force")
+		if err := installHooks(names, force); err != nil {
+			log.Fatalf("Error executing hooks install command: %v", err)
+		}
+	},
+}
+
+var hooksUninstallCmd = &cobra.Command{
+	Use:               "uninstall",
+	Short:             "Remove the git hooks installed by sqirvy-cli",
+	Args:              cobra.NoArgs,
+	ValidArgsFunction: cobra.NoFileCompletions,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := uninstallHooks(); err != nil {
+			log.Fatalf("Error executing hooks uninstall command: %v", err)
+		}
+	},
+}
+
+// hooksRunCmd is called by the installed hook scripts with the arguments git
+// passes to the hook.
+var hooksRunCmd = &cobra.Command{
+	Use:    "run hook [args...]",
+	Short:  "Run a git hook; called by the installed hook scripts",
+	Hidden: true,
+	Args:   cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		model := globalModel()
+		if !explicitSetting(cmd, "model") && viper.IsSet("hooks.model") {
+			model = viper.GetString("hooks.model")
+		}
+		timeout := defaultHookTimeout
+		if viper.IsSet("hooks.timeout") {
+			timeout = viper.GetDuration("hooks.timeout")
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		var err error
+		switch args[0] {
+		case "prepare-commit-msg":
+			err = runPrepareCommitMsg(ctx, model, args[1:])
+		case "pre-push":
+			err = runPrePush(ctx, model)
+		default:
+			log.Fatalf("Error executing hooks run command: unknown hook %q (use %s)", args[0], strings.Join(hookNames, " or "))
+		}
+
+		var blocked *pushBlockedError
+		switch {
+		case err == nil:
+		case errors.As(err, &blocked):
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		case !viper.IsSet("hooks.fail_open") || viper.GetBool("hooks.fail_open"):
+			// an unreachable model must not keep anyone from committing or pushing
+			fmt.Fprintf(os.Stderr, "sqirvy-cli: %s hook skipped: %v\n", args[0], err)
+		default:
+			log.Fatalf("Error executing %s hook: %v", args[0], err)
+		}
+	},
+}
+
+// pushBlockedError is returned by the pre-push hook when the review has findings
+// at or above the hooks.fail_on severity.
+type pushBlockedError struct {
+	counts   findingCounts
+	findings []reviewFinding
+}
+
+func (e *pushBlockedError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "sqirvy-cli: push blocked by %d review findings (critical %d, high %d, medium %d, low %d) at or above %s:\n",
+		e.counts.Total, e.counts.Critical, e.counts.High, e.counts.Medium, e.counts.Low, e.counts.FailOn)
+	threshold := failOnSeverities[e.counts.FailOn]
+	for _, f := range e.findings {
+		if severityRank(f.Severity) > severityRank(threshold) {
+			continue
+		}
+		fmt.Fprintf(&b, "  %s:%d %s [%s] %s\n", f.File, f.Line, f.Severity, f.Rule, f.Message)
+	}
+	b.WriteString("Fix the findings, or push with --no-verify to skip the review.")
+	return b.String()
+}
+
+// hooksDir returns the hooks directory of the repository in the current
+// directory, honoring core.hooksPath.
+func hooksDir() (string, error) {
+	dir, err := runGit("rev-parse", "--git-path", "hooks")
+	if err != nil {
+		return "", fmt.Errorf("error: not in a git repository: %w", err)
+	}
+	return filepath.Abs(strings.TrimSpace(dir))
+}
+
+// hookScript returns the script of a hook, which runs this binary, or
+// sqirvy-cli from the PATH if the binary was moved. If neither is found the
+// hook does nothing, so git is never blocked by a missing binary.
+func hookScript(name string) string {
+	exe, err := os.Executable()
+	if err != nil {
+		exe = "sqirvy-cli"
+	}
+	return fmt.Sprintf(`#!/bin/sh
+%s
+SQIRVY='%s'
+[ -x "$SQIRVY" ] || SQIRVY=sqirvy-cli
+command -v "$SQIRVY" >/dev/null 2>&1 || exit 0
+exec "$SQIRVY" hooks run %s "$@"
+`, hookMarker, strings.ReplaceAll(exe, "'", `'\''`), name)
+}
+
+// installHooks writes the named hook scripts to the hooks directory.
+func installHooks(names []string, force bool) error {
+	dir, err := hooksDir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("error: creating hooks directory: %w", err)
+	}
+	for _, name := range names {
+		if !slices.Contains(hookNames, name) {
+			return fmt.Errorf("error: unknown hook %q (use %s)", name, strings.Join(hookNames, " or "))
+		}
+		path := filepath.Join(dir, name)
+		if data, err := os.ReadFile(path); err == nil && !strings.Contains(string(data), hookMarker) && !force {
+			return fmt.Errorf("error: %s exists and was not installed by sqirvy-cli (use --force to replace it)", path)
+		}
+		if err := os.WriteFile(path, []byte(hookScript(name)), 0o755); err != nil {
+			return fmt.Errorf("error: writing hook: %w", err)
+		}
+		// WriteFile keeps the mode of an existing file
+		if err := os.Chmod(path, 0o755); err != nil {
+			return fmt.Errorf("error: writing hook: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "Installed %s\n", path)
+	}
+	return nil
+}
+
+// uninstallHooks removes the hook scripts written by installHooks.
+func uninstallHooks() error {
+	dir, err := hooksDir()
+	if err != nil {
+		return err
+	}
+	for _, name := range hookNames {
+		path := filepath.Join(dir, name)
+		data, err := os.ReadFile(path)
+		if err != nil || !strings.Contains(string(data), hookMarker) {
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("error: removing hook: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "Removed %s\n", path)
+	}
+	return nil
+}
+
+// runPrepareCommitMsg writes a commit message for the staged changes to the
+// message file, above the comments git put there. Commits that already have a
+// message, from -m, -c, a merge or a squash, are left alone.
+func runPrepareCommitMsg(ctx context.Context, model string, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing commit message file")
+	}
+	if len(args) > 1 && args[1] != "" && args[1] != "template" {
+		return nil
+	}
+
+	diff, err := runGit("diff", "--cached", "--no-color")
+	if err != nil {
+		return fmt.Errorf("reading staged changes: %w", err)
+	}
+	if strings.TrimSpace(diff) == "" {
+		return nil
+	}
+
+	message, err := cachedHookQuery("prepare-commit-msg", model, commitPrompt, hookDiffPrompt(diff), func(system string, prompts []string, model string, client sqirvy.Client, options sqirvy.Options) (string, error) {
+		return client.QueryText(ctx, system, prompts, model, options)
+	})
+	if err != nil {
+		return err
+	}
+
+	current, err := os.ReadFile(args[0])
+	if err != nil {
+		return err
+	}
+	message = strings.TrimSpace(sqirvy.StripCodeFences(message))
+	return os.WriteFile(args[0], []byte(message+"\n"+string(current)), 0o644)
+}
+
+// runPrePush reviews the commits being pushed, read from stdin in the format git
+// passes to pre-push hooks, and returns a pushBlockedError if a finding is at or
+// above hooks.fail_on.
+func runPrePush(ctx context.Context, model string) error {
+	failOn := "high"
+	if viper.IsSet("hooks.fail_on") {
+		failOn = viper.GetString("hooks.fail_on")
+	}
+	if _, ok := failOnSeverities[failOn]; !ok {
+		return fmt.Errorf("unknown hooks.fail_on %q (use critical, high, medium or any)", failOn)
+	}
+
+	var diffs []string
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		// <local ref> <local sha> <remote ref> <remote sha>
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 4 || strings.Trim(fields[1], "0") == "" {
+			// deleted branches have nothing to review
+			continue
+		}
+		base, err := pushBase(fields[1], fields[3])
+		if err != nil {
+			return err
+		}
+		if base == "" {
+			continue
+		}
+		diff, err := runGit("diff", "--no-color", base, fields[1])
+		if err != nil {
+			return fmt.Errorf("reading pushed changes: %w", err)
+		}
+		diffs = append(diffs, diff)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	diff := strings.Join(diffs, "\n")
+	if strings.TrimSpace(diff) == "" {
+		return nil
+	}
+
+	response, err := cachedHookQuery("pre-push", model, reviewFindingsPrompt, hookDiffPrompt(diff), func(system string, prompts []string, model string, client sqirvy.Client, options sqirvy.Options) (string, error) {
+		review, _, err := sqirvy.QueryInto[reviewFindings](ctx, client, system, prompts, model, options, defaultReviewRetries)
+		if err != nil {
+			return "", err
+		}
+		b, err := json.Marshal(review)
+		return string(b), err
+	})
+	if err != nil {
+		return err
+	}
+
+	var review reviewFindings
+	if err := json.Unmarshal([]byte(response), &review); err != nil {
+		return fmt.Errorf("decoding review: %w", err)
+	}
+	findings := normalizeFindings(review.Findings, nil)
+	if counts := countFindings(findings, failOn); counts.Failed {
+		return &pushBlockedError{counts: counts, findings: findings}
+	}
+	return nil
+}
+
+// pushBase returns the commit to diff a pushed commit against: the remote commit
+// it replaces, or for a new branch the parent of the oldest commit that is not
+// on a remote yet. It is empty if there is nothing new to review.
+func pushBase(local, remote string) (string, error) {
+	if strings.Trim(remote, "0") != "" {
+		return remote, nil
+	}
+	commits, err := runGit("rev-list", "--reverse", local, "--not", "--remotes")
+	if err != nil {
+		return "", fmt.Errorf("listing pushed commits: %w", err)
+	}
+	oldest, _, _ := strings.Cut(strings.TrimSpace(commits), "\n")
+	if oldest == "" {
+		return "", nil
+	}
+	if _, err := runGit("rev-parse", "--verify", "--quiet", oldest+"^"); err != nil {
+		return emptyTree, nil
+	}
+	return oldest + "^", nil
+}
+
+// hookDiffPrompt returns the prompts for a diff, cut to hookMaxDiffBytes.
+func hookDiffPrompt(diff string) []string {
+	if len(diff) > hookMaxDiffBytes {
+		slog.Debug("Diff is too large, cutting it", "bytes", len(diff), "limit", hookMaxDiffBytes)
+		diff = strings.ToValidUTF8(diff[:hookMaxDiffBytes], "") + "\n[diff cut at the size limit of the hook]"
+	}
+	return []string{fmt.Sprintf("--- START DIFF ---\n%s\n--- END DIFF ---", diff)}
+}
+
+// cachedHookQuery returns the cached response of the hook for the model and
+// prompts, or runs query at temperature 0 and caches its response. The cache is
+// kept in the user cache directory; a cache that cannot be read or written only
+// makes the hook slower.
+func cachedHookQuery(hook, model, system string, prompts []string, query func(system string, prompts []string, model string, client sqirvy.Client, options sqirvy.Options) (string, error)) (string, error) {
+	// resolve aliases and unique prefixes
+	model = resolveModel(model)
+
+	// switch to the fallback model while the provider is failing
+	model = availableModel(model)
+
+	sum := sha256.Sum256([]byte(strings.Join(append([]string{hook, model, system}, prompts...), "\x00")))
+	var cacheFile string
+	if dir, err := cacheDir(); err == nil {
+		cacheFile = filepath.Join(dir, "hooks", hex.EncodeToString(sum[:]))
+		if data, err := os.ReadFile(cacheFile); err == nil {
+			slog.Debug("Using cached hook response", "hook", hook, "file", cacheFile)
+			return string(data), nil
+		}
+	}
+
+	// Log the selected model
+	slog.Info("Using model", "model", model)
+
+	client, err := newClientForModel(model)
+	if err != nil {
+		return "", err
+	}
+	options := sqirvy.Options{Temperature: 0, MaxTokens: sqirvy.GetMaxTokens(model)}
+	response, err := query(system, prompts, model, client, options)
+	if err != nil {
+		return "", fmt.Errorf("querying model %s: %w", model, err)
+	}
+
+	if cacheFile != "" {
+		if err := os.MkdirAll(filepath.Dir(cacheFile), 0o700); err == nil {
+			if err := os.WriteFile(cacheFile, []byte(response), 0o600); err != nil {
+				slog.Debug("Caching hook response failed", "error", err)
+			}
+		}
+	}
+	return response, nil
+}
+
+// init registers the hooks command and its subcommands with the root command.
+func init() {
+	hooksInstallCmd.Flags().StringSlice("hooks", hookNames, "Hooks to install: prepare-commit-msg, pre-push")
+	hooksInstallCmd.Flags().Bool("force", false, "Replace existing hooks that were not installed by sqirvy-cli")
+	hooksCmd.AddCommand(hooksInstallCmd, hooksUninstallCmd, hooksRunCmd)
+	rootCmd.AddCommand(hooksCmd)
+}
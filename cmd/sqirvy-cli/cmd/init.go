@@ -0,0 +1,299 @@
+/*
+Copyright © 2025 David Howard  dmh2000@gmail.com
+*/
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	sqirvy "github.com/dmh2000/sqirvy-cli/pkg/sqirvy"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// providerSetup lists the environment variables that configure a provider.
+// It is shared by the init and doctor commands.
+type providerSetup struct {
+	Provider        string
+	KeyVar          string
+	BaseURLVar      string // empty if the provider has no base URL setting
+	BaseURLRequired bool
+	DefaultBaseURL  string // endpoint used when the base URL is not set
+	DefaultModel    string // model used when no model is set and the provider has a key
+}
+
+// setupProviders are the providers offered by the init command, in the order asked.
+var setupProviders = []providerSetup{
+	{Provider: sqirvy.Anthropic, KeyVar: "ANTHROPIC_API_KEY", BaseURLVar: "ANTHROPIC_BASE_URL", DefaultBaseURL: "https://api.anthropic.com", DefaultModel: "claude-sonnet-4-20250514"},
+	{Provider: sqirvy.Gemini, KeyVar: "GEMINI_API_KEY", BaseURLVar: "GEMINI_BASE_URL", DefaultBaseURL: "https://generativelanguage.googleapis.com", DefaultModel: "gemini-2.5-flash"},
+	{Provider: sqirvy.OpenAI, KeyVar: "OPENAI_API_KEY", BaseURLVar: "OPENAI_BASE_URL", DefaultBaseURL: "https://api.openai.com/v1", DefaultModel: "gpt-4o"},
+	{Provider: sqirvy.Llama, KeyVar: "LLAMA_API_KEY", BaseURLVar: "LLAMA_BASE_URL", BaseURLRequired: true, DefaultModel: "llama3.3-70b"},
+}
+
+// setupValidateTimeout limits the request used to check an API key.
+const setupValidateTimeout = 15 * time.Second
+
+// initCmd represents the interactive first-run setup.
+var initCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Interactive setup of providers, API keys and the default model",
+	Long: `sqirvy-cli init walks through choosing providers, entering API keys, and
+picking a default model, then writes the configuration file.
+Each API key is checked by listing the models the provider serves.
+Keys are stored in the env section of the configuration file, which is only
+readable by the user. Variables already set in the environment take precedence.
+`,
+	Args:              cobra.NoArgs,
+	ValidArgsFunction: cobra.NoFileCompletions,
+	Run: func(cmd *cobra.Command, args []string) {
+		path, err := configFilePath()
+		if err != nil {
+			log.Fatalf("Error executing init command: %v", err)
+		}
+		if err := executeInit(os.Stdin, os.Stdout, path); err != nil {
+			log.Fatalf("Error executing init command: %v", err)
+		}
+	},
+}
+
+// setupWizard reads answers from in and writes questions to out.
+type setupWizard struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+// ask prints a question and returns the trimmed answer, or def if the answer is empty.
+func (w *setupWizard) ask(question, def string) (string, error) {
+	if def != "" {
+		fmt.Fprintf(w.out, "%s [%s]: ", question, def)
+	} else {
+		fmt.Fprintf(w.out, "%s: ", question)
+	}
+	line, err := w.in.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", fmt.Errorf("error: reading answer: %w", err)
+	}
+	if answer := strings.TrimSpace(line); answer != "" {
+		return answer, nil
+	}
+	return def, nil
+}
+
+// confirm asks a yes/no question.
+func (w *setupWizard) confirm(question string, def bool) (bool, error) {
+	defAnswer := "y/N"
+	if def {
+		defAnswer = "Y/n"
+	}
+	answer, err := w.ask(question+" ("+defAnswer+")", "")
+	if err != nil {
+		return false, err
+	}
+	if answer == "" {
+		return def, nil
+	}
+	return strings.HasPrefix(strings.ToLower(answer), "y"), nil
+}
+
+// executeInit runs the setup dialog and writes the configuration file to path.
+func executeInit(in io.Reader, out io.Writer, path string) error {
+	w := &setupWizard{in: bufio.NewReader(in), out: out}
+
+	overwrite := false
+	if _, err := os.Stat(path); err == nil {
+		ok, err := w.confirm(fmt.Sprintf("%s already exists. Overwrite it?", path), false)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("error: %s already exists", path)
+		}
+		overwrite = true
+	}
+
+	env := make(map[string]string)
+	var configured []string
+	for _, p := range setupProviders {
+		if !sqirvy.ProviderIncluded(p.Provider) {
+			continue
+		}
+		ok, err := setupProvider(w, p, env)
+		if err != nil {
+			return err
+		}
+		if ok {
+			configured = append(configured, p.Provider)
+		}
+	}
+	if len(configured) == 0 {
+		return fmt.Errorf("error: no providers were configured")
+	}
+
+	model, err := chooseModel(w, configured)
+	if err != nil {
+		return err
+	}
+
+	data, err := setupConfig(model, env)
+	if err != nil {
+		return err
+	}
+	if err := writeConfigFile(path, data, overwrite); err != nil {
+		return err
+	}
+	fmt.Fprintln(out, "Configuration written to", path)
+	return nil
+}
+
+// setupProvider asks whether to use a provider and, if so, for its API key and base
+// URL, which are added to env. A key already in the environment can be kept as is.
+// It reports whether the provider was configured.
+func setupProvider(w *setupWizard, p providerSetup, env map[string]string) (bool, error) {
+	if err := loadAPIKey(p.Provider); err != nil {
+		fmt.Fprintln(w.out, err)
+	}
+	existing := os.Getenv(p.KeyVar)
+	use, err := w.confirm(fmt.Sprintf("\nUse %s?", p.Provider), existing != "")
+	if err != nil || !use {
+		return false, err
+	}
+
+	question := fmt.Sprintf("%s API key", p.Provider)
+	if existing != "" {
+		question += fmt.Sprintf(" (leave empty to use $%s from the environment)", p.KeyVar)
+	}
+	key, err := w.ask(question, "")
+	if err != nil {
+		return false, err
+	}
+	if key == "" && existing == "" {
+		fmt.Fprintf(w.out, "No API key, skipping %s\n", p.Provider)
+		return false, nil
+	}
+
+	baseURL := ""
+	existingBaseURL := ""
+	if p.BaseURLVar != "" {
+		existingBaseURL = os.Getenv(p.BaseURLVar)
+		question := fmt.Sprintf("%s base URL", p.Provider)
+		if !p.BaseURLRequired {
+			question += " (leave empty for the default)"
+		}
+		baseURL, err = w.ask(question, existingBaseURL)
+		if err != nil {
+			return false, err
+		}
+		if baseURL == "" && p.BaseURLRequired {
+			fmt.Fprintf(w.out, "No base URL, skipping %s\n", p.Provider)
+			return false, nil
+		}
+	}
+
+	// the key is checked with the same environment the clients will see
+	if key != "" {
+		os.Setenv(p.KeyVar, key)
+	}
+	if baseURL != "" {
+		os.Setenv(p.BaseURLVar, baseURL)
+	}
+	fmt.Fprintf(w.out, "Checking %s API key... ", p.Provider)
+	ctx, cancel := context.WithTimeout(context.Background(), setupValidateTimeout)
+	models, err := sqirvy.ListRemoteModels(ctx, p.Provider)
+	cancel()
+	if err != nil {
+		fmt.Fprintf(w.out, "failed: %v\n", err)
+		keep, err := w.confirm("Keep these settings anyway?", false)
+		if err != nil || !keep {
+			return false, err
+		}
+	} else {
+		fmt.Fprintf(w.out, "ok, %d models available\n", len(models))
+	}
+
+	if key != "" {
+		env[p.KeyVar] = key
+	}
+	// a new key is stored with its base URL so the config file is self-contained
+	if baseURL != "" && (key != "" || baseURL != existingBaseURL) {
+		env[p.BaseURLVar] = baseURL
+	}
+	return true, nil
+}
+
+// chooseModel lists the registered models of the configured providers and asks for
+// the default model, by number or by name.
+func chooseModel(w *setupWizard, providers []string) (string, error) {
+	var models []string
+	for _, mp := range sqirvy.GetModelProviderList() {
+		if slices.Contains(providers, mp.Provider) {
+			models = append(models, mp.Model)
+		}
+	}
+	slices.Sort(models)
+
+	// the default model of the first configured provider is offered
+	def := ""
+	for _, p := range setupProviders {
+		if slices.Contains(providers, p.Provider) && slices.Contains(models, p.DefaultModel) {
+			def = p.DefaultModel
+			break
+		}
+	}
+	if def == "" && len(models) > 0 {
+		def = models[0]
+	}
+
+	fmt.Fprintln(w.out, "\nAvailable models:")
+	for i, model := range models {
+		fmt.Fprintf(w.out, "%3d  %s\n", i+1, model)
+	}
+	for {
+		answer, err := w.ask("Default model (number or name)", def)
+		if err != nil {
+			return "", err
+		}
+		if n, err := strconv.Atoi(answer); err == nil && n >= 1 && n <= len(models) {
+			return models[n-1], nil
+		}
+		model := sqirvy.ResolveModel(answer)
+		if _, err := sqirvy.GetProviderName(model); err == nil {
+			return model, nil
+		}
+		fmt.Fprintf(w.out, "Unknown model %q\n", answer)
+	}
+}
+
+// setupConfig renders the configuration file written by the init command.
+func setupConfig(model string, env map[string]string) ([]byte, error) {
+	config := struct {
+		Model       string            `yaml:"model"`
+		Temperature float64           `yaml:"temperature"`
+		Env         map[string]string `yaml:"env,omitempty"`
+	}{model, defaultTemperature, env}
+
+	var out bytes.Buffer
+	out.WriteString("# sqirvy-cli configuration file written by sqirvy-cli init\n")
+	out.WriteString("# see \"sqirvy-cli config\" to view and change settings\n\n")
+	enc := yaml.NewEncoder(&out)
+	enc.SetIndent(2)
+	if err := enc.Encode(config); err != nil {
+		return nil, fmt.Errorf("error: encoding config file: %w", err)
+	}
+	return out.Bytes(), nil
+}
+
+// init registers the init command with the root command.
+func init() {
+	rootCmd.AddCommand(initCmd)
+}
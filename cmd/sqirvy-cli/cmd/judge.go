@@ -0,0 +1,208 @@
+/*
+Copyright © 2025 David Howard  dmh2000@gmail.com
+*/
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+
+	sqirvy "github.com/dmh2000/sqirvy-cli/pkg/sqirvy"
+	util "github.com/dmh2000/sqirvy-cli/pkg/util"
+
+	"github.com/spf13/cobra"
+)
+
+// judgement is the structured result of grading a response.
+type judgement struct {
+	Score     float64 `json:"score"`     // 0 (unusable) to 10 (excellent)
+	Rationale string  `json:"rationale"` // explanation of the score
+}
+
+// judgeOutput is the JSON document printed by the judge command.
+type judgeOutput struct {
+	judgement
+	Passed         *bool  `json:"passed,omitempty"`          // set when --min-score is given
+	JudgeModel     string `json:"judge_model"`               // model that graded the candidate
+	CandidateModel string `json:"candidate_model,omitempty"` // model that generated the candidate, inline mode only
+	Candidate      string `json:"candidate,omitempty"`       // generated candidate, inline mode only
+}
+
+// judgeCmd represents the command to grade a candidate with an LLM acting as judge.
+// The candidate is read from stdin, files or urls. With --candidate-model the input
+// is treated as a task instead, the candidate model answers it, and the answer is graded.
+// The result is a JSON object with a score and rationale. When --min-score is given the
+// command exits with a non-zero status if the score is below it, so it can gate CI jobs.
+var judgeCmd = &cobra.Command{
+	Use:   "judge",
+	Short: "Grade a response with an LLM acting as judge",
+	Long: `sqirvy-cli judge will ask the LLM (--model) to grade a candidate response against
+a rubric and will output a JSON object with a score from 0 to 10 and a rationale.
+The candidate is the input from stdin and any filename or url arguments.
+With --candidate-model, the input is the task instead: the candidate model answers it
+and its answer is graded.
+With --min-score, the exit status is 1 when the score is below the minimum.
+The prompt is constructed in this order:
+	An internal system prompt for grading
+	The criteria file, if any
+	The task, in --candidate-model mode
+	The candidate
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		// get arg/config params
+		model := commandModel(cmd)
+		temperature := commandTemperature(cmd)
+		criteriaFile, _ := cmd.Flags().GetString("criteria")
+		candidateModel, _ := cmd.Flags().GetString("candidate-model")
+		minScore, _ := cmd.Flags().GetFloat64("min-score")
+
+		out, err := executeJudge(model, temperature, criteriaFile, candidateModel, args)
+		if err != nil {
+			log.Fatalf("Error executing judge command: %v", err)
+		}
+		if cmd.Flags().Changed("min-score") {
+			passed := out.Score >= minScore
+			out.Passed = &passed
+		}
+
+		b, err := json.MarshalIndent(out, "", "  ")
+		if err != nil {
+			log.Fatalf("Error executing judge command: %v", err)
+		}
+		fmt.Println(string(b))
+
+		if out.Passed != nil && !*out.Passed {
+			fmt.Fprintf(os.Stderr, "Score %.1f is below the minimum %.1f\n", out.Score, minScore)
+			os.Exit(1)
+		}
+	},
+}
+
+// executeJudge reads the criteria and input, generates the candidate in inline mode,
+// and grades the candidate with the judge model.
+func executeJudge(model string, temperature float64, criteriaFile string, candidateModel string, args []string) (judgeOutput, error) {
+	// resolve aliases and unique prefixes
+	model = resolveModel(model)
+
+	// Log the selected model
+	slog.Info("Using model", "model", model)
+
+	var criteria string
+	if criteriaFile != "" {
+		data, _, err := util.ReadFile(criteriaFile, MaxInputTotalBytes)
+		if err != nil {
+			return judgeOutput{}, fmt.Errorf("error: reading criteria: %w", err)
+		}
+		criteria = string(data)
+	}
+
+	prompts, err := ReadPrompt(args)
+	if err != nil {
+		return judgeOutput{}, fmt.Errorf("error: reading prompt: %v", err)
+	}
+	input := strings.Join(prompts, "\n\n")
+
+	ctx := context.Background()
+	out := judgeOutput{JudgeModel: model}
+
+	task, candidate := "", input
+	if candidateModel != "" {
+		candidateModel = resolveModel(candidateModel)
+		slog.Info("Candidate model", "model", candidateModel)
+
+		client, err := newClientForModel(candidateModel)
+		if err != nil {
+			return judgeOutput{}, err
+		}
+
+		candidateTemperature, err := queryTemperature(temperature, candidateModel)
+		if err != nil {
+			return judgeOutput{}, err
+		}
+		options := sqirvy.Options{Temperature: candidateTemperature, MaxTokens: sqirvy.GetMaxTokens(candidateModel)}
+		candidate, err = client.QueryText(ctx, queryPrompt, prompts, candidateModel, options)
+		if err != nil {
+			return judgeOutput{}, fmt.Errorf("error: querying model %s: %v", candidateModel, err)
+		}
+		task = input
+		out.CandidateModel = candidateModel
+		out.Candidate = candidate
+	}
+
+	judge, err := newClientForModel(model)
+	if err != nil {
+		return judgeOutput{}, err
+	}
+
+	// grading should be as repeatable as possible, so the judge runs at temperature 0
+	options := sqirvy.Options{Temperature: 0, MaxTokens: sqirvy.GetMaxTokens(model)}
+	j, err := judgeResponse(ctx, judge, model, options, criteria, task, candidate)
+	if err != nil {
+		return judgeOutput{}, fmt.Errorf("error: %w", err)
+	}
+	out.judgement = j
+	return out, nil
+}
+
+// judgeResponse asks the judge model to grade candidate, optionally against the task
+// it was written for and a set of evaluation criteria.
+func judgeResponse(ctx context.Context, client sqirvy.Client, model string, options sqirvy.Options, criteria, task, candidate string) (judgement, error) {
+	var prompts []string
+	if criteria != "" {
+		prompts = append(prompts, fmt.Sprintf("--- START CRITERIA ---\n%s\n--- END CRITERIA ---", criteria))
+	}
+	if task != "" {
+		prompts = append(prompts, fmt.Sprintf("--- START TASK ---\n%s\n--- END TASK ---", task))
+	}
+	prompts = append(prompts, fmt.Sprintf("--- START CANDIDATE ---\n%s\n--- END CANDIDATE ---", candidate))
+
+	response, err := client.QueryText(ctx, judgePrompt, prompts, model, options)
+	if err != nil {
+		return judgement{}, fmt.Errorf("querying judge model %s: %w", model, err)
+	}
+	return parseJudgement(response)
+}
+
+// parseJudgement decodes the judge model's JSON response and checks the score range.
+func parseJudgement(response string) (judgement, error) {
+	text := sqirvy.StripCodeFences(response)
+
+	// tolerate text around the JSON object
+	start := strings.Index(text, "{")
+	end := strings.LastIndex(text, "}")
+	if start < 0 || end < start {
+		return judgement{}, fmt.Errorf("judge response is not a JSON object: %q", response)
+	}
+
+	var j judgement
+	if err := json.Unmarshal([]byte(text[start:end+1]), &j); err != nil {
+		return judgement{}, fmt.Errorf("judge response is not valid JSON: %w", err)
+	}
+	if j.Score < 0 || j.Score > 10 {
+		return judgement{}, fmt.Errorf("judge score %v is outside the range 0 to 10", j.Score)
+	}
+	return j, nil
+}
+
+// judgeUsage prints the usage instructions for the judge command.
+func judgeUsage(cmd *cobra.Command) error {
+	fmt.Println("Usage: stdin | sqirvy-cli judge [--criteria file.md] [--candidate-model model] [--min-score n] [flags] [files| urls]")
+	fmt.Println("\nFlags:")
+	cmd.Flags().PrintDefaults()
+	return nil
+}
+
+// init registers the judge command with the root command and sets its custom usage function.
+func init() {
+	judgeCmd.Flags().String("criteria", "", "Markdown file with the rubric to grade against")
+	judgeCmd.Flags().String("candidate-model", "", "Generate the candidate with this model, treating the input as the task")
+	judgeCmd.RegisterFlagCompletionFunc("candidate-model", completeModels)
+	judgeCmd.Flags().Float64("min-score", 0, "Exit with status 1 if the score is below this value")
+	rootCmd.AddCommand(judgeCmd)
+	judgeCmd.SetUsageFunc(judgeUsage)
+}
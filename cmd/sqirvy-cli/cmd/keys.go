@@ -0,0 +1,160 @@
+/*
+Copyright © 2025 David Howard  dmh2000@gmail.com
+*/
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	sqirvy "github.com/dmh2000/sqirvy-cli/pkg/sqirvy"
+
+	"github.com/spf13/cobra"
+)
+
+// keyCheck is the result of checking one provider's API key.
+type keyCheck struct {
+	Provider string
+	Status   string
+	Detail   string
+}
+
+// keysCmd groups the subcommands that manage provider API keys.
+var keysCmd = &cobra.Command{
+	Use:   "keys",
+	Short: "Manage provider API keys",
+	Long: `sqirvy-cli keys manages the API keys of the providers.
+	check   verify each configured API key
+	set     store a provider API key in the OS keyring
+API keys are taken from the provider environment variable, then from the
+key_command.<provider> command in the config file, then from the OS keyring.
+`,
+}
+
+var keysSetCmd = &cobra.Command{
+	Use:   "set provider",
+	Short: "Store a provider API key in the OS keyring",
+	Long: `sqirvy-cli keys set reads an API key from stdin and stores it in the OS keyring
+(macOS keychain, Linux secret service or Windows credential manager).
+The stored key is used when the provider environment variable is not set.
+`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		provider := args[0]
+		if !slices.Contains(sqirvy.GetProviderList(), provider) {
+			log.Fatalf("Error executing keys set command: unknown provider %s", provider)
+		}
+		if providerKeyVar(provider) == "" {
+			log.Fatalf("Error executing keys set command: provider %s does not use an API key", provider)
+		}
+
+		fmt.Fprintf(os.Stderr, "%s API key: ", provider)
+		key, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && key == "" {
+			log.Fatalf("Error executing keys set command: reading key: %v", err)
+		}
+		key = strings.TrimSpace(key)
+		if key == "" {
+			log.Fatalf("Error executing keys set command: no key given")
+		}
+		if err := storeAPIKey(provider, key); err != nil {
+			log.Fatalf("Error executing keys set command: %v", err)
+		}
+		fmt.Fprintf(os.Stderr, "Stored %s API key in the OS keyring\n", provider)
+	},
+}
+
+var keysCheckCmd = &cobra.Command{
+	Use:   "check [provider...]",
+	Short: "Verify the configured API keys",
+	Long: `sqirvy-cli keys check verifies the API key of each configured provider, or of
+the named providers, with an authenticated request that does not consume tokens.
+Invalid, expired and under-privileged keys are reported. The command exits with
+status 1 if any key fails.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		for _, provider := range args {
+			if !slices.Contains(sqirvy.GetProviderList(), provider) {
+				log.Fatalf("Error executing keys check command: unknown provider %s", provider)
+			}
+			if providerKeyVar(provider) == "" {
+				log.Fatalf("Error executing keys check command: provider %s does not use an API key", provider)
+			}
+		}
+
+		checks := executeKeysCheck(context.Background(), args)
+		if err := writeKeyChecks(os.Stdout, checks); err != nil {
+			log.Fatalf("Error executing keys check command: %v", err)
+		}
+		for _, c := range checks {
+			if c.Status == checkFail {
+				os.Exit(1)
+			}
+		}
+	},
+}
+
+// executeKeysCheck validates the key of each named provider, or of every provider with
+// a key set if none are named.
+func executeKeysCheck(ctx context.Context, providers []string) []keyCheck {
+	var checks []keyCheck
+	for _, p := range setupProviders {
+		named := slices.Contains(providers, p.Provider)
+		if len(providers) > 0 && !named {
+			continue
+		}
+		if err := loadAPIKey(p.Provider); err != nil {
+			checks = append(checks, keyCheck{p.Provider, checkFail, err.Error()})
+			continue
+		}
+		if os.Getenv(p.KeyVar) == "" {
+			status := checkSkip
+			if named {
+				status = checkFail
+			}
+			checks = append(checks, keyCheck{p.Provider, status, p.KeyVar + " not set"})
+			continue
+		}
+		checks = append(checks, checkKey(ctx, p.Provider))
+	}
+	return checks
+}
+
+// checkKey validates the API key of one provider.
+func checkKey(ctx context.Context, provider string) keyCheck {
+	client, err := sqirvy.NewClient(provider)
+	if err != nil {
+		return keyCheck{provider, checkFail, err.Error()}
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, doctorTimeout)
+	defer cancel()
+	if err := client.ValidateCredentials(ctx); err != nil {
+		return keyCheck{provider, checkFail, err.Error()}
+	}
+	return keyCheck{provider, checkPass, "API key accepted"}
+}
+
+// writeKeyChecks writes the results as an aligned table.
+func writeKeyChecks(w io.Writer, checks []keyCheck) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PROVIDER\tSTATUS\tDETAIL")
+	for _, c := range checks {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", c.Provider, c.Status, c.Detail)
+	}
+	return tw.Flush()
+}
+
+// init registers the keys command and its subcommands with the root command.
+func init() {
+	keysCmd.AddCommand(keysCheckCmd, keysSetCmd)
+	rootCmd.AddCommand(keysCmd)
+}
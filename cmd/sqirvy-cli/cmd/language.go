@@ -0,0 +1,97 @@
+// Package cmd implements the language and framework hints of the code and review
+// commands. --lang and --framework name the language and framework the code is
+// written in; without --lang the language is detected from the extensions of the
+// file arguments. The hints are added to the system prompt, so the same prompts
+// work across ecosystems.
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// languageByExtension maps file extensions to the language of the file.
+var languageByExtension = map[string]string{
+	".c":     "C",
+	".h":     "C",
+	".cc":    "C++",
+	".cpp":   "C++",
+	".hpp":   "C++",
+	".cs":    "C#",
+	".go":    "Go",
+	".java":  "Java",
+	".js":    "JavaScript",
+	".jsx":   "JavaScript",
+	".mjs":   "JavaScript",
+	".kt":    "Kotlin",
+	".lua":   "Lua",
+	".php":   "PHP",
+	".py":    "Python",
+	".rb":    "Ruby",
+	".rs":    "Rust",
+	".scala": "Scala",
+	".sh":    "shell",
+	".sql":   "SQL",
+	".swift": "Swift",
+	".ts":    "TypeScript",
+	".tsx":   "TypeScript",
+	".zig":   "Zig",
+}
+
+// addLanguageFlags adds --lang and --framework to a command.
+func addLanguageFlags(cmd *cobra.Command) {
+	cmd.Flags().String("lang", "", "Programming language of the code, detected from file extensions if not set")
+	cmd.Flags().String("framework", "", "Framework or library the code uses, e.g. gin, react or pytest")
+}
+
+// languageHint returns the text added to the system prompt for the --lang and
+// --framework flags, or the language detected from the file arguments. It is
+// empty if neither is known.
+func languageHint(cmd *cobra.Command, args []string) string {
+	lang, _ := cmd.Flags().GetString("lang")
+	framework, _ := cmd.Flags().GetString("framework")
+	if lang == "" {
+		lang = detectLanguage(args)
+		if lang != "" {
+			slog.Debug("Detected language", "lang", lang)
+		}
+	}
+
+	var hints []string
+	if lang != "" {
+		hints = append(hints, fmt.Sprintf("The code is written in %s. Follow the conventions and idioms of %s.", lang, lang))
+	}
+	if framework != "" {
+		hints = append(hints, fmt.Sprintf("The code uses %s. Use its APIs and conventions correctly.", framework))
+	}
+	if len(hints) == 0 {
+		return ""
+	}
+	return "\n\n" + strings.Join(hints, "\n")
+}
+
+// detectLanguage returns the language of most file arguments, by extension, or an
+// empty string if no argument has a known extension. Ties go to the language seen
+// first. URLs are ignored.
+func detectLanguage(args []string) string {
+	counts := make(map[string]int)
+	best := ""
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "http://") || strings.HasPrefix(arg, "https://") {
+			continue
+		}
+		lang, ok := languageByExtension[strings.ToLower(filepath.Ext(arg))]
+		if !ok {
+			continue
+		}
+		counts[lang]++
+		if best == "" || counts[lang] > counts[best] {
+			best = lang
+		}
+	}
+	return best
+}
@@ -0,0 +1,140 @@
+// Package cmd implements the logger used for notices, warnings and timings, with
+// verbosity set by --quiet, -v and -vv and the format by --log-format.
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/spf13/viper"
+)
+
+// levelTrace is the level of the detailed messages shown with -vv, e.g. each file read.
+const levelTrace = slog.LevelDebug - 4
+
+// initLogging sets the default logger from the verbosity flags and the log format.
+// The default shows notices such as the model used; --quiet shows only warnings and
+// errors, -v adds the timing of prompt assembly, scraping and provider calls, and
+// -vv adds detailed messages.
+func initLogging() {
+	quiet, _ := rootCmd.PersistentFlags().GetBool("quiet")
+	verbose, _ := rootCmd.PersistentFlags().GetCount("verbose")
+
+	level := slog.LevelInfo
+	switch {
+	case quiet:
+		level = slog.LevelWarn
+	case verbose == 1:
+		level = slog.LevelDebug
+	case verbose > 1:
+		level = levelTrace
+	}
+
+	var handler slog.Handler
+	switch format := viper.GetString("log-format"); format {
+	case "", "text":
+		handler = newTextHandler(os.Stderr, level)
+	case "json":
+		handler = slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: level, ReplaceAttr: traceLevelName})
+	default:
+		fmt.Fprintf(os.Stderr, "error: unknown log format %q (use text or json)\n", format)
+		os.Exit(1)
+	}
+	slog.SetDefault(slog.New(handler))
+}
+
+// traceLevelName names levelTrace TRACE in JSON logs instead of DEBUG-4.
+func traceLevelName(groups []string, a slog.Attr) slog.Attr {
+	if a.Key == slog.LevelKey && len(groups) == 0 {
+		if level, ok := a.Value.Any().(slog.Level); ok && level <= levelTrace {
+			a.Value = slog.StringValue("TRACE")
+		}
+	}
+	return a
+}
+
+// textHandler writes log records as one line of plain text, the message followed by
+// its attributes, e.g. "Using model model=gpt-4o". Warnings and errors are prefixed
+// with their level; there is no timestamp.
+type textHandler struct {
+	mu     *sync.Mutex
+	w      io.Writer
+	level  slog.Level
+	attrs  string // preformatted attributes added with WithAttrs
+	prefix string // group prefix of attribute keys
+}
+
+// newTextHandler returns a text handler writing records at level or above to w.
+func newTextHandler(w io.Writer, level slog.Level) *textHandler {
+	return &textHandler{mu: &sync.Mutex{}, w: w, level: level}
+}
+
+func (h *textHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level
+}
+
+func (h *textHandler) Handle(_ context.Context, r slog.Record) error {
+	var b strings.Builder
+	switch {
+	case r.Level >= slog.LevelError:
+		b.WriteString("error: ")
+	case r.Level >= slog.LevelWarn:
+		b.WriteString("warning: ")
+	}
+	b.WriteString(r.Message)
+	b.WriteString(h.attrs)
+	r.Attrs(func(a slog.Attr) bool {
+		writeTextAttr(&b, h.prefix, a)
+		return true
+	})
+	b.WriteString("\n")
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := io.WriteString(h.w, b.String())
+	return err
+}
+
+func (h *textHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	var b strings.Builder
+	for _, a := range attrs {
+		writeTextAttr(&b, h.prefix, a)
+	}
+	h2 := *h
+	h2.attrs += b.String()
+	return &h2
+}
+
+func (h *textHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	h2.prefix += name + "."
+	return &h2
+}
+
+// writeTextAttr writes one attribute as " key=value", quoting values with spaces.
+func writeTextAttr(b *strings.Builder, prefix string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		for _, ga := range a.Value.Group() {
+			writeTextAttr(b, prefix+a.Key+".", ga)
+		}
+		return
+	}
+	value := a.Value.String()
+	if value == "" || strings.ContainsAny(value, " \t\n\"=") {
+		value = strconv.Quote(value)
+	}
+	fmt.Fprintf(b, " %s%s=%s", prefix, a.Key, value)
+}
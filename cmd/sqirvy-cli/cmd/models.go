@@ -4,60 +4,249 @@ Copyright © 2025 David Howard  dmh2000@gmail.com
 package cmd
 
 import (
+	"context"
 	_ "embed"
+	"encoding/json"
 	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
 	"sort"
+	"text/tabwriter"
 
-	sqirvy "dmh2000/sqirvy-cli/pkg/sqirvy"
+	sqirvy "github.com/dmh2000/sqirvy-cli/pkg/sqirvy"
 
 	"github.com/spf13/cobra"
 )
 
+// modelEntry is the machine-readable description of a model printed by --format json.
+type modelEntry struct {
+	Model           string  `json:"model"`
+	Provider        string  `json:"provider"`
+	ContextWindow   int64   `json:"context_window"`
+	MaxOutputTokens int64   `json:"max_output_tokens"`
+	Vision          bool    `json:"vision"`
+	Tools           bool    `json:"tools"`
+	JSON            bool    `json:"json_mode"`
+	Reasoning       bool    `json:"reasoning"`
+	InputCost       float64 `json:"input_cost_per_mtok"`
+	OutputCost      float64 `json:"output_cost_per_mtok"`
+	Retires         string  `json:"retires,omitempty"`
+	Successor       string  `json:"successor,omitempty"`
+	Status          string  `json:"status,omitempty"` // set by --remote
+}
+
+// Model status values reported by --remote
+const (
+	modelStatusOK           = "ok"           // registered and served by the provider
+	modelStatusNotServed    = "not served"   // registered but not listed by the provider
+	modelStatusUnregistered = "unregistered" // listed by the provider but not registered
+)
+
 // modelsCmd represents the command to list supported LLM providers and models.
-// It retrieves the list of models and their providers from the sqirvy package
+// It retrieves the list of models and their capabilities from the sqirvy package
 // and prints them to standard output, sorted alphabetically by provider and model.
 var modelsCmd = &cobra.Command{
 	Use:   "models",
 	Short: "List the supported LLM models and providers",
-	Long:  `sqirvy-cli models lists all the Large Language Models (LLMs) supported by the tool, grouped by their provider (e.g., OpenAI, Anthropic, Gemini, Llama).`,
+	Long: `sqirvy-cli models lists all the Large Language Models (LLMs) supported by the tool, grouped by their provider (e.g., OpenAI, Anthropic, Gemini, Llama).
+For each model it shows the context window, the maximum output tokens, whether the model
+accepts images and supports tool calling and JSON mode, whether it reasons before
+answering, and the price in USD per million input and output tokens.
+Use --provider to list the models of a single provider and --format json for machine-readable output.
+With --remote, each provider that has an API key configured is asked for the models it serves.
+The results are merged with the built-in list and each model is given a status:
+	ok            registered and served by the provider
+	not served    registered but not listed by the provider
+	unregistered  listed by the provider but not registered in sqirvy-cli`,
 	Run: func(cmd *cobra.Command, args []string) {
-		// Retrieve the list of models and providers
-		mplist := sqirvy.GetModelProviderList()
-		if mplist == nil {
-			fmt.Println("No models found")
-			return
+		format, _ := cmd.Flags().GetString("format")
+		provider, _ := cmd.Flags().GetString("provider")
+		remote, _ := cmd.Flags().GetBool("remote")
+
+		entries := listModels(provider)
+		if remote {
+			entries = mergeRemoteModels(entries, provider)
 		}
 
-		// Format the list for printing
-		var mptext []string
-		for _, v := range mplist {
-			// Format as "  Provider  : ModelName"
-			mptext = append(mptext, fmt.Sprintf("  %-10s: %s", v.Provider, v.Model))
+		switch format {
+		case "json":
+			b, err := json.MarshalIndent(entries, "", "  ")
+			if err != nil {
+				log.Fatalf("Error executing models command: %v", err)
+			}
+			fmt.Println(string(b))
+		case "text":
+			if len(entries) == 0 {
+				fmt.Println("No models found")
+				return
+			}
+			printModelTable(os.Stdout, entries)
+		default:
+			log.Fatalf("Error executing models command: unknown format %q (use text or json)", format)
 		}
+	},
+}
 
-		// Sort the formatted list alphabetically
-		sort.Strings(mptext)
+// listModels returns the registered models, optionally restricted to one provider,
+// sorted by provider and then model name.
+func listModels(provider string) []modelEntry {
+	entries := []modelEntry{}
+	for _, model := range sqirvy.GetModelList() {
+		info, err := sqirvy.GetModelInfo(model)
+		if err != nil {
+			continue
+		}
+		if provider != "" && info.Provider != provider {
+			continue
+		}
+		entries = append(entries, modelEntry{
+			Model:           model,
+			Provider:        info.Provider,
+			ContextWindow:   info.ContextWindow,
+			MaxOutputTokens: info.MaxTokens,
+			Vision:          info.Vision,
+			Tools:           info.Tools,
+			JSON:            info.JSON,
+			Reasoning:       info.Reasoning,
+			InputCost:       info.InputCost,
+			OutputCost:      info.OutputCost,
+			Retires:         info.Retires,
+			Successor:       info.Successor,
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Provider != entries[j].Provider {
+			return entries[i].Provider < entries[j].Provider
+		}
+		return entries[i].Model < entries[j].Model
+	})
+	return entries
+}
+
+// mergeRemoteModels asks each configured provider for the models it serves and
+// merges them with the registered models, setting the status of each entry.
+// Providers without an API key, or whose list request fails, are skipped with a
+// warning and their models are left without a status.
+func mergeRemoteModels(entries []modelEntry, provider string) []modelEntry {
+	ctx, cancel := context.WithTimeout(context.Background(), sqirvy.RequestTimeout)
+	defer cancel()
 
-		// Print the header and the sorted list
-		fmt.Println("Supported Providers and Models:")
-		for _, m := range mptext {
-			fmt.Println(m)
+	for _, p := range sqirvy.GetProviderList() {
+		if provider != "" && p != provider {
+			continue
 		}
-		fmt.Println() // Add a trailing newline for cleaner output
-	},
+		if err := loadAPIKey(p); err != nil {
+			slog.Warn("Skipping provider", "provider", p, "error", err)
+			continue
+		}
+		remoteModels, err := sqirvy.ListRemoteModels(ctx, p)
+		if err != nil {
+			slog.Warn("Skipping provider", "provider", p, "error", err)
+			continue
+		}
+
+		served := make(map[string]bool)
+		for _, m := range remoteModels {
+			served[m] = true
+		}
+
+		registered := make(map[string]bool)
+		for i := range entries {
+			if entries[i].Provider != p {
+				continue
+			}
+			registered[entries[i].Model] = true
+			if served[entries[i].Model] {
+				entries[i].Status = modelStatusOK
+			} else {
+				entries[i].Status = modelStatusNotServed
+			}
+		}
+		for _, m := range remoteModels {
+			if !registered[m] {
+				entries = append(entries, modelEntry{Model: m, Provider: p, Status: modelStatusUnregistered})
+			}
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Provider != entries[j].Provider {
+			return entries[i].Provider < entries[j].Provider
+		}
+		return entries[i].Model < entries[j].Model
+	})
+	return entries
+}
+
+// printModelTable prints the models as an aligned table.
+func printModelTable(w io.Writer, entries []modelEntry) {
+	yesNo := func(b bool) string {
+		if b {
+			return "yes"
+		}
+		return "no"
+	}
+	// unknown values are printed as "-"
+	orDash := func(s string, known bool) string {
+		if known {
+			return s
+		}
+		return "-"
+	}
+
+	// the status column is only shown when --remote set a status
+	withStatus := false
+	for _, e := range entries {
+		if e.Status != "" {
+			withStatus = true
+			break
+		}
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	header := "PROVIDER\tMODEL\tCONTEXT\tMAX OUTPUT\tVISION\tTOOLS\tJSON\tREASONING\tINPUT $/MTOK\tOUTPUT $/MTOK"
+	if withStatus {
+		header += "\tSTATUS"
+	}
+	fmt.Fprintln(tw, header)
+	for _, e := range entries {
+		registered := e.Status != modelStatusUnregistered
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s",
+			e.Provider,
+			e.Model,
+			orDash(fmt.Sprint(e.ContextWindow), e.ContextWindow > 0),
+			orDash(fmt.Sprint(e.MaxOutputTokens), registered),
+			orDash(yesNo(e.Vision), registered),
+			orDash(yesNo(e.Tools), registered),
+			orDash(yesNo(e.JSON), registered),
+			orDash(yesNo(e.Reasoning), registered),
+			orDash(fmt.Sprintf("%.3f", e.InputCost), e.InputCost > 0),
+			orDash(fmt.Sprintf("%.3f", e.OutputCost), e.OutputCost > 0),
+		)
+		if withStatus {
+			fmt.Fprintf(tw, "\t%s", orDash(e.Status, e.Status != ""))
+		}
+		fmt.Fprintln(tw)
+	}
+	tw.Flush()
 }
 
 // modelsUsage prints the usage instructions for the models command.
 func modelsUsage(cmd *cobra.Command) error {
-	fmt.Println("Usage: sqirvy-cli models")
-	// No flags specific to this command, but persistent flags apply.
+	fmt.Println("Usage: sqirvy-cli models [--provider name] [--format text|json] [--remote]")
 	fmt.Println("\nFlags:")
-	cmd.PersistentFlags().PrintDefaults()
+	cmd.Flags().PrintDefaults()
 	return nil
 }
 
 // init registers the models command with the root command and sets its custom usage function.
 func init() {
+	modelsCmd.Flags().String("format", "text", "Output format: text or json")
+	modelsCmd.Flags().String("provider", "", "Only list models for this provider (anthropic, gemini, openai, llama)")
+	modelsCmd.RegisterFlagCompletionFunc("provider", completeProviders)
+	modelsCmd.Flags().Bool("remote", false, "Query each configured provider for the models it serves and compare with the registry")
 	rootCmd.AddCommand(modelsCmd)
 	modelsCmd.SetUsageFunc(modelsUsage)
 }
@@ -0,0 +1,193 @@
+// Package cmd implements the models resolve command, which shows how a model name
+// given with --model resolves: through a unique prefix and an alias to the model,
+// its provider, token limits and pricing. Without a name it lists the aliases.
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	sqirvy "github.com/dmh2000/sqirvy-cli/pkg/sqirvy"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// resolveEntry is the resolution of a model name printed by models resolve.
+type resolveEntry struct {
+	Input           string   `json:"input"`
+	Prefix          string   `json:"prefix_of,omitempty"`
+	Alias           string   `json:"alias,omitempty"`
+	Model           string   `json:"model"`
+	Ambiguous       []string `json:"ambiguous,omitempty"`
+	Registered      bool     `json:"registered"`
+	Provider        string   `json:"provider,omitempty"`
+	ContextWindow   int64    `json:"context_window,omitempty"`
+	MaxOutputTokens int64    `json:"max_output_tokens,omitempty"`
+	InputCost       float64  `json:"input_cost_per_mtok,omitempty"`
+	OutputCost      float64  `json:"output_cost_per_mtok,omitempty"`
+	Deprecation     string   `json:"deprecation,omitempty"`
+}
+
+// aliasEntry is an alias listed by models resolve without a name.
+type aliasEntry struct {
+	Alias    string `json:"alias"`
+	Model    string `json:"model"`
+	Provider string `json:"provider,omitempty"` // empty if the model is not registered
+}
+
+// modelsResolveCmd shows how a model name resolves.
+var modelsResolveCmd = &cobra.Command{
+	Use:   "resolve [name]",
+	Short: "Show how a model name resolves to a model, provider, limits and pricing",
+	Long: `sqirvy-cli models resolve shows how a model name, as given with --model, resolves:
+the model or alias name it is a unique prefix of, the alias it follows, the model,
+its provider, context window, maximum output tokens and price in USD per million
+input and output tokens. Without a name it lists the aliases and their models.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		format, _ := cmd.Flags().GetString("format")
+		if format != "text" && format != "json" {
+			log.Fatalf("Error executing models resolve command: unknown format %q (use text or json)", format)
+		}
+
+		var v any
+		if len(args) == 0 {
+			v = listAliases()
+		} else {
+			v = resolveModelName(args[0])
+		}
+		if format == "json" {
+			b, err := json.MarshalIndent(v, "", "  ")
+			if err != nil {
+				log.Fatalf("Error executing models resolve command: %v", err)
+			}
+			fmt.Println(string(b))
+			return
+		}
+		switch v := v.(type) {
+		case []aliasEntry:
+			printAliasTable(os.Stdout, v)
+		case resolveEntry:
+			printResolution(os.Stdout, v)
+		}
+	},
+}
+
+// resolveModelName resolves the name like --model and looks up the model.
+func resolveModelName(name string) resolveEntry {
+	r := sqirvy.ExplainModel(strings.TrimSpace(name))
+	e := resolveEntry{Input: r.Input, Prefix: r.Prefix, Alias: r.Alias, Model: r.Model, Ambiguous: r.Ambiguous}
+	if info, err := sqirvy.GetModelInfo(r.Model); err == nil {
+		e.Registered = true
+		e.Provider = info.Provider
+		e.ContextWindow = info.ContextWindow
+		e.MaxOutputTokens = info.MaxTokens
+		e.InputCost = info.InputCost
+		e.OutputCost = info.OutputCost
+		if d, deprecated := sqirvy.CheckDeprecation(r.Model, time.Now()); deprecated {
+			e.Deprecation = d.String()
+		}
+		return e
+	}
+	// unregistered models are sent to the provider setting, or run in process
+	// if they name a GGUF file
+	e.Provider = viper.GetString("provider")
+	if sqirvy.IsLocalModel(r.Model) {
+		e.Provider = sqirvy.Local
+	}
+	return e
+}
+
+// printResolution prints each step of the resolution.
+func printResolution(w io.Writer, e resolveEntry) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "input:\t%s\n", e.Input)
+	if len(e.Ambiguous) > 0 {
+		fmt.Fprintf(tw, "ambiguous prefix of:\t%s\n", strings.Join(e.Ambiguous, ", "))
+	}
+	if e.Prefix != "" {
+		fmt.Fprintf(tw, "prefix of:\t%s\n", e.Prefix)
+	}
+	if e.Alias != "" {
+		fmt.Fprintf(tw, "alias of:\t%s\n", e.Model)
+	}
+	fmt.Fprintf(tw, "model:\t%s\n", e.Model)
+	if !e.Registered {
+		if e.Provider == "" {
+			fmt.Fprintf(tw, "provider:\tnone, the model is not registered (use --provider to select one)\n")
+		} else {
+			fmt.Fprintf(tw, "provider:\t%s, the model is not registered\n", e.Provider)
+		}
+		tw.Flush()
+		return
+	}
+	fmt.Fprintf(tw, "provider:\t%s\n", e.Provider)
+	fmt.Fprintf(tw, "context window:\t%s\n", knownOr(fmt.Sprint(e.ContextWindow), e.ContextWindow > 0))
+	fmt.Fprintf(tw, "max output:\t%d\n", e.MaxOutputTokens)
+	fmt.Fprintf(tw, "input $/mtok:\t%s\n", knownOr(fmt.Sprintf("%.3f", e.InputCost), e.InputCost > 0))
+	fmt.Fprintf(tw, "output $/mtok:\t%s\n", knownOr(fmt.Sprintf("%.3f", e.OutputCost), e.OutputCost > 0))
+	if e.Deprecation != "" {
+		fmt.Fprintf(tw, "deprecated:\t%s\n", e.Deprecation)
+	}
+	tw.Flush()
+}
+
+// knownOr returns s, or "unknown" if the value is not known.
+func knownOr(s string, known bool) string {
+	if known {
+		return s
+	}
+	return "unknown"
+}
+
+// listAliases returns the registered aliases sorted by name.
+func listAliases() []aliasEntry {
+	entries := []aliasEntry{}
+	for alias, model := range sqirvy.GetAliases() {
+		provider, _ := sqirvy.GetProviderName(model)
+		entries = append(entries, aliasEntry{Alias: alias, Model: model, Provider: provider})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Alias < entries[j].Alias })
+	return entries
+}
+
+// printAliasTable prints the aliases as an aligned table.
+func printAliasTable(w io.Writer, entries []aliasEntry) {
+	if len(entries) == 0 {
+		fmt.Fprintln(w, "No aliases found")
+		return
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ALIAS\tMODEL\tPROVIDER")
+	for _, e := range entries {
+		provider := e.Provider
+		if provider == "" {
+			provider = "- (not registered)"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", e.Alias, e.Model, provider)
+	}
+	tw.Flush()
+}
+
+// modelsResolveUsage prints the usage instructions for the models resolve command.
+func modelsResolveUsage(cmd *cobra.Command) error {
+	fmt.Println("Usage: sqirvy-cli models resolve [--format text|json] [name]")
+	fmt.Println("\nFlags:")
+	cmd.Flags().PrintDefaults()
+	return nil
+}
+
+// init registers the models resolve command.
+func init() {
+	modelsResolveCmd.Flags().String("format", "text", "Output format: text or json")
+	modelsCmd.AddCommand(modelsResolveCmd)
+	modelsResolveCmd.SetUsageFunc(modelsResolveUsage)
+}
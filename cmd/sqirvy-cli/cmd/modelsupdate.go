@@ -0,0 +1,224 @@
+// Package cmd implements the models update command, which downloads a model
+// manifest, a model registry file signed with Ed25519, into the config directory. The manifest is loaded over the built-in models and
+// under the user's models.yaml, so new models, context windows and prices arrive
+// between releases without overwriting local changes.
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	sqirvy "github.com/dmh2000/sqirvy-cli/pkg/sqirvy"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// defaultManifestURL is where the project publishes its model manifest. Its
+// signature is at the same URL with .sig appended. No signed manifest is published
+// there yet: the manifest is not signed until the maintainer creates the key.
+const defaultManifestURL = "https://raw.githubusercontent.com/dmh2000/sqirvy-cli/main/cmd/models-manifest.yaml"
+
+// manifestPublicKey is the base64 Ed25519 public key of the project that signs the
+// manifest. It is not in the source: once the maintainer commits it as
+// cmd/models-manifest.pub, the Makefile sets it with
+//
+//	go build -ldflags "-X github.com/dmh2000/sqirvy-cli/cmd/sqirvy-cli/cmd.manifestPublicKey=..."
+//
+// Until then it is empty and only manifests at models_update.url, signed with
+// models_update.public_key, can be downloaded.
+var manifestPublicKey = ""
+
+// manifestFileName is the name of the downloaded manifest in the config directory.
+const manifestFileName = "models-manifest.yaml"
+
+// maxManifestBytes limits the size of a downloaded manifest or signature.
+const maxManifestBytes = 1 << 20
+
+// modelsUpdateCmd downloads and verifies the model manifest.
+var modelsUpdateCmd = &cobra.Command{
+	Use:   "update",
+	Short: "Download a signed model manifest into the config directory",
+	Long: `sqirvy-cli models update downloads a signed model manifest, verifies its
+Ed25519 signature and saves it as models-manifest.yaml in the config directory.
+The manifest adds new models and updates the context windows, limits and prices of
+the built-in models between releases. It is loaded before models.yaml, so local
+changes in models.yaml win.
+
+The project does not publish a signed manifest yet, so the command needs
+models_update.url, or --url, and models_update.public_key: a manifest in the
+layout of cmd/models-manifest.yaml, signed with your own Ed25519 key.`,
+	Args:              cobra.NoArgs,
+	ValidArgsFunction: cobra.NoFileCompletions,
+	Run: func(cmd *cobra.Command, args []string) {
+		url, _ := cmd.Flags().GetString("url")
+		summary, err := executeModelsUpdate(url)
+		if err != nil {
+			log.Fatalf("Error executing models update command: %v", err)
+		}
+		fmt.Println(summary)
+	},
+}
+
+// executeModelsUpdate downloads the manifest at url, or the configured or project
+// manifest, verifies it and saves it in the config directory. It returns a summary
+// of the update.
+func executeModelsUpdate(url string) (string, error) {
+	key := manifestPublicKey
+	if url == "" {
+		url = viper.GetString("models_update.url")
+	}
+	if url == "" {
+		url = defaultManifestURL
+	}
+	if url == defaultManifestURL && key == "" {
+		return "", fmt.Errorf("error: the project does not publish a signed model manifest yet: set models_update.url and models_update.public_key to a manifest signed with your own key")
+	}
+	if url != defaultManifestURL {
+		key = viper.GetString("models_update.public_key")
+		if key == "" {
+			return "", fmt.Errorf("error: %s is not the project manifest: set models_update.public_key to the key that signs it", url)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), sqirvy.RequestTimeout)
+	defer cancel()
+	data, err := download(ctx, url)
+	if err != nil {
+		return "", fmt.Errorf("error: downloading manifest: %w", err)
+	}
+	sig, err := download(ctx, url+".sig")
+	if err != nil {
+		return "", fmt.Errorf("error: downloading manifest signature: %w", err)
+	}
+	if err := verifyManifest(data, sig, key); err != nil {
+		return "", err
+	}
+	manifest, err := decodeModelsFile(data)
+	if err != nil {
+		return "", fmt.Errorf("error: manifest %s: %w", url, err)
+	}
+	for model, entry := range manifest.Models {
+		if entry.Provider != nil && !slices.Contains(sqirvy.GetProviderList(), *entry.Provider) {
+			return "", fmt.Errorf("error: manifest %s: model %s has unknown provider %q", url, model, *entry.Provider)
+		}
+	}
+
+	path, err := manifestFile()
+	if err != nil {
+		return "", err
+	}
+	if err := writeFileAtomic(path, data); err != nil {
+		return "", fmt.Errorf("error: saving manifest: %w", err)
+	}
+
+	var added []string
+	for model := range manifest.Models {
+		if _, err := sqirvy.GetModelInfo(model); err != nil {
+			added = append(added, model)
+		}
+	}
+	slices.Sort(added)
+	summary := fmt.Sprintf("Saved %d models and %d aliases from %s to %s", len(manifest.Models), len(manifest.Aliases), url, path)
+	if len(added) > 0 {
+		summary += "\nNew models: " + strings.Join(added, ", ")
+	}
+	return summary, nil
+}
+
+// download returns the body of a GET request to url.
+func download(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent())
+	resp, err := sqirvy.HTTPClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxManifestBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxManifestBytes {
+		return nil, fmt.Errorf("%s: exceeds limit of %d bytes", url, maxManifestBytes)
+	}
+	return data, nil
+}
+
+// verifyManifest checks the base64 Ed25519 signature of the manifest with the
+// base64 public key.
+func verifyManifest(data, sig []byte, key string) error {
+	publicKey, err := base64.StdEncoding.DecodeString(strings.TrimSpace(key))
+	if err != nil || len(publicKey) != ed25519.PublicKeySize {
+		return fmt.Errorf("error: invalid manifest public key: want %d base64 bytes", ed25519.PublicKeySize)
+	}
+	signature, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(sig)))
+	if err != nil {
+		return fmt.Errorf("error: invalid manifest signature: %w", err)
+	}
+	if !ed25519.Verify(publicKey, data, signature) {
+		return fmt.Errorf("error: the manifest signature does not match, it was not saved")
+	}
+	return nil
+}
+
+// manifestFile returns the path of the downloaded manifest in the config directory.
+func manifestFile() (string, error) {
+	path, err := defaultModelsFile()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(path), manifestFileName), nil
+}
+
+// writeFileAtomic writes data to path through a temporary file in the same
+// directory, so that a failed write leaves the old file intact.
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// modelsUpdateUsage prints the usage instructions for the models update command.
+func modelsUpdateUsage(cmd *cobra.Command) error {
+	fmt.Println("Usage: sqirvy-cli models update [--url manifest-url]")
+	fmt.Println("\nFlags:")
+	cmd.Flags().PrintDefaults()
+	return nil
+}
+
+// init registers the models update command.
+func init() {
+	modelsUpdateCmd.Flags().String("url", "", "URL of the manifest, signed with models_update.public_key (default models_update.url)")
+	modelsCmd.AddCommand(modelsUpdateCmd)
+	modelsUpdateCmd.SetUsageFunc(modelsUpdateUsage)
+}
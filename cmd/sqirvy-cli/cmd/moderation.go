@@ -0,0 +1,119 @@
+// Package cmd implements content moderation of the prompts and responses of
+// every query. The moderation section of the config file selects the OpenAI
+// moderation API or local rules, regular expressions of harmful content, and
+// whether flagged content only warns or blocks the query.
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strings"
+
+	sqirvy "github.com/dmh2000/sqirvy-cli/pkg/sqirvy"
+
+	"github.com/spf13/viper"
+)
+
+// Moderation providers and actions
+const (
+	moderationOpenAI = "openai" // the OpenAI moderation API
+	moderationLocal  = "local"  // the rules of the config file
+
+	moderationWarn  = "warn"
+	moderationBlock = "block"
+)
+
+// moderationFilter is the query filter that moderates prompts and responses.
+type moderationFilter struct {
+	provider string
+	action   string
+	rules    map[string]*regexp.Regexp // local rules by category
+}
+
+// configModeration returns the moderation filter of the config file, or nil if
+// moderation.provider is not set.
+func configModeration() (*moderationFilter, error) {
+	f := &moderationFilter{
+		provider: viper.GetString("moderation.provider"),
+		action:   viper.GetString("moderation.action"),
+	}
+	switch f.provider {
+	case "":
+		return nil, nil
+	case moderationOpenAI, moderationLocal:
+	default:
+		return nil, fmt.Errorf("error: unknown moderation provider %q (use openai or local)", f.provider)
+	}
+	switch f.action {
+	case "":
+		f.action = moderationBlock
+	case moderationWarn, moderationBlock:
+	default:
+		return nil, fmt.Errorf("error: unknown moderation action %q (use warn or block)", f.action)
+	}
+
+	rules := viper.GetStringMapString("moderation.rules")
+	if f.provider == moderationLocal && len(rules) == 0 {
+		return nil, fmt.Errorf("error: moderation provider local needs moderation.rules")
+	}
+	f.rules = make(map[string]*regexp.Regexp, len(rules))
+	for category, pattern := range rules {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("error: moderation rule %s: %w", category, err)
+		}
+		f.rules[category] = re
+	}
+	return f, nil
+}
+
+// filterPrompt moderates the prompt before it is sent.
+func (f *moderationFilter) filterPrompt(ctx context.Context, text, model string) (string, error) {
+	return text, f.check(ctx, "prompt", text)
+}
+
+// filterResponse moderates the response of the model.
+func (f *moderationFilter) filterResponse(ctx context.Context, text, model string) (string, error) {
+	return text, f.check(ctx, "response", text)
+}
+
+// check moderates a text and warns about it or blocks it if it is flagged. A
+// failure of the moderation API blocks the query, so content is never let
+// through unchecked.
+func (f *moderationFilter) check(ctx context.Context, what, text string) error {
+	categories, err := f.moderate(ctx, text)
+	if err != nil {
+		return fmt.Errorf("error: moderating the %s: %w", what, err)
+	}
+	if len(categories) == 0 {
+		return nil
+	}
+	flagged := strings.Join(categories, ", ")
+	if f.action == moderationWarn {
+		slog.Warn("Moderation flagged the "+what, "categories", flagged)
+		return nil
+	}
+	return fmt.Errorf("error: moderation flagged the %s: %s", what, flagged)
+}
+
+// moderate returns the flagged categories of a text, sorted.
+func (f *moderationFilter) moderate(ctx context.Context, text string) ([]string, error) {
+	if f.provider == moderationOpenAI {
+		result, err := sqirvy.Moderate(ctx, text)
+		if err != nil {
+			return nil, err
+		}
+		return result.Categories, nil
+	}
+	var categories []string
+	for category, re := range f.rules {
+		if re.MatchString(text) {
+			categories = append(categories, category)
+		}
+	}
+	sort.Strings(categories)
+	return categories, nil
+}
@@ -0,0 +1,117 @@
+// Package cmd implements desktop notifications. With --notify, or notify.enabled
+// in the config file, the query, plan, code, review and batch commands show a
+// desktop notification when they finish, with the outcome, the duration and the
+// cost, so a long run can be left in a background terminal.
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	sqirvy "github.com/dmh2000/sqirvy-cli/pkg/sqirvy"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// notifyEnabled reports whether the command shows a notification when it
+// finishes, from --notify or notify.enabled in the config file.
+func notifyEnabled(cmd *cobra.Command) bool {
+	if f := cmd.Flags().Lookup("notify"); f != nil && f.Changed {
+		return f.Value.String() == "true"
+	}
+	return viper.GetBool("notify.enabled")
+}
+
+// notifyingRun returns run, which also shows a notification when it finishes if
+// notifications are enabled for the command.
+func notifyingRun(cmd *cobra.Command, run func(args []string) (string, error)) func(args []string) (string, error) {
+	if !notifyEnabled(cmd) {
+		return run
+	}
+	return func(args []string) (string, error) {
+		start := time.Now()
+		spent := sqirvy.RunSpend()
+		response, err := run(args)
+		notifyDone(cmd.Name(), start, spent, "", err)
+		return response, err
+	}
+}
+
+// notifyDone shows the notification of a command started at start, when the run
+// spend was spent, with an optional summary of the result. Runs shorter than
+// notify.min_duration are not notified.
+func notifyDone(name string, start time.Time, spent float64, summary string, err error) {
+	elapsed := time.Since(start)
+	if elapsed < viper.GetDuration("notify.min_duration") {
+		return
+	}
+	title := "sqirvy-cli " + name + " finished"
+	if err != nil {
+		title = "sqirvy-cli " + name + " failed"
+	}
+	var parts []string
+	if summary != "" {
+		parts = append(parts, summary)
+	}
+	parts = append(parts, elapsed.Round(time.Second).String())
+	if cost := sqirvy.RunSpend() - spent; cost > 0 {
+		parts = append(parts, fmt.Sprintf("$%.4f", cost))
+	}
+	message := strings.Join(parts, ", ")
+	if err != nil {
+		message += "\n" + err.Error()
+	}
+	if err := notify(title, message); err != nil {
+		slog.Warn("Desktop notification failed", "error", err)
+	}
+}
+
+// notify shows a desktop notification with notify.command from the config file,
+// with the title and message appended, or with notify-send on Linux, osascript on
+// macOS and PowerShell on Windows. The command is not waited for.
+func notify(title, message string) error {
+	c := notifyCommand(title, message)
+	if c == nil {
+		return fmt.Errorf("no notification command found, set notify.command")
+	}
+	if err := c.Start(); err != nil {
+		return err
+	}
+	go c.Wait()
+	return nil
+}
+
+// notifyCommand returns the command that shows a notification, or nil if there
+// is none on the platform.
+func notifyCommand(title, message string) *exec.Cmd {
+	if command := strings.Fields(viper.GetString("notify.command")); len(command) > 0 {
+		return exec.Command(command[0], append(command[1:], title, message)...)
+	}
+	var args []string
+	switch runtime.GOOS {
+	case "darwin":
+		args = []string{"osascript", "-e", "on run argv", "-e", "display notification (item 2 of argv) with title (item 1 of argv)", "-e", "end run"}
+	case "windows":
+		args = []string{"powershell", "-NoProfile", "-Command", "Add-Type -AssemblyName System.Windows.Forms; " +
+			"$n = New-Object System.Windows.Forms.NotifyIcon; $n.Icon = [System.Drawing.SystemIcons]::Information; " +
+			"$n.Visible = $true; $n.ShowBalloonTip(10000, $args[0], $args[1], 'Info'); Start-Sleep -Seconds 10; $n.Dispose()"}
+	default:
+		args = []string{"notify-send", "--app-name=sqirvy-cli"}
+	}
+	if _, err := exec.LookPath(args[0]); err != nil {
+		return nil
+	}
+	return exec.Command(args[0], append(args[1:], title, message)...)
+}
+
+// init adds the --notify flag to the commands that can notify when they finish.
+func init() {
+	for _, c := range []*cobra.Command{queryCmd, planCmd, codeCmd, reviewCmd, batchCmd} {
+		c.Flags().Bool("notify", false, "Show a desktop notification with the outcome, duration and cost when the command finishes")
+	}
+}
@@ -0,0 +1,159 @@
+// Package cmd implements the directories of the files of sqirvy-cli. The config
+// directory holds config.yaml, models.yaml, the downloaded model manifest and the
+// prompt library; the data directory holds the spending ledger and the audit log;
+// the cache directory holds provider health and the responses of git hooks. Each
+// follows the conventions of the platform:
+//
+//	          config                          data                              cache
+//	Linux     $XDG_CONFIG_HOME or ~/.config   $XDG_DATA_HOME or ~/.local/share  $XDG_CACHE_HOME or ~/.cache
+//	macOS     ~/Library/Application Support   ~/Library/Application Support     ~/Library/Caches
+//	Windows   %APPDATA%                       %APPDATA%                         %LOCALAPPDATA%
+//
+// with a sqirvy-cli directory in each. XDG_CONFIG_HOME and XDG_DATA_HOME are also
+// used on macOS when they are set. The config file of earlier versions, which kept
+// it in ~/.config/sqirvy-cli, is moved to the config directory on the first run,
+// unless the config file is given explicitly.
+package cmd
+
+import (
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+)
+
+// appDirName is the name of the sqirvy-cli directory in the config, data and cache
+// directories.
+const appDirName = "sqirvy-cli"
+
+// configDir returns the directory of the config file, the model registry files and
+// the prompt library.
+func configDir() (string, error) {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" && runtime.GOOS != "windows" && filepath.IsAbs(dir) {
+		return filepath.Join(dir, appDirName), nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, appDirName), nil
+}
+
+// dataDir returns the directory of the spending ledger and the audit log.
+func dataDir() (string, error) {
+	switch runtime.GOOS {
+	case "windows":
+		// %APPDATA% holds data as well as config
+	case "darwin":
+		if dir := os.Getenv("XDG_DATA_HOME"); dir != "" && filepath.IsAbs(dir) {
+			return filepath.Join(dir, appDirName), nil
+		}
+		// so does ~/Library/Application Support
+	default:
+		if dir := os.Getenv("XDG_DATA_HOME"); dir != "" && filepath.IsAbs(dir) {
+			return filepath.Join(dir, appDirName), nil
+		}
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(home, ".local", "share", appDirName), nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, appDirName), nil
+}
+
+// cacheDir returns the directory of files that may be deleted at any time.
+func cacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, appDirName), nil
+}
+
+// legacyDir returns ~/.config/sqirvy-cli, where earlier versions kept all files.
+func legacyDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".config", appDirName), nil
+}
+
+// configFileIn returns the path of a file in the config directory.
+func configFileIn(name string) (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name), nil
+}
+
+// dataFileIn returns the path of a file in the data directory, or "" if there is
+// no data directory.
+func dataFileIn(name string) string {
+	dir, err := dataDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, name)
+}
+
+// migrateOnce moves the config file of earlier versions once per run.
+var migrateOnce sync.Once
+
+// migrateLegacyFiles moves the config file of earlier versions once per run,
+// unless the config file is given with --config or SQIRVY_CONFIG: then the user
+// chose where it is.
+func migrateLegacyFiles() {
+	migrateOnce.Do(func() {
+		if cfgFile == "" {
+			moveLegacyFiles()
+		}
+	})
+}
+
+// moveLegacyFiles moves the config.yaml that earlier versions kept in
+// ~/.config/sqirvy-cli to the config directory of the platform, if there is none
+// there. A file that cannot be moved is left in place with a warning; the config
+// file is still found there.
+func moveLegacyFiles() {
+	legacy, err := legacyDir()
+	if err != nil {
+		return
+	}
+	config, err := configDir()
+	if err != nil || config == legacy {
+		return
+	}
+	from, to := filepath.Join(legacy, "config.yaml"), filepath.Join(config, "config.yaml")
+	if err := migrateFile(from, to); err != nil {
+		slog.Warn("Could not move the config file of an earlier version, move it by hand", "from", from, "to", to, "error", err)
+	}
+}
+
+// migrateFile moves the file from to the path to, if from exists and to does not.
+func migrateFile(from, to string) error {
+	if _, err := os.Lstat(from); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if _, err := os.Lstat(to); err == nil {
+		slog.Debug("Not moving the config file of an earlier version, the new file exists", "from", from, "to", to)
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(to), 0o755); err != nil {
+		return err
+	}
+	if err := os.Rename(from, to); err != nil {
+		return err
+	}
+	slog.Warn("Moved the config file of an earlier version", "from", from, "to", to)
+	return nil
+}
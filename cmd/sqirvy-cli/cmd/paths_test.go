@@ -0,0 +1,137 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// legacyHome returns a temporary home directory with the XDG directories set and
+// the given files of an earlier version in ~/.config/sqirvy-cli, and the config
+// and data directories of sqirvy-cli.
+func legacyHome(t *testing.T, files []string) (legacy, config, data string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the XDG directories are not used on Windows")
+	}
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, "xdg-config"))
+	t.Setenv("XDG_DATA_HOME", filepath.Join(home, "xdg-data"))
+	legacy = filepath.Join(home, ".config", appDirName)
+	for _, file := range files {
+		path := filepath.Join(legacy, file)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(file), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return legacy, filepath.Join(home, "xdg-config", appDirName), filepath.Join(home, "xdg-data", appDirName)
+}
+
+func TestPlatformDirs(t *testing.T) {
+	_, config, data := legacyHome(t, nil)
+
+	tests := []struct {
+		name string
+		dir  func() (string, error)
+		want string
+	}{
+		{name: "config", dir: configDir, want: config},
+		{name: "data", dir: dataDir, want: data},
+		{name: "config file", dir: func() (string, error) { return configFileIn("config.yaml") }, want: filepath.Join(config, "config.yaml")},
+		{name: "data file", dir: func() (string, error) { return dataFileIn("ledger.json"), nil }, want: filepath.Join(data, "ledger.json")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.dir()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoveLegacyFiles(t *testing.T) {
+	// only the config file is moved; the other files of earlier versions stay
+	files := []string{"config.yaml", "models.yaml", "ledger.json", "prompts/review.md"}
+
+	tests := []struct {
+		name     string
+		existing bool // a config file exists in the config directory
+	}{
+		{name: "config file moved"},
+		{name: "new config file exists", existing: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			legacy, config, data := legacyHome(t, files)
+			if tt.existing {
+				if err := os.MkdirAll(config, 0o755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(filepath.Join(config, "config.yaml"), []byte("new"), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			moveLegacyFiles()
+
+			want := "config.yaml"
+			if tt.existing {
+				want = "new"
+			}
+			got, err := os.ReadFile(filepath.Join(config, "config.yaml"))
+			if err != nil || string(got) != want {
+				t.Errorf("config.yaml in the config directory = %q, %v, want %q", got, err, want)
+			}
+			for _, file := range files {
+				_, err := os.Stat(filepath.Join(legacy, file))
+				if stays, want := err == nil, file != "config.yaml" || tt.existing; stays != want {
+					t.Errorf("%s left in the legacy directory = %v, want %v", file, stays, want)
+				}
+			}
+			if _, err := os.Stat(data); err == nil {
+				t.Errorf("data directory %s was created", data)
+			}
+
+			// the config directory is created like any other, 0o755 less the umask
+			reference := filepath.Join(t.TempDir(), "reference")
+			if err := os.Mkdir(reference, 0o755); err != nil {
+				t.Fatal(err)
+			}
+			ref, _ := os.Stat(reference)
+			info, err := os.Stat(config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Mode().Perm() != ref.Mode().Perm() {
+				t.Errorf("mode of %s = %v, want %v", config, info.Mode().Perm(), ref.Mode().Perm())
+			}
+		})
+	}
+}
+
+func TestMigrateLegacyFilesExplicitConfig(t *testing.T) {
+	legacy, config, _ := legacyHome(t, []string{"config.yaml", "ledger.json"})
+	saved := cfgFile
+	defer func() { cfgFile = saved }()
+
+	// a config file given with --config keeps the files where they are
+	cfgFile = filepath.Join(legacy, "config.yaml")
+	migrateLegacyFiles()
+	for _, file := range []string{"config.yaml", "ledger.json"} {
+		if _, err := os.Stat(filepath.Join(legacy, file)); err != nil {
+			t.Errorf("%s was moved: %v", file, err)
+		}
+	}
+	if _, err := os.Stat(config); err == nil {
+		t.Errorf("config directory %s was created", config)
+	}
+}
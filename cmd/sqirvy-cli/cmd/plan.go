@@ -5,10 +5,8 @@ package cmd
 
 import (
 	"fmt"
-	"log"
 
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 // planCmd represents the command to request a plan generation from the LLM.
@@ -29,23 +27,20 @@ The prompt is constructed in this order:
 	Any number of filename or url arguments	`,
 	Run: func(cmd *cobra.Command, args []string) {
 		// get arg/config params
-		model := viper.GetString("model")
-		temperature := viper.GetFloat64("temperature")
+		model := commandModel(cmd)
+		temperature := commandTemperature(cmd)
 
-		// Execute the query using the specific planning prompt
-		response, err := executeQuery(model, temperature, planPrompt, args)
-		if err != nil {
-			log.Fatalf("Error executing plan command: %v", err)
-		}
-		// Print the LLM response to standard output
-		fmt.Print(response)
-		fmt.Println() // Ensure a newline at the end
+		// Execute the query using the specific planning prompt, running it again on
+		// changes with --watch
+		runOrWatch(cmd, args, func(args []string) (string, error) {
+			return executeQuery(model, temperature, planPrompt, args)
+		})
 	},
 }
 
 // planUsage prints the usage instructions for the plan command.
 func planUsage(cmd *cobra.Command) error {
-	fmt.Println("Usage: stdin | sqirvy-cli plan [flags] [files| urls]")
+	fmt.Println("Usage: [stdin |] sqirvy-cli plan [flags] [-p prompt] [files| urls]")
 	fmt.Println("\nFlags:")
 	cmd.Flags().PrintDefaults()
 	return nil
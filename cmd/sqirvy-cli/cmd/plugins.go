@@ -0,0 +1,127 @@
+// Package cmd implements external subcommand plugins. Like git, an unknown
+// subcommand foo runs the executable sqirvy-cli-foo from the PATH with the rest
+// of the arguments, so third parties can ship their own commands. The global
+// flags given before the subcommand are passed to the plugin as SQIRVY_*
+// environment variables, next to the env section of the config file, so the
+// plugin and the sqirvy-cli commands it runs share the sqirvy configuration.
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// pluginPrefix is the prefix of the executables of plugins.
+const pluginPrefix = "sqirvy-cli-"
+
+// pluginCommand returns the subcommand of the arguments if it is not a command of
+// sqirvy-cli, with the global flags before it and the arguments after it.
+func pluginCommand(args []string) (name string, flags, rest []string, ok bool) {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" || arg == "-" {
+			return "", nil, nil, false
+		}
+		if strings.HasPrefix(arg, "-") {
+			if flagTakesValue(arg) {
+				i++
+			}
+			continue
+		}
+		if isCommand(arg) || strings.ContainsAny(arg, `/\.`) {
+			return "", nil, nil, false
+		}
+		return arg, args[:i], args[i+1:], true
+	}
+	return "", nil, nil, false
+}
+
+// flagTakesValue reports whether a global flag argument without an = is followed
+// by its value, e.g. --model gpt-4o or -m gpt-4o.
+func flagTakesValue(arg string) bool {
+	if strings.Contains(arg, "=") {
+		return false
+	}
+	var f *pflag.Flag
+	if name, ok := strings.CutPrefix(arg, "--"); ok {
+		f = rootCmd.PersistentFlags().Lookup(name)
+	} else if len(arg) == 2 {
+		f = rootCmd.PersistentFlags().ShorthandLookup(arg[1:])
+	}
+	return f != nil && f.NoOptDefVal == ""
+}
+
+// isCommand reports whether name is a command of sqirvy-cli, including the help
+// and completion commands that cobra adds when it runs.
+func isCommand(name string) bool {
+	for _, c := range rootCmd.Commands() {
+		if c.Name() == name || c.HasAlias(name) {
+			return true
+		}
+	}
+	return name == "help" || name == "completion" || strings.HasPrefix(name, "__")
+}
+
+// pluginEnv returns the environment of a plugin: the environment of sqirvy-cli,
+// which includes the env section of the config file, the global flags that were
+// set as SQIRVY_* variables, the config file in SQIRVY_CONFIG and the sqirvy-cli
+// executable in SQIRVY_BIN.
+func pluginEnv(flags *pflag.FlagSet) []string {
+	env := os.Environ()
+	flags.Visit(func(f *pflag.Flag) {
+		value := f.Value.String()
+		if s, ok := f.Value.(pflag.SliceValue); ok {
+			value = strings.Join(s.GetSlice(), ",")
+		}
+		env = append(env, envVarName(f.Name)+"="+value)
+	})
+	if path := viper.ConfigFileUsed(); path != "" {
+		env = append(env, envVarName("config")+"="+path)
+	}
+	if path, err := os.Executable(); err == nil {
+		env = append(env, envVarName("bin")+"="+path)
+	}
+	return env
+}
+
+// runPlugin runs the plugin of an unknown subcommand in the arguments, if there is
+// one on the PATH, and returns its exit code. ok is false if the arguments do not
+// name a plugin, so they are handled as a sqirvy-cli command.
+func runPlugin(args []string) (code int, ok bool) {
+	name, flags, rest, ok := pluginCommand(args)
+	if !ok {
+		return 0, false
+	}
+	path, err := exec.LookPath(pluginPrefix + name)
+	if err != nil {
+		return 0, false
+	}
+
+	// load the config file as the commands do, with the global flags
+	if err := rootCmd.PersistentFlags().Parse(flags); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1, true
+	}
+	initConfig()
+
+	c := exec.Command(path, rest...)
+	c.Env = pluginEnv(rootCmd.PersistentFlags())
+	c.Stdin = os.Stdin
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	if err := c.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() > 0 {
+			return exitErr.ExitCode(), true
+		}
+		fmt.Fprintf(os.Stderr, "Error executing plugin %s: %v\n", path, err)
+		return 1, true
+	}
+	return 0, true
+}
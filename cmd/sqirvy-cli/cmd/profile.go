@@ -0,0 +1,68 @@
+// Package cmd implements named configuration profiles. A profile bundles settings
+// such as the default model and temperature with the environment variables that
+// hold API keys and base URLs, so a single config file can hold several isolated
+// configurations.
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// selectedProfile returns the name of the profile given with --profile or
+// SQIRVY_PROFILE, or "" if none.
+func selectedProfile() string {
+	return viper.GetString("profile")
+}
+
+// applyProfile merges the settings of the named profile over the config file and
+// exports its environment variables. Flags still take precedence over profile settings.
+// Environment variables set by the profile replace any inherited values, so that
+// credentials from one profile never leak into another.
+func applyProfile(name string) error {
+	key := "profiles." + name
+	if !viper.IsSet(key) {
+		return fmt.Errorf("error: profile %q not found in config file (available: %s)", name, strings.Join(profileNames(), ", "))
+	}
+
+	settings := viper.GetStringMap(key)
+	if err := exportEnv(viper.GetStringMapString(key+".env"), true); err != nil {
+		return fmt.Errorf("error: profile %s: %w", name, err)
+	}
+	delete(settings, "env")
+
+	if err := viper.MergeConfigMap(settings); err != nil {
+		return fmt.Errorf("error: profile %s: %w", name, err)
+	}
+	return nil
+}
+
+// exportEnv sets the environment variables in env, which come from an env section
+// of the config file. Variables that are already set are only replaced if override is set.
+func exportEnv(env map[string]string, override bool) error {
+	for name, value := range env {
+		// viper lowercases keys, environment variable names are upper case by convention
+		name = strings.ToUpper(name)
+		if _, ok := os.LookupEnv(name); ok && !override {
+			continue
+		}
+		if err := os.Setenv(name, value); err != nil {
+			return fmt.Errorf("setting %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// profileNames returns the names of the profiles in the config file, sorted.
+func profileNames() []string {
+	var names []string
+	for name := range viper.GetStringMap("profiles") {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,392 @@
+/*
+Copyright © 2025 David Howard  dmh2000@gmail.com
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	sqirvy "github.com/dmh2000/sqirvy-cli/pkg/sqirvy"
+	util "github.com/dmh2000/sqirvy-cli/pkg/util"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// promptFileExt is the extension of the files in the prompt library.
+const promptFileExt = ".md"
+
+// Roles of a library prompt selected by --prompt-as.
+const (
+	promptAsSystem = "system" // added to the system prompt of the command
+	promptAsUser   = "user"   // sent as the first user prompt
+)
+
+// promptSettings are the settings in the frontmatter of a library prompt. They
+// are the defaults of a command that uses the prompt: explicit flags win.
+type promptSettings struct {
+	Model       string   `yaml:"model"`       // model of the command
+	Temperature *float64 `yaml:"temperature"` // temperature of the command
+	MaxTokens   int64    `yaml:"max_tokens"`  // response limit, capped at the model limit
+	Format      string   `yaml:"format"`      // --format of review and changelog, or csv or json for extract
+}
+
+// libraryPrompt is a prompt from the library, split into its settings and its text.
+type libraryPrompt struct {
+	Settings promptSettings
+	Text     string
+}
+
+// promptNamePattern restricts prompt names to names that are safe file names.
+var promptNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// promptCmd groups the subcommands that manage the prompt library.
+var promptCmd = &cobra.Command{
+	Use:   "prompt",
+	Short: "Manage the library of named prompts",
+	Long: `sqirvy-cli prompt manages a library of named prompts in the prompts directory
+of the config directory, e.g. $HOME/.config/sqirvy-cli/prompts.
+	add     add a prompt from a file or stdin
+	list    list the prompts
+	show    print a prompt
+	rm      remove a prompt
+--prompt NAME uses a prompt from the library with the query, plan, code, review,
+scaffold, extract, batch and changelog commands: added to the system prompt of
+the command, or with --prompt-as user sent as the first user prompt.
+A prompt can start with YAML frontmatter that sets the defaults of the command
+when the prompt is used; explicit flags win:
+	---
+	model: gpt-4o
+	temperature: 0
+	max_tokens: 2048
+	format: json
+	---
+	Extract every invoice in the input.
+`,
+}
+
+var promptAddCmd = &cobra.Command{
+	Use:   "add name [file]",
+	Short: "Add a prompt to the library from a file or stdin",
+	Args:  cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		force, _ := cmd.Flags().GetBool("force")
+		var text string
+		if len(args) == 2 {
+			data, _, err := util.ReadFile(args[1], MaxInputTotalBytes)
+			if err != nil {
+				log.Fatalf("Error executing prompt add command: %v", err)
+			}
+			text = string(data)
+		} else {
+			// read stdin as is: util.ReadStdin wraps it in a code fence
+			data, err := io.ReadAll(io.LimitReader(os.Stdin, MaxInputTotalBytes+1))
+			if err != nil {
+				log.Fatalf("Error executing prompt add command: error: reading stdin: %v", err)
+			}
+			if len(data) > MaxInputTotalBytes {
+				log.Fatalf("Error executing prompt add command: error: prompt exceeds limit of %d bytes", MaxInputTotalBytes)
+			}
+			text = string(data)
+		}
+		path, err := addLibraryPrompt(args[0], text, force)
+		if err != nil {
+			log.Fatalf("Error executing prompt add command: %v", err)
+		}
+		fmt.Println(path)
+	},
+}
+
+var promptListCmd = &cobra.Command{
+	Use:               "list",
+	Short:             "List the prompts in the library",
+	Args:              cobra.NoArgs,
+	ValidArgsFunction: cobra.NoFileCompletions,
+	Run: func(cmd *cobra.Command, args []string) {
+		names, err := libraryPromptNames()
+		if err != nil {
+			log.Fatalf("Error executing prompt list command: %v", err)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, name := range names {
+			prompt, err := readLibraryPrompt(name)
+			if err != nil {
+				log.Fatalf("Error executing prompt list command: %v", err)
+			}
+			fmt.Fprintf(w, "%s\t%s\n", name, firstPromptLine(prompt.Text))
+		}
+		w.Flush()
+	},
+}
+
+var promptShowCmd = &cobra.Command{
+	Use:   "show name",
+	Short: "Print a prompt from the library",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		text, err := loadLibraryPrompt(args[0])
+		if err != nil {
+			log.Fatalf("Error executing prompt show command: %v", err)
+		}
+		fmt.Print(text)
+		if !strings.HasSuffix(text, "\n") {
+			fmt.Println()
+		}
+	},
+}
+
+var promptRmCmd = &cobra.Command{
+	Use:   "rm name",
+	Short: "Remove a prompt from the library",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		path, err := libraryPromptPath(args[0])
+		if err != nil {
+			log.Fatalf("Error executing prompt rm command: %v", err)
+		}
+		if err := os.Remove(path); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				log.Fatalf("Error executing prompt rm command: prompt %s does not exist", args[0])
+			}
+			log.Fatalf("Error executing prompt rm command: %v", err)
+		}
+	},
+}
+
+// promptsDir returns the directory of the prompt library.
+func promptsDir() (string, error) {
+	return configFileIn("prompts")
+}
+
+// libraryPromptPath returns the file of a named prompt.
+func libraryPromptPath(name string) (string, error) {
+	if !promptNamePattern.MatchString(name) {
+		return "", fmt.Errorf("error: invalid prompt name %q: use letters, digits, dots, dashes and underscores", name)
+	}
+	dir, err := promptsDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name+promptFileExt), nil
+}
+
+// addLibraryPrompt writes a named prompt to the library and returns its file.
+// An existing prompt is only replaced if force is set.
+func addLibraryPrompt(name, text string, force bool) (string, error) {
+	path, err := libraryPromptPath(name)
+	if err != nil {
+		return "", err
+	}
+	prompt, err := parseLibraryPrompt(name, text)
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(prompt.Text) == "" {
+		return "", fmt.Errorf("error: prompt %s is empty", name)
+	}
+	if _, err := os.Stat(path); err == nil && !force {
+		return "", fmt.Errorf("error: prompt %s exists (use --force to replace it)", name)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", fmt.Errorf("error: creating prompts directory: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+		return "", fmt.Errorf("error: writing prompt: %w", err)
+	}
+	return path, nil
+}
+
+// loadLibraryPrompt returns the text of a named prompt.
+func loadLibraryPrompt(name string) (string, error) {
+	path, err := libraryPromptPath(name)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", fmt.Errorf("error: prompt %s does not exist (see sqirvy-cli prompt list)", name)
+		}
+		return "", fmt.Errorf("error: reading prompt %s: %w", name, err)
+	}
+	return string(data), nil
+}
+
+// readLibraryPrompt returns a named prompt with its frontmatter parsed.
+func readLibraryPrompt(name string) (libraryPrompt, error) {
+	text, err := loadLibraryPrompt(name)
+	if err != nil {
+		return libraryPrompt{}, err
+	}
+	return parseLibraryPrompt(name, text)
+}
+
+// parseLibraryPrompt splits the text of a prompt into its frontmatter settings
+// and its text. Unknown settings are an error, so that a typo is not ignored.
+func parseLibraryPrompt(name, text string) (libraryPrompt, error) {
+	front, body, ok := util.SplitFrontmatter(text)
+	prompt := libraryPrompt{Text: body}
+	if !ok || strings.TrimSpace(front) == "" {
+		return prompt, nil
+	}
+	dec := yaml.NewDecoder(strings.NewReader(front))
+	dec.KnownFields(true)
+	if err := dec.Decode(&prompt.Settings); err != nil {
+		return libraryPrompt{}, fmt.Errorf("error: prompt %s frontmatter: %w", name, err)
+	}
+	if prompt.Settings.MaxTokens < 0 {
+		return libraryPrompt{}, fmt.Errorf("error: prompt %s frontmatter: max_tokens must not be negative", name)
+	}
+	return prompt, nil
+}
+
+// libraryPromptNames returns the names of the prompts in the library, sorted.
+func libraryPromptNames() ([]string, error) {
+	dir, err := promptsDir()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error: reading prompts directory: %w", err)
+	}
+	var names []string
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), promptFileExt)
+		if ok && !e.IsDir() && promptNamePattern.MatchString(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// firstPromptLine returns the first non-empty line of a prompt, shortened for listings.
+func firstPromptLine(text string) string {
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if len(line) > 60 {
+			line = strings.ToValidUTF8(line[:60], "") + "..."
+		}
+		return line
+	}
+	return ""
+}
+
+// selectedPrompt returns the library prompt selected by --prompt, rendered as a
+// template if templating is enabled, and its role from --prompt-as. The text is
+// empty if no prompt is selected.
+func selectedPrompt() (text, role string, err error) {
+	name, _ := rootCmd.PersistentFlags().GetString("prompt")
+	role, _ = rootCmd.PersistentFlags().GetString("prompt-as")
+	if name == "" {
+		return "", role, nil
+	}
+	if role != promptAsSystem && role != promptAsUser {
+		return "", "", fmt.Errorf("error: unknown --prompt-as %q (use system or user)", role)
+	}
+	prompt, err := readLibraryPrompt(name)
+	if err != nil {
+		return "", "", err
+	}
+	text, err = renderPrompt("prompt "+name, prompt.Text)
+	return text, role, err
+}
+
+// selectedPromptSettings returns the frontmatter settings of the library prompt
+// selected by --prompt. Errors reading the prompt are reported when its text is
+// used, so they are ignored here.
+func selectedPromptSettings() promptSettings {
+	name, _ := rootCmd.PersistentFlags().GetString("prompt")
+	if name == "" {
+		return promptSettings{}
+	}
+	prompt, err := readLibraryPrompt(name)
+	if err != nil {
+		return promptSettings{}
+	}
+	return prompt.Settings
+}
+
+// commandMaxTokens returns the response limit for a query: max_tokens of the
+// --prompt prompt, if set, otherwise the limit of the model.
+func commandMaxTokens(model string) int64 {
+	if maxTokens := selectedPromptSettings().MaxTokens; maxTokens > 0 {
+		return maxTokens
+	}
+	return sqirvy.GetMaxTokens(model)
+}
+
+// commandFormat returns the output format of the command: an explicit --format
+// flag wins, then the format of the --prompt prompt, then the default of the flag.
+func commandFormat(cmd *cobra.Command) string {
+	format, _ := cmd.Flags().GetString("format")
+	if s := selectedPromptSettings(); !cmd.Flags().Changed("format") && s.Format != "" {
+		return s.Format
+	}
+	return format
+}
+
+// commandSystemPrompt returns the system prompt of a command, layered in order:
+// the built-in prompt of the command, unless --no-default-prompt, system_prompt
+// of the config file, e.g. the house style of an organization, the library prompt
+// selected by --prompt, if its role is system, and --system. Empty layers are
+// skipped.
+func commandSystemPrompt(system string) (string, error) {
+	text, role, err := selectedPrompt()
+	if err != nil {
+		return "", err
+	}
+	if role != promptAsSystem {
+		text = ""
+	}
+	if noDefault, _ := rootCmd.PersistentFlags().GetBool("no-default-prompt"); noDefault {
+		system = ""
+	}
+	flag, _ := rootCmd.PersistentFlags().GetString("system")
+
+	var layers []string
+	for _, layer := range []string{system, viper.GetString("system_prompt"), text, flag} {
+		if layer = strings.TrimSpace(layer); layer != "" {
+			layers = append(layers, layer)
+		}
+	}
+	return strings.Join(layers, "\n\n"), nil
+}
+
+// promptUsage prints the usage instructions for the prompt command.
+func promptUsage(cmd *cobra.Command) error {
+	fmt.Println("Usage: sqirvy-cli prompt add|list|show|rm [name] [file]")
+	fmt.Println("\nFlags:")
+	cmd.Flags().PrintDefaults()
+	return nil
+}
+
+// init registers the prompt command and its subcommands with the root command.
+func init() {
+	promptAddCmd.Flags().Bool("force", false, "Replace an existing prompt")
+	promptCmd.AddCommand(promptAddCmd, promptListCmd, promptShowCmd, promptRmCmd)
+	rootCmd.AddCommand(promptCmd)
+	promptCmd.SetUsageFunc(promptUsage)
+
+	rootCmd.PersistentFlags().String("prompt", "", "Named prompt from the prompt library (see sqirvy-cli prompt list)")
+	rootCmd.PersistentFlags().String("prompt-as", promptAsSystem, "Use the --prompt prompt as the system prompt (added to the command's) or as the first user prompt: system or user")
+	rootCmd.PersistentFlags().String("system", "", "Text added last to the system prompt, after the command's prompt, system_prompt of the config file and the --prompt prompt")
+	rootCmd.PersistentFlags().Bool("no-default-prompt", false, "Leave the built-in prompt of the command out of the system prompt")
+}
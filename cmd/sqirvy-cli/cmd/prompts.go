@@ -3,11 +3,25 @@
 package cmd
 
 import (
-	util "dmh2000/sqirvy-cli/pkg/util"
+	"context"
 	_ "embed"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
 	"net"
 	"net/url"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	sqirvy "github.com/dmh2000/sqirvy-cli/pkg/sqirvy"
+	util "github.com/dmh2000/sqirvy-cli/pkg/util"
+
+	"github.com/spf13/viper"
 )
 
 // queryPrompt contains the embedded content of the query.md file,
@@ -28,55 +42,248 @@ var planPrompt string
 //go:embed prompts/code.md
 var codePrompt string
 
+// scaffoldPrompt contains the embedded content of the scaffold.md file,
+// which defines the system prompt for generating a project tree from a plan.
+//
+//go:embed prompts/scaffold.md
+var scaffoldPrompt string
+
 // reviewPrompt contains the embedded content of the review.md file,
 // which defines the system prompt for code review operations.
 //
 //go:embed prompts/review.md
 var reviewPrompt string
 
+// reviewFindingsPrompt contains the embedded content of the review-findings.md file,
+// which defines the system prompt for code reviews with structured findings.
+//
+//go:embed prompts/review-findings.md
+var reviewFindingsPrompt string
+
+// changelogPrompt contains the embedded content of the changelog.md file,
+// which defines the system prompt for release notes generation.
+//
+//go:embed prompts/changelog.md
+var changelogPrompt string
+
+// commitPrompt contains the embedded content of the commit.md file,
+// which defines the system prompt for commit message generation.
+//
+//go:embed prompts/commit.md
+var commitPrompt string
+
+// extractPrompt contains the embedded content of the extract.md file,
+// which defines the system prompt for structured data extraction.
+//
+//go:embed prompts/extract.md
+var extractPrompt string
+
+// judgePrompt contains the embedded content of the judge.md file,
+// which defines the system prompt for grading responses.
+//
+//go:embed prompts/judge.md
+var judgePrompt string
+
+// mergePrompt contains the embedded content of the merge.md file,
+// which defines the system prompt for merging several samples into one response.
+//
+//go:embed prompts/merge.md
+var mergePrompt string
+
+// stdin can only be read once, so it is kept for commands that build prompts
+// more than once, e.g. in watch mode.
+var (
+	stdinOnce   sync.Once
+	cachedStdin string
+	stdinText   string        // stdin without the code fence, to detect duplicate inputs
+	stdinJSON   *stdinRequest // stdin with --stdin-format json
+	stdinErr    error
+)
+
+// readStdinOnce reads stdin on the first call and returns the same data on later
+// calls, transcoded to UTF-8 and wrapped in a code fence like util.ReadStdin.
+// With --stdin-format json, stdin is parsed into stdinJSON instead and the prompt
+// of stdin is empty.
+func readStdinOnce() (string, error) {
+	stdinOnce.Do(func() {
+		pipe, err := util.IsFromStdin()
+		if err != nil || !pipe {
+			stdinErr = err
+			return
+		}
+		data, err := io.ReadAll(io.LimitReader(os.Stdin, MaxInputTotalBytes+1))
+		if err != nil {
+			stdinErr = err
+			return
+		}
+		if len(data) > MaxInputTotalBytes {
+			stdinErr = fmt.Errorf("total size would exceed limit of %d bytes", MaxInputTotalBytes)
+			return
+		}
+		format, err := stdinFormat()
+		if err != nil {
+			stdinErr = err
+			return
+		}
+		if format == stdinFormatJSON {
+			stdinJSON, stdinErr = parseStdinRequest(data)
+			return
+		}
+		text, err := decodeInput("stdin", data)
+		if err != nil {
+			stdinErr = err
+			return
+		}
+		stdinText = text
+		cachedStdin = "```stdin\n" + text + "```"
+	})
+	return cachedStdin, stdinErr
+}
+
+// decodeInput transcodes an input to UTF-8, with a warning if it was in another
+// encoding, so that a wrong guess is noticed rather than sent to the model as
+// mojibake.
+func decodeInput(name string, data []byte) (string, error) {
+	text, enc, err := util.ToUTF8(data)
+	if err != nil {
+		return "", fmt.Errorf("error: reading %s: %w", name, err)
+	}
+	warnEncoding(name, enc)
+	return string(text), nil
+}
+
+// warnEncoding warns that an input was transcoded to UTF-8 from its encoding.
+func warnEncoding(name, enc string) {
+	if enc != "" && enc != util.EncodingUTF8 {
+		slog.Warn("Input transcoded to UTF-8, check the encoding if the text looks wrong", "input", name, "encoding", enc)
+	}
+}
+
+// promptVars returns the template variables of the prompts: the vars section of
+// the config file, overridden by --var. Templating is enabled by --var or
+// --template; otherwise inputs are used as is, since code often contains {{ }}.
+func promptVars() (map[string]string, bool, error) {
+	pairs, _ := rootCmd.PersistentFlags().GetStringArray("var")
+	enabled, _ := rootCmd.PersistentFlags().GetBool("template")
+	if len(pairs) == 0 && !enabled {
+		return nil, false, nil
+	}
+	vars := viper.GetStringMapString("vars")
+	flagVars, err := util.ParseVars(pairs)
+	if err != nil {
+		return nil, false, fmt.Errorf("error: %w", err)
+	}
+	for key, value := range flagVars {
+		vars[key] = value
+	}
+	return vars, true, nil
+}
+
+// renderPrompt renders one input as a template if templating is enabled.
+func renderPrompt(name, text string) (string, error) {
+	vars, enabled, err := promptVars()
+	if err != nil || !enabled {
+		return text, err
+	}
+	rendered, err := util.RenderTemplate(name, text, vars)
+	if err != nil {
+		return "", fmt.Errorf("error: rendering template %s: %w", name, err)
+	}
+	return rendered, nil
+}
+
+// stdinArg is the argument that places stdin among the other arguments, which it
+// precedes otherwise.
+const stdinArg = "-"
+
+// binaryHeaderBytes is the number of bytes of a binary file dumped with --force-binary.
+const binaryHeaderBytes = 256
+
+// binaryFilePrompt returns a binary file as its type, size and the hexdump of its
+// header, framed like a file.
+func binaryFilePrompt(name, contentType string, data []byte) string {
+	header := data[:min(len(data), binaryHeaderBytes)]
+	return fmt.Sprintf("--- START FILE: %s ---\nbinary file, %s, %d bytes; hexdump of the first %d bytes:\n%s--- END FILE: %s ---",
+		name, contentType, len(data), len(header), hex.Dump(header), name)
+}
+
 // ReadPrompt processes input from standard input (stdin), URLs, and local files,
 // combining them into a slice of strings suitable for use as prompts.
 // It ensures the total size of all inputs does not exceed MaxInputTotalBytes.
-// Input sources are processed in the order: stdin, then arguments (files/URLs).
-// If no input is provided via stdin or arguments, a default prompt is used.
+// Input sources are processed in the order: stdin, then arguments (files/URLs),
+// unless a - argument places stdin among the arguments.
+// Audio files are transcribed and their transcripts are added instead, CSV, TSV
+// and Excel files are added as Markdown tables, the text files of zip and tar
+// archives are added one by one, and directories are added as their repo maps.
+// Other binary files are skipped with a warning, or added as the hexdump of their
+// header with --force-binary.
+// An input given more than once, as the same path or URL or with the same content
+// as an earlier input, e.g. stdin redirected from a file argument, is added once.
+// The prompt text of -p, if any, comes first.
+// If no input is provided via -p, stdin or arguments, it is an error, unless
+// --allow-empty is set or --default-prompt is given, which send the default prompt.
 //
 // Parameters:
 //   - args: A slice of strings, each representing a local file path or a URL.
 //
 // Returns:
 //   - []string: A slice containing the content from stdin and each file/URL,
-//     formatted and ready to be used as prompts. Returns a default prompt if
-//     no other input is provided.
+//     formatted and ready to be used as prompts. Returns the default prompt if
+//     no other input is provided and it is allowed.
 //   - error: An error if reading stdin, scraping a URL, reading a file fails,
-//     or if the total combined size exceeds MaxInputTotalBytes.
+//     if the total combined size exceeds MaxInputTotalBytes, or if there is
+//     no input.
 func ReadPrompt(args []string) ([]string, error) {
 	var prompts []string
 	var length int64 // Tracks the cumulative size of the prompts
+	start := time.Now()
+	inputs := make(inputSet) // skips inputs given more than once
 
 	// Process standard input and check size limit
-	var stdinData string
-	stdinData, _, err := util.ReadStdin(MaxInputTotalBytes)
+	stdinData, err := readStdinOnce()
 	if err != nil {
 		return nil, fmt.Errorf("error: reading from stdin: %w", err)
 	}
+	if stdinData, err = renderPrompt("stdin", stdinData); err != nil {
+		return nil, err
+	}
 	// Add markers only if stdinData is not empty
+	var markedStdinData string
+	stdinPlaceholder := slices.Contains(args, stdinArg)
 	if len(stdinData) > 0 {
-		markedStdinData := fmt.Sprintf("--- START STDIN ---\n%s\n--- END STDIN ---", stdinData)
-		prompts = append(prompts, markedStdinData)
+		inputs.duplicate("stdin", contentKey(stdinText))
+		markedStdinData = fmt.Sprintf("--- START STDIN ---\n%s\n--- END STDIN ---", stdinData)
 		length += int64(len(markedStdinData))
 		if length > MaxInputTotalBytes {
 			return nil, fmt.Errorf("error: total size would exceed limit of %d bytes (stdin)", MaxInputTotalBytes)
 		}
+	} else if stdinPlaceholder {
+		return nil, fmt.Errorf("error: %s stands for stdin, but there is no input on stdin", stdinArg)
+	}
+	if len(stdinData) > 0 && !stdinPlaceholder {
+		prompts = append(prompts, markedStdinData)
 	} else {
-		// Append empty string if stdin is empty, maintaining the structure but adding no content/markers
+		// Append empty string if stdin is empty or placed by the - argument, maintaining
+		// the structure but adding no content/markers
 		prompts = append(prompts, "")
 	}
 
 	// Process each argument which can be either a URL or a file path
 	for _, arg := range args {
+		// Place stdin at the - argument
+		if arg == stdinArg {
+			if !inputs.duplicate(arg, stdinArg) {
+				prompts = append(prompts, markedStdinData)
+			}
+			continue
+		}
+
 		// Attempt to parse argument as URL
 		parsedURL, err := url.ParseRequestURI(arg)
 		if err == nil && (parsedURL.Scheme == "http" || parsedURL.Scheme == "https") {
+			if inputs.duplicate(arg, urlKey(parsedURL)) {
+				continue
+			}
 			// Basic URL format is valid, now check for potential SSRF
 			hostname := parsedURL.Hostname()
 			ips, err := net.LookupIP(hostname)
@@ -91,10 +298,15 @@ func ReadPrompt(args []string) ([]string, error) {
 			}
 
 			// Hostname resolves to public IPs, proceed with scraping
+			scrapeStart := time.Now()
 			content, err := util.ScrapeURL(arg)
 			if err != nil {
 				return nil, fmt.Errorf("error: failed to scrape URL %s: %w", arg, err)
 			}
+			slog.Debug("Scraped URL", "url", arg, "bytes", len(content), "duration", time.Since(scrapeStart).Round(time.Millisecond))
+			if inputs.duplicate(arg, contentKey(content)) {
+				continue
+			}
 			// Add markers around URL content
 			markedContent := fmt.Sprintf("--- START URL: %s ---\n%s\n--- END URL: %s ---", arg, content, arg)
 			prompts = append(prompts, markedContent)
@@ -105,13 +317,108 @@ func ReadPrompt(args []string) ([]string, error) {
 			continue
 		}
 
+		// Skip files and directories that were already added
+		if inputs.duplicate(arg, fileKey(arg)) {
+			continue
+		}
+
+		// Add the repo map of directories
+		if info, err := os.Stat(arg); err == nil && info.IsDir() {
+			repoMap, err := buildRepoMap(arg, repoMapTokens())
+			if err != nil {
+				return nil, err
+			}
+			markedMap := fmt.Sprintf("--- START REPO MAP: %s ---\n%s--- END REPO MAP: %s ---", arg, repoMap, arg)
+			prompts = append(prompts, markedMap)
+			length += int64(len(markedMap))
+			if length > MaxInputTotalBytes {
+				return nil, fmt.Errorf("error: total size would exceed limit of %d bytes (repo maps)", MaxInputTotalBytes)
+			}
+			continue
+		}
+
+		// Add the text files of archives
+		if util.IsArchiveFile(arg) {
+			files, err := readArchive(arg)
+			if err != nil {
+				return nil, err
+			}
+			for _, f := range files {
+				prompts = append(prompts, f)
+				length += int64(len(f))
+			}
+			if length > MaxInputTotalBytes {
+				return nil, fmt.Errorf("error: total size would exceed limit of %d bytes (archives)", MaxInputTotalBytes)
+			}
+			continue
+		}
+
+		// Add tabular files as Markdown tables
+		if util.IsTableFile(arg) {
+			table, err := readTable(arg)
+			if err != nil {
+				return nil, err
+			}
+			markedTable := fmt.Sprintf("--- START TABLE: %s ---\n%s--- END TABLE: %s ---", arg, table, arg)
+			prompts = append(prompts, markedTable)
+			length += int64(len(markedTable))
+			if length > MaxInputTotalBytes {
+				return nil, fmt.Errorf("error: total size would exceed limit of %d bytes (tables)", MaxInputTotalBytes)
+			}
+			continue
+		}
+
+		// Transcribe audio files and add the transcript
+		if sqirvy.IsAudioFile(arg) {
+			transcript, err := transcribeFile(arg, transcriptionOptions())
+			if err != nil {
+				return nil, err
+			}
+			markedTranscript := fmt.Sprintf("--- START TRANSCRIPT: %s ---\n%s\n--- END TRANSCRIPT: %s ---", arg, transcript, arg)
+			prompts = append(prompts, markedTranscript)
+			length += int64(len(markedTranscript))
+			if length > MaxInputTotalBytes {
+				return nil, fmt.Errorf("error: total size would exceed limit of %d bytes (transcripts)", MaxInputTotalBytes)
+			}
+			continue
+		}
+
 		// Handle file content if not a URL
 		fileData, _, err := util.ReadFile(arg, MaxInputTotalBytes)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("error: failed to read file %s: %w (use -p to give the prompt text as an argument)", arg, err)
+		}
 		if err != nil {
 			return nil, fmt.Errorf("error: failed to read file %s: %w", arg, err)
 		}
+		slog.Log(context.Background(), levelTrace, "Read file", "file", arg, "bytes", len(fileData))
+		// Skip binary files, or add the hexdump of their header with --force-binary
+		if contentType, binary := util.BinaryContentType(fileData); binary {
+			if force, _ := rootCmd.PersistentFlags().GetBool("force-binary"); !force {
+				slog.Warn("Skipping binary file, use --force-binary to include a hexdump of its header", "file", arg, "type", contentType, "bytes", len(fileData))
+				continue
+			}
+			markedBinary := binaryFilePrompt(arg, contentType, fileData)
+			prompts = append(prompts, markedBinary)
+			length += int64(len(markedBinary))
+			if length > MaxInputTotalBytes {
+				return nil, fmt.Errorf("error: total size would exceed limit of %d bytes (files)", MaxInputTotalBytes)
+			}
+			continue
+		}
+		text, err := decodeInput(arg, fileData)
+		if err != nil {
+			return nil, err
+		}
+		if inputs.duplicate(arg, contentKey(text)) {
+			continue
+		}
+		rendered, err := renderPrompt(arg, text)
+		if err != nil {
+			return nil, err
+		}
 		// Add markers around file content
-		markedFileData := fmt.Sprintf("--- START FILE: %s ---\n%s\n--- END FILE: %s ---", arg, string(fileData), arg)
+		markedFileData := fmt.Sprintf("--- START FILE: %s ---\n%s\n--- END FILE: %s ---", arg, rendered, arg)
 		prompts = append(prompts, markedFileData)
 		length += int64(len(markedFileData))
 		if length > MaxInputTotalBytes {
@@ -119,6 +426,22 @@ func ReadPrompt(args []string) ([]string, error) {
 		}
 	}
 
+	// The prompt text of -p leads the inputs it is about
+	if text, _ := rootCmd.PersistentFlags().GetString("prompt-text"); text != "" {
+		rendered, err := renderPrompt("-p", text)
+		if err != nil {
+			return nil, err
+		}
+		length += int64(len(rendered))
+		if length > MaxInputTotalBytes {
+			return nil, fmt.Errorf("error: total size would exceed limit of %d bytes (-p)", MaxInputTotalBytes)
+		}
+		if prompts[0] == "" {
+			prompts = prompts[1:]
+		}
+		prompts = append([]string{rendered}, prompts...)
+	}
+
 	// Check if any actual content was added (beyond the initial potentially empty stdin prompt)
 	hasContent := false
 	if len(prompts) > 1 { // More than just the initial stdin placeholder
@@ -127,14 +450,54 @@ func ReadPrompt(args []string) ([]string, error) {
 		hasContent = true
 	}
 
-	// If no content was gathered from stdin or arguments, use the default prompt.
+	// A library prompt with --prompt-as user leads the prompts, and replaces the
+	// default prompt if there is no other content.
+	libraryText, role, err := selectedPrompt()
+	if err != nil {
+		return nil, err
+	}
+	if libraryText != "" && role == promptAsUser {
+		if !hasContent {
+			prompts = []string{libraryText}
+		} else {
+			if prompts[0] == "" {
+				prompts = prompts[1:]
+			}
+			prompts = append([]string{libraryText}, prompts...)
+		}
+		length += int64(len(libraryText))
+		if length > MaxInputTotalBytes {
+			return nil, fmt.Errorf("error: total size would exceed limit of %d bytes (prompt)", MaxInputTotalBytes)
+		}
+		slog.Debug("Assembled prompt", "prompts", len(prompts), "bytes", length, "duration", time.Since(start).Round(time.Millisecond))
+		return prompts, nil
+	}
+
+	// If no content was gathered from stdin or arguments, use the default prompt
+	// only if it was asked for, rather than paying for a query nobody wrote
 	if !hasContent {
+		allowEmpty, _ := rootCmd.PersistentFlags().GetBool("allow-empty")
+		if !allowEmpty && !viper.IsSet("default-prompt") {
+			return nil, errNoPrompt()
+		}
 		// Replace the potentially empty stdin prompt with the default prompt
-		prompts = []string{defaultPrompt}
+		prompts = []string{viper.GetString("default-prompt")}
 	} else if len(prompts) > 0 && prompts[0] == "" {
 		// If stdin was empty but files/URLs were added, remove the empty stdin placeholder
 		prompts = prompts[1:]
 	}
 
+	slog.Debug("Assembled prompt", "prompts", len(prompts), "bytes", length, "duration", time.Since(start).Round(time.Millisecond))
 	return prompts, nil
 }
+
+// errNoPrompt returns the error of a command run without a prompt, with help on
+// how to give one.
+func errNoPrompt() error {
+	name := auditCommand()
+	return fmt.Errorf("no prompt: give it with -p, pipe it on stdin or give files or URLs as arguments, e.g.\n"+
+		"  %s -p \"What is a goroutine?\"\n"+
+		"  echo \"What is a goroutine?\" | %s\n"+
+		"  %s notes.md https://example.com/spec\n"+
+		"or use --allow-empty to send the default prompt (%q)", name, name, name, viper.GetString("default-prompt"))
+}
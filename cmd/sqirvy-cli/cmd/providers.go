@@ -0,0 +1,114 @@
+// Package cmd implements the providers command, which lists the providers and
+// whether each is included in this binary. The Anthropic, Gemini, OpenAI and Llama
+// providers are left out of a build with the no_anthropic, no_gemini, no_openai and
+// no_llama build tags, and GGUF models are only run by a build with the llamacpp tag.
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	sqirvy "github.com/dmh2000/sqirvy-cli/pkg/sqirvy"
+
+	"github.com/spf13/cobra"
+)
+
+// providerEntry is the description of a provider printed by the providers command.
+type providerEntry struct {
+	Provider string `json:"provider"`
+	Included bool   `json:"included"`
+	Detail   string `json:"detail,omitempty"` // how to include a provider that is left out
+	Models   int    `json:"models"`           // number of registered models
+}
+
+// providersCmd lists the providers included in this build.
+var providersCmd = &cobra.Command{
+	Use:   "providers",
+	Short: "List the providers and whether they are included in this build",
+	Long: `sqirvy-cli providers lists the supported providers, whether each is included
+in this binary and the number of registered models of each.
+
+Providers are left out of a slimmer binary with build tags, e.g.
+	go build -tags no_gemini,no_llama -o sqirvy-cli main.go
+builds a binary with only the Anthropic and OpenAI providers. The available tags are
+no_anthropic, no_gemini, no_openai and no_llama. The local provider runs GGUF models
+only in a binary built with -tags llamacpp.`,
+	Args:              cobra.NoArgs,
+	ValidArgsFunction: cobra.NoFileCompletions,
+	Run: func(cmd *cobra.Command, args []string) {
+		format, _ := cmd.Flags().GetString("format")
+		entries := listProviders()
+		switch format {
+		case "json":
+			b, err := json.MarshalIndent(entries, "", "  ")
+			if err != nil {
+				log.Fatalf("Error executing providers command: %v", err)
+			}
+			fmt.Println(string(b))
+		case "text":
+			printProviderTable(os.Stdout, entries)
+		default:
+			log.Fatalf("Error executing providers command: unknown format %q (use text or json)", format)
+		}
+	},
+}
+
+// listProviders returns the providers in display order.
+func listProviders() []providerEntry {
+	models := map[string]int{}
+	for _, mp := range sqirvy.GetModelProviderList() {
+		models[mp.Provider]++
+	}
+
+	var entries []providerEntry
+	for _, provider := range sqirvy.GetProviderList() {
+		e := providerEntry{Provider: provider, Included: sqirvy.ProviderIncluded(provider), Models: models[provider]}
+		switch {
+		case !e.Included && sqirvy.ProviderBuildTag(provider) != "":
+			e.Detail = "rebuild without -tags " + sqirvy.ProviderBuildTag(provider)
+		case provider == sqirvy.Local && !sqirvy.LocalEngineIncluded():
+			// the provider is registered, but its queries fail without llama.cpp
+			e.Included = false
+			e.Detail = "rebuild with -tags llamacpp"
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// printProviderTable prints the providers as an aligned table.
+func printProviderTable(w io.Writer, entries []providerEntry) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PROVIDER\tINCLUDED\tMODELS\tDETAIL")
+	for _, e := range entries {
+		included := "yes"
+		if !e.Included {
+			included = "no"
+		}
+		detail := e.Detail
+		if detail == "" {
+			detail = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\n", e.Provider, included, e.Models, detail)
+	}
+	tw.Flush()
+}
+
+// providersUsage prints the usage instructions for the providers command.
+func providersUsage(cmd *cobra.Command) error {
+	fmt.Println("Usage: sqirvy-cli providers [--format text|json]")
+	fmt.Println("\nFlags:")
+	cmd.Flags().PrintDefaults()
+	return nil
+}
+
+// init registers the providers command with the root command.
+func init() {
+	providersCmd.Flags().String("format", "text", "Output format: text or json")
+	rootCmd.AddCommand(providersCmd)
+	providersCmd.SetUsageFunc(providersUsage)
+}
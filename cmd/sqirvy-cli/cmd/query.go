@@ -5,10 +5,8 @@ package cmd
 
 import (
 	"fmt"
-	"log"
 
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 // queryCmd represents the command to execute an arbitrary query against the LLM.
@@ -25,23 +23,20 @@ in the order specified.
 `,
 	Run: func(cmd *cobra.Command, args []string) {
 		// get arg/config params
-		model := viper.GetString("model")
-		temperature := viper.GetFloat64("temperature")
+		model := commandModel(cmd)
+		temperature := commandTemperature(cmd)
 
-		// Execute the query using the generic query prompt
-		response, err := executeQuery(model, temperature, queryPrompt, args)
-		if err != nil {
-			log.Fatalf("Error executing query command: %v", err)
-		}
-		// Print the LLM response to standard output
-		fmt.Print(response)
-		fmt.Println() // Ensure a newline at the end
+		// Execute the query using the generic query prompt, running it again on
+		// changes with --watch
+		runOrWatch(cmd, args, func(args []string) (string, error) {
+			return executeQuery(model, temperature, queryPrompt, args)
+		})
 	},
 }
 
 // queryUsage prints the usage instructions for the query command.
 func queryUsage(cmd *cobra.Command) error {
-	fmt.Println("Usage: stdin | sqirvy-cli query [flags] [files| urls]")
+	fmt.Println("Usage: [stdin |] sqirvy-cli query [flags] [-p prompt] [files| urls]")
 	fmt.Println("\nFlags:")
 	cmd.Flags().PrintDefaults()
 	return nil
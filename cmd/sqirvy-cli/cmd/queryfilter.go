@@ -0,0 +1,189 @@
+// Package cmd implements query filters, which inspect or change the prompts
+// of every query before they are sent and the responses before they are used,
+// e.g. the query hooks of the config file, the redaction of secrets and the
+// moderation of content.
+package cmd
+
+import (
+	"context"
+	"strings"
+
+	sqirvy "github.com/dmh2000/sqirvy-cli/pkg/sqirvy"
+)
+
+// queryFilter inspects or changes the text of a query. An error stops the query.
+type queryFilter interface {
+	// filterPrompt runs on the assembled prompt before it is sent.
+	filterPrompt(ctx context.Context, text, model string) (string, error)
+	// filterResponse runs on the response of the model.
+	filterResponse(ctx context.Context, text, model string) (string, error)
+}
+
+// queryFilters are the query filters of the configuration, run in order.
+type queryFilters []queryFilter
+
+// filteredClient runs query filters around the queries of a provider client.
+type filteredClient struct {
+	sqirvy.Client
+	filters queryFilters
+}
+
+// withQueryFilters returns client with the query filters of the configuration.
+// client is returned as is if there are no filters.
+func withQueryFilters(client sqirvy.Client) (sqirvy.Client, error) {
+	filters, err := configQueryFilters()
+	if err != nil {
+		return nil, err
+	}
+	if len(filters) == 0 {
+		return client, nil
+	}
+	return &filteredClient{Client: client, filters: filters}, nil
+}
+
+// configQueryFilters returns the query filters of the configuration: the query
+// hooks, then the redaction of secrets and the moderation, so that they see the
+// prompt as it will be sent.
+func configQueryFilters() (queryFilters, error) {
+	var filters queryFilters
+	if hooks := configQueryHooks(); hooks != nil {
+		filters = append(filters, hooks)
+	}
+	redaction, err := configRedaction()
+	if err != nil {
+		return nil, err
+	}
+	if redaction != nil {
+		filters = append(filters, redaction)
+	}
+	moderation, err := configModeration()
+	if err != nil {
+		return nil, err
+	}
+	if moderation != nil {
+		filters = append(filters, moderation)
+	}
+	return filters, nil
+}
+
+// QueryText runs the filters on the system prompt, the prompts and the response.
+func (c *filteredClient) QueryText(ctx context.Context, system string, prompts []string, model string, options sqirvy.Options) (string, error) {
+	response, _, err := c.QueryTextUsage(ctx, system, prompts, model, options)
+	return response, err
+}
+
+// QueryTextUsage runs the filters on the system prompt, the prompts and the
+// response.
+func (c *filteredClient) QueryTextUsage(ctx context.Context, system string, prompts []string, model string, options sqirvy.Options) (string, sqirvy.Usage, error) {
+	system, prompts, err := c.filters.filterPrompts(ctx, system, prompts, model)
+	if err != nil {
+		return "", sqirvy.Usage{}, err
+	}
+	response, usage, err := c.Client.QueryTextUsage(ctx, system, prompts, model, options)
+	if err != nil {
+		return "", usage, err
+	}
+	response, err = c.filters.filterResponse(ctx, response, model)
+	return response, usage, err
+}
+
+// QueryMessages runs the filters on each message, whatever its role, and on the
+// response.
+func (c *filteredClient) QueryMessages(ctx context.Context, messages []sqirvy.Message, model string, options sqirvy.Options) (string, sqirvy.Usage, error) {
+	filtered := make([]sqirvy.Message, len(messages))
+	for i, m := range messages {
+		filtered[i] = m
+		if m.Content == "" {
+			continue
+		}
+		content, err := c.filters.filterPrompt(ctx, m.Content, model)
+		if err != nil {
+			return "", sqirvy.Usage{}, err
+		}
+		filtered[i].Content = content
+	}
+	response, usage, err := c.Client.QueryMessages(ctx, filtered, model, options)
+	if err != nil {
+		return "", usage, err
+	}
+	response, err = c.filters.filterResponse(ctx, response, model)
+	return response, usage, err
+}
+
+// QueryCompletions runs the filters on the system prompt, the prompts and each
+// completion, so that clients that generate several completions in one request
+// still do.
+func (c *filteredClient) QueryCompletions(ctx context.Context, system string, prompts []string, model string, options sqirvy.Options, n int) ([]string, sqirvy.Usage, error) {
+	system, prompts, err := c.filters.filterPrompts(ctx, system, prompts, model)
+	if err != nil {
+		return nil, sqirvy.Usage{}, err
+	}
+	completions, usage, err := sqirvy.QueryCompletions(ctx, c.Client, system, prompts, model, options, n)
+	if err != nil {
+		return nil, usage, err
+	}
+	for i := range completions {
+		if completions[i], err = c.filters.filterResponse(ctx, completions[i], model); err != nil {
+			return nil, usage, err
+		}
+	}
+	return completions, usage, nil
+}
+
+// QueryWithTools runs the filters on the system prompt, the prompts and the text
+// of the response. Tool calls are returned as the model made them.
+func (c *filteredClient) QueryWithTools(ctx context.Context, system string, prompts []string, model string, options sqirvy.Options, tools []sqirvy.Tool) (sqirvy.ToolResponse, error) {
+	system, prompts, err := c.filters.filterPrompts(ctx, system, prompts, model)
+	if err != nil {
+		return sqirvy.ToolResponse{}, err
+	}
+	response, err := c.Client.QueryWithTools(ctx, system, prompts, model, options, tools)
+	if err != nil || response.Text == "" {
+		return response, err
+	}
+	response.Text, err = c.filters.filterResponse(ctx, response.Text, model)
+	return response, err
+}
+
+// filterPrompts runs the filters on the system prompt, if there is one, and on
+// the assembled prompt. If a filter changes the assembled prompt, the prompts are
+// replaced by the changed prompt.
+func (filters queryFilters) filterPrompts(ctx context.Context, system string, prompts []string, model string) (string, []string, error) {
+	if system != "" {
+		var err error
+		if system, err = filters.filterPrompt(ctx, system, model); err != nil {
+			return "", nil, err
+		}
+	}
+	assembled := strings.Join(prompts, "\n\n")
+	filtered, err := filters.filterPrompt(ctx, assembled, model)
+	if err != nil {
+		return "", nil, err
+	}
+	if filtered == assembled {
+		return system, prompts, nil
+	}
+	return system, []string{filtered}, nil
+}
+
+// filterPrompt runs the filters in order on a prompt.
+func (filters queryFilters) filterPrompt(ctx context.Context, text, model string) (string, error) {
+	for _, f := range filters {
+		var err error
+		if text, err = f.filterPrompt(ctx, text, model); err != nil {
+			return "", err
+		}
+	}
+	return text, nil
+}
+
+// filterResponse runs the filters in order on a response.
+func (filters queryFilters) filterResponse(ctx context.Context, text, model string) (string, error) {
+	for _, f := range filters {
+		var err error
+		if text, err = f.filterResponse(ctx, text, model); err != nil {
+			return "", err
+		}
+	}
+	return text, nil
+}
@@ -0,0 +1,210 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+
+	sqirvy "github.com/dmh2000/sqirvy-cli/pkg/sqirvy"
+	util "github.com/dmh2000/sqirvy-cli/pkg/util"
+
+	"github.com/spf13/viper"
+)
+
+// recordingClient records the text it is asked to send.
+type recordingClient struct {
+	sent []string
+}
+
+func (c *recordingClient) record(system string, prompts []string) {
+	c.sent = append(append(c.sent, system), prompts...)
+}
+
+func (c *recordingClient) QueryText(ctx context.Context, system string, prompts []string, model string, options sqirvy.Options) (string, error) {
+	c.record(system, prompts)
+	return "ok", nil
+}
+
+func (c *recordingClient) QueryTextUsage(ctx context.Context, system string, prompts []string, model string, options sqirvy.Options) (string, sqirvy.Usage, error) {
+	c.record(system, prompts)
+	return "ok", sqirvy.Usage{}, nil
+}
+
+func (c *recordingClient) QueryMessages(ctx context.Context, messages []sqirvy.Message, model string, options sqirvy.Options) (string, sqirvy.Usage, error) {
+	for _, m := range messages {
+		c.sent = append(c.sent, m.Content)
+	}
+	return "ok", sqirvy.Usage{}, nil
+}
+
+func (c *recordingClient) QueryWithTools(ctx context.Context, system string, prompts []string, model string, options sqirvy.Options, tools []sqirvy.Tool) (sqirvy.ToolResponse, error) {
+	c.record(system, prompts)
+	return sqirvy.ToolResponse{Text: "ok"}, nil
+}
+
+func (c *recordingClient) ValidateCredentials(ctx context.Context) error { return nil }
+func (c *recordingClient) Close() error                                  { return nil }
+
+func TestFilteredClientRedactsEveryPrompt(t *testing.T) {
+	const secret = "sk-ant-REDACTED"
+	const masked = "[REDACTED:api-key]"
+
+	tests := []struct {
+		name  string
+		query func(ctx context.Context, c *filteredClient) error
+	}{
+		{
+			name: "system of QueryText",
+			query: func(ctx context.Context, c *filteredClient) error {
+				_, err := c.QueryText(ctx, "key "+secret, []string{"hello"}, "m", sqirvy.Options{})
+				return err
+			},
+		},
+		{
+			name: "prompt of QueryTextUsage",
+			query: func(ctx context.Context, c *filteredClient) error {
+				_, _, err := c.QueryTextUsage(ctx, "be brief", []string{"hello", "key " + secret}, "m", sqirvy.Options{})
+				return err
+			},
+		},
+		{
+			name: "system of QueryCompletions",
+			query: func(ctx context.Context, c *filteredClient) error {
+				_, _, err := c.QueryCompletions(ctx, "key "+secret, []string{"hello"}, "m", sqirvy.Options{}, 1)
+				return err
+			},
+		},
+		{
+			name: "system of QueryWithTools",
+			query: func(ctx context.Context, c *filteredClient) error {
+				_, err := c.QueryWithTools(ctx, "key "+secret, []string{"hello"}, "m", sqirvy.Options{}, nil)
+				return err
+			},
+		},
+		{
+			name: "system message",
+			query: func(ctx context.Context, c *filteredClient) error {
+				messages := []sqirvy.Message{{Role: sqirvy.RoleSystem, Content: "key " + secret}, {Role: sqirvy.RoleUser, Content: "hello"}}
+				_, _, err := c.QueryMessages(ctx, messages, "m", sqirvy.Options{})
+				return err
+			},
+		},
+		{
+			name: "user message",
+			query: func(ctx context.Context, c *filteredClient) error {
+				messages := []sqirvy.Message{{Role: sqirvy.RoleUser, Content: "key " + secret}}
+				_, _, err := c.QueryMessages(ctx, messages, "m", sqirvy.Options{})
+				return err
+			},
+		},
+		{
+			name: "assistant message",
+			query: func(ctx context.Context, c *filteredClient) error {
+				messages := []sqirvy.Message{{Role: sqirvy.RoleUser, Content: "hello"}, {Role: sqirvy.RoleAssistant, Content: "key " + secret}, {Role: sqirvy.RoleUser, Content: "again"}}
+				_, _, err := c.QueryMessages(ctx, messages, "m", sqirvy.Options{})
+				return err
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			recorder := &recordingClient{}
+			masking := &filteredClient{Client: recorder, filters: []queryFilter{&redactFilter{mode: redactMask, rules: util.DefaultRedactRules}}}
+			if err := tt.query(ctx, masking); err != nil {
+				t.Fatalf("mask: unexpected error: %v", err)
+			}
+			sent := strings.Join(recorder.sent, "\n")
+			if strings.Contains(sent, secret) {
+				t.Errorf("mask: the secret was sent: %q", sent)
+			}
+			if !strings.Contains(sent, masked) {
+				t.Errorf("mask: sent %q, want it to contain %q", sent, masked)
+			}
+
+			recorder = &recordingClient{}
+			blocking := &filteredClient{Client: recorder, filters: []queryFilter{&redactFilter{mode: redactBlock, rules: util.DefaultRedactRules}}}
+			if err := tt.query(ctx, blocking); err == nil {
+				t.Error("block: expected an error")
+			}
+			if len(recorder.sent) > 0 {
+				t.Errorf("block: sent %q, want nothing", recorder.sent)
+			}
+		})
+	}
+}
+
+func TestWithQueryFiltersOrder(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the hooks of the test are POSIX shell commands")
+	}
+
+	// the hook adds an email address, redaction masks it and moderation, which
+	// flags the hook's word and the address, sees only what redaction left
+	tests := []struct {
+		name    string
+		prompt  string
+		want    string // prompt sent to the provider, empty if the query is refused
+		wantErr string
+	}{
+		{
+			name:   "hook output is redacted before moderation",
+			prompt: "hello",
+			want:   "hello [REDACTED:email]",
+		},
+		{
+			name:    "hook output is moderated",
+			prompt:  "attack",
+			wantErr: "moderation flagged the prompt: violence",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Reset()
+			defer viper.Reset()
+			viper.Set("query_hooks.pre", []string{`printf '%s ops@example.com' "$(cat)" | sed 's/attack/assault/'`})
+			viper.Set("redact.mode", redactMask)
+			viper.Set("moderation.provider", moderationLocal)
+			viper.Set("moderation.rules", map[string]string{"violence": `assault`, "contact": `@example\.com`})
+
+			recorder := &recordingClient{}
+			client, err := withQueryFilters(recorder)
+			if err != nil {
+				t.Fatalf("withQueryFilters() error = %v", err)
+			}
+			filtered, ok := client.(*filteredClient)
+			if !ok {
+				t.Fatalf("withQueryFilters() = %T, want *filteredClient", client)
+			}
+			var order []string
+			for _, f := range filtered.filters {
+				order = append(order, fmt.Sprintf("%T", f))
+			}
+			if want := []string{"*cmd.queryHooks", "*cmd.redactFilter", "*cmd.moderationFilter"}; !slices.Equal(order, want) {
+				t.Errorf("filters = %v, want %v", order, want)
+			}
+
+			_, err = client.QueryText(context.Background(), "", []string{tt.prompt}, "m", sqirvy.Options{})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("QueryText() error = %v, want %q", err, tt.wantErr)
+				}
+				if len(recorder.sent) > 0 {
+					t.Errorf("sent %q, want nothing", recorder.sent)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("QueryText() error = %v", err)
+			}
+			if sent := strings.Join(recorder.sent, "\n"); !strings.Contains(sent, tt.want) {
+				t.Errorf("sent %q, want %q", sent, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+// Package cmd implements query hooks: shell commands from the query_hooks
+// section of the config file that run around every query. Pre hooks receive the
+// system prompt and the assembled prompt, each in turn, on stdin before they are
+// sent and can veto the query by exiting with an error or transform the text by
+// printing a replacement. Post hooks
+// receive the response and can post-process it the same way. They let an
+// organization add redaction, formatting or notification without forking.
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// defaultQueryHookTimeout limits each query hook unless query_hooks.timeout is set.
+const defaultQueryHookTimeout = 30 * time.Second
+
+// Stages of a query hook, passed to the hook in SQIRVY_HOOK_STAGE.
+const (
+	queryHookPre  = "pre"
+	queryHookPost = "post"
+)
+
+// queryHooks is the query filter that runs the query hooks.
+type queryHooks struct {
+	pre     []string
+	post    []string
+	timeout time.Duration
+}
+
+// configQueryHooks returns the query hooks of the config file, or nil if none
+// are configured.
+func configQueryHooks() *queryHooks {
+	pre := viper.GetStringSlice("query_hooks.pre")
+	post := viper.GetStringSlice("query_hooks.post")
+	if len(pre) == 0 && len(post) == 0 {
+		return nil
+	}
+	timeout := defaultQueryHookTimeout
+	if viper.IsSet("query_hooks.timeout") {
+		timeout = viper.GetDuration("query_hooks.timeout")
+	}
+	return &queryHooks{pre: pre, post: post, timeout: timeout}
+}
+
+// filterPrompt runs the pre hooks on a prompt.
+func (h *queryHooks) filterPrompt(ctx context.Context, text, model string) (string, error) {
+	return h.run(ctx, queryHookPre, h.pre, text, model)
+}
+
+// filterResponse runs the post hooks on the response.
+func (h *queryHooks) filterResponse(ctx context.Context, text, model string) (string, error) {
+	return h.run(ctx, queryHookPost, h.post, text, model)
+}
+
+// run runs the hooks of a stage in order, each receiving the text printed by the
+// one before. A hook that prints nothing leaves the text unchanged, and a hook
+// that fails stops the query.
+func (h *queryHooks) run(ctx context.Context, stage string, hooks []string, text string, model string) (string, error) {
+	for _, hook := range hooks {
+		start := time.Now()
+		out, err := runQueryHook(ctx, h.timeout, hook, stage, text, model)
+		if err != nil {
+			if stage == queryHookPre {
+				return "", fmt.Errorf("error: pre-query hook %q rejected the query: %w", hook, err)
+			}
+			return "", fmt.Errorf("error: post-query hook %q failed: %w", hook, err)
+		}
+		slog.Debug("Ran query hook", "stage", stage, "hook", hook, "bytes", len(out), "duration", time.Since(start).Round(time.Millisecond))
+		if out != "" {
+			text = out
+		}
+	}
+	return text, nil
+}
+
+// runQueryHook runs one hook with text on stdin and returns its output. The hook
+// gets the stage and the model in SQIRVY_HOOK_STAGE and SQIRVY_HOOK_MODEL, and
+// writes messages, e.g. the reason for a veto, to stderr.
+func runQueryHook(ctx context.Context, timeout time.Duration, hook, stage, text, model string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	c := shellCommand(ctx, hook)
+	c.Env = append(os.Environ(), "SQIRVY_HOOK_STAGE="+stage, "SQIRVY_HOOK_MODEL="+model)
+	c.Stdin = strings.NewReader(text)
+	var stdout bytes.Buffer
+	c.Stdout = &stdout
+	c.Stderr = os.Stderr
+	if err := c.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return "", fmt.Errorf("timed out after %s", timeout)
+		}
+		return "", err
+	}
+	return stdout.String(), nil
+}
+
+// shellCommand returns a command that runs command with the shell of the platform.
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", command)
+	}
+	return exec.CommandContext(ctx, "sh", "-c", command)
+}
@@ -0,0 +1,107 @@
+// Package cmd implements racing, where the same query is sent to several models,
+// usually of different providers, at the same time and the first successful
+// response is used. The other queries are cancelled. Racing trades cost for
+// latency and for resilience to a flaky provider.
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	sqirvy "github.com/dmh2000/sqirvy-cli/pkg/sqirvy"
+)
+
+// raceQuery sends a query to a model of a race
+type raceQuery func(ctx context.Context, client sqirvy.Client, model string, options sqirvy.Options) (string, error)
+
+// raceModels returns the models that race: the selected model followed by the
+// models of --race, with aliases resolved and duplicates removed.
+func raceModels(model string, race []string) []string {
+	models := []string{model}
+	for _, m := range race {
+		m = resolveModel(strings.TrimSpace(m))
+		if m != "" && !slices.Contains(models, m) {
+			models = append(models, m)
+		}
+	}
+	return models
+}
+
+// raceClient is the client and options of a model of a race.
+type raceClient struct {
+	model   string
+	client  sqirvy.Client
+	options sqirvy.Options
+}
+
+// newRaceClient creates the client of a model of a race, with the temperature and
+// response limit of the model.
+func newRaceClient(model string, temperature float64, maxTokens int64) (raceClient, error) {
+	client, err := newClientForModel(model)
+	if err != nil {
+		return raceClient{}, err
+	}
+	queryTemp, err := queryTemperature(temperature, model)
+	if err != nil {
+		return raceClient{}, err
+	}
+	options := sqirvy.Options{Temperature: queryTemp, MaxTokens: commandMaxTokens(model), Stop: stopSequences(), Seed: querySeed(model), Prefill: queryPrefill(model)}
+	if maxTokens > 0 {
+		options.MaxTokens = maxTokens
+	}
+	return raceClient{model: model, client: client, options: options}, nil
+}
+
+// queryRace sends the query to each model concurrently, with the temperature and
+// response limit of the model, and returns the first successful response. The
+// queries still running are cancelled. It is an error if every query fails.
+//
+// The clients are created one at a time before the queries start, since creating
+// the client of an unregistered model registers it.
+func queryRace(ctx context.Context, models []string, temperature float64, maxTokens int64, query raceQuery) (string, error) {
+	type result struct {
+		model    string
+		response string
+		err      error
+	}
+
+	var racers []raceClient
+	var errs []error
+	for _, model := range models {
+		racer, err := newRaceClient(model, temperature, maxTokens)
+		if err != nil {
+			slog.Warn("Race query failed", "model", model, "error", err)
+			errs = append(errs, err)
+			continue
+		}
+		racers = append(racers, racer)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	start := time.Now()
+	results := make(chan result, len(racers))
+	for _, r := range racers {
+		go func() {
+			response, err := query(ctx, r.client, r.model, r.options)
+			results <- result{model: r.model, response: response, err: err}
+		}()
+	}
+
+	for range racers {
+		r := <-results
+		if r.err != nil {
+			slog.Warn("Race query failed", "model", r.model, "error", r.err)
+			errs = append(errs, r.err)
+			continue
+		}
+		slog.Info("Race won", "model", r.model, "duration", time.Since(start).Round(time.Millisecond))
+		return r.response, nil
+	}
+	return "", fmt.Errorf("error: all %d models of the race failed: %w", len(models), errors.Join(errs...))
+}
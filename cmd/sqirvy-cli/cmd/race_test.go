@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	sqirvy "github.com/dmh2000/sqirvy-cli/pkg/sqirvy"
+)
+
+func TestQueryRaceFasterWins(t *testing.T) {
+	// OpenAI answers after a short delay, Anthropic not until the query is cancelled
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		w.Write([]byte(`{"choices": [{"message": {"content": "fast"}, "finish_reason": "stop"}],
+			"usage": {"prompt_tokens": 1000, "completion_tokens": 2000}}`))
+	}))
+	defer fast.Close()
+	cancelled := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the server notices the client going away once the body is read
+		io.Copy(io.Discard, r.Body)
+		select {
+		case <-r.Context().Done():
+			close(cancelled)
+		case <-time.After(10 * time.Second):
+			w.Write([]byte(`{"content": [{"type": "text", "text": "slow"}], "stop_reason": "end_turn",
+				"usage": {"input_tokens": 1000, "output_tokens": 2000}}`))
+		}
+	}))
+	defer slow.Close()
+	t.Setenv("OPENAI_API_KEY", "test-key-0123456789abcdef")
+	t.Setenv("OPENAI_BASE_URL", fast.URL)
+	t.Setenv("ANTHROPIC_API_KEY", "sk-ant-test-key-0123456789")
+	t.Setenv("ANTHROPIC_BASE_URL", slow.URL)
+
+	// clients of the providers cached by other tests point to other servers
+	saved := clients
+	clients = sqirvy.NewClientPool()
+	defer func() {
+		clients.Close()
+		clients = saved
+	}()
+
+	type result struct {
+		model string
+		err   error
+	}
+	done := make(chan result, 2)
+	query := func(ctx context.Context, client sqirvy.Client, model string, options sqirvy.Options) (string, error) {
+		response, err := client.QueryText(ctx, "be brief", []string{"hello"}, model, options)
+		done <- result{model: model, err: err}
+		return response, err
+	}
+
+	// the slower model is listed first, so it cannot win by its order
+	spent := sqirvy.RunSpend()
+	models := raceModels("claude-3-5-haiku-latest", []string{"gpt-4o-mini"})
+	response, err := queryRace(context.Background(), models, 0.5, 0, query)
+	if err != nil {
+		t.Fatalf("queryRace() error = %v", err)
+	}
+	if response != "fast" {
+		t.Errorf("queryRace() = %q, want the response of the faster model", response)
+	}
+
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the query of the slower model was not cancelled")
+	}
+	// wait for the query of the slower model to give up its budget reservation
+	for range 2 {
+		r := <-done
+		if r.model == "claude-3-5-haiku-latest" && !errors.Is(r.err, context.Canceled) {
+			t.Errorf("query of the slower model error = %v, want %v", r.err, context.Canceled)
+		}
+	}
+
+	want := sqirvy.EstimateCost("gpt-4o-mini", sqirvy.Usage{InputTokens: 1000, OutputTokens: 2000})
+	if got := sqirvy.RunSpend() - spent; math.Abs(got-want) > 1e-12 {
+		t.Errorf("cost charged to the budget = %v, want the cost of the winner %v", got, want)
+	}
+}
@@ -0,0 +1,91 @@
+// Package cmd implements the redaction of secrets and personal data, such as API
+// keys, passwords and email addresses, from prompts before they leave the machine.
+// --redact, or redact.mode in the config file, selects what happens when the
+// assembled prompt matches a rule: mask replaces the match, warn only reports it
+// and block refuses to send the query.
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+
+	util "github.com/dmh2000/sqirvy-cli/pkg/util"
+
+	"github.com/spf13/viper"
+)
+
+// Redaction modes
+const (
+	redactOff   = "off"
+	redactMask  = "mask"
+	redactWarn  = "warn"
+	redactBlock = "block"
+)
+
+// redactFilter is the query filter that redacts prompts.
+type redactFilter struct {
+	mode  string
+	rules []util.RedactRule
+}
+
+// configRedaction returns the redaction filter of the configuration, or nil if
+// redaction is off. The rules are the built-in rules not listed in redact.ignore
+// and the patterns of redact.patterns.
+func configRedaction() (*redactFilter, error) {
+	mode := viper.GetString("redact.mode")
+	switch mode {
+	case "", redactOff:
+		return nil, nil
+	case redactMask, redactWarn, redactBlock:
+	default:
+		return nil, fmt.Errorf("error: unknown redact mode %q (use mask, warn, block or off)", mode)
+	}
+
+	ignore := viper.GetStringSlice("redact.ignore")
+	var rules []util.RedactRule
+	for _, rule := range util.DefaultRedactRules {
+		if !slices.Contains(ignore, rule.Name) {
+			rules = append(rules, rule)
+		}
+	}
+	patterns := viper.GetStringMapString("redact.patterns")
+	names := make([]string, 0, len(patterns))
+	for name := range patterns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		rule, err := util.NewRedactRule(name, patterns[name])
+		if err != nil {
+			return nil, fmt.Errorf("error: %w", err)
+		}
+		rules = append(rules, rule)
+	}
+	return &redactFilter{mode: mode, rules: rules}, nil
+}
+
+// filterPrompt masks, reports or blocks the sensitive data in the prompt.
+func (f *redactFilter) filterPrompt(ctx context.Context, text, model string) (string, error) {
+	masked, counts := util.Redact(text, f.rules)
+	if len(counts) == 0 {
+		return text, nil
+	}
+	matches := util.FormatRedactCounts(counts)
+	switch f.mode {
+	case redactMask:
+		slog.Warn("Redacted sensitive data from the prompt", "matches", matches)
+		return masked, nil
+	case redactWarn:
+		slog.Warn("Prompt contains sensitive data", "matches", matches)
+		return text, nil
+	}
+	return "", fmt.Errorf("error: prompt contains sensitive data: %s (see --redact)", matches)
+}
+
+// filterResponse returns the response as is.
+func (f *redactFilter) filterResponse(ctx context.Context, text, model string) (string, error) {
+	return text, nil
+}
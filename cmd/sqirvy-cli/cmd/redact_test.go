@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"context"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestConfigRedaction(t *testing.T) {
+	const text = "mail ada@example.com, key sk-ant-REDACTED, id EMP-123456"
+
+	tests := []struct {
+		name     string
+		config   map[string]any
+		want     string // prompt after the filter
+		wantNil  bool   // redaction is off
+		wantErr  bool   // the configuration is invalid
+		wantDeny bool   // the query is refused
+	}{
+		{name: "off by default", wantNil: true},
+		{name: "off", config: map[string]any{"redact.mode": "off"}, wantNil: true},
+		{name: "unknown mode", config: map[string]any{"redact.mode": "hide"}, wantErr: true},
+		{
+			name:   "mask",
+			config: map[string]any{"redact.mode": "mask"},
+			want:   "mail [REDACTED:email], key [REDACTED:api-key], id EMP-123456",
+		},
+		{
+			name:   "mask with ignored rule and custom pattern",
+			config: map[string]any{"redact.mode": "mask", "redact.ignore": []string{"email"}, "redact.patterns": map[string]string{"employee-id": `EMP-[0-9]{6}`}},
+			want:   "mail ada@example.com, key [REDACTED:api-key], id [REDACTED:employee-id]",
+		},
+		{
+			name:    "invalid custom pattern",
+			config:  map[string]any{"redact.mode": "mask", "redact.patterns": map[string]string{"bad": `[`}},
+			wantErr: true,
+		},
+		{name: "warn", config: map[string]any{"redact.mode": "warn"}, want: text},
+		{name: "block", config: map[string]any{"redact.mode": "block"}, wantDeny: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Reset()
+			defer viper.Reset()
+			for k, v := range tt.config {
+				viper.Set(k, v)
+			}
+
+			f, err := configRedaction()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("configRedaction() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if (f == nil) != tt.wantNil {
+				t.Fatalf("configRedaction() = %v, want nil %v", f, tt.wantNil)
+			}
+			if f == nil {
+				return
+			}
+
+			got, err := f.filterPrompt(context.Background(), text, "m")
+			if (err != nil) != tt.wantDeny {
+				t.Fatalf("filterPrompt() error = %v, want refused %v", err, tt.wantDeny)
+			}
+			if got != tt.want {
+				t.Errorf("filterPrompt() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+// Package cmd implements loading of the user's model registry file, which adds
+// models and aliases to the built-in registry without rebuilding the binary.
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+
+	sqirvy "github.com/dmh2000/sqirvy-cli/pkg/sqirvy"
+
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// modelsFileName is the name of the model registry file in the config directory.
+const modelsFileName = "models.yaml"
+
+// modelFileEntry describes one model in the registry file. Fields that are not
+// set keep the value from the built-in registry when the model already exists.
+type modelFileEntry struct {
+	Provider      *string  `yaml:"provider"`
+	MaxTokens     *int64   `yaml:"max_tokens"`
+	ContextWindow *int64   `yaml:"context_window"`
+	Vision        *bool    `yaml:"vision"`
+	Tools         *bool    `yaml:"tools"`
+	JSON          *bool    `yaml:"json"`
+	Reasoning     *bool    `yaml:"reasoning"`
+	InputCost     *float64 `yaml:"input_cost"`
+	OutputCost    *float64 `yaml:"output_cost"`
+	Retires       *string  `yaml:"retires"`
+	Successor     *string  `yaml:"successor"`
+}
+
+// modelsFile is the layout of the registry file.
+type modelsFile struct {
+	Models  map[string]modelFileEntry `yaml:"models"`
+	Aliases map[string]string         `yaml:"aliases"`
+}
+
+// defaultModelsFile returns the path of the registry file in the config directory.
+func defaultModelsFile() (string, error) {
+	return configFileIn(modelsFileName)
+}
+
+// decodeModelsFile decodes the contents of a registry file.
+func decodeModelsFile(data []byte) (modelsFile, error) {
+	var file modelsFile
+	err := yaml.Unmarshal(data, &file)
+	return file, err
+}
+
+// loadModelsFile merges the models and aliases in the registry file over the
+// built-in registry. A missing file at the default location is not an error;
+// a missing file that was named explicitly is.
+func loadModelsFile(path string, explicit bool) error {
+	if _, err := os.Stat(path); err != nil {
+		if errors.Is(err, os.ErrNotExist) && !explicit {
+			return nil
+		}
+		return fmt.Errorf("error: model registry file %s: %w", path, err)
+	}
+
+	// model names contain dots and capitals, so the file is decoded directly
+	// rather than through viper, which treats dots as key separators
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error: reading model registry file %s: %w", path, err)
+	}
+
+	file, err := decodeModelsFile(data)
+	if err != nil {
+		return fmt.Errorf("error: parsing model registry file %s: %w", path, err)
+	}
+
+	for model, entry := range file.Models {
+		// start from the built-in entry so the file only needs the fields it changes
+		info, _ := sqirvy.GetModelInfo(model)
+		if entry.Provider != nil {
+			info.Provider = *entry.Provider
+		}
+		if entry.MaxTokens != nil {
+			info.MaxTokens = *entry.MaxTokens
+		}
+		if entry.ContextWindow != nil {
+			info.ContextWindow = *entry.ContextWindow
+		}
+		if entry.Vision != nil {
+			info.Vision = *entry.Vision
+		}
+		if entry.Tools != nil {
+			info.Tools = *entry.Tools
+		}
+		if entry.JSON != nil {
+			info.JSON = *entry.JSON
+		}
+		if entry.Reasoning != nil {
+			info.Reasoning = *entry.Reasoning
+		}
+		if entry.InputCost != nil {
+			info.InputCost = *entry.InputCost
+		}
+		if entry.OutputCost != nil {
+			info.OutputCost = *entry.OutputCost
+		}
+		if entry.Retires != nil {
+			info.Retires = *entry.Retires
+		}
+		if entry.Successor != nil {
+			info.Successor = *entry.Successor
+		}
+		if err := sqirvy.RegisterModel(model, info); err != nil {
+			return fmt.Errorf("error: model registry file %s: %w", path, err)
+		}
+	}
+
+	for alias, model := range file.Aliases {
+		if err := sqirvy.RegisterAlias(alias, model); err != nil {
+			return fmt.Errorf("error: model registry file %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// initModels loads the manifest saved by models update, if it exists, and then
+// the registry file named by the models-file setting, or the default registry
+// file if it exists, so that the user's changes win over the manifest. A
+// manifest that does not load is skipped with a warning.
+func initModels() {
+	if manifest, err := manifestFile(); err == nil {
+		if err := loadModelsFile(manifest, false); err != nil {
+			slog.Warn("Skipping the model manifest, run sqirvy-cli models update", "error", err)
+		}
+	}
+
+	path := viper.GetString("models-file")
+	explicit := path != ""
+	if !explicit {
+		var err error
+		path, err = defaultModelsFile()
+		if err != nil {
+			return
+		}
+	}
+	if err := loadModelsFile(path, explicit); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
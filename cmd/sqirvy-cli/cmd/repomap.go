@@ -0,0 +1,89 @@
+/*
+Copyright © 2025 David Howard  dmh2000@gmail.com
+*/
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"log/slog"
+	"time"
+
+	util "github.com/dmh2000/sqirvy-cli/pkg/util"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// defaultRepoMapTokens is the token budget of a repo map unless repomap.tokens is set.
+const defaultRepoMapTokens = 2048
+
+// repomapCmd represents the command to print the repo map of a directory.
+var repomapCmd = &cobra.Command{
+	Use:   "repomap [directory]",
+	Short: "Print a condensed map of the files and exported symbols of a codebase",
+	Long: `sqirvy-cli repomap will print a map of the source files under the directory
+(default the current directory) with the signatures of their exported types,
+functions and methods, without their bodies, in a token budget.
+When the map does not fit, the files whose symbols are used most by the other
+files keep their signatures, the next files are listed by path, and the rest are
+counted. Go files are parsed; Python, JavaScript, TypeScript, Rust and Java files
+are outlined by pattern. Hidden directories, vendor, node_modules and testdata are
+skipped.
+A directory given as an argument to the other commands, e.g. code or plan, is
+added to the prompt as its repo map:
+	echo "add a --json flag to the list command" | sqirvy-cli plan .
+The budget is set with --tokens or repomap.tokens in the config file (default 2048).
+`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		dir := "."
+		if len(args) == 1 {
+			dir = args[0]
+		}
+		tokens := repoMapTokens()
+		if cmd.Flags().Changed("tokens") {
+			tokens, _ = cmd.Flags().GetInt("tokens")
+		}
+		text, err := buildRepoMap(dir, tokens)
+		if err != nil {
+			log.Fatalf("Error executing repomap command: %v", err)
+		}
+		fmt.Print(text)
+	},
+}
+
+// repoMapTokens returns the token budget of repo maps from the config file.
+func repoMapTokens() int {
+	if viper.IsSet("repomap.tokens") {
+		return viper.GetInt("repomap.tokens")
+	}
+	return defaultRepoMapTokens
+}
+
+// buildRepoMap returns the repo map of dir in a budget of tokens, estimated at
+// four bytes per token, or without limit if tokens is 0.
+func buildRepoMap(dir string, tokens int) (string, error) {
+	start := time.Now()
+	text, err := util.RepoMap(dir, tokens*4)
+	if err != nil {
+		return "", fmt.Errorf("error: %w", err)
+	}
+	slog.Debug("Built repo map", "directory", dir, "bytes", len(text), "duration", time.Since(start).Round(time.Millisecond))
+	return text, nil
+}
+
+// repomapUsage prints the usage instructions for the repomap command.
+func repomapUsage(cmd *cobra.Command) error {
+	fmt.Println("Usage: sqirvy-cli repomap [--tokens n] [directory]")
+	fmt.Println("\nFlags:")
+	cmd.Flags().PrintDefaults()
+	return nil
+}
+
+// init registers the repomap command with the root command.
+func init() {
+	repomapCmd.Flags().Int("tokens", defaultRepoMapTokens, "Token budget of the map, 0 for no limit (default repomap.tokens, else 2048)")
+	rootCmd.AddCommand(repomapCmd)
+	repomapCmd.SetUsageFunc(repomapUsage)
+}
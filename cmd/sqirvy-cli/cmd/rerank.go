@@ -0,0 +1,193 @@
+/*
+Copyright © 2025 David Howard  dmh2000@gmail.com
+*/
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	sqirvy "github.com/dmh2000/sqirvy-cli/pkg/sqirvy"
+	util "github.com/dmh2000/sqirvy-cli/pkg/util"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// Ways to split stdin into documents
+const (
+	rerankSplitLine      = "line"      // one document per line
+	rerankSplitParagraph = "paragraph" // documents separated by blank lines
+)
+
+// rerankOutput is a reranked document in the JSON output of the rerank command.
+type rerankOutput struct {
+	Index    int     `json:"index"`
+	Score    float64 `json:"score"`
+	Document string  `json:"document"`
+}
+
+// paragraphSeparator separates paragraphs: a line that is empty or only spaces.
+var paragraphSeparator = regexp.MustCompile(`\n[ \t]*\n`)
+
+// rerankCmd represents the command to reorder documents by relevance to a query.
+var rerankCmd = &cobra.Command{
+	Use:   "rerank query [file...]",
+	Short: "Reorder documents by relevance to a query",
+	Long: `sqirvy-cli rerank will score candidate documents by their relevance to the query
+with a rerank model of Cohere (COHERE_API_KEY), Voyage AI (VOYAGE_API_KEY) or Jina AI
+(JINA_API_KEY) and print them most relevant first.
+The documents are the lines of stdin, or its paragraphs with --split paragraph, and
+the contents of the file arguments, one document per file:
+	grep -h "func " *.go | sqirvy-cli rerank "parse the config file" --top 5
+	sqirvy-cli rerank "how are retries configured" docs/*.md --format json
+The defaults are set in the rerank section of the config file:
+	rerank:
+	  service: voyage      # cohere (default), voyage or jina
+	  model: rerank-2-lite
+`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		options := sqirvy.RerankOptions{
+			Provider: viper.GetString("rerank.service"),
+			Model:    viper.GetString("rerank.model"),
+		}
+		if cmd.Flags().Changed("service") {
+			options.Provider, _ = cmd.Flags().GetString("service")
+		}
+		if cmd.Flags().Changed("rerank-model") {
+			options.Model, _ = cmd.Flags().GetString("rerank-model")
+		}
+		options.TopN, _ = cmd.Flags().GetInt("top")
+		split, _ := cmd.Flags().GetString("split")
+		format, _ := cmd.Flags().GetString("format")
+		scores, _ := cmd.Flags().GetBool("scores")
+
+		results, err := executeRerank(args[0], args[1:], split, options)
+		if err != nil {
+			log.Fatalf("Error executing rerank command: %v", err)
+		}
+
+		switch format {
+		case "json":
+			out := make([]rerankOutput, len(results))
+			for i, r := range results {
+				out[i] = rerankOutput{Index: r.Index, Score: r.Score, Document: r.Document}
+			}
+			b, err := json.MarshalIndent(out, "", "  ")
+			if err != nil {
+				log.Fatalf("Error executing rerank command: %v", err)
+			}
+			fmt.Println(string(b))
+		case "text":
+			for i, r := range results {
+				if split == rerankSplitParagraph && i > 0 {
+					fmt.Println()
+				}
+				if scores {
+					fmt.Printf("%.4f\t", r.Score)
+				}
+				fmt.Println(r.Document)
+			}
+		default:
+			log.Fatalf("Error executing rerank command: unknown --format %q (use text or json)", format)
+		}
+	},
+}
+
+// executeRerank reads the documents and reranks them by relevance to the query.
+func executeRerank(query string, files []string, split string, options sqirvy.RerankOptions) ([]sqirvy.RerankResult, error) {
+	documents, err := readRerankDocuments(files, split)
+	if err != nil {
+		return nil, err
+	}
+	if len(documents) == 0 {
+		return nil, fmt.Errorf("error: no documents to rerank on stdin or in the files")
+	}
+
+	service := options.Provider
+	if service == "" {
+		service = sqirvy.RerankCohere
+	}
+	if err := loadAPIKey(service); err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	results, err := sqirvy.Rerank(context.Background(), query, documents, options)
+	if err != nil {
+		return nil, fmt.Errorf("error: %w", err)
+	}
+	slog.Debug("Reranked documents", "service", service, "documents", len(documents), "duration", time.Since(start).Round(time.Millisecond))
+	return results, nil
+}
+
+// readRerankDocuments returns the documents of stdin, split into lines or
+// paragraphs, followed by the contents of the files.
+func readRerankDocuments(files []string, split string) ([]string, error) {
+	var separator *regexp.Regexp
+	switch split {
+	case rerankSplitLine:
+		separator = regexp.MustCompile(`\r?\n`)
+	case rerankSplitParagraph:
+		separator = paragraphSeparator
+	default:
+		return nil, fmt.Errorf("error: unknown --split %q (use line or paragraph)", split)
+	}
+
+	var documents []string
+	pipe, err := util.IsFromStdin()
+	if err != nil {
+		return nil, fmt.Errorf("error: reading stdin: %w", err)
+	}
+	if pipe {
+		// read stdin as is: util.ReadStdin wraps it in a code fence
+		data, err := io.ReadAll(io.LimitReader(os.Stdin, MaxInputTotalBytes+1))
+		if err != nil {
+			return nil, fmt.Errorf("error: reading stdin: %w", err)
+		}
+		if len(data) > MaxInputTotalBytes {
+			return nil, fmt.Errorf("error: stdin exceeds limit of %d bytes", MaxInputTotalBytes)
+		}
+		for _, doc := range separator.Split(string(data), -1) {
+			if doc = strings.TrimSpace(doc); doc != "" {
+				documents = append(documents, doc)
+			}
+		}
+	}
+	for _, file := range files {
+		data, _, err := util.ReadFile(file, MaxInputTotalBytes)
+		if err != nil {
+			return nil, fmt.Errorf("error: failed to read file %s: %w", file, err)
+		}
+		documents = append(documents, string(data))
+	}
+	return documents, nil
+}
+
+// rerankUsage prints the usage instructions for the rerank command.
+func rerankUsage(cmd *cobra.Command) error {
+	fmt.Println("Usage: stdin | sqirvy-cli rerank [--service cohere|voyage|jina] [--top n] [--split line|paragraph] [--format text|json] query [file...]")
+	fmt.Println("\nFlags:")
+	cmd.Flags().PrintDefaults()
+	return nil
+}
+
+// init registers the rerank command with the root command.
+func init() {
+	rerankCmd.Flags().String("service", "", "Rerank service: cohere, voyage or jina (default rerank.service, else cohere)")
+	rerankCmd.Flags().String("rerank-model", "", "Rerank model, e.g. rerank-2 (default rerank.model, else the default of the service)")
+	rerankCmd.Flags().Int("top", 0, "Print only the n most relevant documents, 0 for all")
+	rerankCmd.Flags().String("split", rerankSplitLine, "Split stdin into documents by line or paragraph")
+	rerankCmd.Flags().String("format", "text", "Output format: text (the documents) or json (with indexes and scores)")
+	rerankCmd.Flags().Bool("scores", false, "Print the score before each document in text format")
+	rootCmd.AddCommand(rerankCmd)
+	rerankCmd.SetUsageFunc(rerankUsage)
+}
@@ -4,11 +4,12 @@ Copyright © 2025 David Howard  dmh2000@gmail.com
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
+	"os"
 
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 // reviewCmd represents the command to request a code review from the LLM.
@@ -25,26 +26,128 @@ The prompt is constructed in this order:
     An internal system prompt for code review
     Input from stdin
     Any number of filename or url arguments
+--lang and --framework name the language and framework of the code; without
+--lang the language is detected from the file extensions.
+With --format sarif, the review is output as SARIF 2.1.0 with a result for each
+finding, with its file, line, severity and rule, for GitHub code scanning.
+With --format json, the findings are output as JSON with their counts by severity.
+--lint adds the issues of a golangci-lint JSON or SARIF report, and --coverage the
+coverage of a Go coverage profile, to the prompt, so the review can focus on them.
+Review rules are read from --rules, or from .sqirvy-review.yaml in the current
+directory or its nearest parent that has one: focus areas, rules or categories to
+ignore, severities of rules and instructions are added to the review prompt, and
+ignored rules and severities are applied to the findings.
+With --fail-on critical, high, medium or any, the counts are also written to
+stderr as JSON, and the exit status is 1 if any finding is at or above that severity.
 `,
 	Run: func(cmd *cobra.Command, args []string) {
 		// get arg/config params
-		model := viper.GetString("model")
-		temperature := viper.GetFloat64("temperature")
+		model := commandModel(cmd)
+		temperature := commandTemperature(cmd)
+		format := commandFormat(cmd)
+		failOn, _ := cmd.Flags().GetString("fail-on")
+		watch, _ := cmd.Flags().GetBool("watch")
 
-		// Execute the query using the specific code review prompt
-		response, err := executeQuery(model, temperature, reviewPrompt, args)
+		if format != "markdown" && format != "sarif" && format != "json" {
+			log.Fatalf("Error executing review command: unknown format %q (use markdown, sarif or json)", format)
+		}
+		if failOn != "" {
+			if _, ok := failOnSeverities[failOn]; !ok {
+				log.Fatalf("Error executing review command: unknown --fail-on %q (use critical, high, medium or any)", failOn)
+			}
+			if format == "markdown" {
+				log.Fatalf("Error executing review command: --fail-on requires --format sarif or json")
+			}
+			if watch {
+				log.Fatalf("Error executing review command: --fail-on cannot be used with --watch")
+			}
+		}
+
+		rulesFile, _ := cmd.Flags().GetString("rules")
+		rules, err := readReviewRules(rulesFile)
+		if err != nil {
+			log.Fatalf("Error executing review command: %v", err)
+		}
+
+		if format == "markdown" {
+			// Execute the query using the specific code review prompt, running it again on
+			// changes with --watch
+			runOrWatch(cmd, args, func(args []string) (string, error) {
+				tools, err := toolOutputContext(cmd, args)
+				if err != nil {
+					return "", err
+				}
+				return executeQuery(model, temperature, reviewPrompt+languageHint(cmd, args)+tools+rules.prompt(), args)
+			})
+			return
+		}
+
+		findings := func(args []string) (reviewFindings, error) {
+			tools, err := toolOutputContext(cmd, args)
+			if err != nil {
+				return reviewFindings{}, err
+			}
+			review, err := executeReviewFindings(model, temperature, reviewFindingsPrompt+languageHint(cmd, args)+tools+rules.prompt(), args)
+			if err != nil {
+				return reviewFindings{}, err
+			}
+			review.Findings = rules.apply(review.Findings)
+			return review, nil
+		}
+
+		if failOn == "" {
+			runOrWatch(cmd, args, func(args []string) (string, error) {
+				review, err := findings(args)
+				if err != nil {
+					return "", err
+				}
+				return formatReview(format, review)
+			})
+			return
+		}
+
+		var review reviewFindings
+		out, err := notifyingRun(cmd, postingRun(cmd, func(args []string) (string, error) {
+			var err error
+			if review, err = findings(args); err != nil {
+				return "", err
+			}
+			return formatReview(format, review)
+		}))(args)
+		if err != nil {
+			log.Fatalf("Error executing review command: %v", err)
+		}
+		fmt.Println(out)
+
+		// the counts go to stderr, so CI jobs can read them without parsing the report
+		counts := countFindings(review.Findings, failOn)
+		b, err := json.Marshal(counts)
 		if err != nil {
 			log.Fatalf("Error executing review command: %v", err)
 		}
-		// Print the LLM response (the review) to standard output
-		fmt.Print(response)
-		fmt.Println() // Ensure a newline at the end
+		fmt.Fprintln(os.Stderr, string(b))
+		if counts.Failed {
+			os.Exit(1)
+		}
 	},
 }
 
+// formatReview returns the review findings in the output format, sarif or json.
+func formatReview(format string, review reviewFindings) (string, error) {
+	if format == "sarif" {
+		return formatSARIF(review.Findings)
+	}
+	out := reviewOutput{Summary: review.Summary, Counts: countFindings(review.Findings, ""), Findings: review.Findings}
+	b, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("error: encoding review: %w", err)
+	}
+	return string(b), nil
+}
+
 // reviewUsage prints the usage instructions for the review command.
 func reviewUsage(cmd *cobra.Command) error {
-	fmt.Println("Usage: stdin | sqirvy-cli review [flags] [files| urls]")
+	fmt.Println("Usage: stdin | sqirvy-cli review [--format markdown|sarif|json] [--fail-on critical|high|medium|any] [--rules file] [--lint report.json] [--coverage cover.out] [flags] [files| urls]")
 	fmt.Println("\nFlags:")
 	cmd.Flags().PrintDefaults()
 	return nil
@@ -54,4 +157,9 @@ func reviewUsage(cmd *cobra.Command) error {
 func init() {
 	rootCmd.AddCommand(reviewCmd)
 	reviewCmd.SetUsageFunc(reviewUsage)
+	addLanguageFlags(reviewCmd)
+	addToolOutputFlags(reviewCmd)
+	reviewCmd.Flags().String("format", "markdown", "Output format: markdown, sarif or json")
+	reviewCmd.Flags().String("rules", "", "Review rules file (default is .sqirvy-review.yaml in the current directory or a parent)")
+	reviewCmd.Flags().String("fail-on", "", "Exit with status 1 if a finding is at or above this severity: critical, high, medium or any")
 }
@@ -0,0 +1,158 @@
+// Package cmd implements the review rules file, .sqirvy-review.yaml, which lets a
+// team encode its review standards once instead of adding them to every prompt.
+// The file declares focus areas, rules to ignore, severities of rules and custom
+// instructions. They are added to the review prompt, and ignored rules and
+// severities are also applied to structured findings.
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// reviewRulesFileName is the name of the review rules file, which is looked up in
+// the current directory and its parents.
+const reviewRulesFileName = ".sqirvy-review.yaml"
+
+// reviewRules is the layout of the review rules file, e.g.
+//
+//	focus: [security, error handling]
+//	ignore: [line-length, style]
+//	severity:
+//	  unchecked-error: high
+//	instructions: |
+//	  Errors are wrapped with fmt.Errorf and %w.
+type reviewRules struct {
+	Focus        []string          `yaml:"focus"`        // areas the review concentrates on
+	Ignore       []string          `yaml:"ignore"`       // rule IDs or categories that are not reported
+	Severity     map[string]string `yaml:"severity"`     // severity of findings of a rule ID
+	Instructions string            `yaml:"instructions"` // added to the review prompt as written
+}
+
+// findReviewRulesFile returns the path of the review rules file in the current
+// directory or the nearest parent that has one, or an empty string if there is none.
+func findReviewRulesFile() string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	for {
+		path := filepath.Join(dir, reviewRulesFileName)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// readReviewRules loads the rules file at path, or the rules file found by
+// findReviewRulesFile if path is empty. Without a rules file the rules are empty.
+func readReviewRules(path string) (reviewRules, error) {
+	if path == "" {
+		path = findReviewRulesFile()
+		if path == "" {
+			return reviewRules{}, nil
+		}
+	}
+	slog.Debug("Using review rules", "file", path)
+	return loadReviewRules(path)
+}
+
+// loadReviewRules reads and checks a review rules file. Rule IDs are normalized
+// like the rule IDs of findings and severities are mapped to review severities.
+func loadReviewRules(path string) (reviewRules, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return reviewRules{}, fmt.Errorf("error: review rules file %s does not exist", path)
+		}
+		return reviewRules{}, fmt.Errorf("error: reading review rules file %s: %w", path, err)
+	}
+
+	// rule IDs may contain dots, so the file is decoded directly rather than
+	// through viper, which treats dots as key separators
+	var rules reviewRules
+	if err := yaml.Unmarshal(data, &rules); err != nil {
+		return reviewRules{}, fmt.Errorf("error: parsing review rules file %s: %w", path, err)
+	}
+
+	for i, rule := range rules.Ignore {
+		rules.Ignore[i] = normalizeRuleID(rule)
+	}
+	severities := make(map[string]string, len(rules.Severity))
+	for rule, severity := range rules.Severity {
+		mapped, ok := severityAliases[strings.ToLower(strings.TrimSpace(severity))]
+		if !ok {
+			return reviewRules{}, fmt.Errorf("error: review rules file %s: unknown severity %q of rule %s (use critical, high, medium or low)", path, severity, rule)
+		}
+		severities[normalizeRuleID(rule)] = mapped
+	}
+	rules.Severity = severities
+	rules.Instructions = strings.TrimSpace(rules.Instructions)
+	return rules, nil
+}
+
+// prompt returns the text added to the review prompt for the rules, or an empty
+// string if there are no rules.
+func (r reviewRules) prompt() string {
+	var lines []string
+	if len(r.Focus) > 0 {
+		lines = append(lines, "- Focus the review on: "+strings.Join(r.Focus, ", ")+".")
+	}
+	if len(r.Ignore) > 0 {
+		lines = append(lines, "- Do not report problems of these rules or categories: "+strings.Join(r.Ignore, ", ")+".")
+	}
+	rules := make([]string, 0, len(r.Severity))
+	for rule := range r.Severity {
+		rules = append(rules, rule)
+	}
+	sort.Strings(rules)
+	for _, rule := range rules {
+		lines = append(lines, fmt.Sprintf("- Report problems of the rule %s with severity %s.", rule, r.Severity[rule]))
+	}
+	if len(lines) == 0 && r.Instructions == "" {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString("\n\n# Team review rules\n\nFollow these rules of the team, they take precedence over the guidelines above:\n\n")
+	if len(lines) > 0 {
+		b.WriteString(strings.Join(lines, "\n"))
+		b.WriteString("\n")
+	}
+	if r.Instructions != "" {
+		b.WriteString("\n")
+		b.WriteString(r.Instructions)
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// apply removes the normalized findings of ignored rules and categories, which
+// the model may report anyway, and sets the severities of the rules.
+func (r reviewRules) apply(findings []reviewFinding) []reviewFinding {
+	applied := make([]reviewFinding, 0, len(findings))
+	for _, f := range findings {
+		if slices.Contains(r.Ignore, f.Rule) || (f.Category != "" && slices.Contains(r.Ignore, f.Category)) {
+			slog.Debug("Ignoring review finding", "rule", f.Rule, "file", f.File, "line", f.Line)
+			continue
+		}
+		if severity, ok := r.Severity[f.Rule]; ok {
+			f.Severity = severity
+		}
+		applied = append(applied, f)
+	}
+	return applied
+}
@@ -0,0 +1,162 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadReviewRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		want    reviewRules
+		wantErr string
+	}{
+		{
+			name: "all sections",
+			file: "focus: [security, error handling]\nignore: [Line Length, style]\nseverity:\n  Unchecked Error: major\n  go.vet: low\ninstructions: |\n  Wrap errors with %w.\n",
+			want: reviewRules{
+				Focus:        []string{"security", "error handling"},
+				Ignore:       []string{"line-length", "style"},
+				Severity:     map[string]string{"unchecked-error": severityHigh, "go.vet": severityLow},
+				Instructions: "Wrap errors with %w.",
+			},
+		},
+		{
+			name: "empty",
+			file: "",
+			want: reviewRules{Severity: map[string]string{}},
+		},
+		{
+			name:    "unknown severity",
+			file:    "severity:\n  nil-deref: urgent\n",
+			wantErr: `unknown severity "urgent" of rule nil-deref`,
+		},
+		{
+			name:    "invalid yaml",
+			file:    "focus: [security\n",
+			wantErr: "error: parsing review rules file",
+		},
+		{
+			name:    "wrong type",
+			file:    "ignore: style\n",
+			wantErr: "error: parsing review rules file",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), reviewRulesFileName)
+			if err := os.WriteFile(path, []byte(tt.file), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := loadReviewRules(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("loadReviewRules() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadReviewRules() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("loadReviewRules() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadReviewRulesMissing(t *testing.T) {
+	_, err := loadReviewRules(filepath.Join(t.TempDir(), reviewRulesFileName))
+	if err == nil || !strings.Contains(err.Error(), "does not exist") {
+		t.Errorf("loadReviewRules() error = %v, want a missing file error", err)
+	}
+}
+
+func TestReadReviewRulesFromParent(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, reviewRulesFileName), []byte("focus: [security]\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	sub := filepath.Join(root, "pkg", "db")
+	if err := os.MkdirAll(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(sub)
+
+	rules, err := readReviewRules("")
+	if err != nil {
+		t.Fatalf("readReviewRules() error = %v", err)
+	}
+	if !reflect.DeepEqual(rules.Focus, []string{"security"}) {
+		t.Errorf("readReviewRules() focus = %v, want the rules of the parent directory", rules.Focus)
+	}
+}
+
+func TestReviewRulesApply(t *testing.T) {
+	rules := reviewRules{
+		Ignore:   []string{"line-length", "style"},
+		Severity: map[string]string{"unchecked-error": severityHigh},
+	}
+
+	tests := []struct {
+		name    string
+		finding reviewFinding
+		want    []reviewFinding
+	}{
+		{
+			name:    "ignored rule",
+			finding: reviewFinding{Rule: "line-length", Category: "bugs", Severity: severityLow},
+			want:    []reviewFinding{},
+		},
+		{
+			name:    "ignored category",
+			finding: reviewFinding{Rule: "naming", Category: "style", Severity: severityLow},
+			want:    []reviewFinding{},
+		},
+		{
+			name:    "severity of the rule",
+			finding: reviewFinding{Rule: "unchecked-error", Category: "bugs", Severity: severityLow},
+			want:    []reviewFinding{{Rule: "unchecked-error", Category: "bugs", Severity: severityHigh}},
+		},
+		{
+			name:    "other rule unchanged",
+			finding: reviewFinding{Rule: "nil-deref", Category: "bugs", Severity: severityMedium},
+			want:    []reviewFinding{{Rule: "nil-deref", Category: "bugs", Severity: severityMedium}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rules.apply([]reviewFinding{tt.finding}); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("apply() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReviewRulesPrompt(t *testing.T) {
+	if got := (reviewRules{}).prompt(); got != "" {
+		t.Errorf("prompt() of no rules = %q, want empty", got)
+	}
+
+	rules := reviewRules{
+		Focus:        []string{"security"},
+		Ignore:       []string{"style"},
+		Severity:     map[string]string{"b-rule": severityLow, "a-rule": severityHigh},
+		Instructions: "Wrap errors with %w.",
+	}
+	want := "\n\n# Team review rules\n\nFollow these rules of the team, they take precedence over the guidelines above:\n\n" +
+		"- Focus the review on: security.\n" +
+		"- Do not report problems of these rules or categories: style.\n" +
+		"- Report problems of the rule a-rule with severity high.\n" +
+		"- Report problems of the rule b-rule with severity low.\n" +
+		"\nWrap errors with %w.\n"
+	if got := rules.prompt(); got != want {
+		t.Errorf("prompt() = %q, want %q", got, want)
+	}
+}
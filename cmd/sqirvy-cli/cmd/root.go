@@ -4,19 +4,32 @@ Copyright © 2025 David Howard  dmh2000@gmail.com
 package cmd
 
 import (
+	"errors"
 	"fmt"
+	"log/slog"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	sqirvy "github.com/dmh2000/sqirvy-cli/pkg/sqirvy"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
 
 var cfgFile string
-var defaultPrompt = "Hello"
 
-const defaultModel = "gemini-2.5-flash-preview-04-17"
 const defaultTemperature = 0.5
 
+// envPrefix is the prefix of environment variables that set flags and config keys,
+// e.g. SQIRVY_MODEL. Dashes and dots in keys become underscores.
+const envPrefix = "SQIRVY"
+
+var envKeyReplacer = strings.NewReplacer("-", "_", ".", "_")
+
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "sqirvy-cli [command] [flags] [files| urls]",
@@ -31,6 +44,7 @@ var rootCmd = &cobra.Command{
    - The "code" command is used to send a prompt to the LLM and receive source code in response.
    - The "review" command is used to send a prompt to the LLM and receive a code review in response.
    - Sqirvy-cli is designed to support terminal command pipelines. 
+   - An unknown command foo runs the plugin sqirvy-cli-foo from the PATH, with the global flags in SQIRVY_* variables.
 	`,
 	// Run defines the behavior when the root command is executed without subcommands.
 	// It defaults to executing the 'query' command with the provided arguments.
@@ -50,8 +64,16 @@ var rootCmd = &cobra.Command{
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
+// The provider clients are closed when the command returns. An unknown command
+// runs the plugin of the same name from the PATH, if there is one.
 func Execute() {
+	if code, ok := runPlugin(os.Args[1:]); ok {
+		os.Exit(code)
+	}
 	err := rootCmd.Execute()
+	if cerr := clients.Close(); cerr != nil {
+		slog.Warn("Closing provider clients failed", "error", cerr)
+	}
 	if err != nil {
 		os.Exit(1)
 	}
@@ -61,19 +83,95 @@ func Execute() {
 // It defines flags common to all commands, such as model selection and temperature.
 func init() {
 	// Register the initConfig function to run when Cobra initializes.
-	cobra.OnInitialize(initConfig)
+	cobra.OnInitialize(initConfig, initModels, initConfigCheck, initHTTP, initRateLimits, initCircuit, initBudget, initMemo, initMock, initAudit)
 
 	// Define persistent flags available to the root command and all subcommands.
-	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.config/sqirvy-cli/config.yaml)") // Example if config file flag was used
+	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $SQIRVY_CONFIG or config.yaml in the config directory, e.g. $HOME/.config/sqirvy-cli)") // Example if config file flag was used
+	rootCmd.MarkPersistentFlagFilename("config", "yaml", "yml")
+
+	rootCmd.PersistentFlags().String("profile", "", "named profile from the config file (default is $SQIRVY_PROFILE)")
+	viper.BindPFlag("profile", rootCmd.PersistentFlags().Lookup("profile")) // Bind flag to Viper config
+	rootCmd.RegisterFlagCompletionFunc("profile", completeProfiles)
 
-	rootCmd.PersistentFlags().StringVar(&defaultPrompt, "default-prompt", "Hello", "Default prompt if no stdin/args provided")
+	rootCmd.PersistentFlags().String("models-file", "", "model registry file merged over the built-in models (default is models.yaml in the config directory)")
+	rootCmd.MarkPersistentFlagFilename("models-file", "yaml", "yml")
+	viper.BindPFlag("models-file", rootCmd.PersistentFlags().Lookup("models-file")) // Bind flag to Viper config
+
+	rootCmd.PersistentFlags().String("default-prompt", "Hello", "Prompt sent with --allow-empty when there is no stdin and no file or URL arguments")
 	viper.BindPFlag("default-prompt", rootCmd.PersistentFlags().Lookup("default-prompt")) // Bind flag to Viper config
+	rootCmd.PersistentFlags().StringP("prompt-text", "p", "", "Prompt text, sent before stdin and the file and URL arguments, e.g. -p \"what is a goroutine\"")
+	rootCmd.PersistentFlags().Bool("allow-empty", false, "Send the default prompt when there is no stdin and no file or URL arguments, instead of failing")
 
-	rootCmd.PersistentFlags().StringP("model", "m", defaultModel, "LLM model to use (e.g., gpt-4o, claude-3-5-sonnet-latest)")
+	rootCmd.PersistentFlags().StringP("model", "m", "", "LLM model to use, e.g. gpt-4o (default model in the config file, $SQIRVY_MODEL, or a model of the first provider with an API key)")
 	viper.BindPFlag("model", rootCmd.PersistentFlags().Lookup("model")) // Bind flag to Viper config
+	rootCmd.RegisterFlagCompletionFunc("model", completeModels)
+
+	rootCmd.PersistentFlags().String("provider", "", "Provider for models that are not registered (anthropic, gemini, openai, llama)")
+	viper.BindPFlag("provider", rootCmd.PersistentFlags().Lookup("provider")) // Bind flag to Viper config
+	rootCmd.RegisterFlagCompletionFunc("provider", completeProviders)
 
-	rootCmd.PersistentFlags().Float32P("temperature", "t", defaultTemperature, "LLM temperature (randomness) to use (0.0 to 1.0)")
+	rootCmd.PersistentFlags().Float32P("temperature", "t", defaultTemperature, "LLM temperature (randomness) to use (0.0 to 1.0, see --temperature-scale)")
 	viper.BindPFlag("temperature", rootCmd.PersistentFlags().Lookup("temperature")) // Bind flag to Viper config
+
+	rootCmd.PersistentFlags().String("temperature-scale", temperatureScaleUnit, "Scale of --temperature: unit (0 to 1), percent (0 to 100) or native (the provider range, e.g. 0 to 2 for OpenAI)")
+	viper.BindPFlag("temperature-scale", rootCmd.PersistentFlags().Lookup("temperature-scale")) // Bind flag to Viper config
+
+	rootCmd.PersistentFlags().Float64("budget", 0, "Maximum cost in USD of all queries in this run, 0 for no limit")
+	viper.BindPFlag("budget.per_run", rootCmd.PersistentFlags().Lookup("budget")) // Bind flag to Viper config
+
+	rootCmd.PersistentFlags().String("redact", redactOff, "Redact API keys, passwords, emails and the patterns of the config file from prompts: mask, warn, block or off")
+	viper.BindPFlag("redact.mode", rootCmd.PersistentFlags().Lookup("redact")) // Bind flag to Viper config
+
+	rootCmd.PersistentFlags().String("record", "", "Record provider requests and responses to a cassette file")
+	rootCmd.PersistentFlags().String("replay", "", "Answer provider requests from a cassette file recorded with --record")
+	rootCmd.MarkFlagsMutuallyExclusive("record", "replay")
+
+	rootCmd.PersistentFlags().BoolP("quiet", "q", false, "Show only warnings and errors on stderr")
+	rootCmd.PersistentFlags().CountP("verbose", "v", "Show timings with -v and details with -vv on stderr")
+	rootCmd.MarkFlagsMutuallyExclusive("quiet", "verbose")
+
+	rootCmd.PersistentFlags().String("log-format", "text", "Format of the messages on stderr: text or json")
+	viper.BindPFlag("log-format", rootCmd.PersistentFlags().Lookup("log-format")) // Bind flag to Viper config
+
+	rootCmd.PersistentFlags().String("debug-http", "", "Write provider requests and responses, API keys redacted, to stderr or to the given file")
+	rootCmd.PersistentFlags().Lookup("debug-http").NoOptDefVal = "-"
+
+	rootCmd.PersistentFlags().StringArray("var", nil, "Template variable key=value for prompts from stdin and files; enables templating (can be repeated)")
+	rootCmd.PersistentFlags().Bool("template", false, "Render prompts from stdin and files as Go templates, with the variables of --var and the vars config section")
+
+	rootCmd.PersistentFlags().String("stdin-format", stdinFormatText, "Format of stdin: text (a prompt) or json (a request with system, messages, files and options)")
+
+	rootCmd.PersistentFlags().Bool("force-binary", false, "Include binary file arguments as the hexdump of their header instead of skipping them")
+
+	rootCmd.PersistentFlags().StringArray("stop", nil, "Stop sequence: generation ends before it and it is not printed, e.g. '### END' (can be repeated)")
+	viper.BindPFlag("stop", rootCmd.PersistentFlags().Lookup("stop")) // Bind flag to Viper config
+
+	rootCmd.PersistentFlags().Int64("seed", 0, "Seed for reproducible sampling with OpenAI, Gemini, Meta Llama and local models; the same query and seed give the same response")
+	viper.BindPFlag("seed", rootCmd.PersistentFlags().Lookup("seed")) // Bind flag to Viper config
+
+	rootCmd.PersistentFlags().String("prefill", "", "Start of the response, which the model continues and which is printed with it, e.g. '```go' (Anthropic)")
+	viper.BindPFlag("prefill", rootCmd.PersistentFlags().Lookup("prefill")) // Bind flag to Viper config
+
+	rootCmd.PersistentFlags().Bool("memoize", false, "Answer queries identical to an earlier query of this run with its response instead of sending them again (always on for batch)")
+	viper.BindPFlag("memoize", rootCmd.PersistentFlags().Lookup("memoize")) // Bind flag to Viper config
+
+	rootCmd.PersistentFlags().StringSlice("race", nil, "Comma separated list of models that race the --model model; the first successful response is used and the other queries are cancelled")
+	viper.BindPFlag("race", rootCmd.PersistentFlags().Lookup("race")) // Bind flag to Viper config
+	rootCmd.RegisterFlagCompletionFunc("race", completeModelList)
+
+	rootCmd.PersistentFlags().Int("samples", 1, "Number of completions to generate and combine (self-consistency), in one request where the provider allows it; a temperature of 0 is raised to 0.5; --n is an alias")
+	viper.BindPFlag("samples", rootCmd.PersistentFlags().Lookup("samples")) // Bind flag to Viper config
+
+	rootCmd.PersistentFlags().String("sample-mode", sampleModeAll, "How to combine samples: all, vote (majority of JSON answers), merge or json (a JSON array)")
+	viper.BindPFlag("sample-mode", rootCmd.PersistentFlags().Lookup("sample-mode")) // Bind flag to Viper config
+
+	// --n 3 asks for 3 completions, as the n parameter of the OpenAI API
+	rootCmd.SetGlobalNormalizationFunc(func(f *pflag.FlagSet, name string) pflag.NormalizedName {
+		if name == "n" {
+			name = "samples"
+		}
+		return pflag.NormalizedName(name)
+	})
 }
 
 // configPrinted ensures the config file path is printed only once to stderr.
@@ -82,27 +180,330 @@ var configPrinted bool
 // initConfig reads in configuration settings from a config file (if found)
 // and environment variables. Viper handles the precedence (flags > env > config).
 func initConfig() {
+	// plugins pass the config file to the sqirvy-cli commands they run
+	if cfgFile == "" {
+		cfgFile = os.Getenv(envVarName("config"))
+	}
 	if cfgFile != "" {
 		// Use config file from the flag.
 		viper.SetConfigFile(cfgFile)
 	} else {
-		// Find home directory.
-		home, err := os.UserHomeDir()
+		// Search config.yaml in the config directory, and in ~/.config/sqirvy-cli
+		// if the file of an earlier version could not be moved from there.
+		dir, err := configDir()
 		cobra.CheckErr(err)
-
-		// Search config in home directory with name ".config/sqirvy-cli" (without extension).
-		viper.AddConfigPath(home + "/.config/sqirvy-cli")
+		viper.AddConfigPath(dir)
+		if legacy, err := legacyDir(); err == nil && legacy != dir {
+			viper.AddConfigPath(legacy)
+		}
 		viper.SetConfigType("yaml")
 		viper.SetConfigName("config")
 	}
 
-	viper.AutomaticEnv() // read in environment variables that match
+	// read in environment variables that match, e.g. SQIRVY_MODEL for model
+	// and SQIRVY_SAMPLE_MODE for sample-mode
+	viper.SetEnvPrefix(envPrefix)
+	viper.SetEnvKeyReplacer(envKeyReplacer)
+	viper.AutomaticEnv()
 
-	// If a config file is found, read it in.
-	if err := viper.ReadInConfig(); err == nil {
+	// If a config file is found, read it in. The logger is set up once the
+	// log format from the config file is known.
+	err := viper.ReadInConfig()
+	initLogging()
+	migrateLegacyFiles()
+	if used := viper.ConfigFileUsed(); err == nil && cfgFile == "" {
+		if _, serr := os.Stat(used); serr != nil {
+			// the file was moved to the config directory
+			if path, perr := configFileIn("config.yaml"); perr == nil {
+				viper.SetConfigFile(path)
+			}
+		}
+	}
+	if err == nil {
 		if !configPrinted {
 			configPrinted = true
-			fmt.Fprintln(os.Stderr, "Config file :", viper.ConfigFileUsed())
+			slog.Info("Config file", "path", viper.ConfigFileUsed())
+		}
+	} else if parseErr := (viper.ConfigParseError{}); errors.As(err, &parseErr) && !configPrinted {
+		configPrinted = true
+		slog.Warn("The config file is not valid YAML and is ignored", "path", viper.ConfigFileUsed(), "error", parseErr.Unwrap())
+	}
+
+	// Export the env section of the config file, e.g. API keys written by the init
+	// command. Variables already set in the environment take precedence.
+	if err := exportEnv(viper.GetStringMapString("env"), false); err != nil {
+		fmt.Fprintln(os.Stderr, "error: config file env:", err)
+		os.Exit(1)
+	}
+
+	// Apply the selected profile, if any, over the config file settings.
+	if profile := selectedProfile(); profile != "" {
+		if err := applyProfile(profile); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		slog.Info("Profile", "name", profile)
+	}
+}
+
+// initHTTP configures the proxy, CA bundle, client certificate and connection
+// pool used for provider requests from the http section of the config file, and
+// the extra headers and timeouts for each provider from the headers and timeouts
+// sections. With --record or --replay provider traffic is recorded to or replayed
+// from a cassette file, and with --debug-http it is written to stderr or a file
+// for debugging.
+func initHTTP() {
+	err := sqirvy.SetHTTPConfig(sqirvy.HTTPConfig{
+		Proxy:    viper.GetString("http.proxy"),
+		CAFile:   viper.GetString("http.ca_file"),
+		CertFile: viper.GetString("http.cert_file"),
+		KeyFile:  viper.GetString("http.key_file"),
+
+		MaxIdleConnsPerHost: viper.GetInt("http.max_idle_conns_per_host"),
+		IdleConnTimeout:     viper.GetDuration("http.idle_timeout"),
+		DisableHTTP2:        viper.GetBool("http.disable_http2"),
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error: config file http:", err)
+		os.Exit(1)
+	}
+
+	for _, provider := range sqirvy.GetProviderList() {
+		headers := viper.GetStringMapString("headers." + provider)
+		if err := sqirvy.SetProviderHeaders(provider, headers); err != nil {
+			fmt.Fprintln(os.Stderr, "error: config file headers:", err)
+			os.Exit(1)
+		}
+
+		key := "timeouts." + provider
+		timeouts := sqirvy.Timeouts{
+			Dial:           viper.GetDuration(key + ".dial"),
+			TLSHandshake:   viper.GetDuration(key + ".tls_handshake"),
+			ResponseHeader: viper.GetDuration(key + ".response_header"),
+			Total:          viper.GetDuration(key + ".total"),
+		}
+		if err := sqirvy.SetProviderTimeouts(provider, timeouts); err != nil {
+			fmt.Fprintln(os.Stderr, "error: config file timeouts:", err)
+			os.Exit(1)
+		}
+	}
+
+	record, _ := rootCmd.PersistentFlags().GetString("record")
+	replay, _ := rootCmd.PersistentFlags().GetString("replay")
+	var cassette *sqirvy.Cassette
+	switch {
+	case record != "":
+		cassette, err = sqirvy.RecordCassette(record)
+	case replay != "":
+		cassette, err = sqirvy.LoadCassette(replay)
+		sqirvy.SetReplayKeys()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+	sqirvy.SetCassette(cassette)
+
+	switch debug, _ := rootCmd.PersistentFlags().GetString("debug-http"); debug {
+	case "":
+	case "-":
+		sqirvy.SetHTTPDebug(os.Stderr)
+	default:
+		f, err := os.OpenFile(debug, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error: --debug-http:", err)
+			os.Exit(1)
+		}
+		sqirvy.SetHTTPDebug(f)
+	}
+}
+
+// initRateLimits sets the client-side rate limit of each provider from the
+// rate_limits section of the config file.
+func initRateLimits() {
+	for _, provider := range sqirvy.GetProviderList() {
+		key := "rate_limits." + provider
+		limit := sqirvy.RateLimit{
+			RequestsPerMinute: viper.GetInt(key + ".requests_per_minute"),
+			TokensPerMinute:   viper.GetInt(key + ".tokens_per_minute"),
+		}
+		if err := sqirvy.SetRateLimit(provider, limit); err != nil {
+			fmt.Fprintln(os.Stderr, "error: config file rate_limits:", err)
+			os.Exit(1)
 		}
 	}
 }
+
+// Circuit breaker defaults, used when the circuit section of the config file
+// does not set them.
+const (
+	defaultCircuitThreshold = 3
+	defaultCircuitCooldown  = time.Minute
+)
+
+// initCircuit configures the per-provider circuit breaker from the circuit section
+// of the config file. Provider health is kept in the user cache directory so that
+// every invocation, e.g. in a shell loop, sees the failures of the previous ones.
+func initCircuit() {
+	cfg := sqirvy.CircuitConfig{Threshold: defaultCircuitThreshold, Cooldown: defaultCircuitCooldown}
+	if viper.IsSet("circuit.threshold") {
+		cfg.Threshold = viper.GetInt("circuit.threshold")
+	}
+	if viper.IsSet("circuit.cooldown") {
+		cfg.Cooldown = viper.GetDuration("circuit.cooldown")
+	}
+	if err := sqirvy.SetCircuitConfig(cfg); err != nil {
+		fmt.Fprintln(os.Stderr, "error: config file circuit:", err)
+		os.Exit(1)
+	}
+
+	dir, err := cacheDir()
+	if err != nil {
+		// no cache directory, health is tracked for this process only
+		return
+	}
+	if err := sqirvy.SetHealthFile(filepath.Join(dir, "health.json")); err != nil {
+		slog.Warn(err.Error())
+	}
+}
+
+// initBudget sets the per-run budget from the --budget flag and the monthly budget
+// from the budget section of the config file. The cost of every query is recorded
+// in the spending ledger, by default next to the config file.
+func initBudget() {
+	err := sqirvy.SetBudget(sqirvy.Budget{
+		PerRun:  viper.GetFloat64("budget.per_run"),
+		Monthly: viper.GetFloat64("budget.monthly"),
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error: config file budget:", err)
+		os.Exit(1)
+	}
+	sqirvy.SetLedgerFile(ledgerFilePath())
+}
+
+// initMemo turns memoization of identical queries on with --memoize or memoize in
+// the config file. The batch command turns it on itself.
+func initMemo() {
+	sqirvy.SetMemoize(viper.GetBool("memoize"))
+}
+
+// initMock sets the response template of the mock provider from mock.response in
+// the config file or SQIRVY_MOCK_RESPONSE.
+func initMock() {
+	if err := sqirvy.SetMockResponse(viper.GetString("mock.response")); err != nil {
+		fmt.Fprintln(os.Stderr, "error: config file mock:", err)
+		os.Exit(1)
+	}
+}
+
+// ledgerFilePath returns the spending ledger file, from budget.ledger in the config
+// file or ledger.json in the data directory.
+func ledgerFilePath() string {
+	if path := viper.GetString("budget.ledger"); path != "" {
+		return path
+	}
+	return dataFileIn("ledger.json")
+}
+
+// envVarName returns the environment variable that sets a config key.
+func envVarName(key string) string {
+	return strings.ToUpper(envPrefix + "_" + envKeyReplacer.Replace(key))
+}
+
+// explicitSetting reports whether a setting was given with a flag or an environment
+// variable, rather than coming from the config file or a default.
+func explicitSetting(cmd *cobra.Command, key string) bool {
+	if cmd.Flags().Changed(key) {
+		return true
+	}
+	_, ok := os.LookupEnv(envVarName(key))
+	return ok
+}
+
+// commandModel returns the model for the command. An explicit --model flag or
+// SQIRVY_MODEL wins, then the model of the --prompt prompt, then
+// commands.<command>.model from the config file, then the global model setting,
+// then the default model of the first provider with an API key.
+func commandModel(cmd *cobra.Command) string {
+	return namedCommandModel(cmd, cmd.Name())
+}
+
+// namedCommandModel is commandModel for the named command, for commands such as
+// batch that run another command.
+func namedCommandModel(cmd *cobra.Command, name string) string {
+	key := "commands." + name + ".model"
+	if explicitSetting(cmd, "model") {
+		return viper.GetString("model")
+	}
+	if model := selectedPromptSettings().Model; model != "" {
+		return model
+	}
+	if viper.IsSet(key) {
+		return viper.GetString(key)
+	}
+	return globalModel()
+}
+
+// commandTemperature returns the temperature for the command. An explicit --temperature
+// flag or SQIRVY_TEMPERATURE wins, then the temperature of the --prompt prompt, then
+// commands.<command>.temperature from the config file, then the global temperature setting.
+func commandTemperature(cmd *cobra.Command) float64 {
+	return namedCommandTemperature(cmd, cmd.Name())
+}
+
+// namedCommandTemperature is commandTemperature for the named command.
+func namedCommandTemperature(cmd *cobra.Command, name string) float64 {
+	key := "commands." + name + ".temperature"
+	if explicitSetting(cmd, "temperature") {
+		return viper.GetFloat64("temperature")
+	}
+	if temperature := selectedPromptSettings().Temperature; temperature != nil {
+		return *temperature
+	}
+	if viper.IsSet(key) {
+		return viper.GetFloat64(key)
+	}
+	return viper.GetFloat64("temperature")
+}
+
+// stopSequences returns the stop sequences of --stop, or the stop list of the
+// config file.
+func stopSequences() []string {
+	return viper.GetStringSlice("stop")
+}
+
+// unsupportedWarned holds the options and providers already warned about.
+var unsupportedWarned sync.Map
+
+// warnUnsupported warns once per provider that it ignores an option of the query.
+func warnUnsupported(option, model string, supported func(provider string) bool) {
+	provider, err := sqirvy.GetProviderName(model)
+	if err != nil || supported(provider) {
+		return
+	}
+	if _, warned := unsupportedWarned.LoadOrStore(option+"/"+provider, true); !warned {
+		slog.Warn("The provider does not support the option, it is ignored", "option", option, "provider", provider)
+	}
+}
+
+// querySeed returns the seed of --seed, or seed in the config file, for a query of
+// the model, or nil if none is set.
+func querySeed(model string) *int64 {
+	if !viper.IsSet("seed") {
+		return nil
+	}
+	warnUnsupported("seed", model, sqirvy.SupportsSeed)
+	seed := viper.GetInt64("seed")
+	return &seed
+}
+
+// queryPrefill returns the start of the response of --prefill, or prefill in the
+// config file, for a query of the model.
+func queryPrefill(model string) string {
+	prefill := viper.GetString("prefill")
+	if prefill != "" {
+		warnUnsupported("prefill", model, sqirvy.SupportsPrefill)
+	}
+	return prefill
+}
@@ -0,0 +1,190 @@
+// Package cmd implements the SARIF output of the review command. SARIF 2.1.0 is
+// the format of static analysis results read by GitHub code scanning and other
+// tools; each review finding becomes a result of the rule it names.
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+)
+
+// sarifSchema and sarifVersion identify the SARIF version of the output.
+const (
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+	sarifVersion = "2.1.0"
+)
+
+// sarifLevels maps review severities to SARIF result levels.
+var sarifLevels = map[string]string{
+	severityCritical: "error",
+	severityHigh:     "error",
+	severityMedium:   "warning",
+	severityLow:      "note",
+}
+
+// sarifSecuritySeverities maps review severities to the security-severity scores
+// GitHub code scanning uses to rank security findings.
+var sarifSecuritySeverities = map[string]string{
+	severityCritical: "9.5",
+	severityHigh:     "8.0",
+	severityMedium:   "5.5",
+	severityLow:      "2.0",
+}
+
+// sarifLog is a SARIF document with a single run.
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID                   string              `json:"id"`
+	ShortDescription     sarifMessage        `json:"shortDescription"`
+	DefaultConfiguration sarifConfiguration  `json:"defaultConfiguration"`
+	Properties           sarifRuleProperties `json:"properties,omitzero"`
+}
+
+type sarifConfiguration struct {
+	Level string `json:"level"`
+}
+
+type sarifRuleProperties struct {
+	Tags             []string `json:"tags,omitempty"`
+	SecuritySeverity string   `json:"security-severity,omitempty"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	RuleIndex int             `json:"ruleIndex"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations,omitempty"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           sarifRegion           `json:"region"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+	EndLine   int `json:"endLine,omitempty"`
+}
+
+// formatSARIF returns the normalized findings as an indented SARIF document.
+// Rules are listed in the order they are first used, at the level of their most
+// severe finding. Findings without a file have no location.
+func formatSARIF(findings []reviewFinding) (string, error) {
+	driver := sarifDriver{
+		Name:           "sqirvy-cli",
+		InformationURI: "https://github.com/dmh2000/sqirvy-cli",
+		Rules:          []sarifRule{},
+	}
+	results := make([]sarifResult, 0, len(findings))
+	ruleIndex := make(map[string]int)
+	ruleSeverity := make(map[string]string)
+
+	for _, f := range findings {
+		index, ok := ruleIndex[f.Rule]
+		if !ok {
+			index = len(driver.Rules)
+			ruleIndex[f.Rule] = index
+			rule := sarifRule{ID: f.Rule, ShortDescription: sarifMessage{Text: f.Rule}}
+			if f.Category != "" {
+				rule.Properties.Tags = []string{f.Category}
+			}
+			driver.Rules = append(driver.Rules, rule)
+		}
+		if prev, seen := ruleSeverity[f.Rule]; !seen || severityRank(f.Severity) < severityRank(prev) {
+			ruleSeverity[f.Rule] = f.Severity
+		}
+
+		result := sarifResult{
+			RuleID:    f.Rule,
+			RuleIndex: index,
+			Level:     sarifLevels[f.Severity],
+			Message:   sarifMessage{Text: f.Message},
+		}
+		if f.File != "" {
+			result.Locations = []sarifLocation{{PhysicalLocation: sarifPhysicalLocation{
+				ArtifactLocation: sarifArtifactLocation{URI: sarifURI(f.File)},
+				Region:           sarifRegion{StartLine: f.Line, EndLine: f.EndLine},
+			}}}
+		}
+		results = append(results, result)
+	}
+
+	for i := range driver.Rules {
+		rule := &driver.Rules[i]
+		severity := ruleSeverity[rule.ID]
+		rule.DefaultConfiguration.Level = sarifLevels[severity]
+		if len(rule.Properties.Tags) > 0 && rule.Properties.Tags[0] == "security" {
+			rule.Properties.SecuritySeverity = sarifSecuritySeverities[severity]
+		}
+	}
+
+	log := sarifLog{
+		Schema:  sarifSchema,
+		Version: sarifVersion,
+		Runs:    []sarifRun{{Tool: sarifTool{Driver: driver}, Results: results}},
+	}
+	b, err := json.MarshalIndent(log, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("error: encoding SARIF: %w", err)
+	}
+	return string(b), nil
+}
+
+// severityRank returns the position of a review severity, 0 for the most severe.
+func severityRank(severity string) int {
+	switch severity {
+	case severityCritical:
+		return 0
+	case severityHigh:
+		return 1
+	case severityMedium:
+		return 2
+	default:
+		return 3
+	}
+}
+
+// sarifURI returns the artifact URI of a file: a relative reference for relative
+// paths, which SARIF consumers resolve against the repository root, or a file
+// URI for absolute paths.
+func sarifURI(file string) string {
+	if path.IsAbs(file) {
+		return (&url.URL{Scheme: "file", Path: file}).String()
+	}
+	return (&url.URL{Path: file}).String()
+}
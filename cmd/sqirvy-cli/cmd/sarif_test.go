@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestFormatSARIF(t *testing.T) {
+	tests := []struct {
+		name     string
+		findings []reviewFinding
+		want     string // the runs of the document
+	}{
+		{
+			name: "no findings",
+			want: `[{"tool": {"driver": {"name": "sqirvy-cli", "informationUri": "https://github.com/dmh2000/sqirvy-cli", "rules": []}}, "results": []}]`,
+		},
+		{
+			name: "one finding",
+			findings: []reviewFinding{
+				{File: "db/query.go", Line: 12, EndLine: 14, Severity: severityHigh, Category: "bugs", Rule: "nil-deref", Message: "rows may be nil"},
+			},
+			want: `[{
+				"tool": {"driver": {"name": "sqirvy-cli", "informationUri": "https://github.com/dmh2000/sqirvy-cli", "rules": [
+					{"id": "nil-deref", "shortDescription": {"text": "nil-deref"}, "defaultConfiguration": {"level": "error"}, "properties": {"tags": ["bugs"]}}
+				]}},
+				"results": [
+					{"ruleId": "nil-deref", "ruleIndex": 0, "level": "error", "message": {"text": "rows may be nil"},
+					 "locations": [{"physicalLocation": {"artifactLocation": {"uri": "db/query.go"}, "region": {"startLine": 12, "endLine": 14}}}]}
+				]
+			}]`,
+		},
+		{
+			name: "rule at the level of its most severe finding",
+			findings: []reviewFinding{
+				{File: "a.go", Line: 3, Severity: severityLow, Category: "security", Rule: "sql-injection", Message: "first"},
+				{File: "b.go", Line: 7, Severity: severityCritical, Category: "security", Rule: "sql-injection", Message: "second"},
+				{File: "a.go", Line: 9, Severity: severityMedium, Category: "style", Rule: "naming", Message: "third"},
+			},
+			want: `[{
+				"tool": {"driver": {"name": "sqirvy-cli", "informationUri": "https://github.com/dmh2000/sqirvy-cli", "rules": [
+					{"id": "sql-injection", "shortDescription": {"text": "sql-injection"}, "defaultConfiguration": {"level": "error"},
+					 "properties": {"tags": ["security"], "security-severity": "9.5"}},
+					{"id": "naming", "shortDescription": {"text": "naming"}, "defaultConfiguration": {"level": "warning"}, "properties": {"tags": ["style"]}}
+				]}},
+				"results": [
+					{"ruleId": "sql-injection", "ruleIndex": 0, "level": "note", "message": {"text": "first"},
+					 "locations": [{"physicalLocation": {"artifactLocation": {"uri": "a.go"}, "region": {"startLine": 3}}}]},
+					{"ruleId": "sql-injection", "ruleIndex": 0, "level": "error", "message": {"text": "second"},
+					 "locations": [{"physicalLocation": {"artifactLocation": {"uri": "b.go"}, "region": {"startLine": 7}}}]},
+					{"ruleId": "naming", "ruleIndex": 1, "level": "warning", "message": {"text": "third"},
+					 "locations": [{"physicalLocation": {"artifactLocation": {"uri": "a.go"}, "region": {"startLine": 9}}}]}
+				]
+			}]`,
+		},
+		{
+			name: "no file, no category, absolute path",
+			findings: []reviewFinding{
+				{Line: 1, Severity: severityMedium, Rule: "general", Message: "stdin"},
+				{File: "/src/my file.go", Line: 2, Severity: severityLow, Rule: "general", Message: "absolute"},
+			},
+			want: `[{
+				"tool": {"driver": {"name": "sqirvy-cli", "informationUri": "https://github.com/dmh2000/sqirvy-cli", "rules": [
+					{"id": "general", "shortDescription": {"text": "general"}, "defaultConfiguration": {"level": "warning"}}
+				]}},
+				"results": [
+					{"ruleId": "general", "ruleIndex": 0, "level": "warning", "message": {"text": "stdin"}},
+					{"ruleId": "general", "ruleIndex": 0, "level": "note", "message": {"text": "absolute"},
+					 "locations": [{"physicalLocation": {"artifactLocation": {"uri": "file:///src/my%20file.go"}, "region": {"startLine": 2}}}]}
+				]
+			}]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := formatSARIF(tt.findings)
+			if err != nil {
+				t.Fatalf("formatSARIF() error = %v", err)
+			}
+			var got map[string]any
+			if err := json.Unmarshal([]byte(out), &got); err != nil {
+				t.Fatalf("formatSARIF() is not JSON: %v", err)
+			}
+			if got["$schema"] != sarifSchema || got["version"] != sarifVersion {
+				t.Errorf("formatSARIF() schema = %v, version = %v", got["$schema"], got["version"])
+			}
+			var want any
+			if err := json.Unmarshal([]byte(tt.want), &want); err != nil {
+				t.Fatalf("invalid want: %v", err)
+			}
+			if !reflect.DeepEqual(got["runs"], want) {
+				t.Errorf("formatSARIF() runs = %s", out)
+			}
+		})
+	}
+}
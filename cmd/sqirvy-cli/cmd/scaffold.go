@@ -0,0 +1,102 @@
+/*
+Copyright © 2025 David Howard  dmh2000@gmail.com
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	util "github.com/dmh2000/sqirvy-cli/pkg/util"
+
+	"github.com/spf13/cobra"
+)
+
+// scaffoldCmd represents the command to generate a project tree from a plan.
+// The LLM writes every file of the project in the multi-file output format, which
+// is parsed and written below the output directory.
+var scaffoldCmd = &cobra.Command{
+	Use:   "scaffold",
+	Short: "Generate a multi-file project from a plan",
+	Long: `sqirvy-cli scaffold will ask the LLM to generate a complete project from a plan,
+e.g. the output of [sqirvy-cli plan], and will write its files below --out.
+The LLM writes each file between --- START FILE: path --- and --- END FILE: path ---
+markers. Paths must stay inside --out. Existing files are not replaced unless
+--force is given, and --dry-run only lists the files.
+--init runs a command in --out after the files are written, e.g. "go mod tidy".
+The paths of the files are printed to stdout.
+The prompt is constructed in this order:
+	An internal system prompt for project generation
+	Input from stdin
+	Any number of filename or url arguments
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		// get arg/config params
+		model := commandModel(cmd)
+		temperature := commandTemperature(cmd)
+		out, _ := cmd.Flags().GetString("out")
+		initCommand, _ := cmd.Flags().GetString("init")
+		force, _ := cmd.Flags().GetBool("force")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+		if out == "" {
+			log.Fatalf("Error executing scaffold command: --out is required")
+		}
+
+		response, err := executeQuery(model, temperature, scaffoldPrompt+languageHint(cmd, args), args)
+		if err != nil {
+			log.Fatalf("Error executing scaffold command: %v", err)
+		}
+		files, err := util.ParseFiles(response)
+		if err != nil {
+			log.Fatalf("Error executing scaffold command: error: parsing response: %v", err)
+		}
+
+		if !dryRun {
+			if err := util.WriteFiles(out, files, force); err != nil {
+				log.Fatalf("Error executing scaffold command: error: writing project: %v (use --force to replace existing files)", err)
+			}
+		}
+		for _, f := range files {
+			fmt.Println(filepath.Join(out, filepath.FromSlash(f.Path)))
+		}
+
+		if initCommand != "" && !dryRun {
+			if err := runInitCommand(out, initCommand); err != nil {
+				log.Fatalf("Error executing scaffold command: error: running %q: %v", initCommand, err)
+			}
+		}
+	},
+}
+
+// runInitCommand runs a shell command in dir, with its output on stderr so that
+// stdout only lists the generated files.
+func runInitCommand(dir, command string) error {
+	c := shellCommand(context.Background(), command)
+	c.Dir = dir
+	c.Stdout = os.Stderr
+	c.Stderr = os.Stderr
+	return c.Run()
+}
+
+// scaffoldUsage prints the usage instructions for the scaffold command.
+func scaffoldUsage(cmd *cobra.Command) error {
+	fmt.Println("Usage: stdin | sqirvy-cli scaffold --out dir [--init command] [--force] [--dry-run] [flags] [files| urls]")
+	fmt.Println("\nFlags:")
+	cmd.Flags().PrintDefaults()
+	return nil
+}
+
+// init registers the scaffold command with the root command and sets its custom usage function.
+func init() {
+	rootCmd.AddCommand(scaffoldCmd)
+	scaffoldCmd.SetUsageFunc(scaffoldUsage)
+	addLanguageFlags(scaffoldCmd)
+	scaffoldCmd.Flags().String("out", "", "Directory to write the project to")
+	scaffoldCmd.Flags().String("init", "", "Command to run in the project directory after writing it, e.g. \"go mod init example.com/app\"")
+	scaffoldCmd.Flags().Bool("force", false, "Replace existing files")
+	scaffoldCmd.Flags().Bool("dry-run", false, "List the files without writing them")
+}
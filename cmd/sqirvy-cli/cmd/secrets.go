@@ -0,0 +1,93 @@
+// Package cmd implements lookup of provider API keys from sources other than
+// environment variables: a configured key command, such as "pass show openai",
+// and the OS keyring (macOS keychain, Linux secret service, Windows credential manager).
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/spf13/viper"
+	"github.com/zalando/go-keyring"
+)
+
+// keyringService is the service name under which API keys are stored in the OS
+// keyring. The keyring user is the provider name.
+const keyringService = "sqirvy-cli"
+
+// providerKeyVar returns the API key environment variable of the provider, or "".
+func providerKeyVar(provider string) string {
+	for _, p := range setupProviders {
+		if p.Provider == provider {
+			return p.KeyVar
+		}
+	}
+	return ""
+}
+
+// loadAPIKey makes the provider API key available to the provider client through its
+// environment variable. A key already in the environment is used as is, otherwise
+// the key comes from key_command.<provider> in the config file, then from the OS
+// keyring. Keys are looked up only when a provider is used, so a key command that
+// prompts for a passphrase only runs when needed. It is not an error if no key is found.
+func loadAPIKey(provider string) error {
+	keyVar := providerKeyVar(provider)
+	if keyVar == "" || os.Getenv(keyVar) != "" {
+		return nil
+	}
+
+	if command := viper.GetString("key_command." + provider); command != "" {
+		key, err := runKeyCommand(command)
+		if err != nil {
+			return fmt.Errorf("error: key_command for %s: %w", provider, err)
+		}
+		return os.Setenv(keyVar, key)
+	}
+
+	key, err := keyring.Get(keyringService, provider)
+	if err != nil {
+		// no stored key, or no keyring on this system
+		return nil
+	}
+	return os.Setenv(keyVar, key)
+}
+
+// runKeyCommand runs a shell command and returns the first line of its output.
+func runKeyCommand(command string) (string, error) {
+	var c *exec.Cmd
+	if runtime.GOOS == "windows" {
+		c = exec.Command("cmd", "/C", command)
+	} else {
+		c = exec.Command("sh", "-c", command)
+	}
+	var stderr bytes.Buffer
+	c.Stderr = &stderr
+	out, err := c.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%w: %s", err, msg)
+		}
+		return "", err
+	}
+
+	// tools like pass print the secret on the first line
+	key, _, _ := strings.Cut(string(out), "\n")
+	key = strings.TrimSpace(key)
+	if key == "" {
+		return "", errors.New("command printed no key")
+	}
+	return key, nil
+}
+
+// storeAPIKey saves the provider API key in the OS keyring.
+func storeAPIKey(provider, key string) error {
+	if err := keyring.Set(keyringService, provider, key); err != nil {
+		return fmt.Errorf("error: storing %s API key in the OS keyring: %w", provider, err)
+	}
+	return nil
+}
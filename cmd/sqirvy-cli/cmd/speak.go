@@ -0,0 +1,212 @@
+/*
+Copyright © 2025 David Howard  dmh2000@gmail.com
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	sqirvy "github.com/dmh2000/sqirvy-cli/pkg/sqirvy"
+	util "github.com/dmh2000/sqirvy-cli/pkg/util"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// speakCmd represents the command to convert text to speech.
+var speakCmd = &cobra.Command{
+	Use:   "speak [file...]",
+	Short: "Convert text to speech and play it or write it to a file",
+	Long: `sqirvy-cli speak will convert the text from stdin, or from the file arguments,
+to audio with the OpenAI (OPENAI_API_KEY) or Gemini (GEMINI_API_KEY) text-to-speech
+API. The audio is played on the default audio device, or written to a file with
+--output, or to stdout with --output -. Pipelines can end in spoken output:
+	echo "Summarize the news" | sqirvy-cli query https://example.com | sqirvy-cli speak
+The defaults are set in the speak section of the config file:
+	speak:
+	  service: gemini      # openai (default) or gemini
+	  model: gemini-2.5-flash-preview-tts
+	  voice: Puck
+	  player: mpv --really-quiet   # the audio file is appended
+OpenAI produces mp3 (default), opus, aac, flac, wav or pcm, Gemini wav (default) or pcm.
+Audio is played with the player command, or afplay on macOS, ffplay, mpv, paplay
+or aplay on Linux, and PowerShell (wav only) on Windows.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		options := sqirvy.SpeechOptions{
+			Provider: viper.GetString("speak.service"),
+			Model:    viper.GetString("speak.model"),
+			Voice:    viper.GetString("speak.voice"),
+		}
+		for flag, value := range map[string]*string{"service": &options.Provider, "tts-model": &options.Model, "voice": &options.Voice} {
+			if cmd.Flags().Changed(flag) {
+				*value, _ = cmd.Flags().GetString(flag)
+			}
+		}
+		options.Format, _ = cmd.Flags().GetString("format")
+		options.Instructions, _ = cmd.Flags().GetString("instructions")
+		output, _ := cmd.Flags().GetString("output")
+
+		if err := executeSpeak(options, output, args); err != nil {
+			log.Fatalf("Error executing speak command: %v", err)
+		}
+	},
+}
+
+// executeSpeak reads the text, converts it to audio and writes or plays the audio.
+func executeSpeak(options sqirvy.SpeechOptions, output string, args []string) error {
+	text, err := readSpeakText(args)
+	if err != nil {
+		return err
+	}
+
+	if options.Provider == "" {
+		options.Provider = sqirvy.OpenAI
+	}
+	if formats := sqirvy.SpeechFormats(options.Provider); options.Format == "" && len(formats) > 0 {
+		// the default format of the service, for the extension of the audio file
+		options.Format = formats[0]
+	}
+	if err := loadAPIKey(options.Provider); err != nil {
+		return err
+	}
+	start := time.Now()
+	audio, err := sqirvy.Speak(context.Background(), text, options)
+	if err != nil {
+		return fmt.Errorf("error: %w", err)
+	}
+	slog.Debug("Generated speech", "service", options.Provider, "format", options.Format, "bytes", len(audio), "duration", time.Since(start).Round(time.Millisecond))
+
+	switch output {
+	case "":
+		return playAudio(audio, options.Format)
+	case "-":
+		_, err = os.Stdout.Write(audio)
+		return err
+	default:
+		if err := os.WriteFile(output, audio, 0o644); err != nil {
+			return fmt.Errorf("error: writing audio: %w", err)
+		}
+		return nil
+	}
+}
+
+// readSpeakText returns the text of the files, or of stdin if there are none, as is.
+func readSpeakText(args []string) (string, error) {
+	var parts []string
+	for _, arg := range args {
+		data, _, err := util.ReadFile(arg, MaxInputTotalBytes)
+		if err != nil {
+			return "", fmt.Errorf("error: failed to read file %s: %w", arg, err)
+		}
+		parts = append(parts, string(data))
+	}
+	if len(args) == 0 {
+		// read stdin as is: util.ReadStdin wraps it in a code fence
+		data, err := io.ReadAll(io.LimitReader(os.Stdin, MaxInputTotalBytes+1))
+		if err != nil {
+			return "", fmt.Errorf("error: reading stdin: %v", err)
+		}
+		if len(data) > MaxInputTotalBytes {
+			return "", fmt.Errorf("error: text exceeds limit of %d bytes", MaxInputTotalBytes)
+		}
+		parts = append(parts, string(data))
+	}
+	text := strings.TrimSpace(strings.Join(parts, "\n\n"))
+	if text == "" {
+		return "", fmt.Errorf("error: no text to speak on stdin or in the files")
+	}
+	return text, nil
+}
+
+// playAudio plays audio on the default audio device with the speak.player command
+// of the config file or the first player of the platform found on the PATH.
+func playAudio(audio []byte, format string) error {
+	f, err := os.CreateTemp("", "sqirvy-speak-*."+format)
+	if err != nil {
+		return fmt.Errorf("error: writing audio: %w", err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(audio); err != nil {
+		f.Close()
+		return fmt.Errorf("error: writing audio: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("error: writing audio: %w", err)
+	}
+
+	var c *exec.Cmd
+	if player := viper.GetString("speak.player"); player != "" {
+		c = shellCommand(context.Background(), player+" "+shellQuote(f.Name()))
+	} else if c = defaultAudioPlayer(f.Name(), format); c == nil {
+		return fmt.Errorf("error: no audio player found: set speak.player in the config file or use --output")
+	}
+	c.Stdout = os.Stderr
+	c.Stderr = os.Stderr
+	if err := c.Run(); err != nil {
+		return fmt.Errorf("error: playing audio with %s: %w", c.Path, err)
+	}
+	return nil
+}
+
+// defaultAudioPlayer returns the command that plays an audio file with the first
+// player of the platform found on the PATH, or nil if there is none.
+func defaultAudioPlayer(path, format string) *exec.Cmd {
+	var players [][]string
+	switch runtime.GOOS {
+	case "darwin":
+		players = [][]string{{"afplay"}}
+	case "windows":
+		if format == sqirvy.SpeechWAV {
+			players = [][]string{{"powershell", "-NoProfile", "-Command", "(New-Object Media.SoundPlayer $args[0]).PlaySync()"}}
+		}
+	default:
+		players = [][]string{{"ffplay", "-nodisp", "-autoexit", "-loglevel", "quiet"}, {"mpv", "--no-video", "--really-quiet"}}
+		if format == sqirvy.SpeechWAV {
+			players = append(players, []string{"paplay"}, []string{"aplay", "-q"})
+		}
+	}
+	for _, p := range players {
+		if _, err := exec.LookPath(p[0]); err == nil {
+			return exec.Command(p[0], append(p[1:], path)...)
+		}
+	}
+	return nil
+}
+
+// shellQuote quotes a path for the shell of the platform.
+func shellQuote(path string) string {
+	if runtime.GOOS == "windows" {
+		return `"` + path + `"`
+	}
+	return "'" + strings.ReplaceAll(path, "'", `'\''`) + "'"
+}
+
+// speakUsage prints the usage instructions for the speak command.
+func speakUsage(cmd *cobra.Command) error {
+	fmt.Println("Usage: stdin | sqirvy-cli speak [--service openai|gemini] [--voice voice] [--format format] [--output file] [file...]")
+	fmt.Println("\nFlags:")
+	cmd.Flags().PrintDefaults()
+	return nil
+}
+
+// init registers the speak command with the root command.
+func init() {
+	speakCmd.Flags().String("service", "", "Text-to-speech service: openai or gemini (default speak.service, else openai)")
+	speakCmd.Flags().String("tts-model", "", "Text-to-speech model, e.g. tts-1 (default speak.model, else the default of the service)")
+	speakCmd.Flags().String("voice", "", "Voice, e.g. alloy or nova for OpenAI, Kore or Puck for Gemini (default speak.voice, else the default of the service)")
+	speakCmd.Flags().String("format", "", "Audio format: mp3, opus, aac, flac, wav or pcm (default mp3 for OpenAI, wav for Gemini)")
+	speakCmd.Flags().String("instructions", "", "How to speak, e.g. \"calm and slow\"")
+	speakCmd.Flags().StringP("output", "o", "", "Write the audio to this file, or to stdout with -, instead of playing it")
+	rootCmd.AddCommand(speakCmd)
+	speakCmd.SetUsageFunc(speakUsage)
+}
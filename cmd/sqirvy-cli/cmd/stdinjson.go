@@ -0,0 +1,176 @@
+/*
+Copyright © 2025 David Howard  dmh2000@gmail.com
+*/
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	sqirvy "github.com/dmh2000/sqirvy-cli/pkg/sqirvy"
+)
+
+// Formats of stdin selected by --stdin-format
+const (
+	stdinFormatText = "text" // stdin is a prompt
+	stdinFormatJSON = "json" // stdin is a stdinRequest
+)
+
+// stdinRequest is the JSON document read from stdin with --stdin-format json, for
+// editors and scripts that would otherwise have to quote prompts for the shell:
+//
+//	{
+//	  "system": "Answer in French.",
+//	  "messages": [{"role": "user", "content": "Explain this function"}],
+//	  "files": ["main.go", {"path": "draft.go", "content": "package main ..."}],
+//	  "options": {"model": "claude-3-5-haiku-latest", "temperature": 0.2, "max_tokens": 1000}
+//	}
+//
+// All fields are optional. The system text is added to the system prompt of the
+// command. Files are added like arguments, or with their content if it is given,
+// e.g. an unsaved editor buffer. Messages are the conversation sent after the
+// files; the files are added to the first user message.
+type stdinRequest struct {
+	System   string                `json:"system"`
+	Messages []stdinRequestMessage `json:"messages"`
+	Files    []stdinRequestFile    `json:"files"`
+	Options  stdinRequestOptions   `json:"options"`
+}
+
+// stdinRequestMessage is a message of a stdinRequest.
+type stdinRequestMessage struct {
+	Role    string `json:"role"` // user, assistant or system
+	Content string `json:"content"`
+}
+
+// stdinRequestFile is a file of a stdinRequest: a path or URL, read like an
+// argument, or a path with its content.
+type stdinRequestFile struct {
+	Path    string  `json:"path"`
+	Content *string `json:"content"`
+}
+
+// UnmarshalJSON reads a file given as a string or as an object.
+func (f *stdinRequestFile) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		return json.Unmarshal(data, &f.Path)
+	}
+	type file stdinRequestFile // without the UnmarshalJSON method
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	return dec.Decode((*file)(f))
+}
+
+// stdinRequestOptions override the model, temperature and response limit of the
+// command.
+type stdinRequestOptions struct {
+	Model       string   `json:"model"`
+	Temperature *float64 `json:"temperature"`
+	MaxTokens   int64    `json:"max_tokens"`
+}
+
+// stdinFormat returns the format of stdin selected by --stdin-format.
+func stdinFormat() (string, error) {
+	format, _ := rootCmd.PersistentFlags().GetString("stdin-format")
+	switch format {
+	case "", stdinFormatText:
+		return stdinFormatText, nil
+	case stdinFormatJSON:
+		return stdinFormatJSON, nil
+	}
+	return "", fmt.Errorf("error: unknown --stdin-format %q (use text or json)", format)
+}
+
+// parseStdinRequest parses and validates the JSON request of stdin.
+func parseStdinRequest(data []byte) (*stdinRequest, error) {
+	var req stdinRequest
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		return nil, fmt.Errorf("parsing JSON request: %w", err)
+	}
+	for i, m := range req.Messages {
+		switch sqirvy.Role(m.Role) {
+		case sqirvy.RoleUser, sqirvy.RoleAssistant, sqirvy.RoleSystem:
+		default:
+			return nil, fmt.Errorf("JSON request: message %d has unknown role %q (use user, assistant or system)", i+1, m.Role)
+		}
+	}
+	for i, f := range req.Files {
+		if f.Path == "" {
+			return nil, fmt.Errorf("JSON request: file %d has no path", i+1)
+		}
+	}
+	return &req, nil
+}
+
+// readStdinRequest returns the JSON request of stdin, or nil if stdin is text or
+// is not piped.
+func readStdinRequest() (*stdinRequest, error) {
+	if format, err := stdinFormat(); err != nil || format != stdinFormatJSON {
+		return nil, err
+	}
+	if _, err := readStdinOnce(); err != nil {
+		return nil, fmt.Errorf("error: reading from stdin: %w", err)
+	}
+	return stdinJSON, nil
+}
+
+// apply overrides the model and temperature of the command with the options of
+// the request, and adds the system text of the request to the system prompt and
+// its files to the arguments.
+func (req *stdinRequest) apply(model string, temperature float64, system string, args []string) (string, float64, string, []string) {
+	if req.Options.Model != "" {
+		model = req.Options.Model
+	}
+	if req.Options.Temperature != nil {
+		temperature = *req.Options.Temperature
+	}
+	if req.System != "" {
+		system = strings.TrimSpace(system + "\n\n" + req.System)
+	}
+	for _, f := range req.Files {
+		if f.Content == nil {
+			args = append(args, f.Path)
+		}
+	}
+	return model, temperature, system, args
+}
+
+// inlineFiles returns the files of the request given with their content, framed
+// like file arguments.
+func (req *stdinRequest) inlineFiles() []string {
+	var prompts []string
+	for _, f := range req.Files {
+		if f.Content != nil {
+			prompts = append(prompts, fmt.Sprintf("--- START FILE: %s ---\n%s\n--- END FILE: %s ---", f.Path, *f.Content, f.Path))
+		}
+	}
+	return prompts
+}
+
+// query sends the conversation of the request after the system prompt, with the
+// prompts of the files and arguments added to its first user message.
+func (req *stdinRequest) query(ctx context.Context, client sqirvy.Client, system string, prompts []string, model string, options sqirvy.Options) (string, error) {
+	messages := []sqirvy.Message{{Role: sqirvy.RoleSystem, Content: system}}
+	files := strings.Join(prompts, "\n\n")
+	for _, m := range req.Messages {
+		content := m.Content
+		if sqirvy.Role(m.Role) == sqirvy.RoleUser && files != "" {
+			content = files + "\n\n" + content
+			files = ""
+		}
+		messages = append(messages, sqirvy.Message{Role: sqirvy.Role(m.Role), Content: content})
+	}
+	if files != "" {
+		messages = append(messages, sqirvy.Message{Role: sqirvy.RoleUser, Content: files})
+	}
+	response, _, err := client.QueryMessages(ctx, messages, model, options)
+	if err != nil {
+		return "", fmt.Errorf("error: querying model %s: %v", model, err)
+	}
+	return response, nil
+}
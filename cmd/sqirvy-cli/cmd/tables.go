@@ -0,0 +1,46 @@
+/*
+Copyright © 2025 David Howard  dmh2000@gmail.com
+*/
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	util "github.com/dmh2000/sqirvy-cli/pkg/util"
+
+	"github.com/spf13/viper"
+)
+
+// Defaults of the tables section of the config file
+const (
+	defaultTableMaxRows    = 200 // tables with more data rows are sampled
+	defaultTableSampleRows = 20  // rows of a sampled table
+)
+
+// tableLimits returns the number of rows above which tables are sampled, and the
+// number of rows of the sample, from the config file.
+func tableLimits() (maxRows, sampleRows int) {
+	maxRows, sampleRows = defaultTableMaxRows, defaultTableSampleRows
+	if viper.IsSet("tables.max_rows") {
+		maxRows = viper.GetInt("tables.max_rows")
+	}
+	if viper.IsSet("tables.sample_rows") {
+		sampleRows = viper.GetInt("tables.sample_rows")
+	}
+	return maxRows, sampleRows
+}
+
+// readTable returns a CSV, TSV or Excel file as a Markdown table, sampled with
+// summary statistics if it has more rows than tables.max_rows.
+func readTable(file string) (string, error) {
+	start := time.Now()
+	maxRows, sampleRows := tableLimits()
+	text, err := util.TableToMarkdown(file, MaxInputTotalBytes, maxRows, sampleRows)
+	if err != nil {
+		return "", fmt.Errorf("error: failed to read table %s: %w", file, err)
+	}
+	slog.Debug("Read table", "file", file, "bytes", len(text), "duration", time.Since(start).Round(time.Millisecond))
+	return text, nil
+}
@@ -0,0 +1,45 @@
+// Package cmd implements the temperature scales selected by --temperature-scale.
+// Temperatures are given from 0 to 1 by default, the same for every provider, or
+// from 0 to 100, or in the native range of the model's provider, e.g. 0 to 2 for
+// OpenAI, for users used to the provider conventions.
+package cmd
+
+import (
+	"fmt"
+
+	sqirvy "github.com/dmh2000/sqirvy-cli/pkg/sqirvy"
+	"github.com/spf13/viper"
+)
+
+// Temperature scales select how --temperature is interpreted.
+const (
+	temperatureScaleUnit    = "unit"    // 0 to 1 for every provider
+	temperatureScalePercent = "percent" // 0 to 100
+	temperatureScaleNative  = "native"  // the range of the provider, e.g. 0 to 2 for OpenAI
+)
+
+// queryTemperature converts a temperature on the scale set by --temperature-scale
+// to the 0 to 1 scale of sqirvy.Options for a query to the model.
+func queryTemperature(temperature float64, model string) (float32, error) {
+	scale := viper.GetString("temperature-scale")
+	var limit float64
+	switch scale {
+	case "", temperatureScaleUnit:
+		scale, limit = temperatureScaleUnit, 1
+	case temperatureScalePercent:
+		limit = 100
+	case temperatureScaleNative:
+		provider, err := sqirvy.GetProviderName(model)
+		if err != nil {
+			provider = viper.GetString("provider")
+		}
+		limit = float64(sqirvy.MaxTemperature(provider))
+	default:
+		return 0, fmt.Errorf("error: unknown temperature scale %q (use unit, percent or native)", scale)
+	}
+	if temperature < 0 || temperature > limit {
+		return 0, fmt.Errorf("error: temperature %g is out of range for model %s: must be between 0 and %g on the %s scale",
+			temperature, model, limit, scale)
+	}
+	return float32(temperature / limit), nil
+}
@@ -0,0 +1,319 @@
+// Package cmd implements the static analysis context of the review command.
+// --lint and --coverage read the output of linters and coverage tools, and a
+// compact summary of it is added to the review prompt, so the model can focus on
+// the reported issues and untested code instead of guessing where the problems are.
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	util "github.com/dmh2000/sqirvy-cli/pkg/util"
+
+	"github.com/spf13/cobra"
+)
+
+// maxLintIssues and maxCoverageFiles limit the size of the static analysis
+// context, so that large reports do not crowd out the code under review.
+const (
+	maxLintIssues    = 100
+	maxCoverageFiles = 20
+)
+
+// lintIssue is one issue reported by a linter.
+type lintIssue struct {
+	File   string
+	Line   int
+	Column int
+	Linter string
+	Text   string
+}
+
+// golangciReport is the part of the golangci-lint JSON output that is used.
+type golangciReport struct {
+	Issues []struct {
+		FromLinter string `json:"FromLinter"`
+		Text       string `json:"Text"`
+		Pos        struct {
+			Filename string `json:"Filename"`
+			Line     int    `json:"Line"`
+			Column   int    `json:"Column"`
+		} `json:"Pos"`
+	} `json:"Issues"`
+}
+
+// sarifReport is the part of a SARIF document from another tool that is used.
+type sarifReport struct {
+	Runs []struct {
+		Tool struct {
+			Driver struct {
+				Name string `json:"name"`
+			} `json:"driver"`
+		} `json:"tool"`
+		Results []struct {
+			RuleID    string          `json:"ruleId"`
+			Message   sarifMessage    `json:"message"`
+			Locations []sarifLocation `json:"locations"`
+		} `json:"results"`
+	} `json:"runs"`
+}
+
+// coverageFile is the statement coverage of one file from a Go coverage profile.
+type coverageFile struct {
+	Name       string
+	Statements int
+	Covered    int
+	Uncovered  [][2]int // line ranges of blocks that were not run
+}
+
+// addToolOutputFlags adds --lint and --coverage to a command.
+func addToolOutputFlags(cmd *cobra.Command) {
+	cmd.Flags().StringArray("lint", nil, "Linter report to add to the prompt, golangci-lint JSON or SARIF (can be repeated)")
+	cmd.Flags().String("coverage", "", "Go coverage profile to add to the prompt, e.g. cover.out from go test -coverprofile")
+}
+
+// toolOutputContext returns the text added to the system prompt for the --lint
+// and --coverage reports, or an empty string if there are none. Issues and
+// coverage of the file arguments are listed if the reports have any; otherwise
+// the whole report is summarized.
+func toolOutputContext(cmd *cobra.Command, args []string) (string, error) {
+	lintFiles, _ := cmd.Flags().GetStringArray("lint")
+	coverageProfile, _ := cmd.Flags().GetString("coverage")
+	if len(lintFiles) == 0 && coverageProfile == "" {
+		return "", nil
+	}
+
+	var b strings.Builder
+	b.WriteString("\n\n# Static analysis results\n\nThe following tool results are for the code under review. Use them to prioritize the review: confirm or dismiss the reported issues and look for bugs in code that is not covered by tests.\n")
+
+	var issues []lintIssue
+	for _, file := range lintFiles {
+		data, _, err := util.ReadFile(file, MaxInputTotalBytes)
+		if err != nil {
+			return "", fmt.Errorf("error: reading lint report: %w", err)
+		}
+		parsed, err := parseLintReport(data)
+		if err != nil {
+			return "", fmt.Errorf("error: lint report %s: %w", file, err)
+		}
+		issues = append(issues, parsed...)
+	}
+	if len(lintFiles) > 0 {
+		issues = forReviewedFiles(issues, args, func(i lintIssue) string { return i.File })
+		slices.SortStableFunc(issues, func(a, b lintIssue) int {
+			return cmp.Or(cmp.Compare(a.File, b.File), cmp.Compare(a.Line, b.Line))
+		})
+		fmt.Fprintf(&b, "\n## Linter issues (%d)\n\n", len(issues))
+		for i, issue := range issues {
+			if i == maxLintIssues {
+				fmt.Fprintf(&b, "... %d more issues\n", len(issues)-maxLintIssues)
+				break
+			}
+			fmt.Fprintf(&b, "%s:%d:%d %s: %s\n", issue.File, issue.Line, issue.Column, issue.Linter, issue.Text)
+		}
+	}
+
+	if coverageProfile != "" {
+		data, _, err := util.ReadFile(coverageProfile, MaxInputTotalBytes)
+		if err != nil {
+			return "", fmt.Errorf("error: reading coverage profile: %w", err)
+		}
+		files, err := parseCoverProfile(data)
+		if err != nil {
+			return "", fmt.Errorf("error: coverage profile %s: %w", coverageProfile, err)
+		}
+		files = forReviewedFiles(files, args, func(f coverageFile) string { return f.Name })
+		// the least covered files are the most interesting ones
+		slices.SortStableFunc(files, func(a, b coverageFile) int {
+			return cmp.Compare(coveragePercent(a), coveragePercent(b))
+		})
+		b.WriteString("\n## Test coverage\n\n")
+		for i, f := range files {
+			if i == maxCoverageFiles {
+				fmt.Fprintf(&b, "... %d more files\n", len(files)-maxCoverageFiles)
+				break
+			}
+			fmt.Fprintf(&b, "%s: %.1f%% of %d statements covered", f.Name, coveragePercent(f), f.Statements)
+			if len(f.Uncovered) > 0 {
+				b.WriteString("; not covered: lines ")
+				for j, r := range f.Uncovered {
+					if j > 0 {
+						b.WriteString(", ")
+					}
+					if r[0] == r[1] {
+						fmt.Fprintf(&b, "%d", r[0])
+					} else {
+						fmt.Fprintf(&b, "%d-%d", r[0], r[1])
+					}
+				}
+			}
+			b.WriteString("\n")
+		}
+	}
+	return b.String(), nil
+}
+
+// forReviewedFiles returns the items whose file is one of the file arguments, or
+// all items if none is. Reports often name files by import path, e.g.
+// github.com/user/repo/pkg/a.go for pkg/a.go, so a file matches an argument that
+// is a suffix of it.
+func forReviewedFiles[T any](items []T, args []string, file func(T) string) []T {
+	var matched []T
+	for _, item := range items {
+		name := filepath.ToSlash(filepath.Clean(file(item)))
+		for _, arg := range args {
+			arg = filepath.ToSlash(filepath.Clean(arg))
+			if name == arg || strings.HasSuffix(name, "/"+strings.TrimPrefix(arg, "./")) {
+				matched = append(matched, item)
+				break
+			}
+		}
+	}
+	if len(matched) == 0 {
+		return items
+	}
+	return matched
+}
+
+// parseLintReport parses golangci-lint JSON output or a SARIF document.
+func parseLintReport(data []byte) ([]lintIssue, error) {
+	var probe map[string]json.RawMessage
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return nil, fmt.Errorf("not a JSON lint report: %w", err)
+	}
+
+	var issues []lintIssue
+	switch {
+	case probe["runs"] != nil:
+		var report sarifReport
+		if err := json.Unmarshal(data, &report); err != nil {
+			return nil, fmt.Errorf("invalid SARIF: %w", err)
+		}
+		for _, run := range report.Runs {
+			for _, result := range run.Results {
+				issue := lintIssue{Linter: run.Tool.Driver.Name, Text: result.Message.Text}
+				if result.RuleID != "" {
+					issue.Linter += "/" + result.RuleID
+				}
+				if len(result.Locations) > 0 {
+					location := result.Locations[0].PhysicalLocation
+					issue.File = strings.TrimPrefix(location.ArtifactLocation.URI, "file://")
+					issue.Line = location.Region.StartLine
+				}
+				issues = append(issues, issue)
+			}
+		}
+	case probe["Issues"] != nil:
+		var report golangciReport
+		if err := json.Unmarshal(data, &report); err != nil {
+			return nil, fmt.Errorf("invalid golangci-lint JSON: %w", err)
+		}
+		for _, i := range report.Issues {
+			issues = append(issues, lintIssue{
+				File:   i.Pos.Filename,
+				Line:   i.Pos.Line,
+				Column: i.Pos.Column,
+				Linter: i.FromLinter,
+				Text:   i.Text,
+			})
+		}
+	default:
+		return nil, fmt.Errorf("unknown lint report format (use golangci-lint --out-format json or SARIF)")
+	}
+	return issues, nil
+}
+
+// parseCoverProfile parses a Go coverage profile, whose lines after the mode line
+// have the form file.go:startLine.startCol,endLine.endCol statements count.
+// Blocks listed more than once, e.g. in merged profiles, count as covered if any
+// of their counts is.
+func parseCoverProfile(data []byte) ([]coverageFile, error) {
+	type block struct {
+		statements int
+		covered    bool
+		start, end int
+	}
+	blocks := make(map[string]map[string]*block)
+	var order []string
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "mode:") {
+			continue
+		}
+		name, rest, ok := strings.Cut(line, ":")
+		fields := strings.Fields(rest)
+		if !ok || len(fields) != 3 {
+			return nil, fmt.Errorf("line %d: invalid coverage block %q", n, line)
+		}
+		start, end, ok := strings.Cut(fields[0], ",")
+		startLine, err1 := strconv.Atoi(strings.Split(start, ".")[0])
+		endLine, err2 := strconv.Atoi(strings.Split(end, ".")[0])
+		statements, err3 := strconv.Atoi(fields[1])
+		count, err4 := strconv.Atoi(fields[2])
+		if !ok || err1 != nil || err2 != nil || err3 != nil || err4 != nil {
+			return nil, fmt.Errorf("line %d: invalid coverage block %q", n, line)
+		}
+
+		if blocks[name] == nil {
+			blocks[name] = make(map[string]*block)
+			order = append(order, name)
+		}
+		b := blocks[name][fields[0]]
+		if b == nil {
+			b = &block{statements: statements, start: startLine, end: endLine}
+			blocks[name][fields[0]] = b
+		}
+		b.covered = b.covered || count > 0
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	files := make([]coverageFile, 0, len(order))
+	for _, name := range order {
+		f := coverageFile{Name: name}
+		var uncovered [][2]int
+		for _, b := range blocks[name] {
+			f.Statements += b.statements
+			if b.covered {
+				f.Covered += b.statements
+			} else if b.statements > 0 {
+				uncovered = append(uncovered, [2]int{b.start, b.end})
+			}
+		}
+		f.Uncovered = mergeRanges(uncovered)
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+// mergeRanges sorts line ranges and merges the ones that overlap or touch.
+func mergeRanges(ranges [][2]int) [][2]int {
+	slices.SortFunc(ranges, func(a, b [2]int) int { return cmp.Compare(a[0], b[0]) })
+	var merged [][2]int
+	for _, r := range ranges {
+		if n := len(merged); n > 0 && r[0] <= merged[n-1][1]+1 {
+			merged[n-1][1] = max(merged[n-1][1], r[1])
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// coveragePercent returns the percentage of statements of the file that are covered.
+func coveragePercent(f coverageFile) float64 {
+	if f.Statements == 0 {
+		return 100
+	}
+	return 100 * float64(f.Covered) / float64(f.Statements)
+}
@@ -0,0 +1,108 @@
+/*
+Copyright © 2025 David Howard  dmh2000@gmail.com
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"time"
+
+	sqirvy "github.com/dmh2000/sqirvy-cli/pkg/sqirvy"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// transcribeCmd represents the command to transcribe audio files.
+var transcribeCmd = &cobra.Command{
+	Use:   "transcribe audio-file...",
+	Short: "Transcribe audio files with a Whisper model",
+	Long: `sqirvy-cli transcribe will send each audio file to a Whisper-compatible
+transcription API and print the transcript as text or as SRT or WebVTT subtitles.
+The service is OpenAI (OPENAI_API_KEY), Groq (GROQ_API_KEY) or a local server with
+an OpenAI-compatible API, e.g. whisper.cpp, at WHISPER_BASE_URL. The defaults are
+set in the transcribe section of the config file:
+	transcribe:
+	  service: groq        # openai (default), groq or local
+	  model: whisper-large-v3
+	  language: en         # detected if not set
+Audio files (.mp3, .wav, .m4a, .ogg, .flac, .webm, ...) given as arguments to the
+other commands are transcribed the same way and added to the prompt as context:
+	echo "List the action items" | sqirvy-cli query standup.mp3
+Files of up to 25 MB are accepted.
+`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		options := transcriptionOptions()
+		if cmd.Flags().Changed("service") {
+			options.Provider, _ = cmd.Flags().GetString("service")
+		}
+		if cmd.Flags().Changed("whisper-model") {
+			options.Model, _ = cmd.Flags().GetString("whisper-model")
+		}
+		if cmd.Flags().Changed("language") {
+			options.Language, _ = cmd.Flags().GetString("language")
+		}
+		options.Format, _ = cmd.Flags().GetString("format")
+
+		for i, path := range args {
+			text, err := transcribeFile(path, options)
+			if err != nil {
+				log.Fatalf("Error executing transcribe command: %v", err)
+			}
+			if i > 0 {
+				fmt.Println()
+			}
+			fmt.Println(text)
+		}
+	},
+}
+
+// transcriptionOptions returns the transcription settings of the config file.
+func transcriptionOptions() sqirvy.TranscriptionOptions {
+	return sqirvy.TranscriptionOptions{
+		Provider: viper.GetString("transcribe.service"),
+		Model:    viper.GetString("transcribe.model"),
+		Language: viper.GetString("transcribe.language"),
+	}
+}
+
+// transcribeFile transcribes an audio file, loading the API key of the service
+// like the keys of the query providers.
+func transcribeFile(path string, options sqirvy.TranscriptionOptions) (string, error) {
+	service := options.Provider
+	if service == "" {
+		service = sqirvy.OpenAI
+	}
+	if err := loadAPIKey(service); err != nil {
+		return "", err
+	}
+	start := time.Now()
+	text, err := sqirvy.TranscribeFile(context.Background(), path, options)
+	if err != nil {
+		return "", fmt.Errorf("error: transcribing %s: %w", path, err)
+	}
+	slog.Debug("Transcribed audio", "file", path, "service", service, "bytes", len(text), "duration", time.Since(start).Round(time.Millisecond))
+	return text, nil
+}
+
+// transcribeUsage prints the usage instructions for the transcribe command.
+func transcribeUsage(cmd *cobra.Command) error {
+	fmt.Println("Usage: sqirvy-cli transcribe [--service openai|groq|local] [--format text|srt|vtt] audio-file...")
+	fmt.Println("\nFlags:")
+	cmd.Flags().PrintDefaults()
+	return nil
+}
+
+// init registers the transcribe command with the root command.
+func init() {
+	transcribeCmd.Flags().String("service", "", "Transcription service: openai, groq or local (default transcribe.service, else openai)")
+	transcribeCmd.Flags().String("whisper-model", "", "Transcription model, e.g. whisper-large-v3 (default transcribe.model, else the default of the service)")
+	transcribeCmd.Flags().String("language", "", "ISO-639-1 language of the audio, e.g. en (default transcribe.language, else detected)")
+	transcribeCmd.Flags().String("format", sqirvy.TranscriptText, "Output format: text, srt or vtt")
+	rootCmd.AddCommand(transcribeCmd)
+	transcribeCmd.SetUsageFunc(transcribeUsage)
+}
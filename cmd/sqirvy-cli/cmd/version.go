@@ -0,0 +1,167 @@
+// Package cmd implements the version command and the --version flag, which print
+// the version, commit and build date of the binary, set with -ldflags, the Go
+// version and the providers included in the build, so that bug reports say which
+// binary they are about.
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"runtime"
+	"runtime/debug"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// Build metadata, set by the Makefile with
+//
+//	go build -ldflags "-X github.com/dmh2000/sqirvy-cli/cmd/sqirvy-cli/cmd.version=v1.2.0 \
+//	  -X github.com/dmh2000/sqirvy-cli/cmd/sqirvy-cli/cmd.commit=abc1234 \
+//	  -X github.com/dmh2000/sqirvy-cli/cmd/sqirvy-cli/cmd.buildDate=2025-05-01T12:00:00Z"
+//
+// Values that are not set are taken from the build information Go records, e.g.
+// with go install or in a git checkout.
+var (
+	version   = ""
+	commit    = ""
+	buildDate = ""
+)
+
+// versionInfo is the build metadata printed by the version command.
+type versionInfo struct {
+	Version   string   `json:"version"`
+	Commit    string   `json:"commit,omitempty"`
+	Modified  bool     `json:"modified,omitempty"` // built from a checkout with local changes
+	BuildDate string   `json:"build_date,omitempty"`
+	GoVersion string   `json:"go_version"`
+	Platform  string   `json:"platform"`
+	Tags      string   `json:"tags,omitempty"` // build tags, e.g. llamacpp
+	Providers []string `json:"providers"`      // providers included in the build
+}
+
+// versionCmd prints the build metadata.
+var versionCmd = &cobra.Command{
+	Use:   "version",
+	Short: "Print the version, commit, build date, Go version and providers of this build",
+	Long: `sqirvy-cli version prints the version, commit and build date of the binary, the
+Go version and platform it was built with, its build tags and the providers it
+includes. Please add it to bug reports. --format json prints it as JSON.`,
+	Args:              cobra.NoArgs,
+	ValidArgsFunction: cobra.NoFileCompletions,
+	Run: func(cmd *cobra.Command, args []string) {
+		format, _ := cmd.Flags().GetString("format")
+		info := buildVersion()
+		switch format {
+		case "json":
+			b, err := json.MarshalIndent(info, "", "  ")
+			if err != nil {
+				log.Fatalf("Error executing version command: %v", err)
+			}
+			fmt.Println(string(b))
+		case "text":
+			fmt.Print(info.String())
+		default:
+			log.Fatalf("Error executing version command: unknown format %q (use text or json)", format)
+		}
+	},
+}
+
+// buildVersion returns the build metadata of the binary.
+func buildVersion() versionInfo {
+	info := versionInfo{
+		Version:   version,
+		Commit:    commit,
+		BuildDate: buildDate,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		if info.Version == "" && bi.Main.Version != "(devel)" {
+			info.Version = bi.Main.Version
+		}
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = s.Value
+				}
+			case "vcs.time":
+				if info.BuildDate == "" {
+					info.BuildDate = s.Value
+				}
+			case "vcs.modified":
+				info.Modified = s.Value == "true"
+			case "-tags":
+				info.Tags = s.Value
+			}
+		}
+	}
+	if info.Version == "" {
+		info.Version = "dev"
+	}
+	if len(info.Commit) > 12 {
+		info.Commit = info.Commit[:12]
+	}
+	for _, e := range listProviders() {
+		if e.Included {
+			info.Providers = append(info.Providers, e.Provider)
+		}
+	}
+	return info
+}
+
+// short returns the version and commit on one line, e.g. "v1.2.0 (abc1234)".
+func (v versionInfo) short() string {
+	s := v.Version
+	if v.Commit != "" {
+		s += " (" + v.Commit
+		if v.Modified {
+			s += ", modified"
+		}
+		s += ")"
+	}
+	return s
+}
+
+// userAgent returns the User-Agent header of requests other than provider queries,
+// e.g. "sqirvy-cli/v1.2.0".
+func userAgent() string {
+	return "sqirvy-cli/" + buildVersion().Version
+}
+
+// String returns the build metadata as aligned lines.
+func (v versionInfo) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "sqirvy-cli %s\n", v.short())
+	if v.BuildDate != "" {
+		fmt.Fprintf(&b, "built:      %s\n", v.BuildDate)
+	}
+	fmt.Fprintf(&b, "go:         %s %s\n", v.GoVersion, v.Platform)
+	if v.Tags != "" {
+		fmt.Fprintf(&b, "tags:       %s\n", v.Tags)
+	}
+	fmt.Fprintf(&b, "providers:  %s\n", strings.Join(v.Providers, ", "))
+	return b.String()
+}
+
+// versionUsage prints the usage instructions for the version command.
+func versionUsage(cmd *cobra.Command) error {
+	fmt.Println("Usage: sqirvy-cli version [--format text|json]")
+	fmt.Println("\nFlags:")
+	cmd.Flags().PrintDefaults()
+	return nil
+}
+
+// init registers the version command and the --version flag of the root command.
+func init() {
+	versionCmd.Flags().String("format", "text", "Output format: text or json")
+	rootCmd.AddCommand(versionCmd)
+	versionCmd.SetUsageFunc(versionUsage)
+
+	// cobra adds --version when the root command has a version
+	info := buildVersion()
+	rootCmd.Version = info.short()
+	rootCmd.SetVersionTemplate(info.String())
+}
@@ -0,0 +1,177 @@
+// Package cmd implements watch mode, where a command is run again every time
+// one of its input files changes.
+package cmd
+
+import (
+	"fmt"
+	"io/fs"
+	"log"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/cobra"
+)
+
+// watchDebounce is how long the files must be unchanged before the command is run
+// again, so that saving several files at once causes a single run.
+const watchDebounce = 500 * time.Millisecond
+
+// runOrWatch runs the query and prints the response, posts it with --post-to and
+// notifies with --notify. With --watch it keeps running, and runs the query again
+// each time one of the file arguments changes. Directory arguments are watched
+// recursively and replaced by the files they contain.
+func runOrWatch(cmd *cobra.Command, args []string, run func(args []string) (string, error)) {
+	run = notifyingRun(cmd, postingRun(cmd, run))
+	watch, _ := cmd.Flags().GetBool("watch")
+	if !watch {
+		response, err := run(args)
+		if err != nil {
+			log.Fatalf("Error executing %s command: %v", cmd.Name(), err)
+		}
+		// Print the LLM response to standard output
+		fmt.Print(response)
+		fmt.Println() // Ensure a newline at the end
+		return
+	}
+
+	if err := watchAndRun(args, run); err != nil {
+		log.Fatalf("Error executing %s command: %v", cmd.Name(), err)
+	}
+}
+
+// watchAndRun runs the query, then runs it again after every change to the watched
+// files until the process is interrupted. Query errors are printed and do not stop watching.
+func watchAndRun(args []string, run func(args []string) (string, error)) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("error: starting file watcher: %w", err)
+	}
+	defer watcher.Close()
+
+	runOnce := func() {
+		files, err := watchFiles(watcher, args)
+		if err != nil {
+			slog.Error(err.Error())
+			return
+		}
+		response, err := run(files)
+		if err != nil {
+			slog.Error(err.Error())
+			return
+		}
+		fmt.Print(response)
+		fmt.Println()
+	}
+
+	runOnce()
+	slog.Info("Watching for changes, press Ctrl-C to stop")
+
+	var debounce <-chan time.Time
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if event.Op == fsnotify.Chmod || !watchedPath(args, event.Name) {
+				continue
+			}
+			debounce = time.After(watchDebounce)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			slog.Warn("Watch error", "error", err)
+		case <-debounce:
+			debounce = nil
+			slog.Info("Change detected, running again", "time", time.Now().Format(time.TimeOnly))
+			runOnce()
+		}
+	}
+}
+
+// watchFiles expands directory arguments into the files they contain and adds the
+// directories of all arguments to the watcher, so that new files are noticed.
+// URL arguments and the stdin placeholder are passed through and not watched.
+func watchFiles(watcher *fsnotify.Watcher, args []string) ([]string, error) {
+	var files []string
+	for _, arg := range args {
+		if arg == stdinArg || strings.HasPrefix(arg, "http://") || strings.HasPrefix(arg, "https://") {
+			files = append(files, arg)
+			continue
+		}
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, fmt.Errorf("error: %w", err)
+		}
+		if !info.IsDir() {
+			files = append(files, arg)
+			if err := watcher.Add(filepath.Dir(arg)); err != nil {
+				return nil, fmt.Errorf("error: watching %s: %w", arg, err)
+			}
+			continue
+		}
+
+		err = filepath.WalkDir(arg, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if path != arg && ignoredPath(path) {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if d.IsDir() {
+				return watcher.Add(path)
+			}
+			if d.Type().IsRegular() {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error: watching %s: %w", arg, err)
+		}
+	}
+	return files, nil
+}
+
+// watchedPath reports whether a change to path should run the command again: the
+// path is a file argument or is inside a directory argument, and is not ignored.
+func watchedPath(args []string, path string) bool {
+	if ignoredPath(path) {
+		return false
+	}
+	path = filepath.Clean(path)
+	for _, arg := range args {
+		arg = filepath.Clean(arg)
+		if path == arg {
+			return true
+		}
+		if info, err := os.Stat(arg); err == nil && info.IsDir() {
+			if rel, err := filepath.Rel(arg, path); err == nil && !strings.HasPrefix(rel, "..") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ignoredPath reports whether changes to a path are ignored: hidden files and
+// directories such as .git, and editor backup files.
+func ignoredPath(path string) bool {
+	base := filepath.Base(path)
+	return strings.HasPrefix(base, ".") || strings.HasSuffix(base, "~")
+}
+
+// init adds the --watch flag to the commands that can be run in watch mode.
+func init() {
+	for _, c := range []*cobra.Command{queryCmd, planCmd, codeCmd, reviewCmd} {
+		c.Flags().Bool("watch", false, "Run again whenever a file or directory argument changes")
+	}
+}
@@ -0,0 +1,166 @@
+// Package cmd implements the webhook output sink. With --post-to, or post.url in
+// the config file, the response of the query, plan, code and review commands is
+// also sent as a JSON POST to a webhook, e.g. a Slack incoming webhook, an n8n
+// workflow or an internal service, so that cron jobs can publish their results
+// without a wrapper script.
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	sqirvy "github.com/dmh2000/sqirvy-cli/pkg/sqirvy"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// defaultPostTimeout limits the webhook request when post.timeout is not set.
+const defaultPostTimeout = 10 * time.Second
+
+// postPayload is the JSON document posted to the webhook. The response is in
+// text, the message field of Slack incoming webhooks, so that they can be used
+// as is; other services can use the metadata.
+type postPayload struct {
+	Text         string    `json:"text"`
+	Command      string    `json:"command"`
+	Args         []string  `json:"args"`
+	Provider     string    `json:"provider,omitempty"`
+	Model        string    `json:"model,omitempty"`
+	Seed         *int64    `json:"seed,omitempty"`
+	Fingerprint  string    `json:"system_fingerprint,omitempty"`
+	InputTokens  int64     `json:"input_tokens"`
+	OutputTokens int64     `json:"output_tokens"`
+	CostUSD      float64   `json:"cost_usd"`
+	Time         time.Time `json:"time"`
+	DurationMS   int64     `json:"duration_ms"`
+	Host         string    `json:"host"`
+	Error        string    `json:"error,omitempty"`
+}
+
+// postUsage adds up the provider, model and token usage of the queries of a run,
+// from the query recorder, with the seed and fingerprint of the last one.
+var postUsage struct {
+	sync.Mutex
+	provider     string
+	model        string
+	seed         *int64
+	fingerprint  string
+	inputTokens  int64
+	outputTokens int64
+}
+
+// recordPostUsage adds a query to the usage of the run.
+func recordPostUsage(q sqirvy.QueryRecord) {
+	postUsage.Lock()
+	defer postUsage.Unlock()
+	postUsage.provider = q.Provider
+	postUsage.model = q.Model
+	postUsage.seed, postUsage.fingerprint = q.Seed, q.Fingerprint
+	postUsage.inputTokens += q.Usage.InputTokens
+	postUsage.outputTokens += q.Usage.OutputTokens
+}
+
+// postURL returns the webhook of the command, from --post-to or post.url in the
+// config file, or an empty string.
+func postURL(cmd *cobra.Command) string {
+	if f := cmd.Flags().Lookup("post-to"); f != nil && f.Changed {
+		return f.Value.String()
+	}
+	return viper.GetString("post.url")
+}
+
+// postingRun returns run, which also posts the response, or the error, to the
+// webhook of the command if there is one. A failed post is logged and does not
+// fail the command.
+func postingRun(cmd *cobra.Command, run func(args []string) (string, error)) func(args []string) (string, error) {
+	url := postURL(cmd)
+	if url == "" {
+		return run
+	}
+	return func(args []string) (string, error) {
+		postUsage.Lock()
+		postUsage.provider, postUsage.model = "", ""
+		postUsage.seed, postUsage.fingerprint = nil, ""
+		postUsage.inputTokens, postUsage.outputTokens = 0, 0
+		postUsage.Unlock()
+		spent := sqirvy.RunSpend()
+		start := time.Now()
+
+		response, err := run(args)
+
+		payload := postPayload{
+			Text:       response,
+			Command:    auditCommand(),
+			Args:       args,
+			CostUSD:    sqirvy.RunSpend() - spent,
+			Time:       start.UTC(),
+			DurationMS: time.Since(start).Milliseconds(),
+		}
+		payload.Host, _ = os.Hostname()
+		postUsage.Lock()
+		payload.Provider, payload.Model = postUsage.provider, postUsage.model
+		payload.Seed, payload.Fingerprint = postUsage.seed, postUsage.fingerprint
+		payload.InputTokens, payload.OutputTokens = postUsage.inputTokens, postUsage.outputTokens
+		postUsage.Unlock()
+		if err != nil {
+			payload.Text = "error: " + err.Error()
+			payload.Error = err.Error()
+		}
+		if perr := postWebhook(url, payload); perr != nil {
+			slog.Warn("Posting the response to the webhook failed", "url", url, "error", perr)
+		} else {
+			slog.Info("Posted the response to the webhook", "url", url)
+		}
+		return response, err
+	}
+}
+
+// postWebhook sends the payload to the webhook with the headers of post.headers
+// in the config file, e.g. an Authorization header, within post.timeout.
+func postWebhook(url string, payload postPayload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	timeout := defaultPostTimeout
+	if viper.IsSet("post.timeout") {
+		timeout = viper.GetDuration("post.timeout")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent())
+	for k, v := range viper.GetStringMapString("post.headers") {
+		req.Header.Set(k, v)
+	}
+	resp, err := sqirvy.HTTPClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 200))
+		return fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// init adds the --post-to flag to the commands whose response can be posted.
+func init() {
+	for _, c := range []*cobra.Command{queryCmd, planCmd, codeCmd, reviewCmd} {
+		c.Flags().String("post-to", "", "Also POST the response and its metadata as JSON to this webhook URL (default is post.url in the config file)")
+	}
+}
@@ -4,7 +4,7 @@
 // AI model providers.
 package main
 
-import "dmh2000/sqirvy-cli/cmd/sqirvy-cli/cmd"
+import "github.com/dmh2000/sqirvy-cli/cmd/sqirvy-cli/cmd"
 
 func main() {
 	cmd.Execute()
@@ -62,8 +62,8 @@ query="what is the sum of 1 + 2 + 3"
 mkdir -p $TESTDIR
 
 echo "-------------------------------"
-echo "sqirvy no flags or args"
-check_return_code                 $TARGET                                             >$TESTDIR/no-flags-or-args.md
+echo "sqirvy no flags or args, with the default prompt"
+check_return_code                 $TARGET --allow-empty                               >$TESTDIR/no-flags-or-args.md
 echo "-------------------------------"
 echo "sqirvy -h"
 check_return_code                 $TARGET -h                                          >$TESTDIR/help.md
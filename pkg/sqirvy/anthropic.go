@@ -1,32 +1,40 @@
+//go:build !no_anthropic
+
 // Package sqirvy provides integration with Anthropic's Claude AI models.
 package sqirvy
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
 	"os"
 	"strings"
-
-	"github.com/tmc/langchaingo/llms"
-	"github.com/tmc/langchaingo/llms/anthropic"
 )
 
+// init adds the Anthropic provider to the provider registry.
+func init() {
+	providerRegistry[Anthropic] = providerEntry{fromEnv: envClient(NewAnthropicClient), fromConfig: configClient(newAnthropicClient), maxTemperature: 1}
+}
+
 // AnthropicClient implements the Client interface for Anthropic's API.
 // It provides methods for querying Anthropic's language models through
-// the langchaingo library.
+// the Messages API.
 type AnthropicClient struct {
-	llm              llms.Model // langchaingo LLM client
-	temperatureScale float32
+	api    backend // Messages API client
+	config Config  // API key and endpoint, for credential checks
 }
 
-// Ensure AnthropicClient implements the Client interface
+// Ensure AnthropicClient implements the Client and ToolMessagesClient interfaces
 var _ Client = (*AnthropicClient)(nil)
+var _ ToolMessagesClient = (*AnthropicClient)(nil)
 
-// NewAnthropicClient creates a new instance of AnthropicClient using langchaingo.
+// NewAnthropicClient creates a new instance of AnthropicClient.
 // It returns an error if the required ANTHROPIC_API_KEY environment variable is not set.
 //
 // The Anthropic API key is retrieved from the ANTHROPIC_API_KEY environment variable.
-// Ensure this variable is set before calling this function.
+// Ensure this variable is set before calling this function. The optional
+// ANTHROPIC_BASE_URL variable overrides the endpoint, https://api.anthropic.com.
 func NewAnthropicClient() (*AnthropicClient, error) {
 	// require api key
 	apiKey := os.Getenv("ANTHROPIC_API_KEY")
@@ -37,25 +45,23 @@ func NewAnthropicClient() (*AnthropicClient, error) {
 		return nil, fmt.Errorf("invalid ANTHROPIC_API_KEY: %s", apiKey)
 	}
 
-	// require base url
-	baseUrl := os.Getenv("ANTHROPIC_BASE_URL")
-	if baseUrl == "" {
-		return nil, fmt.Errorf("ANTHROPIC_BASE_URL environment variable not set")
-	}
-
-	// Note: langchaingo's anthropic client uses the API key from the environment variable by default.
-	llm, err := anthropic.New()
-	if err != nil {
-		return nil, fmt.Errorf("failed to create Anthropic client (check API key and network): %w", err)
-	}
+	// an empty base URL uses the default endpoint
+	return newAnthropicClient(Config{APIKey: apiKey, BaseURL: os.Getenv("ANTHROPIC_BASE_URL")})
+}
 
+// newAnthropicClient creates an AnthropicClient from an explicit configuration.
+func newAnthropicClient(cfg Config) (*AnthropicClient, error) {
 	return &AnthropicClient{
-		llm:              llm,
-		temperatureScale: 1.0, // Default temperature scale for Anthropic
+		api: &anthropicBackend{
+			client:  cfg.apiHTTPClient(Anthropic),
+			baseURL: cfg.baseURLOrDefault(Anthropic),
+			apiKey:  cfg.APIKey,
+		},
+		config: cfg,
 	}, nil
 }
 
-// QueryText sends a text query to the specified Anthropic model using langchaingo and returns the response.
+// QueryText sends a text query to the specified Anthropic model and returns the response.
 //
 // It takes a context, system prompt, a list of prompts, the model name, and options as input.
 // It returns the generated text or an error if the query fails or the model is invalid.
@@ -67,17 +73,183 @@ func (c *AnthropicClient) QueryText(ctx context.Context, system string, prompts
 		return "", fmt.Errorf("invalid or unsupported Anthropic model: %s", model)
 	}
 
-	// scale the temperature
-	options.Temperature = options.Temperature * c.temperatureScale
-	options.MaxTokens = GetMaxTokens(model)
-	return queryTextLangChain(ctx, c.llm, system, prompts, model, options)
+	options.MaxTokens = limitMaxTokens(model, options.MaxTokens)
+	return queryText(ctx, c.api, system, prompts, model, options)
+}
+
+// QueryTextUsage is QueryText for Anthropic models that also returns the token usage
+// reported by the provider.
+func (c *AnthropicClient) QueryTextUsage(ctx context.Context, system string, prompts []string, model string, options Options) (string, Usage, error) {
+	provider, err := GetProviderName(model)
+	if err != nil || provider != Anthropic {
+		return "", Usage{}, fmt.Errorf("invalid or unsupported Anthropic model: %s", model)
+	}
+
+	options.MaxTokens = limitMaxTokens(model, options.MaxTokens)
+
+	return queryTextUsage(ctx, c.api, system, prompts, model, options)
+}
+
+// QueryMessages sends a conversation with explicit roles to the specified Anthropic model
+// and returns the response and the token usage reported by the provider.
+func (c *AnthropicClient) QueryMessages(ctx context.Context, messages []Message, model string, options Options) (string, Usage, error) {
+	provider, err := GetProviderName(model)
+	if err != nil || provider != Anthropic {
+		return "", Usage{}, fmt.Errorf("invalid or unsupported Anthropic model: %s", model)
+	}
+
+	options.MaxTokens = limitMaxTokens(model, options.MaxTokens)
+
+	return queryMessages(ctx, c.api, messages, model, options)
+}
+
+// QueryWithTools sends a query to the specified Anthropic model along with a set of
+// tool definitions. The response contains any text and the tool calls requested by the model.
+func (c *AnthropicClient) QueryWithTools(ctx context.Context, system string, prompts []string, model string, options Options, tools []Tool) (ToolResponse, error) {
+	provider, err := GetProviderName(model)
+	if err != nil || provider != Anthropic {
+		return ToolResponse{}, fmt.Errorf("invalid or unsupported Anthropic model: %s", model)
+	}
+
+	options.MaxTokens = limitMaxTokens(model, options.MaxTokens)
+
+	return queryWithTools(ctx, c.api, system, prompts, model, options, tools)
+}
+
+// QueryMessagesWithTools sends a conversation with the results of tool calls to
+// the specified Anthropic model along with a set of tool definitions. The response
+// contains any text and the tool calls requested by the model.
+func (c *AnthropicClient) QueryMessagesWithTools(ctx context.Context, messages []Message, model string, options Options, tools []Tool) (ToolResponse, error) {
+	provider, err := GetProviderName(model)
+	if err != nil || provider != Anthropic {
+		return ToolResponse{}, fmt.Errorf("invalid or unsupported Anthropic model: %s", model)
+	}
+
+	options.MaxTokens = limitMaxTokens(model, options.MaxTokens)
+
+	return queryMessagesWithTools(ctx, c.api, messages, model, options, tools)
+}
+
+// ValidateCredentials checks the Anthropic API key with a request that does not consume tokens.
+func (c *AnthropicClient) ValidateCredentials(ctx context.Context) error {
+	return c.config.validateCredentials(ctx, Anthropic)
 }
 
 // Close implements the Close method for the Client interface.
 //
 // For the Anthropic client, this method does not require any action as the
-// underlying langchaingo client does not need to be explicitly closed.
+// underlying HTTP client does not need to be explicitly closed.
 func (c *AnthropicClient) Close() error {
-	// the langchaingo llm does not require explicit close
 	return nil
 }
+
+// anthropicBackend sends requests to the Anthropic Messages API.
+type anthropicBackend struct {
+	client  *http.Client
+	baseURL string
+	apiKey  string
+}
+
+// anthropicContent is a content block of a message in the Messages API.
+type anthropicContent struct {
+	Type      string          `json:"type"`
+	Text      string          `json:"text,omitempty"`
+	ID        string          `json:"id,omitempty"`          // tool_use
+	Name      string          `json:"name,omitempty"`        // tool_use
+	Input     json.RawMessage `json:"input,omitempty"`       // tool_use
+	ToolUseID string          `json:"tool_use_id,omitempty"` // tool_result
+	Content   string          `json:"content,omitempty"`     // tool_result
+}
+
+type anthropicMessage struct {
+	Role    string             `json:"role"`
+	Content []anthropicContent `json:"content"`
+}
+
+type anthropicTool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	InputSchema map[string]any `json:"input_schema"`
+}
+
+type anthropicRequest struct {
+	Model         string             `json:"model"`
+	MaxTokens     int64              `json:"max_tokens"`
+	Temperature   float32            `json:"temperature"`
+	System        string             `json:"system,omitempty"`
+	Messages      []anthropicMessage `json:"messages"`
+	Tools         []anthropicTool    `json:"tools,omitempty"`
+	StopSequences []string           `json:"stop_sequences,omitempty"`
+}
+
+type anthropicResponse struct {
+	Content    []anthropicContent `json:"content"`
+	StopReason string             `json:"stop_reason"`
+	Usage      struct {
+		InputTokens  int64 `json:"input_tokens"`
+		OutputTokens int64 `json:"output_tokens"`
+	} `json:"usage"`
+}
+
+func (b *anthropicBackend) complete(ctx context.Context, req chatRequest) (chatResponse, error) {
+	body := anthropicRequest{
+		Model:         req.Model,
+		MaxTokens:     req.MaxTokens,
+		Temperature:   req.Temperature,
+		System:        systemPrompt(req.Messages),
+		StopSequences: req.Stop,
+	}
+	for _, m := range req.Messages {
+		role := string(m.Role)
+		var blocks []anthropicContent
+		switch {
+		case m.Role == RoleSystem:
+			continue
+		case m.Role == RoleTool:
+			// tool results are content blocks of a user message
+			role = string(RoleUser)
+			blocks = append(blocks, anthropicContent{Type: "tool_result", ToolUseID: m.ToolCallID, Content: m.Content})
+		case m.Content != "":
+			// the API rejects empty text blocks
+			blocks = append(blocks, anthropicContent{Type: "text", Text: m.Content})
+		}
+		for _, call := range m.ToolCalls {
+			blocks = append(blocks, anthropicContent{Type: "tool_use", ID: call.ID, Name: call.Name, Input: toolArguments(call)})
+		}
+		if len(blocks) == 0 {
+			continue
+		}
+		// consecutive messages of the same role are sent as one message
+		if n := len(body.Messages); n > 0 && body.Messages[n-1].Role == role {
+			body.Messages[n-1].Content = append(body.Messages[n-1].Content, blocks...)
+			continue
+		}
+		body.Messages = append(body.Messages, anthropicMessage{Role: role, Content: blocks})
+	}
+	for _, tool := range req.Tools {
+		body.Tools = append(body.Tools, anthropicTool{Name: tool.Name, Description: tool.Description, InputSchema: toolParameters(tool)})
+	}
+
+	var resp anthropicResponse
+	endpoint := strings.TrimSuffix(b.baseURL, "/") + "/v1/messages"
+	headers := map[string]string{"x-api-key": b.apiKey, "anthropic-version": anthropicAPIVersion}
+	if err := postJSON(ctx, b.client, endpoint, headers, body, &resp); err != nil {
+		return chatResponse{}, err
+	}
+
+	out := chatResponse{
+		StopReason: resp.StopReason,
+		Usage:      Usage{InputTokens: resp.Usage.InputTokens, OutputTokens: resp.Usage.OutputTokens},
+	}
+	var text strings.Builder
+	for _, c := range resp.Content {
+		switch c.Type {
+		case "text":
+			text.WriteString(c.Text)
+		case "tool_use":
+			out.ToolCalls = append(out.ToolCalls, ToolCall{ID: c.ID, Name: c.Name, Arguments: string(c.Input)})
+		}
+	}
+	out.Text = text.String()
+	return out, nil
+}
@@ -1,3 +1,5 @@
+//go:build !no_anthropic
+
 package sqirvy
 
 import (
@@ -6,8 +8,6 @@ import (
 	"testing"
 )
 
-const assistant = "you are a helpful assistant"
-
 func TestAnthropicClient_QueryText(t *testing.T) {
 	// Skip test if ANTHROPIC_API_KEY not set
 	if os.Getenv("ANTHROPIC_API_KEY") == "" {
@@ -66,3 +66,86 @@ func TestAnthropicClient_QueryText(t *testing.T) {
 		})
 	}
 }
+
+func TestAnthropicBackend(t *testing.T) {
+	server, header, body := providerServer(t, "/v1/messages", `{
+		"content": [
+			{"type": "text", "text": "Checking. "},
+			{"type": "tool_use", "id": "toolu_1", "name": "get_weather", "input": {"city": "Paris"}}
+		],
+		"stop_reason": "tool_use",
+		"usage": {"input_tokens": 12, "output_tokens": 7}
+	}`)
+
+	client, err := NewClientWithConfig(Anthropic, Config{APIKey: "test-key", BaseURL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tools := []Tool{{Name: "get_weather", Description: "weather", Parameters: map[string]any{"type": "object"}}}
+	resp, err := client.QueryWithTools(context.Background(), "be brief", []string{"weather?", "in Paris"}, "claude-3-5-haiku-latest", Options{Temperature: 0.5, MaxTokens: 100}, tools)
+	if err != nil {
+		t.Fatalf("QueryWithTools() error = %v", err)
+	}
+
+	if header.Get("X-Api-Key") != "test-key" || header.Get("Anthropic-Version") != anthropicAPIVersion {
+		t.Errorf("request headers = %v", *header)
+	}
+	want := map[string]any{
+		"model":       "claude-3-5-haiku-latest",
+		"max_tokens":  100,
+		"temperature": 0.5,
+		"system":      "be brief",
+		"messages": []any{map[string]any{"role": "user", "content": []any{
+			map[string]any{"type": "text", "text": "weather?"},
+			map[string]any{"type": "text", "text": "in Paris"},
+		}}},
+		"tools": []any{map[string]any{"name": "get_weather", "description": "weather", "input_schema": map[string]any{"type": "object"}}},
+	}
+	if jsonString(*body) != jsonString(want) {
+		t.Errorf("request body = %s, want %s", jsonString(*body), jsonString(want))
+	}
+
+	wantResp := ToolResponse{
+		Text:      "Checking. ",
+		ToolCalls: []ToolCall{{ID: "toolu_1", Name: "get_weather", Arguments: `{"city": "Paris"}`}},
+		Usage:     Usage{InputTokens: 12, OutputTokens: 7},
+	}
+	if jsonString(resp) != jsonString(wantResp) {
+		t.Errorf("QueryWithTools() = %+v, want %+v", resp, wantResp)
+	}
+}
+
+func TestAnthropicBackendToolResults(t *testing.T) {
+	server, _, body := providerServer(t, "/v1/messages", `{
+		"content": [{"type": "text", "text": "Sunny."}],
+		"stop_reason": "end_turn",
+		"usage": {"input_tokens": 30, "output_tokens": 2}
+	}`)
+
+	client, err := NewClientWithConfig(Anthropic, Config{APIKey: "test-key", BaseURL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages := toolConversation("toolu_1", `{"sky": "sunny"}`)
+	resp, err := QueryMessagesWithTools(context.Background(), client, messages, "claude-3-5-haiku-latest", Options{MaxTokens: 100}, toolConversationTools)
+	if err != nil {
+		t.Fatalf("QueryMessagesWithTools() error = %v", err)
+	}
+	if resp.Text != "Sunny." {
+		t.Errorf("QueryMessagesWithTools() = %+v", resp)
+	}
+
+	want := []any{
+		map[string]any{"role": "user", "content": []any{map[string]any{"type": "text", "text": "weather in Paris?"}}},
+		map[string]any{"role": "assistant", "content": []any{
+			map[string]any{"type": "text", "text": "Checking."},
+			map[string]any{"type": "tool_use", "id": "toolu_1", "name": "get_weather", "input": map[string]any{"city": "Paris"}},
+		}},
+		map[string]any{"role": "user", "content": []any{
+			map[string]any{"type": "tool_result", "tool_use_id": "toolu_1", "content": `{"sky": "sunny"}`},
+		}},
+	}
+	if got := jsonString((*body)["messages"]); got != jsonString(want) {
+		t.Errorf("request messages = %s, want %s", got, jsonString(want))
+	}
+}
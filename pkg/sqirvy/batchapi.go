@@ -0,0 +1,545 @@
+// Package sqirvy provides access to the provider batch APIs.
+//
+// OpenAI and Anthropic accept a set of queries as one batch job that completes
+// within 24 hours at half the price of individual queries. SubmitBatch creates a
+// job, GetBatch reports its progress and GetBatchResults downloads the responses
+// once the job is done. SettleBatch replaces the cost charged to the budget at
+// submission with the cost of the results.
+package sqirvy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+)
+
+// BatchDiscount is the fraction of the normal price charged for batch queries.
+const BatchDiscount = 0.5
+
+// BatchRequest is one query in a batch job.
+type BatchRequest struct {
+	ID      string   // identifies the result, letters, digits, - and _ only
+	System  string   // system prompt
+	Prompts []string // user prompts
+}
+
+// BatchJob is the state of a batch job.
+type BatchJob struct {
+	Provider  string
+	ID        string
+	Status    string  // status reported by the provider
+	Done      bool    // true once results can be collected
+	Total     int     // number of requests
+	Succeeded int     // requests that completed
+	Failed    int     // requests that failed, were cancelled or expired
+	Charged   float64 // estimated input cost charged to the budget by SubmitBatch
+}
+
+// BatchResult is the response to one request of a batch job.
+type BatchResult struct {
+	ID    string // BatchRequest.ID
+	Text  string
+	Usage Usage
+	Err   string // empty if the request succeeded
+}
+
+// SupportsBatch reports whether the provider has a batch API.
+func SupportsBatch(provider string) bool {
+	return provider == OpenAI || provider == Anthropic
+}
+
+// SubmitBatch creates a batch job that sends every request to the model with the
+// given options. The discounted input cost is estimated and charged to the budget
+// when the job is created, and returned in BatchJob.Charged for SettleBatch.
+func SubmitBatch(ctx context.Context, model string, options Options, requests []BatchRequest) (BatchJob, error) {
+	provider, err := GetProviderName(model)
+	if err != nil {
+		return BatchJob{}, err
+	}
+	if !SupportsBatch(provider) {
+		return BatchJob{}, fmt.Errorf("provider %s does not support batch jobs", provider)
+	}
+	if len(requests) == 0 {
+		return BatchJob{}, fmt.Errorf("batch job has no requests")
+	}
+	if err := validateTemperature(options.Temperature); err != nil {
+		return BatchJob{}, err
+	}
+	if err := validateStop(options.Stop); err != nil {
+		return BatchJob{}, err
+	}
+
+	var estimate int64
+	for _, r := range requests {
+		estimate += EstimateTokens(r.System, r.Prompts)
+	}
+	reserved, err := reserveCost(estimateInputCost(model, estimate) * BatchDiscount)
+	if err != nil {
+		return BatchJob{}, err
+	}
+
+	options.MaxTokens = limitMaxTokens(model, options.MaxTokens)
+	options.Temperature = nativeTemperature(model, options.Temperature)
+	var job BatchJob
+	if provider == Anthropic {
+		job, err = submitAnthropicBatch(ctx, model, options, requests)
+	} else {
+		job, err = submitOpenAIBatch(ctx, model, options, requests)
+	}
+	settleBudget(model, reserved, Usage{}, err == nil)
+	if err == nil {
+		job.Charged = reserved
+	}
+	return job, err
+}
+
+// SettleBatch records the discounted cost of the results of a batch job of the
+// model, including the output tokens, in place of the estimate charged by
+// SubmitBatch, and returns the cost. It is called once per job.
+func SettleBatch(model string, charged float64, results []BatchResult) float64 {
+	var cost float64
+	for _, r := range results {
+		cost += EstimateCost(model, r.Usage) * BatchDiscount
+	}
+	adjustSpend(cost - charged)
+	return cost
+}
+
+// GetBatch returns the state of a batch job.
+func GetBatch(ctx context.Context, provider string, id string) (BatchJob, error) {
+	switch provider {
+	case Anthropic:
+		job, _, err := getAnthropicBatch(ctx, id)
+		return job, err
+	case OpenAI:
+		job, _, err := getOpenAIBatch(ctx, id)
+		return job, err
+	}
+	return BatchJob{}, fmt.Errorf("provider %s does not support batch jobs", provider)
+}
+
+// GetBatchResults returns the results of a finished batch job.
+func GetBatchResults(ctx context.Context, provider string, id string) ([]BatchResult, error) {
+	switch provider {
+	case Anthropic:
+		return anthropicBatchResults(ctx, id)
+	case OpenAI:
+		return openAIBatchResults(ctx, id)
+	}
+	return nil, fmt.Errorf("provider %s does not support batch jobs", provider)
+}
+
+// batchPrompts returns the prompts that are not empty, which providers reject.
+func batchPrompts(prompts []string) []string {
+	var out []string
+	for _, p := range prompts {
+		if p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// anthropicHeaders returns the headers for Anthropic API requests.
+func anthropicHeaders(apiKey string) map[string]string {
+	return map[string]string{
+		"x-api-key":         apiKey,
+		"anthropic-version": anthropicAPIVersion,
+		"Content-Type":      "application/json",
+	}
+}
+
+// anthropicBatch is a message batch in the Anthropic API.
+type anthropicBatch struct {
+	ID               string `json:"id"`
+	ProcessingStatus string `json:"processing_status"`
+	RequestCounts    struct {
+		Processing int `json:"processing"`
+		Succeeded  int `json:"succeeded"`
+		Errored    int `json:"errored"`
+		Canceled   int `json:"canceled"`
+		Expired    int `json:"expired"`
+	} `json:"request_counts"`
+	ResultsURL string `json:"results_url"`
+}
+
+// job converts the Anthropic batch to a BatchJob.
+func (b anthropicBatch) job() BatchJob {
+	c := b.RequestCounts
+	failed := c.Errored + c.Canceled + c.Expired
+	return BatchJob{
+		Provider:  Anthropic,
+		ID:        b.ID,
+		Status:    b.ProcessingStatus,
+		Done:      b.ProcessingStatus == "ended",
+		Total:     c.Processing + c.Succeeded + failed,
+		Succeeded: c.Succeeded,
+		Failed:    failed,
+	}
+}
+
+func submitAnthropicBatch(ctx context.Context, model string, options Options, requests []BatchRequest) (BatchJob, error) {
+	baseURL, apiKey, err := providerEndpoint(Anthropic)
+	if err != nil {
+		return BatchJob{}, err
+	}
+
+	type textBlock struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	type message struct {
+		Role    string      `json:"role"`
+		Content []textBlock `json:"content"`
+	}
+	type params struct {
+		Model         string    `json:"model"`
+		MaxTokens     int64     `json:"max_tokens"`
+		Temperature   float32   `json:"temperature"`
+		System        string    `json:"system,omitempty"`
+		Messages      []message `json:"messages"`
+		StopSequences []string  `json:"stop_sequences,omitempty"`
+	}
+	type request struct {
+		CustomID string `json:"custom_id"`
+		Params   params `json:"params"`
+	}
+
+	body := struct {
+		Requests []request `json:"requests"`
+	}{}
+	for _, r := range requests {
+		msg := message{Role: "user"}
+		for _, p := range batchPrompts(r.Prompts) {
+			msg.Content = append(msg.Content, textBlock{Type: "text", Text: p})
+		}
+		body.Requests = append(body.Requests, request{
+			CustomID: r.ID,
+			Params: params{
+				Model:         model,
+				MaxTokens:     options.MaxTokens,
+				Temperature:   options.Temperature,
+				System:        r.System,
+				Messages:      []message{msg},
+				StopSequences: options.Stop,
+			},
+		})
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return BatchJob{}, err
+	}
+
+	var batch anthropicBatch
+	endpoint := strings.TrimSuffix(baseURL, "/") + "/v1/messages/batches"
+	if err := doJSON(ctx, apiHTTPClient(Anthropic), http.MethodPost, endpoint, anthropicHeaders(apiKey), bytes.NewReader(data), &batch); err != nil {
+		return BatchJob{}, fmt.Errorf("creating Anthropic batch: %w", err)
+	}
+	return batch.job(), nil
+}
+
+func getAnthropicBatch(ctx context.Context, id string) (BatchJob, anthropicBatch, error) {
+	baseURL, apiKey, err := providerEndpoint(Anthropic)
+	if err != nil {
+		return BatchJob{}, anthropicBatch{}, err
+	}
+	var batch anthropicBatch
+	endpoint := strings.TrimSuffix(baseURL, "/") + "/v1/messages/batches/" + id
+	if err := getJSON(ctx, apiHTTPClient(Anthropic), endpoint, anthropicHeaders(apiKey), &batch); err != nil {
+		return BatchJob{}, anthropicBatch{}, fmt.Errorf("getting Anthropic batch %s: %w", id, err)
+	}
+	return batch.job(), batch, nil
+}
+
+func anthropicBatchResults(ctx context.Context, id string) ([]BatchResult, error) {
+	job, batch, err := getAnthropicBatch(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !job.Done || batch.ResultsURL == "" {
+		return nil, fmt.Errorf("batch %s is not finished, status %s", id, job.Status)
+	}
+	_, apiKey, err := providerEndpoint(Anthropic)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []BatchResult
+	err = readJSONLines(ctx, Anthropic, batch.ResultsURL, anthropicHeaders(apiKey), func(line []byte) error {
+		var entry struct {
+			CustomID string `json:"custom_id"`
+			Result   struct {
+				Type    string `json:"type"`
+				Message struct {
+					Content []struct {
+						Type string `json:"type"`
+						Text string `json:"text"`
+					} `json:"content"`
+					Usage struct {
+						InputTokens  int64 `json:"input_tokens"`
+						OutputTokens int64 `json:"output_tokens"`
+					} `json:"usage"`
+				} `json:"message"`
+				Error json.RawMessage `json:"error"`
+			} `json:"result"`
+		}
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return err
+		}
+		result := BatchResult{ID: entry.CustomID}
+		switch entry.Result.Type {
+		case "succeeded":
+			var text strings.Builder
+			for _, c := range entry.Result.Message.Content {
+				if c.Type == "text" {
+					text.WriteString(c.Text)
+				}
+			}
+			result.Text = text.String()
+			result.Usage = Usage{
+				InputTokens:  entry.Result.Message.Usage.InputTokens,
+				OutputTokens: entry.Result.Message.Usage.OutputTokens,
+			}
+		case "errored":
+			result.Err = "request failed: " + string(entry.Result.Error)
+		default:
+			result.Err = "request " + entry.Result.Type
+		}
+		results = append(results, result)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reading Anthropic batch %s results: %w", id, err)
+	}
+	return results, nil
+}
+
+// openAIHeaders returns the headers for OpenAI API requests.
+func openAIHeaders(apiKey string) map[string]string {
+	return map[string]string{"Authorization": "Bearer " + apiKey}
+}
+
+// openAIBatch is a batch in the OpenAI API.
+type openAIBatch struct {
+	ID            string `json:"id"`
+	Status        string `json:"status"`
+	OutputFileID  string `json:"output_file_id"`
+	ErrorFileID   string `json:"error_file_id"`
+	RequestCounts struct {
+		Total     int `json:"total"`
+		Completed int `json:"completed"`
+		Failed    int `json:"failed"`
+	} `json:"request_counts"`
+}
+
+// job converts the OpenAI batch to a BatchJob.
+func (b openAIBatch) job() BatchJob {
+	done := false
+	switch b.Status {
+	case "completed", "failed", "expired", "cancelled":
+		done = true
+	}
+	return BatchJob{
+		Provider:  OpenAI,
+		ID:        b.ID,
+		Status:    b.Status,
+		Done:      done,
+		Total:     b.RequestCounts.Total,
+		Succeeded: b.RequestCounts.Completed,
+		Failed:    b.RequestCounts.Failed,
+	}
+}
+
+func submitOpenAIBatch(ctx context.Context, model string, options Options, requests []BatchRequest) (BatchJob, error) {
+	baseURL, apiKey, err := providerEndpoint(OpenAI)
+	if err != nil {
+		return BatchJob{}, err
+	}
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	client := apiHTTPClient(OpenAI)
+
+	// the requests are uploaded as a JSONL file
+	type message struct {
+		Role    string `json:"role"`
+		Content string `json:"content"`
+	}
+	type body struct {
+		Model               string    `json:"model"`
+		Messages            []message `json:"messages"`
+		MaxCompletionTokens int64     `json:"max_completion_tokens"`
+		Temperature         float32   `json:"temperature"`
+		Stop                []string  `json:"stop,omitempty"`
+		Seed                *int64    `json:"seed,omitempty"`
+	}
+	type request struct {
+		CustomID string `json:"custom_id"`
+		Method   string `json:"method"`
+		URL      string `json:"url"`
+		Body     body   `json:"body"`
+	}
+	var lines bytes.Buffer
+	enc := json.NewEncoder(&lines)
+	for _, r := range requests {
+		b := body{Model: model, MaxCompletionTokens: options.MaxTokens, Temperature: options.Temperature, Stop: options.Stop, Seed: options.Seed}
+		if r.System != "" {
+			b.Messages = append(b.Messages, message{Role: "system", Content: r.System})
+		}
+		for _, p := range batchPrompts(r.Prompts) {
+			b.Messages = append(b.Messages, message{Role: "user", Content: p})
+		}
+		if err := enc.Encode(request{CustomID: r.ID, Method: http.MethodPost, URL: "/v1/chat/completions", Body: b}); err != nil {
+			return BatchJob{}, err
+		}
+	}
+
+	var form bytes.Buffer
+	mw := multipart.NewWriter(&form)
+	if err := mw.WriteField("purpose", "batch"); err != nil {
+		return BatchJob{}, err
+	}
+	fw, err := mw.CreateFormFile("file", "batch.jsonl")
+	if err != nil {
+		return BatchJob{}, err
+	}
+	if _, err := fw.Write(lines.Bytes()); err != nil {
+		return BatchJob{}, err
+	}
+	if err := mw.Close(); err != nil {
+		return BatchJob{}, err
+	}
+
+	headers := openAIHeaders(apiKey)
+	headers["Content-Type"] = mw.FormDataContentType()
+	var file struct {
+		ID string `json:"id"`
+	}
+	if err := doJSON(ctx, client, http.MethodPost, baseURL+"/files", headers, &form, &file); err != nil {
+		return BatchJob{}, fmt.Errorf("uploading OpenAI batch file: %w", err)
+	}
+
+	create, err := json.Marshal(map[string]string{
+		"input_file_id":     file.ID,
+		"endpoint":          "/v1/chat/completions",
+		"completion_window": "24h",
+	})
+	if err != nil {
+		return BatchJob{}, err
+	}
+	headers = openAIHeaders(apiKey)
+	headers["Content-Type"] = "application/json"
+	var batch openAIBatch
+	if err := doJSON(ctx, client, http.MethodPost, baseURL+"/batches", headers, bytes.NewReader(create), &batch); err != nil {
+		return BatchJob{}, fmt.Errorf("creating OpenAI batch: %w", err)
+	}
+	return batch.job(), nil
+}
+
+func getOpenAIBatch(ctx context.Context, id string) (BatchJob, openAIBatch, error) {
+	baseURL, apiKey, err := providerEndpoint(OpenAI)
+	if err != nil {
+		return BatchJob{}, openAIBatch{}, err
+	}
+	var batch openAIBatch
+	endpoint := strings.TrimSuffix(baseURL, "/") + "/batches/" + id
+	if err := getJSON(ctx, apiHTTPClient(OpenAI), endpoint, openAIHeaders(apiKey), &batch); err != nil {
+		return BatchJob{}, openAIBatch{}, fmt.Errorf("getting OpenAI batch %s: %w", id, err)
+	}
+	return batch.job(), batch, nil
+}
+
+func openAIBatchResults(ctx context.Context, id string) ([]BatchResult, error) {
+	job, batch, err := getOpenAIBatch(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !job.Done {
+		return nil, fmt.Errorf("batch %s is not finished, status %s", id, job.Status)
+	}
+	baseURL, apiKey, err := providerEndpoint(OpenAI)
+	if err != nil {
+		return nil, err
+	}
+	baseURL = strings.TrimSuffix(baseURL, "/")
+
+	// successful and failed requests are in separate files
+	var results []BatchResult
+	for _, fileID := range []string{batch.OutputFileID, batch.ErrorFileID} {
+		if fileID == "" {
+			continue
+		}
+		err := readJSONLines(ctx, OpenAI, baseURL+"/files/"+fileID+"/content", openAIHeaders(apiKey), func(line []byte) error {
+			var entry struct {
+				CustomID string `json:"custom_id"`
+				Response struct {
+					StatusCode int `json:"status_code"`
+					Body       struct {
+						Choices []struct {
+							Message struct {
+								Content string `json:"content"`
+							} `json:"message"`
+						} `json:"choices"`
+						Usage struct {
+							PromptTokens     int64 `json:"prompt_tokens"`
+							CompletionTokens int64 `json:"completion_tokens"`
+						} `json:"usage"`
+						Error json.RawMessage `json:"error"`
+					} `json:"body"`
+				} `json:"response"`
+				Error json.RawMessage `json:"error"`
+			}
+			if err := json.Unmarshal(line, &entry); err != nil {
+				return err
+			}
+			result := BatchResult{ID: entry.CustomID}
+			body := entry.Response.Body
+			switch {
+			case len(entry.Error) > 0 && string(entry.Error) != "null":
+				result.Err = "request failed: " + string(entry.Error)
+			case entry.Response.StatusCode != http.StatusOK:
+				result.Err = fmt.Sprintf("request failed with status %d: %s", entry.Response.StatusCode, string(body.Error))
+			default:
+				for _, c := range body.Choices {
+					result.Text += c.Message.Content
+				}
+				result.Usage = Usage{InputTokens: body.Usage.PromptTokens, OutputTokens: body.Usage.CompletionTokens}
+			}
+			results = append(results, result)
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("reading OpenAI batch %s results: %w", id, err)
+		}
+	}
+	return results, nil
+}
+
+// readJSONLines downloads a JSONL document and calls fn for each line.
+func readJSONLines(ctx context.Context, provider string, endpoint string, headers map[string]string, fn func(line []byte) error) error {
+	resp, err := doRequest(ctx, apiHTTPClient(provider), http.MethodGet, endpoint, headers, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	r := bufio.NewReader(resp.Body)
+	for {
+		line, err := r.ReadBytes('\n')
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			if err := fn(line); err != nil {
+				return fmt.Errorf("invalid result line: %w", err)
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
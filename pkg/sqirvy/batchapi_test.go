@@ -0,0 +1,204 @@
+package sqirvy
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAnthropicBatch(t *testing.T) {
+	var submitted struct {
+		Requests []struct {
+			CustomID string `json:"custom_id"`
+			Params   struct {
+				Model    string `json:"model"`
+				System   string `json:"system"`
+				Messages []struct {
+					Content []struct {
+						Text string `json:"text"`
+					} `json:"content"`
+				} `json:"messages"`
+			} `json:"params"`
+		} `json:"requests"`
+	}
+
+	var serverURL string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("x-api-key") != "test-key" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/v1/messages/batches":
+			if err := json.NewDecoder(r.Body).Decode(&submitted); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			w.Write([]byte(`{"id": "msgbatch_1", "processing_status": "in_progress", "request_counts": {"processing": 2}}`))
+		case r.URL.Path == "/v1/messages/batches/msgbatch_1":
+			w.Write([]byte(`{"id": "msgbatch_1", "processing_status": "ended",
+				"request_counts": {"succeeded": 1, "errored": 1},
+				"results_url": "` + serverURL + `/v1/messages/batches/msgbatch_1/results"}`))
+		case r.URL.Path == "/v1/messages/batches/msgbatch_1/results":
+			w.Write([]byte(`{"custom_id": "a", "result": {"type": "succeeded", "message": {"content": [{"type": "text", "text": "answer a"}], "usage": {"input_tokens": 10, "output_tokens": 5}}}}
+{"custom_id": "b", "result": {"type": "errored", "error": {"type": "invalid_request_error"}}}
+`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	serverURL = server.URL
+	t.Setenv("ANTHROPIC_API_KEY", "test-key")
+	t.Setenv("ANTHROPIC_BASE_URL", server.URL)
+	resetBudget()
+	defer resetBudget()
+	SetLedgerFile(filepath.Join(t.TempDir(), "ledger.json"))
+
+	ctx := context.Background()
+	requests := []BatchRequest{
+		{ID: "a", System: "system", Prompts: []string{"", "prompt a"}},
+		{ID: "b", System: "system", Prompts: []string{"prompt b"}},
+	}
+	job, err := SubmitBatch(ctx, "claude-3-5-haiku-latest", Options{MaxTokens: 100}, requests)
+	if err != nil {
+		t.Fatalf("SubmitBatch() error = %v", err)
+	}
+	if job.ID != "msgbatch_1" || job.Done || job.Total != 2 || job.Charged <= 0 {
+		t.Errorf("SubmitBatch() = %+v", job)
+	}
+	charged := job.Charged
+	if month, _ := MonthlySpend(time.Now()); !approxEqual(month.Cost, charged) || month.Requests != 1 {
+		t.Errorf("ledger after SubmitBatch() = %+v, want the charged estimate %v", month, charged)
+	}
+	if len(submitted.Requests) != 2 || submitted.Requests[0].Params.System != "system" {
+		t.Fatalf("submitted requests = %+v", submitted.Requests)
+	}
+	// empty prompts are dropped
+	if content := submitted.Requests[0].Params.Messages[0].Content; len(content) != 1 || content[0].Text != "prompt a" {
+		t.Errorf("submitted content = %+v, want only prompt a", content)
+	}
+
+	job, err = GetBatch(ctx, Anthropic, "msgbatch_1")
+	if err != nil {
+		t.Fatalf("GetBatch() error = %v", err)
+	}
+	if !job.Done || job.Succeeded != 1 || job.Failed != 1 {
+		t.Errorf("GetBatch() = %+v", job)
+	}
+
+	results, err := GetBatchResults(ctx, Anthropic, "msgbatch_1")
+	if err != nil {
+		t.Fatalf("GetBatchResults() error = %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("GetBatchResults() returned %d results, want 2", len(results))
+	}
+	want := BatchResult{ID: "a", Text: "answer a", Usage: Usage{InputTokens: 10, OutputTokens: 5}}
+	if !reflect.DeepEqual(results[0], want) {
+		t.Errorf("result a = %+v, want %+v", results[0], want)
+	}
+	if results[1].ID != "b" || results[1].Err == "" {
+		t.Errorf("result b = %+v, want an error", results[1])
+	}
+
+	// the estimate is replaced with the cost of the results, output included
+	wantCost := EstimateCost("claude-3-5-haiku-latest", want.Usage) * BatchDiscount
+	if cost := SettleBatch("claude-3-5-haiku-latest", charged, results); !approxEqual(cost, wantCost) {
+		t.Errorf("SettleBatch() = %v, want %v", cost, wantCost)
+	}
+	month, err := MonthlySpend(time.Now())
+	if err != nil {
+		t.Fatalf("MonthlySpend() error = %v", err)
+	}
+	if !approxEqual(month.Cost, wantCost) || month.Requests != 1 {
+		t.Errorf("ledger after SettleBatch() = %+v, want cost %v and 1 request", month, wantCost)
+	}
+	if !approxEqual(RunSpend(), wantCost) {
+		t.Errorf("RunSpend() = %v, want %v", RunSpend(), wantCost)
+	}
+}
+
+func TestOpenAIBatch(t *testing.T) {
+	var uploaded string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-key" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/v1/files":
+			if r.FormValue("purpose") != "batch" {
+				http.Error(w, "bad purpose", http.StatusBadRequest)
+				return
+			}
+			f, _, err := r.FormFile("file")
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			data, _ := io.ReadAll(f)
+			uploaded = string(data)
+			w.Write([]byte(`{"id": "file-in"}`))
+		case r.Method == http.MethodPost && r.URL.Path == "/v1/batches":
+			w.Write([]byte(`{"id": "batch_1", "status": "validating", "request_counts": {"total": 2}}`))
+		case r.URL.Path == "/v1/batches/batch_1":
+			w.Write([]byte(`{"id": "batch_1", "status": "completed", "output_file_id": "file-out", "error_file_id": "file-err",
+				"request_counts": {"total": 2, "completed": 1, "failed": 1}}`))
+		case r.URL.Path == "/v1/files/file-out/content":
+			w.Write([]byte(`{"custom_id": "a", "response": {"status_code": 200, "body": {"choices": [{"message": {"content": "answer a"}}], "usage": {"prompt_tokens": 10, "completion_tokens": 5}}}, "error": null}` + "\n"))
+		case r.URL.Path == "/v1/files/file-err/content":
+			w.Write([]byte(`{"custom_id": "b", "response": {"status_code": 400, "body": {"error": {"message": "bad"}}}, "error": null}` + "\n"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	t.Setenv("OPENAI_API_KEY", "test-key")
+	t.Setenv("OPENAI_BASE_URL", server.URL+"/v1")
+
+	ctx := context.Background()
+	requests := []BatchRequest{
+		{ID: "a", System: "system", Prompts: []string{"prompt a"}},
+		{ID: "b", Prompts: []string{"prompt b"}},
+	}
+	job, err := SubmitBatch(ctx, "gpt-4o-mini", Options{MaxTokens: 100}, requests)
+	if err != nil {
+		t.Fatalf("SubmitBatch() error = %v", err)
+	}
+	if job.ID != "batch_1" || job.Done {
+		t.Errorf("SubmitBatch() = %+v", job)
+	}
+	if lines := strings.Split(strings.TrimSpace(uploaded), "\n"); len(lines) != 2 || !strings.Contains(lines[0], `"custom_id":"a"`) {
+		t.Errorf("uploaded batch file = %q", uploaded)
+	}
+
+	results, err := GetBatchResults(ctx, OpenAI, "batch_1")
+	if err != nil {
+		t.Fatalf("GetBatchResults() error = %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("GetBatchResults() returned %d results, want 2", len(results))
+	}
+	want := BatchResult{ID: "a", Text: "answer a", Usage: Usage{InputTokens: 10, OutputTokens: 5}}
+	if !reflect.DeepEqual(results[0], want) {
+		t.Errorf("result a = %+v, want %+v", results[0], want)
+	}
+	if results[1].ID != "b" || !strings.Contains(results[1].Err, "400") {
+		t.Errorf("result b = %+v, want a status 400 error", results[1])
+	}
+}
+
+func TestSubmitBatchUnsupported(t *testing.T) {
+	_, err := SubmitBatch(context.Background(), "gemini-2.0-flash", Options{}, []BatchRequest{{ID: "a", Prompts: []string{"x"}}})
+	if err == nil {
+		t.Error("SubmitBatch() error = nil for a provider without a batch API")
+	}
+}
@@ -0,0 +1,189 @@
+// Package sqirvy provides provider health tracking with a circuit breaker.
+//
+// Consecutive failed queries are counted per provider, where a failure is an error
+// of the provider: a transport error, a timeout, a rate limit or a server error.
+// Client errors, such as a bad request, a bad key or an unknown model, say nothing
+// about the health of the provider and are not counted. When the count reaches
+// the threshold the circuit opens and queries to the provider fail immediately
+// until the cooldown has passed, instead of each waiting for its own timeout.
+// The health state can be kept in a file so it is shared by the separate
+// processes of a shell pipeline.
+package sqirvy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// CircuitConfig controls when a provider circuit opens.
+type CircuitConfig struct {
+	Threshold int           // consecutive failures that open the circuit, 0 disables the breaker
+	Cooldown  time.Duration // how long the circuit stays open
+}
+
+// ProviderHealth is the recent health of a provider.
+type ProviderHealth struct {
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	LastError           string    `json:"last_error,omitempty"`
+	LastFailure         time.Time `json:"last_failure,omitempty"`
+	OpenUntil           time.Time `json:"open_until,omitempty"` // zero if the circuit has not opened
+}
+
+// Open reports whether the circuit is open at the given time.
+func (h ProviderHealth) Open(now time.Time) bool {
+	return now.Before(h.OpenUntil)
+}
+
+// CircuitOpenError is returned for queries to a provider whose circuit is open.
+type CircuitOpenError struct {
+	Provider string
+	Until    time.Time
+	Health   ProviderHealth
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("provider %s is unavailable after %d consecutive failures, retry after %s (last error: %s)",
+		e.Provider, e.Health.ConsecutiveFailures, e.Until.Format(time.TimeOnly), e.Health.LastError)
+}
+
+var (
+	healthMu      sync.Mutex
+	circuitConfig CircuitConfig
+	healthFile    string
+	health        = make(map[string]ProviderHealth)
+)
+
+// SetCircuitConfig sets the circuit breaker thresholds.
+func SetCircuitConfig(cfg CircuitConfig) error {
+	if cfg.Threshold < 0 || cfg.Cooldown < 0 {
+		return fmt.Errorf("invalid circuit breaker settings: values cannot be negative")
+	}
+	healthMu.Lock()
+	defer healthMu.Unlock()
+	circuitConfig = cfg
+	return nil
+}
+
+// SetHealthFile loads the provider health from path and saves later changes to it.
+// A missing file starts with all providers healthy.
+func SetHealthFile(path string) error {
+	healthMu.Lock()
+	defer healthMu.Unlock()
+
+	loaded := make(map[string]ProviderHealth)
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("reading provider health file: %w", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &loaded); err != nil {
+			return fmt.Errorf("invalid provider health file %s: %w", path, err)
+		}
+	}
+	healthFile = path
+	health = loaded
+	return nil
+}
+
+// GetProviderHealth returns the recent health of the provider.
+func GetProviderHealth(provider string) ProviderHealth {
+	healthMu.Lock()
+	defer healthMu.Unlock()
+	return health[provider]
+}
+
+// CircuitOpen reports whether queries to the provider currently fail immediately.
+func CircuitOpen(provider string) bool {
+	return GetProviderHealth(provider).Open(time.Now())
+}
+
+// checkCircuit returns a CircuitOpenError if the circuit of the model's provider is open.
+func checkCircuit(model string) error {
+	provider, err := GetProviderName(model)
+	if err != nil {
+		return nil
+	}
+	h := GetProviderHealth(provider)
+	if h.Open(time.Now()) {
+		return &CircuitOpenError{Provider: provider, Until: h.OpenUntil, Health: h}
+	}
+	return nil
+}
+
+// providerFailure reports whether a query error is a failure of the provider: a
+// transport error, a timeout, a dropped connection, a rate limit (429) or a server
+// error (5xx). Other responses, cancelled queries and invalid requests are not.
+func providerFailure(err error) bool {
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode == http.StatusTooManyRequests || httpErr.StatusCode >= 500
+	}
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// recordResult updates the health of the model's provider after a query.
+// Errors that are not failures of the provider leave its health unchanged.
+func recordResult(model string, queryErr error) {
+	if queryErr != nil && !providerFailure(queryErr) {
+		return
+	}
+	provider, err := GetProviderName(model)
+	if err != nil {
+		return
+	}
+
+	healthMu.Lock()
+	defer healthMu.Unlock()
+	if circuitConfig.Threshold == 0 {
+		return
+	}
+
+	h := health[provider]
+	if queryErr == nil {
+		if h.ConsecutiveFailures == 0 {
+			return
+		}
+		delete(health, provider)
+	} else {
+		now := time.Now()
+		h.ConsecutiveFailures++
+		h.LastError = queryErr.Error()
+		h.LastFailure = now
+		if h.ConsecutiveFailures >= circuitConfig.Threshold {
+			h.OpenUntil = now.Add(circuitConfig.Cooldown)
+		}
+		health[provider] = h
+	}
+	saveHealth()
+}
+
+// saveHealth writes the health state to the health file, if one is set.
+// The caller must hold healthMu. Errors are ignored because health tracking
+// must never make a query fail.
+func saveHealth() {
+	if healthFile == "" {
+		return
+	}
+	data, err := json.MarshalIndent(health, "", "  ")
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(healthFile), 0o700); err != nil {
+		return
+	}
+	os.WriteFile(healthFile, data, 0o600)
+}
@@ -0,0 +1,106 @@
+package sqirvy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	defer SetCircuitConfig(CircuitConfig{})
+	if err := SetHealthFile(filepath.Join(t.TempDir(), "health.json")); err != nil {
+		t.Fatalf("SetHealthFile() error = %v", err)
+	}
+	defer func() { healthFile = "" }()
+
+	if err := SetCircuitConfig(CircuitConfig{Threshold: 2, Cooldown: time.Minute}); err != nil {
+		t.Fatalf("SetCircuitConfig() error = %v", err)
+	}
+
+	failure := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	recordResult("gpt-4o", failure)
+	if err := checkCircuit("gpt-4o"); err != nil {
+		t.Fatalf("checkCircuit() after one failure = %v, want nil", err)
+	}
+
+	// cancelled queries are not counted
+	recordResult("gpt-4o", context.Canceled)
+	if CircuitOpen(OpenAI) {
+		t.Fatal("circuit opened after a cancelled query")
+	}
+
+	recordResult("gpt-4o", failure)
+	var openErr *CircuitOpenError
+	if err := checkCircuit("gpt-4o"); !errors.As(err, &openErr) {
+		t.Fatalf("checkCircuit() after two failures = %v, want a CircuitOpenError", err)
+	}
+	if openErr.Provider != OpenAI || openErr.Health.LastError != failure.Error() {
+		t.Errorf("CircuitOpenError = %+v", openErr)
+	}
+
+	// other providers are unaffected
+	if err := checkCircuit("claude-3-5-haiku-latest"); err != nil {
+		t.Errorf("checkCircuit() for another provider = %v, want nil", err)
+	}
+
+	// the state survives a reload from the health file
+	if err := SetHealthFile(healthFile); err != nil {
+		t.Fatalf("SetHealthFile() reload error = %v", err)
+	}
+	if !CircuitOpen(OpenAI) {
+		t.Error("circuit closed after reloading the health file")
+	}
+
+	// a success closes the circuit
+	recordResult("gpt-4o", nil)
+	if CircuitOpen(OpenAI) || GetProviderHealth(OpenAI).ConsecutiveFailures != 0 {
+		t.Error("circuit still open after a successful query")
+	}
+}
+
+func TestCircuitBreakerDisabled(t *testing.T) {
+	SetCircuitConfig(CircuitConfig{})
+	for i := 0; i < 10; i++ {
+		recordResult("gemini-2.0-flash", context.DeadlineExceeded)
+	}
+	if CircuitOpen(Gemini) {
+		t.Error("circuit opened with the breaker disabled")
+	}
+}
+
+func TestProviderFailure(t *testing.T) {
+	status := func(code int) error {
+		return fmt.Errorf("failed to generate completion: %w", &HTTPError{StatusCode: code, Status: http.StatusText(code)})
+	}
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"bad request", status(http.StatusBadRequest), false},
+		{"bad key", status(http.StatusUnauthorized), false},
+		{"forbidden", status(http.StatusForbidden), false},
+		{"unknown model", status(http.StatusNotFound), false},
+		{"rate limit", status(http.StatusTooManyRequests), true},
+		{"server error", status(http.StatusInternalServerError), true},
+		{"overloaded", status(529), true},
+		{"connection refused", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, true},
+		{"timeout", fmt.Errorf("failed to generate completion: %w", context.DeadlineExceeded), true},
+		{"dropped connection", io.ErrUnexpectedEOF, true},
+		{"cancelled", context.Canceled, false},
+		{"invalid request", errors.New("stop sequences cannot be empty"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := providerFailure(tt.err); got != tt.want {
+				t.Errorf("providerFailure(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
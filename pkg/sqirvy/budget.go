@@ -0,0 +1,280 @@
+// Package sqirvy provides spending limits for AI queries.
+//
+// The cost of each query is estimated from its input before it is sent, and
+// queries that would exceed the per-run or monthly budget are refused. After a
+// query the estimate is replaced with the cost of the usage reported by the
+// provider. Monthly spending is kept in a ledger file shared by all processes.
+package sqirvy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	// ledgerLockWait is how long to wait for another process to release the ledger.
+	ledgerLockWait = 15 * time.Second
+	// ledgerLockStale is the age of a lock file left by a process that died.
+	ledgerLockStale = 10 * time.Second
+)
+
+// errInvalidLedger is returned for a ledger file that is not valid JSON.
+var errInvalidLedger = errors.New("invalid spending ledger")
+
+// Budget limits the cost of queries in US dollars. Zero means no limit.
+type Budget struct {
+	PerRun  float64 // cost of all queries made by this process
+	Monthly float64 // cost of all queries in the calendar month, from the ledger
+}
+
+// BudgetError is returned for queries that would exceed a budget.
+type BudgetError struct {
+	Limit    string  // "per-run" or "monthly"
+	Cap      float64 // the budget
+	Spent    float64 // already spent or reserved by running queries
+	Estimate float64 // estimated cost of the refused query
+}
+
+func (e *BudgetError) Error() string {
+	return fmt.Sprintf("%s budget of $%.4f exceeded: estimated cost $%.4f with $%.4f already spent",
+		e.Limit, e.Cap, e.Estimate, e.Spent)
+}
+
+// LedgerMonth is the spending recorded in the ledger for one month.
+type LedgerMonth struct {
+	Cost     float64 `json:"cost"`
+	Requests int     `json:"requests"`
+}
+
+var (
+	budgetMu    sync.Mutex
+	budget      Budget
+	ledgerFile  string
+	runSpent    float64 // cost of completed queries in this process
+	runReserved float64 // estimated cost of queries in flight
+)
+
+// SetBudget sets the spending limits for queries made afterwards.
+func SetBudget(b Budget) error {
+	if b.PerRun < 0 || b.Monthly < 0 {
+		return fmt.Errorf("invalid budget: limits cannot be negative")
+	}
+	budgetMu.Lock()
+	defer budgetMu.Unlock()
+	budget = b
+	return nil
+}
+
+// SetLedgerFile records the cost of every query in the ledger file at path.
+// The ledger is required for the monthly budget.
+func SetLedgerFile(path string) {
+	budgetMu.Lock()
+	defer budgetMu.Unlock()
+	ledgerFile = path
+}
+
+// RunSpend returns the cost of the queries completed by this process.
+func RunSpend() float64 {
+	budgetMu.Lock()
+	defer budgetMu.Unlock()
+	return runSpent
+}
+
+// MonthlySpend returns the spending recorded in the ledger for the month of t.
+func MonthlySpend(t time.Time) (LedgerMonth, error) {
+	budgetMu.Lock()
+	defer budgetMu.Unlock()
+	ledger, err := readLedger()
+	if err != nil {
+		return LedgerMonth{}, err
+	}
+	return ledger[ledgerKey(t)], nil
+}
+
+// ledgerKey returns the ledger entry name for the month of t.
+func ledgerKey(t time.Time) string {
+	return t.Format("2006-01")
+}
+
+// readLedger reads the ledger file. The caller must hold budgetMu.
+// A missing ledger file or no ledger file is an empty ledger. The ledger is
+// replaced by renaming, so it is read without the lock of addToLedger.
+func readLedger() (map[string]LedgerMonth, error) {
+	ledger := make(map[string]LedgerMonth)
+	if ledgerFile == "" {
+		return ledger, nil
+	}
+	data, err := os.ReadFile(ledgerFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return ledger, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading spending ledger: %w", err)
+	}
+	if err := json.Unmarshal(data, &ledger); err != nil {
+		return nil, fmt.Errorf("%w %s: %v (move it away to start a new one)", errInvalidLedger, ledgerFile, err)
+	}
+	return ledger, nil
+}
+
+// estimateInputCost returns the cost of the estimated input tokens of a query.
+// The length of the response is not known before the query, so output is not included.
+func estimateInputCost(model string, estimate int64) float64 {
+	return EstimateCost(model, Usage{InputTokens: estimate})
+}
+
+// reserveBudget checks that a query with the estimated number of input tokens fits
+// within the budgets and reserves its estimated cost until settleBudget is called.
+func reserveBudget(model string, estimate int64) (float64, error) {
+	return reserveCost(estimateInputCost(model, estimate))
+}
+
+// reserveCost checks that a query with the estimated cost fits within the budgets
+// and reserves the cost until settleBudget is called.
+func reserveCost(cost float64) (float64, error) {
+	budgetMu.Lock()
+	defer budgetMu.Unlock()
+	if budget.PerRun > 0 && runSpent+runReserved+cost > budget.PerRun {
+		return 0, &BudgetError{Limit: "per-run", Cap: budget.PerRun, Spent: runSpent + runReserved, Estimate: cost}
+	}
+	if budget.Monthly > 0 {
+		ledger, err := readLedger()
+		if err != nil {
+			return 0, err
+		}
+		spent := ledger[ledgerKey(time.Now())].Cost + runReserved
+		if spent+cost > budget.Monthly {
+			return 0, &BudgetError{Limit: "monthly", Cap: budget.Monthly, Spent: spent, Estimate: cost}
+		}
+	}
+	runReserved += cost
+	return cost, nil
+}
+
+// settleBudget releases the reservation of a query and, if the provider charged for
+// it, records its cost. The reserved estimate is used if the provider did not report usage.
+func settleBudget(model string, reserved float64, usage Usage, charged bool) {
+	budgetMu.Lock()
+	defer budgetMu.Unlock()
+	runReserved = max(0, runReserved-reserved)
+	if !charged {
+		return
+	}
+
+	cost := reserved
+	if usage.InputTokens+usage.OutputTokens > 0 {
+		cost = EstimateCost(model, usage)
+	}
+	runSpent += cost
+
+	if ledgerFile == "" {
+		return
+	}
+	// a completed query must not fail while recording it
+	if err := addToLedger(time.Now(), cost, 1); err != nil {
+		slog.Warn("Recording the cost of the query in the spending ledger failed", "file", ledgerFile, "error", err)
+	}
+}
+
+// adjustSpend corrects the recorded cost of queries that were already counted by
+// delta, e.g. when the cost of a batch job is known after settleBudget estimated it.
+func adjustSpend(delta float64) {
+	budgetMu.Lock()
+	defer budgetMu.Unlock()
+	runSpent += delta
+	if ledgerFile == "" || delta == 0 {
+		return
+	}
+	if err := addToLedger(time.Now(), delta, 0); err != nil {
+		slog.Warn("Recording the cost of the query in the spending ledger failed", "file", ledgerFile, "error", err)
+	}
+}
+
+// addToLedger adds the cost of a number of requests to the month of t in the
+// ledger file. The ledger is locked for the read-modify-write, so that the queries of
+// concurrent processes are all recorded, and replaced by renaming, so that it is
+// never read half written. An invalid ledger is moved aside to ledgerFile.bad
+// and a new one is started. The caller must hold budgetMu.
+func addToLedger(t time.Time, cost float64, requests int) error {
+	if err := os.MkdirAll(filepath.Dir(ledgerFile), 0o700); err != nil {
+		return err
+	}
+	unlock, err := lockLedger()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	ledger, err := readLedger()
+	if errors.Is(err, errInvalidLedger) {
+		if err := os.Rename(ledgerFile, ledgerFile+".bad"); err != nil {
+			return err
+		}
+		slog.Warn("Moved the invalid spending ledger aside and started a new one", "file", ledgerFile+".bad")
+		ledger, err = make(map[string]LedgerMonth), nil
+	}
+	if err != nil {
+		return err
+	}
+	key := ledgerKey(t)
+	month := ledger[key]
+	month.Cost += cost
+	month.Requests += requests
+	ledger[key] = month
+	data, err := json.MarshalIndent(ledger, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeLedger(data)
+}
+
+// lockLedger creates the lock file of the ledger, waiting for another process
+// holding it, and returns the function that removes it. A lock file older than
+// ledgerLockStale was left by a process that died and is removed.
+func lockLedger() (func(), error) {
+	lock := ledgerFile + ".lock"
+	deadline := time.Now().Add(ledgerLockWait)
+	for {
+		f, err := os.OpenFile(lock, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(lock) }, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, fmt.Errorf("locking spending ledger: %w", err)
+		}
+		if info, err := os.Stat(lock); err == nil && time.Since(info.ModTime()) > ledgerLockStale {
+			os.Remove(lock)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("locking spending ledger: %s is held by another process", lock)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// writeLedger replaces the ledger file with data, through a temporary file in the
+// same directory.
+func writeLedger(data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(ledgerFile), "."+filepath.Base(ledgerFile)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), ledgerFile)
+}
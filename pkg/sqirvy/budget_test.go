@@ -0,0 +1,232 @@
+package sqirvy
+
+import (
+	"errors"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// approxEqual compares costs, which are not exact in floating point.
+func approxEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+// resetBudget clears the budget state changed by a test.
+func resetBudget() {
+	SetBudget(Budget{})
+	SetLedgerFile("")
+	runSpent, runReserved = 0, 0
+}
+
+func TestReserveBudgetPerRun(t *testing.T) {
+	resetBudget()
+	defer resetBudget()
+	if err := SetBudget(Budget{PerRun: 0.01}); err != nil {
+		t.Fatalf("SetBudget() error = %v", err)
+	}
+
+	// gpt-4o input costs $2.50 per million tokens, 1000 tokens cost $0.0025
+	reserved, err := reserveBudget("gpt-4o", 1000)
+	if err != nil {
+		t.Fatalf("reserveBudget() error = %v", err)
+	}
+	if !approxEqual(reserved, 0.0025) {
+		t.Errorf("reserveBudget() = %v, want 0.0025", reserved)
+	}
+
+	// the reservation counts against the budget while the query runs
+	var budgetErr *BudgetError
+	if _, err := reserveBudget("gpt-4o", 4000); !errors.As(err, &budgetErr) || budgetErr.Limit != "per-run" {
+		t.Fatalf("reserveBudget() over budget error = %v, want a per-run BudgetError", err)
+	}
+
+	// the reported usage replaces the estimate
+	settleBudget("gpt-4o", reserved, Usage{InputTokens: 1000, OutputTokens: 500}, true)
+	if got := RunSpend(); !approxEqual(got, 0.0075) {
+		t.Errorf("RunSpend() = %v, want 0.0075", got)
+	}
+	if _, err := reserveBudget("gpt-4o", 500); err != nil {
+		t.Errorf("reserveBudget() within the budget error = %v", err)
+	}
+
+	// a single request larger than the budget is refused
+	if _, err := reserveBudget("gpt-4o", 1000000); err == nil {
+		t.Error("reserveBudget() error = nil for a request over the budget")
+	}
+}
+
+func TestReserveBudgetMonthly(t *testing.T) {
+	resetBudget()
+	defer resetBudget()
+	ledger := filepath.Join(t.TempDir(), "ledger.json")
+	SetLedgerFile(ledger)
+	if err := SetBudget(Budget{Monthly: 0.01}); err != nil {
+		t.Fatalf("SetBudget() error = %v", err)
+	}
+
+	reserved, err := reserveBudget("gpt-4o", 1000)
+	if err != nil {
+		t.Fatalf("reserveBudget() error = %v", err)
+	}
+	settleBudget("gpt-4o", reserved, Usage{InputTokens: 1000, OutputTokens: 750}, true)
+
+	month, err := MonthlySpend(time.Now())
+	if err != nil {
+		t.Fatalf("MonthlySpend() error = %v", err)
+	}
+	if !approxEqual(month.Cost, 0.01) || month.Requests != 1 {
+		t.Errorf("MonthlySpend() = %+v, want cost 0.01 and 1 request", month)
+	}
+
+	// the ledger persists across processes, so a new run is still over the cap
+	runSpent = 0
+	var budgetErr *BudgetError
+	if _, err := reserveBudget("gpt-4o", 1000); !errors.As(err, &budgetErr) || budgetErr.Limit != "monthly" {
+		t.Errorf("reserveBudget() error = %v, want a monthly BudgetError", err)
+	}
+}
+
+func TestSettleBudgetNotCharged(t *testing.T) {
+	resetBudget()
+	defer resetBudget()
+	reserved, err := reserveBudget("gpt-4o", 1000)
+	if err != nil {
+		t.Fatalf("reserveBudget() error = %v", err)
+	}
+	settleBudget("gpt-4o", reserved, Usage{}, false)
+	if runReserved != 0 || RunSpend() != 0 {
+		t.Errorf("after a failed query reserved = %v, spent = %v, want 0", runReserved, RunSpend())
+	}
+}
+
+func TestSetBudgetNegative(t *testing.T) {
+	resetBudget()
+	defer resetBudget()
+	if err := SetBudget(Budget{PerRun: -1}); err == nil {
+		t.Error("SetBudget() error = nil for a negative limit")
+	}
+}
+
+// TestSettleBudgetLedgerProcess is run by TestSettleBudgetConcurrent in a child
+// process, which settles queries into the ledger of SQIRVY_TEST_LEDGER.
+func TestSettleBudgetLedgerProcess(t *testing.T) {
+	ledger := os.Getenv("SQIRVY_TEST_LEDGER")
+	if ledger == "" {
+		t.Skip("run by TestSettleBudgetConcurrent")
+	}
+	resetBudget()
+	defer resetBudget()
+	SetLedgerFile(ledger)
+	n, _ := strconv.Atoi(os.Getenv("SQIRVY_TEST_SETTLES"))
+	for range n {
+		settleBudget("gpt-4o", 0.001, Usage{}, true)
+	}
+}
+
+func TestSettleBudgetConcurrent(t *testing.T) {
+	const processes, settles = 4, 25
+	ledger := filepath.Join(t.TempDir(), "ledger.json")
+
+	// every query of every process is recorded
+	var wg sync.WaitGroup
+	errs := make([]error, processes)
+	for i := range processes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cmd := exec.Command(os.Args[0], "-test.run=^TestSettleBudgetLedgerProcess$")
+			cmd.Env = append(os.Environ(), "SQIRVY_TEST_LEDGER="+ledger, "SQIRVY_TEST_SETTLES="+strconv.Itoa(settles))
+			if out, err := cmd.CombinedOutput(); err != nil {
+				errs[i] = errors.New(string(out))
+			}
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Fatalf("child process failed: %v", err)
+		}
+	}
+
+	resetBudget()
+	defer resetBudget()
+	SetLedgerFile(ledger)
+	month, err := MonthlySpend(time.Now())
+	if err != nil {
+		t.Fatalf("MonthlySpend() error = %v", err)
+	}
+	if month.Requests != processes*settles || !approxEqual(month.Cost, processes*settles*0.001) {
+		t.Errorf("MonthlySpend() = %+v, want %d requests costing %v", month, processes*settles, processes*settles*0.001)
+	}
+	if _, err := os.Stat(ledger + ".lock"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("lock file left behind: %v", err)
+	}
+}
+
+func TestSettleBudgetInvalidLedger(t *testing.T) {
+	tests := []struct {
+		name   string
+		ledger string
+	}{
+		{name: "truncated", ledger: `{"2025-01": {"cost": 0.5, "req`},
+		{name: "not json", ledger: "spending"},
+		{name: "wrong type", ledger: `{"2025-01": 3}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetBudget()
+			defer resetBudget()
+			ledger := filepath.Join(t.TempDir(), "ledger.json")
+			if err := os.WriteFile(ledger, []byte(tt.ledger), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			SetLedgerFile(ledger)
+			if _, err := MonthlySpend(time.Now()); !errors.Is(err, errInvalidLedger) {
+				t.Fatalf("MonthlySpend() error = %v, want errInvalidLedger", err)
+			}
+
+			// settling moves the invalid ledger aside and starts a new one
+			settleBudget("gpt-4o", 0.002, Usage{}, true)
+			month, err := MonthlySpend(time.Now())
+			if err != nil {
+				t.Fatalf("MonthlySpend() after settling error = %v", err)
+			}
+			if month.Requests != 1 || !approxEqual(month.Cost, 0.002) {
+				t.Errorf("MonthlySpend() = %+v, want 1 request costing 0.002", month)
+			}
+			if bad, err := os.ReadFile(ledger + ".bad"); err != nil || string(bad) != tt.ledger {
+				t.Errorf("moved ledger = %q, %v, want %q", bad, err, tt.ledger)
+			}
+		})
+	}
+}
+
+func TestLockLedgerStale(t *testing.T) {
+	resetBudget()
+	defer resetBudget()
+	ledger := filepath.Join(t.TempDir(), "ledger.json")
+	SetLedgerFile(ledger)
+
+	// a lock left by a process that died does not block the ledger
+	if err := os.WriteFile(ledger+".lock", nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * ledgerLockStale)
+	if err := os.Chtimes(ledger+".lock", old, old); err != nil {
+		t.Fatal(err)
+	}
+	unlock, err := lockLedger()
+	if err != nil {
+		t.Fatalf("lockLedger() error = %v", err)
+	}
+	unlock()
+	if _, err := os.Stat(ledger + ".lock"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("lock file not removed by unlock: %v", err)
+	}
+}
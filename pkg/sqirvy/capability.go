@@ -0,0 +1,109 @@
+// Package sqirvy provides the capabilities of models.
+//
+// The registry records whether each model accepts images, calls tools, has a
+// JSON response format and reasons before answering. CheckCapability lets a
+// caller fail before a query with an error that names models that do have the
+// capability, rather than with an error of the provider in the middle of a run.
+package sqirvy
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Capability is a feature that only some models have.
+type Capability string
+
+// Model capabilities
+const (
+	CapabilityVision    Capability = "images"
+	CapabilityTools     Capability = "tool calling"
+	CapabilityJSON      Capability = "JSON mode"
+	CapabilityReasoning Capability = "reasoning"
+)
+
+// maxCapableSuggestions limits the models suggested by CheckCapability.
+const maxCapableSuggestions = 3
+
+// Supports reports whether the model has the capability.
+func (info ModelInfo) Supports(c Capability) bool {
+	switch c {
+	case CapabilityVision:
+		return info.Vision
+	case CapabilityTools:
+		return info.Tools
+	case CapabilityJSON:
+		return info.JSON
+	case CapabilityReasoning:
+		return info.Reasoning
+	}
+	return false
+}
+
+// CheckCapability returns an error if the registered model does not have the
+// capability, e.g. "model llama3.3-70b does not support images; try
+// claude-3-haiku-20240307, gemini-1.5-flash or gpt-4o-mini". Unregistered
+// models are not checked.
+func CheckCapability(model string, c Capability) error {
+	info, ok := modelRegistry[model]
+	if !ok || info.Supports(c) {
+		return nil
+	}
+	msg := fmt.Sprintf("model %s does not support %s", model, c)
+	if capable := CapableModels(c, info.Provider); len(capable) > 0 {
+		if len(capable) > maxCapableSuggestions {
+			capable = capable[:maxCapableSuggestions]
+		}
+		msg += "; try " + joinOr(capable)
+	}
+	return errors.New(msg)
+}
+
+// CapableModels returns the cheapest registered model with the capability of
+// each provider, those of the preferred provider first, then in the order of
+// the providers. Deprecated models, and the mock and local providers, are left out.
+func CapableModels(c Capability, preferred string) []string {
+	order := slices.DeleteFunc(append([]string{preferred}, providers...), func(p string) bool {
+		return p == Mock || p == Local || p == ""
+	})
+	var models []string
+	for _, provider := range order {
+		var best string
+		for model, info := range modelRegistry {
+			if info.Provider != provider || !info.Supports(c) || info.Deprecated() {
+				continue
+			}
+			if best == "" || cheaper(model, best) {
+				best = model
+			}
+		}
+		if best != "" && !slices.Contains(models, best) {
+			models = append(models, best)
+		}
+	}
+	return models
+}
+
+// cheaper reports whether model a costs less per input token than model b.
+// Models of unknown price come last, and ties are broken by name.
+func cheaper(a, b string) bool {
+	costA, costB := modelRegistry[a].InputCost, modelRegistry[b].InputCost
+	if (costA == 0) != (costB == 0) {
+		return costA != 0
+	}
+	if costA != costB {
+		return costA < costB
+	}
+	return cmp.Less(a, b)
+}
+
+// joinOr joins the names as "a, b or c".
+func joinOr(names []string) string {
+	if len(names) == 1 {
+		return names[0]
+	}
+	return strings.Join(names[:len(names)-1], ", ") + " or " + names[len(names)-1]
+}
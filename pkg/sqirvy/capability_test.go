@@ -0,0 +1,52 @@
+package sqirvy
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestCheckCapability(t *testing.T) {
+	tests := []struct {
+		name       string
+		model      string
+		capability Capability
+		wantErr    string
+	}{
+		{"supported", "gpt-4o", CapabilityVision, ""},
+		{"unregistered model", "no-such-model", CapabilityVision, ""},
+		{"no images", "llama3.3-70b", CapabilityVision, "model llama3.3-70b does not support images; try claude-3-haiku-20240307, gemini-2.0-flash or gpt-4o-mini"},
+		{"no tools", "gemini-2.0-flash-thinking-exp", CapabilityTools, "model gemini-2.0-flash-thinking-exp does not support tool calling; try gemini-2.0-flash, claude-3-haiku-20240307 or gpt-4o-mini"},
+		{"no JSON mode", "claude-3-5-haiku-latest", CapabilityJSON, "model claude-3-5-haiku-latest does not support JSON mode; try gemini-2.0-flash or gpt-4o-mini"},
+		{"reasoning", "o4-mini", CapabilityReasoning, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckCapability(tt.model, tt.capability)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("CheckCapability() error = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("CheckCapability() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestQueryWithToolsCapability(t *testing.T) {
+	if err := RegisterModel("mock-no-tools", ModelInfo{Provider: Mock}); err != nil {
+		t.Fatal(err)
+	}
+	defer delete(modelRegistry, "mock-no-tools")
+	defer delete(modelToMaxTokens, "mock-no-tools")
+
+	client, _ := NewMockClient()
+	tools := []Tool{{Name: "record", Description: "records", Parameters: map[string]any{"type": "object"}}}
+	_, err := client.QueryWithTools(context.Background(), "", []string{"hi"}, "mock-no-tools", Options{}, tools)
+	if err == nil || !strings.Contains(err.Error(), "does not support tool calling") {
+		t.Errorf("QueryWithTools() error = %v, want unsupported tool calling", err)
+	}
+}
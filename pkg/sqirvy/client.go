@@ -5,6 +5,7 @@
 // - Google (Gemini models)
 // - OpenAI (GPT models)
 // - Meta (Llama models)
+// - a built-in mock provider that answers without network access
 //
 // It provides a consistent interface for making text and JSON queries while handling
 // provider-specific implementation details internally.
@@ -13,11 +14,11 @@ package sqirvy
 import (
 	"context"
 	"fmt"
-	"os"
+	"log/slog"
+	"slices"
 	"strings"
 	"time"
-
-	"github.com/tmc/langchaingo/llms"
+	"unicode"
 )
 
 const (
@@ -27,94 +28,366 @@ const (
 	// request timeout in seconds
 	RequestTimeout = time.Second * 15
 
-	// controls output to stderr
+	// DebugMode is no longer used.
+	//
+	// Deprecated: details of each completion are logged with log/slog at debug level.
 	DebugMode = false
 )
 
 // Options combines all provider-specific options into a single structure.
 // This allows for provider-specific configuration while maintaining a unified interface.
 type Options struct {
-	Temperature float32 // Controls the randomness of the output
-	MaxTokens   int64   // Maximum number of tokens in the response
+	Temperature float32  // randomness of the output from 0 to 1, scaled to the range of the provider
+	MaxTokens   int64    // Maximum number of tokens in the response, 0 for the model limit
+	Stop        []string // stop sequences: generation ends before the first one, which is not returned
+	Seed        *int64   // seed for reproducible sampling where the provider supports it, see SupportsSeed
+	Prefill     string   // start of the response, which the model continues where supported, see SupportsPrefill
+}
+
+// limitMaxTokens returns the requested response limit, or the model limit if
+// the request is 0 or larger than the model allows.
+func limitMaxTokens(model string, maxTokens int64) int64 {
+	limit := GetMaxTokens(model)
+	if maxTokens <= 0 || maxTokens > limit {
+		return limit
+	}
+	return maxTokens
+}
+
+// Usage reports the number of tokens consumed by a query, as reported by the provider.
+// Counts are zero when the provider does not report usage.
+type Usage struct {
+	InputTokens  int64 // Tokens in the prompt, including the system prompt
+	OutputTokens int64 // Tokens in the generated response
+}
+
+// Role is the author of a message in a conversation.
+type Role string
+
+// Message roles
+const (
+	RoleSystem    Role = "system"    // instructions for the model
+	RoleUser      Role = "user"      // input from the user
+	RoleAssistant Role = "assistant" // earlier responses of the model, or a prefill of the response
+	RoleTool      Role = "tool"      // result of a tool call requested by the model
+)
+
+// Message is one turn of a conversation. An assistant message lists the tool
+// calls the model requested, and a tool message holds the result of one of them,
+// in Content, with the ID of the call. Conversations with tool calls are sent
+// with QueryMessagesWithTools.
+type Message struct {
+	Role       Role
+	Content    string
+	ToolCalls  []ToolCall `json:",omitempty"` // tool calls of an assistant message
+	ToolCallID string     `json:",omitempty"` // ID of the call a tool message is the result of
 }
 
 // Client provides a unified interface for AI operations.
 // It abstracts away provider-specific implementations behind a common interface
-// for making text and JSON queries to AI models.
+// for making text and JSON queries to AI models. QueryTextUsage is QueryText plus the
+// token usage reported by the provider. QueryMessages sends a conversation with
+// explicit roles, e.g. earlier turns or an assistant message that the response
+// continues. QueryWithTools lets the model
+// respond with calls to caller-defined tools instead of, or in addition to, text.
+// ValidateCredentials checks the API key without incurring meaningful cost.
 type Client interface {
 	QueryText(ctx context.Context, system string, prompts []string, model string, options Options) (string, error)
+	QueryTextUsage(ctx context.Context, system string, prompts []string, model string, options Options) (string, Usage, error)
+	QueryMessages(ctx context.Context, messages []Message, model string, options Options) (string, Usage, error)
+	QueryWithTools(ctx context.Context, system string, prompts []string, model string, options Options, tools []Tool) (ToolResponse, error)
+	ValidateCredentials(ctx context.Context) error
 	Close() error
 }
 
-// NewClient creates a new AI client for the specified provider
+// NewClient creates a new AI client for the specified provider, configured from
+// the environment variables of the provider.
 func NewClient(provider string) (Client, error) {
-	switch provider {
-	case Anthropic:
-		client, err := NewAnthropicClient()
-		if err != nil {
-			return nil, fmt.Errorf("failed to create client for provider %s: %w", provider, err)
-		}
-		return client, nil
-	case Gemini:
-		client, err := NewGeminiClient()
-		if err != nil {
-			return nil, fmt.Errorf("failed to create client for provider %s: %w", provider, err)
+	entry, ok := providerRegistry[provider]
+	if !ok {
+		return nil, providerMissing(provider)
+	}
+	client, err := entry.fromEnv()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client for provider %s: %w", provider, err)
+	}
+	return client, nil
+}
+
+// chatRequest is a completion request in the form shared by all providers.
+type chatRequest struct {
+	Model       string
+	Messages    []Message // conversation, including system messages
+	Temperature float32   // temperature in the range of the provider
+	MaxTokens   int64
+	Tools       []Tool   // tools the model may call, if any
+	N           int      // number of completions, 0 for one
+	Stop        []string // stop sequences, if any
+	Seed        *int64   // sampling seed, if any
+}
+
+// chatResponse is a completion in the form shared by all providers.
+type chatResponse struct {
+	Text       string
+	ToolCalls  []ToolCall
+	Usage      Usage
+	StopReason string   // reason the model stopped, as reported by the provider
+	Choices    []string // text of each completion when more than one was requested
+
+	// Fingerprint identifies the backend configuration that generated the response,
+	// e.g. the system_fingerprint of OpenAI, to tell apart differences caused by
+	// changes of the provider from those of sampling
+	Fingerprint string
+}
+
+// backend sends completion requests to the API of one provider.
+type backend interface {
+	complete(ctx context.Context, req chatRequest) (chatResponse, error)
+}
+
+func queryText(ctx context.Context, api backend, system string, prompts []string, model string, options Options) (string, error) {
+	response, _, err := queryTextUsage(ctx, api, system, prompts, model, options)
+	return response, err
+}
+
+func queryTextUsage(ctx context.Context, api backend, system string, prompts []string, model string, options Options) (string, Usage, error) {
+	if ctx.Err() != nil {
+		return "", Usage{}, fmt.Errorf("request context error %w", ctx.Err())
+	}
+
+	if len(prompts) == 0 {
+		return "", Usage{}, fmt.Errorf("prompts cannot be empty for text query")
+	}
+
+	return queryMessages(ctx, api, promptMessages(system, prompts), model, options)
+}
+
+func queryMessages(ctx context.Context, api backend, messages []Message, model string, options Options) (string, Usage, error) {
+	resp, err := queryMessagesN(ctx, api, messages, model, options, 0)
+	if err != nil {
+		return "", Usage{}, err
+	}
+	return resp.Text, resp.Usage, nil
+}
+
+// queryMessagesN sends a conversation for n completions, 0 for one.
+func queryMessagesN(ctx context.Context, api backend, messages []Message, model string, options Options, n int) (chatResponse, error) {
+	if ctx.Err() != nil {
+		return chatResponse{}, fmt.Errorf("request context error %w", ctx.Err())
+	}
+
+	if err := validateMessages(messages); err != nil {
+		return chatResponse{}, err
+	}
+
+	if err := validateTemperature(options.Temperature); err != nil {
+		return chatResponse{}, err
+	}
+
+	if err := validateStop(options.Stop); err != nil {
+		return chatResponse{}, err
+	}
+
+	// the prefill is sent as the start of the response, without trailing white
+	// space, which Anthropic rejects, and is returned with the continuation
+	prefill := strings.TrimRightFunc(options.Prefill, unicode.IsSpace)
+	if provider, _ := GetProviderName(model); prefill != "" && SupportsPrefill(provider) {
+		messages = append(slices.Clip(messages), Message{Role: RoleAssistant, Content: prefill})
+	} else {
+		prefill = ""
+	}
+
+	resp, err := generate(ctx, api, chatRequest{
+		Model:       model,
+		Messages:    messages,
+		Temperature: nativeTemperature(model, options.Temperature),
+		MaxTokens:   options.MaxTokens,
+		N:           n,
+		Stop:        options.Stop,
+		Seed:        options.Seed,
+	})
+	if err != nil || prefill == "" {
+		return resp, err
+	}
+	// the choices may be shared with a memoized response
+	resp.Text = prefill + resp.Text
+	if len(resp.Choices) > 0 {
+		choices := make([]string, len(resp.Choices))
+		for i, c := range resp.Choices {
+			choices[i] = prefill + c
 		}
-		return client, nil
-	case OpenAI:
-		client, err := NewOpenAIClient()
-		if err != nil {
-			return nil, fmt.Errorf("failed to create client for provider %s: %w", provider, err)
+		resp.Choices = choices
+	}
+	return resp, nil
+}
+
+// SupportsPrefill reports whether the model of the provider continues a response
+// started by Options.Prefill. The prefill is ignored by the other providers.
+func SupportsPrefill(provider string) bool {
+	return provider == Anthropic || provider == Mock
+}
+
+// SupportsSeed reports whether the provider samples reproducibly with a seed. The
+// seed is ignored by the other providers.
+func SupportsSeed(provider string) bool {
+	switch provider {
+	case OpenAI, Gemini, Llama, Local, Mock:
+		return true
+	}
+	return false
+}
+
+// validateStop returns an error if a stop sequence is empty.
+func validateStop(stop []string) error {
+	for _, s := range stop {
+		if s == "" {
+			return fmt.Errorf("stop sequences cannot be empty")
 		}
-		return client, nil
-	case Llama:
-		client, err := NewLlamaClient()
-		if err != nil {
-			return nil, fmt.Errorf("failed to create client for provider %s: %w", provider, err)
+	}
+	return nil
+}
+
+// cutAtStop returns text up to the first of the stop sequences, and whether one
+// was found, for providers that do not stop generation themselves.
+func cutAtStop(text string, stop []string) (string, bool) {
+	end := -1
+	for _, s := range stop {
+		if i := strings.Index(text, s); i >= 0 && (end < 0 || i < end) {
+			end = i
 		}
-		return client, nil
-	default:
-		return nil, fmt.Errorf("unsupported provider: %s", provider)
 	}
+	if end < 0 {
+		return text, false
+	}
+	return text[:end], true
 }
 
-func queryTextLangChain(ctx context.Context, llm llms.Model, system string, prompts []string, model string, options Options) (string, error) {
-	if ctx.Err() != nil {
-		return "", fmt.Errorf("request context error %w", ctx.Err())
+// generate sends a completion request to the provider, or answers it with the
+// memoized response of an identical request if memoization is on.
+func generate(ctx context.Context, api backend, req chatRequest) (chatResponse, error) {
+	return memoized(ctx, req, func() (chatResponse, error) {
+		return sendRequest(ctx, api, req)
+	})
+}
+
+// sendRequest sends a completion request to the provider, subject to the circuit
+// breaker, the budget and the rate limit of the model.
+func sendRequest(ctx context.Context, api backend, req chatRequest) (chatResponse, error) {
+	model := req.Model
+
+	// fail fast while the provider is unavailable
+	if err := checkCircuit(model); err != nil {
+		return chatResponse{}, err
 	}
 
-	if len(prompts) == 0 {
-		return "", fmt.Errorf("prompts cannot be empty for text query")
+	// refuse queries that cannot fit the context window of the model
+	estimate := estimateMessageTokens(req.Messages)
+	if err := checkContextWindow(req, estimate); err != nil {
+		return chatResponse{}, err
 	}
 
-	// system prompt
-	content := []llms.MessageContent{
-		llms.TextParts(llms.ChatMessageTypeSystem, system),
+	// refuse queries that would exceed the budget
+	reserved, err := reserveBudget(model, estimate)
+	if err != nil {
+		return chatResponse{}, err
 	}
 
-	// query prompts
-	for _, prompt := range prompts {
-		content = append(content, llms.TextParts(llms.ChatMessageTypeHuman, prompt))
+	// wait for the provider rate limit, if any
+	if err := waitRateLimit(ctx, model, estimate); err != nil {
+		settleBudget(model, reserved, Usage{}, false)
+		return chatResponse{}, err
 	}
 
 	// generate completion
-	completion, err := llm.GenerateContent(
-		ctx, content,
-		llms.WithTemperature(float64(options.Temperature)),
-		llms.WithModel(model),
-		llms.WithMaxTokens(int(options.MaxTokens)),
-	)
+	start := time.Now()
+	resp, err := api.complete(ctx, req)
+	recordResult(model, err)
+	recordQuery(req, start, resp, err)
 	if err != nil {
-		return "", fmt.Errorf("failed to generate completion: %w", err)
+		settleBudget(model, reserved, Usage{}, false)
+		logProviderCall(model, start, Usage{}, err)
+		return chatResponse{}, fmt.Errorf("failed to generate completion: %w", err)
+	}
+
+	slog.Debug("Response completion", "model", model, "stop_reason", resp.StopReason, "fingerprint", resp.Fingerprint)
+	logProviderCall(model, start, resp.Usage, nil)
+	recordUsage(model, estimate, resp.Usage)
+	settleBudget(model, reserved, resp.Usage, true)
+	return resp, nil
+}
+
+// promptMessages returns the conversation of a system prompt and user prompts.
+func promptMessages(system string, prompts []string) []Message {
+	messages := []Message{{Role: RoleSystem, Content: system}}
+	for _, prompt := range prompts {
+		messages = append(messages, Message{Role: RoleUser, Content: prompt})
 	}
+	return messages
+}
 
-	var response strings.Builder
-	for _, part := range completion.Choices {
-		if DebugMode {
-			fmt.Fprintf(os.Stderr, "response completion %s:%v\n", model, part.StopReason)
+// validateMessages returns an error if the conversation has no user message or a
+// message has an unknown role.
+func validateMessages(messages []Message) error {
+	hasUser := false
+	for _, m := range messages {
+		switch m.Role {
+		case RoleSystem, RoleAssistant:
+		case RoleUser:
+			hasUser = true
+		case RoleTool:
+			return fmt.Errorf("tool results must be sent with the tools: use QueryMessagesWithTools")
+		default:
+			return fmt.Errorf("unknown message role: %q", m.Role)
+		}
+		if len(m.ToolCalls) > 0 {
+			return fmt.Errorf("tool calls must be sent with the tools: use QueryMessagesWithTools")
 		}
-		response.WriteString(part.Content)
 	}
+	if !hasUser {
+		return fmt.Errorf("messages must include a user message")
+	}
+	return nil
+}
 
-	return response.String(), nil
+// systemPrompt returns the system messages of a conversation joined by blank
+// lines, for providers that take the system prompt separately.
+func systemPrompt(messages []Message) string {
+	var parts []string
+	for _, m := range messages {
+		if m.Role == RoleSystem && m.Content != "" {
+			parts = append(parts, m.Content)
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// estimateMessageTokens estimates the number of input tokens of a conversation.
+func estimateMessageTokens(messages []Message) int64 {
+	contents := make([]string, 0, len(messages))
+	for _, m := range messages {
+		contents = append(contents, m.Content)
+		for _, call := range m.ToolCalls {
+			contents = append(contents, call.Name+call.Arguments)
+		}
+	}
+	return EstimateTokens("", contents)
+}
+
+// logProviderCall logs the duration and token usage of a provider call at debug level.
+func logProviderCall(model string, start time.Time, usage Usage, err error) {
+	duration := time.Since(start).Round(time.Millisecond)
+	if err != nil {
+		slog.Debug("Provider call failed", "model", model, "duration", duration, "error", err)
+		return
+	}
+	slog.Debug("Provider call", "model", model, "duration", duration,
+		"input_tokens", usage.InputTokens, "output_tokens", usage.OutputTokens)
+}
+
+// add returns the sum of two usage values.
+func (u Usage) add(other Usage) Usage {
+	return Usage{
+		InputTokens:  u.InputTokens + other.InputTokens,
+		OutputTokens: u.OutputTokens + other.OutputTokens,
+	}
 }
@@ -0,0 +1,189 @@
+package sqirvy
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// providerServer serves a fixed JSON response to requests for path and records the
+// headers and decoded body of the last request.
+func providerServer(t *testing.T, path string, response string) (*httptest.Server, *http.Header, *map[string]any) {
+	t.Helper()
+	header := &http.Header{}
+	body := &map[string]any{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != path {
+			http.Error(w, "unexpected request "+r.Method+" "+r.URL.Path, http.StatusNotFound)
+			return
+		}
+		*header = r.Header.Clone()
+		data, _ := io.ReadAll(r.Body)
+		*body = map[string]any{}
+		if err := json.Unmarshal(data, body); err != nil {
+			http.Error(w, "invalid JSON", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(response))
+	}))
+	t.Cleanup(server.Close)
+	return server, header, body
+}
+
+// jsonString encodes v as JSON for comparisons in tests.
+func jsonString(v any) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+func TestLimitMaxTokens(t *testing.T) {
+	limit := GetMaxTokens("gpt-4o")
+	tests := []struct {
+		name      string
+		maxTokens int64
+		want      int64
+	}{
+		{name: "Zero uses model limit", maxTokens: 0, want: limit},
+		{name: "Below limit", maxTokens: 1, want: 1},
+		{name: "Above limit", maxTokens: limit + 1, want: limit},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := limitMaxTokens("gpt-4o", tt.maxTokens); got != tt.want {
+				t.Errorf("limitMaxTokens(%d) = %d, want %d", tt.maxTokens, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSeed(t *testing.T) {
+	openai, openaiBody := completionsServer(t, OpenAI, "/v1/chat/completions", `{"choices": [{"message": {"content": "a"}}], "system_fingerprint": "fp_44709d6fcb"}`, "/v1")
+	anthropic, anthropicBody := completionsServer(t, Anthropic, "/v1/messages", `{"content": [{"type": "text", "text": "a"}]}`, "")
+	gemini, geminiBody := completionsServer(t, Gemini, "/v1beta/models/gemini-2.0-flash:generateContent", `{"candidates": [{"content": {"parts": [{"text": "a"}]}}], "modelVersion": "gemini-2.0-flash-001"}`, "")
+
+	var records []QueryRecord
+	SetQueryRecorder(func(r QueryRecord) { records = append(records, r) })
+	defer SetQueryRecorder(nil)
+
+	seed := int64(42)
+	tests := []struct {
+		name        string
+		client      Client
+		model       string
+		seed        func() any
+		fingerprint string
+	}{
+		{"openai", openai, "gpt-4o", func() any { return (*openaiBody)["seed"] }, "fp_44709d6fcb"},
+		{"anthropic", anthropic, "claude-3-5-haiku-latest", func() any { return (*anthropicBody)["seed"] }, ""},
+		{"gemini", gemini, "gemini-2.0-flash", func() any { return (*geminiBody)["generationConfig"].(map[string]any)["seed"] }, "gemini-2.0-flash-001"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records = nil
+			if _, err := tt.client.QueryText(context.Background(), "", []string{"hi"}, tt.model, Options{Seed: &seed}); err != nil {
+				t.Fatalf("QueryText() error = %v", err)
+			}
+			provider, _ := GetProviderName(tt.model)
+			want := any(nil)
+			if SupportsSeed(provider) {
+				want = float64(seed)
+			}
+			if got := tt.seed(); got != want {
+				t.Errorf("request seed = %v, want %v", got, want)
+			}
+			if len(records) != 1 {
+				t.Fatalf("recorded %d queries, want 1", len(records))
+			}
+			if r := records[0]; r.Seed == nil || *r.Seed != seed || r.Fingerprint != tt.fingerprint {
+				t.Errorf("record seed = %v, fingerprint = %q, want %d, %q", r.Seed, r.Fingerprint, seed, tt.fingerprint)
+			}
+		})
+	}
+}
+
+func TestPrefill(t *testing.T) {
+	openai, openaiBody := completionsServer(t, OpenAI, "/v1/chat/completions", `{"choices": [{"message": {"content": "a"}}]}`, "/v1")
+	anthropic, anthropicBody := completionsServer(t, Anthropic, "/v1/messages", `{"content": [{"type": "text", "text": "\npackage main"}]}`, "")
+
+	tests := []struct {
+		name     string
+		client   Client
+		model    string
+		body     *map[string]any
+		want     string
+		messages int
+	}{
+		{"anthropic", anthropic, "claude-3-5-haiku-latest", anthropicBody, "```go\npackage main", 2},
+		{"openai", openai, "gpt-4o", openaiBody, "a", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.client.QueryText(context.Background(), "", []string{"hi"}, tt.model, Options{Prefill: "```go\n"})
+			if err != nil {
+				t.Fatalf("QueryText() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("QueryText() = %q, want %q", got, tt.want)
+			}
+			messages := (*tt.body)["messages"].([]any)
+			if len(messages) != tt.messages {
+				t.Fatalf("request has %d messages, want %d", len(messages), tt.messages)
+			}
+			if tt.messages == 2 {
+				if last := jsonString(messages[1]); last != `{"content":[{"text":"`+"```go"+`","type":"text"}],"role":"assistant"}` {
+					t.Errorf("prefill message = %s", last)
+				}
+			}
+		})
+	}
+
+	// every completion starts with the prefill
+	mock, _ := NewMockClient()
+	completions, _, err := QueryCompletions(context.Background(), mock, "", []string{"x"}, "mock", Options{Prefill: "["}, 2)
+	if err != nil || len(completions) != 2 || completions[0] != "[x" || completions[1] != "[x" {
+		t.Errorf("QueryCompletions() = %q, %v, want two %q", completions, err, "[x")
+	}
+}
+
+func TestStopSequences(t *testing.T) {
+	openai, openaiBody := completionsServer(t, OpenAI, "/v1/chat/completions", `{"choices": [{"message": {"content": "a"}}]}`, "/v1")
+	anthropic, anthropicBody := completionsServer(t, Anthropic, "/v1/messages", `{"content": [{"type": "text", "text": "a"}]}`, "")
+	gemini, geminiBody := completionsServer(t, Gemini, "/v1beta/models/gemini-2.0-flash:generateContent", `{"candidates": [{"content": {"parts": [{"text": "a"}]}}]}`, "")
+
+	stop := []string{"### END", "\n\n"}
+	tests := []struct {
+		name   string
+		client Client
+		model  string
+		stop   func() any
+	}{
+		{"openai", openai, "gpt-4o", func() any { return (*openaiBody)["stop"] }},
+		{"anthropic", anthropic, "claude-3-5-haiku-latest", func() any { return (*anthropicBody)["stop_sequences"] }},
+		{"gemini", gemini, "gemini-2.0-flash", func() any { return (*geminiBody)["generationConfig"].(map[string]any)["stopSequences"] }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.client.QueryText(context.Background(), "", []string{"hi"}, tt.model, Options{Stop: stop}); err != nil {
+				t.Fatalf("QueryText() error = %v", err)
+			}
+			if got := tt.stop(); jsonString(got) != jsonString(stop) {
+				t.Errorf("request stop sequences = %v, want %v", got, stop)
+			}
+		})
+	}
+
+	// the mock provider cuts its response at the first stop sequence
+	mock, _ := NewMockClient()
+	got, err := mock.QueryText(context.Background(), "", []string{"one\n### END\ntwo\n\nthree"}, "mock", Options{Stop: stop})
+	if err != nil || got != "one\n" {
+		t.Errorf("mock QueryText() = %q, %v, want %q", got, err, "one\n")
+	}
+	if _, err := mock.QueryText(context.Background(), "", []string{"hi"}, "mock", Options{Stop: []string{""}}); err == nil {
+		t.Errorf("QueryText() with an empty stop sequence, want error")
+	}
+}
@@ -0,0 +1,76 @@
+// Package sqirvy provides queries for several completions of the same prompt.
+//
+// OpenAI (the n parameter) and Gemini (candidateCount) generate several
+// completions in one request, which pays for the input tokens once and takes
+// the time of one request. Other clients are sent one request per completion.
+package sqirvy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// CompletionsClient is implemented by clients that generate several completions
+// of a prompt in one request.
+type CompletionsClient interface {
+	QueryCompletions(ctx context.Context, system string, prompts []string, model string, options Options, n int) ([]string, Usage, error)
+}
+
+// QueryCompletions returns n completions of the prompts and their total usage, in
+// one request if the client is a CompletionsClient, otherwise with n concurrent
+// requests. Without a CompletionsClient the completions of the requests that
+// succeeded are returned, and it is an error only if all of them fail.
+func QueryCompletions(ctx context.Context, client Client, system string, prompts []string, model string, options Options, n int) ([]string, Usage, error) {
+	if n < 1 {
+		return nil, Usage{}, fmt.Errorf("number of completions must be at least 1: %d", n)
+	}
+	if c, ok := client.(CompletionsClient); ok && n > 1 {
+		return c.QueryCompletions(ctx, system, prompts, model, options, n)
+	}
+
+	// the requests are identical and must all be sent
+	ctx = WithoutMemo(ctx)
+	responses := make([]string, n)
+	usages := make([]Usage, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			responses[i], usages[i], errs[i] = client.QueryTextUsage(ctx, system, prompts, model, options)
+		}()
+	}
+	wg.Wait()
+
+	var completions []string
+	var usage Usage
+	for i := range n {
+		usage.InputTokens += usages[i].InputTokens
+		usage.OutputTokens += usages[i].OutputTokens
+		if errs[i] == nil {
+			completions = append(completions, responses[i])
+		}
+	}
+	if len(completions) == 0 {
+		return nil, usage, errors.Join(errs...)
+	}
+	return completions, usage, nil
+}
+
+// queryCompletions sends the prompts to a backend for n completions in one request.
+func queryCompletions(ctx context.Context, api backend, system string, prompts []string, model string, options Options, n int) ([]string, Usage, error) {
+	if len(prompts) == 0 {
+		return nil, Usage{}, fmt.Errorf("prompts cannot be empty for text query")
+	}
+	resp, err := queryMessagesN(ctx, api, promptMessages(system, prompts), model, options, n)
+	if err != nil {
+		return nil, Usage{}, err
+	}
+	if len(resp.Choices) == 0 {
+		return []string{resp.Text}, resp.Usage, nil
+	}
+	return resp.Choices, resp.Usage, nil
+}
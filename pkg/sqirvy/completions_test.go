@@ -0,0 +1,87 @@
+package sqirvy
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+// plainClient hides the QueryCompletions method of a client.
+type plainClient struct{ Client }
+
+func TestQueryCompletions(t *testing.T) {
+	openai, openaiBody := completionsServer(t, OpenAI, "/v1/chat/completions", `{
+		"choices": [
+			{"message": {"content": "one"}, "finish_reason": "stop"},
+			{"message": {"content": "two"}, "finish_reason": "stop"},
+			{"message": {"content": "three"}, "finish_reason": "stop"}
+		],
+		"usage": {"prompt_tokens": 9, "completion_tokens": 6}
+	}`, "/v1")
+	gemini, geminiBody := completionsServer(t, Gemini, "/v1beta/models/gemini-2.0-flash:generateContent", `{
+		"candidates": [
+			{"content": {"role": "model", "parts": [{"text": "o"}, {"text": "ne"}]}, "finishReason": "STOP"},
+			{"content": {"role": "model", "parts": [{"text": "two"}]}, "finishReason": "STOP"},
+			{"content": {"role": "model", "parts": [{"text": "three"}]}, "finishReason": "STOP"}
+		],
+		"usageMetadata": {"promptTokenCount": 9, "candidatesTokenCount": 6}
+	}`, "")
+
+	if err := SetMockResponse("idea {{.Choice}}"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetMockResponse("")
+	mock, _ := NewMockClient()
+
+	tests := []struct {
+		name      string
+		client    Client
+		model     string
+		want      []string
+		wantUsage Usage
+		body      *map[string]any
+		wantBody  func(map[string]any) any
+	}{
+		{"openai", openai, "gpt-4o", []string{"one", "two", "three"}, Usage{InputTokens: 9, OutputTokens: 6},
+			openaiBody, func(b map[string]any) any { return b["n"] }},
+		{"gemini", gemini, "gemini-2.0-flash", []string{"one", "two", "three"}, Usage{InputTokens: 9, OutputTokens: 6},
+			geminiBody, func(b map[string]any) any { return b["generationConfig"].(map[string]any)["candidateCount"] }},
+		{"mock", mock, "mock", []string{"idea 1", "idea 2", "idea 3"}, Usage{InputTokens: 2, OutputTokens: 6}, nil, nil},
+		{"separate requests", plainClient{mock}, "mock", []string{"idea 0", "idea 0", "idea 0"}, Usage{InputTokens: 6, OutputTokens: 6}, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, usage, err := QueryCompletions(context.Background(), tt.client, "", []string{"ideas"}, tt.model, Options{}, 3)
+			if err != nil {
+				t.Fatalf("QueryCompletions() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("QueryCompletions() = %q, want %q", got, tt.want)
+			}
+			if usage != tt.wantUsage {
+				t.Errorf("QueryCompletions() usage = %+v, want %+v", usage, tt.wantUsage)
+			}
+			if tt.body != nil {
+				if n := tt.wantBody(*tt.body); n != 3.0 {
+					t.Errorf("request completions = %v, want 3", n)
+				}
+			}
+		})
+	}
+
+	if _, _, err := QueryCompletions(context.Background(), mock, "", []string{"ideas"}, "mock", Options{}, 0); err == nil {
+		t.Errorf("QueryCompletions() with n = 0, want error")
+	}
+}
+
+// completionsServer returns a client of the provider that sends its requests to a
+// test server answering with response.
+func completionsServer(t *testing.T, provider, path, response, basePath string) (Client, *map[string]any) {
+	t.Helper()
+	server, _, body := providerServer(t, path, response)
+	client, err := NewClientWithConfig(provider, Config{APIKey: "test-key", BaseURL: server.URL + basePath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client, body
+}
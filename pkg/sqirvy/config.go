@@ -0,0 +1,134 @@
+// Package sqirvy provides explicit client configuration.
+//
+// NewClient and the provider constructors read API keys and endpoints from
+// environment variables. NewClientWithConfig takes them from a Config and
+// functional options instead, so that programs embedding the package, e.g. a
+// server using a different key per tenant, do not have to modify the process
+// environment.
+package sqirvy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Config configures a client without environment variables.
+// Empty fields use the provider defaults.
+type Config struct {
+	APIKey     string            // provider API key, not used by the mock provider
+	BaseURL    string            // API endpoint, e.g. https://api.openai.com/v1; required for llama
+	HTTPClient *http.Client      // client for provider requests, nil for the transport set by SetHTTPConfig
+	Timeouts   Timeouts          // limits on the phases of each request, zero for the defaults
+	Headers    map[string]string // extra headers sent with every request, below those set with SetProviderHeaders
+}
+
+// ClientOption modifies a Config.
+type ClientOption func(*Config)
+
+// WithAPIKey sets the provider API key.
+func WithAPIKey(key string) ClientOption {
+	return func(cfg *Config) { cfg.APIKey = key }
+}
+
+// WithBaseURL sets the API endpoint.
+func WithBaseURL(baseURL string) ClientOption {
+	return func(cfg *Config) { cfg.BaseURL = baseURL }
+}
+
+// WithHTTPClient sets the HTTP client used for provider requests.
+func WithHTTPClient(client *http.Client) ClientOption {
+	return func(cfg *Config) { cfg.HTTPClient = client }
+}
+
+// WithTimeout limits the duration of each request, including reading the response.
+// It is the total of the timeouts set with WithTimeouts.
+func WithTimeout(timeout time.Duration) ClientOption {
+	return func(cfg *Config) { cfg.Timeouts.Total = timeout }
+}
+
+// WithTimeouts sets the connect, TLS handshake, response header and total timeouts.
+func WithTimeouts(timeouts Timeouts) ClientOption {
+	return func(cfg *Config) { cfg.Timeouts = timeouts }
+}
+
+// WithHeader adds a header sent with every request.
+func WithHeader(name, value string) ClientOption {
+	return func(cfg *Config) {
+		headers := make(map[string]string, len(cfg.Headers)+1)
+		for k, v := range cfg.Headers {
+			headers[k] = v
+		}
+		headers[name] = value
+		cfg.Headers = headers
+	}
+}
+
+// NewClientWithConfig creates a client for the provider from cfg, with the options
+// applied in order, e.g.
+//
+//	client, err := sqirvy.NewClientWithConfig(sqirvy.OpenAI, sqirvy.Config{},
+//		sqirvy.WithAPIKey(key), sqirvy.WithTimeout(30*time.Second))
+//
+// No environment variables are read. Headers set with SetProviderHeaders and the
+// transport set with SetHTTPConfig still apply.
+func NewClientWithConfig(provider string, cfg Config, opts ...ClientOption) (Client, error) {
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	entry, ok := providerRegistry[provider]
+	if !ok {
+		return nil, providerMissing(provider)
+	}
+	if err := cfg.Timeouts.validate(); err != nil {
+		return nil, fmt.Errorf("failed to create client for provider %s: %w", provider, err)
+	}
+	client, err := entry.fromConfig(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client for provider %s: %w", provider, err)
+	}
+	return client, nil
+}
+
+// httpClient returns the HTTP client for the provider library, or nil if the
+// library default should be used.
+func (cfg Config) httpClient(provider string) *http.Client {
+	headers := make(map[string]string)
+	for name, value := range cfg.Headers {
+		headers[name] = value
+	}
+	for name, value := range providerHeaders[provider] {
+		headers[name] = value
+	}
+	return newHTTPClient(cfg.HTTPClient, headers, cfg.Timeouts)
+}
+
+// apiHTTPClient returns the HTTP client for direct requests to the provider API.
+func (cfg Config) apiHTTPClient(provider string) *http.Client {
+	if c := cfg.httpClient(provider); c != nil {
+		return c
+	}
+	return defaultClient
+}
+
+// baseURLOrDefault returns the configured API endpoint or the provider default.
+func (cfg Config) baseURLOrDefault(provider string) string {
+	if cfg.BaseURL != "" {
+		return cfg.BaseURL
+	}
+	switch provider {
+	case Anthropic:
+		return anthropicDefaultBaseURL
+	case Gemini:
+		return geminiDefaultBaseURL
+	case OpenAI:
+		return openaiDefaultBaseURL
+	}
+	return ""
+}
+
+// validateCredentials checks the API key of the configuration with one authenticated request.
+func (cfg Config) validateCredentials(ctx context.Context, provider string) error {
+	return checkCredentials(ctx, cfg.apiHTTPClient(provider), provider, cfg.baseURLOrDefault(provider), cfg.APIKey)
+}
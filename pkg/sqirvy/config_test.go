@@ -0,0 +1,142 @@
+//go:build !no_anthropic && !no_gemini && !no_openai && !no_llama
+
+package sqirvy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewClientWithConfig(t *testing.T) {
+	// no environment variables are needed
+	for _, name := range []string{"ANTHROPIC_API_KEY", "ANTHROPIC_BASE_URL", "GEMINI_API_KEY", "OPENAI_API_KEY", "OPENAI_BASE_URL", "LLAMA_API_KEY", "LLAMA_BASE_URL"} {
+		t.Setenv(name, "")
+	}
+
+	tests := []struct {
+		name     string
+		provider string
+		cfg      Config
+		opts     []ClientOption
+		wantErr  string
+	}{
+		{name: "anthropic", provider: Anthropic, cfg: Config{APIKey: "key"}},
+		{name: "gemini", provider: Gemini, opts: []ClientOption{WithAPIKey("key")}},
+		{name: "openai", provider: OpenAI, opts: []ClientOption{WithAPIKey("key"), WithTimeout(time.Second)}},
+		{name: "llama", provider: Llama, cfg: Config{APIKey: "key", BaseURL: "https://llama.example.com/v1"}},
+		{name: "mock without key", provider: Mock},
+		{name: "missing key", provider: OpenAI, wantErr: "API key not set"},
+		{name: "llama without base URL", provider: Llama, cfg: Config{APIKey: "key"}, wantErr: "base URL not set"},
+		{name: "gemini with base URL", provider: Gemini, cfg: Config{APIKey: "key", BaseURL: "https://example.com"}},
+		{name: "unknown provider", provider: "unknown", cfg: Config{APIKey: "key"}, wantErr: "unsupported provider"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := NewClientWithConfig(tt.provider, tt.cfg, tt.opts...)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("NewClientWithConfig() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewClientWithConfig() error = %v", err)
+			}
+			client.Close()
+		})
+	}
+}
+
+func TestClientConfigCredentials(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "")
+	t.Setenv("OPENAI_BASE_URL", "")
+
+	var gotAuth, gotTenant string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		gotTenant = r.Header.Get("X-Tenant")
+		w.Write([]byte(`{"data": []}`))
+	}))
+	defer server.Close()
+
+	client, err := NewClientWithConfig(OpenAI, Config{BaseURL: server.URL},
+		WithAPIKey("tenant-key"), WithHeader("X-Tenant", "acme"), WithHTTPClient(server.Client()))
+	if err != nil {
+		t.Fatalf("NewClientWithConfig() error = %v", err)
+	}
+	if err := client.ValidateCredentials(context.Background()); err != nil {
+		t.Fatalf("ValidateCredentials() error = %v", err)
+	}
+	if gotAuth != "Bearer tenant-key" {
+		t.Errorf("Authorization = %q, want %q", gotAuth, "Bearer tenant-key")
+	}
+	if gotTenant != "acme" {
+		t.Errorf("X-Tenant = %q, want %q", gotTenant, "acme")
+	}
+}
+
+func TestConfigHTTPClient(t *testing.T) {
+	if c := (Config{}).httpClient(OpenAI); c != nil {
+		t.Errorf("httpClient() = %v, want nil for the library default", c)
+	}
+
+	base := &http.Client{Timeout: time.Minute}
+	c := Config{HTTPClient: base, Timeouts: Timeouts{Total: time.Second}}.httpClient(OpenAI)
+	if c == base {
+		t.Error("httpClient() returned the caller's client, want a copy")
+	}
+	if c.Timeout != time.Second || base.Timeout != time.Minute {
+		t.Errorf("httpClient() timeout = %v, caller's timeout = %v, want 1s and 1m", c.Timeout, base.Timeout)
+	}
+}
+
+func TestNewClientDefaultBaseURL(t *testing.T) {
+	t.Setenv("ANTHROPIC_API_KEY", "sk-ant-test-key-0123456789")
+	t.Setenv("GEMINI_API_KEY", "gemini-test-key-0123456789")
+	t.Setenv("OPENAI_API_KEY", "sk-openai-test-key-0123456789")
+
+	tests := []struct {
+		name     string
+		provider string
+		envVar   string
+		override string
+		want     string
+	}{
+		{name: "anthropic default", provider: Anthropic, envVar: "ANTHROPIC_BASE_URL", want: anthropicDefaultBaseURL},
+		{name: "anthropic override", provider: Anthropic, envVar: "ANTHROPIC_BASE_URL", override: "https://gateway.example.com", want: "https://gateway.example.com"},
+		{name: "gemini default", provider: Gemini, envVar: "GEMINI_BASE_URL", want: geminiDefaultBaseURL},
+		{name: "gemini override", provider: Gemini, envVar: "GEMINI_BASE_URL", override: "https://gateway.example.com", want: "https://gateway.example.com"},
+		{name: "openai default", provider: OpenAI, envVar: "OPENAI_BASE_URL", want: openaiDefaultBaseURL},
+		{name: "openai override", provider: OpenAI, envVar: "OPENAI_BASE_URL", override: "http://localhost:8080/v1", want: "http://localhost:8080/v1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(tt.envVar, tt.override)
+			client, err := NewClient(tt.provider)
+			if err != nil {
+				t.Fatalf("NewClient() error = %v", err)
+			}
+			var got string
+			switch c := client.(type) {
+			case *AnthropicClient:
+				got = c.api.(*anthropicBackend).baseURL
+			case *GeminiClient:
+				got = c.api.(*geminiBackend).baseURL
+			case *OpenAIClient:
+				got = c.api.(*openaiBackend).baseURL
+			}
+			if got != tt.want {
+				t.Errorf("base URL = %q, want %q", got, tt.want)
+			}
+
+			baseURL, _, err := providerEndpoint(tt.provider)
+			if err != nil || baseURL != tt.want {
+				t.Errorf("providerEndpoint() = %q, %v, want %q", baseURL, err, tt.want)
+			}
+		})
+	}
+}
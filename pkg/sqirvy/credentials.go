@@ -0,0 +1,74 @@
+// Package sqirvy provides API key validation for AI providers.
+//
+// Credentials are checked with a single request to the provider's list-models
+// endpoint, which requires authentication but does not consume tokens.
+package sqirvy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// validateCredentials checks the provider API key with one authenticated request.
+// Rejected keys are reported with an explanation of the likely cause.
+func validateCredentials(ctx context.Context, provider string) error {
+	baseURL, apiKey, err := providerEndpoint(provider)
+	if err != nil {
+		return err
+	}
+	return checkCredentials(ctx, apiHTTPClient(provider), provider, baseURL, apiKey)
+}
+
+// checkCredentials checks an API key with one authenticated request to baseURL.
+func checkCredentials(ctx context.Context, client *http.Client, provider string, baseURL string, apiKey string) error {
+	if baseURL == "" {
+		return fmt.Errorf("%s base URL not set", provider)
+	}
+	baseURL = strings.TrimSuffix(baseURL, "/")
+
+	var endpoint string
+	var headers map[string]string
+	switch provider {
+	case Anthropic:
+		endpoint = baseURL + "/v1/models?limit=1"
+		headers = map[string]string{"x-api-key": apiKey, "anthropic-version": anthropicAPIVersion}
+	case Gemini:
+		endpoint = baseURL + "/v1beta/models?pageSize=1"
+		headers = map[string]string{"x-goog-api-key": apiKey}
+	default:
+		endpoint = baseURL + "/models"
+		headers = map[string]string{"Authorization": "Bearer " + apiKey}
+	}
+
+	var resp json.RawMessage
+	if err := getJSON(ctx, client, endpoint, headers, &resp); err != nil {
+		return credentialError(provider, err)
+	}
+	return nil
+}
+
+// credentialError explains an error from a credential check.
+func credentialError(provider string, err error) error {
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) {
+		return fmt.Errorf("%s credential check failed: %w", provider, err)
+	}
+	switch httpErr.StatusCode {
+	case http.StatusUnauthorized:
+		return fmt.Errorf("%s API key was rejected, it is invalid, revoked or expired: %w", provider, err)
+	case http.StatusForbidden:
+		return fmt.Errorf("%s API key does not have permission to use the API: %w", provider, err)
+	case http.StatusTooManyRequests:
+		return fmt.Errorf("%s API key is rate limited or out of quota: %w", provider, err)
+	case http.StatusBadRequest:
+		// Gemini reports invalid keys as bad requests
+		if strings.Contains(httpErr.Body, "API_KEY_INVALID") || strings.Contains(httpErr.Body, "API key") {
+			return fmt.Errorf("%s API key was rejected, it is invalid or expired: %w", provider, err)
+		}
+	}
+	return fmt.Errorf("%s credential check failed: %w", provider, err)
+}
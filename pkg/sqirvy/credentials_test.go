@@ -0,0 +1,77 @@
+package sqirvy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestValidateCredentials(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		wantErr string
+	}{
+		{
+			name:   "Valid key",
+			status: http.StatusOK,
+			body:   `{"data": []}`,
+		},
+		{
+			name:    "Invalid key",
+			status:  http.StatusUnauthorized,
+			body:    `{"error": "invalid api key"}`,
+			wantErr: "invalid, revoked or expired",
+		},
+		{
+			name:    "No permission",
+			status:  http.StatusForbidden,
+			body:    `{"error": "forbidden"}`,
+			wantErr: "does not have permission",
+		},
+		{
+			name:    "Out of quota",
+			status:  http.StatusTooManyRequests,
+			body:    `{"error": "quota"}`,
+			wantErr: "rate limited or out of quota",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/v1/models" || r.Header.Get("Authorization") != "Bearer test-key" {
+					http.Error(w, "bad request", http.StatusBadRequest)
+					return
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			t.Setenv("OPENAI_API_KEY", "test-key")
+			t.Setenv("OPENAI_BASE_URL", server.URL+"/v1")
+
+			err := validateCredentials(context.Background(), OpenAI)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validateCredentials() error = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("validateCredentials() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateCredentialsMissingKey(t *testing.T) {
+	t.Setenv("GEMINI_API_KEY", "")
+	if err := validateCredentials(context.Background(), Gemini); err == nil {
+		t.Error("validateCredentials() error = nil, want an error for a missing key")
+	}
+}
@@ -0,0 +1,78 @@
+// Package sqirvy provides the deprecation of models.
+//
+// Providers deprecate models and retire them at an announced date, after which
+// queries fail. The registry records the retirement date and the successor of
+// deprecated models, so a caller can warn about a deprecated model, or switch to
+// its successor, before the provider refuses the query.
+package sqirvy
+
+import (
+	"fmt"
+	"time"
+)
+
+// Deprecation describes a deprecated model.
+type Deprecation struct {
+	Model     string
+	Retires   time.Time // zero if no retirement date is announced
+	Retired   bool      // the retirement date has passed
+	Successor string    // "" if the model has no successor
+}
+
+// String returns a message for the deprecation, e.g. "model gemini-1.5-flash was
+// retired on 2025-09-24; use gemini-2.5-flash".
+func (d Deprecation) String() string {
+	var msg string
+	switch {
+	case d.Retired:
+		msg = fmt.Sprintf("model %s was retired on %s", d.Model, d.Retires.Format(time.DateOnly))
+	case !d.Retires.IsZero():
+		msg = fmt.Sprintf("model %s is deprecated and retires on %s", d.Model, d.Retires.Format(time.DateOnly))
+	default:
+		msg = fmt.Sprintf("model %s is deprecated", d.Model)
+	}
+	if d.Successor != "" {
+		msg += "; use " + d.Successor
+	}
+	return msg
+}
+
+// Deprecated reports whether the model is deprecated, i.e. it has a retirement
+// date or a successor.
+func (info ModelInfo) Deprecated() bool {
+	return info.Retires != "" || info.Successor != ""
+}
+
+// CheckDeprecation reports whether the registered model is deprecated and, if
+// so, whether it is retired at the time now.
+func CheckDeprecation(model string, now time.Time) (Deprecation, bool) {
+	info, ok := modelRegistry[model]
+	if !ok || !info.Deprecated() {
+		return Deprecation{}, false
+	}
+	d := Deprecation{Model: model, Successor: info.Successor}
+	// RegisterModel checks the date, so it parses
+	if retires, err := time.Parse(time.DateOnly, info.Retires); err == nil {
+		d.Retires = retires
+		d.Retired = !now.Before(retires)
+	}
+	return d, true
+}
+
+// UpgradeModel follows the successors of a deprecated model to the first model
+// that is not deprecated, or that has no registered successor, and returns it.
+// Models that are not deprecated are returned unchanged.
+func UpgradeModel(model string) string {
+	seen := map[string]bool{model: true}
+	for {
+		info, ok := modelRegistry[model]
+		if !ok || info.Successor == "" || seen[info.Successor] {
+			return model
+		}
+		if _, ok := modelRegistry[info.Successor]; !ok {
+			return model
+		}
+		model = info.Successor
+		seen[model] = true
+	}
+}
@@ -0,0 +1,69 @@
+package sqirvy
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCheckDeprecation(t *testing.T) {
+	now := time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name       string
+		model      string
+		deprecated bool
+		want       string
+	}{
+		{"current model", "gpt-4o", false, ""},
+		{"unregistered model", "no-such-model", false, ""},
+		{"retired", "gemini-1.5-flash", true, "model gemini-1.5-flash was retired on 2025-09-24; use gemini-2.5-flash"},
+		{"retires later", "claude-3-5-sonnet-latest", true, "model claude-3-5-sonnet-latest is deprecated and retires on 2025-10-22; use claude-sonnet-4-20250514"},
+		{"no retirement date", "gpt-4-turbo", true, "model gpt-4-turbo is deprecated; use gpt-4o"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, deprecated := CheckDeprecation(tt.model, now)
+			if deprecated != tt.deprecated {
+				t.Fatalf("CheckDeprecation(%q) deprecated = %v, want %v", tt.model, deprecated, tt.deprecated)
+			}
+			if deprecated && d.String() != tt.want {
+				t.Errorf("CheckDeprecation(%q) = %q, want %q", tt.model, d.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestUpgradeModel(t *testing.T) {
+	if err := RegisterModel("mock-old", ModelInfo{Provider: Mock, Successor: "mock-older"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterModel("mock-older", ModelInfo{Provider: Mock, Successor: "mock-old"}); err != nil {
+		t.Fatal(err)
+	}
+	defer delete(modelRegistry, "mock-old")
+	defer delete(modelRegistry, "mock-older")
+	defer delete(modelToMaxTokens, "mock-old")
+	defer delete(modelToMaxTokens, "mock-older")
+
+	tests := []struct {
+		model string
+		want  string
+	}{
+		{"gpt-4o", "gpt-4o"},
+		{"gemini-2.5-flash-preview-04-17", "gemini-2.5-flash"},
+		{"claude-3-7-sonnet-latest", "claude-sonnet-4-20250514"},
+		{"no-such-model", "no-such-model"},
+		{"mock-old", "mock-older"}, // successors that form a cycle stop
+	}
+	for _, tt := range tests {
+		if got := UpgradeModel(tt.model); got != tt.want {
+			t.Errorf("UpgradeModel(%q) = %q, want %q", tt.model, got, tt.want)
+		}
+	}
+}
+
+func TestRegisterModelRetires(t *testing.T) {
+	if err := RegisterModel("mock-bad-date", ModelInfo{Provider: Mock, Retires: "next year"}); err == nil {
+		delete(modelRegistry, "mock-bad-date")
+		t.Error("RegisterModel() error = nil, want invalid retirement date")
+	}
+}
@@ -0,0 +1,270 @@
+// Package sqirvy provides live model discovery for AI providers.
+//
+// This file queries each provider's list-models endpoint so the static model
+// registry can be compared with the models a provider actually serves.
+package sqirvy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+)
+
+const (
+	// default API endpoints used for model discovery when no base URL is configured
+	anthropicDefaultBaseURL = "https://api.anthropic.com"
+	geminiDefaultBaseURL    = "https://generativelanguage.googleapis.com"
+	openaiDefaultBaseURL    = "https://api.openai.com/v1"
+
+	// anthropicAPIVersion is the API version header required by Anthropic
+	anthropicAPIVersion = "2023-06-01"
+)
+
+// ListRemoteModels returns the model identifiers served by the provider, sorted by name.
+// It uses the same API key and base URL environment variables as the provider clients.
+func ListRemoteModels(ctx context.Context, provider string) ([]string, error) {
+	if provider == Mock || provider == Local {
+		// the mock and local providers serve their registered models
+		var models []string
+		for _, mp := range GetModelProviderList() {
+			if mp.Provider == provider {
+				models = append(models, mp.Model)
+			}
+		}
+		sort.Strings(models)
+		return models, nil
+	}
+
+	baseURL, apiKey, err := providerEndpoint(provider)
+	if err != nil {
+		return nil, err
+	}
+
+	client := apiHTTPClient(provider)
+	var models []string
+	switch provider {
+	case Anthropic:
+		models, err = listAnthropicModels(ctx, client, baseURL, apiKey)
+	case Gemini:
+		models, err = listGeminiModels(ctx, client, baseURL, apiKey)
+	case OpenAI, Llama:
+		models, err = listOpenAIModels(ctx, client, baseURL, apiKey)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list models for provider %s: %w", provider, err)
+	}
+	sort.Strings(models)
+	return models, nil
+}
+
+// providerEndpoint returns the API base URL and key of the provider from the same
+// environment variables the provider clients use.
+func providerEndpoint(provider string) (baseURL string, apiKey string, err error) {
+	switch provider {
+	case Anthropic:
+		apiKey = os.Getenv("ANTHROPIC_API_KEY")
+		if apiKey == "" {
+			return "", "", fmt.Errorf("ANTHROPIC_API_KEY environment variable not set")
+		}
+		return envOrDefault("ANTHROPIC_BASE_URL", anthropicDefaultBaseURL), apiKey, nil
+	case Gemini:
+		apiKey = os.Getenv("GEMINI_API_KEY")
+		if apiKey == "" {
+			return "", "", fmt.Errorf("GEMINI_API_KEY environment variable not set")
+		}
+		return envOrDefault("GEMINI_BASE_URL", geminiDefaultBaseURL), apiKey, nil
+	case OpenAI:
+		apiKey = os.Getenv("OPENAI_API_KEY")
+		if apiKey == "" {
+			return "", "", fmt.Errorf("OPENAI_API_KEY environment variable not set")
+		}
+		return envOrDefault("OPENAI_BASE_URL", openaiDefaultBaseURL), apiKey, nil
+	case Llama:
+		apiKey = os.Getenv("LLAMA_API_KEY")
+		if apiKey == "" {
+			return "", "", fmt.Errorf("LLAMA_API_KEY environment variable not set")
+		}
+		baseURL = os.Getenv("LLAMA_BASE_URL")
+		if baseURL == "" {
+			return "", "", fmt.Errorf("LLAMA_BASE_URL environment variable not set")
+		}
+		return baseURL, apiKey, nil
+	default:
+		return "", "", fmt.Errorf("unsupported provider: %s", provider)
+	}
+}
+
+// envOrDefault returns the value of the environment variable, or def if it is not set.
+func envOrDefault(name, def string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return def
+}
+
+// listOpenAIModels lists models from an OpenAI-compatible /models endpoint.
+// The base URL includes the API version path, e.g. https://api.openai.com/v1.
+func listOpenAIModels(ctx context.Context, client *http.Client, baseURL, apiKey string) ([]string, error) {
+	var resp struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	headers := map[string]string{"Authorization": "Bearer " + apiKey}
+	if err := getJSON(ctx, client, strings.TrimSuffix(baseURL, "/")+"/models", headers, &resp); err != nil {
+		return nil, err
+	}
+	var models []string
+	for _, m := range resp.Data {
+		models = append(models, m.ID)
+	}
+	return models, nil
+}
+
+// listAnthropicModels lists models from the Anthropic /v1/models endpoint, following pagination.
+func listAnthropicModels(ctx context.Context, client *http.Client, baseURL, apiKey string) ([]string, error) {
+	headers := map[string]string{
+		"x-api-key":         apiKey,
+		"anthropic-version": anthropicAPIVersion,
+	}
+	var models []string
+	afterID := ""
+	for {
+		endpoint := strings.TrimSuffix(baseURL, "/") + "/v1/models?limit=1000"
+		if afterID != "" {
+			endpoint += "&after_id=" + url.QueryEscape(afterID)
+		}
+		var resp struct {
+			Data []struct {
+				ID string `json:"id"`
+			} `json:"data"`
+			HasMore bool   `json:"has_more"`
+			LastID  string `json:"last_id"`
+		}
+		if err := getJSON(ctx, client, endpoint, headers, &resp); err != nil {
+			return nil, err
+		}
+		for _, m := range resp.Data {
+			models = append(models, m.ID)
+		}
+		if !resp.HasMore || resp.LastID == "" {
+			return models, nil
+		}
+		afterID = resp.LastID
+	}
+}
+
+// listGeminiModels lists the models that support content generation from the
+// Gemini /v1beta/models endpoint, following pagination.
+func listGeminiModels(ctx context.Context, client *http.Client, baseURL, apiKey string) ([]string, error) {
+	headers := map[string]string{"x-goog-api-key": apiKey}
+	var models []string
+	pageToken := ""
+	for {
+		endpoint := strings.TrimSuffix(baseURL, "/") + "/v1beta/models?pageSize=1000"
+		if pageToken != "" {
+			endpoint += "&pageToken=" + url.QueryEscape(pageToken)
+		}
+		var resp struct {
+			Models []struct {
+				Name                       string   `json:"name"`
+				SupportedGenerationMethods []string `json:"supportedGenerationMethods"`
+			} `json:"models"`
+			NextPageToken string `json:"nextPageToken"`
+		}
+		if err := getJSON(ctx, client, endpoint, headers, &resp); err != nil {
+			return nil, err
+		}
+		for _, m := range resp.Models {
+			// skip embedding and other non-chat models
+			generates := false
+			for _, method := range m.SupportedGenerationMethods {
+				if method == "generateContent" {
+					generates = true
+					break
+				}
+			}
+			if generates {
+				models = append(models, strings.TrimPrefix(m.Name, "models/"))
+			}
+		}
+		if resp.NextPageToken == "" {
+			return models, nil
+		}
+		pageToken = resp.NextPageToken
+	}
+}
+
+// HTTPError is returned when a provider API answers with an unexpected status.
+type HTTPError struct {
+	StatusCode int    // HTTP status code
+	Status     string // HTTP status line, e.g. "401 Unauthorized"
+	Body       string // start of the response body
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("unexpected status %s: %s", e.Status, e.Body)
+}
+
+// getJSON performs a GET request and decodes the JSON response into out.
+func getJSON(ctx context.Context, client *http.Client, endpoint string, headers map[string]string, out any) error {
+	return doJSON(ctx, client, http.MethodGet, endpoint, headers, nil, out)
+}
+
+// postJSON performs a POST request with body encoded as JSON and decodes the JSON
+// response into out.
+func postJSON(ctx context.Context, client *http.Client, endpoint string, headers map[string]string, body any, out any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("encoding request: %w", err)
+	}
+	h := map[string]string{"Content-Type": "application/json"}
+	for k, v := range headers {
+		h[k] = v
+	}
+	return doJSON(ctx, client, http.MethodPost, endpoint, h, bytes.NewReader(data), out)
+}
+
+// doJSON performs a request and decodes the JSON response into out.
+func doJSON(ctx context.Context, client *http.Client, method string, endpoint string, headers map[string]string, body io.Reader, out any) error {
+	resp, err := doRequest(ctx, client, method, endpoint, headers, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("invalid response: %w", err)
+	}
+	return nil
+}
+
+// doRequest performs a request and returns the response if it succeeded, or an
+// *HTTPError otherwise. The caller must close the response body.
+func doRequest(ctx context.Context, client *http.Client, method string, endpoint string, headers map[string]string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, &HTTPError{StatusCode: resp.StatusCode, Status: resp.Status, Body: strings.TrimSpace(string(body))}
+	}
+	return resp, nil
+}
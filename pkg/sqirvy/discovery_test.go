@@ -0,0 +1,84 @@
+package sqirvy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestListOpenAIModels(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/models" || r.Header.Get("Authorization") != "Bearer test-key" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"data": [{"id": "gpt-4o"}, {"id": "gpt-4o-mini"}]}`))
+	}))
+	defer server.Close()
+
+	got, err := listOpenAIModels(context.Background(), http.DefaultClient, server.URL+"/v1/", "test-key")
+	if err != nil {
+		t.Fatalf("listOpenAIModels() error = %v", err)
+	}
+	want := []string{"gpt-4o", "gpt-4o-mini"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("listOpenAIModels() = %v, want %v", got, want)
+	}
+}
+
+func TestListAnthropicModels(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("x-api-key") != "test-key" || r.Header.Get("anthropic-version") == "" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		// two pages of results
+		if r.URL.Query().Get("after_id") == "" {
+			w.Write([]byte(`{"data": [{"id": "claude-a"}], "has_more": true, "last_id": "claude-a"}`))
+			return
+		}
+		w.Write([]byte(`{"data": [{"id": "claude-b"}], "has_more": false, "last_id": "claude-b"}`))
+	}))
+	defer server.Close()
+
+	got, err := listAnthropicModels(context.Background(), http.DefaultClient, server.URL, "test-key")
+	if err != nil {
+		t.Fatalf("listAnthropicModels() error = %v", err)
+	}
+	want := []string{"claude-a", "claude-b"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("listAnthropicModels() = %v, want %v", got, want)
+	}
+}
+
+func TestListGeminiModels(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"models": [
+			{"name": "models/gemini-2.0-flash", "supportedGenerationMethods": ["generateContent"]},
+			{"name": "models/text-embedding-004", "supportedGenerationMethods": ["embedContent"]}
+		]}`))
+	}))
+	defer server.Close()
+
+	got, err := listGeminiModels(context.Background(), http.DefaultClient, server.URL, "test-key")
+	if err != nil {
+		t.Fatalf("listGeminiModels() error = %v", err)
+	}
+	want := []string{"gemini-2.0-flash"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("listGeminiModels() = %v, want %v", got, want)
+	}
+}
+
+func TestListModelsError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid key", http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	if _, err := listOpenAIModels(context.Background(), http.DefaultClient, server.URL, "bad-key"); err == nil {
+		t.Error("listOpenAIModels() error = nil for an unauthorized response")
+	}
+}
@@ -1,3 +1,5 @@
+//go:build !no_gemini
+
 // Package sqirvy provides integration with Google's Gemini AI models.
 //
 // This file implements the Client interface for Google's Gemini API, supporting
@@ -7,31 +9,37 @@ package sqirvy
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/url"
 	"os"
-
-	"github.com/tmc/langchaingo/llms"
-	"github.com/tmc/langchaingo/llms/googleai"
+	"strings"
 )
 
-const gemini_temperature_scale = 2.0
+// init adds the Gemini provider to the provider registry.
+func init() {
+	providerRegistry[Gemini] = providerEntry{fromEnv: envClient(NewGeminiClient), fromConfig: configClient(newGeminiClient), maxTemperature: 2}
+}
 
 // GeminiClient implements the Client interface for Google's Gemini API.
 // It provides methods for querying Google's Gemini language models through
-// the langchaingo library.
+// the generateContent API.
 type GeminiClient struct {
-	llm              llms.Model // langchaingo LLM client
-	temperatureScale float32
+	api    backend // generateContent API client
+	config Config  // API key, for credential checks
 }
 
-// Ensure GeminiClient implements the Client interface
+// Ensure GeminiClient implements the Client and ToolMessagesClient interfaces
 var _ Client = (*GeminiClient)(nil)
+var _ ToolMessagesClient = (*GeminiClient)(nil)
 
-// NewGeminiClient creates a new instance of GeminiClient using langchaingo.
+// NewGeminiClient creates a new instance of GeminiClient.
 // It returns an error if the required GEMINI_API_KEY environment variable is not set.
 //
 // The Google API key is retrieved from the GEMINI_API_KEY environment variable.
-// Ensure this variable is set before calling this function.
+// Ensure this variable is set before calling this function. The optional
+// GEMINI_BASE_URL variable overrides the endpoint, https://generativelanguage.googleapis.com.
 func NewGeminiClient() (*GeminiClient, error) {
 	apiKey := os.Getenv("GEMINI_API_KEY")
 	if apiKey == "" {
@@ -41,19 +49,23 @@ func NewGeminiClient() (*GeminiClient, error) {
 		return nil, fmt.Errorf("invalid GEMINI_API_KEY: key appears to be too short")
 	}
 
-	// Note: langchaingo's googleai client uses the API key from the environment variable by default.
-	llm, err := googleai.New(context.Background(), googleai.WithAPIKey(apiKey))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create Gemini client: %w", err)
-	}
+	// an empty base URL uses the default endpoint
+	return newGeminiClient(Config{APIKey: apiKey, BaseURL: os.Getenv("GEMINI_BASE_URL")})
+}
 
+// newGeminiClient creates a GeminiClient from an explicit configuration.
+func newGeminiClient(cfg Config) (*GeminiClient, error) {
 	return &GeminiClient{
-		llm:              llm,
-		temperatureScale: gemini_temperature_scale, // Default temperature scale for Gemini
+		api: &geminiBackend{
+			client:  cfg.apiHTTPClient(Gemini),
+			baseURL: cfg.baseURLOrDefault(Gemini),
+			apiKey:  cfg.APIKey,
+		},
+		config: cfg,
 	}, nil
 }
 
-// QueryText sends a text query to the specified Gemini model using langchaingo and returns the response.
+// QueryText sends a text query to the specified Gemini model and returns the response.
 //
 // It takes a context, system prompt, a list of prompts, the model name, and options as input.
 // It returns the generated text or an error if the query fails.
@@ -64,16 +76,309 @@ func (c *GeminiClient) QueryText(ctx context.Context, system string, prompts []s
 	if err != nil || provider != Gemini {
 		return "", fmt.Errorf("invalid or unsupported Gemini model: %s", model)
 	}
-	options.Temperature = options.Temperature * c.temperatureScale
-	options.MaxTokens = GetMaxTokens(model)
-	return queryTextLangChain(ctx, c.llm, system, prompts, model, options)
+	options.MaxTokens = limitMaxTokens(model, options.MaxTokens)
+	return queryText(ctx, c.api, system, prompts, model, options)
+}
+
+// QueryTextUsage is QueryText for Gemini models that also returns the token usage
+// reported by the provider.
+func (c *GeminiClient) QueryTextUsage(ctx context.Context, system string, prompts []string, model string, options Options) (string, Usage, error) {
+	provider, err := GetProviderName(model)
+	if err != nil || provider != Gemini {
+		return "", Usage{}, fmt.Errorf("invalid or unsupported Gemini model: %s", model)
+	}
+
+	options.MaxTokens = limitMaxTokens(model, options.MaxTokens)
+
+	return queryTextUsage(ctx, c.api, system, prompts, model, options)
+}
+
+// QueryMessages sends a conversation with explicit roles to the specified Gemini model
+// and returns the response and the token usage reported by the provider.
+func (c *GeminiClient) QueryMessages(ctx context.Context, messages []Message, model string, options Options) (string, Usage, error) {
+	provider, err := GetProviderName(model)
+	if err != nil || provider != Gemini {
+		return "", Usage{}, fmt.Errorf("invalid or unsupported Gemini model: %s", model)
+	}
+
+	options.MaxTokens = limitMaxTokens(model, options.MaxTokens)
+
+	return queryMessages(ctx, c.api, messages, model, options)
+}
+
+// QueryWithTools sends a query to the specified Gemini model along with a set of
+// tool definitions. The response contains any text and the tool calls requested by the model.
+func (c *GeminiClient) QueryWithTools(ctx context.Context, system string, prompts []string, model string, options Options, tools []Tool) (ToolResponse, error) {
+	provider, err := GetProviderName(model)
+	if err != nil || provider != Gemini {
+		return ToolResponse{}, fmt.Errorf("invalid or unsupported Gemini model: %s", model)
+	}
+
+	options.MaxTokens = limitMaxTokens(model, options.MaxTokens)
+
+	return queryWithTools(ctx, c.api, system, prompts, model, options, tools)
+}
+
+// QueryMessagesWithTools sends a conversation with the results of tool calls to
+// the specified Gemini model along with a set of tool definitions. The response
+// contains any text and the tool calls requested by the model.
+func (c *GeminiClient) QueryMessagesWithTools(ctx context.Context, messages []Message, model string, options Options, tools []Tool) (ToolResponse, error) {
+	provider, err := GetProviderName(model)
+	if err != nil || provider != Gemini {
+		return ToolResponse{}, fmt.Errorf("invalid or unsupported Gemini model: %s", model)
+	}
+
+	options.MaxTokens = limitMaxTokens(model, options.MaxTokens)
+
+	return queryMessagesWithTools(ctx, c.api, messages, model, options, tools)
+}
+
+// QueryCompletions sends a query to the specified Gemini model for n candidates
+// in one request, and returns them with the token usage reported by the provider.
+func (c *GeminiClient) QueryCompletions(ctx context.Context, system string, prompts []string, model string, options Options, n int) ([]string, Usage, error) {
+	provider, err := GetProviderName(model)
+	if err != nil || provider != Gemini {
+		return nil, Usage{}, fmt.Errorf("invalid or unsupported Gemini model: %s", model)
+	}
+
+	options.MaxTokens = limitMaxTokens(model, options.MaxTokens)
+
+	return queryCompletions(ctx, c.api, system, prompts, model, options, n)
+}
+
+// ValidateCredentials checks the Gemini API key with a request that does not consume tokens.
+func (c *GeminiClient) ValidateCredentials(ctx context.Context) error {
+	return c.config.validateCredentials(ctx, Gemini)
 }
 
 // Close implements the Close method for the Client interface.
 //
 // For the Gemini client, this method does not require any action as the
-// underlying langchaingo client does not need to be explicitly closed.
+// underlying HTTP client does not need to be explicitly closed.
 func (c *GeminiClient) Close() error {
-	// the langchaingo llm does not require explicit close
 	return nil
 }
+
+// geminiBackend sends requests to the Gemini generateContent API.
+type geminiBackend struct {
+	client  *http.Client
+	baseURL string
+	apiKey  string
+}
+
+type geminiFunctionCall struct {
+	ID   string          `json:"id,omitempty"`
+	Name string          `json:"name"`
+	Args json.RawMessage `json:"args,omitempty"`
+}
+
+type geminiFunctionResponse struct {
+	ID       string          `json:"id,omitempty"`
+	Name     string          `json:"name"`
+	Response json.RawMessage `json:"response"`
+}
+
+type geminiPart struct {
+	Text             string                  `json:"text,omitempty"`
+	FunctionCall     *geminiFunctionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *geminiFunctionResponse `json:"functionResponse,omitempty"`
+}
+
+type geminiContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []geminiPart `json:"parts"`
+}
+
+type geminiFunctionDeclaration struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Parameters  map[string]any `json:"parameters"`
+}
+
+type geminiTool struct {
+	FunctionDeclarations []geminiFunctionDeclaration `json:"functionDeclarations"`
+}
+
+type geminiRequest struct {
+	SystemInstruction *geminiContent  `json:"systemInstruction,omitempty"`
+	Contents          []geminiContent `json:"contents"`
+	Tools             []geminiTool    `json:"tools,omitempty"`
+	GenerationConfig  struct {
+		Temperature     float32  `json:"temperature"`
+		MaxOutputTokens int64    `json:"maxOutputTokens,omitempty"`
+		CandidateCount  int      `json:"candidateCount,omitempty"`
+		StopSequences   []string `json:"stopSequences,omitempty"`
+		Seed            *int64   `json:"seed,omitempty"`
+	} `json:"generationConfig"`
+}
+
+type geminiResponse struct {
+	Candidates []struct {
+		Content      geminiContent `json:"content"`
+		FinishReason string        `json:"finishReason"`
+	} `json:"candidates"`
+	UsageMetadata struct {
+		PromptTokenCount     int64 `json:"promptTokenCount"`
+		CandidatesTokenCount int64 `json:"candidatesTokenCount"`
+	} `json:"usageMetadata"`
+	ModelVersion string `json:"modelVersion"`
+}
+
+func (b *geminiBackend) complete(ctx context.Context, req chatRequest) (chatResponse, error) {
+	var body geminiRequest
+	body.GenerationConfig.Temperature = req.Temperature
+	body.GenerationConfig.MaxOutputTokens = req.MaxTokens
+	body.GenerationConfig.StopSequences = req.Stop
+	body.GenerationConfig.Seed = req.Seed
+	if req.N > 1 {
+		body.GenerationConfig.CandidateCount = req.N
+	}
+	if system := systemPrompt(req.Messages); system != "" {
+		body.SystemInstruction = &geminiContent{Parts: []geminiPart{{Text: system}}}
+	}
+	names := toolCallNames(req.Messages)
+	for i, m := range req.Messages {
+		if m.Role == RoleSystem {
+			continue
+		}
+		role := "user"
+		if m.Role == RoleAssistant {
+			role = "model"
+		}
+		var parts []geminiPart
+		switch {
+		case m.Role == RoleTool:
+			parts = append(parts, geminiPart{FunctionResponse: &geminiFunctionResponse{
+				ID:       geminiCallID(m.ToolCallID),
+				Name:     names[m.ToolCallID],
+				Response: geminiToolResult(m.Content),
+			}})
+		case m.Content != "":
+			parts = append(parts, geminiPart{Text: m.Content})
+		}
+		for _, call := range m.ToolCalls {
+			parts = append(parts, geminiPart{FunctionCall: &geminiFunctionCall{ID: geminiCallID(call.ID), Name: call.Name, Args: toolArguments(call)}})
+		}
+		if len(parts) == 0 {
+			continue
+		}
+		// the results of the calls of a turn are sent in one content
+		if m.Role == RoleTool && i > 0 && req.Messages[i-1].Role == RoleTool {
+			last := &body.Contents[len(body.Contents)-1]
+			last.Parts = append(last.Parts, parts...)
+			continue
+		}
+		body.Contents = append(body.Contents, geminiContent{Role: role, Parts: parts})
+	}
+	if len(req.Tools) > 0 {
+		var declarations []geminiFunctionDeclaration
+		for _, tool := range req.Tools {
+			declarations = append(declarations, geminiFunctionDeclaration{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  geminiSchema(toolParameters(tool)),
+			})
+		}
+		body.Tools = []geminiTool{{FunctionDeclarations: declarations}}
+	}
+
+	var resp geminiResponse
+	endpoint := strings.TrimSuffix(b.baseURL, "/") + "/v1beta/models/" + url.PathEscape(req.Model) + ":generateContent"
+	headers := map[string]string{"x-goog-api-key": b.apiKey}
+	if err := postJSON(ctx, b.client, endpoint, headers, body, &resp); err != nil {
+		return chatResponse{}, err
+	}
+
+	out := chatResponse{
+		Usage: Usage{
+			InputTokens:  resp.UsageMetadata.PromptTokenCount,
+			OutputTokens: resp.UsageMetadata.CandidatesTokenCount,
+		},
+		Fingerprint: resp.ModelVersion,
+	}
+	var text strings.Builder
+	for i, candidate := range resp.Candidates {
+		if req.N > 1 {
+			var choice strings.Builder
+			for _, part := range candidate.Content.Parts {
+				choice.WriteString(part.Text)
+			}
+			out.Choices = append(out.Choices, choice.String())
+			if i > 0 {
+				continue
+			}
+		}
+		out.StopReason = candidate.FinishReason
+		for _, part := range candidate.Content.Parts {
+			text.WriteString(part.Text)
+			if fc := part.FunctionCall; fc != nil {
+				args := string(fc.Args)
+				if args == "" {
+					args = "{}"
+				}
+				id := fc.ID
+				if id == "" {
+					id = fmt.Sprintf("%s%d", geminiLocalCallID, len(out.ToolCalls))
+				}
+				out.ToolCalls = append(out.ToolCalls, ToolCall{ID: id, Name: fc.Name, Arguments: args})
+			}
+		}
+	}
+	out.Text = text.String()
+	return out, nil
+}
+
+// geminiLocalCallID prefixes the IDs given to function calls that Gemini returns
+// without one, so their results can be matched to them. They are not sent back.
+const geminiLocalCallID = "gemini-call-"
+
+// geminiCallID returns the ID of a function call to send to Gemini, empty for an
+// ID given by the client.
+func geminiCallID(id string) string {
+	if strings.HasPrefix(id, geminiLocalCallID) {
+		return ""
+	}
+	return id
+}
+
+// geminiToolResult returns the response of a function, which Gemini takes as a
+// JSON object: a result that is not one is sent as {"content": result}.
+func geminiToolResult(result string) json.RawMessage {
+	trimmed := strings.TrimSpace(result)
+	if strings.HasPrefix(trimmed, "{") && json.Valid([]byte(trimmed)) {
+		return json.RawMessage(trimmed)
+	}
+	wrapped, _ := json.Marshal(map[string]string{"content": result})
+	return wrapped
+}
+
+// geminiSchema returns a copy of a JSON Schema without the keywords that Gemini
+// function declarations reject.
+func geminiSchema(schema map[string]any) map[string]any {
+	out := make(map[string]any, len(schema))
+	for k, v := range schema {
+		switch k {
+		case "additionalProperties", "$schema":
+			continue
+		}
+		switch v := v.(type) {
+		case map[string]any:
+			if k == "properties" {
+				props := make(map[string]any, len(v))
+				for name, p := range v {
+					if ps, ok := p.(map[string]any); ok {
+						props[name] = geminiSchema(ps)
+					} else {
+						props[name] = p
+					}
+				}
+				out[k] = props
+			} else {
+				out[k] = geminiSchema(v)
+			}
+		default:
+			out[k] = v
+		}
+	}
+	return out
+}
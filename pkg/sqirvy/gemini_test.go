@@ -1,3 +1,5 @@
+//go:build !no_gemini
+
 package sqirvy
 
 import (
@@ -55,3 +57,91 @@ func TestGeminiClient_QueryText(t *testing.T) {
 		})
 	}
 }
+
+func TestGeminiBackend(t *testing.T) {
+	server, header, body := providerServer(t, "/v1beta/models/gemini-2.0-flash:generateContent", `{
+		"candidates": [{
+			"content": {"role": "model", "parts": [{"text": "Sure. "}, {"functionCall": {"name": "extract", "args": {"name": "ada"}}}]},
+			"finishReason": "STOP"
+		}],
+		"usageMetadata": {"promptTokenCount": 20, "candidatesTokenCount": 5}
+	}`)
+
+	client, err := NewClientWithConfig(Gemini, Config{APIKey: "test-key", BaseURL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tools := []Tool{{
+		Name: "extract",
+		Parameters: map[string]any{
+			"type":                 "object",
+			"properties":           map[string]any{"name": map[string]any{"type": "string"}},
+			"additionalProperties": false,
+		},
+	}}
+	resp, err := client.QueryWithTools(context.Background(), "be brief", []string{"ada"}, "gemini-2.0-flash", Options{Temperature: 0.5, MaxTokens: 100}, tools)
+	if err != nil {
+		t.Fatalf("QueryWithTools() error = %v", err)
+	}
+
+	if header.Get("X-Goog-Api-Key") != "test-key" {
+		t.Errorf("x-goog-api-key header = %q", header.Get("X-Goog-Api-Key"))
+	}
+	want := map[string]any{
+		"systemInstruction": map[string]any{"parts": []any{map[string]any{"text": "be brief"}}},
+		"contents":          []any{map[string]any{"role": "user", "parts": []any{map[string]any{"text": "ada"}}}},
+		"tools": []any{map[string]any{"functionDeclarations": []any{map[string]any{
+			"name":       "extract",
+			"parameters": map[string]any{"type": "object", "properties": map[string]any{"name": map[string]any{"type": "string"}}},
+		}}}},
+		"generationConfig": map[string]any{"temperature": 1, "maxOutputTokens": 100},
+	}
+	if jsonString(*body) != jsonString(want) {
+		t.Errorf("request body = %s, want %s", jsonString(*body), jsonString(want))
+	}
+
+	wantResp := ToolResponse{
+		Text:      "Sure. ",
+		ToolCalls: []ToolCall{{ID: "gemini-call-0", Name: "extract", Arguments: `{"name": "ada"}`}},
+		Usage:     Usage{InputTokens: 20, OutputTokens: 5},
+	}
+	if jsonString(resp) != jsonString(wantResp) {
+		t.Errorf("QueryWithTools() = %+v, want %+v", resp, wantResp)
+	}
+}
+
+func TestGeminiBackendToolResults(t *testing.T) {
+	server, _, body := providerServer(t, "/v1beta/models/gemini-2.0-flash:generateContent", `{
+		"candidates": [{"content": {"role": "model", "parts": [{"text": "Sunny."}]}, "finishReason": "STOP"}],
+		"usageMetadata": {"promptTokenCount": 30, "candidatesTokenCount": 2}
+	}`)
+
+	client, err := NewClientWithConfig(Gemini, Config{APIKey: "test-key", BaseURL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the ID given to a call that Gemini returned without one is not sent back,
+	// and a result that is not a JSON object is wrapped in one
+	messages := toolConversation("gemini-call-0", "sunny")
+	resp, err := QueryMessagesWithTools(context.Background(), client, messages, "gemini-2.0-flash", Options{}, toolConversationTools)
+	if err != nil {
+		t.Fatalf("QueryMessagesWithTools() error = %v", err)
+	}
+	if resp.Text != "Sunny." {
+		t.Errorf("QueryMessagesWithTools() = %+v", resp)
+	}
+
+	want := []any{
+		map[string]any{"role": "user", "parts": []any{map[string]any{"text": "weather in Paris?"}}},
+		map[string]any{"role": "model", "parts": []any{
+			map[string]any{"text": "Checking."},
+			map[string]any{"functionCall": map[string]any{"name": "get_weather", "args": map[string]any{"city": "Paris"}}},
+		}},
+		map[string]any{"role": "user", "parts": []any{
+			map[string]any{"functionResponse": map[string]any{"name": "get_weather", "response": map[string]any{"content": "sunny"}}},
+		}},
+	}
+	if got := jsonString((*body)["contents"]); got != jsonString(want) {
+		t.Errorf("request contents = %s, want %s", got, jsonString(want))
+	}
+}
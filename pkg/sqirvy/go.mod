@@ -0,0 +1,3 @@
+module github.com/dmh2000/sqirvy-cli/pkg/sqirvy
+
+go 1.24.1
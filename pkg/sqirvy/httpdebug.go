@@ -0,0 +1,148 @@
+// Package sqirvy provides debug logging of provider HTTP traffic.
+//
+// SetHTTPDebug writes every provider request and response, with headers and
+// bodies, to a writer. It covers the provider queries and the API requests for
+// model discovery, credential validation and batch jobs.
+// Credentials are redacted from the headers, the URL and the bodies.
+package sqirvy
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// redacted replaces credentials in debug output.
+const redacted = "REDACTED"
+
+// credentialHeaders are the request headers that carry API keys.
+var credentialHeaders = []string{"Authorization", "X-Api-Key", "X-Goog-Api-Key", "Api-Key", "Proxy-Authorization"}
+
+// credentialEnv are the environment variables holding API keys, whose values are
+// redacted wherever they appear in debug output.
+var credentialEnv = []string{"ANTHROPIC_API_KEY", "GEMINI_API_KEY", "OPENAI_API_KEY", "LLAMA_API_KEY"}
+
+var (
+	httpDebugMu sync.Mutex
+	httpDebug   io.Writer // destination of debug output, or nil
+)
+
+// SetHTTPDebug writes the requests and responses of clients created afterwards to w.
+// A nil writer turns debug output off.
+func SetHTTPDebug(w io.Writer) {
+	httpDebugMu.Lock()
+	defer httpDebugMu.Unlock()
+	httpDebug = w
+}
+
+// httpDebugEnabled reports whether debug output is on.
+func httpDebugEnabled() bool {
+	httpDebugMu.Lock()
+	defer httpDebugMu.Unlock()
+	return httpDebug != nil
+}
+
+// debugTransport writes each exchange to the debug writer.
+type debugTransport struct {
+	base http.RoundTripper
+}
+
+func (t *debugTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		body, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		reqBody = body
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	elapsed := time.Since(start)
+
+	var out strings.Builder
+	fmt.Fprintf(&out, ">>> %s %s\n", req.Method, redactURL(req))
+	writeDebugHeaders(&out, req.Header)
+	writeDebugBody(&out, reqBody)
+	if err != nil {
+		fmt.Fprintf(&out, "<<< error after %s: %v\n\n", elapsed.Round(time.Millisecond), err)
+		writeDebug(out.String())
+		return nil, err
+	}
+
+	respBody, readErr := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+	fmt.Fprintf(&out, "<<< %s in %s\n", resp.Status, elapsed.Round(time.Millisecond))
+	writeDebugHeaders(&out, resp.Header)
+	writeDebugBody(&out, respBody)
+	out.WriteString("\n")
+	writeDebug(out.String())
+	if readErr != nil {
+		return nil, readErr
+	}
+	return resp, nil
+}
+
+// writeDebug writes one exchange with credentials redacted.
+func writeDebug(s string) {
+	for _, name := range credentialEnv {
+		if key := os.Getenv(name); len(key) >= 8 {
+			s = strings.ReplaceAll(s, key, redacted)
+		}
+	}
+	httpDebugMu.Lock()
+	defer httpDebugMu.Unlock()
+	if httpDebug != nil {
+		io.WriteString(httpDebug, s)
+	}
+}
+
+// writeDebugHeaders writes the headers sorted by name, with credential headers redacted.
+func writeDebugHeaders(out *strings.Builder, header http.Header) {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		for _, value := range header[name] {
+			if slices.Contains(credentialHeaders, http.CanonicalHeaderKey(name)) {
+				value = redacted
+			}
+			fmt.Fprintf(out, "%s: %s\n", name, value)
+		}
+	}
+}
+
+// writeDebugBody writes a body, if any, after a blank line.
+func writeDebugBody(out *strings.Builder, body []byte) {
+	if len(body) == 0 {
+		return
+	}
+	out.WriteString("\n")
+	out.Write(body)
+	if !bytes.HasSuffix(body, []byte("\n")) {
+		out.WriteString("\n")
+	}
+}
+
+// redactURL returns the request URL with the key query parameter redacted.
+func redactURL(req *http.Request) string {
+	u := *req.URL
+	q := u.Query()
+	if q.Has("key") {
+		q.Set("key", redacted)
+		u.RawQuery = q.Encode()
+	}
+	return u.String()
+}
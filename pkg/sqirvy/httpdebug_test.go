@@ -0,0 +1,58 @@
+package sqirvy
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHTTPDebug(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"data": [{"id": "gpt-4o"}]}`))
+	}))
+	defer server.Close()
+	t.Setenv("OPENAI_API_KEY", "sk-debug-secret-key")
+	t.Setenv("OPENAI_BASE_URL", server.URL+"/v1")
+
+	var buf bytes.Buffer
+	SetHTTPDebug(&buf)
+	defer SetHTTPDebug(nil)
+
+	if _, err := ListRemoteModels(context.Background(), OpenAI); err != nil {
+		t.Fatalf("ListRemoteModels() error = %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		">>> GET " + server.URL + "/v1/models",
+		"Authorization: REDACTED",
+		"<<< 200 OK",
+		`{"data": [{"id": "gpt-4o"}]}`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("debug output does not contain %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "sk-debug-secret-key") {
+		t.Errorf("debug output contains the API key:\n%s", out)
+	}
+}
+
+func TestRedactURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://example.com/v1/models", "https://example.com/v1/models"},
+		{"https://example.com/v1/models?key=secret", "https://example.com/v1/models?key=REDACTED"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+		if got := redactURL(req); got != tt.want {
+			t.Errorf("redactURL(%s) = %s, want %s", tt.url, got, tt.want)
+		}
+	}
+}
@@ -1,7 +1,9 @@
-// Package sqirvy provides integration with Meta's Llama models via langchaingo.
+//go:build !no_llama
+
+// Package sqirvy provides integration with Meta's Llama models.
 //
 // This file implements the Client interface for Meta's Llama models using
-// langchaingo's OpenAI-compatible interface. It handles model initialization,
+// the OpenAI-compatible Chat Completions API. It handles model initialization,
 // prompt formatting, and response parsing.
 package sqirvy
 
@@ -9,23 +11,24 @@ import (
 	"context"
 	"fmt"
 	"os"
-
-	"github.com/tmc/langchaingo/llms"
-	"github.com/tmc/langchaingo/llms/openai"
 )
 
-const llama_temperature_scale = 1.0
+// init adds the Llama provider to the provider registry.
+func init() {
+	providerRegistry[Llama] = providerEntry{fromEnv: envClient(NewLlamaClient), fromConfig: configClient(newLlamaClient), maxTemperature: 1}
+}
 
 // LlamaClient implements the Client interface for Meta's Llama models.
 // It provides methods for querying Llama language models through
 // an OpenAI-compatible interface.
 type LlamaClient struct {
-	llm              llms.Model // OpenAI-compatible LLM client
-	temperatureScale float32
+	api    backend // OpenAI-compatible API client
+	config Config  // API key and endpoint, for credential checks
 }
 
-// Ensure LlamaClient implements the Client interface
+// Ensure LlamaClient implements the Client and ToolMessagesClient interfaces
 var _ Client = (*LlamaClient)(nil)
+var _ ToolMessagesClient = (*LlamaClient)(nil)
 
 // NewLlamaClient creates a new instance of LlamaClient using an OpenAI-compatible interface.
 // It returns an error if the required LLAMA_API_KEY or LLAMA_BASE_URL environment variables are not set.
@@ -47,17 +50,23 @@ func NewLlamaClient() (*LlamaClient, error) {
 		return nil, fmt.Errorf("LLAMA_BASE_URL environment variable not set")
 	}
 
-	llm, err := openai.New(
-		openai.WithBaseURL(baseURL),
-		openai.WithToken(apiKey),
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create Llama client: %w", err)
+	return newLlamaClient(Config{APIKey: apiKey, BaseURL: baseURL})
+}
+
+// newLlamaClient creates a LlamaClient from an explicit configuration.
+func newLlamaClient(cfg Config) (*LlamaClient, error) {
+	if cfg.BaseURL == "" {
+		return nil, fmt.Errorf("base URL not set for Llama")
 	}
 
 	return &LlamaClient{
-		llm:              llm,
-		temperatureScale: llama_temperature_scale, // Default temperature scale for Llama
+		api: &openaiBackend{
+			client:          cfg.apiHTTPClient(Llama),
+			baseURL:         cfg.BaseURL,
+			apiKey:          cfg.APIKey,
+			legacyMaxTokens: true,
+		},
+		config: cfg,
 	}, nil
 }
 
@@ -70,18 +79,73 @@ func (c *LlamaClient) QueryText(ctx context.Context, system string, prompts []st
 		return "", fmt.Errorf("invalid or unsupported Llama model: %s", model)
 	}
 
-	// scale the temperature
-	options.Temperature = options.Temperature * c.temperatureScale
-	options.MaxTokens = GetMaxTokens(model)
+	options.MaxTokens = limitMaxTokens(model, options.MaxTokens)
+
+	return queryText(ctx, c.api, system, prompts, model, options)
+}
+
+// QueryTextUsage is QueryText for Llama models that also returns the token usage
+// reported by the provider.
+func (c *LlamaClient) QueryTextUsage(ctx context.Context, system string, prompts []string, model string, options Options) (string, Usage, error) {
+	provider, err := GetProviderName(model)
+	if err != nil || provider != Llama {
+		return "", Usage{}, fmt.Errorf("invalid or unsupported Llama model: %s", model)
+	}
+
+	options.MaxTokens = limitMaxTokens(model, options.MaxTokens)
+
+	return queryTextUsage(ctx, c.api, system, prompts, model, options)
+}
+
+// QueryMessages sends a conversation with explicit roles to the specified Llama model
+// and returns the response and the token usage reported by the provider.
+func (c *LlamaClient) QueryMessages(ctx context.Context, messages []Message, model string, options Options) (string, Usage, error) {
+	provider, err := GetProviderName(model)
+	if err != nil || provider != Llama {
+		return "", Usage{}, fmt.Errorf("invalid or unsupported Llama model: %s", model)
+	}
+
+	options.MaxTokens = limitMaxTokens(model, options.MaxTokens)
+
+	return queryMessages(ctx, c.api, messages, model, options)
+}
+
+// QueryWithTools sends a query to the specified Llama model along with a set of
+// tool definitions. The response contains any text and the tool calls requested by the model.
+func (c *LlamaClient) QueryWithTools(ctx context.Context, system string, prompts []string, model string, options Options, tools []Tool) (ToolResponse, error) {
+	provider, err := GetProviderName(model)
+	if err != nil || provider != Llama {
+		return ToolResponse{}, fmt.Errorf("invalid or unsupported Llama model: %s", model)
+	}
+
+	options.MaxTokens = limitMaxTokens(model, options.MaxTokens)
+
+	return queryWithTools(ctx, c.api, system, prompts, model, options, tools)
+}
+
+// QueryMessagesWithTools sends a conversation with the results of tool calls to
+// the specified Llama model along with a set of tool definitions. The response
+// contains any text and the tool calls requested by the model.
+func (c *LlamaClient) QueryMessagesWithTools(ctx context.Context, messages []Message, model string, options Options, tools []Tool) (ToolResponse, error) {
+	provider, err := GetProviderName(model)
+	if err != nil || provider != Llama {
+		return ToolResponse{}, fmt.Errorf("invalid or unsupported Llama model: %s", model)
+	}
+
+	options.MaxTokens = limitMaxTokens(model, options.MaxTokens)
+
+	return queryMessagesWithTools(ctx, c.api, messages, model, options, tools)
+}
 
-	return queryTextLangChain(ctx, c.llm, system, prompts, model, options)
+// ValidateCredentials checks the Llama API key with a request that does not consume tokens.
+func (c *LlamaClient) ValidateCredentials(ctx context.Context) error {
+	return c.config.validateCredentials(ctx, Llama)
 }
 
 // Close implements the Close method for the Client interface.
 //
 // For the Llama client, this method does not require any action as the
-// underlying langchaingo client does not need to be explicitly closed.
+// underlying HTTP client does not need to be explicitly closed.
 func (c *LlamaClient) Close() error {
-	// the langchain llm does not require explicit close
 	return nil
 }
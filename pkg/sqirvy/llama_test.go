@@ -1,3 +1,5 @@
+//go:build !no_llama
+
 package sqirvy
 
 import (
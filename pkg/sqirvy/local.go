@@ -0,0 +1,141 @@
+// Package sqirvy provides the local provider, which runs GGUF model files in
+// process with llama.cpp, without an inference server or an API key.
+//
+// The model of a local query is the path of a GGUF file, e.g.
+// -m ./models/qwen2.5-7b-instruct-q4_k_m.gguf. llama.cpp is linked with cgo,
+// so the provider is only available in binaries built with the llamacpp build
+// tag; other builds report an error when a local model is queried. The runtime
+// is configured with environment variables:
+//
+//	LLAMACPP_CONTEXT_SIZE  context size in tokens (default 4096)
+//	LLAMACPP_GPU_LAYERS    layers offloaded to the GPU (default 0)
+//	LLAMACPP_THREADS       threads used for generation (default: the number of CPUs)
+package sqirvy
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// localSettings configure the llama.cpp runtime of the local provider.
+type localSettings struct {
+	ContextSize int // context size in tokens
+	GPULayers   int // layers offloaded to the GPU
+	Threads     int // threads used for generation
+}
+
+// localEngine generates completions with llama.cpp and owns the loaded models.
+type localEngine interface {
+	backend
+	close() error
+}
+
+// LocalClient implements the Client interface for GGUF models run in process.
+type LocalClient struct {
+	api localEngine
+}
+
+// Ensure LocalClient implements the Client interface
+var _ Client = (*LocalClient)(nil)
+
+// LocalEngineIncluded reports whether the binary was built with llama.cpp, with
+// -tags llamacpp, so that the local provider can run GGUF models.
+func LocalEngineIncluded() bool {
+	return llamacppIncluded
+}
+
+// IsLocalModel reports whether model is the path of a GGUF model file.
+func IsLocalModel(model string) bool {
+	return strings.HasSuffix(strings.ToLower(model), ".gguf")
+}
+
+// NewLocalClient creates a client for the local provider with the settings of the
+// LLAMACPP_* environment variables. It returns an error if the binary was built
+// without llama.cpp or a setting is invalid.
+func NewLocalClient() (*LocalClient, error) {
+	settings, err := localSettingsFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	api, err := newLocalEngine(settings)
+	if err != nil {
+		return nil, err
+	}
+	return &LocalClient{api: api}, nil
+}
+
+// localSettingsFromEnv returns the settings of the LLAMACPP_* environment variables.
+func localSettingsFromEnv() (localSettings, error) {
+	s := localSettings{ContextSize: 4096, Threads: runtime.NumCPU()}
+	for _, v := range []struct {
+		name  string
+		value *int
+	}{
+		{"LLAMACPP_CONTEXT_SIZE", &s.ContextSize},
+		{"LLAMACPP_GPU_LAYERS", &s.GPULayers},
+		{"LLAMACPP_THREADS", &s.Threads},
+	} {
+		text := os.Getenv(v.name)
+		if text == "" {
+			continue
+		}
+		n, err := strconv.Atoi(text)
+		if err != nil || n < 0 {
+			return localSettings{}, fmt.Errorf("invalid %s: %q", v.name, text)
+		}
+		*v.value = n
+	}
+	if s.ContextSize == 0 || s.Threads == 0 {
+		return localSettings{}, fmt.Errorf("LLAMACPP_CONTEXT_SIZE and LLAMACPP_THREADS must be positive")
+	}
+	return s, nil
+}
+
+// QueryText sends the prompts to the GGUF model and returns the generated text.
+func (c *LocalClient) QueryText(ctx context.Context, system string, prompts []string, model string, options Options) (string, error) {
+	response, _, err := c.QueryTextUsage(ctx, system, prompts, model, options)
+	return response, err
+}
+
+// QueryTextUsage is QueryText for GGUF models that also returns the token usage
+// counted by llama.cpp.
+func (c *LocalClient) QueryTextUsage(ctx context.Context, system string, prompts []string, model string, options Options) (string, Usage, error) {
+	provider, err := GetProviderName(model)
+	if err != nil || provider != Local {
+		return "", Usage{}, fmt.Errorf("invalid or unsupported local model: %s", model)
+	}
+	options.MaxTokens = limitMaxTokens(model, options.MaxTokens)
+
+	return queryTextUsage(ctx, c.api, system, prompts, model, options)
+}
+
+// QueryMessages sends a conversation with explicit roles to the GGUF model and
+// returns the response and the token usage counted by llama.cpp.
+func (c *LocalClient) QueryMessages(ctx context.Context, messages []Message, model string, options Options) (string, Usage, error) {
+	provider, err := GetProviderName(model)
+	if err != nil || provider != Local {
+		return "", Usage{}, fmt.Errorf("invalid or unsupported local model: %s", model)
+	}
+	options.MaxTokens = limitMaxTokens(model, options.MaxTokens)
+
+	return queryMessages(ctx, c.api, messages, model, options)
+}
+
+// QueryWithTools is not supported by the local provider, which has no tool calling.
+func (c *LocalClient) QueryWithTools(ctx context.Context, system string, prompts []string, model string, options Options, tools []Tool) (ToolResponse, error) {
+	return ToolResponse{}, fmt.Errorf("tool calling is not supported by the local provider: %s", model)
+}
+
+// ValidateCredentials always succeeds, the local provider has no API key.
+func (c *LocalClient) ValidateCredentials(ctx context.Context) error {
+	return nil
+}
+
+// Close frees the models loaded by the client.
+func (c *LocalClient) Close() error {
+	return c.api.close()
+}
@@ -0,0 +1,237 @@
+//go:build llamacpp
+
+package sqirvy
+
+// The llama.cpp API used here is that of release b5000, which the llamacpp CI job
+// builds against. CGO_CFLAGS and CGO_LDFLAGS locate llama.h and libllama when they
+// are not in the default paths.
+
+/*
+#cgo LDFLAGS: -lllama
+#include <stdlib.h>
+#include <llama.h>
+*/
+import "C"
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"unsafe"
+)
+
+// llamacppIncluded reports whether the binary runs GGUF models with llama.cpp.
+const llamacppIncluded = true
+
+// llamaBackendOnce initializes llama.cpp once per process.
+var llamaBackendOnce sync.Once
+
+// llamaEngine runs GGUF models with llama.cpp. Models are loaded on first use and
+// kept until the client is closed; every request gets its own context, so
+// concurrent queries do not share state.
+type llamaEngine struct {
+	settings localSettings
+
+	mu     sync.Mutex
+	models map[string]*C.struct_llama_model // loaded models by path
+}
+
+// newLocalEngine initializes llama.cpp.
+func newLocalEngine(settings localSettings) (localEngine, error) {
+	llamaBackendOnce.Do(func() { C.llama_backend_init() })
+	return &llamaEngine{settings: settings, models: make(map[string]*C.struct_llama_model)}, nil
+}
+
+// model returns the loaded model of a GGUF file, loading it on first use.
+func (e *llamaEngine) model(path string) (*C.struct_llama_model, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if m, ok := e.models[path]; ok {
+		return m, nil
+	}
+	params := C.llama_model_default_params()
+	params.n_gpu_layers = C.int32_t(e.settings.GPULayers)
+	cpath := C.CString(path)
+	defer C.free(unsafe.Pointer(cpath))
+	m := C.llama_model_load_from_file(cpath, params)
+	if m == nil {
+		return nil, fmt.Errorf("failed to load GGUF model %s", path)
+	}
+	e.models[path] = m
+	return m, nil
+}
+
+// complete generates the response to the request with the model file it names.
+func (e *llamaEngine) complete(ctx context.Context, req chatRequest) (chatResponse, error) {
+	model, err := e.model(req.Model)
+	if err != nil {
+		return chatResponse{}, err
+	}
+	vocab := C.llama_model_get_vocab(model)
+
+	prompt, err := llamaChatPrompt(model, req.Messages)
+	if err != nil {
+		return chatResponse{}, err
+	}
+	tokens, err := llamaTokenize(vocab, prompt)
+	if err != nil {
+		return chatResponse{}, err
+	}
+	defer C.free(unsafe.Pointer(tokens.ptr))
+	if tokens.n >= e.settings.ContextSize {
+		return chatResponse{}, fmt.Errorf("prompt of %d tokens does not fit the context size of %d tokens (set LLAMACPP_CONTEXT_SIZE)", tokens.n, e.settings.ContextSize)
+	}
+
+	cparams := C.llama_context_default_params()
+	cparams.n_ctx = C.uint32_t(e.settings.ContextSize)
+	cparams.n_batch = C.uint32_t(e.settings.ContextSize)
+	cparams.n_threads = C.int32_t(e.settings.Threads)
+	cparams.n_threads_batch = C.int32_t(e.settings.Threads)
+	lctx := C.llama_init_from_model(model, cparams)
+	if lctx == nil {
+		return chatResponse{}, fmt.Errorf("failed to create llama.cpp context for %s", req.Model)
+	}
+	defer C.llama_free(lctx)
+
+	sampler := llamaSampler(req.Temperature, req.Seed)
+	defer C.llama_sampler_free(sampler)
+
+	// evaluate the prompt, then generate one token at a time
+	if C.llama_decode(lctx, C.llama_batch_get_one(tokens.ptr, C.int32_t(tokens.n))) != 0 {
+		return chatResponse{}, fmt.Errorf("llama.cpp failed to evaluate the prompt")
+	}
+	next := (*C.llama_token)(C.malloc(C.size_t(unsafe.Sizeof(C.llama_token(0)))))
+	defer C.free(unsafe.Pointer(next))
+	piece := make([]byte, 256)
+
+	var text []byte
+	stop := "length"
+	generated := int64(0)
+	for generated < req.MaxTokens && tokens.n+int(generated) < e.settings.ContextSize {
+		if ctx.Err() != nil {
+			return chatResponse{}, fmt.Errorf("request context error %w", ctx.Err())
+		}
+		*next = C.llama_sampler_sample(sampler, lctx, -1)
+		if C.llama_vocab_is_eog(vocab, *next) {
+			stop = "stop"
+			break
+		}
+		generated++
+		n := C.llama_token_to_piece(vocab, *next, (*C.char)(unsafe.Pointer(&piece[0])), C.int32_t(len(piece)), 0, false)
+		if n < 0 {
+			return chatResponse{}, fmt.Errorf("llama.cpp failed to convert token %d to text", int(*next))
+		}
+		text = append(text, piece[:n]...)
+		if len(req.Stop) > 0 {
+			if cut, ok := cutAtStop(string(text), req.Stop); ok {
+				text = []byte(cut)
+				stop = "stop"
+				break
+			}
+		}
+		if C.llama_decode(lctx, C.llama_batch_get_one(next, 1)) != 0 {
+			return chatResponse{}, fmt.Errorf("llama.cpp failed to evaluate the response")
+		}
+	}
+
+	return chatResponse{
+		Text:       string(text),
+		Usage:      Usage{InputTokens: int64(tokens.n), OutputTokens: generated},
+		StopReason: stop,
+	}, nil
+}
+
+// close frees the loaded models.
+func (e *llamaEngine) close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for path, m := range e.models {
+		C.llama_model_free(m)
+		delete(e.models, path)
+	}
+	return nil
+}
+
+// llamaChatPrompt formats the messages with the chat template of the model.
+func llamaChatPrompt(model *C.struct_llama_model, messages []Message) (string, error) {
+	tmpl := C.llama_model_chat_template(model, nil)
+	if tmpl == nil {
+		return "", fmt.Errorf("GGUF model has no chat template")
+	}
+
+	chat := (*[1 << 20]C.struct_llama_chat_message)(C.malloc(C.size_t(len(messages)) * C.size_t(unsafe.Sizeof(C.struct_llama_chat_message{}))))[:len(messages):len(messages)]
+	defer C.free(unsafe.Pointer(&chat[0]))
+	for i, m := range messages {
+		chat[i].role = C.CString(string(m.Role))
+		chat[i].content = C.CString(m.Content)
+	}
+	defer func() {
+		for i := range chat {
+			C.free(unsafe.Pointer(chat[i].role))
+			C.free(unsafe.Pointer(chat[i].content))
+		}
+	}()
+
+	size := 0
+	for _, m := range messages {
+		size += 2 * len(m.Content)
+	}
+	size += 1024
+	for {
+		buf := (*C.char)(C.malloc(C.size_t(size)))
+		n := int(C.llama_chat_apply_template(tmpl, &chat[0], C.size_t(len(chat)), true, buf, C.int32_t(size)))
+		if n < 0 {
+			C.free(unsafe.Pointer(buf))
+			return "", fmt.Errorf("chat template of the GGUF model is not supported by llama.cpp")
+		}
+		if n <= size {
+			prompt := C.GoStringN(buf, C.int(n))
+			C.free(unsafe.Pointer(buf))
+			return prompt, nil
+		}
+		C.free(unsafe.Pointer(buf))
+		size = n
+	}
+}
+
+// llamaTokens is a token buffer allocated in C memory, so llama.cpp may keep
+// pointers to it.
+type llamaTokens struct {
+	ptr *C.llama_token
+	n   int
+}
+
+// llamaTokenize returns the tokens of the prompt. The caller frees the buffer.
+func llamaTokenize(vocab *C.struct_llama_vocab, prompt string) (llamaTokens, error) {
+	cprompt := C.CString(prompt)
+	defer C.free(unsafe.Pointer(cprompt))
+
+	// a first call without a buffer returns the negated number of tokens
+	n := -int(C.llama_tokenize(vocab, cprompt, C.int32_t(len(prompt)), nil, 0, true, true))
+	if n <= 0 {
+		return llamaTokens{}, fmt.Errorf("llama.cpp failed to tokenize the prompt")
+	}
+	ptr := (*C.llama_token)(C.malloc(C.size_t(n) * C.size_t(unsafe.Sizeof(C.llama_token(0)))))
+	if int(C.llama_tokenize(vocab, cprompt, C.int32_t(len(prompt)), ptr, C.int32_t(n), true, true)) != n {
+		C.free(unsafe.Pointer(ptr))
+		return llamaTokens{}, fmt.Errorf("llama.cpp failed to tokenize the prompt")
+	}
+	return llamaTokens{ptr: ptr, n: n}, nil
+}
+
+// llamaSampler returns the sampler of a temperature: greedy at 0, otherwise
+// random sampling from the distribution scaled by the temperature.
+func llamaSampler(temperature float32, seed *int64) *C.struct_llama_sampler {
+	sampler := C.llama_sampler_chain_init(C.llama_sampler_chain_default_params())
+	if temperature <= 0 {
+		C.llama_sampler_chain_add(sampler, C.llama_sampler_init_greedy())
+		return sampler
+	}
+	C.llama_sampler_chain_add(sampler, C.llama_sampler_init_temp(C.float(temperature)))
+	dist := C.uint32_t(C.LLAMA_DEFAULT_SEED)
+	if seed != nil {
+		dist = C.uint32_t(uint32(*seed))
+	}
+	C.llama_sampler_chain_add(sampler, C.llama_sampler_init_dist(dist))
+	return sampler
+}
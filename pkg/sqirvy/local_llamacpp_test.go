@@ -0,0 +1,73 @@
+//go:build llamacpp
+
+package sqirvy
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestLocalEngineIncluded(t *testing.T) {
+	if !LocalEngineIncluded() {
+		t.Error("LocalEngineIncluded() = false with the llamacpp tag")
+	}
+}
+
+func TestLocalClient_QueryText(t *testing.T) {
+	model := os.Getenv("LLAMACPP_TEST_MODEL")
+	if model == "" {
+		t.Skip("LLAMACPP_TEST_MODEL not set")
+	}
+	if err := RegisterModel(model, ModelInfo{Provider: Local, MaxTokens: 64, ContextWindow: 2048}); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("LLAMACPP_CONTEXT_SIZE", "2048")
+	client, err := NewLocalClient()
+	if err != nil {
+		t.Fatalf("NewLocalClient() error = %v", err)
+	}
+	defer client.Close()
+
+	tests := []struct {
+		name     string
+		messages []Message
+		wantErr  bool
+	}{
+		{
+			name:     "system and user",
+			messages: []Message{{Role: RoleSystem, Content: "Answer in one word."}, {Role: RoleUser, Content: "What color is the sky?"}},
+		},
+		{
+			name:     "conversation",
+			messages: []Message{{Role: RoleUser, Content: "Say hello."}, {Role: RoleAssistant, Content: "Hello."}, {Role: RoleUser, Content: "Say it again."}},
+		},
+		{
+			name:    "no messages",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, usage, err := client.QueryMessages(context.Background(), tt.messages, model, Options{MaxTokens: 16})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("QueryMessages() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if strings.TrimSpace(got) == "" {
+				t.Error("QueryMessages() returned an empty response")
+			}
+			if usage.InputTokens == 0 || usage.OutputTokens == 0 || usage.OutputTokens > 16 {
+				t.Errorf("QueryMessages() usage = %+v, want input tokens and at most 16 output tokens", usage)
+			}
+		})
+	}
+
+	if _, err := client.QueryText(context.Background(), "", []string{"hello"}, "./missing.gguf", Options{}); err == nil {
+		t.Error("QueryText() of an unregistered model succeeded")
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !llamacpp
+
+package sqirvy
+
+import "fmt"
+
+// llamacppIncluded reports whether the binary runs GGUF models with llama.cpp.
+const llamacppIncluded = false
+
+// newLocalEngine reports that the binary was built without llama.cpp.
+func newLocalEngine(settings localSettings) (localEngine, error) {
+	return nil, fmt.Errorf("local GGUF models are not supported by this build: rebuild with -tags llamacpp")
+}
@@ -0,0 +1,63 @@
+package sqirvy
+
+import (
+	"testing"
+)
+
+func TestIsLocalModel(t *testing.T) {
+	tests := []struct {
+		model string
+		want  bool
+	}{
+		{"./models/qwen2.5-7b-instruct-q4_k_m.gguf", true},
+		{"/opt/models/Llama-3.2-3B.Q8_0.GGUF", true},
+		{"gpt-4o", false},
+		{"gguf", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			if got := IsLocalModel(tt.model); got != tt.want {
+				t.Errorf("IsLocalModel(%q) = %v, want %v", tt.model, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLocalSettingsFromEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    localSettings
+		wantErr bool
+	}{
+		{
+			name: "configured",
+			env:  map[string]string{"LLAMACPP_CONTEXT_SIZE": "8192", "LLAMACPP_GPU_LAYERS": "99", "LLAMACPP_THREADS": "4"},
+			want: localSettings{ContextSize: 8192, GPULayers: 99, Threads: 4},
+		},
+		{
+			name:    "not a number",
+			env:     map[string]string{"LLAMACPP_CONTEXT_SIZE": "big"},
+			wantErr: true,
+		},
+		{
+			name:    "zero context",
+			env:     map[string]string{"LLAMACPP_CONTEXT_SIZE": "0"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range []string{"LLAMACPP_CONTEXT_SIZE", "LLAMACPP_GPU_LAYERS", "LLAMACPP_THREADS"} {
+				t.Setenv(name, tt.env[name])
+			}
+			got, err := localSettingsFromEnv()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("localSettingsFromEnv() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("localSettingsFromEnv() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
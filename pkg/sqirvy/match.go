@@ -0,0 +1,167 @@
+// Package sqirvy provides model name resolution helpers.
+//
+// This file resolves unique-prefix shorthand for model names and suggests
+// close matches for names that do not resolve.
+package sqirvy
+
+import (
+	"maps"
+	"sort"
+	"strings"
+)
+
+// maxSuggestions is the maximum number of suggestions returned by SuggestNames
+const maxSuggestions = 5
+
+// Resolution describes how a model name given by the user was resolved.
+type Resolution struct {
+	Input     string   // the name as given
+	Prefix    string   // the model or alias name the input is a unique prefix of, if any
+	Alias     string   // the alias that was followed, if any
+	Model     string   // the resolved model name, the input if it did not resolve
+	Ambiguous []string // the names the input is a prefix of, if they name several models
+}
+
+// ResolveModel returns the registered model name for the input.
+// The input is resolved in this order: an alias, an exact model name, then a
+// prefix of exactly one model or alias name (e.g. "gpt-4o-m" for "gpt-4o-mini").
+// If none of these match, the input is returned unchanged.
+func ResolveModel(model string) string {
+	return ExplainModel(model).Model
+}
+
+// ExplainModel resolves the input like ResolveModel and returns each step of the
+// resolution.
+func ExplainModel(model string) Resolution {
+	r := Resolution{Input: model, Model: model}
+	if target, ok := modelAlias[model]; ok {
+		r.Alias, r.Model = model, target
+		return r
+	}
+	if _, ok := modelRegistry[model]; ok {
+		return r
+	}
+	if model == "" {
+		return r
+	}
+
+	var names []string
+	match, ambiguous := "", false
+	for _, name := range knownModelNames() {
+		if !strings.HasPrefix(name, model) {
+			continue
+		}
+		names = append(names, name)
+		target := GetModelAlias(name)
+		switch {
+		case match == "":
+			match, r.Prefix = target, name
+		case match != target:
+			ambiguous = true
+		}
+	}
+	if ambiguous {
+		r.Prefix, r.Ambiguous = "", names
+		return r
+	}
+	if match == "" {
+		return r
+	}
+	if _, ok := modelAlias[r.Prefix]; ok {
+		r.Alias = r.Prefix
+	}
+	r.Model = match
+	return r
+}
+
+// GetAliases returns a copy of the registered aliases and the models they name.
+func GetAliases() map[string]string {
+	return maps.Clone(modelAlias)
+}
+
+// SuggestModels returns registered model names and aliases that are close to the
+// input, best matches first. Names that start with the input, or that are within
+// a small edit distance of it, are considered close.
+func SuggestModels(model string) []string {
+	return SuggestNames(model, knownModelNames())
+}
+
+// SuggestNames returns the candidates that are close to the name, best matches
+// first, as SuggestModels does for model names. It suggests the keys of a config
+// file or the commands of a program the same way.
+func SuggestNames(name string, candidates []string) []string {
+	if name == "" {
+		return nil
+	}
+
+	type candidate struct {
+		name     string
+		distance int
+	}
+	var matches []candidate
+
+	// allow roughly one typo per four characters
+	maxDistance := len(name) / 4
+	if maxDistance < 2 {
+		maxDistance = 2
+	}
+
+	for _, c := range candidates {
+		switch {
+		case strings.HasPrefix(c, name):
+			matches = append(matches, candidate{c, 0})
+		default:
+			if d := levenshtein(name, c); d <= maxDistance {
+				matches = append(matches, candidate{c, d})
+			}
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].distance != matches[j].distance {
+			return matches[i].distance < matches[j].distance
+		}
+		return matches[i].name < matches[j].name
+	})
+
+	var suggestions []string
+	for i := 0; i < len(matches) && i < maxSuggestions; i++ {
+		suggestions = append(suggestions, matches[i].name)
+	}
+	return suggestions
+}
+
+// knownModelNames returns all registered model names and aliases, sorted.
+func knownModelNames() []string {
+	names := make([]string, 0, len(modelRegistry)+len(modelAlias))
+	for name := range modelRegistry {
+		names = append(names, name)
+	}
+	for name := range modelAlias {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// levenshtein returns the edit distance between a and b.
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
@@ -0,0 +1,126 @@
+package sqirvy
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestResolveModel(t *testing.T) {
+	tests := []struct {
+		name  string
+		model string
+		want  string
+	}{
+		{
+			name:  "Exact model",
+			model: "gpt-4o",
+			want:  "gpt-4o",
+		},
+		{
+			name:  "Alias",
+			model: "claude-3-5-haiku",
+			want:  "claude-3-5-haiku-latest",
+		},
+		{
+			name:  "Unique prefix",
+			model: "gpt-4o-m",
+			want:  "gpt-4o-mini",
+		},
+		{
+			name:  "Ambiguous prefix",
+			model: "gemini-2.5",
+			want:  "gemini-2.5",
+		},
+		{
+			name:  "No match",
+			model: "no-such-model",
+			want:  "no-such-model",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ResolveModel(tt.model); got != tt.want {
+				t.Errorf("ResolveModel(%q) = %q, want %q", tt.model, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExplainModel(t *testing.T) {
+	tests := []struct {
+		name  string
+		model string
+		want  Resolution
+	}{
+		{"Exact model", "gpt-4o", Resolution{Input: "gpt-4o", Model: "gpt-4o"}},
+		{"Alias", "claude-3-5-haiku", Resolution{Input: "claude-3-5-haiku", Alias: "claude-3-5-haiku", Model: "claude-3-5-haiku-latest"}},
+		{"Prefix of a model", "gpt-4o-m", Resolution{Input: "gpt-4o-m", Prefix: "gpt-4o-mini", Model: "gpt-4o-mini"}},
+		{"Prefix of an alias", "claude-3-o", Resolution{Input: "claude-3-o", Prefix: "claude-3-opus", Alias: "claude-3-opus", Model: "claude-3-opus-latest"}},
+		{"Ambiguous prefix", "gemini-2.5", Resolution{Input: "gemini-2.5", Model: "gemini-2.5", Ambiguous: []string{"gemini-2.5-flash", "gemini-2.5-flash-preview-04-17", "gemini-2.5-pro", "gemini-2.5-pro-preview-03-25"}}},
+		{"No match", "no-such-model", Resolution{Input: "no-such-model", Model: "no-such-model"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ExplainModel(tt.model); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ExplainModel(%q) = %+v, want %+v", tt.model, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSuggestModels(t *testing.T) {
+	got := SuggestModels("gtp-4o")
+	if !slices.Contains(got, "gpt-4o") {
+		t.Errorf("SuggestModels(\"gtp-4o\") = %v, want it to contain gpt-4o", got)
+	}
+
+	got = SuggestModels("gemini-2.5")
+	if len(got) < 2 {
+		t.Errorf("SuggestModels(\"gemini-2.5\") = %v, want the gemini-2.5 models", got)
+	}
+
+	if got := SuggestModels("completely-different"); len(got) != 0 {
+		t.Errorf("SuggestModels(\"completely-different\") = %v, want none", got)
+	}
+}
+
+func TestSuggestNames(t *testing.T) {
+	candidates := []string{"model", "models-file", "moderation", "temperature", "timeouts"}
+	tests := []struct {
+		name string
+		want []string
+	}{
+		{"modle", []string{"model"}},
+		{"mod", []string{"model", "models-file", "moderation"}},
+		{"temprature", []string{"temperature"}},
+		{"timeout", []string{"timeouts"}},
+		{"colour", nil},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		if got := SuggestNames(tt.name, candidates); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SuggestNames(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"abc", "", 3},
+		{"gpt-4o", "gpt-4o", 0},
+		{"gtp-4o", "gpt-4o", 2},
+		{"kitten", "sitting", 3},
+	}
+	for _, tt := range tests {
+		if got := levenshtein(tt.a, tt.b); got != tt.want {
+			t.Errorf("levenshtein(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+// Package sqirvy provides memoization of completion requests within a process.
+//
+// When memoization is on, a request identical to an earlier successful one, with
+// the same model, conversation, temperature, response limit and tools, is
+// answered with the earlier response instead of being sent again, so batch runs
+// and retry loops do not pay twice for the same answer. Identical requests made
+// at the same time are sent once. Failed requests are not memoized.
+package sqirvy
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"log/slog"
+	"sync"
+)
+
+// memoEntry is the response of a memoized request, available once done is closed.
+type memoEntry struct {
+	done chan struct{}
+	resp chatResponse
+	err  error
+}
+
+// noMemoKey marks a context whose requests are not memoized.
+type noMemoKey struct{}
+
+var (
+	memoMu  sync.Mutex
+	memoOn  bool
+	memoMap map[[sha256.Size]byte]*memoEntry
+)
+
+// SetMemoize turns memoization of the requests of the process on or off. Turning
+// it off forgets the memoized responses.
+func SetMemoize(on bool) {
+	memoMu.Lock()
+	defer memoMu.Unlock()
+	memoOn = on
+	memoMap = nil
+}
+
+// WithoutMemo returns a context whose requests are always sent, for requests
+// that are repeated on purpose, e.g. to sample several completions.
+func WithoutMemo(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noMemoKey{}, true)
+}
+
+// memoized returns the memoized response of req, or sends it with send and
+// memoizes the response if it succeeds. A memoized response has no usage, as it
+// cost nothing.
+func memoized(ctx context.Context, req chatRequest, send func() (chatResponse, error)) (chatResponse, error) {
+	memoMu.Lock()
+	on := memoOn
+	memoMu.Unlock()
+	if !on || ctx.Value(noMemoKey{}) != nil {
+		return send()
+	}
+	data, err := json.Marshal(req)
+	if err != nil {
+		return send()
+	}
+	key := sha256.Sum256(data)
+
+	for {
+		memoMu.Lock()
+		e, ok := memoMap[key]
+		if !ok {
+			if memoMap == nil {
+				memoMap = make(map[[sha256.Size]byte]*memoEntry)
+			}
+			e = &memoEntry{done: make(chan struct{})}
+			memoMap[key] = e
+			memoMu.Unlock()
+
+			e.resp, e.err = send()
+			if e.err != nil {
+				memoMu.Lock()
+				if memoMap[key] == e {
+					delete(memoMap, key)
+				}
+				memoMu.Unlock()
+			}
+			close(e.done)
+			return e.resp, e.err
+		}
+		memoMu.Unlock()
+
+		select {
+		case <-e.done:
+		case <-ctx.Done():
+			return chatResponse{}, ctx.Err()
+		}
+		if e.err == nil {
+			slog.Debug("Memoized response", "model", req.Model)
+			resp := e.resp
+			resp.Usage = Usage{}
+			return resp, nil
+		}
+		// the first request failed and was not memoized, send it again
+	}
+}
@@ -0,0 +1,83 @@
+package sqirvy
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+func TestMemoize(t *testing.T) {
+	var mu sync.Mutex
+	sent := 0
+	SetQueryRecorder(func(QueryRecord) {
+		mu.Lock()
+		sent++
+		mu.Unlock()
+	})
+	defer SetQueryRecorder(nil)
+	SetMemoize(true)
+	defer SetMemoize(false)
+
+	client, err := NewClient(Mock)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	ctx := context.Background()
+	tests := []struct {
+		name      string
+		ctx       context.Context
+		prompt    string
+		options   Options
+		wantSent  int
+		wantUsage bool
+	}{
+		{"first", ctx, "hello", Options{}, 1, true},
+		{"identical", ctx, "hello", Options{}, 1, false},
+		{"other prompt", ctx, "goodbye", Options{}, 2, true},
+		{"other options", ctx, "hello", Options{MaxTokens: 10}, 3, true},
+		{"without memo", WithoutMemo(ctx), "hello", Options{}, 4, true},
+	}
+	var first string
+	for _, tt := range tests {
+		response, usage, err := client.QueryTextUsage(tt.ctx, "be brief", []string{tt.prompt}, "mock", tt.options)
+		if err != nil {
+			t.Fatalf("%s: QueryTextUsage() error = %v", tt.name, err)
+		}
+		if tt.name == "first" {
+			first = response
+		}
+		if tt.name == "identical" && response != first {
+			t.Errorf("%s: response = %q, want %q", tt.name, response, first)
+		}
+		if sent != tt.wantSent {
+			t.Errorf("%s: sent %d requests, want %d", tt.name, sent, tt.wantSent)
+		}
+		if got := usage.OutputTokens > 0; got != tt.wantUsage {
+			t.Errorf("%s: usage = %+v, want usage %v", tt.name, usage, tt.wantUsage)
+		}
+	}
+
+	// identical requests made at the same time are sent once
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := client.QueryText(ctx, "", []string{"concurrent"}, "mock", Options{}); err != nil {
+				t.Errorf("QueryText() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if sent != 5 {
+		t.Errorf("sent %d requests for 8 concurrent identical requests, want 1", sent-4)
+	}
+
+	SetMemoize(false)
+	if _, err := client.QueryText(ctx, "be brief", []string{"hello"}, "mock", Options{}); err != nil {
+		t.Fatalf("QueryText() error = %v", err)
+	}
+	if sent != 6 {
+		t.Errorf("sent %d requests after SetMemoize(false), want 6", sent)
+	}
+}
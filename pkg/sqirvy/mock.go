@@ -0,0 +1,223 @@
+// Package sqirvy provides a built-in mock provider that answers queries without
+// network access or an API key.
+//
+// The mock provider is selected with the "mock" model, e.g. -m mock, for demos,
+// for testing scripts that call sqirvy-cli, and for unit tests of code that uses
+// a Client. By default it echoes the prompts. SetMockResponse replaces the echo
+// with a text/template rendered from the request, so responses are deterministic.
+package sqirvy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// MockRequest is the data the mock response template is rendered with.
+type MockRequest struct {
+	System      string   // system prompt
+	Prompts     []string // user prompts, in order; assistant messages are not included
+	Prompt      string   // last user prompt
+	Model       string
+	Temperature float64
+	Tools       []string // names of the tools offered with the query, if any
+	ToolResults []string // results of the tool calls of the conversation, in order
+	Choice      int      // number of the completion, from 1, when several are requested
+	Seed        int64    // sampling seed of the query, 0 if none
+}
+
+// mockTemplate renders mock responses, or nil to echo the prompts.
+var mockTemplate *template.Template
+
+// SetMockResponse sets the template the mock provider renders its responses from,
+// with a MockRequest as data, e.g. "You asked: {{.Prompt}}". An empty template
+// restores the default, which echoes the prompts separated by blank lines.
+// When the query offers tools and the response is a JSON object, the mock calls
+// the first tool with the object as arguments.
+func SetMockResponse(text string) error {
+	if text == "" {
+		mockTemplate = nil
+		return nil
+	}
+	t, err := template.New("mock").Parse(text)
+	if err != nil {
+		return fmt.Errorf("invalid mock response template: %w", err)
+	}
+	mockTemplate = t
+	return nil
+}
+
+// MockClient implements the Client interface for the mock provider.
+type MockClient struct {
+	api backend
+}
+
+// Ensure MockClient implements the Client and ToolMessagesClient interfaces
+var _ Client = (*MockClient)(nil)
+var _ ToolMessagesClient = (*MockClient)(nil)
+
+// NewMockClient creates a client for the mock provider. It never fails.
+func NewMockClient() (*MockClient, error) {
+	return &MockClient{api: mockBackend{}}, nil
+}
+
+// QueryText returns the mock response to the prompts.
+func (c *MockClient) QueryText(ctx context.Context, system string, prompts []string, model string, options Options) (string, error) {
+	response, _, err := c.QueryTextUsage(ctx, system, prompts, model, options)
+	return response, err
+}
+
+// QueryTextUsage returns the mock response to the prompts and a token usage
+// estimated from the length of the prompts and the response.
+func (c *MockClient) QueryTextUsage(ctx context.Context, system string, prompts []string, model string, options Options) (string, Usage, error) {
+	provider, err := GetProviderName(model)
+	if err != nil || provider != Mock {
+		return "", Usage{}, fmt.Errorf("invalid or unsupported mock model: %s", model)
+	}
+	options.MaxTokens = limitMaxTokens(model, options.MaxTokens)
+
+	return queryTextUsage(ctx, c.api, system, prompts, model, options)
+}
+
+// QueryMessages returns the mock response to the user messages of a conversation
+// and an estimated token usage.
+func (c *MockClient) QueryMessages(ctx context.Context, messages []Message, model string, options Options) (string, Usage, error) {
+	provider, err := GetProviderName(model)
+	if err != nil || provider != Mock {
+		return "", Usage{}, fmt.Errorf("invalid or unsupported mock model: %s", model)
+	}
+	options.MaxTokens = limitMaxTokens(model, options.MaxTokens)
+
+	return queryMessages(ctx, c.api, messages, model, options)
+}
+
+// QueryWithTools returns the mock response to the prompts, as a call to the first
+// tool if the response is a JSON object.
+func (c *MockClient) QueryWithTools(ctx context.Context, system string, prompts []string, model string, options Options, tools []Tool) (ToolResponse, error) {
+	provider, err := GetProviderName(model)
+	if err != nil || provider != Mock {
+		return ToolResponse{}, fmt.Errorf("invalid or unsupported mock model: %s", model)
+	}
+	options.MaxTokens = limitMaxTokens(model, options.MaxTokens)
+
+	return queryWithTools(ctx, c.api, system, prompts, model, options, tools)
+}
+
+// QueryMessagesWithTools returns the mock response to a conversation with tool
+// results, as a call to the first tool if the response is a JSON object.
+func (c *MockClient) QueryMessagesWithTools(ctx context.Context, messages []Message, model string, options Options, tools []Tool) (ToolResponse, error) {
+	provider, err := GetProviderName(model)
+	if err != nil || provider != Mock {
+		return ToolResponse{}, fmt.Errorf("invalid or unsupported mock model: %s", model)
+	}
+
+	options.MaxTokens = limitMaxTokens(model, options.MaxTokens)
+
+	return queryMessagesWithTools(ctx, c.api, messages, model, options, tools)
+}
+
+// QueryCompletions returns n mock responses to the prompts, rendered with Choice
+// set from 1 to n, and an estimated token usage.
+func (c *MockClient) QueryCompletions(ctx context.Context, system string, prompts []string, model string, options Options, n int) ([]string, Usage, error) {
+	provider, err := GetProviderName(model)
+	if err != nil || provider != Mock {
+		return nil, Usage{}, fmt.Errorf("invalid or unsupported mock model: %s", model)
+	}
+	options.MaxTokens = limitMaxTokens(model, options.MaxTokens)
+
+	return queryCompletions(ctx, c.api, system, prompts, model, options, n)
+}
+
+// ValidateCredentials always succeeds, the mock provider has no API key.
+func (c *MockClient) ValidateCredentials(ctx context.Context) error {
+	return nil
+}
+
+// Close implements the Close method for the Client interface.
+func (c *MockClient) Close() error {
+	return nil
+}
+
+// mockBackend answers for the mock provider, so that mock queries go through the
+// same rate limits, budget and circuit breaker as real ones.
+type mockBackend struct{}
+
+// complete renders the mock response to the request.
+func (mockBackend) complete(ctx context.Context, r chatRequest) (chatResponse, error) {
+	req := MockRequest{Model: r.Model, Temperature: float64(r.Temperature)}
+	if r.Seed != nil {
+		req.Seed = *r.Seed
+	}
+	for _, m := range r.Messages {
+		switch m.Role {
+		case RoleSystem:
+			req.System = m.Content
+		case RoleUser:
+			req.Prompts = append(req.Prompts, m.Content)
+		case RoleTool:
+			req.ToolResults = append(req.ToolResults, m.Content)
+		}
+	}
+	if len(req.Prompts) > 0 {
+		req.Prompt = req.Prompts[len(req.Prompts)-1]
+	}
+	for _, tool := range r.Tools {
+		req.Tools = append(req.Tools, tool.Name)
+	}
+
+	if r.N > 1 {
+		return mockChoices(req, r.N, r.Stop)
+	}
+
+	text, err := renderMockResponse(req)
+	if err != nil {
+		return chatResponse{}, err
+	}
+	text, _ = cutAtStop(text, r.Stop)
+
+	resp := chatResponse{
+		StopReason: "stop",
+		Usage: Usage{
+			InputTokens:  EstimateTokens(req.System, req.Prompts),
+			OutputTokens: EstimateTokens("", []string{text}),
+		},
+	}
+	if len(req.Tools) > 0 && json.Valid([]byte(text)) && strings.HasPrefix(strings.TrimSpace(text), "{") {
+		resp.ToolCalls = []ToolCall{{ID: "mock-call-0", Name: req.Tools[0], Arguments: text}}
+	} else {
+		resp.Text = text
+	}
+	return resp, nil
+}
+
+// mockChoices renders n mock responses to a request for several completions.
+func mockChoices(req MockRequest, n int, stop []string) (chatResponse, error) {
+	resp := chatResponse{StopReason: "stop", Usage: Usage{InputTokens: EstimateTokens(req.System, req.Prompts)}}
+	for i := 1; i <= n; i++ {
+		req.Choice = i
+		text, err := renderMockResponse(req)
+		if err != nil {
+			return chatResponse{}, err
+		}
+		text, _ = cutAtStop(text, stop)
+		resp.Choices = append(resp.Choices, text)
+		resp.Usage.OutputTokens += EstimateTokens("", []string{text})
+	}
+	resp.Text = resp.Choices[0]
+	return resp, nil
+}
+
+// renderMockResponse renders the mock response template, or echoes the prompts.
+func renderMockResponse(req MockRequest) (string, error) {
+	if mockTemplate == nil {
+		return strings.Join(req.Prompts, "\n\n"), nil
+	}
+	var buf bytes.Buffer
+	if err := mockTemplate.Execute(&buf, req); err != nil {
+		return "", fmt.Errorf("rendering mock response: %w", err)
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,167 @@
+package sqirvy
+
+import (
+	"context"
+	"testing"
+)
+
+func TestMockClient_QueryText(t *testing.T) {
+	defer SetMockResponse("")
+
+	tests := []struct {
+		name     string
+		template string
+		prompts  []string
+		want     string
+		wantErr  bool
+	}{
+		{
+			name:    "echo",
+			prompts: []string{"first", "second"},
+			want:    "first\n\nsecond",
+		},
+		{
+			name:     "template",
+			template: "{{.Model}} answers {{.Prompt}} to {{.System}}",
+			prompts:  []string{"first", "second"},
+			want:     "mock answers second to be brief",
+		},
+		{
+			name:    "empty prompts",
+			prompts: []string{},
+			wantErr: true,
+		},
+	}
+
+	client, err := NewClient(Mock)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := SetMockResponse(tt.template); err != nil {
+				t.Fatalf("SetMockResponse() error = %v", err)
+			}
+			got, usage, err := client.QueryTextUsage(context.Background(), "be brief", tt.prompts, "mock", Options{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("QueryTextUsage() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got != tt.want {
+				t.Errorf("QueryTextUsage() = %q, want %q", got, tt.want)
+			}
+			if usage.InputTokens == 0 || usage.OutputTokens == 0 {
+				t.Errorf("QueryTextUsage() usage = %+v, want nonzero counts", usage)
+			}
+		})
+	}
+}
+
+func TestMockClient_QueryWithTools(t *testing.T) {
+	defer SetMockResponse("")
+	tools := []Tool{{Name: "extract", Description: "extract fields", Parameters: map[string]any{"type": "object"}}}
+
+	client, _ := NewMockClient()
+	if err := SetMockResponse(`{"name": "{{.Prompt}}"}`); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.QueryWithTools(context.Background(), "", []string{"ada"}, "mock", Options{}, tools)
+	if err != nil {
+		t.Fatalf("QueryWithTools() error = %v", err)
+	}
+	if len(resp.ToolCalls) != 1 || resp.ToolCalls[0].Name != "extract" || resp.ToolCalls[0].Arguments != `{"name": "ada"}` {
+		t.Errorf("QueryWithTools() tool calls = %+v, want one call to extract", resp.ToolCalls)
+	}
+
+	// responses that are not JSON objects are returned as text
+	if err := SetMockResponse("plain text"); err != nil {
+		t.Fatal(err)
+	}
+	resp, err = client.QueryWithTools(context.Background(), "", []string{"ada"}, "mock", Options{}, tools)
+	if err != nil {
+		t.Fatalf("QueryWithTools() error = %v", err)
+	}
+	if resp.Text != "plain text" || len(resp.ToolCalls) != 0 {
+		t.Errorf("QueryWithTools() = %+v, want text only", resp)
+	}
+}
+
+func TestSetMockResponseInvalid(t *testing.T) {
+	if err := SetMockResponse("{{.Prompt"); err == nil {
+		t.Error("SetMockResponse() error = nil for an invalid template")
+	}
+}
+
+func TestMockClient_QueryMessages(t *testing.T) {
+	defer SetMockResponse("")
+	if err := SetMockResponse("{{.System}}|{{range .Prompts}}{{.}};{{end}}"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		messages []Message
+		want     string
+		wantErr  bool
+	}{
+		{
+			name: "multi-turn",
+			messages: []Message{
+				{Role: RoleSystem, Content: "be brief"},
+				{Role: RoleUser, Content: "hello"},
+				{Role: RoleAssistant, Content: "hi"},
+				{Role: RoleUser, Content: "bye"},
+			},
+			want: "be brief|hello;bye;",
+		},
+		{
+			name: "assistant prefill",
+			messages: []Message{
+				{Role: RoleUser, Content: "list"},
+				{Role: RoleAssistant, Content: "["},
+			},
+			want: "|list;",
+		},
+		{
+			name:     "no user message",
+			messages: []Message{{Role: RoleSystem, Content: "be brief"}},
+			wantErr:  true,
+		},
+		{
+			name:     "unknown role",
+			messages: []Message{{Role: "tool", Content: "x"}, {Role: RoleUser, Content: "hello"}},
+			wantErr:  true,
+		},
+		{
+			name:    "empty",
+			wantErr: true,
+		},
+	}
+
+	client, _ := NewMockClient()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, err := client.QueryMessages(context.Background(), tt.messages, "mock", Options{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("QueryMessages() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("QueryMessages() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMockClient_InvalidTemperature(t *testing.T) {
+	client, err := NewMockClient()
+	if err != nil {
+		t.Fatalf("NewMockClient() error = %v", err)
+	}
+	for _, temperature := range []float32{-0.1, 1.5} {
+		if _, err := client.QueryText(context.Background(), "", []string{"hi"}, "mock", Options{Temperature: temperature}); err == nil {
+			t.Errorf("QueryText() with temperature %v error = nil, want an error", temperature)
+		}
+	}
+}
@@ -4,7 +4,10 @@
 // working with different AI models across supported providers.
 package sqirvy
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
 
 var modelAlias = map[string]string{
 	"claude-3-7-sonnet": "claude-3-7-sonnet-latest",
@@ -19,8 +22,18 @@ const (
 	Gemini    string = "gemini"    // Google's Gemini models
 	OpenAI    string = "openai"    // OpenAI's GPT models
 	Llama     string = "llama"     // Meta's Llama models
+	Mock      string = "mock"      // built-in offline provider for demos and tests
+	Local     string = "local"     // GGUF model files run in process with llama.cpp
 )
 
+// providers lists the supported providers in display order
+var providers = []string{Anthropic, Gemini, OpenAI, Llama, Mock, Local}
+
+// GetProviderList returns the names of all supported providers
+func GetProviderList() []string {
+	return append([]string(nil), providers...)
+}
+
 // modelRegistry consolidates provider and token information for each model
 // This helps ensure consistency between provider and token information.
 // These mappings are essential for the QueryText functions to route requests
@@ -28,33 +41,48 @@ const (
 
 // ModelInfo holds information about a specific model
 type ModelInfo struct {
-	Provider  string
-	MaxTokens int64
+	Provider      string
+	MaxTokens     int64   // Maximum number of output tokens
+	ContextWindow int64   // Maximum number of input plus output tokens, 0 if unknown
+	Vision        bool    // Accepts image input
+	Tools         bool    // Supports tool (function) calling
+	JSON          bool    // Supports a JSON response format (JSON mode)
+	Reasoning     bool    // Reasons before answering, e.g. with extended thinking
+	InputCost     float64 // USD per million input tokens, 0 if unknown
+	OutputCost    float64 // USD per million output tokens, 0 if unknown
+	Retires       string  // Date the provider retires the model, YYYY-MM-DD, "" if not announced
+	Successor     string  // Model that replaces a deprecated model
 }
 
 // modelRegistry is the single source of truth for model information
 var modelRegistry = map[string]ModelInfo{
 	// anthropic models
-	"claude-3-7-sonnet-20250219": {Provider: Anthropic, MaxTokens: 64000},
-	"claude-3-5-sonnet-20241022": {Provider: Anthropic, MaxTokens: 8192},
-	"claude-3-7-sonnet-latest":   {Provider: Anthropic, MaxTokens: 64000},
-	"claude-3-5-sonnet-latest":   {Provider: Anthropic, MaxTokens: 8192},
-	"claude-3-5-haiku-latest":    {Provider: Anthropic, MaxTokens: MAX_TOKENS_DEFAULT},
-	"claude-3-haiku-20240307":    {Provider: Anthropic, MaxTokens: MAX_TOKENS_DEFAULT},
+	"claude-3-7-sonnet-20250219": {Provider: Anthropic, MaxTokens: 64000, ContextWindow: 200000, Vision: true, Tools: true, Reasoning: true, InputCost: 3, OutputCost: 15, Retires: "2026-02-19", Successor: "claude-sonnet-4-20250514"},
+	"claude-3-5-sonnet-20241022": {Provider: Anthropic, MaxTokens: 8192, ContextWindow: 200000, Vision: true, Tools: true, InputCost: 3, OutputCost: 15, Retires: "2025-10-22", Successor: "claude-sonnet-4-20250514"},
+	"claude-3-7-sonnet-latest":   {Provider: Anthropic, MaxTokens: 64000, ContextWindow: 200000, Vision: true, Tools: true, Reasoning: true, InputCost: 3, OutputCost: 15, Retires: "2026-02-19", Successor: "claude-sonnet-4-20250514"},
+	"claude-3-5-sonnet-latest":   {Provider: Anthropic, MaxTokens: 8192, ContextWindow: 200000, Vision: true, Tools: true, InputCost: 3, OutputCost: 15, Retires: "2025-10-22", Successor: "claude-sonnet-4-20250514"},
+	"claude-3-5-haiku-latest":    {Provider: Anthropic, MaxTokens: MAX_TOKENS_DEFAULT, ContextWindow: 200000, Vision: true, Tools: true, InputCost: 0.8, OutputCost: 4, Retires: "2026-02-19", Successor: "claude-haiku-4-5-20251001"},
+	"claude-sonnet-4-20250514":   {Provider: Anthropic, MaxTokens: 64000, ContextWindow: 200000, Vision: true, Tools: true, Reasoning: true, InputCost: 3, OutputCost: 15},
+	"claude-haiku-4-5-20251001":  {Provider: Anthropic, MaxTokens: 64000, ContextWindow: 200000, Vision: true, Tools: true, Reasoning: true, InputCost: 1, OutputCost: 5},
+	"claude-3-haiku-20240307":    {Provider: Anthropic, MaxTokens: MAX_TOKENS_DEFAULT, ContextWindow: 200000, Vision: true, Tools: true, InputCost: 0.25, OutputCost: 1.25},
 	// google gemini models
-	"gemini-1.5-flash":               {Provider: Gemini, MaxTokens: MAX_TOKENS_DEFAULT},
-	"gemini-1.5-pro":                 {Provider: Gemini, MaxTokens: MAX_TOKENS_DEFAULT},
-	"gemini-2.0-flash":               {Provider: Gemini, MaxTokens: MAX_TOKENS_DEFAULT},
-	"gemini-2.0-flash-thinking-exp":  {Provider: Gemini, MaxTokens: MAX_TOKENS_DEFAULT},
-	"gemini-2.5-flash-preview-04-17": {Provider: Gemini, MaxTokens: 65536},
-	"gemini-2.5-pro-preview-03-25":   {Provider: Gemini, MaxTokens: 65536},
+	"gemini-1.5-flash":               {Provider: Gemini, MaxTokens: MAX_TOKENS_DEFAULT, ContextWindow: 1048576, Vision: true, Tools: true, JSON: true, InputCost: 0.075, OutputCost: 0.3, Retires: "2025-09-24", Successor: "gemini-2.5-flash"},
+	"gemini-1.5-pro":                 {Provider: Gemini, MaxTokens: MAX_TOKENS_DEFAULT, ContextWindow: 2097152, Vision: true, Tools: true, JSON: true, InputCost: 1.25, OutputCost: 5, Retires: "2025-09-24", Successor: "gemini-2.5-pro"},
+	"gemini-2.0-flash":               {Provider: Gemini, MaxTokens: MAX_TOKENS_DEFAULT, ContextWindow: 1048576, Vision: true, Tools: true, JSON: true, InputCost: 0.1, OutputCost: 0.4},
+	"gemini-2.0-flash-thinking-exp":  {Provider: Gemini, MaxTokens: MAX_TOKENS_DEFAULT, ContextWindow: 1048576, Vision: true, Reasoning: true, Successor: "gemini-2.5-flash"},
+	"gemini-2.5-flash":               {Provider: Gemini, MaxTokens: 65536, ContextWindow: 1048576, Vision: true, Tools: true, JSON: true, Reasoning: true, InputCost: 0.3, OutputCost: 2.5},
+	"gemini-2.5-pro":                 {Provider: Gemini, MaxTokens: 65536, ContextWindow: 1048576, Vision: true, Tools: true, JSON: true, Reasoning: true, InputCost: 1.25, OutputCost: 10},
+	"gemini-2.5-flash-preview-04-17": {Provider: Gemini, MaxTokens: 65536, ContextWindow: 1048576, Vision: true, Tools: true, JSON: true, Reasoning: true, InputCost: 0.15, OutputCost: 0.6, Retires: "2025-07-15", Successor: "gemini-2.5-flash"},
+	"gemini-2.5-pro-preview-03-25":   {Provider: Gemini, MaxTokens: 65536, ContextWindow: 1048576, Vision: true, Tools: true, JSON: true, Reasoning: true, InputCost: 1.25, OutputCost: 10, Retires: "2025-07-15", Successor: "gemini-2.5-pro"},
 	// openai models
-	"gpt-4o":      {Provider: OpenAI, MaxTokens: MAX_TOKENS_DEFAULT},
-	"gpt-4o-mini": {Provider: OpenAI, MaxTokens: MAX_TOKENS_DEFAULT},
-	"gpt-4-turbo": {Provider: OpenAI, MaxTokens: MAX_TOKENS_DEFAULT},
-	"o4-mini":     {Provider: OpenAI, MaxTokens: MAX_TOKENS_DEFAULT},
+	"gpt-4o":      {Provider: OpenAI, MaxTokens: MAX_TOKENS_DEFAULT, ContextWindow: 128000, Vision: true, Tools: true, JSON: true, InputCost: 2.5, OutputCost: 10},
+	"gpt-4o-mini": {Provider: OpenAI, MaxTokens: MAX_TOKENS_DEFAULT, ContextWindow: 128000, Vision: true, Tools: true, JSON: true, InputCost: 0.15, OutputCost: 0.6},
+	"gpt-4-turbo": {Provider: OpenAI, MaxTokens: MAX_TOKENS_DEFAULT, ContextWindow: 128000, Vision: true, Tools: true, JSON: true, InputCost: 10, OutputCost: 30, Successor: "gpt-4o"},
+	"o4-mini":     {Provider: OpenAI, MaxTokens: MAX_TOKENS_DEFAULT, ContextWindow: 200000, Vision: true, Tools: true, JSON: true, Reasoning: true, InputCost: 1.1, OutputCost: 4.4},
 	// llama models
-	"llama3.3-70b": {Provider: Llama, MaxTokens: MAX_TOKENS_DEFAULT},
+	"llama3.3-70b": {Provider: Llama, MaxTokens: MAX_TOKENS_DEFAULT, ContextWindow: 128000, Tools: true},
+	// mock model, answers without network access
+	"mock": {Provider: Mock, MaxTokens: MAX_TOKENS_DEFAULT, ContextWindow: 1000000, Tools: true, JSON: true},
 }
 
 // ModelToMaxTokens maps model names to their maximum token limits.
@@ -80,6 +108,50 @@ func GetModelAlias(model string) string {
 	return model
 }
 
+// RegisterModel adds a model to the registry, replacing any existing entry for it.
+// A MaxTokens of 0 is replaced with MAX_TOKENS_DEFAULT.
+// The registry is not safe for concurrent modification, so models should be
+// registered at startup before any queries are made.
+func RegisterModel(model string, info ModelInfo) error {
+	if model == "" {
+		return fmt.Errorf("model name cannot be empty")
+	}
+	if !isProvider(info.Provider) {
+		return fmt.Errorf("unsupported provider %q for model %s", info.Provider, model)
+	}
+	if info.Retires != "" {
+		if _, err := time.Parse(time.DateOnly, info.Retires); err != nil {
+			return fmt.Errorf("invalid retirement date %q for model %s, use YYYY-MM-DD", info.Retires, model)
+		}
+	}
+	if info.MaxTokens <= 0 {
+		info.MaxTokens = MAX_TOKENS_DEFAULT
+	}
+	modelRegistry[model] = info
+	modelToMaxTokens[model] = info.MaxTokens
+	return nil
+}
+
+// RegisterAlias adds an alias for a model, replacing any existing alias with that name.
+// Like RegisterModel, it should be called at startup.
+func RegisterAlias(alias, model string) error {
+	if alias == "" || model == "" {
+		return fmt.Errorf("alias and model cannot be empty")
+	}
+	modelAlias[alias] = model
+	return nil
+}
+
+// isProvider reports whether name is a supported provider
+func isProvider(name string) bool {
+	for _, p := range providers {
+		if p == name {
+			return true
+		}
+	}
+	return false
+}
+
 // GetModelList returns a list of all supported model names
 func GetModelList() []string {
 	var models []string
@@ -111,6 +183,15 @@ func GetProviderName(model string) (string, error) {
 	return "", fmt.Errorf("unrecognized model: %s", model)
 }
 
+// GetModelInfo returns the registry information for a model identifier.
+// Returns an error if the model is not recognized.
+func GetModelInfo(model string) (ModelInfo, error) {
+	if info, ok := modelRegistry[model]; ok {
+		return info, nil
+	}
+	return ModelInfo{}, fmt.Errorf("unrecognized model: %s", model)
+}
+
 // GetMaxTokensWithError returns the maximum token limit for a given model identifier
 // along with an error if the model is not recognized.
 // This function provides more detailed error reporting compared to GetMaxTokens.
@@ -128,3 +209,13 @@ func GetMaxTokens(model string) int64 {
 	tokens, _ := GetMaxTokensWithError(model)
 	return tokens
 }
+
+// EstimateCost returns the cost in USD of a query with the given token usage.
+// It returns 0 for models whose pricing is unknown.
+func EstimateCost(model string, usage Usage) float64 {
+	info, ok := modelRegistry[model]
+	if !ok {
+		return 0
+	}
+	return (float64(usage.InputTokens)*info.InputCost + float64(usage.OutputTokens)*info.OutputCost) / 1e6
+}
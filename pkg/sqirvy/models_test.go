@@ -4,8 +4,12 @@ import (
 	"context"
 	"os"
 	"testing"
+	"time"
 )
 
+// assistant is the system prompt of the test queries
+const assistant = "you are a helpful assistant"
+
 func TestAllModels(t *testing.T) {
 	// Test cases for both QueryText and QueryJSON
 	tests := []struct {
@@ -33,6 +37,12 @@ func TestAllModels(t *testing.T) {
 	// Test each model from modelRegistry
 	for model, info := range modelRegistry {
 		provider := info.Provider
+		// retired models are refused by the provider
+		if d, ok := CheckDeprecation(model, time.Now()); ok && d.Retired {
+			t.Logf("Skipping retired %s model %s", provider, model)
+			continue
+		}
+
 		// Create client for this provider
 		client, err := NewClient(provider)
 		if err != nil {
@@ -51,6 +61,8 @@ func TestAllModels(t *testing.T) {
 			apiKey = os.Getenv("OPENAI_API_KEY")
 		case "llama":
 			apiKey = os.Getenv("LLAMA_API_KEY")
+		case "mock":
+			apiKey = "not needed"
 		}
 
 		if apiKey == "" {
@@ -83,3 +95,83 @@ func TestAllModels(t *testing.T) {
 		})
 	}
 }
+
+func TestEstimateCost(t *testing.T) {
+	tests := []struct {
+		name  string
+		model string
+		usage Usage
+		want  float64
+	}{
+		{
+			name:  "Known model",
+			model: "gpt-4o",
+			usage: Usage{InputTokens: 1000000, OutputTokens: 500000},
+			want:  7.5,
+		},
+		{
+			name:  "Unknown pricing",
+			model: "llama3.3-70b",
+			usage: Usage{InputTokens: 1000, OutputTokens: 1000},
+			want:  0,
+		},
+		{
+			name:  "Unknown model",
+			model: "no-such-model",
+			usage: Usage{InputTokens: 1000, OutputTokens: 1000},
+			want:  0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := EstimateCost(tt.model, tt.usage); got != tt.want {
+				t.Errorf("EstimateCost() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetModelInfo(t *testing.T) {
+	info, err := GetModelInfo("gpt-4o")
+	if err != nil {
+		t.Fatalf("GetModelInfo() error = %v", err)
+	}
+	if info.Provider != OpenAI || info.ContextWindow == 0 || !info.Tools {
+		t.Errorf("GetModelInfo() = %+v, want an OpenAI model with a context window and tool support", info)
+	}
+
+	if _, err := GetModelInfo("no-such-model"); err == nil {
+		t.Error("GetModelInfo() error = nil for an unknown model")
+	}
+}
+
+func TestRegisterModel(t *testing.T) {
+	const model = "test-registered-model"
+	defer delete(modelRegistry, model)
+	defer delete(modelToMaxTokens, model)
+
+	if err := RegisterModel(model, ModelInfo{Provider: "no-such-provider"}); err == nil {
+		t.Error("RegisterModel() error = nil for an unsupported provider")
+	}
+
+	if err := RegisterModel(model, ModelInfo{Provider: OpenAI}); err != nil {
+		t.Fatalf("RegisterModel() error = %v", err)
+	}
+	provider, err := GetProviderName(model)
+	if err != nil || provider != OpenAI {
+		t.Errorf("GetProviderName() = %v, %v, want %v", provider, err, OpenAI)
+	}
+	if got := GetMaxTokens(model); got != MAX_TOKENS_DEFAULT {
+		t.Errorf("GetMaxTokens() = %v, want %v", got, MAX_TOKENS_DEFAULT)
+	}
+
+	const alias = "test-alias"
+	defer delete(modelAlias, alias)
+	if err := RegisterAlias(alias, model); err != nil {
+		t.Fatalf("RegisterAlias() error = %v", err)
+	}
+	if got := GetModelAlias(alias); got != model {
+		t.Errorf("GetModelAlias() = %v, want %v", got, model)
+	}
+}
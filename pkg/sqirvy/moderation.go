@@ -0,0 +1,65 @@
+// Package sqirvy provides content moderation with the OpenAI moderation API.
+//
+// Moderate classifies a text, e.g. a prompt before it is sent or a response
+// before it is shown, and reports the categories of harmful content it contains.
+package sqirvy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// moderationModel is the OpenAI model used by Moderate.
+const moderationModel = "omni-moderation-latest"
+
+// ModerationResult is the classification of a text by Moderate.
+type ModerationResult struct {
+	Flagged    bool               // the text contains harmful content
+	Categories []string           // flagged categories, e.g. "harassment", sorted
+	Scores     map[string]float64 // score of each category from 0 to 1
+}
+
+// Moderate classifies text with the OpenAI moderation API, using the same API key
+// and base URL environment variables as the OpenAI client.
+func Moderate(ctx context.Context, text string) (ModerationResult, error) {
+	baseURL, apiKey, err := providerEndpoint(OpenAI)
+	if err != nil {
+		return ModerationResult{}, err
+	}
+	result, err := moderateOpenAI(ctx, apiHTTPClient(OpenAI), baseURL, apiKey, text)
+	if err != nil {
+		return ModerationResult{}, fmt.Errorf("moderation failed: %w", err)
+	}
+	return result, nil
+}
+
+// moderateOpenAI calls the /moderations endpoint of an OpenAI-compatible API.
+func moderateOpenAI(ctx context.Context, client *http.Client, baseURL, apiKey, text string) (ModerationResult, error) {
+	var resp struct {
+		Results []struct {
+			Flagged        bool               `json:"flagged"`
+			Categories     map[string]bool    `json:"categories"`
+			CategoryScores map[string]float64 `json:"category_scores"`
+		} `json:"results"`
+	}
+	body := map[string]string{"model": moderationModel, "input": text}
+	headers := map[string]string{"Authorization": "Bearer " + apiKey}
+	if err := postJSON(ctx, client, strings.TrimSuffix(baseURL, "/")+"/moderations", headers, body, &resp); err != nil {
+		return ModerationResult{}, err
+	}
+	if len(resp.Results) == 0 {
+		return ModerationResult{}, fmt.Errorf("invalid response: no results")
+	}
+	r := resp.Results[0]
+	result := ModerationResult{Flagged: r.Flagged, Scores: r.CategoryScores}
+	for category, flagged := range r.Categories {
+		if flagged {
+			result.Categories = append(result.Categories, category)
+		}
+	}
+	sort.Strings(result.Categories)
+	return result, nil
+}
@@ -0,0 +1,74 @@
+package sqirvy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestModerateOpenAI(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Model string `json:"model"`
+			Input string `json:"input"`
+		}
+		if r.URL.Path != "/v1/moderations" || r.Header.Get("Authorization") != "Bearer test-key" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Model != moderationModel {
+			http.Error(w, "bad body", http.StatusBadRequest)
+			return
+		}
+		if req.Input == "clean" {
+			w.Write([]byte(`{"results": [{"flagged": false, "categories": {"harassment": false}, "category_scores": {"harassment": 0.01}}]}`))
+			return
+		}
+		w.Write([]byte(`{"results": [{"flagged": true,
+			"categories": {"violence": true, "harassment": true, "hate": false},
+			"category_scores": {"violence": 0.9, "harassment": 0.8, "hate": 0.1}}]}`))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		input   string
+		want    ModerationResult
+		baseURL string
+		wantErr bool
+	}{
+		{
+			name:  "clean",
+			input: "clean",
+			want:  ModerationResult{Scores: map[string]float64{"harassment": 0.01}},
+		},
+		{
+			name:  "flagged",
+			input: "threat",
+			want: ModerationResult{
+				Flagged:    true,
+				Categories: []string{"harassment", "violence"},
+				Scores:     map[string]float64{"violence": 0.9, "harassment": 0.8, "hate": 0.1},
+			},
+		},
+		{name: "http error", input: "clean", baseURL: server.URL + "/other", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			baseURL := tt.baseURL
+			if baseURL == "" {
+				baseURL = server.URL + "/v1/"
+			}
+			got, err := moderateOpenAI(context.Background(), http.DefaultClient, baseURL, "test-key", tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("moderateOpenAI() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("moderateOpenAI() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
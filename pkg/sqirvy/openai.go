@@ -1,38 +1,43 @@
-// Package sqirvy provides integration with OpenAI models via langchaingo.
+//go:build !no_openai
+
+// Package sqirvy provides integration with OpenAI models.
 //
-// This file implements the Client interface for OpenAI models using
-// langchaingo's OpenAI-compatible interface. It handles model initialization,
-// prompt formatting, and response parsing.
+// This file implements the Client interface for OpenAI models using the
+// Chat Completions API, which is shared by OpenAI-compatible providers. It
+// handles model initialization, prompt formatting, and response parsing.
 package sqirvy
 
 import (
 	"context"
 	"fmt"
 	"os"
-
-	"github.com/tmc/langchaingo/llms"
-	"github.com/tmc/langchaingo/llms/openai"
 )
 
-const openai_temperature_scale = 2.0
+// init adds the OpenAI provider to the provider registry.
+func init() {
+	providerRegistry[OpenAI] = providerEntry{fromEnv: envClient(NewOpenAIClient), fromConfig: configClient(newOpenAIClient), maxTemperature: 2}
+}
 
 // OpenAIClient implements the Client interface for OpenAI models.
 // It provides methods for querying OpenAI language models through
 // an OpenAI-compatible interface.
 type OpenAIClient struct {
-	llm              llms.Model // OpenAI-compatible LLM client
-	temperatureScale float32
+	api    backend // Chat Completions API client
+	config Config  // API key and endpoint, for credential checks
 }
 
-// Ensure OpenAIClient implements the Client interface
+// Ensure OpenAIClient implements the Client and ToolMessagesClient interfaces
 var _ Client = (*OpenAIClient)(nil)
+var _ ToolMessagesClient = (*OpenAIClient)(nil)
 
-// NewOpenAIClient creates a new instance of OpenAIClient using langchaingo.
-// It returns an error if the required OPENAI_API_KEY or OPENAI_BASE_URL environment variables are not set.
+// NewOpenAIClient creates a new instance of OpenAIClient.
+// It returns an error if the required OPENAI_API_KEY environment variable is not set.
 //
-// The API key is retrieved from the OPENAI_API_KEY environment variable and
-// the base URL is retrieved from the OPENAI_BASE_URL environment variable.
-// Ensure these variables are set before calling this function.
+// The API key is retrieved from the OPENAI_API_KEY environment variable. The
+// optional OPENAI_BASE_URL variable overrides the endpoint, https://api.openai.com/v1,
+// e.g. for OpenAI-compatible servers or gateways. The optional
+// OPENAI_ORG_ID and OPENAI_PROJECT_ID variables are sent as the OpenAI-Organization
+// and OpenAI-Project headers, for keys scoped to a project with separate billing.
 func NewOpenAIClient() (*OpenAIClient, error) {
 	apiKey := os.Getenv("OPENAI_API_KEY")
 	if apiKey == "" {
@@ -42,22 +47,19 @@ func NewOpenAIClient() (*OpenAIClient, error) {
 		return nil, fmt.Errorf("invalid OPENAI_API_KEY: key appears to be too short")
 	}
 
-	baseURL := os.Getenv("OPENAI_BASE_URL")
-	if baseURL == "" {
-		return nil, fmt.Errorf("OPENAI_BASE_URL environment variable not set")
-	}
-
-	llm, err := openai.New(
-		openai.WithBaseURL(baseURL),
-		openai.WithToken(apiKey),
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create OpenAI client: %w", err)
-	}
+	// an empty base URL uses the default endpoint
+	return newOpenAIClient(Config{APIKey: apiKey, BaseURL: os.Getenv("OPENAI_BASE_URL"), Headers: envHeaders(OpenAI)})
+}
 
+// newOpenAIClient creates an OpenAIClient from an explicit configuration.
+func newOpenAIClient(cfg Config) (*OpenAIClient, error) {
 	return &OpenAIClient{
-		llm:              llm,
-		temperatureScale: openai_temperature_scale, // Default temperature scale for OpenAI
+		api: &openaiBackend{
+			client:  cfg.apiHTTPClient(OpenAI),
+			baseURL: cfg.baseURLOrDefault(OpenAI),
+			apiKey:  cfg.APIKey,
+		},
+		config: cfg,
 	}, nil
 }
 
@@ -71,18 +73,86 @@ func (c *OpenAIClient) QueryText(ctx context.Context, system string, prompts []s
 		return "", fmt.Errorf("invalid or unsupported OpenAI model: %s", model)
 	}
 
-	// scale the temperature
-	options.Temperature = options.Temperature * c.temperatureScale
-	options.MaxTokens = GetMaxTokens(model)
+	options.MaxTokens = limitMaxTokens(model, options.MaxTokens)
+
+	return queryText(ctx, c.api, system, prompts, model, options)
+}
+
+// QueryTextUsage is QueryText for OpenAI models that also returns the token usage
+// reported by the provider.
+func (c *OpenAIClient) QueryTextUsage(ctx context.Context, system string, prompts []string, model string, options Options) (string, Usage, error) {
+	provider, err := GetProviderName(model)
+	if err != nil || provider != OpenAI {
+		return "", Usage{}, fmt.Errorf("invalid or unsupported OpenAI model: %s", model)
+	}
+
+	options.MaxTokens = limitMaxTokens(model, options.MaxTokens)
+
+	return queryTextUsage(ctx, c.api, system, prompts, model, options)
+}
+
+// QueryMessages sends a conversation with explicit roles to the specified OpenAI model
+// and returns the response and the token usage reported by the provider.
+func (c *OpenAIClient) QueryMessages(ctx context.Context, messages []Message, model string, options Options) (string, Usage, error) {
+	provider, err := GetProviderName(model)
+	if err != nil || provider != OpenAI {
+		return "", Usage{}, fmt.Errorf("invalid or unsupported OpenAI model: %s", model)
+	}
+
+	options.MaxTokens = limitMaxTokens(model, options.MaxTokens)
+
+	return queryMessages(ctx, c.api, messages, model, options)
+}
+
+// QueryWithTools sends a query to the specified OpenAI model along with a set of
+// tool definitions. The response contains any text and the tool calls requested by the model.
+func (c *OpenAIClient) QueryWithTools(ctx context.Context, system string, prompts []string, model string, options Options, tools []Tool) (ToolResponse, error) {
+	provider, err := GetProviderName(model)
+	if err != nil || provider != OpenAI {
+		return ToolResponse{}, fmt.Errorf("invalid or unsupported OpenAI model: %s", model)
+	}
+
+	options.MaxTokens = limitMaxTokens(model, options.MaxTokens)
+
+	return queryWithTools(ctx, c.api, system, prompts, model, options, tools)
+}
+
+// QueryMessagesWithTools sends a conversation with the results of tool calls to
+// the specified OpenAI model along with a set of tool definitions. The response
+// contains any text and the tool calls requested by the model.
+func (c *OpenAIClient) QueryMessagesWithTools(ctx context.Context, messages []Message, model string, options Options, tools []Tool) (ToolResponse, error) {
+	provider, err := GetProviderName(model)
+	if err != nil || provider != OpenAI {
+		return ToolResponse{}, fmt.Errorf("invalid or unsupported OpenAI model: %s", model)
+	}
+
+	options.MaxTokens = limitMaxTokens(model, options.MaxTokens)
+
+	return queryMessagesWithTools(ctx, c.api, messages, model, options, tools)
+}
+
+// QueryCompletions sends a query to the specified OpenAI model for n completions
+// in one request, and returns them with the token usage reported by the provider.
+func (c *OpenAIClient) QueryCompletions(ctx context.Context, system string, prompts []string, model string, options Options, n int) ([]string, Usage, error) {
+	provider, err := GetProviderName(model)
+	if err != nil || provider != OpenAI {
+		return nil, Usage{}, fmt.Errorf("invalid or unsupported OpenAI model: %s", model)
+	}
+
+	options.MaxTokens = limitMaxTokens(model, options.MaxTokens)
+
+	return queryCompletions(ctx, c.api, system, prompts, model, options, n)
+}
 
-	return queryTextLangChain(ctx, c.llm, system, prompts, model, options)
+// ValidateCredentials checks the OpenAI API key with a request that does not consume tokens.
+func (c *OpenAIClient) ValidateCredentials(ctx context.Context) error {
+	return c.config.validateCredentials(ctx, OpenAI)
 }
 
 // Close implements the Close method for the Client interface.
 //
 // For the OpenAI client, this method does not require any action as the
-// underlying langchaingo client does not need to be explicitly closed.
+// underlying HTTP client does not need to be explicitly closed.
 func (c *OpenAIClient) Close() error {
-	// the langchain llm does not require explicit close
 	return nil
 }
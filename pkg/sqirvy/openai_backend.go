@@ -0,0 +1,141 @@
+//go:build !no_openai || !no_llama
+
+// Package sqirvy provides the OpenAI-compatible Chat Completions API.
+//
+// This file sends completion requests to the Chat Completions API of OpenAI and
+// of OpenAI-compatible providers such as Llama, so it is built when either of
+// them is.
+package sqirvy
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// openaiBackend sends requests to an OpenAI-compatible Chat Completions API.
+type openaiBackend struct {
+	client  *http.Client
+	baseURL string // includes the API version path, e.g. https://api.openai.com/v1
+	apiKey  string
+
+	// legacyMaxTokens sends the response limit as max_tokens, which compatible
+	// servers accept, instead of max_completion_tokens
+	legacyMaxTokens bool
+}
+
+type openaiMessage struct {
+	Role       string           `json:"role"`
+	Content    string           `json:"content"`
+	ToolCalls  []openaiToolCall `json:"tool_calls,omitempty"`   // assistant
+	ToolCallID string           `json:"tool_call_id,omitempty"` // tool
+}
+
+type openaiToolCall struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+type openaiFunction struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Parameters  map[string]any `json:"parameters"`
+}
+
+type openaiTool struct {
+	Type     string         `json:"type"`
+	Function openaiFunction `json:"function"`
+}
+
+type openaiRequest struct {
+	Model               string          `json:"model"`
+	Messages            []openaiMessage `json:"messages"`
+	Temperature         float32         `json:"temperature"`
+	MaxCompletionTokens int64           `json:"max_completion_tokens,omitempty"`
+	MaxTokens           int64           `json:"max_tokens,omitempty"`
+	Tools               []openaiTool    `json:"tools,omitempty"`
+	N                   int             `json:"n,omitempty"`
+	Stop                []string        `json:"stop,omitempty"`
+	Seed                *int64          `json:"seed,omitempty"`
+}
+
+type openaiResponse struct {
+	Choices []struct {
+		Message struct {
+			Content   string           `json:"content"`
+			ToolCalls []openaiToolCall `json:"tool_calls"`
+		} `json:"message"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage struct {
+		PromptTokens     int64 `json:"prompt_tokens"`
+		CompletionTokens int64 `json:"completion_tokens"`
+	} `json:"usage"`
+	SystemFingerprint string `json:"system_fingerprint"`
+}
+
+func (b *openaiBackend) complete(ctx context.Context, req chatRequest) (chatResponse, error) {
+	body := openaiRequest{Model: req.Model, Temperature: req.Temperature, Stop: req.Stop, Seed: req.Seed}
+	if req.N > 1 {
+		body.N = req.N
+	}
+	if b.legacyMaxTokens {
+		body.MaxTokens = req.MaxTokens
+	} else {
+		body.MaxCompletionTokens = req.MaxTokens
+	}
+	if system := systemPrompt(req.Messages); system != "" {
+		body.Messages = append(body.Messages, openaiMessage{Role: "system", Content: system})
+	}
+	for _, m := range req.Messages {
+		if m.Role == RoleSystem {
+			continue
+		}
+		msg := openaiMessage{Role: string(m.Role), Content: m.Content, ToolCallID: m.ToolCallID}
+		for _, call := range m.ToolCalls {
+			tc := openaiToolCall{ID: call.ID, Type: "function"}
+			tc.Function.Name = call.Name
+			tc.Function.Arguments = string(toolArguments(call))
+			msg.ToolCalls = append(msg.ToolCalls, tc)
+		}
+		body.Messages = append(body.Messages, msg)
+	}
+	for _, tool := range req.Tools {
+		body.Tools = append(body.Tools, openaiTool{
+			Type:     "function",
+			Function: openaiFunction{Name: tool.Name, Description: tool.Description, Parameters: toolParameters(tool)},
+		})
+	}
+
+	var resp openaiResponse
+	endpoint := strings.TrimSuffix(b.baseURL, "/") + "/chat/completions"
+	headers := map[string]string{"Authorization": "Bearer " + b.apiKey}
+	if err := postJSON(ctx, b.client, endpoint, headers, body, &resp); err != nil {
+		return chatResponse{}, err
+	}
+
+	out := chatResponse{
+		Usage:       Usage{InputTokens: resp.Usage.PromptTokens, OutputTokens: resp.Usage.CompletionTokens},
+		Fingerprint: resp.SystemFingerprint,
+	}
+	var text strings.Builder
+	for _, choice := range resp.Choices {
+		if req.N > 1 {
+			out.Choices = append(out.Choices, choice.Message.Content)
+			if len(out.Choices) > 1 {
+				continue
+			}
+		}
+		text.WriteString(choice.Message.Content)
+		out.StopReason = choice.FinishReason
+		for _, tc := range choice.Message.ToolCalls {
+			out.ToolCalls = append(out.ToolCalls, ToolCall{ID: tc.ID, Name: tc.Function.Name, Arguments: tc.Function.Arguments})
+		}
+	}
+	out.Text = text.String()
+	return out, nil
+}
@@ -1,9 +1,14 @@
+//go:build !no_openai
+
 package sqirvy
 
 import (
 	"context"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 )
 
 func TestOpenAIClient_QueryText(t *testing.T) {
@@ -52,3 +57,132 @@ func TestOpenAIClient_QueryText(t *testing.T) {
 		})
 	}
 }
+
+func TestOpenAIBackend(t *testing.T) {
+	server, header, body := providerServer(t, "/v1/chat/completions", `{
+		"choices": [{
+			"message": {"content": "Hello", "tool_calls": [{"id": "call_1", "type": "function", "function": {"name": "get_time", "arguments": "{}"}}]},
+			"finish_reason": "stop"
+		}],
+		"usage": {"prompt_tokens": 9, "completion_tokens": 2}
+	}`)
+
+	client, err := NewClientWithConfig(OpenAI, Config{APIKey: "test-key", BaseURL: server.URL + "/v1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages := []Message{
+		{Role: RoleSystem, Content: "be brief"},
+		{Role: RoleUser, Content: "hi"},
+		{Role: RoleAssistant, Content: "He"},
+	}
+	text, usage, err := client.QueryMessages(context.Background(), messages, "gpt-4o", Options{Temperature: 0.25, MaxTokens: 50})
+	if err != nil {
+		t.Fatalf("QueryMessages() error = %v", err)
+	}
+
+	if header.Get("Authorization") != "Bearer test-key" {
+		t.Errorf("Authorization header = %q", header.Get("Authorization"))
+	}
+	want := map[string]any{
+		"model": "gpt-4o",
+		"messages": []any{
+			map[string]any{"role": "system", "content": "be brief"},
+			map[string]any{"role": "user", "content": "hi"},
+			map[string]any{"role": "assistant", "content": "He"},
+		},
+		"temperature":           0.5, // scaled to the OpenAI range
+		"max_completion_tokens": 50,
+	}
+	if jsonString(*body) != jsonString(want) {
+		t.Errorf("request body = %s, want %s", jsonString(*body), jsonString(want))
+	}
+	if text != "Hello" || usage != (Usage{InputTokens: 9, OutputTokens: 2}) {
+		t.Errorf("QueryMessages() = %q, %+v", text, usage)
+	}
+
+	// compatible servers get the response limit as max_tokens
+	llama, err := NewClientWithConfig(Llama, Config{APIKey: "test-key", BaseURL: server.URL + "/v1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := llama.QueryText(context.Background(), "", []string{"hi"}, "llama3.3-70b", Options{MaxTokens: 50}); err != nil {
+		t.Fatalf("QueryText() error = %v", err)
+	}
+	if (*body)["max_tokens"] != 50.0 || (*body)["max_completion_tokens"] != nil {
+		t.Errorf("llama request body = %s, want max_tokens", jsonString(*body))
+	}
+	if messages := (*body)["messages"].([]any); len(messages) != 1 {
+		t.Errorf("llama request messages = %v, want no empty system message", messages)
+	}
+}
+
+func TestCircuitBreakerClientErrors(t *testing.T) {
+	var code int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error": {"message": "bad request"}}`, code)
+	}))
+	defer server.Close()
+	t.Setenv("OPENAI_API_KEY", "test-key-0123456789abcdef")
+	t.Setenv("OPENAI_BASE_URL", server.URL)
+
+	defer SetCircuitConfig(CircuitConfig{})
+	if err := SetCircuitConfig(CircuitConfig{Threshold: 1, Cooldown: time.Minute}); err != nil {
+		t.Fatalf("SetCircuitConfig() error = %v", err)
+	}
+	client, err := NewOpenAIClient()
+	if err != nil {
+		t.Fatalf("NewOpenAIClient() error = %v", err)
+	}
+	defer client.Close()
+
+	// a bad request is a mistake of the caller, not a failure of the provider
+	code = http.StatusBadRequest
+	if _, err := client.QueryText(context.Background(), "", []string{"hello"}, "gpt-4o", Options{}); err == nil {
+		t.Fatal("QueryText() error = nil, want the 400")
+	}
+	if CircuitOpen(OpenAI) || GetProviderHealth(OpenAI).ConsecutiveFailures != 0 {
+		t.Fatalf("circuit health after a 400 = %+v, want closed", GetProviderHealth(OpenAI))
+	}
+
+	code = http.StatusServiceUnavailable
+	if _, err := client.QueryText(context.Background(), "", []string{"hello"}, "gpt-4o", Options{}); err == nil {
+		t.Fatal("QueryText() error = nil, want the 503")
+	}
+	if !CircuitOpen(OpenAI) {
+		t.Error("circuit closed after a 503")
+	}
+	recordResult("gpt-4o", nil)
+}
+
+func TestOpenAIBackendToolResults(t *testing.T) {
+	server, _, body := providerServer(t, "/v1/chat/completions", `{
+		"choices": [{"message": {"content": "Sunny."}, "finish_reason": "stop"}],
+		"usage": {"prompt_tokens": 30, "completion_tokens": 2}
+	}`)
+
+	client, err := NewClientWithConfig(OpenAI, Config{APIKey: "test-key", BaseURL: server.URL + "/v1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages := toolConversation("call_1", `{"sky": "sunny"}`)
+	resp, err := QueryMessagesWithTools(context.Background(), client, messages, "gpt-4o-mini", Options{}, toolConversationTools)
+	if err != nil {
+		t.Fatalf("QueryMessagesWithTools() error = %v", err)
+	}
+	if resp.Text != "Sunny." {
+		t.Errorf("QueryMessagesWithTools() = %+v", resp)
+	}
+
+	want := []any{
+		map[string]any{"role": "system", "content": "be brief"},
+		map[string]any{"role": "user", "content": "weather in Paris?"},
+		map[string]any{"role": "assistant", "content": "Checking.", "tool_calls": []any{map[string]any{
+			"id": "call_1", "type": "function", "function": map[string]any{"name": "get_weather", "arguments": `{"city": "Paris"}`},
+		}}},
+		map[string]any{"role": "tool", "content": `{"sky": "sunny"}`, "tool_call_id": "call_1"},
+	}
+	if got := jsonString((*body)["messages"]); got != jsonString(want) {
+		t.Errorf("request messages = %s, want %s", got, jsonString(want))
+	}
+}
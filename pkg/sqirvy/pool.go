@@ -0,0 +1,66 @@
+// Package sqirvy provides a pool of provider clients.
+//
+// A client holds its HTTP client and the settings read from the environment, so
+// programs that send many queries, e.g. batch jobs or a file watcher, should
+// create one client per provider and reuse it. ClientPool does this: Get creates
+// the client of a provider on first use and returns the same client afterwards,
+// and Close closes all of them on shutdown.
+package sqirvy
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ClientPool holds one client per provider. It is safe for concurrent use.
+// The pool owns its clients; callers must not close them.
+type ClientPool struct {
+	mu      sync.Mutex
+	clients map[string]Client
+	closed  bool
+}
+
+// NewClientPool returns an empty pool.
+func NewClientPool() *ClientPool {
+	return &ClientPool{clients: make(map[string]Client)}
+}
+
+// Get returns the client of the provider, creating it with NewClient on first use.
+// A client that cannot be created is not cached, so a later call, e.g. after the
+// API key has been set, tries again.
+func (p *ClientPool) Get(provider string) (Client, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return nil, fmt.Errorf("client pool is closed")
+	}
+	if client, ok := p.clients[provider]; ok {
+		return client, nil
+	}
+	client, err := NewClient(provider)
+	if err != nil {
+		return nil, err
+	}
+	p.clients[provider] = client
+	return client, nil
+}
+
+// Close closes the clients of the pool. Get fails afterwards.
+// It returns the errors of all clients that failed to close.
+func (p *ClientPool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return nil
+	}
+	p.closed = true
+	var errs []error
+	for provider, client := range p.clients {
+		if err := client.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("closing client for provider %s: %w", provider, err))
+		}
+	}
+	p.clients = nil
+	return errors.Join(errs...)
+}
@@ -0,0 +1,82 @@
+package sqirvy
+
+import (
+	"errors"
+	"testing"
+)
+
+// closeCounter is a client that counts its Close calls.
+type closeCounter struct {
+	*MockClient
+	closed int
+	err    error
+}
+
+func (c *closeCounter) Close() error {
+	c.closed++
+	return c.err
+}
+
+func TestClientPool(t *testing.T) {
+	const name = "test-pool"
+	defer unregisterProvider(name)
+
+	var created []*closeCounter
+	if err := RegisterProvider(name, func(Config) (Client, error) {
+		mock, _ := NewMockClient()
+		c := &closeCounter{MockClient: mock}
+		created = append(created, c)
+		return c, nil
+	}); err != nil {
+		t.Fatalf("RegisterProvider() error = %v", err)
+	}
+
+	pool := NewClientPool()
+	tests := []struct {
+		name        string
+		provider    string
+		wantCreated int
+		wantErr     bool
+	}{
+		{name: "first use creates the client", provider: name, wantCreated: 1},
+		{name: "second use reuses the client", provider: name, wantCreated: 1},
+		{name: "other provider", provider: Mock, wantCreated: 1},
+		{name: "unknown provider", provider: "unknown", wantCreated: 1, wantErr: true},
+	}
+	var first Client
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := pool.Get(tt.provider)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Get() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(created) != tt.wantCreated {
+				t.Errorf("Get() created %d clients, want %d", len(created), tt.wantCreated)
+			}
+			if tt.provider == name {
+				if first == nil {
+					first = client
+				} else if client != first {
+					t.Errorf("Get() returned a new client, want the pooled one")
+				}
+			}
+		})
+	}
+
+	created[0].err = errors.New("close failed")
+	if err := pool.Close(); err == nil {
+		t.Errorf("Close() error = nil, want the error of the client")
+	}
+	if created[0].closed != 1 {
+		t.Errorf("Close() closed the client %d times, want 1", created[0].closed)
+	}
+	if err := pool.Close(); err != nil {
+		t.Errorf("second Close() error = %v, want nil", err)
+	}
+	if created[0].closed != 1 {
+		t.Errorf("second Close() closed the client again")
+	}
+	if _, err := pool.Get(name); err == nil {
+		t.Errorf("Get() after Close() error = nil, want an error")
+	}
+}
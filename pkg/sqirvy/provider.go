@@ -0,0 +1,150 @@
+// Package sqirvy provides the provider registry.
+//
+// NewClient and NewClientWithConfig look up the provider in the registry, which
+// holds the built-in providers. RegisterProvider adds a provider from outside the
+// package, e.g. a local inference server, so that its models can be registered
+// with RegisterModel and used like those of the built-in providers.
+package sqirvy
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ProviderFactory creates a client for a registered provider. Clients created with
+// NewClient get an empty Config, and the factory may read its settings from the
+// environment; clients created with NewClientWithConfig get the caller's Config.
+type ProviderFactory func(cfg Config) (Client, error)
+
+// providerEntry creates the clients of one provider.
+type providerEntry struct {
+	fromEnv        func() (Client, error) // used by NewClient
+	fromConfig     ProviderFactory        // used by NewClientWithConfig
+	maxTemperature float32                // provider temperature that Options.Temperature 1 maps to
+}
+
+// providerRegistry holds the providers NewClient can create clients for. The
+// Anthropic, Gemini, OpenAI and Llama providers add themselves from the files of
+// their clients, which the no_anthropic, no_gemini, no_openai and no_llama build
+// tags leave out of the binary.
+var providerRegistry = map[string]providerEntry{
+	Mock: {
+		fromEnv:        envClient(NewMockClient),
+		fromConfig:     func(Config) (Client, error) { return NewMockClient() },
+		maxTemperature: 1,
+	},
+	Local: {
+		fromEnv:        envClient(NewLocalClient),
+		fromConfig:     func(Config) (Client, error) { return NewLocalClient() },
+		maxTemperature: 1,
+	},
+}
+
+// RegisterProvider adds a provider, whose clients are created by the factory.
+// Models of the provider are added with RegisterModel. Like RegisterModel, it
+// should be called at startup, before any clients are created.
+// It returns an error if the name is invalid or already registered.
+func RegisterProvider(name string, factory ProviderFactory) error {
+	if name == "" || strings.ContainsAny(name, " \t\r\n") {
+		return fmt.Errorf("invalid provider name: %q", name)
+	}
+	if factory == nil {
+		return fmt.Errorf("provider %s has no factory", name)
+	}
+	if _, ok := providerRegistry[name]; ok {
+		return fmt.Errorf("provider %s is already registered", name)
+	}
+	providerRegistry[name] = providerEntry{
+		fromEnv:    func() (Client, error) { return factory(Config{}) },
+		fromConfig: factory,
+	}
+	// a built-in provider left out of the build is already listed
+	if !isProvider(name) {
+		providers = append(providers, name)
+	}
+	return nil
+}
+
+// providerBuildTags are the build tags that leave the built-in providers out.
+var providerBuildTags = map[string]string{
+	Anthropic: "no_anthropic",
+	Gemini:    "no_gemini",
+	OpenAI:    "no_openai",
+	Llama:     "no_llama",
+}
+
+// ProviderIncluded reports whether clients of the provider can be created, i.e.
+// the provider is registered and, for a built-in provider, was not left out of
+// the binary with its build tag.
+func ProviderIncluded(provider string) bool {
+	_, ok := providerRegistry[provider]
+	return ok
+}
+
+// ProviderBuildTag returns the build tag that leaves the built-in provider out
+// of the binary, e.g. no_anthropic, or "" if the provider has none.
+func ProviderBuildTag(provider string) string {
+	return providerBuildTags[provider]
+}
+
+// providerMissing returns the error for a provider that NewClient cannot create
+// clients for.
+func providerMissing(provider string) error {
+	if tag := providerBuildTags[provider]; tag != "" {
+		return fmt.Errorf("provider %s is not included in this build: rebuild without -tags %s", provider, tag)
+	}
+	return fmt.Errorf("unsupported provider: %s", provider)
+}
+
+// MaxTemperature returns the highest temperature the provider accepts, to which
+// Options.Temperature 1 is scaled, e.g. 2 for OpenAI. It is 1 for providers
+// added with RegisterProvider, whose clients receive the temperature unscaled.
+func MaxTemperature(provider string) float32 {
+	if entry, ok := providerRegistry[provider]; ok && entry.maxTemperature > 0 {
+		return entry.maxTemperature
+	}
+	return 1
+}
+
+// validateTemperature returns an error if the temperature of Options is outside 0 to 1.
+func validateTemperature(temperature float32) error {
+	if temperature < 0 || temperature > 1 {
+		return fmt.Errorf("invalid temperature %v: must be between 0 and 1", temperature)
+	}
+	return nil
+}
+
+// nativeTemperature converts the temperature of Options, from 0 to 1, to the
+// range of the model's provider. It is the only place the temperature is scaled.
+func nativeTemperature(model string, temperature float32) float32 {
+	provider, err := GetProviderName(model)
+	if err != nil {
+		return temperature
+	}
+	return temperature * MaxTemperature(provider)
+}
+
+// envClient adapts a built-in constructor that reads the environment.
+func envClient[C Client](newClient func() (C, error)) func() (Client, error) {
+	return func() (Client, error) {
+		client, err := newClient()
+		if err != nil {
+			return nil, err
+		}
+		return client, nil
+	}
+}
+
+// configClient adapts a built-in constructor that takes a Config, which requires an API key.
+func configClient[C Client](newClient func(Config) (C, error)) ProviderFactory {
+	return func(cfg Config) (Client, error) {
+		if cfg.APIKey == "" {
+			return nil, fmt.Errorf("API key not set")
+		}
+		client, err := newClient(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return client, nil
+	}
+}
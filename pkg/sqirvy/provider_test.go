@@ -0,0 +1,118 @@
+package sqirvy
+
+import (
+	"slices"
+	"testing"
+)
+
+// unregisterProvider removes a provider added by a test.
+func unregisterProvider(name string) {
+	delete(providerRegistry, name)
+	providers = slices.DeleteFunc(providers, func(p string) bool { return p == name })
+}
+
+func TestRegisterProvider(t *testing.T) {
+	const name = "test-local"
+	defer unregisterProvider(name)
+	defer delete(modelRegistry, "local-model")
+
+	var gotConfig Config
+	factory := func(cfg Config) (Client, error) {
+		gotConfig = cfg
+		return NewMockClient()
+	}
+
+	tests := []struct {
+		name     string
+		provider string
+		factory  ProviderFactory
+		wantErr  bool
+	}{
+		{name: "new provider", provider: name, factory: factory},
+		{name: "already registered", provider: name, factory: factory, wantErr: true},
+		{name: "built-in provider", provider: OpenAI, factory: factory, wantErr: true},
+		{name: "empty name", provider: "", factory: factory, wantErr: true},
+		{name: "no factory", provider: "other", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := RegisterProvider(tt.provider, tt.factory)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("RegisterProvider() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if !slices.Contains(GetProviderList(), name) {
+		t.Errorf("GetProviderList() = %v, want it to contain %s", GetProviderList(), name)
+	}
+	if err := RegisterModel("local-model", ModelInfo{Provider: name}); err != nil {
+		t.Fatalf("RegisterModel() error = %v", err)
+	}
+
+	client, err := NewClient(name)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	if gotConfig.APIKey != "" {
+		t.Errorf("NewClient() passed config %+v, want an empty config", gotConfig)
+	}
+	if _, err := NewClientWithConfig(name, Config{}, WithAPIKey("key")); err != nil {
+		t.Fatalf("NewClientWithConfig() error = %v", err)
+	}
+	if gotConfig.APIKey != "key" {
+		t.Errorf("NewClientWithConfig() passed API key %q, want %q", gotConfig.APIKey, "key")
+	}
+	client.Close()
+
+	provider, err := GetProviderName("local-model")
+	if err != nil || provider != name {
+		t.Errorf("GetProviderName() = %s, %v, want %s", provider, err, name)
+	}
+}
+
+func TestNativeTemperature(t *testing.T) {
+	tests := []struct {
+		model       string
+		temperature float32
+		want        float32
+	}{
+		{model: "gpt-4o", temperature: 0.5, want: 1},
+		{model: "gemini-2.0-flash", temperature: 1, want: 2},
+		{model: "claude-3-5-haiku-latest", temperature: 0.5, want: 0.5},
+		{model: "llama3.3-70b", temperature: 0.7, want: 0.7},
+		{model: "unregistered-model", temperature: 0.3, want: 0.3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			if got := nativeTemperature(tt.model, tt.temperature); got != tt.want {
+				t.Errorf("nativeTemperature(%s, %v) = %v, want %v", tt.model, tt.temperature, got, tt.want)
+			}
+		})
+	}
+
+	if got := MaxTemperature("no-such-provider"); got != 1 {
+		t.Errorf("MaxTemperature() = %v for an unknown provider, want 1", got)
+	}
+}
+
+func TestProviderIncluded(t *testing.T) {
+	if !ProviderIncluded(Mock) {
+		t.Errorf("ProviderIncluded(%q) = false, want true", Mock)
+	}
+	if ProviderIncluded("no-such-provider") {
+		t.Errorf("ProviderIncluded(%q) = true, want false", "no-such-provider")
+	}
+
+	// a built-in provider left out of the build names its build tag
+	entry, ok := providerRegistry[Llama]
+	if !ok {
+		t.Skip("llama is not included in this build")
+	}
+	delete(providerRegistry, Llama)
+	defer func() { providerRegistry[Llama] = entry }()
+	_, err := NewClient(Llama)
+	if err == nil || err.Error() != "provider llama is not included in this build: rebuild without -tags no_llama" {
+		t.Errorf("NewClient() error = %v, want the no_llama build tag", err)
+	}
+}
@@ -0,0 +1,171 @@
+// Package sqirvy provides client-side rate limiting for AI providers.
+//
+// Each provider can be limited to a number of requests and tokens per minute.
+// The limits are enforced with token buckets shared by all clients of the
+// provider in the process, so batch and concurrent modes stay under the limits
+// the provider applies to the API key instead of being throttled by it.
+package sqirvy
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// RateLimit is the maximum request rate for a provider. Zero means no limit.
+type RateLimit struct {
+	RequestsPerMinute int // requests sent per minute
+	TokensPerMinute   int // input plus output tokens per minute
+}
+
+// tokenBucket allows up to capacity units at once, refilled at rate units per second.
+// The balance can go negative, which makes later callers wait until it is repaid.
+type tokenBucket struct {
+	capacity float64
+	rate     float64 // units per second
+	tokens   float64
+	last     time.Time
+}
+
+// newTokenBucket returns a full bucket for a per-minute limit.
+func newTokenBucket(perMinute int, now time.Time) *tokenBucket {
+	return &tokenBucket{
+		capacity: float64(perMinute),
+		rate:     float64(perMinute) / 60,
+		tokens:   float64(perMinute),
+		last:     now,
+	}
+}
+
+// refill adds the units accumulated since the last call.
+func (b *tokenBucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = min(b.capacity, b.tokens+elapsed*b.rate)
+		b.last = now
+	}
+}
+
+// reserve takes n units and returns how long the caller must wait before using them.
+// A request larger than the bucket waits for a full bucket rather than forever.
+func (b *tokenBucket) reserve(n float64, now time.Time) time.Duration {
+	b.refill(now)
+	b.tokens -= min(n, b.capacity)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// adjust corrects an earlier reservation by n units, which may be negative.
+func (b *tokenBucket) adjust(n float64, now time.Time) {
+	b.refill(now)
+	b.tokens = max(-b.capacity, min(b.capacity, b.tokens-n))
+}
+
+// rateLimiter enforces the limits of one provider.
+type rateLimiter struct {
+	requests *tokenBucket // nil if requests are not limited
+	tokens   *tokenBucket // nil if tokens are not limited
+}
+
+var (
+	rateLimitMu  sync.Mutex
+	rateLimiters = make(map[string]*rateLimiter)
+)
+
+// SetRateLimit limits the requests and tokens per minute sent to the provider.
+// A zero RateLimit removes the limits.
+func SetRateLimit(provider string, limit RateLimit) error {
+	if !isProvider(provider) {
+		return fmt.Errorf("unsupported provider: %s", provider)
+	}
+	if limit.RequestsPerMinute < 0 || limit.TokensPerMinute < 0 {
+		return fmt.Errorf("invalid rate limit for provider %s: limits cannot be negative", provider)
+	}
+
+	rateLimitMu.Lock()
+	defer rateLimitMu.Unlock()
+	if limit == (RateLimit{}) {
+		delete(rateLimiters, provider)
+		return nil
+	}
+	now := time.Now()
+	l := &rateLimiter{}
+	if limit.RequestsPerMinute > 0 {
+		l.requests = newTokenBucket(limit.RequestsPerMinute, now)
+	}
+	if limit.TokensPerMinute > 0 {
+		l.tokens = newTokenBucket(limit.TokensPerMinute, now)
+	}
+	rateLimiters[provider] = l
+	return nil
+}
+
+// EstimateTokens approximates the number of tokens in the prompts at four
+// characters per token, which is close enough for rate limiting, budgets and
+// warnings about large prompts.
+func EstimateTokens(system string, prompts []string) int64 {
+	n := len(system)
+	for _, p := range prompts {
+		n += len(p)
+	}
+	return int64(n/4 + 1)
+}
+
+// waitRateLimit blocks until the provider of the model may be sent a request with
+// the estimated number of input tokens, or the context is done.
+func waitRateLimit(ctx context.Context, model string, estimate int64) error {
+	provider, err := GetProviderName(model)
+	if err != nil {
+		return nil
+	}
+
+	rateLimitMu.Lock()
+	l := rateLimiters[provider]
+	var wait time.Duration
+	if l != nil {
+		now := time.Now()
+		if l.requests != nil {
+			wait = max(wait, l.requests.reserve(1, now))
+		}
+		if l.tokens != nil {
+			wait = max(wait, l.tokens.reserve(float64(estimate), now))
+		}
+	}
+	rateLimitMu.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+	slog.Debug("Waiting for rate limit", "provider", provider, "wait", wait.Round(time.Millisecond))
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("waiting for %s rate limit: %w", provider, ctx.Err())
+	}
+}
+
+// recordUsage replaces the estimate charged to the token bucket with the usage
+// reported by the provider, which includes the output tokens.
+func recordUsage(model string, estimate int64, usage Usage) {
+	total := usage.InputTokens + usage.OutputTokens
+	if total == 0 {
+		// the provider did not report usage, keep the estimate
+		return
+	}
+	provider, err := GetProviderName(model)
+	if err != nil {
+		return
+	}
+
+	rateLimitMu.Lock()
+	defer rateLimitMu.Unlock()
+	if l := rateLimiters[provider]; l != nil && l.tokens != nil {
+		l.tokens.adjust(float64(total-estimate), time.Now())
+	}
+}
@@ -0,0 +1,73 @@
+package sqirvy
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	start := time.Now()
+	b := newTokenBucket(60, start) // one unit per second
+
+	if wait := b.reserve(60, start); wait != 0 {
+		t.Errorf("reserve(60) on a full bucket waits %v, want 0", wait)
+	}
+	if wait := b.reserve(2, start); wait != 2*time.Second {
+		t.Errorf("reserve(2) on an empty bucket waits %v, want 2s", wait)
+	}
+
+	// after 10 seconds the 2 unit debt is repaid and 8 units are available
+	if wait := b.reserve(8, start.Add(10*time.Second)); wait != 0 {
+		t.Errorf("reserve(8) after refill waits %v, want 0", wait)
+	}
+
+	// requests larger than the bucket wait for a full bucket, not forever
+	b = newTokenBucket(60, start)
+	if wait := b.reserve(1000, start); wait != 0 {
+		t.Errorf("reserve(1000) on a full bucket waits %v, want 0", wait)
+	}
+
+	// adjusting for a larger actual usage creates a debt
+	b = newTokenBucket(60, start)
+	b.reserve(10, start)
+	b.adjust(55, start)
+	if wait := b.reserve(1, start); wait != 6*time.Second {
+		t.Errorf("reserve(1) after adjust waits %v, want 6s", wait)
+	}
+}
+
+func TestSetRateLimit(t *testing.T) {
+	defer SetRateLimit(OpenAI, RateLimit{})
+
+	if err := SetRateLimit("no-such-provider", RateLimit{RequestsPerMinute: 1}); err == nil {
+		t.Error("SetRateLimit() error = nil for an unknown provider")
+	}
+	if err := SetRateLimit(OpenAI, RateLimit{RequestsPerMinute: -1}); err == nil {
+		t.Error("SetRateLimit() error = nil for a negative limit")
+	}
+
+	// one request per minute: the first request passes, the second waits
+	if err := SetRateLimit(OpenAI, RateLimit{RequestsPerMinute: 1}); err != nil {
+		t.Fatalf("SetRateLimit() error = %v", err)
+	}
+	if err := waitRateLimit(context.Background(), "gpt-4o", 10); err != nil {
+		t.Fatalf("waitRateLimit() error = %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := waitRateLimit(ctx, "gpt-4o", 10); err == nil {
+		t.Error("waitRateLimit() error = nil, want the context deadline while waiting")
+	}
+
+	// other providers are not limited
+	if err := waitRateLimit(ctx, "claude-3-5-haiku-latest", 10); err != nil {
+		t.Errorf("waitRateLimit() for an unlimited provider error = %v", err)
+	}
+}
+
+func TestEstimateTokens(t *testing.T) {
+	if got := EstimateTokens("12345678", []string{"1234", "1234"}); got != 5 {
+		t.Errorf("EstimateTokens() = %d, want 5", got)
+	}
+}
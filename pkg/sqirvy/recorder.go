@@ -0,0 +1,67 @@
+// Package sqirvy provides a hook that observes every completion request, e.g.
+// for an audit log of the prompts and responses.
+//
+// SetQueryRecorder registers a function that is called after each request to a
+// provider, successful or not, with the conversation, the response and the usage.
+package sqirvy
+
+import (
+	"sync"
+	"time"
+)
+
+// QueryRecord describes one completion request and its result.
+type QueryRecord struct {
+	Time      time.Time // start of the request
+	Provider  string
+	Model     string
+	Messages  []Message // conversation sent, including system messages
+	Response  string    // text of the response
+	ToolCalls []ToolCall
+	Usage     Usage
+	Seed      *int64 // sampling seed of the request, if any
+	// Fingerprint identifies the backend configuration of the provider, e.g. the
+	// system_fingerprint of OpenAI, if reported
+	Fingerprint string
+	Duration    time.Duration
+	Err         error // error of the request, or nil
+}
+
+var (
+	recorderMu    sync.Mutex
+	queryRecorder func(QueryRecord)
+)
+
+// SetQueryRecorder calls f after every completion request. A nil f turns
+// recording off. f is called from the goroutine that made the request, so it
+// must be safe for concurrent use.
+func SetQueryRecorder(f func(QueryRecord)) {
+	recorderMu.Lock()
+	defer recorderMu.Unlock()
+	queryRecorder = f
+}
+
+// recordQuery passes a request and its result to the query recorder, if any.
+func recordQuery(req chatRequest, start time.Time, resp chatResponse, err error) {
+	recorderMu.Lock()
+	f := queryRecorder
+	recorderMu.Unlock()
+	if f == nil {
+		return
+	}
+	provider, _ := GetProviderName(req.Model)
+	f(QueryRecord{
+		Time:      start,
+		Provider:  provider,
+		Model:     req.Model,
+		Messages:  req.Messages,
+		Response:  resp.Text,
+		ToolCalls: resp.ToolCalls,
+		Usage:     resp.Usage,
+		Seed:      req.Seed,
+
+		Fingerprint: resp.Fingerprint,
+		Duration:    time.Since(start),
+		Err:         err,
+	})
+}
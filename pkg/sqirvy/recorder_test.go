@@ -0,0 +1,46 @@
+package sqirvy
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSetQueryRecorder(t *testing.T) {
+	var records []QueryRecord
+	SetQueryRecorder(func(r QueryRecord) { records = append(records, r) })
+	defer SetQueryRecorder(nil)
+
+	client, err := NewClient(Mock)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	response, err := client.QueryText(context.Background(), "be brief", []string{"hello"}, "mock", Options{})
+	if err != nil {
+		t.Fatalf("QueryText() error = %v", err)
+	}
+
+	if len(records) != 1 {
+		t.Fatalf("recorded %d queries, want 1", len(records))
+	}
+	r := records[0]
+	if r.Provider != Mock || r.Model != "mock" {
+		t.Errorf("record provider, model = %q, %q, want %q, %q", r.Provider, r.Model, Mock, "mock")
+	}
+	if len(r.Messages) != 2 || r.Messages[0].Role != RoleSystem || r.Messages[1].Content != "hello" {
+		t.Errorf("record messages = %+v, want the system prompt and the prompt", r.Messages)
+	}
+	if r.Response != response || r.Err != nil {
+		t.Errorf("record response, err = %q, %v, want %q, nil", r.Response, r.Err, response)
+	}
+	if r.Time.IsZero() || r.Usage.OutputTokens == 0 {
+		t.Errorf("record = %+v, want time and usage", r)
+	}
+
+	SetQueryRecorder(nil)
+	if _, err := client.QueryText(context.Background(), "", []string{"again"}, "mock", Options{}); err != nil {
+		t.Fatalf("QueryText() error = %v", err)
+	}
+	if len(records) != 1 {
+		t.Errorf("recorded %d queries after SetQueryRecorder(nil), want 1", len(records))
+	}
+}
@@ -0,0 +1,139 @@
+// Package sqirvy provides reranking of documents with the Cohere, Voyage AI and
+// Jina AI rerank APIs.
+//
+// Rerank scores candidate documents, e.g. the results of a search, by their
+// relevance to a query with a cross-encoder model and returns them best first.
+package sqirvy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Rerank providers
+const (
+	RerankCohere = "cohere" // Cohere, with COHERE_API_KEY and COHERE_BASE_URL
+	RerankVoyage = "voyage" // Voyage AI, with VOYAGE_API_KEY and VOYAGE_BASE_URL
+	RerankJina   = "jina"   // Jina AI, with JINA_API_KEY and JINA_BASE_URL
+)
+
+// rerankProvider is the endpoint and default model of a rerank provider.
+type rerankProvider struct {
+	keyVar         string
+	baseURLVar     string
+	defaultBaseURL string
+	defaultModel   string
+	path           string
+	topField       string // name of the field limiting the number of results
+}
+
+// rerankProviders holds the rerank providers by name.
+var rerankProviders = map[string]rerankProvider{
+	RerankCohere: {
+		keyVar: "COHERE_API_KEY", baseURLVar: "COHERE_BASE_URL", defaultBaseURL: "https://api.cohere.com",
+		defaultModel: "rerank-v3.5", path: "/v2/rerank", topField: "top_n",
+	},
+	RerankVoyage: {
+		keyVar: "VOYAGE_API_KEY", baseURLVar: "VOYAGE_BASE_URL", defaultBaseURL: "https://api.voyageai.com",
+		defaultModel: "rerank-2", path: "/v1/rerank", topField: "top_k",
+	},
+	RerankJina: {
+		keyVar: "JINA_API_KEY", baseURLVar: "JINA_BASE_URL", defaultBaseURL: "https://api.jina.ai",
+		defaultModel: "jina-reranker-v2-base-multilingual", path: "/v1/rerank", topField: "top_n",
+	},
+}
+
+// RerankOptions configure Rerank. The zero value reranks all documents with the
+// default Cohere model.
+type RerankOptions struct {
+	Provider string // cohere (default), voyage or jina
+	Model    string // model of the provider, empty for its default
+	TopN     int    // number of documents to return, 0 for all
+}
+
+// RerankResult is a document scored by Rerank.
+type RerankResult struct {
+	Index    int     // index of the document in the input
+	Score    float64 // relevance to the query, higher is more relevant
+	Document string
+}
+
+// RerankProviders returns the names of the rerank providers, sorted.
+func RerankProviders() []string {
+	names := make([]string, 0, len(rerankProviders))
+	for name := range rerankProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Rerank scores the documents by relevance to the query and returns them sorted
+// by score, most relevant first.
+func Rerank(ctx context.Context, query string, documents []string, options RerankOptions) ([]RerankResult, error) {
+	if options.Provider == "" {
+		options.Provider = RerankCohere
+	}
+	p, ok := rerankProviders[options.Provider]
+	if !ok {
+		return nil, fmt.Errorf("unsupported rerank provider %q (use %s)", options.Provider, strings.Join(RerankProviders(), ", "))
+	}
+	if strings.TrimSpace(query) == "" {
+		return nil, fmt.Errorf("rerank query cannot be empty")
+	}
+	if len(documents) == 0 {
+		return nil, nil
+	}
+	apiKey := os.Getenv(p.keyVar)
+	if apiKey == "" {
+		return nil, fmt.Errorf("%s environment variable not set", p.keyVar)
+	}
+	if options.Model == "" {
+		options.Model = p.defaultModel
+	}
+	baseURL := envOrDefault(p.baseURLVar, p.defaultBaseURL)
+	results, err := rerankAPI(ctx, apiHTTPClient(options.Provider), p, baseURL, apiKey, query, documents, options)
+	if err != nil {
+		return nil, fmt.Errorf("rerank failed: %w", err)
+	}
+	return results, nil
+}
+
+// rerankScore is the score of a document in a rerank response.
+type rerankScore struct {
+	Index          int     `json:"index"`
+	RelevanceScore float64 `json:"relevance_score"`
+}
+
+// rerankAPI calls the rerank endpoint of a provider. The APIs of Cohere, Voyage AI
+// and Jina AI differ only in the names of the fields of the number of results and
+// of the results.
+func rerankAPI(ctx context.Context, client *http.Client, p rerankProvider, baseURL, apiKey, query string, documents []string, options RerankOptions) ([]RerankResult, error) {
+	body := map[string]any{"model": options.Model, "query": query, "documents": documents}
+	if options.TopN > 0 {
+		body[p.topField] = options.TopN
+	}
+	var resp struct {
+		Results []rerankScore `json:"results"` // Cohere and Jina AI
+		Data    []rerankScore `json:"data"`    // Voyage AI
+	}
+	headers := map[string]string{"Authorization": "Bearer " + apiKey}
+	if err := postJSON(ctx, client, strings.TrimSuffix(baseURL, "/")+p.path, headers, body, &resp); err != nil {
+		return nil, err
+	}
+
+	scores := append(resp.Results, resp.Data...)
+	results := make([]RerankResult, 0, len(scores))
+	for _, r := range scores {
+		if r.Index < 0 || r.Index >= len(documents) {
+			return nil, fmt.Errorf("invalid response: document index %d out of range", r.Index)
+		}
+		results = append(results, RerankResult{Index: r.Index, Score: r.RelevanceScore, Document: documents[r.Index]})
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+	return results, nil
+}
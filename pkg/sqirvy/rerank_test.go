@@ -0,0 +1,81 @@
+package sqirvy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestRerankAPI(t *testing.T) {
+	documents := []string{"cats purr", "go has goroutines", "channels connect goroutines"}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]any
+		if r.Header.Get("Authorization") != "Bearer test-key" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req["query"] != "concurrency in go" {
+			http.Error(w, "bad body", http.StatusBadRequest)
+			return
+		}
+		switch r.URL.Path {
+		case "/v2/rerank": // Cohere, results in index order
+			if req["top_n"] != 2.0 {
+				http.Error(w, "bad top_n", http.StatusBadRequest)
+				return
+			}
+			w.Write([]byte(`{"id": "x", "results": [{"index": 1, "relevance_score": 0.6}, {"index": 2, "relevance_score": 0.9}], "meta": {}}`))
+		case "/v1/rerank": // Voyage AI
+			if req["top_k"] != 2.0 {
+				http.Error(w, "bad top_k", http.StatusBadRequest)
+				return
+			}
+			w.Write([]byte(`{"object": "list", "data": [{"index": 2, "relevance_score": 0.9}, {"index": 1, "relevance_score": 0.6}], "usage": {"total_tokens": 10}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	want := []RerankResult{
+		{Index: 2, Score: 0.9, Document: "channels connect goroutines"},
+		{Index: 1, Score: 0.6, Document: "go has goroutines"},
+	}
+	tests := []struct {
+		name     string
+		provider string
+		path     string
+		wantErr  bool
+	}{
+		{name: "cohere", provider: RerankCohere},
+		{name: "voyage", provider: RerankVoyage},
+		{name: "not found", provider: RerankCohere, path: "/other", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := rerankProviders[tt.provider]
+			if tt.path != "" {
+				p.path = tt.path
+			}
+			got, err := rerankAPI(context.Background(), http.DefaultClient, p, server.URL+"/", "test-key", "concurrency in go", documents, RerankOptions{Model: "m", TopN: 2})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("rerankAPI() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, want) {
+				t.Errorf("rerankAPI() = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestRerankInvalidOptions(t *testing.T) {
+	if _, err := Rerank(context.Background(), "query", []string{"doc"}, RerankOptions{Provider: "acme"}); err == nil {
+		t.Error("Rerank() error = nil, want error for unknown provider")
+	}
+	if _, err := Rerank(context.Background(), " ", []string{"doc"}, RerankOptions{}); err == nil {
+		t.Error("Rerank() error = nil, want error for empty query")
+	}
+}
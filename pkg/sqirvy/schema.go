@@ -0,0 +1,218 @@
+// Package sqirvy provides validation of structured model responses.
+//
+// This file implements a small JSON Schema validator covering the subset of
+// the specification commonly used to describe extraction results: type,
+// properties, required, additionalProperties, items and enum.
+package sqirvy
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ParseSchema decodes a JSON Schema document into a generic map.
+func ParseSchema(data []byte) (map[string]any, error) {
+	var schema map[string]any
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return nil, fmt.Errorf("invalid JSON schema: %w", err)
+	}
+	return schema, nil
+}
+
+// StripCodeFences removes a surrounding markdown code fence, if present, so that
+// a model response formatted as a code block can be parsed.
+func StripCodeFences(s string) string {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "```") {
+		return s
+	}
+	// drop the opening fence line, which may carry a language tag
+	if i := strings.Index(s, "\n"); i >= 0 {
+		s = s[i+1:]
+	} else {
+		return ""
+	}
+	s = strings.TrimSpace(s)
+	s = strings.TrimSuffix(s, "```")
+	return strings.TrimSpace(s)
+}
+
+// ExtractCode returns the code of a model response that may wrap it in markdown
+// fences and prose, e.g. "Here is the program:\n```go\n...\n```\nIt prints...".
+// If the response has fenced blocks, the longest one is returned without its
+// fences; otherwise the whole response is returned. Fences are only recognized at
+// the start of a line, so backticks inside code are kept.
+func ExtractCode(s string) string {
+	var blocks []string
+	var block []string
+	inBlock := false
+	for _, line := range strings.Split(s, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			if inBlock {
+				blocks = append(blocks, strings.Join(block, "\n"))
+				block = nil
+			}
+			inBlock = !inBlock
+			continue
+		}
+		if inBlock {
+			block = append(block, line)
+		}
+	}
+	if inBlock {
+		// an unterminated fence, e.g. a response cut off by the token limit
+		blocks = append(blocks, strings.Join(block, "\n"))
+	}
+	if len(blocks) == 0 {
+		return strings.TrimSpace(s)
+	}
+	longest := blocks[0]
+	for _, b := range blocks[1:] {
+		if len(b) > len(longest) {
+			longest = b
+		}
+	}
+	return strings.Trim(longest, "\n")
+}
+
+// ValidateJSON checks that the decoded JSON value conforms to the schema.
+// It returns an error describing the first violation found.
+func ValidateJSON(schema map[string]any, value any) error {
+	return validateValue(schema, value, "$")
+}
+
+func validateValue(schema map[string]any, value any, path string) error {
+	if enum, ok := schema["enum"].([]any); ok {
+		found := false
+		for _, e := range enum {
+			if reflect.DeepEqual(e, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s: value %v is not one of %v", path, value, enum)
+		}
+	}
+
+	if t, ok := schema["type"]; ok {
+		var types []string
+		switch tv := t.(type) {
+		case string:
+			types = []string{tv}
+		case []any:
+			for _, v := range tv {
+				if s, ok := v.(string); ok {
+					types = append(types, s)
+				}
+			}
+		}
+		matched := false
+		for _, typ := range types {
+			if matchesType(typ, value) {
+				matched = true
+				break
+			}
+		}
+		if len(types) > 0 && !matched {
+			return fmt.Errorf("%s: expected %v, got %s", path, t, jsonTypeName(value))
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		return validateObject(schema, v, path)
+	case []any:
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, item := range v {
+				if err := validateValue(items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func validateObject(schema map[string]any, obj map[string]any, path string) error {
+	if required, ok := schema["required"].([]any); ok {
+		for _, r := range required {
+			name, _ := r.(string)
+			if _, ok := obj[name]; !ok {
+				return fmt.Errorf("%s: missing required property %q", path, name)
+			}
+		}
+	}
+
+	props, _ := schema["properties"].(map[string]any)
+
+	// iterate in a stable order so errors are reproducible
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		propSchema, ok := props[k].(map[string]any)
+		if !ok {
+			if additional, ok := schema["additionalProperties"].(bool); ok && !additional {
+				return fmt.Errorf("%s: unexpected property %q", path, k)
+			}
+			continue
+		}
+		if err := validateValue(propSchema, obj[k], path+"."+k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func matchesType(typ string, value any) bool {
+	switch typ {
+	case "object":
+		_, ok := value.(map[string]any)
+		return ok
+	case "array":
+		_, ok := value.([]any)
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		f, ok := value.(float64)
+		return ok && f == math.Trunc(f)
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "null":
+		return value == nil
+	}
+	// unknown types are not enforced
+	return true
+}
+
+func jsonTypeName(value any) string {
+	switch value.(type) {
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	case nil:
+		return "null"
+	}
+	return fmt.Sprintf("%T", value)
+}
@@ -0,0 +1,123 @@
+package sqirvy
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestValidateJSON(t *testing.T) {
+	schema, err := ParseSchema([]byte(`{
+		"type": "object",
+		"required": ["name", "age"],
+		"additionalProperties": false,
+		"properties": {
+			"name":   {"type": "string"},
+			"age":    {"type": "integer"},
+			"role":   {"enum": ["admin", "user"]},
+			"emails": {"type": "array", "items": {"type": "string"}}
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		input   string
+		wantErr bool
+	}{
+		{
+			name:    "Valid object",
+			input:   `{"name": "ann", "age": 42, "role": "admin", "emails": ["a@b.c"]}`,
+			wantErr: false,
+		},
+		{
+			name:    "Missing required",
+			input:   `{"name": "ann"}`,
+			wantErr: true,
+		},
+		{
+			name:    "Wrong type",
+			input:   `{"name": "ann", "age": "42"}`,
+			wantErr: true,
+		},
+		{
+			name:    "Non integer",
+			input:   `{"name": "ann", "age": 4.2}`,
+			wantErr: true,
+		},
+		{
+			name:    "Enum violation",
+			input:   `{"name": "ann", "age": 42, "role": "root"}`,
+			wantErr: true,
+		},
+		{
+			name:    "Array item violation",
+			input:   `{"name": "ann", "age": 42, "emails": [1]}`,
+			wantErr: true,
+		},
+		{
+			name:    "Additional property",
+			input:   `{"name": "ann", "age": 42, "extra": true}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var value any
+			if err := json.Unmarshal([]byte(tt.input), &value); err != nil {
+				t.Fatal(err)
+			}
+			err := ValidateJSON(schema, value)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateJSON() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestExtractCode(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{name: "No fence", input: "package main\n\nfunc main() {}\n", want: "package main\n\nfunc main() {}"},
+		{name: "Fence only", input: "```go\npackage main\n```", want: "package main"},
+		{name: "Prose around the fence", input: "Here is the code:\n\n```go\npackage main\n\nfunc main() {}\n```\n\nRun it with go run.", want: "package main\n\nfunc main() {}"},
+		{name: "Longest of several blocks", input: "```bash\ngo run .\n```\n\n```go\npackage main\n\nfunc main() {}\n```", want: "package main\n\nfunc main() {}"},
+		{name: "Indentation kept", input: "```python\ndef f():\n    return 1\n```", want: "def f():\n    return 1"},
+		{name: "Unterminated fence", input: "Sure:\n```go\npackage main\n", want: "package main"},
+		{name: "Backticks inside code", input: "```go\ns := `a ``` b`\n```", want: "s := `a ``` b`"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ExtractCode(tt.input); got != tt.want {
+				t.Errorf("ExtractCode() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStripCodeFences(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{name: "No fence", input: " {\"a\": 1}\n", want: `{"a": 1}`},
+		{name: "Fence with language", input: "```json\n{\"a\": 1}\n```", want: `{"a": 1}`},
+		{name: "Fence without language", input: "```\na,b\n1,2\n```\n", want: "a,b\n1,2"},
+		{name: "Unterminated fence", input: "```", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := StripCodeFences(tt.input); got != tt.want {
+				t.Errorf("StripCodeFences() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,216 @@
+// Package sqirvy provides text-to-speech with the OpenAI and Gemini APIs.
+//
+// Speak converts a text to audio with the /audio/speech endpoint of OpenAI or a
+// Gemini TTS model, and returns the encoded audio, e.g. an MP3 or WAV file.
+package sqirvy
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Audio formats of Speak
+const (
+	SpeechMP3  = "mp3"
+	SpeechOpus = "opus"
+	SpeechAAC  = "aac"
+	SpeechFLAC = "flac"
+	SpeechWAV  = "wav"
+	SpeechPCM  = "pcm" // raw 16-bit little-endian mono samples, 24 kHz
+)
+
+// MaxSpeechChars is the longest text the OpenAI speech API accepts.
+const MaxSpeechChars = 4096
+
+// default speech models, voices and formats of the providers
+var (
+	speechModels  = map[string]string{OpenAI: "gpt-4o-mini-tts", Gemini: "gemini-2.5-flash-preview-tts"}
+	speechVoices  = map[string]string{OpenAI: "alloy", Gemini: "Kore"}
+	speechFormats = map[string][]string{
+		OpenAI: {SpeechMP3, SpeechOpus, SpeechAAC, SpeechFLAC, SpeechWAV, SpeechPCM},
+		Gemini: {SpeechWAV, SpeechPCM},
+	}
+)
+
+// SpeechOptions configure Speak. The zero value speaks with the OpenAI
+// gpt-4o-mini-tts model and the alloy voice, as MP3.
+type SpeechOptions struct {
+	Provider     string // openai (default) or gemini
+	Model        string // model of the provider, empty for its default
+	Voice        string // voice of the provider, e.g. alloy or Kore, empty for its default
+	Format       string // audio format, mp3 (default for OpenAI) or wav (default for Gemini), see SpeechFormats
+	Instructions string // how to speak, e.g. "calm and slow", for models that support it
+}
+
+// SpeechFormats returns the audio formats a provider can produce.
+func SpeechFormats(provider string) []string {
+	return append([]string(nil), speechFormats[provider]...)
+}
+
+// Speak converts text to audio with the provider of the options, using the API
+// key and base URL environment variables of the provider's client.
+func Speak(ctx context.Context, text string, options SpeechOptions) ([]byte, error) {
+	if options.Provider == "" {
+		options.Provider = OpenAI
+	}
+	formats, ok := speechFormats[options.Provider]
+	if !ok {
+		return nil, fmt.Errorf("unsupported speech provider %q (use openai or gemini)", options.Provider)
+	}
+	if options.Format == "" {
+		options.Format = formats[0]
+	}
+	if !slices.Contains(formats, options.Format) {
+		return nil, fmt.Errorf("unsupported audio format %q for %s (use %s)", options.Format, options.Provider, strings.Join(formats, ", "))
+	}
+	if strings.TrimSpace(text) == "" {
+		return nil, fmt.Errorf("no text to speak")
+	}
+	if options.Model == "" {
+		options.Model = speechModels[options.Provider]
+	}
+	if options.Voice == "" {
+		options.Voice = speechVoices[options.Provider]
+	}
+
+	baseURL, apiKey, err := providerEndpoint(options.Provider)
+	if err != nil {
+		return nil, err
+	}
+	client := apiHTTPClient(options.Provider)
+	var audio []byte
+	switch options.Provider {
+	case OpenAI:
+		if len([]rune(text)) > MaxSpeechChars {
+			return nil, fmt.Errorf("text of %d characters is longer than the limit of %d", len([]rune(text)), MaxSpeechChars)
+		}
+		audio, err = speakOpenAI(ctx, client, baseURL, apiKey, text, options)
+	case Gemini:
+		audio, err = speakGemini(ctx, client, baseURL, apiKey, text, options)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("speech failed: %w", err)
+	}
+	return audio, nil
+}
+
+// speakOpenAI calls the /audio/speech endpoint of an OpenAI-compatible API, which
+// returns the encoded audio.
+func speakOpenAI(ctx context.Context, client *http.Client, baseURL, apiKey, text string, options SpeechOptions) ([]byte, error) {
+	body := map[string]string{
+		"model":           options.Model,
+		"input":           text,
+		"voice":           options.Voice,
+		"response_format": options.Format,
+	}
+	if options.Instructions != "" {
+		body["instructions"] = options.Instructions
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("encoding request: %w", err)
+	}
+	headers := map[string]string{"Content-Type": "application/json", "Authorization": "Bearer " + apiKey}
+	resp, err := doRequest(ctx, client, http.MethodPost, strings.TrimSuffix(baseURL, "/")+"/audio/speech", headers, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	audio, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid response: %w", err)
+	}
+	return audio, nil
+}
+
+// speakGemini calls the generateContent endpoint of a Gemini TTS model, which
+// returns base64 encoded PCM samples, and wraps them in a WAV file if requested.
+func speakGemini(ctx context.Context, client *http.Client, baseURL, apiKey, text string, options SpeechOptions) ([]byte, error) {
+	if options.Instructions != "" {
+		text = options.Instructions + ": " + text
+	}
+	body := map[string]any{
+		"contents": []map[string]any{{"parts": []map[string]string{{"text": text}}}},
+		"generationConfig": map[string]any{
+			"responseModalities": []string{"AUDIO"},
+			"speechConfig": map[string]any{
+				"voiceConfig": map[string]any{
+					"prebuiltVoiceConfig": map[string]string{"voiceName": options.Voice},
+				},
+			},
+		},
+	}
+	var resp struct {
+		Candidates []struct {
+			Content struct {
+				Parts []struct {
+					InlineData struct {
+						MimeType string `json:"mimeType"`
+						Data     string `json:"data"`
+					} `json:"inlineData"`
+				} `json:"parts"`
+			} `json:"content"`
+		} `json:"candidates"`
+	}
+	endpoint := strings.TrimSuffix(baseURL, "/") + "/v1beta/models/" + url.PathEscape(options.Model) + ":generateContent"
+	headers := map[string]string{"x-goog-api-key": apiKey}
+	if err := postJSON(ctx, client, endpoint, headers, body, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Candidates) == 0 || len(resp.Candidates[0].Content.Parts) == 0 {
+		return nil, fmt.Errorf("invalid response: no audio")
+	}
+	inline := resp.Candidates[0].Content.Parts[0].InlineData
+	pcm, err := base64.StdEncoding.DecodeString(inline.Data)
+	if err != nil || len(pcm) == 0 {
+		return nil, fmt.Errorf("invalid response: no audio")
+	}
+	if options.Format == SpeechPCM {
+		return pcm, nil
+	}
+	return pcmToWAV(pcm, pcmSampleRate(inline.MimeType), 1), nil
+}
+
+// pcmSampleRate returns the sample rate of a PCM mime type, e.g.
+// "audio/L16;codec=pcm;rate=24000", or 24000 if it has none.
+func pcmSampleRate(mimeType string) int {
+	for _, param := range strings.Split(mimeType, ";") {
+		if value, ok := strings.CutPrefix(strings.TrimSpace(param), "rate="); ok {
+			if rate, err := strconv.Atoi(value); err == nil && rate > 0 {
+				return rate
+			}
+		}
+	}
+	return 24000
+}
+
+// pcmToWAV returns a WAV file of 16-bit little-endian PCM samples.
+func pcmToWAV(pcm []byte, sampleRate, channels int) []byte {
+	const bitsPerSample = 16
+	blockAlign := channels * bitsPerSample / 8
+	var b bytes.Buffer
+	b.WriteString("RIFF")
+	binary.Write(&b, binary.LittleEndian, uint32(36+len(pcm)))
+	b.WriteString("WAVEfmt ")
+	binary.Write(&b, binary.LittleEndian, uint32(16)) // size of the fmt chunk
+	binary.Write(&b, binary.LittleEndian, uint16(1))  // PCM
+	binary.Write(&b, binary.LittleEndian, uint16(channels))
+	binary.Write(&b, binary.LittleEndian, uint32(sampleRate))
+	binary.Write(&b, binary.LittleEndian, uint32(sampleRate*blockAlign))
+	binary.Write(&b, binary.LittleEndian, uint16(blockAlign))
+	binary.Write(&b, binary.LittleEndian, uint16(bitsPerSample))
+	b.WriteString("data")
+	binary.Write(&b, binary.LittleEndian, uint32(len(pcm)))
+	b.Write(pcm)
+	return b.Bytes()
+}
@@ -0,0 +1,114 @@
+package sqirvy
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSpeakOpenAI(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]string
+		if r.URL.Path != "/v1/audio/speech" || r.Header.Get("Authorization") != "Bearer test-key" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req["voice"] != "nova" || req["response_format"] != SpeechMP3 {
+			http.Error(w, "bad body", http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte("ID3" + req["input"]))
+	}))
+	defer server.Close()
+
+	options := SpeechOptions{Model: "tts-1", Voice: "nova", Format: SpeechMP3}
+	got, err := speakOpenAI(context.Background(), http.DefaultClient, server.URL+"/v1/", "test-key", "hello", options)
+	if err != nil {
+		t.Fatalf("speakOpenAI() error = %v", err)
+	}
+	if string(got) != "ID3hello" {
+		t.Errorf("speakOpenAI() = %q, want %q", got, "ID3hello")
+	}
+	if _, err := speakOpenAI(context.Background(), http.DefaultClient, server.URL+"/other", "test-key", "hello", options); err == nil {
+		t.Error("speakOpenAI() error = nil, want HTTP error")
+	}
+}
+
+func TestSpeakGemini(t *testing.T) {
+	pcm := []byte{1, 0, 2, 0, 3, 0, 4, 0}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1beta/models/tts-model:generateContent" || r.Header.Get("x-goog-api-key") != "test-key" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"candidates": []any{map[string]any{"content": map[string]any{"parts": []any{
+			map[string]any{"inlineData": map[string]string{"mimeType": "audio/L16;codec=pcm;rate=16000", "data": base64.StdEncoding.EncodeToString(pcm)}},
+		}}}}})
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name   string
+		format string
+		check  func(t *testing.T, audio []byte)
+	}{
+		{
+			name:   "pcm",
+			format: SpeechPCM,
+			check: func(t *testing.T, audio []byte) {
+				if !bytes.Equal(audio, pcm) {
+					t.Errorf("speakGemini() = %v, want %v", audio, pcm)
+				}
+			},
+		},
+		{
+			name:   "wav",
+			format: SpeechWAV,
+			check: func(t *testing.T, audio []byte) {
+				if len(audio) != 44+len(pcm) || string(audio[:4]) != "RIFF" || string(audio[8:12]) != "WAVE" {
+					t.Fatalf("speakGemini() = %v, want a WAV file", audio)
+				}
+				if rate := binary.LittleEndian.Uint32(audio[24:28]); rate != 16000 {
+					t.Errorf("sample rate = %d, want 16000", rate)
+				}
+				if !bytes.Equal(audio[44:], pcm) {
+					t.Errorf("samples = %v, want %v", audio[44:], pcm)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := SpeechOptions{Model: "tts-model", Voice: "Kore", Format: tt.format}
+			audio, err := speakGemini(context.Background(), http.DefaultClient, server.URL, "test-key", "hello", options)
+			if err != nil {
+				t.Fatalf("speakGemini() error = %v", err)
+			}
+			tt.check(t, audio)
+		})
+	}
+}
+
+func TestSpeakInvalidOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		options SpeechOptions
+	}{
+		{name: "provider", text: "hi", options: SpeechOptions{Provider: "llama"}},
+		{name: "format", text: "hi", options: SpeechOptions{Provider: Gemini, Format: SpeechMP3}},
+		{name: "empty text", text: " \n", options: SpeechOptions{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Speak(context.Background(), tt.text, tt.options); err == nil {
+				t.Error("Speak() error = nil, want error")
+			}
+		})
+	}
+}
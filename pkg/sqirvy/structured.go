@@ -0,0 +1,256 @@
+// Package sqirvy provides typed queries that return Go values instead of text.
+//
+// QueryInto derives a JSON Schema from the type argument, asks the model for a
+// result through a tool whose parameters are that schema, validates the result
+// and unmarshals it. Results that fail validation are sent back to the model with
+// the validation error so it can correct them.
+package sqirvy
+
+import (
+	"context"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+)
+
+// resultToolName is the name of the tool the model calls to return a typed result.
+const resultToolName = "record_result"
+
+var (
+	timeType          = reflect.TypeFor[time.Time]()
+	rawMessageType    = reflect.TypeFor[json.RawMessage]()
+	textMarshalerType = reflect.TypeFor[encoding.TextMarshaler]()
+)
+
+// QueryInto queries the model for a value of type T, e.g.
+//
+//	type Person struct {
+//		Name string `json:"name"`
+//		Age  int    `json:"age,omitempty" description:"age in years"`
+//	}
+//	person, usage, err := sqirvy.QueryInto[Person](ctx, client, system, prompts, model, options, 2)
+//
+// The result must conform to the schema returned by SchemaFor[T]. Results that do
+// not are retried up to retries times, with the validation error appended to the
+// prompts. Errors of the query itself are not retried. The usage is the total of
+// all attempts.
+func QueryInto[T any](ctx context.Context, client Client, system string, prompts []string, model string, options Options, retries int) (T, Usage, error) {
+	var zero T
+	schema, err := SchemaFor[T]()
+	if err != nil {
+		return zero, Usage{}, err
+	}
+	schemaJSON, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return zero, Usage{}, fmt.Errorf("encoding schema: %w", err)
+	}
+
+	// providers require the tool parameters to be an object, so the schema
+	// is wrapped in a single "data" property
+	tool := Tool{
+		Name:        resultToolName,
+		Description: "Record the result of the request.",
+		Parameters: map[string]any{
+			"type":       "object",
+			"properties": map[string]any{"data": schema},
+			"required":   []any{"data"},
+		},
+	}
+	if system != "" {
+		system += "\n\n"
+	}
+	system += fmt.Sprintf("Return the result by calling the %s tool. The result must conform to this JSON Schema:\n%s", resultToolName, schemaJSON)
+
+	prompts = slices.Clone(prompts)
+	var total Usage
+	var lastErr error
+	for attempt := 0; attempt <= retries; attempt++ {
+		resp, err := client.QueryWithTools(ctx, system, prompts, model, options, []Tool{tool})
+		if err != nil {
+			return zero, total, err
+		}
+		total = total.add(resp.Usage)
+
+		result, err := decodeResult[T](resp, schema)
+		if err == nil {
+			return result, total, nil
+		}
+		lastErr = err
+		slog.Debug("Typed query result rejected", "model", model, "attempt", attempt+1, "error", err)
+
+		// tell the model what was wrong so the next attempt can correct it
+		prompts = append(prompts, fmt.Sprintf("The previous result was rejected: %v. Return the result again and make sure it conforms to the schema.", err))
+	}
+	return zero, total, fmt.Errorf("no valid result after %d attempts: %w", retries+1, lastErr)
+}
+
+// decodeResult extracts the result from a tool call or, for models that answer in
+// text even when a tool is offered, from the response text, and validates it.
+func decodeResult[T any](resp ToolResponse, schema map[string]any) (T, error) {
+	var result T
+	var data any
+	if i := slices.IndexFunc(resp.ToolCalls, func(c ToolCall) bool { return c.Name == resultToolName }); i >= 0 {
+		var args map[string]any
+		if err := json.Unmarshal([]byte(resp.ToolCalls[i].Arguments), &args); err != nil {
+			return result, fmt.Errorf("tool arguments are not valid JSON: %v", err)
+		}
+		data = args["data"]
+	} else if err := json.Unmarshal([]byte(StripCodeFences(resp.Text)), &data); err != nil {
+		return result, fmt.Errorf("response is not valid JSON: %v", err)
+	}
+
+	if err := ValidateJSON(schema, data); err != nil {
+		return result, fmt.Errorf("result does not match schema: %v", err)
+	}
+
+	b, err := json.Marshal(data)
+	if err != nil {
+		return result, err
+	}
+	if err := json.Unmarshal(b, &result); err != nil {
+		return result, fmt.Errorf("result does not fit %T: %v", result, err)
+	}
+	return result, nil
+}
+
+// SchemaFor returns the JSON Schema of the JSON encoding of T.
+// Struct fields follow the encoding/json rules for names, omitted and embedded
+// fields. Fields are required unless they are pointers or tagged omitempty or
+// omitzero, and a description struct tag describes the field to the model.
+// It returns an error for types that have no JSON encoding, such as channels,
+// and for recursive types.
+func SchemaFor[T any]() (map[string]any, error) {
+	return schemaForType(reflect.TypeFor[T](), make(map[reflect.Type]bool))
+}
+
+// schemaForType returns the schema of t. seen holds the struct types being
+// expanded, to detect recursion.
+func schemaForType(t reflect.Type, seen map[reflect.Type]bool) (map[string]any, error) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}, nil
+	case t == rawMessageType:
+		return map[string]any{}, nil
+	case t.Implements(textMarshalerType) || reflect.PointerTo(t).Implements(textMarshalerType):
+		return map[string]any{"type": "string"}, nil
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}, nil
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}, nil
+	case reflect.String:
+		return map[string]any{"type": "string"}, nil
+	case reflect.Interface:
+		return map[string]any{}, nil
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// byte slices are encoded as base64 strings
+			return map[string]any{"type": "string"}, nil
+		}
+		items, err := schemaForType(t.Elem(), seen)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"type": "array", "items": items}, nil
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("unsupported map key type %s", t.Key())
+		}
+		values, err := schemaForType(t.Elem(), seen)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"type": "object", "additionalProperties": values}, nil
+	case reflect.Struct:
+		return structSchema(t, seen)
+	}
+	return nil, fmt.Errorf("unsupported type %s", t)
+}
+
+// structSchema returns the schema of a struct type.
+func structSchema(t reflect.Type, seen map[reflect.Type]bool) (map[string]any, error) {
+	if seen[t] {
+		return nil, fmt.Errorf("recursive type %s", t)
+	}
+	seen[t] = true
+	defer delete(seen, t)
+
+	properties := make(map[string]any)
+	var required []any
+	if err := addStructFields(t, seen, properties, &required); err != nil {
+		return nil, err
+	}
+	schema := map[string]any{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema, nil
+}
+
+// addStructFields adds the fields of a struct type to properties, flattening
+// embedded structs without a JSON name.
+func addStructFields(t reflect.Type, seen map[reflect.Type]bool, properties map[string]any, required *[]any) error {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+
+		fieldType := field.Type
+		for fieldType.Kind() == reflect.Pointer {
+			fieldType = fieldType.Elem()
+		}
+		if field.Anonymous && name == "" && fieldType.Kind() == reflect.Struct {
+			if err := addStructFields(fieldType, seen, properties, required); err != nil {
+				return err
+			}
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		schema, err := schemaForType(field.Type, seen)
+		if err != nil {
+			return fmt.Errorf("field %s: %w", field.Name, err)
+		}
+		if description := field.Tag.Get("description"); description != "" {
+			schema["description"] = description
+		}
+		properties[name] = schema
+
+		optional := field.Type.Kind() == reflect.Pointer
+		for _, opt := range strings.Split(opts, ",") {
+			if opt == "omitempty" || opt == "omitzero" {
+				optional = true
+			}
+		}
+		if !optional {
+			*required = append(*required, name)
+		}
+	}
+	return nil
+}
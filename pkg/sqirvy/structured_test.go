@@ -0,0 +1,169 @@
+package sqirvy
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type testAddress struct {
+	City string `json:"city"`
+}
+
+type testBase struct {
+	ID int `json:"id"`
+}
+
+type testPerson struct {
+	testBase
+	Name     string            `json:"name" description:"full name"`
+	Age      int               `json:"age,omitempty"`
+	Emails   []string          `json:"emails"`
+	Address  *testAddress      `json:"address"`
+	Born     time.Time         `json:"born,omitzero"`
+	Tags     map[string]string `json:"tags,omitempty"`
+	Internal string            `json:"-"`
+	secret   string
+}
+
+type testNode struct {
+	Children []testNode `json:"children"`
+}
+
+func TestSchemaFor(t *testing.T) {
+	tests := []struct {
+		name    string
+		schema  func() (map[string]any, error)
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "string",
+			schema: SchemaFor[string],
+			want:   `{"type":"string"}`,
+		},
+		{
+			name:   "slice",
+			schema: SchemaFor[[]float64],
+			want:   `{"items":{"type":"number"},"type":"array"}`,
+		},
+		{
+			name:   "bytes",
+			schema: SchemaFor[[]byte],
+			want:   `{"type":"string"}`,
+		},
+		{
+			name:   "struct",
+			schema: SchemaFor[testPerson],
+			want: `{"additionalProperties":false,"properties":{` +
+				`"address":{"additionalProperties":false,"properties":{"city":{"type":"string"}},"required":["city"],"type":"object"},` +
+				`"age":{"type":"integer"},` +
+				`"born":{"format":"date-time","type":"string"},` +
+				`"emails":{"items":{"type":"string"},"type":"array"},` +
+				`"id":{"type":"integer"},` +
+				`"name":{"description":"full name","type":"string"},` +
+				`"tags":{"additionalProperties":{"type":"string"},"type":"object"}},` +
+				`"required":["id","name","emails"],"type":"object"}`,
+		},
+		{
+			name:    "recursive",
+			schema:  SchemaFor[testNode],
+			wantErr: true,
+		},
+		{
+			name:    "channel",
+			schema:  SchemaFor[chan int],
+			wantErr: true,
+		},
+		{
+			name:    "int map keys",
+			schema:  SchemaFor[map[int]string],
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schema, err := tt.schema()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SchemaFor() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			got, _ := json.Marshal(schema)
+			if string(got) != tt.want {
+				t.Errorf("SchemaFor() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryInto(t *testing.T) {
+	defer SetMockResponse("")
+
+	type result struct {
+		Name string `json:"name"`
+		Age  int    `json:"age"`
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		retries  int
+		want     result
+		wantErr  bool
+	}{
+		{
+			name:     "tool call",
+			template: `{"data": {"name": "{{.Prompt}}", "age": 36}}`,
+			want:     result{Name: "ada", Age: 36},
+		},
+		{
+			name:     "retry after invalid result",
+			template: `{{if eq (len .Prompts) 1}}{"data": {"name": "ada"}}{{else}}{"data": {"name": "ada", "age": 36}}{{end}}`,
+			retries:  1,
+			want:     result{Name: "ada", Age: 36},
+		},
+		{
+			name:     "no retries left",
+			template: `{"data": {"name": "ada"}}`,
+			retries:  1,
+			wantErr:  true,
+		},
+		{
+			name:     "text response in code fence",
+			template: "```json\n{\"name\": \"ada\", \"age\": 36}\n```",
+			want:     result{Name: "ada", Age: 36},
+		},
+		{
+			name:     "not JSON",
+			template: "Ada is 36",
+			wantErr:  true,
+		},
+	}
+
+	client, _ := NewMockClient()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := SetMockResponse(tt.template); err != nil {
+				t.Fatal(err)
+			}
+			got, usage, err := QueryInto[result](context.Background(), client, "", []string{"ada"}, "mock", Options{}, tt.retries)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("QueryInto() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("QueryInto() = %+v, want %+v", got, tt.want)
+			}
+			if usage.InputTokens == 0 {
+				t.Errorf("QueryInto() usage = %+v, want nonzero input tokens", usage)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+// Package sqirvy provides the request timeouts of provider clients.
+//
+// A single deadline does not fit all models: a slow model that streams a long
+// response needs minutes, while an unreachable endpoint should fail within
+// seconds. Timeouts therefore limits connecting, the TLS handshake, waiting for
+// the response headers and the whole request separately. NewClientWithConfig
+// takes them from the Config; SetProviderTimeouts sets them for the clients of
+// a provider created with NewClient.
+package sqirvy
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Timeouts limits the phases of a provider request. Zero fields keep the
+// transport defaults, which limit connecting to 30 seconds and the TLS
+// handshake to 10 seconds and do not limit the rest.
+type Timeouts struct {
+	Dial           time.Duration // establishing the TCP connection
+	TLSHandshake   time.Duration // the TLS handshake
+	ResponseHeader time.Duration // waiting for the response headers after sending the request
+	Total          time.Duration // the whole request, including reading the response body
+}
+
+// validate returns an error if a timeout is negative.
+func (t Timeouts) validate() error {
+	if t.Dial < 0 || t.TLSHandshake < 0 || t.ResponseHeader < 0 || t.Total < 0 {
+		return fmt.Errorf("timeouts must not be negative")
+	}
+	return nil
+}
+
+// connectionTimeouts returns the timeouts that are set on the transport, which
+// are all but the total.
+func (t Timeouts) connectionTimeouts() Timeouts {
+	t.Total = 0
+	return t
+}
+
+// providerTimeouts holds the timeouts set with SetProviderTimeouts.
+var providerTimeouts = make(map[string]Timeouts)
+
+// SetProviderTimeouts sets the timeouts of clients of the provider created
+// afterwards with NewClient. Zero timeouts remove the setting.
+func SetProviderTimeouts(provider string, timeouts Timeouts) error {
+	if !isProvider(provider) {
+		return fmt.Errorf("unsupported provider: %s", provider)
+	}
+	if err := timeouts.validate(); err != nil {
+		return fmt.Errorf("provider %s: %w", provider, err)
+	}
+	if timeouts == (Timeouts{}) {
+		delete(providerTimeouts, provider)
+		return nil
+	}
+	providerTimeouts[provider] = timeouts
+	return nil
+}
+
+// timedTransportKey identifies a transport with connection timeouts.
+type timedTransportKey struct {
+	base     *http.Transport
+	timeouts Timeouts
+}
+
+var (
+	timedTransportsMu sync.Mutex
+	timedTransports   = make(map[timedTransportKey]*http.Transport)
+)
+
+// withConnectionTimeouts returns base with the connection timeouts applied.
+// Clients with the same base and timeouts share one transport, so that they
+// share its connections. Transports other than *http.Transport are returned
+// unchanged, since their connections are not under our control.
+func withConnectionTimeouts(base http.RoundTripper, timeouts Timeouts) http.RoundTripper {
+	timeouts = timeouts.connectionTimeouts()
+	t, ok := base.(*http.Transport)
+	if !ok || timeouts == (Timeouts{}) {
+		return base
+	}
+
+	timedTransportsMu.Lock()
+	defer timedTransportsMu.Unlock()
+	key := timedTransportKey{base: t, timeouts: timeouts}
+	if timed, ok := timedTransports[key]; ok {
+		return timed
+	}
+	timed := t.Clone()
+	if timeouts.Dial > 0 {
+		dialer := &net.Dialer{Timeout: timeouts.Dial, KeepAlive: 30 * time.Second}
+		timed.DialContext = dialer.DialContext
+	}
+	if timeouts.TLSHandshake > 0 {
+		timed.TLSHandshakeTimeout = timeouts.TLSHandshake
+	}
+	if timeouts.ResponseHeader > 0 {
+		timed.ResponseHeaderTimeout = timeouts.ResponseHeader
+	}
+	timedTransports[key] = timed
+	return timed
+}
@@ -0,0 +1,97 @@
+package sqirvy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTimeoutsResponseHeader(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		timeouts Timeouts
+		wantErr  bool
+	}{
+		{name: "no timeouts", wantErr: false},
+		{name: "long response header timeout", timeouts: Timeouts{ResponseHeader: 5 * time.Second}, wantErr: false},
+		{name: "short response header timeout", timeouts: Timeouts{ResponseHeader: 20 * time.Millisecond}, wantErr: true},
+		{name: "short total timeout", timeouts: Timeouts{Total: 20 * time.Millisecond}, wantErr: true},
+		{name: "dial timeout only", timeouts: Timeouts{Dial: 5 * time.Second}, wantErr: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := Config{Timeouts: tt.timeouts}.apiHTTPClient(OpenAI)
+			resp, err := client.Get(server.URL)
+			if err == nil {
+				resp.Body.Close()
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Get() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWithConnectionTimeouts(t *testing.T) {
+	timeouts := Timeouts{Dial: time.Second, TLSHandshake: 2 * time.Second, ResponseHeader: 3 * time.Second, Total: time.Minute}
+
+	timed, ok := withConnectionTimeouts(defaultTransport, timeouts).(*http.Transport)
+	if !ok || timed == defaultTransport {
+		t.Fatalf("withConnectionTimeouts() = %v, want a new transport", timed)
+	}
+	if timed.TLSHandshakeTimeout != 2*time.Second || timed.ResponseHeaderTimeout != 3*time.Second {
+		t.Errorf("TLSHandshakeTimeout = %v, ResponseHeaderTimeout = %v, want 2s and 3s", timed.TLSHandshakeTimeout, timed.ResponseHeaderTimeout)
+	}
+	if defaultTransport.ResponseHeaderTimeout != 0 {
+		t.Error("withConnectionTimeouts() modified the base transport")
+	}
+
+	// clients with the same timeouts share the connections of one transport,
+	// the total timeout is set on the client and does not need a transport of its own
+	if again := withConnectionTimeouts(defaultTransport, Timeouts{Dial: time.Second, TLSHandshake: 2 * time.Second, ResponseHeader: 3 * time.Second}); again != timed {
+		t.Error("withConnectionTimeouts() returned a new transport for the same timeouts")
+	}
+	if base := withConnectionTimeouts(defaultTransport, Timeouts{Total: time.Minute}); base != http.RoundTripper(defaultTransport) {
+		t.Error("withConnectionTimeouts() replaced the transport for a total timeout")
+	}
+}
+
+func TestSetProviderTimeouts(t *testing.T) {
+	defer delete(providerTimeouts, Anthropic)
+
+	tests := []struct {
+		name     string
+		provider string
+		timeouts Timeouts
+		wantErr  bool
+	}{
+		{name: "valid", provider: Anthropic, timeouts: Timeouts{Dial: time.Second, Total: time.Minute}},
+		{name: "unknown provider", provider: "no-such-provider", timeouts: Timeouts{Dial: time.Second}, wantErr: true},
+		{name: "negative timeout", provider: Anthropic, timeouts: Timeouts{ResponseHeader: -time.Second}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := SetProviderTimeouts(tt.provider, tt.timeouts)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("SetProviderTimeouts() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if c := providerHTTPClient(Anthropic); c == nil || c.Timeout != time.Minute {
+		t.Errorf("providerHTTPClient() = %v, want a client with a total timeout of 1m", c)
+	}
+	if err := SetProviderTimeouts(Anthropic, Timeouts{}); err != nil {
+		t.Fatalf("SetProviderTimeouts() error = %v", err)
+	}
+	if c := providerHTTPClient(Anthropic); c != nil {
+		t.Errorf("providerHTTPClient() = %v after clearing the timeouts, want nil", c)
+	}
+}
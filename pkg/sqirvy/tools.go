@@ -0,0 +1,189 @@
+// Package sqirvy provides tool (function) calling support for AI language models.
+//
+// This file defines the provider-neutral tool types and the shared implementation
+// used by each client's QueryWithTools method. Each provider maps these
+// definitions onto OpenAI tools, Anthropic tool_use blocks or Gemini function
+// declarations, and the results of the calls, sent back with
+// QueryMessagesWithTools, onto OpenAI tool messages, Anthropic tool_result blocks
+// or Gemini function responses.
+package sqirvy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// Tool describes a function that the model may ask the caller to invoke.
+type Tool struct {
+	Name        string         // Function name exposed to the model
+	Description string         // What the function does and when to use it
+	Parameters  map[string]any // JSON Schema describing the function arguments
+}
+
+// ToolCall is a request from the model to invoke one of the supplied tools.
+type ToolCall struct {
+	ID        string // Provider-assigned identifier for the call
+	Name      string // Name of the tool to invoke
+	Arguments string // JSON encoded arguments for the tool
+}
+
+// ToolResponse holds the result of a tool-enabled query. A model may return
+// text, tool calls, or both.
+type ToolResponse struct {
+	Text      string
+	ToolCalls []ToolCall
+	Usage     Usage // Token usage reported by the provider
+}
+
+// ToolMessagesClient is implemented by clients that continue a conversation with
+// the results of the tool calls requested by the model.
+type ToolMessagesClient interface {
+	QueryMessagesWithTools(ctx context.Context, messages []Message, model string, options Options, tools []Tool) (ToolResponse, error)
+}
+
+// QueryMessagesWithTools sends a conversation with tool definitions, e.g. the
+// prompt, the assistant message with the tool calls of a ToolResponse and a
+// RoleTool message with the result of each call, and returns the next response of
+// the model, which may call the tools again. It is an error if the client cannot
+// send tool results.
+func QueryMessagesWithTools(ctx context.Context, client Client, messages []Message, model string, options Options, tools []Tool) (ToolResponse, error) {
+	c, ok := client.(ToolMessagesClient)
+	if !ok {
+		return ToolResponse{}, fmt.Errorf("tool results are not supported by the client of model %s", model)
+	}
+	return c.QueryMessagesWithTools(ctx, messages, model, options, tools)
+}
+
+// validateTools checks that the tool definitions are usable by every provider.
+func validateTools(tools []Tool) error {
+	if len(tools) == 0 {
+		return fmt.Errorf("tools cannot be empty for tool query")
+	}
+	seen := make(map[string]bool)
+	for _, tool := range tools {
+		if tool.Name == "" {
+			return fmt.Errorf("tool name cannot be empty")
+		}
+		if seen[tool.Name] {
+			return fmt.Errorf("duplicate tool name: %s", tool.Name)
+		}
+		seen[tool.Name] = true
+	}
+	return nil
+}
+
+// validateToolMessages checks that a conversation with tool calls can be sent:
+// each tool result answers a call of an earlier assistant message.
+func validateToolMessages(messages []Message) error {
+	hasUser := false
+	calls := make(map[string]bool)
+	for i, m := range messages {
+		switch m.Role {
+		case RoleSystem:
+		case RoleUser:
+			hasUser = true
+		case RoleAssistant:
+			for _, call := range m.ToolCalls {
+				if call.ID == "" || call.Name == "" {
+					return fmt.Errorf("tool call of message %d has no ID or name", i+1)
+				}
+				calls[call.ID] = true
+			}
+		case RoleTool:
+			if !calls[m.ToolCallID] {
+				return fmt.Errorf("tool result of message %d does not answer a tool call of an earlier message: %q", i+1, m.ToolCallID)
+			}
+		default:
+			return fmt.Errorf("unknown message role: %q", m.Role)
+		}
+		if len(m.ToolCalls) > 0 && m.Role != RoleAssistant {
+			return fmt.Errorf("tool calls of message %d must be in an assistant message", i+1)
+		}
+	}
+	if !hasUser {
+		return fmt.Errorf("messages must include a user message")
+	}
+	return nil
+}
+
+// toolCallNames returns the tool names of the calls of a conversation by ID, for
+// providers that name the function of a result.
+func toolCallNames(messages []Message) map[string]string {
+	names := make(map[string]string)
+	for _, m := range messages {
+		for _, call := range m.ToolCalls {
+			names[call.ID] = call.Name
+		}
+	}
+	return names
+}
+
+// toolArguments returns the JSON arguments of a tool call, an empty object if none.
+func toolArguments(call ToolCall) json.RawMessage {
+	if call.Arguments == "" {
+		return json.RawMessage("{}")
+	}
+	return json.RawMessage(call.Arguments)
+}
+
+// toolParameters returns the JSON Schema of the tool arguments. Providers require
+// an object schema even for functions without arguments.
+func toolParameters(tool Tool) map[string]any {
+	if tool.Parameters == nil {
+		return map[string]any{"type": "object", "properties": map[string]any{}}
+	}
+	return tool.Parameters
+}
+
+func queryWithTools(ctx context.Context, api backend, system string, prompts []string, model string, options Options, tools []Tool) (ToolResponse, error) {
+	if ctx.Err() != nil {
+		return ToolResponse{}, fmt.Errorf("request context error %w", ctx.Err())
+	}
+
+	if len(prompts) == 0 {
+		return ToolResponse{}, fmt.Errorf("prompts cannot be empty for tool query")
+	}
+
+	return queryMessagesWithTools(ctx, api, promptMessages(system, prompts), model, options, tools)
+}
+
+func queryMessagesWithTools(ctx context.Context, api backend, messages []Message, model string, options Options, tools []Tool) (ToolResponse, error) {
+	if ctx.Err() != nil {
+		return ToolResponse{}, fmt.Errorf("request context error %w", ctx.Err())
+	}
+
+	if err := validateToolMessages(messages); err != nil {
+		return ToolResponse{}, err
+	}
+
+	if err := validateTools(tools); err != nil {
+		return ToolResponse{}, err
+	}
+
+	if err := CheckCapability(model, CapabilityTools); err != nil {
+		return ToolResponse{}, err
+	}
+
+	if err := validateTemperature(options.Temperature); err != nil {
+		return ToolResponse{}, err
+	}
+
+	if err := validateStop(options.Stop); err != nil {
+		return ToolResponse{}, err
+	}
+
+	resp, err := generate(ctx, api, chatRequest{
+		Model:       model,
+		Messages:    messages,
+		Temperature: nativeTemperature(model, options.Temperature),
+		MaxTokens:   options.MaxTokens,
+		Tools:       tools,
+		Stop:        options.Stop,
+		Seed:        options.Seed,
+	})
+	if err != nil {
+		return ToolResponse{}, err
+	}
+	return ToolResponse{Text: resp.Text, ToolCalls: resp.ToolCalls, Usage: resp.Usage}, nil
+}
@@ -0,0 +1,170 @@
+package sqirvy
+
+import (
+	"context"
+	"testing"
+)
+
+func TestValidateTools(t *testing.T) {
+	tests := []struct {
+		name    string
+		tools   []Tool
+		wantErr bool
+	}{
+		{
+			name:    "Valid tools",
+			tools:   []Tool{{Name: "get_weather"}, {Name: "get_time"}},
+			wantErr: false,
+		},
+		{
+			name:    "Empty tools",
+			tools:   []Tool{},
+			wantErr: true,
+		},
+		{
+			name:    "Missing name",
+			tools:   []Tool{{Description: "no name"}},
+			wantErr: true,
+		},
+		{
+			name:    "Duplicate name",
+			tools:   []Tool{{Name: "get_weather"}, {Name: "get_weather"}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateTools(tt.tools)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateTools() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestToolParameters(t *testing.T) {
+	params := map[string]any{
+		"type":       "object",
+		"properties": map[string]any{"city": map[string]any{"type": "string"}},
+	}
+	if got := toolParameters(Tool{Name: "get_weather", Parameters: params}); got["properties"] == nil {
+		t.Errorf("toolParameters() = %v, want the tool parameters", got)
+	}
+	if got := toolParameters(Tool{Name: "get_time"}); got["type"] != "object" {
+		t.Errorf("toolParameters() = %v, want an empty object schema", got)
+	}
+}
+
+// toolConversationTools are the tools of toolConversation.
+var toolConversationTools = []Tool{{Name: "get_weather", Description: "weather", Parameters: map[string]any{"type": "object"}}}
+
+// toolConversation returns a conversation that sends back the result of a tool
+// call, for the tests of the requests of each provider.
+func toolConversation(callID, result string) []Message {
+	return []Message{
+		{Role: RoleSystem, Content: "be brief"},
+		{Role: RoleUser, Content: "weather in Paris?"},
+		{Role: RoleAssistant, Content: "Checking.", ToolCalls: []ToolCall{{ID: callID, Name: "get_weather", Arguments: `{"city": "Paris"}`}}},
+		{Role: RoleTool, ToolCallID: callID, Content: result},
+	}
+}
+
+func TestValidateToolMessages(t *testing.T) {
+	call := ToolCall{ID: "call_1", Name: "get_weather"}
+	tests := []struct {
+		name     string
+		messages []Message
+		wantErr  bool
+	}{
+		{
+			name:     "Result of a call",
+			messages: toolConversation("call_1", "sunny"),
+		},
+		{
+			name:     "No tool calls",
+			messages: []Message{{Role: RoleUser, Content: "hi"}},
+		},
+		{
+			name: "Result of an unknown call",
+			messages: []Message{
+				{Role: RoleUser, Content: "hi"},
+				{Role: RoleAssistant, ToolCalls: []ToolCall{call}},
+				{Role: RoleTool, ToolCallID: "call_2", Content: "sunny"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Result before the call",
+			messages: []Message{
+				{Role: RoleUser, Content: "hi"},
+				{Role: RoleTool, ToolCallID: "call_1", Content: "sunny"},
+				{Role: RoleAssistant, ToolCalls: []ToolCall{call}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Call without an ID",
+			messages: []Message{
+				{Role: RoleUser, Content: "hi"},
+				{Role: RoleAssistant, ToolCalls: []ToolCall{{Name: "get_weather"}}},
+			},
+			wantErr: true,
+		},
+		{
+			name:     "Calls in a user message",
+			messages: []Message{{Role: RoleUser, Content: "hi", ToolCalls: []ToolCall{call}}},
+			wantErr:  true,
+		},
+		{
+			name:     "No user message",
+			messages: []Message{{Role: RoleAssistant, ToolCalls: []ToolCall{call}}, {Role: RoleTool, ToolCallID: "call_1"}},
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateToolMessages(tt.messages)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateToolMessages() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestQueryMessagesWithToolsRoundTrip(t *testing.T) {
+	defer SetMockResponse("")
+	client, _ := NewMockClient()
+	// the mock calls the tool with the city, then answers with the result of the call
+	if err := SetMockResponse(`{{if .ToolResults}}{{index .ToolResults 0}} in {{.Prompt}}{{else}}{"city": "{{.Prompt}}"}{{end}}`); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	messages := []Message{{Role: RoleUser, Content: "Paris"}}
+	resp, err := QueryMessagesWithTools(ctx, client, messages, "mock", Options{}, toolConversationTools)
+	if err != nil {
+		t.Fatalf("QueryMessagesWithTools() error = %v", err)
+	}
+	if len(resp.ToolCalls) != 1 || resp.ToolCalls[0].Arguments != `{"city": "Paris"}` {
+		t.Fatalf("QueryMessagesWithTools() = %+v, want a call to get_weather", resp)
+	}
+
+	messages = append(messages, Message{Role: RoleAssistant, Content: resp.Text, ToolCalls: resp.ToolCalls})
+	for _, call := range resp.ToolCalls {
+		messages = append(messages, Message{Role: RoleTool, ToolCallID: call.ID, Content: "sunny"})
+	}
+	resp, err = QueryMessagesWithTools(ctx, client, messages, "mock", Options{}, toolConversationTools)
+	if err != nil {
+		t.Fatalf("QueryMessagesWithTools() with the result error = %v", err)
+	}
+	if resp.Text != "sunny in Paris" || len(resp.ToolCalls) != 0 {
+		t.Errorf("QueryMessagesWithTools() with the result = %+v, want the answer", resp)
+	}
+
+	// tool results are refused without the tools
+	if _, _, err := client.QueryMessages(ctx, messages, "mock", Options{}); err == nil {
+		t.Error("QueryMessages() with a tool result succeeded")
+	}
+}
@@ -0,0 +1,181 @@
+// Package sqirvy provides audio transcription with Whisper-compatible APIs.
+//
+// Transcribe sends an audio file to the /audio/transcriptions endpoint of OpenAI,
+// Groq or a local Whisper server with an OpenAI-compatible API, e.g. whisper.cpp
+// or faster-whisper-server, and returns the transcript as text or as SRT or WebVTT
+// subtitles.
+package sqirvy
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Transcription providers, in addition to OpenAI
+const (
+	TranscriptionGroq  = "groq"  // Groq, with GROQ_API_KEY and GROQ_BASE_URL
+	TranscriptionLocal = "local" // a local Whisper server at WHISPER_BASE_URL
+)
+
+// Transcript formats
+const (
+	TranscriptText = "text" // plain text
+	TranscriptSRT  = "srt"  // SubRip subtitles, with timestamps
+	TranscriptVTT  = "vtt"  // WebVTT subtitles, with timestamps
+)
+
+// MaxAudioBytes is the largest audio file accepted by the transcription APIs.
+const MaxAudioBytes = 25 * 1024 * 1024
+
+// groqDefaultBaseURL is the OpenAI-compatible endpoint of Groq.
+const groqDefaultBaseURL = "https://api.groq.com/openai/v1"
+
+// default transcription models of the providers
+var transcriptionModels = map[string]string{
+	OpenAI:             "whisper-1",
+	TranscriptionGroq:  "whisper-large-v3-turbo",
+	TranscriptionLocal: "whisper-1",
+}
+
+// TranscriptionOptions configure Transcribe. The zero value transcribes with the
+// OpenAI whisper-1 model to plain text.
+type TranscriptionOptions struct {
+	Provider string // openai (default), groq or local
+	Model    string // model of the provider, empty for its default
+	Language string // ISO-639-1 language of the audio, e.g. "en", empty to detect it
+	Format   string // text (default), srt or vtt
+	Prompt   string // text that guides the spelling and style of the transcript
+}
+
+// IsAudioFile reports whether the extension of path is an audio format accepted by
+// the transcription APIs.
+func IsAudioFile(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".flac", ".m4a", ".mp3", ".mp4", ".mpeg", ".mpga", ".oga", ".ogg", ".wav", ".webm":
+		return true
+	}
+	return false
+}
+
+// TranscribeFile transcribes an audio file.
+func TranscribeFile(ctx context.Context, path string, options TranscriptionOptions) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if info.Size() > MaxAudioBytes {
+		return "", fmt.Errorf("audio file %s is larger than %d MB", path, MaxAudioBytes/1024/1024)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return Transcribe(ctx, f, filepath.Base(path), options)
+}
+
+// Transcribe transcribes audio read from r. The name of the file tells the API its
+// format, e.g. "meeting.mp3". OpenAI uses the same API key and base URL environment
+// variables as the OpenAI client, Groq uses GROQ_API_KEY and GROQ_BASE_URL, and a
+// local server uses WHISPER_BASE_URL and, if it requires one, WHISPER_API_KEY.
+func Transcribe(ctx context.Context, r io.Reader, name string, options TranscriptionOptions) (string, error) {
+	if options.Provider == "" {
+		options.Provider = OpenAI
+	}
+	if options.Format == "" {
+		options.Format = TranscriptText
+	}
+	switch options.Format {
+	case TranscriptText, TranscriptSRT, TranscriptVTT:
+	default:
+		return "", fmt.Errorf("unsupported transcript format %q (use text, srt or vtt)", options.Format)
+	}
+
+	baseURL, apiKey, err := transcriptionEndpoint(options.Provider)
+	if err != nil {
+		return "", err
+	}
+	if options.Model == "" {
+		options.Model = transcriptionModels[options.Provider]
+	}
+	text, err := transcribeOpenAI(ctx, apiHTTPClient(options.Provider), baseURL, apiKey, r, name, options)
+	if err != nil {
+		return "", fmt.Errorf("transcription failed: %w", err)
+	}
+	return text, nil
+}
+
+// transcriptionEndpoint returns the base URL and API key of a transcription provider.
+func transcriptionEndpoint(provider string) (baseURL string, apiKey string, err error) {
+	switch provider {
+	case OpenAI:
+		return providerEndpoint(OpenAI)
+	case TranscriptionGroq:
+		apiKey = os.Getenv("GROQ_API_KEY")
+		if apiKey == "" {
+			return "", "", fmt.Errorf("GROQ_API_KEY environment variable not set")
+		}
+		return envOrDefault("GROQ_BASE_URL", groqDefaultBaseURL), apiKey, nil
+	case TranscriptionLocal:
+		baseURL = os.Getenv("WHISPER_BASE_URL")
+		if baseURL == "" {
+			return "", "", fmt.Errorf("WHISPER_BASE_URL environment variable not set")
+		}
+		return baseURL, os.Getenv("WHISPER_API_KEY"), nil
+	default:
+		return "", "", fmt.Errorf("unsupported transcription provider %q (use openai, groq or local)", provider)
+	}
+}
+
+// transcribeOpenAI posts the audio to the /audio/transcriptions endpoint of an
+// OpenAI-compatible API and returns the transcript in the requested format.
+func transcribeOpenAI(ctx context.Context, client *http.Client, baseURL, apiKey string, r io.Reader, name string, options TranscriptionOptions) (string, error) {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	fields := map[string]string{
+		"model":           options.Model,
+		"response_format": options.Format,
+		"language":        options.Language,
+		"prompt":          options.Prompt,
+	}
+	for k, v := range fields {
+		if v == "" {
+			continue
+		}
+		if err := w.WriteField(k, v); err != nil {
+			return "", err
+		}
+	}
+	part, err := w.CreateFormFile("file", name)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(part, r); err != nil {
+		return "", fmt.Errorf("reading audio: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+
+	headers := map[string]string{"Content-Type": w.FormDataContentType()}
+	if apiKey != "" {
+		headers["Authorization"] = "Bearer " + apiKey
+	}
+	resp, err := doRequest(ctx, client, http.MethodPost, strings.TrimSuffix(baseURL, "/")+"/audio/transcriptions", headers, &body)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	text, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("invalid response: %w", err)
+	}
+	return strings.TrimSpace(string(text)), nil
+}
@@ -0,0 +1,101 @@
+package sqirvy
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTranscribeOpenAI(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/audio/transcriptions" || r.Header.Get("Authorization") != "Bearer test-key" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		file, header, err := r.FormFile("file")
+		if err != nil || header.Filename != "talk.mp3" {
+			http.Error(w, "bad file", http.StatusBadRequest)
+			return
+		}
+		audio, _ := io.ReadAll(file)
+		if string(audio) != "ID3 audio" || r.FormValue("model") != "whisper-1" {
+			http.Error(w, "bad body", http.StatusBadRequest)
+			return
+		}
+		switch r.FormValue("response_format") {
+		case TranscriptSRT:
+			w.Write([]byte("1\n00:00:00,000 --> 00:00:01,500\nHello there.\n\n"))
+		default:
+			w.Write([]byte("Hello there.\n"))
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		format  string
+		baseURL string
+		want    string
+		wantErr bool
+	}{
+		{name: "text", format: TranscriptText, want: "Hello there."},
+		{name: "srt", format: TranscriptSRT, want: "1\n00:00:00,000 --> 00:00:01,500\nHello there."},
+		{name: "http error", format: TranscriptText, baseURL: server.URL + "/other", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			baseURL := tt.baseURL
+			if baseURL == "" {
+				baseURL = server.URL + "/v1/"
+			}
+			options := TranscriptionOptions{Model: "whisper-1", Format: tt.format}
+			got, err := transcribeOpenAI(context.Background(), http.DefaultClient, baseURL, "test-key", strings.NewReader("ID3 audio"), "talk.mp3", options)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("transcribeOpenAI() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("transcribeOpenAI() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTranscribeInvalidOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		options TranscriptionOptions
+	}{
+		{name: "format", options: TranscriptionOptions{Format: "docx"}},
+		{name: "provider", options: TranscriptionOptions{Provider: "acme"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Transcribe(context.Background(), strings.NewReader(""), "a.mp3", tt.options); err == nil {
+				t.Errorf("Transcribe() error = nil, want error")
+			}
+		})
+	}
+}
+
+func TestIsAudioFile(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"meeting.mp3", true},
+		{"notes/Standup.WAV", true},
+		{"talk.m4a", true},
+		{"main.go", false},
+		{"mp3", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := IsAudioFile(tt.path); got != tt.want {
+				t.Errorf("IsAudioFile(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
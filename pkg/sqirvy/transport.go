@@ -0,0 +1,261 @@
+// Package sqirvy provides HTTP transport configuration for AI providers.
+//
+// By default provider requests use the Go default transport, which honors the
+// HTTPS_PROXY, HTTP_PROXY and NO_PROXY environment variables. SetHTTPConfig adds
+// an explicit proxy, a custom CA bundle for networks with TLS interception, and a
+// client certificate for mutual TLS. The configured transport is used by all
+// provider clients and by the direct API requests for model discovery and
+// credential validation.
+//
+// All clients share one transport, so connections to a provider are kept alive
+// and reused across clients and queries. Unlike the Go default, which keeps two
+// idle connections per host, it keeps enough for concurrent batch requests;
+// HTTPConfig tunes the pool and can turn off HTTP/2.
+package sqirvy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// HTTPConfig configures the HTTP transport used for provider requests.
+// Empty fields keep the default behavior.
+type HTTPConfig struct {
+	Proxy    string // proxy URL, overrides HTTPS_PROXY and HTTP_PROXY
+	CAFile   string // PEM file with CA certificates trusted in addition to the system roots
+	CertFile string // PEM client certificate for mutual TLS
+	KeyFile  string // PEM private key of the client certificate
+
+	MaxIdleConnsPerHost int           // idle connections kept per host, 0 for 16
+	IdleConnTimeout     time.Duration // time an idle connection is kept, 0 for 90 seconds
+	DisableHTTP2        bool          // use HTTP/1.1 only, e.g. for proxies that break HTTP/2
+}
+
+const (
+	// defaultMaxIdleConnsPerHost is the idle connection limit per host of the shared transport.
+	defaultMaxIdleConnsPerHost = 16
+
+	// defaultIdleConnTimeout is the time the shared transport keeps an idle connection.
+	defaultIdleConnTimeout = 90 * time.Second
+)
+
+var (
+	// transport is the configured transport, or nil to use defaultTransport.
+	transport http.RoundTripper
+
+	// defaultTransport is the transport shared by all clients without configuration.
+	defaultTransport = tuneTransport(http.DefaultTransport.(*http.Transport).Clone(), HTTPConfig{})
+
+	// defaultClient sends direct API requests through defaultTransport.
+	defaultClient = &http.Client{Transport: defaultTransport}
+)
+
+// providerHeaders holds extra headers sent with every request to a provider.
+var providerHeaders = make(map[string]map[string]string)
+
+// SetHTTPConfig configures the HTTP transport for clients created afterwards.
+// It returns an error if the proxy URL or a certificate file is invalid.
+func SetHTTPConfig(cfg HTTPConfig) error {
+	if cfg == (HTTPConfig{}) {
+		transport = nil
+		return nil
+	}
+	t, err := newTransport(cfg)
+	if err != nil {
+		return err
+	}
+	transport = t
+	return nil
+}
+
+// newTransport builds a transport from the configuration.
+func newTransport(cfg HTTPConfig) (*http.Transport, error) {
+	if cfg.MaxIdleConnsPerHost < 0 || cfg.IdleConnTimeout < 0 {
+		return nil, fmt.Errorf("connection pool settings must not be negative")
+	}
+	t := tuneTransport(http.DefaultTransport.(*http.Transport).Clone(), cfg)
+
+	if cfg.Proxy != "" {
+		proxyURL, err := url.Parse(cfg.Proxy)
+		if err != nil || proxyURL.Host == "" {
+			return nil, fmt.Errorf("invalid proxy URL: %s", cfg.Proxy)
+		}
+		t.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	if cfg.CAFile == "" && cfg.CertFile == "" && cfg.KeyFile == "" {
+		return t, nil
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading CA file: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		if cfg.CertFile == "" || cfg.KeyFile == "" {
+			return nil, fmt.Errorf("a client certificate requires both a certificate file and a key file")
+		}
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	t.TLSClientConfig = tlsConfig
+	return t, nil
+}
+
+// tuneTransport applies the connection pool and HTTP/2 settings to t.
+func tuneTransport(t *http.Transport, cfg HTTPConfig) *http.Transport {
+	t.MaxIdleConnsPerHost = defaultMaxIdleConnsPerHost
+	if cfg.MaxIdleConnsPerHost > 0 {
+		t.MaxIdleConnsPerHost = cfg.MaxIdleConnsPerHost
+	}
+	if t.MaxIdleConns < t.MaxIdleConnsPerHost {
+		t.MaxIdleConns = t.MaxIdleConnsPerHost
+	}
+	t.IdleConnTimeout = defaultIdleConnTimeout
+	if cfg.IdleConnTimeout > 0 {
+		t.IdleConnTimeout = cfg.IdleConnTimeout
+	}
+	if cfg.DisableHTTP2 {
+		// a non-nil empty map turns off the automatic HTTP/2 upgrade
+		t.ForceAttemptHTTP2 = false
+		t.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+	}
+	return t
+}
+
+// SetProviderHeaders sets extra headers sent with every request to the provider,
+// e.g. for API gateways or beta feature flags. They apply to clients created afterwards
+// and replace headers of the same name set by the client library.
+func SetProviderHeaders(provider string, headers map[string]string) error {
+	if !isProvider(provider) {
+		return fmt.Errorf("unsupported provider: %s", provider)
+	}
+	h := make(map[string]string, len(headers))
+	for name, value := range headers {
+		if name == "" || strings.ContainsAny(name, " :\t\r\n") {
+			return fmt.Errorf("invalid header name for provider %s: %q", provider, name)
+		}
+		h[name] = value
+	}
+	if len(h) == 0 {
+		delete(providerHeaders, provider)
+		return nil
+	}
+	providerHeaders[provider] = h
+	return nil
+}
+
+// providerHTTPClient returns the HTTP client for a provider client library, or nil
+// if the library default should be used.
+func providerHTTPClient(provider string) *http.Client {
+	headers := envHeaders(provider)
+	for name, value := range providerHeaders[provider] {
+		headers[name] = value
+	}
+	return newHTTPClient(nil, headers, providerTimeouts[provider])
+}
+
+// newHTTPClient returns a copy of client, or a new client if it is nil, that sends
+// requests through the cassette and the debug log, if enabled, adds the headers and
+// applies the timeouts. Without a client of its own the configured transport is used.
+// It returns nil if there is nothing to add to the library default.
+func newHTTPClient(client *http.Client, headers map[string]string, timeouts Timeouts) *http.Client {
+	debug := httpDebugEnabled()
+	if client == nil && transport == nil && len(headers) == 0 && activeCassette == nil && !debug && timeouts == (Timeouts{}) {
+		return nil
+	}
+	c := &http.Client{}
+	if client != nil {
+		*c = *client
+	}
+	base := c.Transport
+	if base == nil {
+		base = transport
+	}
+	if base == nil {
+		base = defaultTransport
+	}
+	base = withConnectionTimeouts(base, timeouts)
+	if activeCassette != nil {
+		base = activeCassette.wrap(base)
+	}
+	if debug {
+		base = &debugTransport{base: base}
+	}
+	if len(headers) > 0 {
+		base = &headerTransport{base: base, headers: headers}
+	}
+	c.Transport = base
+	if timeouts.Total > 0 {
+		c.Timeout = timeouts.Total
+	}
+	return c
+}
+
+// envHeaders returns the headers set through provider environment variables:
+// OPENAI_ORG_ID and OPENAI_PROJECT_ID select the organization and project that
+// OpenAI requests are billed to.
+func envHeaders(provider string) map[string]string {
+	headers := make(map[string]string)
+	if provider == OpenAI {
+		if org := os.Getenv("OPENAI_ORG_ID"); org != "" {
+			headers["OpenAI-Organization"] = org
+		}
+		if project := os.Getenv("OPENAI_PROJECT_ID"); project != "" {
+			headers["OpenAI-Project"] = project
+		}
+	}
+	return headers
+}
+
+// apiHTTPClient returns the HTTP client for direct requests to the provider API.
+func apiHTTPClient(provider string) *http.Client {
+	if c := providerHTTPClient(provider); c != nil {
+		return c
+	}
+	return defaultClient
+}
+
+// HTTPClient returns an HTTP client that uses the configured transport, for
+// requests that are not specific to one provider.
+func HTTPClient() *http.Client {
+	if transport == nil {
+		return defaultClient
+	}
+	return &http.Client{Transport: transport}
+}
+
+// headerTransport adds fixed headers to every request.
+type headerTransport struct {
+	base    http.RoundTripper
+	headers map[string]string
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// a RoundTripper must not modify the caller's request
+	req = req.Clone(req.Context())
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,196 @@
+package sqirvy
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNewTransportCAFile(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	// trust the test server's self-signed certificate through a CA file
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caFile, certPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tr, err := newTransport(HTTPConfig{CAFile: caFile})
+	if err != nil {
+		t.Fatalf("newTransport() error = %v", err)
+	}
+	resp, err := (&http.Client{Transport: tr}).Get(server.URL)
+	if err != nil {
+		t.Fatalf("request with CA file failed: %v", err)
+	}
+	resp.Body.Close()
+
+	// without the CA file the certificate is rejected
+	if resp, err := http.Get(server.URL); err == nil {
+		resp.Body.Close()
+		t.Error("request without CA file succeeded, want a certificate error")
+	}
+}
+
+func TestNewTransportPool(t *testing.T) {
+	tests := []struct {
+		name        string
+		cfg         HTTPConfig
+		wantIdle    int
+		wantTimeout time.Duration
+		wantHTTP2   bool
+	}{
+		{name: "defaults", wantIdle: defaultMaxIdleConnsPerHost, wantTimeout: defaultIdleConnTimeout, wantHTTP2: true},
+		{name: "tuned pool", cfg: HTTPConfig{MaxIdleConnsPerHost: 64, IdleConnTimeout: time.Minute}, wantIdle: 64, wantTimeout: time.Minute, wantHTTP2: true},
+		{name: "HTTP/2 disabled", cfg: HTTPConfig{DisableHTTP2: true}, wantIdle: defaultMaxIdleConnsPerHost, wantTimeout: defaultIdleConnTimeout},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr, err := newTransport(tt.cfg)
+			if err != nil {
+				t.Fatalf("newTransport() error = %v", err)
+			}
+			if tr.MaxIdleConnsPerHost != tt.wantIdle || tr.MaxIdleConns < tt.wantIdle {
+				t.Errorf("idle connections = %d per host, %d total, want %d per host", tr.MaxIdleConnsPerHost, tr.MaxIdleConns, tt.wantIdle)
+			}
+			if tr.IdleConnTimeout != tt.wantTimeout {
+				t.Errorf("IdleConnTimeout = %v, want %v", tr.IdleConnTimeout, tt.wantTimeout)
+			}
+			if http2 := tr.ForceAttemptHTTP2 && tr.TLSNextProto == nil; http2 != tt.wantHTTP2 {
+				t.Errorf("HTTP/2 enabled = %v, want %v", http2, tt.wantHTTP2)
+			}
+		})
+	}
+
+	if defaultTransport.MaxIdleConnsPerHost != defaultMaxIdleConnsPerHost {
+		t.Errorf("shared transport keeps %d idle connections per host, want %d", defaultTransport.MaxIdleConnsPerHost, defaultMaxIdleConnsPerHost)
+	}
+}
+
+func TestNewTransportErrors(t *testing.T) {
+	dir := t.TempDir()
+	notPEM := filepath.Join(dir, "not.pem")
+	if err := os.WriteFile(notPEM, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		cfg  HTTPConfig
+	}{
+		{name: "Invalid proxy", cfg: HTTPConfig{Proxy: "://bad"}},
+		{name: "Negative idle connections", cfg: HTTPConfig{MaxIdleConnsPerHost: -1}},
+		{name: "Missing CA file", cfg: HTTPConfig{CAFile: filepath.Join(dir, "missing.pem")}},
+		{name: "CA file without certificates", cfg: HTTPConfig{CAFile: notPEM}},
+		{name: "Certificate without key", cfg: HTTPConfig{CertFile: notPEM}},
+		{name: "Invalid client certificate", cfg: HTTPConfig{CertFile: notPEM, KeyFile: notPEM}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newTransport(tt.cfg); err == nil {
+				t.Errorf("newTransport(%+v) error = nil, want an error", tt.cfg)
+			}
+		})
+	}
+}
+
+func TestHeaderTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Test") != "value" {
+			http.Error(w, "missing header", http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: &headerTransport{base: http.DefaultTransport, headers: map[string]string{"X-Test": "value"}}}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+}
+
+func TestSetProviderHeaders(t *testing.T) {
+	defer delete(providerHeaders, OpenAI)
+
+	if err := SetProviderHeaders("no-such-provider", map[string]string{"X-Test": "value"}); err == nil {
+		t.Error("SetProviderHeaders() error = nil for an unknown provider")
+	}
+	if err := SetProviderHeaders(OpenAI, map[string]string{"Bad Name": "value"}); err == nil {
+		t.Error("SetProviderHeaders() error = nil for an invalid header name")
+	}
+
+	if providerHTTPClient(OpenAI) != nil {
+		t.Fatal("providerHTTPClient() != nil without configuration")
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Test") != "value" {
+			http.Error(w, "missing header", http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	if err := SetProviderHeaders(OpenAI, map[string]string{"X-Test": "value"}); err != nil {
+		t.Fatalf("SetProviderHeaders() error = %v", err)
+	}
+	client := providerHTTPClient(OpenAI)
+	if client == nil {
+		t.Fatal("providerHTTPClient() = nil with headers configured")
+	}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+
+	// headers are per provider
+	if providerHTTPClient(Anthropic) != nil {
+		t.Error("providerHTTPClient(Anthropic) != nil, headers leaked to another provider")
+	}
+}
+
+func TestOpenAIProjectHeaders(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("OpenAI-Organization") != "org-test" || r.Header.Get("OpenAI-Project") != "proj_test" {
+			http.Error(w, "missing organization or project", http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	t.Setenv("OPENAI_ORG_ID", "org-test")
+	t.Setenv("OPENAI_PROJECT_ID", "proj_test")
+
+	client := providerHTTPClient(OpenAI)
+	if client == nil {
+		t.Fatal("providerHTTPClient() = nil with OPENAI_ORG_ID and OPENAI_PROJECT_ID set")
+	}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+
+	// the variables only apply to OpenAI
+	if providerHTTPClient(Llama) != nil {
+		t.Error("providerHTTPClient(Llama) != nil, OpenAI headers applied to another provider")
+	}
+}
@@ -0,0 +1,255 @@
+// Package sqirvy provides record and replay of provider HTTP traffic.
+//
+// A cassette is a JSON fixture file of request and response pairs. In record mode
+// every provider request is sent to the provider and the exchange is appended to
+// the cassette. In replay mode requests are answered from the cassette without
+// network access, so tests and demos run deterministically without API keys.
+// Request headers are never recorded, and the key query parameter is removed from
+// URLs, so cassettes do not contain credentials.
+package sqirvy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Interaction is one recorded request and its response.
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+// RecordedRequest is the part of a request that identifies it in a cassette.
+type RecordedRequest struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+	Body   string `json:"body,omitempty"`
+}
+
+// RecordedResponse is a recorded response.
+type RecordedResponse struct {
+	StatusCode  int    `json:"status_code"`
+	ContentType string `json:"content_type,omitempty"`
+	Body        string `json:"body"`
+}
+
+// Cassette holds the interactions recorded to or replayed from a fixture file.
+type Cassette struct {
+	mu           sync.Mutex
+	path         string
+	record       bool
+	Interactions []Interaction `json:"interactions"`
+	replayed     map[int]bool  // interactions already replayed
+}
+
+// activeCassette is the cassette used by provider clients, or nil.
+var activeCassette *Cassette
+
+// SetCassette records or replays provider traffic with the cassette for clients
+// created afterwards. A nil cassette sends requests to the providers.
+func SetCassette(c *Cassette) {
+	activeCassette = c
+}
+
+// RecordCassette returns an empty cassette that saves every interaction to path.
+func RecordCassette(path string) (*Cassette, error) {
+	c := &Cassette{path: path, record: true}
+	if err := c.save(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// LoadCassette returns a cassette that replays the interactions saved in path.
+func LoadCassette(path string) (*Cassette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading cassette: %w", err)
+	}
+	c := &Cassette{path: path, replayed: make(map[int]bool)}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("invalid cassette %s: %w", path, err)
+	}
+	return c, nil
+}
+
+// UseCassette is a test helper that runs the provider clients of a test against
+// the cassette at path. With SQIRVY_RECORD=1 in the environment the test talks to
+// the providers and records a new cassette; otherwise the cassette is replayed and
+// placeholder API keys are set for providers without one.
+func UseCassette(t testing.TB, path string) {
+	t.Helper()
+	var c *Cassette
+	var err error
+	if os.Getenv("SQIRVY_RECORD") == "1" {
+		c, err = RecordCassette(path)
+	} else {
+		c, err = LoadCassette(path)
+		for name, value := range replayEnv {
+			if os.Getenv(name) == "" {
+				t.Setenv(name, value)
+			}
+		}
+	}
+	if err != nil {
+		t.Fatalf("UseCassette: %v", err)
+	}
+	previous := activeCassette
+	SetCassette(c)
+	t.Cleanup(func() { SetCassette(previous) })
+}
+
+// replayEnv holds placeholder settings that let provider clients be created for replay.
+var replayEnv = map[string]string{
+	"ANTHROPIC_API_KEY": "sk-ant-replay-placeholder",
+	"GEMINI_API_KEY":    "replay-gemini-api-key-placeholder",
+	"OPENAI_API_KEY":    "replay-openai-api-key",
+	"LLAMA_API_KEY":     "replay-llama-api-key",
+	"LLAMA_BASE_URL":    "https://api.llama.com/compat/v1",
+}
+
+// SetReplayKeys sets placeholder API keys and base URLs for providers without
+// them, so that clients can be created to replay a cassette.
+func SetReplayKeys() {
+	for name, value := range replayEnv {
+		if os.Getenv(name) == "" {
+			os.Setenv(name, value)
+		}
+	}
+}
+
+// wrap returns a transport that records or replays requests through the cassette.
+func (c *Cassette) wrap(base http.RoundTripper) http.RoundTripper {
+	return &cassetteTransport{cassette: c, base: base}
+}
+
+// save writes the cassette to its file.
+func (c *Cassette) save() error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o755); err != nil {
+		return fmt.Errorf("writing cassette: %w", err)
+	}
+	if err := os.WriteFile(c.path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("writing cassette: %w", err)
+	}
+	return nil
+}
+
+// cassetteTransport records or replays requests.
+type cassetteTransport struct {
+	cassette *Cassette
+	base     http.RoundTripper
+}
+
+func (t *cassetteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	recorded, err := recordRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	if t.cassette.record {
+		return t.recordRoundTrip(req, recorded)
+	}
+	resp, ok := t.cassette.find(recorded)
+	if !ok {
+		return nil, fmt.Errorf("no recorded response in cassette %s for %s %s", t.cassette.path, recorded.Method, recorded.URL)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", resp.StatusCode, http.StatusText(resp.StatusCode)),
+		StatusCode:    resp.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{resp.ContentType}},
+		Body:          io.NopCloser(strings.NewReader(resp.Body)),
+		ContentLength: int64(len(resp.Body)),
+		Request:       req,
+	}, nil
+}
+
+// recordRoundTrip sends the request and appends the exchange to the cassette.
+func (t *cassetteTransport) recordRoundTrip(req *http.Request, recorded RecordedRequest) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	c := t.cassette
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Interactions = append(c.Interactions, Interaction{
+		Request:  recorded,
+		Response: RecordedResponse{StatusCode: resp.StatusCode, ContentType: resp.Header.Get("Content-Type"), Body: string(body)},
+	})
+	if err := c.save(); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// find returns the first recorded response to the request that has not been replayed
+// yet, or the last matching response if all of them have been replayed.
+func (c *Cassette) find(req RecordedRequest) (RecordedResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	last := -1
+	for i, in := range c.Interactions {
+		if in.Request != req {
+			continue
+		}
+		if !c.replayed[i] {
+			c.replayed[i] = true
+			return in.Response, true
+		}
+		last = i
+	}
+	if last < 0 {
+		return RecordedResponse{}, false
+	}
+	return c.Interactions[last].Response, true
+}
+
+// recordRequest returns the identifying part of a request, without credentials.
+// JSON bodies are compacted so formatting differences do not matter.
+func recordRequest(req *http.Request) (RecordedRequest, error) {
+	u := *req.URL
+	q := u.Query()
+	if q.Has("key") {
+		q.Del("key")
+		u.RawQuery = q.Encode()
+	}
+	recorded := RecordedRequest{Method: req.Method, URL: u.String()}
+
+	if req.Body == nil || req.Body == http.NoBody {
+		return recorded, nil
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return recorded, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, body); err == nil {
+		body = compact.Bytes()
+	}
+	recorded.Body = string(body)
+	return recorded, nil
+}
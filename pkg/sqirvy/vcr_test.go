@@ -0,0 +1,74 @@
+package sqirvy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCassetteRecordReplay(t *testing.T) {
+	defer SetCassette(nil)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"data": [{"id": "gpt-4o"}, {"id": "gpt-4o-mini"}]}`))
+	}))
+	t.Setenv("OPENAI_API_KEY", "secret-test-key")
+	t.Setenv("OPENAI_BASE_URL", server.URL+"/v1")
+	path := filepath.Join(t.TempDir(), "cassette.json")
+
+	// record
+	c, err := RecordCassette(path)
+	if err != nil {
+		t.Fatalf("RecordCassette() error = %v", err)
+	}
+	SetCassette(c)
+	recorded, err := ListRemoteModels(context.Background(), OpenAI)
+	if err != nil {
+		t.Fatalf("ListRemoteModels() while recording error = %v", err)
+	}
+	server.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "secret-test-key") {
+		t.Error("cassette contains the API key")
+	}
+
+	// replay with the server gone
+	c, err = LoadCassette(path)
+	if err != nil {
+		t.Fatalf("LoadCassette() error = %v", err)
+	}
+	SetCassette(c)
+	replayed, err := ListRemoteModels(context.Background(), OpenAI)
+	if err != nil {
+		t.Fatalf("ListRemoteModels() while replaying error = %v", err)
+	}
+	if !reflect.DeepEqual(replayed, recorded) {
+		t.Errorf("replayed models = %v, want %v", replayed, recorded)
+	}
+
+	// requests that were not recorded fail
+	if _, err := ListRemoteModels(context.Background(), Anthropic); err == nil {
+		t.Error("ListRemoteModels() error = nil for a request missing from the cassette")
+	}
+}
+
+func TestRecordRequest(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "https://example.com/v1/models?key=secret&pageSize=1", strings.NewReader("{\n  \"a\": 1\n}"))
+	got, err := recordRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := RecordedRequest{Method: http.MethodPost, URL: "https://example.com/v1/models?pageSize=1", Body: `{"a":1}`}
+	if got != want {
+		t.Errorf("recordRequest() = %+v, want %+v", got, want)
+	}
+}
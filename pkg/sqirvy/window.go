@@ -0,0 +1,99 @@
+// Package sqirvy provides the context window check of queries.
+//
+// Providers reject a request whose prompt plus response limit does not fit the
+// context window of the model, often with an error that does not say which input
+// is too large. Queries are therefore checked against the context window in the
+// model registry before they are sent, and a query that does not fit returns a
+// ContextWindowError naming its largest inputs.
+package sqirvy
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// maxListedInputs is the number of inputs listed by a ContextWindowError.
+const maxListedInputs = 3
+
+// InputEstimate is the estimated size of one input of a query.
+type InputEstimate struct {
+	Label  string // role and position of the message and its first line, e.g. `user message 2 "--- START FILE: main.go ---"`
+	Tokens int64  // estimated number of tokens
+}
+
+// ContextWindowError is returned for queries whose estimated prompt tokens plus
+// the response limit exceed the context window of the model.
+type ContextWindowError struct {
+	Model         string
+	ContextWindow int64           // context window of the model in tokens
+	InputTokens   int64           // estimated tokens of the prompt
+	MaxTokens     int64           // response limit of the query
+	Inputs        []InputEstimate // largest inputs first, at most three
+}
+
+func (e *ContextWindowError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "prompt of about %d tokens plus %d response tokens exceeds the %d token context window of %s",
+		e.InputTokens, e.MaxTokens, e.ContextWindow, e.Model)
+	if len(e.Inputs) > 0 {
+		b.WriteString("; largest inputs:")
+		for i, input := range e.Inputs {
+			if i > 0 {
+				b.WriteString(",")
+			}
+			fmt.Fprintf(&b, " %s (about %d tokens)", input.Label, input.Tokens)
+		}
+	}
+	b.WriteString("; remove inputs, lower the response limit or use a model with a larger context window")
+	return b.String()
+}
+
+// checkContextWindow returns a ContextWindowError if the estimated input tokens
+// plus the response limit of the request exceed the context window of the model.
+// Models without a known context window are not checked.
+func checkContextWindow(req chatRequest, estimate int64) error {
+	info, err := GetModelInfo(req.Model)
+	if err != nil || info.ContextWindow <= 0 || estimate+req.MaxTokens <= info.ContextWindow {
+		return nil
+	}
+	return &ContextWindowError{
+		Model:         req.Model,
+		ContextWindow: info.ContextWindow,
+		InputTokens:   estimate,
+		MaxTokens:     req.MaxTokens,
+		Inputs:        largestInputs(req.Messages, maxListedInputs),
+	}
+}
+
+// largestInputs returns the estimated sizes of the n largest messages.
+func largestInputs(messages []Message, n int) []InputEstimate {
+	inputs := make([]InputEstimate, 0, len(messages))
+	for i, m := range messages {
+		if m.Content == "" {
+			continue
+		}
+		inputs = append(inputs, InputEstimate{
+			Label:  fmt.Sprintf("%s message %d %q", m.Role, i+1, firstLine(m.Content, 60)),
+			Tokens: EstimateTokens("", []string{m.Content}),
+		})
+	}
+	slices.SortStableFunc(inputs, func(a, b InputEstimate) int { return cmp.Compare(b.Tokens, a.Tokens) })
+	return inputs[:min(n, len(inputs))]
+}
+
+// firstLine returns the first non-empty line of s, shortened to at most n bytes.
+func firstLine(s string, n int) string {
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if len(line) > n {
+			line = strings.ToValidUTF8(line[:n], "") + "..."
+		}
+		return line
+	}
+	return ""
+}
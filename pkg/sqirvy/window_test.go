@@ -0,0 +1,73 @@
+package sqirvy
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestContextWindow(t *testing.T) {
+	const model = "mock-small"
+	if err := RegisterModel(model, ModelInfo{Provider: Mock, MaxTokens: 100, ContextWindow: 1000}); err != nil {
+		t.Fatalf("RegisterModel() error = %v", err)
+	}
+	defer delete(modelRegistry, model)
+
+	client, err := NewMockClient()
+	if err != nil {
+		t.Fatalf("NewMockClient() error = %v", err)
+	}
+
+	big := "--- START FILE: big.log ---\n" + strings.Repeat("x", 4000) + "\n--- END FILE: big.log ---"
+	small := "--- START FILE: small.go ---\npackage main\n--- END FILE: small.go ---"
+	tests := []struct {
+		name      string
+		prompts   []string
+		maxTokens int64
+		wantErr   bool
+		wantFirst string // label of the largest input
+	}{
+		{name: "fits", prompts: []string{small}, maxTokens: 100},
+		{name: "prompt too large", prompts: []string{small, big}, maxTokens: 100, wantErr: true, wantFirst: `user message 3 "--- START FILE: big.log ---"`},
+		{name: "fits only without the response limit", prompts: []string{strings.Repeat("y", 3700)}, maxTokens: 100, wantErr: true, wantFirst: `user message 2 "yyyyyyyyyyyyyyyyyyyyyyyyyyyyyyyyyyyyyyyyyyyyyyyyyyyyyyyyyyyy..."`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := client.QueryText(context.Background(), "be brief", tt.prompts, model, Options{MaxTokens: tt.maxTokens})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("QueryText() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr {
+				return
+			}
+			var windowErr *ContextWindowError
+			if !errors.As(err, &windowErr) {
+				t.Fatalf("QueryText() error = %v, want a ContextWindowError", err)
+			}
+			if windowErr.ContextWindow != 1000 || windowErr.MaxTokens != tt.maxTokens {
+				t.Errorf("ContextWindowError = %+v", windowErr)
+			}
+			if len(windowErr.Inputs) == 0 || windowErr.Inputs[0].Label != tt.wantFirst {
+				t.Errorf("largest inputs = %+v, want %s first", windowErr.Inputs, tt.wantFirst)
+			}
+		})
+	}
+}
+
+func TestLargestInputs(t *testing.T) {
+	messages := []Message{
+		{Role: RoleSystem, Content: "system"},
+		{Role: RoleUser, Content: strings.Repeat("a", 40)},
+		{Role: RoleUser, Content: ""},
+		{Role: RoleUser, Content: strings.Repeat("b", 80)},
+		{Role: RoleAssistant, Content: strings.Repeat("c", 20)},
+	}
+	got := largestInputs(messages, 2)
+	if len(got) != 2 || !strings.HasPrefix(got[0].Label, "user message 4") || !strings.HasPrefix(got[1].Label, "user message 2") {
+		t.Errorf("largestInputs() = %+v, want user messages 4 and 2", got)
+	}
+	if got[0].Tokens != 21 {
+		t.Errorf("largestInputs() tokens = %d, want 21", got[0].Tokens)
+	}
+}
@@ -0,0 +1,285 @@
+// Package util provides utility functions for reading archives.
+//
+// Zip and tar archives, optionally gzip compressed, are extracted to a temporary
+// directory and their text files are returned with their paths in the archive,
+// transcoded to UTF-8.
+// Hidden files, dependency and build directories, binary files and the paths
+// matching the ignore patterns or the .gitignore files of the archive are
+// skipped.
+package util
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// ArchiveFile is a text file of an archive.
+type ArchiveFile struct {
+	Path     string // slash-separated path in the archive
+	Content  string // content transcoded to UTF-8
+	Encoding string // encoding of the file, see DetectEncoding
+}
+
+// IsArchiveFile reports whether a file is read as an archive by its extension:
+// .zip, .tar, .tar.gz or .tgz.
+func IsArchiveFile(name string) bool {
+	name = strings.ToLower(name)
+	for _, ext := range []string{".zip", ".tar", ".tar.gz", ".tgz"} {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadArchive extracts an archive to a temporary directory and returns its text
+// files sorted by path, skipping the paths matching the ignore patterns or those
+// of the .gitignore files of the archive. Patterns follow .gitignore: a pattern
+// without a slash matches a file or directory name at any depth, a pattern with a
+// slash matches a path from the root of the archive, or from the directory of the
+// .gitignore file, ** matches any number of directories and a trailing slash
+// matches directories only. Negated patterns are not supported. It is an error if
+// the extracted files exceed maxBytes bytes.
+func ReadArchive(name string, maxBytes int64, ignore []string) ([]ArchiveFile, error) {
+	dir, err := os.MkdirTemp("", "sqirvy-archive-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	if err := ExtractArchive(name, dir, maxBytes); err != nil {
+		return nil, err
+	}
+	// the patterns of the .gitignore file of each directory apply to the paths
+	// under it
+	ignores := map[string][]string{".": slices.Clip(ignore)}
+	var files []ArchiveFile
+	err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel != "." && (strings.HasPrefix(d.Name(), ".") || (d.IsDir() && repoMapSkipDirs[d.Name()]) || ignoredInArchive(ignores, rel, d.IsDir())) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			if patterns := readIgnoreFile(filepath.Join(p, ".gitignore")); patterns != nil {
+				ignores[rel] = append(ignores[rel], patterns...)
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		if _, binary := BinaryContentType(data); binary {
+			return nil
+		}
+		data, enc, err := ToUTF8(data)
+		if err != nil {
+			return nil
+		}
+		files = append(files, ArchiveFile{Path: rel, Content: string(data), Encoding: enc})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reading archive %s: %w", name, err)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files, nil
+}
+
+// ExtractArchive extracts the regular files and directories of a zip or tar
+// archive into dir. Links and other special files are skipped. It is an error if
+// an entry is outside dir or if the extracted files exceed maxBytes bytes.
+func ExtractArchive(name, dir string, maxBytes int64) error {
+	cleanPath, err := validateFilePath(name)
+	if err != nil {
+		return err
+	}
+	lower := strings.ToLower(name)
+	if strings.HasSuffix(lower, ".zip") {
+		err = extractZip(cleanPath, dir, maxBytes)
+	} else {
+		err = extractTar(cleanPath, dir, maxBytes, strings.HasSuffix(lower, ".gz") || strings.HasSuffix(lower, ".tgz"))
+	}
+	if err != nil {
+		return fmt.Errorf("extracting archive %s: %w", name, err)
+	}
+	return nil
+}
+
+// extractZip extracts a zip archive into dir.
+func extractZip(name, dir string, maxBytes int64) error {
+	zr, err := zip.OpenReader(name)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	var total int64
+	for _, f := range zr.File {
+		mode := f.Mode()
+		if !mode.IsRegular() && !mode.IsDir() {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		err = extractEntry(dir, f.Name, mode.IsDir(), rc, maxBytes, &total)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// extractTar extracts a tar archive, gzip compressed if gzipped is set, into dir.
+func extractTar(name, dir string, maxBytes int64, gzipped bool) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var r io.Reader = bufio.NewReader(f)
+	if gzipped {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+	tr := tar.NewReader(r)
+	var total int64
+	for {
+		h, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if h.Typeflag != tar.TypeReg && h.Typeflag != tar.TypeDir {
+			continue
+		}
+		if err := extractEntry(dir, h.Name, h.Typeflag == tar.TypeDir, tr, maxBytes, &total); err != nil {
+			return err
+		}
+	}
+}
+
+// extractEntry writes an entry of an archive under dir, adding its size to total.
+func extractEntry(dir, name string, isDir bool, r io.Reader, maxBytes int64, total *int64) error {
+	rel := filepath.FromSlash(path.Clean(strings.ReplaceAll(name, `\`, "/")))
+	if !filepath.IsLocal(rel) {
+		return fmt.Errorf("invalid path %s in archive", name)
+	}
+	target := filepath.Join(dir, rel)
+	if isDir {
+		return os.MkdirAll(target, 0o755)
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+	out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(out, io.LimitReader(r, maxBytes-*total+1))
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	*total += n
+	if *total > maxBytes {
+		return fmt.Errorf("extracted files exceed limit of %d bytes", maxBytes)
+	}
+	return nil
+}
+
+// readIgnoreFile returns the patterns of an ignore file, without comments and
+// blank lines, or nil if it cannot be read.
+func readIgnoreFile(name string) []string {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil
+	}
+	var patterns []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			patterns = append(patterns, line)
+		}
+	}
+	return patterns
+}
+
+// ignoredInArchive reports whether a slash-separated path in an archive matches
+// the ignore patterns of one of its directories, by directory.
+func ignoredInArchive(ignores map[string][]string, rel string, isDir bool) bool {
+	for d := path.Dir(rel); ; d = path.Dir(d) {
+		sub := rel
+		if d != "." {
+			sub = strings.TrimPrefix(rel, d+"/")
+		}
+		if ignoredByPatterns(ignores[d], sub, isDir) {
+			return true
+		}
+		if d == "." {
+			return false
+		}
+	}
+}
+
+// ignoredByPatterns reports whether a slash-separated relative path matches one
+// of the ignore patterns.
+func ignoredByPatterns(patterns []string, rel string, isDir bool) bool {
+	segments := strings.Split(rel, "/")
+	for _, p := range patterns {
+		if strings.HasPrefix(p, "!") {
+			continue
+		}
+		if strings.HasSuffix(p, "/") {
+			if !isDir {
+				continue
+			}
+			p = strings.TrimSuffix(p, "/")
+		}
+		if !strings.Contains(p, "/") {
+			if ok, _ := filepath.Match(p, segments[len(segments)-1]); ok {
+				return true
+			}
+			continue
+		}
+		if matchSegments(strings.Split(strings.TrimPrefix(p, "/"), "/"), segments) {
+			return true
+		}
+	}
+	return false
+}
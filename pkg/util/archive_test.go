@@ -0,0 +1,144 @@
+package util
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// archiveEntries are the files of the test archives, in order.
+var archiveEntries = [][2]string{
+	{"src/main.go", "package main\n"},
+	{"src/main.log", "log\n"},
+	{"src/gen/out.go", "package gen\n"},
+	{"docs/readme.md", "# docs\n"},
+	{"logo.png", "\x89PNG\x00\x00"},
+	{".env", "SECRET=1\n"},
+	{"node_modules/x/index.js", "x\n"},
+	{".gitignore", "# generated\n*.log\n"},
+	{"docs/drafts/todo.md", "todo\n"},
+	{"docs/.gitignore", "/drafts/\n"},
+	{"notes.txt", "\xFF\xFEh\x00i\x00"},
+}
+
+func writeZip(t *testing.T, name string, entries [][2]string) {
+	t.Helper()
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	for _, e := range entries {
+		w, err := zw.Create(e[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(e[1])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeTarGz(t *testing.T, name string, entries [][2]string) {
+	t.Helper()
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	for _, e := range entries {
+		if err := tw.WriteHeader(&tar.Header{Name: e[0], Mode: 0o644, Size: int64(len(e[1])), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e[1])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: "link", Linkname: "/etc/passwd", Typeflag: tar.TypeSymlink}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadArchive(t *testing.T) {
+	dir := t.TempDir()
+	writeZip(t, filepath.Join(dir, "a.zip"), archiveEntries)
+	writeTarGz(t, filepath.Join(dir, "a.tar.gz"), archiveEntries)
+	writeZip(t, filepath.Join(dir, "slip.zip"), [][2]string{{"../evil.txt", "x\n"}})
+
+	want := []ArchiveFile{
+		{Path: "docs/readme.md", Content: "# docs\n", Encoding: EncodingUTF8},
+		{Path: "notes.txt", Content: "hi", Encoding: EncodingUTF16LE},
+		{Path: "src/main.go", Content: "package main\n", Encoding: EncodingUTF8},
+	}
+	tests := []struct {
+		name     string
+		maxBytes int64
+		want     []ArchiveFile
+		wantErr  string
+	}{
+		{name: "a.zip", maxBytes: 1024, want: want},
+		{name: "a.tar.gz", maxBytes: 1024, want: want},
+		{name: "a.zip", maxBytes: 20, wantErr: "exceed limit"},
+		{name: "slip.zip", maxBytes: 1024, wantErr: "invalid path"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadArchive(filepath.Join(dir, tt.name), tt.maxBytes, []string{"src/gen/"})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ReadArchive() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ReadArchive() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ReadArchive() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+	if _, err := os.Stat(filepath.Join(dir, "evil.txt")); !os.IsNotExist(err) {
+		t.Errorf("entry outside the archive directory was extracted")
+	}
+}
+
+func TestIgnoredByPatterns(t *testing.T) {
+	patterns := []string{"*.log", "build/", "/docs/*.md", "src/**/testdata"}
+	tests := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{"app.log", false, true},
+		{"a/b/app.log", false, true},
+		{"build", true, true},
+		{"build", false, false},
+		{"docs/readme.md", false, true},
+		{"x/docs/readme.md", false, false},
+		{"src/a/b/testdata", true, true},
+		{"src/main.go", false, false},
+	}
+	for _, tt := range tests {
+		if got := ignoredByPatterns(patterns, tt.path, tt.isDir); got != tt.want {
+			t.Errorf("ignoredByPatterns(%q, %v) = %v, want %v", tt.path, tt.isDir, got, tt.want)
+		}
+	}
+}
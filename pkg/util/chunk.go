@@ -0,0 +1,164 @@
+// Package util provides utility functions for splitting source files into chunks.
+//
+// ChunkSource splits a file along the boundaries of its declarations, so that a
+// chunk never ends in the middle of a function or type unless the declaration
+// alone is larger than a chunk. Go files are split with go/parser at their
+// top-level declarations, with their doc comments. Other files are split at
+// unindented lines that follow a blank line, which are the starts of top-level
+// definitions in most languages.
+package util
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"strings"
+)
+
+// Chunk is a part of a source file.
+type Chunk struct {
+	Path      string
+	StartLine int // first line of the chunk, from 1
+	EndLine   int // last line of the chunk
+	Text      string
+}
+
+// ChunkSource splits the source of the file at path into chunks of at most
+// maxBytes bytes, merging consecutive declarations while they fit. A declaration
+// larger than maxBytes is split at line boundaries, and a line larger than
+// maxBytes is split at maxBytes. A maxBytes of 0 or less returns one chunk per
+// declaration.
+func ChunkSource(path string, src []byte, maxBytes int) []Chunk {
+	lines := strings.SplitAfter(string(src), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+
+	var starts []int
+	if filepath.Ext(path) == ".go" {
+		starts = goDeclStarts(path, src)
+	}
+	if starts == nil {
+		starts = blockStarts(lines)
+	}
+
+	// segments are the line ranges between the starts
+	var chunks []Chunk
+	add := func(start, end int) {
+		chunks = append(chunks, Chunk{Path: path, StartLine: start + 1, EndLine: end, Text: strings.Join(lines[start:end], "")})
+	}
+	chunkStart, size := 0, 0
+	for i, start := range starts {
+		end := len(lines)
+		if i+1 < len(starts) {
+			end = starts[i+1]
+		}
+		segment := 0
+		for _, line := range lines[start:end] {
+			segment += len(line)
+		}
+
+		switch {
+		case maxBytes <= 0:
+			add(start, end)
+			chunkStart = end
+		case size+segment <= maxBytes:
+			size += segment
+		default:
+			if size > 0 {
+				add(chunkStart, start)
+			}
+			chunkStart, size = start, segment
+			if segment > maxBytes {
+				chunks = append(chunks, splitLines(path, lines, start, end, maxBytes)...)
+				chunkStart, size = end, 0
+			}
+		}
+	}
+	if size > 0 {
+		add(chunkStart, len(lines))
+	}
+	return chunks
+}
+
+// goDeclStarts returns the first line, from 0, of each top-level declaration of
+// a Go file, including its doc comment, after the first line of the file. It
+// returns nil if the file does not parse.
+func goDeclStarts(path string, src []byte) []int {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, path, src, parser.ParseComments|parser.SkipObjectResolution)
+	if err != nil {
+		return nil
+	}
+	starts := []int{0}
+	for _, decl := range f.Decls {
+		pos := decl.Pos()
+		if doc := declDoc(decl); doc != nil {
+			pos = doc.Pos()
+		}
+		line := fset.Position(pos).Line - 1
+		if line > starts[len(starts)-1] {
+			starts = append(starts, line)
+		}
+	}
+	return starts
+}
+
+// declDoc returns the doc comment of a declaration, or nil.
+func declDoc(decl ast.Decl) *ast.CommentGroup {
+	switch d := decl.(type) {
+	case *ast.FuncDecl:
+		return d.Doc
+	case *ast.GenDecl:
+		return d.Doc
+	}
+	return nil
+}
+
+// blockStarts returns the first line of each block of a file: the first line of
+// the file and each unindented line after a blank line, unless it closes a block.
+func blockStarts(lines []string) []int {
+	starts := []int{0}
+	for i := 1; i < len(lines); i++ {
+		line := lines[i]
+		if strings.TrimSpace(lines[i-1]) != "" || strings.TrimSpace(line) == "" {
+			continue
+		}
+		if line[0] == ' ' || line[0] == '\t' || strings.ContainsAny(line[:1], "})]") {
+			continue
+		}
+		starts = append(starts, i)
+	}
+	return starts
+}
+
+// splitLines splits the lines from start to end into chunks of at most maxBytes.
+func splitLines(path string, lines []string, start, end, maxBytes int) []Chunk {
+	var chunks []Chunk
+	var b strings.Builder
+	first := start
+	flush := func(last int) {
+		if b.Len() > 0 {
+			chunks = append(chunks, Chunk{Path: path, StartLine: first + 1, EndLine: last, Text: b.String()})
+			b.Reset()
+		}
+	}
+	for i := start; i < end; i++ {
+		line := lines[i]
+		if b.Len()+len(line) > maxBytes {
+			flush(i)
+			first = i
+		}
+		for len(line) > maxBytes {
+			chunks = append(chunks, Chunk{Path: path, StartLine: i + 1, EndLine: i + 1, Text: line[:maxBytes]})
+			line = line[maxBytes:]
+		}
+		b.WriteString(line)
+	}
+	flush(end)
+	return chunks
+}
@@ -0,0 +1,82 @@
+package util
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestChunkSource(t *testing.T) {
+	goSrc := `package shapes
+
+import "math"
+
+// Circle is a circle.
+type Circle struct{ R float64 }
+
+// Area returns the area.
+func (c Circle) Area() float64 {
+	return math.Pi * c.R * c.R
+}
+
+func Unit() Circle {
+	return Circle{R: 1}
+}
+`
+	pySrc := "import os\n\n\ndef a():\n    x = 1\n\n    return x\n\n\nclass B:\n    pass\n"
+
+	tests := []struct {
+		name     string
+		path     string
+		src      string
+		maxBytes int
+		want     [][2]int // start and end line of each chunk
+	}{
+		{
+			name: "go declarations",
+			path: "shapes.go",
+			src:  goSrc,
+			want: [][2]int{{1, 2}, {3, 4}, {5, 7}, {8, 12}, {13, 15}},
+		},
+		{
+			name:     "go declarations merged while they fit",
+			path:     "shapes.go",
+			src:      goSrc,
+			maxBytes: 120,
+			want:     [][2]int{{1, 7}, {8, 12}, {13, 15}},
+		},
+		{
+			name:     "go declaration larger than a chunk split by lines",
+			path:     "shapes.go",
+			src:      goSrc,
+			maxBytes: 40,
+			want:     [][2]int{{1, 4}, {5, 5}, {6, 7}, {8, 8}, {9, 9}, {10, 12}, {13, 13}, {14, 15}},
+		},
+		{
+			name: "other languages at unindented lines after blank lines",
+			path: "b.py",
+			src:  pySrc,
+			want: [][2]int{{1, 3}, {4, 9}, {10, 11}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks := ChunkSource(tt.path, []byte(tt.src), tt.maxBytes)
+			var got [][2]int
+			var text strings.Builder
+			for _, c := range chunks {
+				got = append(got, [2]int{c.StartLine, c.EndLine})
+				text.WriteString(c.Text)
+				if tt.maxBytes > 0 && len(c.Text) > tt.maxBytes {
+					t.Errorf("chunk %d-%d is %d bytes, want at most %d", c.StartLine, c.EndLine, len(c.Text), tt.maxBytes)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ChunkSource() lines = %v, want %v", got, tt.want)
+			}
+			if text.String() != tt.src {
+				t.Errorf("ChunkSource() chunks do not add up to the source")
+			}
+		})
+	}
+}
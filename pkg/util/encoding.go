@@ -0,0 +1,172 @@
+// Package util provides utility functions for detecting the character encoding
+// of inputs and transcoding them to UTF-8.
+//
+// Models expect UTF-8. Files saved by other tools are often UTF-16 (with or
+// without a byte order mark), Shift-JIS or Latin-1, and would reach the model as
+// mojibake if they were sent as is.
+package util
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// Encodings detected by DetectEncoding
+const (
+	EncodingUTF8     = "utf-8"
+	EncodingUTF16LE  = "utf-16le"
+	EncodingUTF16BE  = "utf-16be"
+	EncodingShiftJIS = "shift_jis"
+	EncodingLatin1   = "latin-1" // ISO-8859-1, decoded as its superset Windows-1252
+)
+
+var (
+	utf8BOM    = []byte{0xEF, 0xBB, 0xBF}
+	utf16LEBOM = []byte{0xFF, 0xFE}
+	utf16BEBOM = []byte{0xFE, 0xFF}
+)
+
+// encodingSampleBytes is the size of the start of the data used to detect UTF-16
+// without a byte order mark.
+const encodingSampleBytes = 8000
+
+// DetectEncoding returns the encoding of text data: UTF-16 if it starts with a
+// byte order mark or has a NUL byte in every other position, UTF-8 if it is valid
+// UTF-8, Shift-JIS if it is valid Shift-JIS made mostly of two-byte characters,
+// and Latin-1 otherwise. It returns an empty string for binary data, which has
+// NUL bytes but is not UTF-16.
+func DetectEncoding(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, utf8BOM):
+		return EncodingUTF8
+	case bytes.HasPrefix(data, utf16LEBOM):
+		return EncodingUTF16LE
+	case bytes.HasPrefix(data, utf16BEBOM):
+		return EncodingUTF16BE
+	}
+	if enc := detectUTF16(data[:min(len(data), encodingSampleBytes)]); enc != "" {
+		return enc
+	}
+	if isBinary(data) {
+		return ""
+	}
+	if utf8.Valid(data) {
+		return EncodingUTF8
+	}
+	if isShiftJIS(data) {
+		return EncodingShiftJIS
+	}
+	return EncodingLatin1
+}
+
+// detectUTF16 returns the UTF-16 byte order of text without a byte order mark, in
+// which most characters are ASCII and have a NUL high byte, or an empty string.
+func detectUTF16(sample []byte) string {
+	if len(sample) < 2 {
+		return ""
+	}
+	var even, odd int
+	for i := 0; i+1 < len(sample); i += 2 {
+		if sample[i] == 0 {
+			even++
+		}
+		if sample[i+1] == 0 {
+			odd++
+		}
+	}
+	pairs := len(sample) / 2
+	switch {
+	case odd*10 >= pairs*4 && even*20 < pairs:
+		return EncodingUTF16LE
+	case even*10 >= pairs*4 && odd*20 < pairs:
+		return EncodingUTF16BE
+	}
+	return ""
+}
+
+// isShiftJIS reports whether data is valid Shift-JIS with two-byte characters, at
+// least half of which have a second byte outside ASCII. Latin-1 text, in which
+// an accented letter is usually followed by an ASCII letter, rarely qualifies.
+func isShiftJIS(data []byte) bool {
+	var pairs, highPairs int
+	for i := 0; i < len(data); i++ {
+		b := data[i]
+		switch {
+		case b < 0x80 || (b >= 0xA1 && b <= 0xDF): // ASCII or half-width katakana
+		case (b >= 0x81 && b <= 0x9F) || (b >= 0xE0 && b <= 0xFC):
+			if i+1 >= len(data) {
+				return false
+			}
+			t := data[i+1]
+			if t < 0x40 || t == 0x7F || t > 0xFC {
+				return false
+			}
+			pairs++
+			if t >= 0x80 {
+				highPairs++
+			}
+			i++
+		default:
+			return false
+		}
+	}
+	return pairs > 0 && highPairs*2 >= pairs
+}
+
+// ToUTF8 transcodes text data to UTF-8 from the encoding detected by
+// DetectEncoding, without a byte order mark, and returns the encoding. Binary
+// data is returned as is with an empty encoding.
+func ToUTF8(data []byte) ([]byte, string, error) {
+	enc := DetectEncoding(data)
+	var decoder encoding.Encoding
+	switch enc {
+	case "":
+		return data, "", nil
+	case EncodingUTF8:
+		return bytes.TrimPrefix(data, utf8BOM), enc, nil
+	case EncodingUTF16LE:
+		data = bytes.TrimPrefix(data, utf16LEBOM)
+		decoder = unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM)
+	case EncodingUTF16BE:
+		data = bytes.TrimPrefix(data, utf16BEBOM)
+		decoder = unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM)
+	case EncodingShiftJIS:
+		decoder = japanese.ShiftJIS
+	default:
+		decoder = charmap.Windows1252
+	}
+	text, err := decoder.NewDecoder().Bytes(data)
+	if err != nil {
+		return nil, enc, fmt.Errorf("transcoding %s to utf-8: %w", enc, err)
+	}
+	return text, enc, nil
+}
+
+// isBinary reports whether data looks like a binary file: it has a NUL byte in
+// its first 8000 bytes.
+func isBinary(data []byte) bool {
+	return bytes.IndexByte(data[:min(len(data), 8000)], 0) >= 0
+}
+
+// BinaryContentType reports whether data is binary rather than text, with its
+// MIME type sniffed by http.DetectContentType. Data is binary if its type is not
+// a text type, e.g. an image, a PDF or an archive, or if it has NUL bytes and is
+// not UTF-16 text.
+func BinaryContentType(data []byte) (string, bool) {
+	contentType := http.DetectContentType(data)
+	switch DetectEncoding(data) {
+	case "":
+		return contentType, true
+	case EncodingUTF16LE, EncodingUTF16BE:
+		return "text/plain; charset=utf-16", false
+	}
+	return contentType, !strings.HasPrefix(contentType, "text/")
+}
@@ -0,0 +1,69 @@
+package util
+
+import (
+	"testing"
+)
+
+func TestToUTF8(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		want     string
+		wantEnc  string
+		wantSame bool // binary data is returned as is
+	}{
+		{name: "ascii", data: []byte("hello\n"), want: "hello\n", wantEnc: EncodingUTF8},
+		{name: "utf-8 with bom", data: []byte("\xEF\xBB\xBFcafé"), want: "café", wantEnc: EncodingUTF8},
+		{name: "utf-16le with bom", data: []byte{0xFF, 0xFE, 'h', 0, 'i', 0, 0xE9, 0}, want: "hié", wantEnc: EncodingUTF16LE},
+		{name: "utf-16be with bom", data: []byte{0xFE, 0xFF, 0, 'h', 0, 'i'}, want: "hi", wantEnc: EncodingUTF16BE},
+		{name: "utf-16le without bom", data: []byte{'a', 0, ',', 0, 'b', 0, '\n', 0}, want: "a,b\n", wantEnc: EncodingUTF16LE},
+		{name: "latin-1", data: []byte("caf\xE9 na\xEFve \x93quoted\x94"), want: "café naïve “quoted”", wantEnc: EncodingLatin1},
+		{name: "latin-1 letter before ascii", data: []byte("\xE9lan"), want: "élan", wantEnc: EncodingLatin1},
+		{name: "shift-jis", data: []byte("\x82\xB1\x82\xF1\x82\xC9\x82\xBF\x82\xCD, world"), want: "こんにちは, world", wantEnc: EncodingShiftJIS},
+		{name: "binary", data: []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\xff\xfe"), wantEnc: "", wantSame: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, enc, err := ToUTF8(tt.data)
+			if err != nil {
+				t.Fatalf("ToUTF8() error = %v", err)
+			}
+			if enc != tt.wantEnc {
+				t.Errorf("ToUTF8() encoding = %q, want %q", enc, tt.wantEnc)
+			}
+			if tt.wantSame {
+				if string(got) != string(tt.data) {
+					t.Errorf("ToUTF8() = %q, want the data as is", got)
+				}
+				return
+			}
+			if string(got) != tt.want {
+				t.Errorf("ToUTF8() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBinaryContentType(t *testing.T) {
+	tests := []struct {
+		name       string
+		data       []byte
+		wantType   string
+		wantBinary bool
+	}{
+		{"text", []byte("package main\n"), "text/plain; charset=utf-8", false},
+		{"latin-1 text", []byte("caf\xE9\n"), "text/plain; charset=utf-8", false},
+		{"utf-16 text", []byte{'a', 0, 'b', 0, '\n', 0}, "text/plain; charset=utf-16", false},
+		{"png", []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), "image/png", true},
+		{"pdf", []byte("%PDF-1.7\n"), "application/pdf", true},
+		{"control bytes", []byte("ab\x01\x02cd"), "application/octet-stream", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotType, gotBinary := BinaryContentType(tt.data)
+			if gotType != tt.wantType || gotBinary != tt.wantBinary {
+				t.Errorf("BinaryContentType() = %q, %v, want %q, %v", gotType, gotBinary, tt.wantType, tt.wantBinary)
+			}
+		})
+	}
+}
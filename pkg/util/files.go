@@ -19,7 +19,7 @@ func IsFromStdin() (bool, error) {
 	return (fileInfo.Mode() & os.ModeNamedPipe) != 0, err
 }
 
-// ReadStdin reads and concatenates the contents of stdin,
+// ReadStdin reads and concatenates the contents of stdin, transcoded to UTF-8,
 func ReadStdin(maxTotalBytes int64) (data string, size int64, err error) {
 	pipe, err := IsFromStdin()
 
@@ -40,6 +40,11 @@ func ReadStdin(maxTotalBytes int64) (data string, size int64, err error) {
 	if size > maxTotalBytes {
 		return "", 0, fmt.Errorf("total size would exceed limit of %d bytes", maxTotalBytes)
 	}
+	// transcode text that is not UTF-8, e.g. UTF-16 from PowerShell
+	stdinBytes, _, err = ToUTF8(stdinBytes)
+	if err != nil {
+		return "", 0, fmt.Errorf("error reading from stdin: %w", err)
+	}
 	// wrap thje input in backticks
 	s := "```stdin\n" + string(stdinBytes) + "```"
 	return s, size, nil
@@ -0,0 +1,31 @@
+// Package util provides utility functions for prompt files with frontmatter.
+//
+// A prompt file can start with a YAML block between --- lines that holds the
+// settings of the prompt, e.g. its model and temperature.
+package util
+
+import "strings"
+
+// frontmatterDelimiter is the line that opens and closes the frontmatter.
+const frontmatterDelimiter = "---"
+
+// SplitFrontmatter splits text into its frontmatter and its body. The frontmatter
+// is the text between a first line of --- and the next line of ---. If text does
+// not start with frontmatter, it is returned as the body and ok is false.
+func SplitFrontmatter(text string) (front, body string, ok bool) {
+	first, rest, found := strings.Cut(text, "\n")
+	if !found || strings.TrimSpace(first) != frontmatterDelimiter {
+		return "", text, false
+	}
+	var lines []string
+	for rest != "" {
+		var line string
+		line, rest, _ = strings.Cut(rest, "\n")
+		if strings.TrimSpace(line) == frontmatterDelimiter {
+			return strings.Join(lines, "\n"), rest, true
+		}
+		lines = append(lines, strings.TrimRight(line, "\r"))
+	}
+	// no closing delimiter: the text is not frontmatter
+	return "", text, false
+}
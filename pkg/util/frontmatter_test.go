@@ -0,0 +1,46 @@
+package util
+
+import "testing"
+
+func TestSplitFrontmatter(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		wantFront string
+		wantBody  string
+		wantOK    bool
+	}{
+		{
+			name:      "frontmatter",
+			text:      "---\nmodel: gpt-4o\ntemperature: 0\n---\nExtract the data.\n",
+			wantFront: "model: gpt-4o\ntemperature: 0",
+			wantBody:  "Extract the data.\n",
+			wantOK:    true,
+		},
+		{
+			name:      "crlf",
+			text:      "---\r\nformat: json\r\n---\r\nbody",
+			wantFront: "format: json",
+			wantBody:  "body",
+			wantOK:    true,
+		},
+		{
+			name:      "empty frontmatter",
+			text:      "---\n---\nbody",
+			wantFront: "",
+			wantBody:  "body",
+			wantOK:    true,
+		},
+		{name: "no frontmatter", text: "Extract the data.\n---\n", wantBody: "Extract the data.\n---\n"},
+		{name: "unclosed", text: "---\nmodel: gpt-4o\n", wantBody: "---\nmodel: gpt-4o\n"},
+		{name: "single line", text: "---", wantBody: "---"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			front, body, ok := SplitFrontmatter(tt.text)
+			if front != tt.wantFront || body != tt.wantBody || ok != tt.wantOK {
+				t.Errorf("SplitFrontmatter() = (%q, %q, %v), want (%q, %q, %v)", front, body, ok, tt.wantFront, tt.wantBody, tt.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestGlob(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"main.go", "README.md", "pkg/util/files.go", "pkg/util/files_test.go", "pkg/doc.md"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		pattern string
+		want    []string
+	}{
+		{
+			name:    "Plain glob",
+			pattern: "*.go",
+			want:    []string{"main.go"},
+		},
+		{
+			name:    "Recursive glob",
+			pattern: "**/*.go",
+			want:    []string{"main.go", "pkg/util/files.go", "pkg/util/files_test.go"},
+		},
+		{
+			name:    "Recursive glob under a directory",
+			pattern: "pkg/**/*.md",
+			want:    []string{"pkg/doc.md"},
+		},
+		{
+			name:    "Recursive glob in the middle",
+			pattern: "pkg/**/files_*.go",
+			want:    []string{"pkg/util/files_test.go"},
+		},
+		{
+			name:    "Directories are not matched",
+			pattern: "pkg/*",
+			want:    []string{"pkg/doc.md"},
+		},
+		{
+			name:    "No matches",
+			pattern: "**/*.rs",
+			want:    nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Glob(filepath.Join(dir, tt.pattern))
+			if err != nil {
+				t.Fatalf("Glob(%q) error = %v", tt.pattern, err)
+			}
+			var rel []string
+			for _, g := range got {
+				r, err := filepath.Rel(dir, g)
+				if err != nil {
+					t.Fatal(err)
+				}
+				rel = append(rel, filepath.ToSlash(r))
+			}
+			if !reflect.DeepEqual(rel, tt.want) {
+				t.Errorf("Glob(%q) = %v, want %v", tt.pattern, rel, tt.want)
+			}
+		})
+	}
+
+	if _, err := Glob(filepath.Join(dir, "**", "[")); err == nil {
+		t.Error("Glob() error = nil for an invalid pattern")
+	}
+}
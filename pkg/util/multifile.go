@@ -0,0 +1,140 @@
+// Package util provides utility functions for multi-file output.
+//
+// Models write several files in one response in the same format sqirvy-cli uses
+// for file inputs:
+//
+//	--- START FILE: cmd/main.go ---
+//	package main
+//	--- END FILE: cmd/main.go ---
+//
+// Text outside the blocks, e.g. explanations, is ignored.
+package util
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	startFileMarker = "--- START FILE: "
+	endFileMarker   = "--- END FILE: "
+	markerSuffix    = " ---"
+)
+
+// OutputFile is one file of a multi-file response.
+type OutputFile struct {
+	Path    string // slash-separated path relative to the output directory
+	Content string
+}
+
+// ParseFiles returns the files of a multi-file response in order. A code fence
+// around the whole content of a file is removed. It is an error if a file is
+// not terminated, if a path is not a relative path inside the output directory,
+// if a path is repeated, or if there are no files.
+func ParseFiles(s string) ([]OutputFile, error) {
+	var files []OutputFile
+	seen := make(map[string]bool)
+	lines := strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		name, ok := fileMarker(lines[i], startFileMarker)
+		if !ok {
+			continue
+		}
+		if err := checkOutputPath(name); err != nil {
+			return nil, err
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("file %s is repeated", name)
+		}
+		seen[name] = true
+
+		end := -1
+		for j := i + 1; j < len(lines); j++ {
+			if endName, ok := fileMarker(lines[j], endFileMarker); ok && endName == name {
+				end = j
+				break
+			}
+		}
+		if end < 0 {
+			return nil, fmt.Errorf("file %s has no END FILE marker", name)
+		}
+		files = append(files, OutputFile{Path: name, Content: stripFence(lines[i+1 : end])})
+		i = end
+	}
+	if len(files) == 0 {
+		return nil, errors.New("no files found in the response")
+	}
+	return files, nil
+}
+
+// fileMarker returns the path of a START FILE or END FILE marker line.
+func fileMarker(line, prefix string) (string, bool) {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, prefix) || !strings.HasSuffix(line, markerSuffix) {
+		return "", false
+	}
+	name := strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(line, prefix), markerSuffix))
+	return name, name != ""
+}
+
+// stripFence joins the lines of a file, without a code fence around all of them.
+func stripFence(lines []string) string {
+	if len(lines) >= 2 && strings.HasPrefix(strings.TrimSpace(lines[0]), "```") && strings.TrimSpace(lines[len(lines)-1]) == "```" {
+		lines = lines[1 : len(lines)-1]
+	}
+	content := strings.Join(lines, "\n")
+	if content != "" {
+		content += "\n"
+	}
+	return content
+}
+
+// checkOutputPath returns an error unless name is a relative path that stays
+// inside the output directory.
+func checkOutputPath(name string) error {
+	clean := path.Clean(filepath.ToSlash(name))
+	if path.IsAbs(clean) || filepath.IsAbs(name) || filepath.VolumeName(name) != "" {
+		return fmt.Errorf("file %s: path must be relative", name)
+	}
+	if clean == "." || clean == ".." || strings.HasPrefix(clean, "../") {
+		return fmt.Errorf("file %s: path must be inside the output directory", name)
+	}
+	return nil
+}
+
+// WriteFiles writes the files below dir, creating directories as needed. Files
+// starting with #! are made executable.
+// Existing files are only replaced if overwrite is true; otherwise nothing is
+// written if any file exists.
+func WriteFiles(dir string, files []OutputFile, overwrite bool) error {
+	for _, f := range files {
+		if err := checkOutputPath(f.Path); err != nil {
+			return err
+		}
+		if overwrite {
+			continue
+		}
+		if _, err := os.Lstat(filepath.Join(dir, filepath.FromSlash(f.Path))); err == nil {
+			return fmt.Errorf("file %s exists", filepath.Join(dir, filepath.FromSlash(f.Path)))
+		}
+	}
+	for _, f := range files {
+		target := filepath.Join(dir, filepath.FromSlash(path.Clean(f.Path)))
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return err
+		}
+		// scripts are written executable
+		mode := os.FileMode(0o644)
+		if strings.HasPrefix(f.Content, "#!") {
+			mode = 0o755
+		}
+		if err := os.WriteFile(target, []byte(f.Content), mode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
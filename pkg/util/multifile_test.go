@@ -0,0 +1,86 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseFiles(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []OutputFile
+		wantErr bool
+	}{
+		{
+			name: "two files with prose",
+			input: "Here is the project.\n--- START FILE: go.mod ---\nmodule example.com/x\n--- END FILE: go.mod ---\n\n" +
+				"--- START FILE: cmd/main.go ---\npackage main\n\nfunc main() {}\n--- END FILE: cmd/main.go ---\nDone.",
+			want: []OutputFile{
+				{Path: "go.mod", Content: "module example.com/x\n"},
+				{Path: "cmd/main.go", Content: "package main\n\nfunc main() {}\n"},
+			},
+		},
+		{
+			name:  "fenced content",
+			input: "--- START FILE: a.py ---\n```python\nprint(1)\n```\n--- END FILE: a.py ---",
+			want:  []OutputFile{{Path: "a.py", Content: "print(1)\n"}},
+		},
+		{
+			name:  "end marker of another file is content",
+			input: "--- START FILE: a.md ---\n--- END FILE: b.md ---\n--- END FILE: a.md ---",
+			want:  []OutputFile{{Path: "a.md", Content: "--- END FILE: b.md ---\n"}},
+		},
+		{
+			name:  "empty file",
+			input: "--- START FILE: .keep ---\n--- END FILE: .keep ---",
+			want:  []OutputFile{{Path: ".keep", Content: ""}},
+		},
+		{name: "no files", input: "just prose", wantErr: true},
+		{name: "unterminated", input: "--- START FILE: a.go ---\npackage a", wantErr: true},
+		{name: "absolute path", input: "--- START FILE: /etc/passwd ---\nx\n--- END FILE: /etc/passwd ---", wantErr: true},
+		{name: "escaping path", input: "--- START FILE: ../x ---\nx\n--- END FILE: ../x ---", wantErr: true},
+		{name: "repeated path", input: "--- START FILE: a ---\n--- END FILE: a ---\n--- START FILE: a ---\n--- END FILE: a ---", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseFiles(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseFiles() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseFiles() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteFiles(t *testing.T) {
+	dir := t.TempDir()
+	files := []OutputFile{
+		{Path: "cmd/main.go", Content: "package main\n"},
+		{Path: "build.sh", Content: "#!/bin/sh\ngo build ./...\n"},
+	}
+	if err := WriteFiles(dir, files, false); err != nil {
+		t.Fatalf("WriteFiles() error = %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "cmd", "main.go"))
+	if err != nil || string(data) != "package main\n" {
+		t.Errorf("cmd/main.go = %q, %v", data, err)
+	}
+	if info, err := os.Stat(filepath.Join(dir, "build.sh")); err != nil || info.Mode().Perm()&0o100 == 0 {
+		t.Errorf("build.sh is not executable: %v", err)
+	}
+
+	if err := WriteFiles(dir, files, false); err == nil {
+		t.Error("WriteFiles() replaced existing files without overwrite")
+	}
+	if err := WriteFiles(dir, []OutputFile{{Path: "cmd/main.go", Content: "package other\n"}}, true); err != nil {
+		t.Fatalf("WriteFiles() with overwrite error = %v", err)
+	}
+	if err := WriteFiles(dir, []OutputFile{{Path: "../outside", Content: "x"}}, true); err == nil {
+		t.Error("WriteFiles() wrote outside the directory")
+	}
+}
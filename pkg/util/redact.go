@@ -0,0 +1,87 @@
+// Package util provides utility functions for redacting secrets and personal
+// data from prompts before they are sent to a provider.
+//
+// A rule is a named regular expression. If the expression has a capture group,
+// only the first group is masked, e.g. the value of password=..., otherwise the
+// whole match is masked.
+package util
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// RedactRule is a named pattern of sensitive data.
+type RedactRule struct {
+	Name    string
+	Pattern *regexp.Regexp
+}
+
+// RedactCount is the number of matches of a rule in a text.
+type RedactCount struct {
+	Rule  string
+	Count int
+}
+
+// DefaultRedactRules detect common API keys, credentials and email addresses.
+var DefaultRedactRules = []RedactRule{
+	{Name: "private-key", Pattern: regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`)},
+	{Name: "aws-access-key", Pattern: regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{Name: "api-key", Pattern: regexp.MustCompile(`\b(?:sk-(?:ant-|proj-)?[A-Za-z0-9_-]{20,}|AIza[0-9A-Za-z_-]{35}|gh[pousr]_[A-Za-z0-9]{36,}|xox[abprs]-[A-Za-z0-9-]{10,})`)},
+	{Name: "jwt", Pattern: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`)},
+	{Name: "password", Pattern: regexp.MustCompile(`(?i)(?:password|passwd|pwd|secret|api[_-]?key|access[_-]?token|auth[_-]?token)\b["']?\s*[:=]\s*["']?([^\s"',;\[][^\s"',;]*)`)},
+	{Name: "email", Pattern: regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}\b`)},
+}
+
+// NewRedactRule compiles a rule from a regular expression.
+func NewRedactRule(name, pattern string) (RedactRule, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return RedactRule{}, fmt.Errorf("redact rule %s: %w", name, err)
+	}
+	return RedactRule{Name: name, Pattern: re}, nil
+}
+
+// RedactMask returns the text that replaces a match of a rule.
+func RedactMask(rule string) string {
+	return "[REDACTED:" + rule + "]"
+}
+
+// Redact masks the matches of the rules in text, applying the rules in order, and
+// returns the masked text and the number of matches of each rule that matched,
+// sorted by rule name.
+func Redact(text string, rules []RedactRule) (string, []RedactCount) {
+	counts := make(map[string]int)
+	for _, rule := range rules {
+		text = rule.Pattern.ReplaceAllStringFunc(text, func(match string) string {
+			counts[rule.Name]++
+			mask := RedactMask(rule.Name)
+			if rule.Pattern.NumSubexp() == 0 {
+				return mask
+			}
+			// mask only the first group, e.g. the value of password=...
+			loc := rule.Pattern.FindStringSubmatchIndex(match)
+			if loc == nil || loc[2] < 0 {
+				return mask
+			}
+			return match[:loc[2]] + mask + match[loc[3]:]
+		})
+	}
+	result := make([]RedactCount, 0, len(counts))
+	for name, n := range counts {
+		result = append(result, RedactCount{Rule: name, Count: n})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Rule < result[j].Rule })
+	return text, result
+}
+
+// FormatRedactCounts formats counts for messages, e.g. "api-key (2), email (1)".
+func FormatRedactCounts(counts []RedactCount) string {
+	parts := make([]string, len(counts))
+	for i, c := range counts {
+		parts[i] = fmt.Sprintf("%s (%d)", c.Rule, c.Count)
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,334 @@
+// Package util provides utility functions for building repository maps.
+//
+// A repository map is a condensed outline of a source tree: its files and the
+// signatures of the exported symbols of each file, without the bodies. It gives
+// an LLM the structure of a large codebase in a small number of tokens. Go files
+// are parsed with go/parser; Python, JavaScript, TypeScript, Rust and Java files
+// are outlined with regular expressions.
+//
+// When the map does not fit its budget, the files whose symbols are referenced
+// most by the other files are kept with their signatures, then the paths of the
+// next files are listed, and the rest are counted.
+package util
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// maxRepoMapFileBytes skips larger files, which are usually generated.
+const maxRepoMapFileBytes = 1024 * 1024
+
+// RepoMapFile is the outline of a source file.
+type RepoMapFile struct {
+	Path    string   // slash-separated path relative to the root of the map
+	Symbols []string // signatures of the exported symbols, in source order
+	Score   int      // number of references to the symbols from the other files
+}
+
+// repoMapSkipDirs are directories of dependencies, build output and test data.
+var repoMapSkipDirs = map[string]bool{
+	"node_modules": true, "vendor": true, "testdata": true, "dist": true,
+	"build": true, "target": true, "__pycache__": true, "venv": true,
+}
+
+// symbolPatterns outline the files of languages other than Go. The first group
+// of a match is the signature.
+var symbolPatterns = map[string]*regexp.Regexp{
+	".py":   regexp.MustCompile(`(?m)^((?:class|def|async def) [A-Za-z]\w*.*?):[ \t]*(?:#.*)?$`),
+	".js":   regexp.MustCompile(`(?m)^(export (?:default )?(?:async )?(?:function\*?|class|const|let) [\w$]+[^{=\n]*)`),
+	".ts":   regexp.MustCompile(`(?m)^(export (?:default )?(?:abstract )?(?:async )?(?:function\*?|class|const|let|interface|type|enum) [\w$]+[^{=\n]*)`),
+	".rs":   regexp.MustCompile(`(?m)^\s*(pub (?:async )?(?:fn|struct|enum|trait|type|const|mod) \w+[^{;\n]*)`),
+	".java": regexp.MustCompile(`(?m)^\s*(public (?:(?:static|final|abstract|sealed) )*(?:class|interface|enum|record|[\w<>\[\], ]+ \w+\s*\()[^{;\n]*)`),
+}
+
+func init() {
+	symbolPatterns[".jsx"] = symbolPatterns[".js"]
+	symbolPatterns[".mjs"] = symbolPatterns[".js"]
+	symbolPatterns[".tsx"] = symbolPatterns[".ts"]
+}
+
+// symbolKeywords precede the name of a symbol in the signatures of symbolPatterns.
+var symbolKeywords = map[string]bool{
+	"class": true, "def": true, "function": true, "function*": true, "const": true, "let": true, "interface": true,
+	"type": true, "enum": true, "fn": true, "struct": true, "trait": true, "mod": true, "record": true,
+}
+
+// identifierPattern matches the identifiers counted as references.
+var identifierPattern = regexp.MustCompile(`[A-Za-z_][A-Za-z0-9_]*`)
+
+// BuildRepoMap outlines the source files under root, skipping hidden directories,
+// dependencies, build output, test data and Go test files. The files are sorted by
+// path.
+func BuildRepoMap(root string) ([]RepoMapFile, error) {
+	var files []RepoMapFile
+	names := make(map[string]int)         // file of each symbol name, -1 if defined in several
+	refs := make([]map[string]bool, 0, 8) // identifiers used by each file
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != root && (strings.HasPrefix(d.Name(), ".") || repoMapSkipDirs[d.Name()]) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		ext := filepath.Ext(path)
+		if (ext != ".go" && symbolPatterns[ext] == nil) || strings.HasSuffix(path, "_test.go") || !d.Type().IsRegular() {
+			return nil
+		}
+		if info, err := d.Info(); err != nil || info.Size() > maxRepoMapFileBytes {
+			return nil
+		}
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+
+		symbols, symbolNames := outlineFile(path, src)
+		for _, name := range symbolNames {
+			if _, ok := names[name]; ok {
+				names[name] = -1
+			} else {
+				names[name] = len(files)
+			}
+		}
+		used := make(map[string]bool)
+		for _, id := range identifierPattern.FindAllString(string(src), -1) {
+			used[id] = true
+		}
+		refs = append(refs, used)
+		files = append(files, RepoMapFile{Path: filepath.ToSlash(rel), Symbols: symbols})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("building repo map of %s: %w", root, err)
+	}
+
+	// score each file by the files that use its symbols
+	for name, i := range names {
+		if i < 0 {
+			continue
+		}
+		for j, used := range refs {
+			if j != i && used[name] {
+				files[i].Score++
+			}
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files, nil
+}
+
+// outlineFile returns the signatures and the names of the exported symbols of a
+// source file.
+func outlineFile(path string, src []byte) (signatures []string, names []string) {
+	if filepath.Ext(path) == ".go" {
+		return outlineGo(path, src)
+	}
+	for _, m := range symbolPatterns[filepath.Ext(path)].FindAllSubmatch(src, -1) {
+		sig := strings.Join(strings.Fields(string(m[1])), " ")
+		fields := strings.FieldsFunc(sig, func(r rune) bool { return r == ' ' || r == '(' || r == '<' || r == ':' })
+		name := ""
+		for i := 1; i < len(fields); i++ {
+			if symbolKeywords[fields[i-1]] {
+				name = fields[i]
+				break
+			}
+		}
+		if strings.HasPrefix(name, "_") {
+			continue
+		}
+		signatures = append(signatures, sig)
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return signatures, names
+}
+
+// outlineGo returns the package clause and the signatures and names of the exported
+// declarations of a Go file. Files that do not parse are listed without symbols.
+func outlineGo(path string, src []byte) (signatures []string, names []string) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, path, src, parser.SkipObjectResolution)
+	if err != nil {
+		return nil, nil
+	}
+	signatures = append(signatures, "package "+f.Name.Name)
+	for _, decl := range f.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if !d.Name.IsExported() || (d.Recv != nil && !exportedReceiver(d.Recv)) {
+				continue
+			}
+			fn := *d
+			fn.Doc, fn.Body = nil, nil
+			signatures = append(signatures, printNode(fset, &fn))
+			names = append(names, d.Name.Name)
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					if !s.Name.IsExported() {
+						continue
+					}
+					signatures = append(signatures, "type "+s.Name.Name+typeKind(fset, s))
+					names = append(names, s.Name.Name)
+				case *ast.ValueSpec:
+					var exported []string
+					for _, n := range s.Names {
+						if n.IsExported() {
+							exported = append(exported, n.Name)
+						}
+					}
+					if len(exported) > 0 {
+						signatures = append(signatures, d.Tok.String()+" "+strings.Join(exported, ", "))
+						names = append(names, exported...)
+					}
+				}
+			}
+		}
+	}
+	return signatures, names
+}
+
+// exportedReceiver reports whether the receiver type of a method is exported.
+func exportedReceiver(recv *ast.FieldList) bool {
+	if len(recv.List) == 0 {
+		return false
+	}
+	t := recv.List[0].Type
+	if star, ok := t.(*ast.StarExpr); ok {
+		t = star.X
+	}
+	switch x := t.(type) {
+	case *ast.IndexExpr:
+		t = x.X
+	case *ast.IndexListExpr:
+		t = x.X
+	}
+	id, ok := t.(*ast.Ident)
+	return ok && id.IsExported()
+}
+
+// typeKind describes a type declaration after its name: struct and interface
+// types by their kind, other types by their definition.
+func typeKind(fset *token.FileSet, s *ast.TypeSpec) string {
+	switch s.Type.(type) {
+	case *ast.StructType:
+		return " struct"
+	case *ast.InterfaceType:
+		return " interface"
+	}
+	if s.Assign.IsValid() {
+		return " = " + printNode(fset, s.Type)
+	}
+	return " " + printNode(fset, s.Type)
+}
+
+// printNode prints a syntax node on one line.
+func printNode(fset *token.FileSet, node any) string {
+	var b bytes.Buffer
+	if err := printer.Fprint(&b, fset, node); err != nil {
+		return ""
+	}
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+// FormatRepoMap formats the outlines in at most maxBytes bytes, 0 for no limit.
+// Each file is a line with its path followed by its symbols, indented.
+func FormatRepoMap(files []RepoMapFile, maxBytes int) string {
+	full := formatRepoMapFiles(files, nil)
+	if maxBytes <= 0 || len(full) <= maxBytes {
+		return full
+	}
+
+	// keep the most referenced files, with their symbols while they fit, then as
+	// paths only
+	ranked := make([]int, len(files))
+	for i := range ranked {
+		ranked[i] = i
+	}
+	sort.SliceStable(ranked, func(a, b int) bool { return files[ranked[a]].Score > files[ranked[b]].Score })
+
+	detail := make(map[int]bool) // files with symbols
+	listed := make(map[int]bool) // files with or without symbols
+	size := 0
+	for _, i := range ranked {
+		if n := len(formatRepoMapFile(files[i], true)); size+n <= maxBytes {
+			detail[i], listed[i] = true, true
+			size += n
+		}
+	}
+	for _, i := range ranked {
+		if listed[i] {
+			continue
+		}
+		if n := len(formatRepoMapFile(files[i], false)); size+n <= maxBytes {
+			listed[i] = true
+			size += n
+		}
+	}
+
+	var kept []RepoMapFile
+	var withSymbols []bool
+	for i, f := range files {
+		if listed[i] {
+			kept = append(kept, f)
+			withSymbols = append(withSymbols, detail[i])
+		}
+	}
+	text := formatRepoMapFiles(kept, withSymbols)
+	if omitted := len(files) - len(kept); omitted > 0 {
+		text += fmt.Sprintf("... %d more files\n", omitted)
+	}
+	return text
+}
+
+// formatRepoMapFiles formats the files, with their symbols unless withSymbols is
+// set and false for the file.
+func formatRepoMapFiles(files []RepoMapFile, withSymbols []bool) string {
+	var b strings.Builder
+	for i, f := range files {
+		b.WriteString(formatRepoMapFile(f, withSymbols == nil || withSymbols[i]))
+	}
+	return b.String()
+}
+
+// formatRepoMapFile formats one file of a repo map.
+func formatRepoMapFile(f RepoMapFile, withSymbols bool) string {
+	var b strings.Builder
+	b.WriteString(f.Path + "\n")
+	if withSymbols {
+		for _, s := range f.Symbols {
+			b.WriteString("\t" + s + "\n")
+		}
+	}
+	return b.String()
+}
+
+// RepoMap builds the repository map of the source tree under root in at most
+// maxBytes bytes, 0 for no limit.
+func RepoMap(root string, maxBytes int) (string, error) {
+	files, err := BuildRepoMap(root)
+	if err != nil {
+		return "", err
+	}
+	return FormatRepoMap(files, maxBytes), nil
+}
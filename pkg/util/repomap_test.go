@@ -0,0 +1,111 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBuildRepoMap(t *testing.T) {
+	dir := t.TempDir()
+	sources := map[string]string{
+		"store/store.go": `package store
+
+// Store keeps items.
+type Store struct{ items []string }
+
+type Option func(*Store)
+
+const MaxItems, minItems = 10, 1
+
+// New returns a store.
+func New(opts ...Option) *Store { return &Store{} }
+
+func (s *Store) Add(item string) error {
+	return nil
+}
+
+func (s *Store) reset() {}
+
+func helper() {}
+`,
+		"store/store_test.go":       "package store\n\nfunc TestX() {}\n",
+		"main.go":                   "package main\n\nfunc main() { store.New() }\n",
+		"tools/report.py":           "import os\n\nclass Report(Base):\n    def render(self):\n        pass\n\ndef build_report(path: str) -> Report:\n    pass\n\ndef _private():\n    pass\n",
+		"web/api.ts":                "export interface User { id: string }\nexport async function fetchUser(id: string): Promise<User> {\n}\nfunction local() {}\n",
+		"node_modules/lib/index.js": "export function ignored() {}\n",
+		".git/hooks/x.py":           "def ignored():\n    pass\n",
+		"README.md":                 "# readme\n",
+	}
+	for name, src := range sources {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, err := BuildRepoMap(dir)
+	if err != nil {
+		t.Fatalf("BuildRepoMap() error = %v", err)
+	}
+	want := []RepoMapFile{
+		{Path: "main.go", Symbols: []string{"package main"}},
+		{Path: "store/store.go", Score: 1, Symbols: []string{
+			"package store",
+			"type Store struct",
+			"type Option func(*Store)",
+			"const MaxItems",
+			"func New(opts ...Option) *Store",
+			"func (s *Store) Add(item string) error",
+		}},
+		{Path: "tools/report.py", Symbols: []string{"class Report(Base)", "def build_report(path: str) -> Report"}},
+		{Path: "web/api.ts", Symbols: []string{"export interface User", "export async function fetchUser(id: string): Promise<User>"}},
+	}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("BuildRepoMap() = %+v, want %+v", files, want)
+	}
+}
+
+func TestFormatRepoMap(t *testing.T) {
+	files := []RepoMapFile{
+		{Path: "a.go", Symbols: []string{"package a", "func A()"}},
+		{Path: "b.go", Score: 3, Symbols: []string{"package b", "func B()"}},
+		{Path: "c.go", Symbols: []string{"package c", "func C()"}},
+	}
+	tests := []struct {
+		name     string
+		maxBytes int
+		want     string
+	}{
+		{
+			name: "unlimited",
+			want: "a.go\n\tpackage a\n\tfunc A()\nb.go\n\tpackage b\n\tfunc B()\nc.go\n\tpackage c\n\tfunc C()\n",
+		},
+		{
+			name:     "most referenced file with symbols, the others as paths",
+			maxBytes: 40,
+			want:     "a.go\nb.go\n\tpackage b\n\tfunc B()\nc.go\n",
+		},
+		{
+			name:     "omitted files counted",
+			maxBytes: 33,
+			want:     "a.go\nb.go\n\tpackage b\n\tfunc B()\n... 1 more files\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := FormatRepoMap(files, tt.maxBytes)
+			if got != tt.want {
+				t.Errorf("FormatRepoMap() = %q, want %q", got, tt.want)
+			}
+			if tt.maxBytes > 0 && len(strings.TrimSuffix(got, "... 1 more files\n")) > tt.maxBytes {
+				t.Errorf("FormatRepoMap() is %d bytes, want at most %d", len(got), tt.maxBytes)
+			}
+		})
+	}
+}
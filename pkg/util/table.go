@@ -0,0 +1,364 @@
+// Package util provides utility functions for converting tabular files to
+// Markdown.
+//
+// CSV, TSV and Excel (.xlsx) files are read into rows and formatted as Markdown
+// tables. A table with more rows than a limit is replaced by its header, a sample
+// of its rows and summary statistics of its columns, so that large datasets fit
+// in a prompt.
+package util
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// IsTableFile reports whether a file is read as a table by its extension: .csv,
+// .tsv or .xlsx.
+func IsTableFile(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".csv", ".tsv", ".xlsx":
+		return true
+	}
+	return false
+}
+
+// ReadTable reads the rows of a CSV, TSV or Excel file of at most maxBytes bytes.
+// CSV and TSV files are transcoded to UTF-8. The rows of an Excel file are those
+// of its first worksheet.
+func ReadTable(name string, maxBytes int64) ([][]string, error) {
+	ext := strings.ToLower(filepath.Ext(name))
+	if ext == ".xlsx" {
+		return readXLSX(name, maxBytes)
+	}
+	data, _, err := ReadFile(name, maxBytes)
+	if err != nil {
+		return nil, err
+	}
+	// spreadsheets often export UTF-16 or Latin-1 text
+	if data, _, err = ToUTF8(data); err != nil {
+		return nil, fmt.Errorf("reading table %s: %w", name, err)
+	}
+	r := csv.NewReader(bytes.NewReader(data))
+	if ext == ".tsv" {
+		r.Comma = '\t'
+	}
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	rows, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("reading table %s: %w", name, err)
+	}
+	return rows, nil
+}
+
+// FormatTable formats rows as a Markdown table with the first row as the header.
+// If there are more than maxRows data rows, only sampleRows of them are kept, the
+// first half from the start of the table and the rest evenly spaced over the
+// remainder, and the table is followed by summary statistics of its columns.
+// A maxRows of 0 or less keeps all rows.
+func FormatTable(rows [][]string, maxRows, sampleRows int) string {
+	if len(rows) == 0 {
+		return ""
+	}
+	header, data := rows[0], rows[1:]
+	width := len(header)
+	for _, row := range data {
+		width = max(width, len(row))
+	}
+
+	if maxRows <= 0 || len(data) <= maxRows {
+		return markdownTable(header, data, width)
+	}
+	sampleRows = max(0, min(sampleRows, len(data)))
+	sample := make([][]string, 0, sampleRows)
+	for _, i := range sampleIndexes(len(data), sampleRows) {
+		sample = append(sample, data[i])
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d rows, %d columns; showing a sample of %d rows.\n\n", len(data), width, len(sample))
+	b.WriteString(markdownTable(header, sample, width))
+	b.WriteString("\nColumn statistics:\n\n")
+	b.WriteString(markdownTable(columnStatsHeader, columnStats(header, data, width), len(columnStatsHeader)))
+	return b.String()
+}
+
+// sampleIndexes returns n indexes of rows out of total: the first half of them
+// from the start, the rest evenly spaced over the remaining rows, ending at the
+// last row.
+func sampleIndexes(total, n int) []int {
+	head := (n + 1) / 2
+	indexes := make([]int, 0, n)
+	for i := 0; i < head; i++ {
+		indexes = append(indexes, i)
+	}
+	rest := n - head
+	for k := 1; k <= rest; k++ {
+		indexes = append(indexes, head-1+k*(total-head)/rest)
+	}
+	return indexes
+}
+
+// columnStatsHeader is the header of the statistics of the columns.
+var columnStatsHeader = []string{"column", "type", "non-empty", "distinct", "min", "max", "mean / most common"}
+
+// columnStats returns the statistics of each column: the number of non-empty and
+// distinct values, and the minimum, maximum and mean of numeric columns or the
+// most common value of text columns.
+func columnStats(header []string, data [][]string, width int) [][]string {
+	stats := make([][]string, 0, width)
+	for c := 0; c < width; c++ {
+		name := ""
+		if c < len(header) {
+			name = header[c]
+		}
+		counts := make(map[string]int)
+		nonEmpty, numbers := 0, 0
+		var lo, hi, sum float64
+		for _, row := range data {
+			if c >= len(row) || strings.TrimSpace(row[c]) == "" {
+				continue
+			}
+			value := strings.TrimSpace(row[c])
+			counts[value]++
+			nonEmpty++
+			f, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			if numbers == 0 || f < lo {
+				lo = f
+			}
+			if numbers == 0 || f > hi {
+				hi = f
+			}
+			sum += f
+			numbers++
+		}
+
+		row := []string{name, "text", strconv.Itoa(nonEmpty), strconv.Itoa(len(counts)), "", "", ""}
+		switch {
+		case nonEmpty == 0:
+			row[1] = "empty"
+		case numbers == nonEmpty:
+			row[1] = "number"
+			row[4] = strconv.FormatFloat(lo, 'g', 6, 64)
+			row[5] = strconv.FormatFloat(hi, 'g', 6, 64)
+			row[6] = strconv.FormatFloat(sum/float64(numbers), 'g', 6, 64)
+		default:
+			values := make([]string, 0, len(counts))
+			for v := range counts {
+				values = append(values, v)
+			}
+			sort.Strings(values)
+			row[4], row[5] = values[0], values[len(values)-1]
+			sort.SliceStable(values, func(i, j int) bool { return counts[values[i]] > counts[values[j]] })
+			row[6] = fmt.Sprintf("%s (%d)", values[0], counts[values[0]])
+		}
+		stats = append(stats, row)
+	}
+	return stats
+}
+
+// markdownTable formats a Markdown table of width columns.
+func markdownTable(header []string, rows [][]string, width int) string {
+	var b strings.Builder
+	writeRow := func(row []string) {
+		b.WriteString("|")
+		for c := 0; c < width; c++ {
+			cell := ""
+			if c < len(row) {
+				cell = markdownCell(row[c])
+			}
+			b.WriteString(" " + cell + " |")
+		}
+		b.WriteString("\n")
+	}
+	writeRow(header)
+	b.WriteString("|" + strings.Repeat(" --- |", width) + "\n")
+	for _, row := range rows {
+		writeRow(row)
+	}
+	return b.String()
+}
+
+// markdownCell escapes a value for a cell of a Markdown table.
+func markdownCell(s string) string {
+	s = strings.ReplaceAll(strings.TrimSpace(s), "|", `\|`)
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// TableToMarkdown reads a tabular file of at most maxBytes bytes and formats it
+// with FormatTable.
+func TableToMarkdown(name string, maxBytes int64, maxRows, sampleRows int) (string, error) {
+	rows, err := ReadTable(name, maxBytes)
+	if err != nil {
+		return "", err
+	}
+	return FormatTable(rows, maxRows, sampleRows), nil
+}
+
+// xlsxCell is a cell of an Excel worksheet.
+type xlsxCell struct {
+	Ref    string `xml:"r,attr"`
+	Type   string `xml:"t,attr"`
+	Value  string `xml:"v"`
+	Inline struct {
+		Text string `xml:",innerxml"`
+	} `xml:"is"`
+}
+
+// xlsxText is a string of the shared strings or an inline string, with its rich
+// text runs.
+type xlsxText struct {
+	Text string   `xml:"t"`
+	Runs []string `xml:"r>t"`
+}
+
+// String returns the text with its runs.
+func (t xlsxText) String() string {
+	return t.Text + strings.Join(t.Runs, "")
+}
+
+// readXLSX reads the rows of the first worksheet of an Excel file, with at most
+// maxBytes bytes of uncompressed XML in each part. Formulas are read as their
+// cached values and dates as their serial numbers.
+func readXLSX(name string, maxBytes int64) ([][]string, error) {
+	cleanPath, err := validateFilePath(name)
+	if err != nil {
+		return nil, err
+	}
+	zr, err := zip.OpenReader(cleanPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading Excel file %s: %w", name, err)
+	}
+	defer zr.Close()
+	parts := make(map[string]*zip.File)
+	for _, f := range zr.File {
+		parts[f.Name] = f
+	}
+	decode := func(part string, v any) error {
+		f, ok := parts[part]
+		if !ok {
+			return fmt.Errorf("missing %s", part)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		lr := &io.LimitedReader{R: rc, N: maxBytes + 1}
+		err = xml.NewDecoder(lr).Decode(v)
+		if lr.N <= 0 {
+			return fmt.Errorf("%s exceeds limit of %d bytes", part, maxBytes)
+		}
+		return err
+	}
+
+	sheet, err := firstSheet(decode)
+	if err != nil {
+		return nil, fmt.Errorf("reading Excel file %s: %w", name, err)
+	}
+	var shared struct {
+		Items []xlsxText `xml:"si"`
+	}
+	if _, ok := parts["xl/sharedStrings.xml"]; ok {
+		if err := decode("xl/sharedStrings.xml", &shared); err != nil {
+			return nil, fmt.Errorf("reading Excel file %s: %w", name, err)
+		}
+	}
+	var ws struct {
+		Rows []struct {
+			Cells []xlsxCell `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+	if err := decode(sheet, &ws); err != nil {
+		return nil, fmt.Errorf("reading Excel file %s: %w", name, err)
+	}
+
+	rows := make([][]string, 0, len(ws.Rows))
+	for _, r := range ws.Rows {
+		var row []string
+		for i, c := range r.Cells {
+			col := columnIndex(c.Ref)
+			if col < 0 {
+				col = i
+			}
+			for len(row) <= col {
+				row = append(row, "")
+			}
+			switch c.Type {
+			case "s":
+				if n, err := strconv.Atoi(c.Value); err == nil && n >= 0 && n < len(shared.Items) {
+					row[col] = shared.Items[n].String()
+				}
+			case "inlineStr":
+				var t xlsxText
+				if err := xml.Unmarshal([]byte("<is>"+c.Inline.Text+"</is>"), &t); err == nil {
+					row[col] = t.String()
+				}
+			case "b":
+				row[col] = map[string]string{"0": "FALSE", "1": "TRUE"}[c.Value]
+			default:
+				row[col] = c.Value
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// firstSheet returns the name of the part of the first worksheet of a workbook.
+func firstSheet(decode func(part string, v any) error) (string, error) {
+	var workbook struct {
+		Sheets []struct {
+			ID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := decode("xl/workbook.xml", &workbook); err != nil {
+		return "", err
+	}
+	if len(workbook.Sheets) == 0 {
+		return "", fmt.Errorf("no worksheets")
+	}
+	var rels struct {
+		Relationships []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if err := decode("xl/_rels/workbook.xml.rels", &rels); err != nil {
+		return "", err
+	}
+	for _, r := range rels.Relationships {
+		if r.ID == workbook.Sheets[0].ID {
+			if strings.HasPrefix(r.Target, "/") {
+				return strings.TrimPrefix(r.Target, "/"), nil
+			}
+			return path.Join("xl", r.Target), nil
+		}
+	}
+	return "", fmt.Errorf("worksheet %s not found", workbook.Sheets[0].ID)
+}
+
+// columnIndex returns the index, from 0, of the column of a cell reference such
+// as "B7", or -1 if it has no column.
+func columnIndex(ref string) int {
+	col := 0
+	for _, r := range ref {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		col = col*26 + int(r-'A'+1)
+	}
+	return col - 1
+}
@@ -0,0 +1,132 @@
+package util
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestReadTable(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"a.csv": "\ufeffname,qty\n\"Smith, J\",3\nLee,\n",
+		"b.tsv": "name\tqty\nSmith, J\t3\n",
+		"d.csv": "name,qty\nM\xFCller,3\n",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeXLSX(t, filepath.Join(dir, "c.xlsx"), map[string]string{
+		"[Content_Types].xml":        `<Types/>`,
+		"xl/workbook.xml":            `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="Data" sheetId="1" r:id="rId2"/><sheet name="Other" sheetId="2" r:id="rId1"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Target="worksheets/sheet1.xml"/><Relationship Id="rId2" Target="worksheets/sheet2.xml"/></Relationships>`,
+		"xl/sharedStrings.xml":       `<sst><si><t>name</t></si><si><t>qty</t></si><si><r><t>Smith, </t></r><r><t>J</t></r></si></sst>`,
+		"xl/worksheets/sheet1.xml":   `<worksheet><sheetData><row r="1"><c r="A1"><v>1</v></c></row></sheetData></worksheet>`,
+		"xl/worksheets/sheet2.xml":   `<worksheet><sheetData><row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="s"><v>1</v></c></row><row r="2"><c r="A2" t="s"><v>2</v></c><c r="C2"><v>3</v></c></row><row r="3"><c r="A3" t="inlineStr"><is><t>Lee</t></is></c><c r="B3" t="b"><v>1</v></c></row></sheetData></worksheet>`,
+	})
+
+	tests := []struct {
+		name string
+		want [][]string
+	}{
+		{"a.csv", [][]string{{"name", "qty"}, {"Smith, J", "3"}, {"Lee", ""}}},
+		{"b.tsv", [][]string{{"name", "qty"}, {"Smith, J", "3"}}},
+		{"d.csv", [][]string{{"name", "qty"}, {"Müller", "3"}}},
+		{"c.xlsx", [][]string{{"name", "qty"}, {"Smith, J", "", "3"}, {"Lee", "TRUE"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadTable(filepath.Join(dir, tt.name), 1024)
+			if err != nil {
+				t.Fatalf("ReadTable() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ReadTable() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := ReadTable(filepath.Join(dir, "a.csv"), 10); err == nil {
+		t.Error("ReadTable() over the limit error = nil, want an error")
+	}
+}
+
+func writeXLSX(t *testing.T, path string, parts map[string]string) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	for name, data := range parts {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFormatTable(t *testing.T) {
+	rows := [][]string{{"id", "city", "note"}}
+	for i := 1; i <= 10; i++ {
+		city := "Oslo"
+		if i%3 == 0 {
+			city = "Rome"
+		}
+		rows = append(rows, []string{strconv.Itoa(i), city})
+	}
+
+	tests := []struct {
+		name       string
+		rows       [][]string
+		maxRows    int
+		sampleRows int
+		want       string
+	}{
+		{
+			name:    "all rows",
+			rows:    [][]string{{"a", "b|c"}, {"1"}, {"x\ny", "2"}},
+			maxRows: 10,
+			want:    "| a | b\\|c |\n| --- | --- |\n| 1 |  |\n| x y | 2 |\n",
+		},
+		{
+			name:       "sample and statistics",
+			rows:       rows,
+			maxRows:    5,
+			sampleRows: 4,
+			want: "10 rows, 3 columns; showing a sample of 4 rows.\n\n" +
+				"| id | city | note |\n| --- | --- | --- |\n" +
+				"| 1 | Oslo |  |\n| 2 | Oslo |  |\n| 6 | Rome |  |\n| 10 | Oslo |  |\n" +
+				"\nColumn statistics:\n\n" +
+				"| column | type | non-empty | distinct | min | max | mean / most common |\n" +
+				"| --- | --- | --- | --- | --- | --- | --- |\n" +
+				"| id | number | 10 | 10 | 1 | 10 | 5.5 |\n" +
+				"| city | text | 10 | 2 | Oslo | Rome | Oslo (7) |\n" +
+				"| note | empty | 0 | 0 |  |  |  |\n",
+		},
+		{
+			name: "empty",
+			rows: nil,
+			want: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FormatTable(tt.rows, tt.maxRows, tt.sampleRows); got != tt.want {
+				t.Errorf("FormatTable() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
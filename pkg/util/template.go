@@ -0,0 +1,46 @@
+// Package util provides utility functions for parameterized prompts.
+//
+// Prompts can be Go templates with variables, e.g. "Review the {{.service}}
+// service", and the env function, e.g. {{env "USER"}}, so teams can keep
+// reusable prompts for recurring tasks.
+package util
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// ParseVars parses key=value pairs into a map. Later pairs replace earlier ones.
+func ParseVars(pairs []string) (map[string]string, error) {
+	vars := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		key, value, ok := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid variable %q: use key=value", pair)
+		}
+		vars[key] = value
+	}
+	return vars, nil
+}
+
+// RenderTemplate executes text as a Go template with vars as its data. The env
+// function returns the value of an environment variable. A variable used by the
+// template that is not in vars is an error, so that a typo does not silently
+// produce an empty value.
+func RenderTemplate(name, text string, vars map[string]string) (string, error) {
+	t, err := template.New(name).
+		Option("missingkey=error").
+		Funcs(template.FuncMap{"env": os.Getenv}).
+		Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err := t.Execute(&b, vars); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,62 @@
+package util
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseVars(t *testing.T) {
+	tests := []struct {
+		name    string
+		pairs   []string
+		want    map[string]string
+		wantErr bool
+	}{
+		{name: "pairs", pairs: []string{"service=billing", "env=prod"}, want: map[string]string{"service": "billing", "env": "prod"}},
+		{name: "value with equals", pairs: []string{"query=a=b"}, want: map[string]string{"query": "a=b"}},
+		{name: "empty value", pairs: []string{"note="}, want: map[string]string{"note": ""}},
+		{name: "later wins", pairs: []string{"a=1", "a=2"}, want: map[string]string{"a": "2"}},
+		{name: "missing equals", pairs: []string{"service"}, wantErr: true},
+		{name: "empty key", pairs: []string{"=x"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseVars(tt.pairs)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseVars() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseVars() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderTemplate(t *testing.T) {
+	t.Setenv("SQIRVY_TEST_TEAM", "payments")
+
+	tests := []struct {
+		name    string
+		text    string
+		vars    map[string]string
+		want    string
+		wantErr bool
+	}{
+		{name: "variable", text: "Review the {{.service}} service", vars: map[string]string{"service": "billing"}, want: "Review the billing service"},
+		{name: "env", text: `Team {{env "SQIRVY_TEST_TEAM"}}`, want: "Team payments"},
+		{name: "no template", text: "plain text", want: "plain text"},
+		{name: "missing variable", text: "{{.service}}", vars: map[string]string{}, wantErr: true},
+		{name: "invalid template", text: "{{.service", vars: map[string]string{"service": "x"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := RenderTemplate(tt.name, tt.text, tt.vars)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RenderTemplate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("RenderTemplate() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}